@@ -39,6 +39,11 @@ const (
 	MimetypeDataWithValidator = "data/validator"
 	MimetypeTypedData         = "data/typed"
 	MimetypeClique            = "application/x-clique-header"
+	MimetypeEquaStatement     = "application/x-equa-statement"
+	MimetypeEquaTimestamp     = "application/x-equa-timestamp"
+	MimetypeEquaDecryption    = "application/x-equa-decryption-share"
+	MimetypeEquaInclusionList = "application/x-equa-inclusion-list"
+	MimetypeEquaOrderingClaim = "application/x-equa-ordering-claim"
 	MimetypeTextPlain         = "text/plain"
 )
 
@@ -78,6 +78,7 @@ var (
 		executablePath("geth"),
 		executablePath("rlpdump"),
 		executablePath("clef"),
+		executablePath("equactl"),
 	}
 
 	// A debian package is created for all executables listed here.
@@ -102,6 +103,10 @@ var (
 			BinaryName:  "clef",
 			Description: "Ethereum account management tool.",
 		},
+		{
+			BinaryName:  "equactl",
+			Description: "EQUA node operator tool querying the execution client and beacon node.",
+		},
 	}
 
 	// A debian package is created for all executables listed here.
@@ -0,0 +1,128 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/equa/go-equa/rpc"
+)
+
+// errNoBeacon is returned for beacon queries if no beacon node is configured.
+var errNoBeacon = errors.New("no beacon node configured")
+
+// client queries the execution client and the beacon node of an operator.
+type client struct {
+	el     *rpc.Client
+	beacon string // Base URL of the beacon node API, empty if not configured
+	http   *http.Client
+}
+
+// dial connects to the execution client. The beacon node is only contacted
+// when queried.
+func dial(ctx context.Context, endpoint, beacon string) (*client, error) {
+	el, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to execution client: %v", err)
+	}
+	return &client{
+		el:     el,
+		beacon: strings.TrimSuffix(beacon, "/"),
+		http:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// close disconnects from the execution client.
+func (c *client) close() {
+	c.el.Close()
+}
+
+// call invokes an RPC method of the execution client, returning the result as
+// generic JSON with numbers kept verbatim.
+func (c *client) call(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	var raw json.RawMessage
+	if err := c.el.CallContext(ctx, &raw, method, args...); err != nil {
+		return nil, err
+	}
+	return decodeJSON(raw)
+}
+
+// beaconGet requests a path of the beacon node API, returning the data field of
+// the response. Responses other than 200 OK are reported along with their
+// status, as some endpoints signal their result through it.
+func (c *client) beaconGet(ctx context.Context, path string) (interface{}, error) {
+	if c.beacon == "" {
+		return nil, errNoBeacon
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.beacon+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 10*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("beacon node returned %s", res.Status)
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	return decodeJSON(envelope.Data)
+}
+
+// decodeJSON decodes a JSON value into generic maps and slices.
+func decodeJSON(raw []byte) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// optional turns the failure of a query whose result is only supplementary
+// into a placeholder, so that the rest of the output is still shown.
+func optional(v interface{}, err error) interface{} {
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return v
+}
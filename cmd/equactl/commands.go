@@ -0,0 +1,212 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/urfave/cli/v2"
+)
+
+// query retrieves the data shown by a command.
+type query func(ctx context.Context, c *client, cmd *cli.Context) (interface{}, error)
+
+var (
+	blocksFlag = &cli.IntFlag{
+		Name:  "blocks",
+		Usage: "number of recent blocks to aggregate",
+		Value: 100,
+	}
+
+	commandValidators = &cli.Command{
+		Name:      "validators",
+		Usage:     "show the validator set, or a single validator",
+		ArgsUsage: "[<address>]",
+		Action:    action(queryValidators),
+	}
+	commandMEV = &cli.Command{
+		Name:      "mev",
+		Usage:     "show MEV statistics of recent blocks, or the score breakdown of a block",
+		ArgsUsage: "[<number>]",
+		Flags:     []cli.Flag{blocksFlag},
+		Action:    action(queryMEV),
+	}
+	commandFinality = &cli.Command{
+		Name:   "finality",
+		Usage:  "show the latest, safe and finalized blocks and the beacon checkpoints",
+		Action: action(queryFinality),
+	}
+	commandSlashing = &cli.Command{
+		Name:   "slashing",
+		Usage:  "show pending slashing evidence and ordering divergence from peers",
+		Action: action(querySlashing),
+	}
+	commandConfig = &cli.Command{
+		Name:   "config",
+		Usage:  "show the consensus configuration and features",
+		Action: action(queryConfig),
+	}
+	commandHealth = &cli.Command{
+		Name:   "health",
+		Usage:  "show the sync status and validator set health of both clients",
+		Action: action(queryHealth),
+	}
+)
+
+// action creates the command action running a query once or, in watch mode,
+// repeatedly until interrupted.
+func action(q query) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		runCtx, cancel := signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		c, err := dial(runCtx, ctx.String(rpcFlag.Name), ctx.String(beaconFlag.Name))
+		if err != nil {
+			return err
+		}
+		defer c.close()
+
+		interval := ctx.Duration(watchFlag.Name)
+		for {
+			result, err := q(runCtx, c, ctx)
+			if err != nil && interval == 0 {
+				return err
+			}
+			if interval > 0 && !ctx.Bool(jsonFlag.Name) {
+				fmt.Fprint(ctx.App.Writer, "\033[H\033[2J") // Clear the terminal between updates
+				fmt.Fprintf(ctx.App.Writer, "%s, every %v\n\n", time.Now().Format(time.TimeOnly), interval)
+			}
+			if err != nil {
+				fmt.Fprintln(ctx.App.Writer, "Error:", err)
+			} else if err := output(ctx.App.Writer, result, ctx.Bool(jsonFlag.Name)); err != nil {
+				return err
+			}
+			if interval == 0 {
+				return nil
+			}
+			select {
+			case <-time.After(interval):
+			case <-runCtx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// output prints a query result as tables or as JSON.
+func output(w io.Writer, result interface{}, asJSON bool) error {
+	if !asJSON {
+		renderTable(w, result)
+		return nil
+	}
+	blob, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(blob))
+	return err
+}
+
+func queryValidators(ctx context.Context, c *client, cmd *cli.Context) (interface{}, error) {
+	if cmd.Args().Len() == 0 {
+		return c.call(ctx, "equa_getValidators")
+	}
+	addr := cmd.Args().First()
+	if !common.IsHexAddress(addr) {
+		return nil, fmt.Errorf("invalid address %q", addr)
+	}
+	return c.call(ctx, "equa_getValidator", common.HexToAddress(addr))
+}
+
+func queryMEV(ctx context.Context, c *client, cmd *cli.Context) (interface{}, error) {
+	if cmd.Args().Len() == 0 {
+		return c.call(ctx, "equa_getMEVStats", cmd.Int(blocksFlag.Name))
+	}
+	number, err := strconv.ParseUint(cmd.Args().First(), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number %q", cmd.Args().First())
+	}
+	return c.call(ctx, "equa_getScoreBreakdown", number)
+}
+
+func queryFinality(ctx context.Context, c *client, cmd *cli.Context) (interface{}, error) {
+	execution := make(map[string]interface{})
+	for _, tag := range []string{"latest", "safe", "finalized"} {
+		block, err := c.call(ctx, "eth_getBlockByNumber", tag, false)
+		if err != nil {
+			execution[tag] = map[string]interface{}{"error": err.Error()}
+			continue
+		}
+		fields, _ := block.(map[string]interface{})
+		execution[tag] = map[string]interface{}{"number": fields["number"], "hash": fields["hash"]}
+	}
+	result := map[string]interface{}{"execution": execution}
+	if c.beacon != "" {
+		result["beacon"] = optional(c.beaconGet(ctx, "/eth/v1/beacon/states/head/finality_checkpoints"))
+	}
+	return result, nil
+}
+
+func querySlashing(ctx context.Context, c *client, cmd *cli.Context) (interface{}, error) {
+	evidence, err := c.call(ctx, "equa_getSlashingEvidence")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"evidence":   evidence,
+		"divergence": optional(c.call(ctx, "equa_getDivergenceHistory")),
+	}, nil
+}
+
+func queryConfig(ctx context.Context, c *client, cmd *cli.Context) (interface{}, error) {
+	consensus, err := c.call(ctx, "equa_getConsensusInfo")
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"consensus": consensus,
+		"features":  optional(c.call(ctx, "equa_getFeatures")),
+	}
+	if c.beacon != "" {
+		result["beacon"] = optional(c.beaconGet(ctx, "/eth/v1/config/spec"))
+	}
+	return result, nil
+}
+
+func queryHealth(ctx context.Context, c *client, cmd *cli.Context) (interface{}, error) {
+	health, err := c.call(ctx, "equa_getHealth")
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"execution": health,
+		"syncing":   optional(c.call(ctx, "eth_syncing")),
+	}
+	if c.beacon != "" {
+		result["beacon"] = optional(c.beaconGet(ctx, "/eth/v1/node/syncing"))
+	}
+	return result, nil
+}
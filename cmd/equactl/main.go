@@ -0,0 +1,75 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+// equactl is a command line tool for operators of EQUA nodes, querying the
+// execution client and, optionally, the beacon node it is paired with.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/equa/go-equa/internal/flags"
+	"github.com/urfave/cli/v2"
+)
+
+var app *cli.App
+
+func init() {
+	app = flags.NewApp("EQUA node operator control")
+	app.Flags = []cli.Flag{
+		rpcFlag,
+		beaconFlag,
+		jsonFlag,
+		watchFlag,
+	}
+	app.Commands = []*cli.Command{
+		commandValidators,
+		commandMEV,
+		commandFinality,
+		commandSlashing,
+		commandConfig,
+		commandHealth,
+	}
+}
+
+// Commonly used command line flags.
+var (
+	rpcFlag = &cli.StringFlag{
+		Name:  "rpc",
+		Usage: "RPC endpoint of the execution client",
+		Value: "http://127.0.0.1:8545",
+	}
+	beaconFlag = &cli.StringFlag{
+		Name:  "beacon",
+		Usage: "beacon node API endpoint, queried in addition to the execution client if set",
+	}
+	jsonFlag = &cli.BoolFlag{
+		Name:  "json",
+		Usage: "output JSON instead of tables",
+	}
+	watchFlag = &cli.DurationFlag{
+		Name:  "watch",
+		Usage: "repeat the query at the given interval until interrupted (0 = once)",
+	}
+)
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
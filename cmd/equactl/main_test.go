@@ -0,0 +1,122 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/equa/go-equa/rpc"
+)
+
+type testEquaAPI struct{}
+
+func (testEquaAPI) GetHealth() map[string]interface{} {
+	return map[string]interface{}{
+		"head":       7,
+		"validators": 2,
+		"totalStake": new(big.Int).Mul(big.NewInt(64), big.NewInt(1e18)),
+	}
+}
+
+type testEthAPI struct{}
+
+func (testEthAPI) Syncing() bool { return false }
+
+// newTestNodes starts an execution client serving a stub equa namespace and a
+// beacon node serving the sync status.
+func newTestNodes(t *testing.T) (string, string) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("equa", testEquaAPI{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("eth", testEthAPI{}); err != nil {
+		t.Fatal(err)
+	}
+	el := httptest.NewServer(server)
+	t.Cleanup(el.Close)
+
+	beacon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eth/v1/node/syncing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":{"head_slot":"96","is_syncing":false}}`))
+	}))
+	t.Cleanup(beacon.Close)
+	return el.URL, beacon.URL
+}
+
+// runEquactl runs the app with the given arguments, returning its output.
+func runEquactl(t *testing.T, args ...string) string {
+	var out bytes.Buffer
+	app.Writer = &out
+	if err := app.Run(append([]string{"equactl"}, args...)); err != nil {
+		t.Fatalf("equactl %v failed: %v", args, err)
+	}
+	return out.String()
+}
+
+// Tests that the health command combines both clients, keeping large numbers
+// verbatim in table and JSON output.
+func TestHealth(t *testing.T) {
+	el, beacon := newTestNodes(t)
+
+	out := runEquactl(t, "--rpc", el, "--beacon", beacon, "health")
+	for _, want := range []string{"syncing", "false", "BEACON", "is_syncing", "EXECUTION", "64000000000000000000"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table output misses %q:\n%s", want, out)
+		}
+	}
+	out = runEquactl(t, "--rpc", el, "--beacon", beacon, "--json", "health")
+	var result struct {
+		Execution struct {
+			TotalStake json.Number `json:"totalStake"`
+		} `json:"execution"`
+		Beacon struct {
+			HeadSlot string `json:"head_slot"`
+		} `json:"beacon"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if result.Execution.TotalStake != "64000000000000000000" || result.Beacon.HeadSlot != "96" {
+		t.Errorf("JSON output mismatch: %s", out)
+	}
+}
+
+// Tests that lists of objects are rendered with one row per element and the
+// union of their fields as columns.
+func TestRenderList(t *testing.T) {
+	var out bytes.Buffer
+	renderTable(&out, map[string]interface{}{
+		"count": json.Number("2"),
+		"validators": []interface{}{
+			map[string]interface{}{"address": "0x01", "stake": "32"},
+			map[string]interface{}{"address": "0x02", "slashed": true},
+		},
+	})
+	want := "count  2\n\nVALIDATORS\nADDRESS  SLASHED  STAKE\n0x01     -        32\n0x02     true     -\n"
+	if out.String() != want {
+		t.Errorf("output mismatch:\nhave:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
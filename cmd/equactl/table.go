@@ -0,0 +1,137 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// renderTable prints a generic JSON value as tables. The scalar fields of an
+// object are listed as key-value pairs, followed by a titled section for each
+// nested value. Lists of objects are printed with one row per element.
+func renderTable(w io.Writer, v interface{}) {
+	renderSection(w, "", v)
+}
+
+func renderSection(w io.Writer, title string, v interface{}) {
+	if title != "" {
+		fmt.Fprintf(w, "\n%s\n", strings.ToUpper(title))
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		var nested []string
+		for _, key := range sortedKeys(v) {
+			if isComposite(v[key]) {
+				nested = append(nested, key)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", key, formatValue(v[key]))
+		}
+		tw.Flush()
+		for _, key := range nested {
+			renderSection(w, joinTitle(title, key), v[key])
+		}
+	case []interface{}:
+		renderList(w, v)
+	default:
+		fmt.Fprintln(w, formatValue(v))
+	}
+}
+
+// renderList prints a list, as a table if all elements are objects.
+func renderList(w io.Writer, list []interface{}) {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "(none)")
+		return
+	}
+	columns := make(map[string]bool)
+	for _, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			for _, item := range list {
+				fmt.Fprintln(w, formatValue(item))
+			}
+			return
+		}
+		for key := range obj {
+			columns[key] = true
+		}
+	}
+	header := sortedKeys(columns)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	for _, item := range list {
+		obj := item.(map[string]interface{})
+		row := make([]string, len(header))
+		for i, key := range header {
+			row[i] = formatValue(obj[key])
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// formatValue renders a single cell, encoding composite values as compact JSON.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		blob, _ := json.Marshal(v)
+		return string(blob)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// isComposite reports whether a value is printed as a section of its own.
+func isComposite(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return true
+	}
+	return false
+}
+
+func joinTitle(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + " " + key
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/equa/go-equa/accounts/keystore"
+	"github.com/equa/go-equa/cmd/utils"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/params"
+	"github.com/urfave/cli/v2"
+)
+
+type outputSignExit struct {
+	Exit *equa.VoluntaryExit
+	To   common.Address
+	Data hexutil.Bytes
+}
+
+var chainIDFlag = &cli.Uint64Flag{
+	Name:  "chainid",
+	Usage: "the ID of the chain the exit is signed for",
+	Value: params.EquaMainnetChainConfig.ChainID.Uint64(),
+}
+
+var commandSignExit = &cli.Command{
+	Name:      "signexit",
+	Usage:     "sign an EQUA validator voluntary exit",
+	ArgsUsage: "<keyfile> <epoch>",
+	Description: `
+Sign a voluntary exit for the validator owning the keyfile, taking effect at
+the given epoch, on the chain given by --chainid (the EQUA main network by
+default). The signed exit is printed as JSON along with the address and data
+of the transaction carrying it on chain, which any account can send.`,
+	Flags: []cli.Flag{
+		passphraseFlag,
+		chainIDFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() != 2 {
+			utils.Fatalf("This command requires a keyfile and an epoch.")
+		}
+		epoch, err := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		if err != nil {
+			utils.Fatalf("Invalid epoch: %v", err)
+		}
+		// Load the keyfile.
+		keyfilepath := ctx.Args().First()
+		keyjson, err := os.ReadFile(keyfilepath)
+		if err != nil {
+			utils.Fatalf("Failed to read the keyfile at '%s': %v", keyfilepath, err)
+		}
+
+		// Decrypt key with passphrase.
+		passphrase := getPassphrase(ctx, false)
+		key, err := keystore.DecryptKey(keyjson, passphrase)
+		if err != nil {
+			utils.Fatalf("Error decrypting key: %v", err)
+		}
+
+		exit := &equa.VoluntaryExit{Validator: key.Address, Epoch: epoch}
+		if err := exit.Sign(key.PrivateKey, new(big.Int).SetUint64(ctx.Uint64(chainIDFlag.Name))); err != nil {
+			utils.Fatalf("Failed to sign exit: %v", err)
+		}
+		data, err := exit.TxData()
+		if err != nil {
+			utils.Fatalf("Failed to encode exit: %v", err)
+		}
+		mustPrintJSON(outputSignExit{Exit: exit, To: params.EquaExitAddress, Data: data})
+		return nil
+	},
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/equa/go-equa/cmd/utils"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/log"
+	"github.com/urfave/cli/v2"
+)
+
+// epochExportSchema is the version of the epoch export layout. It must be bumped
+// whenever columns or fields are changed, so accounting pipelines can tell
+// exports apart.
+const epochExportSchema = 1
+
+var (
+	epochFromFlag = &cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First epoch to export",
+	}
+	epochToFlag = &cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last epoch to export (default = last finished epoch)",
+	}
+	epochFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format (csv, json)",
+		Value: "csv",
+	}
+
+	exportEpochsCommand = &cli.Command{
+		Action:    exportEpochs,
+		Name:      "export-epochs",
+		Usage:     "Export the summaries of a range of finished epochs for accounting",
+		ArgsUsage: "<filename>",
+		Flags:     slices.Concat([]cli.Flag{epochFromFlag, epochToFlag, epochFormatFlag}, utils.DatabaseFlags),
+		Description: `
+The export-epochs command writes the EQUA epoch summaries of the local chain
+into a file: the blocks proposed, MEV detected, rewards credited and slashable
+offenses of every validator active in an epoch. Epochs not summarized by the
+node yet are summarized from the local blocks and receipts, and the summaries
+are stored in the database. Rewards are only accounted for blocks the node has
+executed itself.
+
+CSV exports contain one row per validator and epoch, JSON exports one summary
+object per line. Every row and object carries the schema version of the export
+layout.
+`,
+	}
+)
+
+// epochExportSummary is the JSON layout of an exported epoch.
+type epochExportSummary struct {
+	Schema int `json:"schemaVersion"`
+	*equa.EpochSummary
+}
+
+// epochCSVHeader is the column layout of CSV exports.
+var epochCSVHeader = []string{"schema_version", "epoch", "first_block", "last_block", "validator", "blocks_proposed", "mev_wei", "rewards_wei", "slashings"}
+
+// epochWriter streams epoch summaries in one of the supported formats.
+type epochWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+// newEpochWriter creates a writer for the given format, emitting any header.
+func newEpochWriter(w io.Writer, format string) (*epochWriter, error) {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		return &epochWriter{csv: cw}, cw.Write(epochCSVHeader)
+	case "json":
+		return &epochWriter{json: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// write emits the summary of a single epoch.
+func (w *epochWriter) write(summary *equa.EpochSummary) error {
+	if w.json != nil {
+		return w.json.Encode(&epochExportSummary{Schema: epochExportSchema, EpochSummary: summary})
+	}
+	prefix := []string{strconv.Itoa(epochExportSchema), strconv.FormatUint(summary.Epoch, 10), strconv.FormatUint(summary.First, 10), strconv.FormatUint(summary.Last, 10)}
+	for _, v := range summary.Validators {
+		row := append(slices.Clone(prefix), v.Address.Hex(), strconv.Itoa(v.Proposed), v.MEV.String(), v.Rewards.String(), strconv.Itoa(len(v.Slashings)))
+		if err := w.csv.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes any buffered data to the underlying writer.
+func (w *epochWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// epochSummarizer retrieves the summary of a finished epoch.
+type epochSummarizer func(epoch uint64) (*equa.EpochSummary, error)
+
+// writeEpochExport streams the summaries of the epochs in [from, to] to out.
+func writeEpochExport(out io.Writer, format string, summarize epochSummarizer, from, to uint64) error {
+	w, err := newEpochWriter(out, format)
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for epoch := from; epoch <= to; epoch++ {
+		summary, err := summarize(epoch)
+		if err != nil {
+			return fmt.Errorf("epoch %d: %v", epoch, err)
+		}
+		if err := w.write(summary); err != nil {
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting epoch summaries", "epoch", epoch, "last", to, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return w.flush()
+}
+
+func exportEpochs(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	// Summaries are stored once computed, the database is opened writable
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+
+	engine, ok := chain.Engine().(*equa.Equa)
+	if !ok {
+		utils.Fatalf("Chain does not use the EQUA consensus engine")
+	}
+	length := chain.Config().Equa.Epoch
+	if head := chain.CurrentBlock().Number.Uint64(); head+1 < length {
+		utils.Fatalf("No finished epoch to export")
+	}
+	var (
+		from = ctx.Uint64(epochFromFlag.Name)
+		to   = (chain.CurrentBlock().Number.Uint64()+1)/length - 1
+	)
+	if ctx.IsSet(epochToFlag.Name) {
+		if last := ctx.Uint64(epochToFlag.Name); last < to {
+			to = last
+		}
+	}
+	if from > to {
+		utils.Fatalf("Invalid epoch range: from %d, to %d", from, to)
+	}
+	f, err := os.Create(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to create export file: %v", err)
+	}
+	defer f.Close()
+
+	out := bufio.NewWriter(f)
+	summarize := func(epoch uint64) (*equa.EpochSummary, error) {
+		return engine.SummarizeEpoch(chain, epoch)
+	}
+	start := time.Now()
+	if err := writeEpochExport(out, ctx.String(epochFormatFlag.Name), summarize, from, to); err != nil {
+		utils.Fatalf("Export error: %v", err)
+	}
+	if err := out.Flush(); err != nil {
+		utils.Fatalf("Export error: %v", err)
+	}
+	fmt.Printf("Exported summaries of epochs %d-%d in %v\n", from, to, time.Since(start))
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus/equa"
+)
+
+func testEpochSummarizer(last uint64) epochSummarizer {
+	return func(epoch uint64) (*equa.EpochSummary, error) {
+		if epoch > last {
+			return nil, errors.New("epoch not finished")
+		}
+		return &equa.EpochSummary{
+			Epoch: epoch,
+			First: epoch * 4,
+			Last:  epoch*4 + 3,
+			Validators: []*equa.ValidatorEpochSummary{
+				{Address: common.Address{0x01}, Proposed: 3, MEV: new(big.Int), Rewards: big.NewInt(3000)},
+				{Address: common.Address{0x02}, Proposed: 1, MEV: big.NewInt(7), Rewards: big.NewInt(1000), Slashings: []*equa.SlashingEvent{{}}},
+			},
+		}, nil
+	}
+}
+
+func TestExportEpochsCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeEpochExport(&out, "csv", testEpochSummarizer(10), 2, 3); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("row count mismatch: have %d, want 5", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(epochCSVHeader, ",") {
+		t.Errorf("header mismatch: have %v", rows[0])
+	}
+	if want := "1,2,8,11,0x0200000000000000000000000000000000000000,1,7,1000,1"; strings.Join(rows[2], ",") != want {
+		t.Errorf("row mismatch: have %v, want %s", rows[2], want)
+	}
+}
+
+func TestExportEpochsJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeEpochExport(&out, "json", testEpochSummarizer(10), 0, 1); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	dec := json.NewDecoder(&out)
+	for want := uint64(0); want <= 1; want++ {
+		var summary epochExportSummary
+		if err := dec.Decode(&summary); err != nil {
+			t.Fatalf("epoch %d: invalid json: %v", want, err)
+		}
+		if summary.Schema != epochExportSchema || summary.Epoch != want || len(summary.Validators) != 2 {
+			t.Errorf("epoch %d mismatch: %+v", want, summary)
+		}
+	}
+}
+
+func TestExportEpochsErrors(t *testing.T) {
+	if err := writeEpochExport(new(bytes.Buffer), "xml", testEpochSummarizer(10), 0, 1); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if err := writeEpochExport(new(bytes.Buffer), "csv", testEpochSummarizer(1), 0, 2); err == nil {
+		t.Error("expected error for unfinished epoch")
+	}
+}
@@ -0,0 +1,521 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/equa/go-equa/accounts/keystore"
+	"github.com/equa/go-equa/cmd/utils"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/params"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	genesisStakeFlag = &cli.StringFlag{
+		Name:  "stake",
+		Usage: "Stake in wei allocated to the validator at genesis",
+	}
+	genesisBLSKeyFlag = &cli.StringFlag{
+		Name:  "blskey",
+		Usage: "Hex encoded BLS public key of the validator",
+	}
+	genesisTemplateFlag = &cli.PathFlag{
+		Name:  "template",
+		Usage: "Genesis file providing the chain configuration and allocations",
+	}
+	genesisCeremonyFlag = &cli.PathFlag{
+		Name:  "ceremony",
+		Usage: "Output of the threshold key ceremony",
+	}
+	genesisOutFlag = &cli.PathFlag{
+		Name:  "out",
+		Usage: "Directory to write the ceremony artifacts to",
+		Value: ".",
+	}
+	genesisNetworkFlag = &cli.StringFlag{
+		Name:  "network",
+		Usage: "EQUA network whose parameters the template starts from (mainnet, testnet)",
+		Value: "testnet",
+	}
+	genesisChainIDFlag = &cli.Uint64Flag{
+		Name:  "chainid",
+		Usage: "Chain ID of the new network",
+	}
+	genesisPeriodFlag = &cli.Uint64Flag{
+		Name:  "period",
+		Usage: "Seconds between blocks",
+	}
+	genesisEpochFlag = &cli.Uint64Flag{
+		Name:  "epoch",
+		Usage: "Blocks per epoch",
+	}
+	genesisThresholdFlag = &cli.Uint64Flag{
+		Name:  "threshold",
+		Usage: "Validator key shares needed to decrypt threshold encrypted transactions",
+	}
+	genesisMEVBurnFlag = &cli.Uint64Flag{
+		Name:  "mevburn",
+		Usage: "Percentage of detected MEV burned",
+	}
+	genesisPoWDifficultyFlag = &cli.Uint64Flag{
+		Name:  "powdifficulty",
+		Usage: "Difficulty of the lightweight PoW of proposers",
+	}
+	genesisRewardFlag = &cli.StringFlag{
+		Name:  "reward",
+		Usage: "Block reward of proposers in wei",
+	}
+	genesisSlashingFlag = &cli.Uint64Flag{
+		Name:  "slashing",
+		Usage: "Percentage of stake slashed for MEV extraction",
+	}
+	genesisGasLimitFlag = &cli.Uint64Flag{
+		Name:  "gaslimit",
+		Usage: "Gas limit of the genesis block",
+		Value: 30_000_000,
+	}
+	genesisTimestampFlag = &cli.Uint64Flag{
+		Name:  "timestamp",
+		Usage: "Timestamp of the genesis block",
+	}
+
+	genesisCommand = &cli.Command{
+		Name:  "genesis",
+		Usage: "Tools for launching a new EQUA network",
+		Description: `
+The genesis commands create the genesis of a new EQUA network from the signed
+registrations of its initial validators. Every participant can rebuild the
+genesis from the shared registrations and ceremony output and check that it is
+identical to the one distributed. The genesis template the ceremony starts from
+can be created from the network parameters with the template command.`,
+		Subcommands: []*cli.Command{
+			{
+				Name:   "template",
+				Usage:  "Create the genesis template of a new network",
+				Action: genesisTemplate,
+				Flags: []cli.Flag{
+					genesisNetworkFlag,
+					genesisChainIDFlag,
+					genesisPeriodFlag,
+					genesisEpochFlag,
+					genesisThresholdFlag,
+					genesisMEVBurnFlag,
+					genesisPoWDifficultyFlag,
+					genesisRewardFlag,
+					genesisSlashingFlag,
+					genesisGasLimitFlag,
+					genesisTimestampFlag,
+				},
+				Description: `
+geth genesis template --chainid <id> [parameters]
+prints a genesis template configuring the equa engine with the parameters of
+the given network, overridden by those set on the command line. The template
+is the input of the ceremony, extended with allocations as needed.`,
+			},
+			{
+				Name:      "register",
+				Usage:     "Sign a validator registration for a new network",
+				ArgsUsage: "<keyfile>",
+				Action:    genesisRegister,
+				Flags: []cli.Flag{
+					genesisStakeFlag,
+					genesisBLSKeyFlag,
+					utils.PasswordFileFlag,
+				},
+				Description: `
+geth genesis register --stake <wei> --blskey <pubkey> <keyfile>
+signs a registration for the validator owning the keyfile and prints it as
+JSON. The registration is handed to the genesis coordinator.`,
+			},
+			{
+				Name:      "ceremony",
+				Usage:     "Run the threshold key ceremony for the registered validators",
+				ArgsUsage: "<registration> [<registration> ...]",
+				Action:    genesisCeremony,
+				Flags: []cli.Flag{
+					genesisTemplateFlag,
+					genesisOutFlag,
+				},
+				Description: `
+geth genesis ceremony --template <genesis.json> <registrations>
+generates the threshold encryption key for the registered validators. The
+master public key is written to ceremony.json, which must be shared with all
+participants, and each validator's key share to <address>.share, which must
+be handed to that validator only.`,
+			},
+			{
+				Name:      "build",
+				Usage:     "Build the genesis of a new network",
+				ArgsUsage: "<registration> [<registration> ...]",
+				Action:    genesisBuild,
+				Flags: []cli.Flag{
+					genesisTemplateFlag,
+					genesisCeremonyFlag,
+				},
+				Description: `
+geth genesis build --template <genesis.json> --ceremony <ceremony.json> <registrations>
+verifies the registrations and prints the genesis file committing to the
+initial validator set and threshold key.`,
+			},
+			{
+				Name:      "verify",
+				Usage:     "Check a genesis against the ceremony inputs",
+				ArgsUsage: "<genesis> <registration> [<registration> ...]",
+				Action:    genesisVerify,
+				Flags: []cli.Flag{
+					genesisTemplateFlag,
+					genesisCeremonyFlag,
+				},
+				Description: `
+geth genesis verify --template <genesis.json> --ceremony <ceremony.json> <genesis> <registrations>
+rebuilds the genesis from the inputs and fails unless it is identical to the
+given one.`,
+			},
+		},
+	}
+)
+
+// equaCeremony is the public output of the threshold key ceremony.
+type equaCeremony struct {
+	Participants       []common.Address `json:"participants"`
+	ThresholdPublicKey hexutil.Bytes    `json:"thresholdPublicKey"`
+}
+
+// readJSONFile decodes the JSON file at the given path into v.
+func readJSONFile(path string, v interface{}) error {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(blob, v); err != nil {
+		return fmt.Errorf("invalid JSON in %s: %v", path, err)
+	}
+	return nil
+}
+
+// readRegistrations loads the validator registrations at the given paths.
+func readRegistrations(paths []string) ([]*equa.ValidatorRegistration, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no validator registrations given")
+	}
+	regs := make([]*equa.ValidatorRegistration, len(paths))
+	for i, path := range paths {
+		regs[i] = new(equa.ValidatorRegistration)
+		if err := readJSONFile(path, regs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return regs, nil
+}
+
+// readGenesisTemplate loads the genesis template, which must configure the
+// EQUA consensus engine.
+func readGenesisTemplate(ctx *cli.Context) (*core.Genesis, error) {
+	if !ctx.IsSet(genesisTemplateFlag.Name) {
+		return nil, errors.New("missing genesis template")
+	}
+	template := new(core.Genesis)
+	if err := readJSONFile(ctx.Path(genesisTemplateFlag.Name), template); err != nil {
+		return nil, err
+	}
+	if template.Config == nil || template.Config.Equa == nil {
+		return nil, errors.New("genesis template does not configure the equa engine")
+	}
+	return template, nil
+}
+
+// buildEquaGenesis creates the genesis of a new network from a template, the
+// validator registrations and the ceremony output. The result only depends on
+// the inputs, not on the order of the registrations.
+func buildEquaGenesis(template *core.Genesis, ceremony *equaCeremony, regs []*equa.ValidatorRegistration) (*core.Genesis, error) {
+	validators, err := equa.InitialValidators(regs)
+	if err != nil {
+		return nil, err
+	}
+	if len(ceremony.Participants) != len(validators) {
+		return nil, fmt.Errorf("ceremony has %d participants, have %d registrations", len(ceremony.Participants), len(validators))
+	}
+	for i, validator := range validators {
+		if ceremony.Participants[i] != validator.Address {
+			return nil, fmt.Errorf("validator %s did not participate in the ceremony", validator.Address)
+		}
+	}
+	if len(ceremony.ThresholdPublicKey) == 0 {
+		return nil, errors.New("ceremony has no threshold public key")
+	}
+	var (
+		genesis = *template
+		config  = *template.Config
+		engine  = *template.Config.Equa
+	)
+	engine.InitialValidators = validators
+	engine.ThresholdPublicKey = common.CopyBytes(ceremony.ThresholdPublicKey)
+	config.Equa = &engine
+	if err := config.CheckConfigForkOrder(); err != nil {
+		return nil, err
+	}
+	genesis.Config = &config
+	genesis.ExtraData = equa.ValidatorSetCommitment(&engine).Bytes()
+	return &genesis, nil
+}
+
+// makeGenesisTemplate creates a genesis template from the parameters of an EQUA
+// network, overridden by those set on the command line.
+func makeGenesisTemplate(ctx *cli.Context) (*core.Genesis, error) {
+	var base *params.ChainConfig
+	switch network := ctx.String(genesisNetworkFlag.Name); network {
+	case "mainnet":
+		base = params.EquaMainnetChainConfig
+	case "testnet":
+		base = params.EquaTestnetChainConfig
+	default:
+		return nil, fmt.Errorf("unknown network %q", network)
+	}
+	if !ctx.IsSet(genesisChainIDFlag.Name) {
+		return nil, errors.New("missing chain ID")
+	}
+	var (
+		config = *base
+		engine = *base.Equa
+	)
+	config.ChainID = new(big.Int).SetUint64(ctx.Uint64(genesisChainIDFlag.Name))
+	for flag, field := range map[*cli.Uint64Flag]*uint64{
+		genesisPeriodFlag:        &engine.Period,
+		genesisEpochFlag:         &engine.Epoch,
+		genesisThresholdFlag:     &engine.ThresholdShares,
+		genesisMEVBurnFlag:       &engine.MEVBurnPercentage,
+		genesisPoWDifficultyFlag: &engine.PoWDifficulty,
+		genesisSlashingFlag:      &engine.SlashingPercentage,
+	} {
+		if ctx.IsSet(flag.Name) {
+			*field = ctx.Uint64(flag.Name)
+		}
+	}
+	if ctx.IsSet(genesisRewardFlag.Name) {
+		reward, ok := new(big.Int).SetString(ctx.String(genesisRewardFlag.Name), 10)
+		if !ok || !reward.IsUint64() {
+			return nil, fmt.Errorf("invalid block reward %q", ctx.String(genesisRewardFlag.Name))
+		}
+		engine.ValidatorReward = reward.Uint64()
+	}
+	config.Equa = &engine
+	return newGenesisTemplate(&config, ctx.Uint64(genesisGasLimitFlag.Name), ctx.Uint64(genesisTimestampFlag.Name))
+}
+
+// newGenesisTemplate creates a genesis template for a chain configuring the
+// equa engine, checking that its parameters can run a network.
+func newGenesisTemplate(config *params.ChainConfig, gasLimit uint64, timestamp uint64) (*core.Genesis, error) {
+	engine := config.Equa
+	switch {
+	case config.ChainID == nil || config.ChainID.Sign() == 0:
+		return nil, errors.New("chain ID must be positive")
+	case engine.Period == 0:
+		return nil, errors.New("block period must be positive")
+	case engine.Epoch == 0:
+		return nil, errors.New("epoch length must be positive")
+	case engine.ThresholdShares == 0:
+		return nil, errors.New("threshold must be positive")
+	case engine.MEVBurnPercentage > 100:
+		return nil, fmt.Errorf("MEV burn percentage %d above 100", engine.MEVBurnPercentage)
+	case engine.SlashingPercentage > 100:
+		return nil, fmt.Errorf("slashing percentage %d above 100", engine.SlashingPercentage)
+	case gasLimit < params.MinGasLimit:
+		return nil, fmt.Errorf("gas limit %d below minimum %d", gasLimit, params.MinGasLimit)
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		return nil, err
+	}
+	return &core.Genesis{
+		Config:     config,
+		Timestamp:  timestamp,
+		GasLimit:   gasLimit,
+		Difficulty: big.NewInt(1),
+		Alloc:      types.GenesisAlloc{},
+	}, nil
+}
+
+// genesisTemplate prints a genesis template for a new network.
+func genesisTemplate(ctx *cli.Context) error {
+	template, err := makeGenesisTemplate(ctx)
+	if err != nil {
+		return err
+	}
+	blob, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(blob))
+	return nil
+}
+
+// genesisRegister signs a validator registration.
+func genesisRegister(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("This command requires a keyfile.")
+	}
+	stake, ok := new(big.Int).SetString(ctx.String(genesisStakeFlag.Name), 10)
+	if !ok || stake.Sign() <= 0 {
+		utils.Fatalf("Invalid stake: %q", ctx.String(genesisStakeFlag.Name))
+	}
+	blskey, err := hexutil.Decode(ctx.String(genesisBLSKeyFlag.Name))
+	if err != nil {
+		utils.Fatalf("Invalid BLS public key: %v", err)
+	}
+	keyfile := ctx.Args().First()
+	keyjson, err := os.ReadFile(keyfile)
+	if err != nil {
+		utils.Fatalf("Failed to read the keyfile at '%s': %v", keyfile, err)
+	}
+	password, ok := readPasswordFromFile(ctx.Path(utils.PasswordFileFlag.Name))
+	if !ok {
+		password = utils.GetPassPhrase("", false)
+	}
+	key, err := keystore.DecryptKey(keyjson, password)
+	if err != nil {
+		utils.Fatalf("Error decrypting key: %v", err)
+	}
+	reg := &equa.ValidatorRegistration{
+		Validator: key.Address,
+		PublicKey: blskey,
+		Stake:     (*hexutil.Big)(stake),
+	}
+	if err := reg.Sign(key.PrivateKey); err != nil {
+		utils.Fatalf("Failed to sign registration: %v", err)
+	}
+	return json.NewEncoder(os.Stdout).Encode(reg)
+}
+
+// genesisCeremony generates the threshold key for the registered validators.
+func genesisCeremony(ctx *cli.Context) error {
+	template, err := readGenesisTemplate(ctx)
+	if err != nil {
+		return err
+	}
+	regs, err := readRegistrations(ctx.Args().Slice())
+	if err != nil {
+		return err
+	}
+	validators, err := equa.InitialValidators(regs)
+	if err != nil {
+		return err
+	}
+	threshold := equa.NewThresholdCrypto(template.Config.Equa)
+	shares, pubkey, err := threshold.GenerateKeyShares(len(validators), int(template.Config.Equa.ThresholdShares))
+	if err != nil {
+		return err
+	}
+	ceremony := &equaCeremony{ThresholdPublicKey: pubkey}
+	dir := ctx.Path(genesisOutFlag.Name)
+	for i, validator := range validators {
+		ceremony.Participants = append(ceremony.Participants, validator.Address)
+
+		path := filepath.Join(dir, validator.Address.Hex()+".share")
+		if err := os.WriteFile(path, []byte(hexutil.Encode(shares[i])), 0600); err != nil {
+			return err
+		}
+	}
+	blob, err := json.MarshalIndent(ceremony, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ceremony.json"), blob, 0644); err != nil {
+		return err
+	}
+	log.Info("Completed threshold key ceremony", "participants", len(validators), "dir", dir)
+	return nil
+}
+
+// makeEquaGenesis builds the genesis from the inputs given on the command line,
+// skipping the given number of leading arguments.
+func makeEquaGenesis(ctx *cli.Context, skip int) (*core.Genesis, error) {
+	template, err := readGenesisTemplate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.IsSet(genesisCeremonyFlag.Name) {
+		return nil, errors.New("missing ceremony output")
+	}
+	ceremony := new(equaCeremony)
+	if err := readJSONFile(ctx.Path(genesisCeremonyFlag.Name), ceremony); err != nil {
+		return nil, err
+	}
+	regs, err := readRegistrations(ctx.Args().Slice()[skip:])
+	if err != nil {
+		return nil, err
+	}
+	return buildEquaGenesis(template, ceremony, regs)
+}
+
+// genesisBuild prints the genesis built from the ceremony inputs.
+func genesisBuild(ctx *cli.Context) error {
+	genesis, err := makeEquaGenesis(ctx, 0)
+	if err != nil {
+		return err
+	}
+	blob, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(blob))
+	log.Info("Built genesis", "hash", genesis.ToBlock().Hash(), "validators", len(genesis.Config.Equa.InitialValidators))
+	return nil
+}
+
+// genesisVerify checks that a genesis is identical to the one built from the
+// ceremony inputs.
+func genesisVerify(ctx *cli.Context) error {
+	if ctx.Args().Len() < 2 {
+		utils.Fatalf("This command requires a genesis file and at least one registration.")
+	}
+	have := new(core.Genesis)
+	if err := readJSONFile(ctx.Args().First(), have); err != nil {
+		return err
+	}
+	want, err := makeEquaGenesis(ctx, 1)
+	if err != nil {
+		return err
+	}
+	haveBlob, err := json.Marshal(have)
+	if err != nil {
+		return err
+	}
+	wantBlob, err := json.Marshal(want)
+	if err != nil {
+		return err
+	}
+	if haveHash, wantHash := have.ToBlock().Hash(), want.ToBlock().Hash(); haveHash != wantHash {
+		return fmt.Errorf("genesis hash mismatch: have %x, want %x", haveHash, wantHash)
+	}
+	if !bytes.Equal(haveBlob, wantBlob) {
+		return errors.New("genesis configuration differs from ceremony inputs")
+	}
+	fmt.Printf("Genesis %x matches the ceremony inputs\n", want.ToBlock().Hash())
+	return nil
+}
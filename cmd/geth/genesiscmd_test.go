@@ -0,0 +1,131 @@
+// Copyright 2016 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that every participant of a genesis ceremony builds the same genesis,
+// regardless of the order they collected the registrations in, and that the
+// genesis hash commits to the initial validator set.
+func TestBuildEquaGenesis(t *testing.T) {
+	config := *params.EquaTestnetChainConfig
+	template := &core.Genesis{
+		Config:     &config,
+		GasLimit:   30_000_000,
+		Difficulty: big.NewInt(1),
+		Alloc:      types.GenesisAlloc{common.HexToAddress("0xfee"): {Balance: big.NewInt(1)}},
+	}
+	var (
+		regs     []*equa.ValidatorRegistration
+		ceremony = &equaCeremony{ThresholdPublicKey: hexutil.Bytes{0xde, 0xad}}
+	)
+	for i := 0; i < 4; i++ {
+		key, _ := crypto.GenerateKey()
+		reg := &equa.ValidatorRegistration{
+			Validator: crypto.PubkeyToAddress(key.PublicKey),
+			PublicKey: hexutil.Bytes{byte(i)},
+			Stake:     (*hexutil.Big)(new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18))),
+		}
+		if err := reg.Sign(key); err != nil {
+			t.Fatalf("failed to sign registration: %v", err)
+		}
+		regs = append(regs, reg)
+	}
+	validators, _ := equa.InitialValidators(regs)
+	for _, validator := range validators {
+		ceremony.Participants = append(ceremony.Participants, validator.Address)
+	}
+	genesis, err := buildEquaGenesis(template, ceremony, regs)
+	if err != nil {
+		t.Fatalf("failed to build genesis: %v", err)
+	}
+	reversed := []*equa.ValidatorRegistration{regs[3], regs[2], regs[1], regs[0]}
+	again, err := buildEquaGenesis(template, ceremony, reversed)
+	if err != nil {
+		t.Fatalf("failed to rebuild genesis: %v", err)
+	}
+	have, _ := json.Marshal(again)
+	want, _ := json.Marshal(genesis)
+	if string(have) != string(want) {
+		t.Fatalf("genesis depends on registration order:\nhave %s\nwant %s", have, want)
+	}
+	if template.Config.Equa.InitialValidators != nil {
+		t.Fatalf("template configuration modified")
+	}
+	// Dropping a validator must change the genesis hash
+	ceremony.Participants = ceremony.Participants[1:]
+	var partial []*equa.ValidatorRegistration
+	for _, reg := range regs {
+		if reg.Validator != validators[0].Address {
+			partial = append(partial, reg)
+		}
+	}
+	other, err := buildEquaGenesis(template, ceremony, partial)
+	if err != nil {
+		t.Fatalf("failed to build partial genesis: %v", err)
+	}
+	if other.ToBlock().Hash() == genesis.ToBlock().Hash() {
+		t.Fatalf("genesis hash does not commit to the validator set")
+	}
+	// Registrations of validators missing from the ceremony must be refused
+	if _, err := buildEquaGenesis(template, ceremony, regs); err == nil {
+		t.Fatalf("genesis built for validator missing from the ceremony")
+	}
+}
+
+// Tests that genesis templates are only created for parameters a network can
+// run with.
+func TestNewGenesisTemplate(t *testing.T) {
+	config := *params.EquaTestnetChainConfig
+	template, err := newGenesisTemplate(&config, 30_000_000, 1700000000)
+	if err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+	if template.Config.Equa.Epoch != 1200 || template.GasLimit != 30_000_000 || template.Timestamp != 1700000000 {
+		t.Fatalf("template mismatch: %+v", template)
+	}
+	for name, modify := range map[string]func(*params.EquaConfig){
+		"zero period":     func(c *params.EquaConfig) { c.Period = 0 },
+		"zero epoch":      func(c *params.EquaConfig) { c.Epoch = 0 },
+		"zero threshold":  func(c *params.EquaConfig) { c.ThresholdShares = 0 },
+		"burn above 100":  func(c *params.EquaConfig) { c.MEVBurnPercentage = 101 },
+		"slash above 100": func(c *params.EquaConfig) { c.SlashingPercentage = 101 },
+	} {
+		engine := *params.EquaTestnetChainConfig.Equa
+		modify(&engine)
+		config.Equa = &engine
+		if _, err := newGenesisTemplate(&config, 30_000_000, 0); err == nil {
+			t.Errorf("%s: template created", name)
+		}
+	}
+	config.Equa = params.EquaTestnetChainConfig.Equa
+	if _, err := newGenesisTemplate(&config, 1000, 0); err == nil {
+		t.Errorf("template created with gas limit below minimum")
+	}
+}
@@ -139,6 +139,21 @@ var (
 		utils.GpoPercentileFlag,
 		utils.GpoMaxGasPriceFlag,
 		utils.GpoIgnoreGasPriceFlag,
+		utils.EquaCrossCheckPeersFlag,
+		utils.EquaCrossCheckSamplesFlag,
+		utils.EquaCrossCheckToleranceFlag,
+		utils.EquaCrossCheckAlertFlag,
+		utils.EquaFaucetAccountFlag,
+		utils.EquaFaucetAmountFlag,
+		utils.EquaFaucetPeriodFlag,
+		utils.EquaFaucetReferralFlag,
+		utils.EquaAdminFlag,
+		utils.EquaAdminRateFlag,
+		utils.EquaAdminBurstFlag,
+		utils.EquaMEVRulesFlag,
+		utils.EquaKeyShareFlag,
+		utils.EquaPoWSolverFlag,
+		utils.EquaPoWThreadsFlag,
 		configFileFlag,
 		utils.LogDebugFlag,
 		utils.LogBacktraceAtFlag,
@@ -242,6 +257,14 @@ func init() {
 		snapshotCommand,
 		// See verkle.go
 		verkleCommand,
+		// See genesiscmd.go
+		genesisCommand,
+		// See mevcmd.go
+		exportMEVCommand,
+		// See epochcmd.go
+		exportEpochsCommand,
+		// See powcmd.go
+		powBenchCommand,
 	}
 	if logTestCommand != nil {
 		app.Commands = append(app.Commands, logTestCommand)
@@ -0,0 +1,231 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/equa/go-equa/cmd/utils"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/log"
+	"github.com/urfave/cli/v2"
+)
+
+// mevExportSchema is the version of the MEV export layout. It must be bumped
+// whenever columns or fields are changed, so analytics pipelines can tell
+// exports apart.
+const mevExportSchema = 1
+
+var (
+	mevFromFlag = &cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to export",
+	}
+	mevToFlag = &cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to export (default = head)",
+	}
+	mevFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format (csv, jsonl)",
+		Value: "csv",
+	}
+
+	exportMEVCommand = &cli.Command{
+		Action:    exportMEV,
+		Name:      "export-mev",
+		Usage:     "Export the MEV detected in a range of blocks for offline analysis",
+		ArgsUsage: "<filename>",
+		Flags:     slices.Concat([]cli.Flag{mevFromFlag, mevToFlag, mevFormatFlag, utils.EquaMEVRulesFlag}, utils.DatabaseFlags),
+		Description: `
+The export-mev command runs the EQUA MEV detector over the blocks and receipts
+of the local database and streams the verdicts into a file: the category,
+extracting transaction, victim and estimated profit of every finding, and a
+"none" verdict for blocks without MEV. The built-in detection rules are used
+unless a rules file is given with --equa.mevrules.
+
+CSV exports contain one row per finding, JSON line exports one object per block.
+Every row and object carries the schema version of the export layout.
+`,
+	}
+)
+
+// mevExportBlock is the JSON line layout of an exported block.
+type mevExportBlock struct {
+	Schema   int                `json:"schemaVersion"`
+	Number   uint64             `json:"number"`
+	Hash     common.Hash        `json:"hash"`
+	Findings []*equa.MEVFinding `json:"findings"`
+}
+
+// mevCSVHeader is the column layout of CSV exports.
+var mevCSVHeader = []string{"schema_version", "block_number", "block_hash", "category", "tx_index", "tx_hash", "victim_tx_hash", "profit_wei"}
+
+// mevWriter streams MEV verdicts in one of the supported formats.
+type mevWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+// newMEVWriter creates a writer for the given format, emitting any header.
+func newMEVWriter(w io.Writer, format string) (*mevWriter, error) {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		return &mevWriter{csv: cw}, cw.Write(mevCSVHeader)
+	case "jsonl":
+		return &mevWriter{json: json.NewEncoder(w)}, nil
+	case "parquet":
+		return nil, errors.New("parquet output is not supported, export as csv and convert")
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// write emits the verdict of a single block.
+func (w *mevWriter) write(block *types.Block, findings []*equa.MEVFinding) error {
+	if w.json != nil {
+		if findings == nil {
+			findings = []*equa.MEVFinding{}
+		}
+		return w.json.Encode(&mevExportBlock{Schema: mevExportSchema, Number: block.NumberU64(), Hash: block.Hash(), Findings: findings})
+	}
+	prefix := []string{strconv.Itoa(mevExportSchema), strconv.FormatUint(block.NumberU64(), 10), block.Hash().Hex()}
+	if len(findings) == 0 {
+		return w.csv.Write(append(prefix, "none", "", "", "", "0"))
+	}
+	for _, finding := range findings {
+		victim := ""
+		if finding.Victim != nil {
+			victim = finding.Victim.Hex()
+		}
+		row := append(slices.Clone(prefix), finding.Category, strconv.Itoa(finding.TxIndex), finding.TxHash.Hex(), victim, finding.Profit.String())
+		if err := w.csv.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes any buffered data to the underlying writer.
+func (w *mevWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// mevBlockReader retrieves a block and its receipts by number, returning a nil
+// block if it is not available.
+type mevBlockReader func(number uint64) (*types.Block, types.Receipts)
+
+// writeMEVExport runs the detector over the blocks in [from, to] and streams
+// the verdicts to out.
+func writeMEVExport(out io.Writer, format string, detector *equa.MEVDetector, read mevBlockReader, from, to uint64) error {
+	w, err := newMEVWriter(out, format)
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := from; number <= to; number++ {
+		block, receipts := read(number)
+		if block == nil {
+			return fmt.Errorf("block %d not found", number)
+		}
+		if err := w.write(block, detector.Analyze(block.Transactions(), receipts, block.BaseFee())); err != nil {
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting MEV data", "number", number, "last", to, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return w.flush()
+}
+
+func exportMEV(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, true)
+	defer db.Close()
+
+	if chain.Config().Equa == nil {
+		utils.Fatalf("Chain does not use the EQUA consensus engine")
+	}
+	var (
+		from = ctx.Uint64(mevFromFlag.Name)
+		to   = chain.CurrentBlock().Number.Uint64()
+	)
+	if ctx.IsSet(mevToFlag.Name) {
+		if last := ctx.Uint64(mevToFlag.Name); last < to {
+			to = last
+		}
+	}
+	if from > to {
+		utils.Fatalf("Invalid block range: from %d, to %d", from, to)
+	}
+	f, err := os.Create(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to create export file: %v", err)
+	}
+	defer f.Close()
+
+	out := bufio.NewWriter(f)
+	read := func(number uint64) (*types.Block, types.Receipts) {
+		block := chain.GetBlockByNumber(number)
+		if block == nil {
+			return nil, nil
+		}
+		return block, chain.GetReceiptsByHash(block.Hash())
+	}
+	detector := equa.NewMEVDetector(chain.Config().Equa, types.LatestSigner(chain.Config()))
+	if file := ctx.String(utils.EquaMEVRulesFlag.Name); file != "" {
+		rules, err := equa.LoadMEVRules(file)
+		if err != nil {
+			utils.Fatalf("Failed to load MEV rules: %v", err)
+		}
+		detector.SetRules(rules)
+	}
+	start := time.Now()
+	if err := writeMEVExport(out, ctx.String(mevFormatFlag.Name), detector, read, from, to); err != nil {
+		utils.Fatalf("Export error: %v", err)
+	}
+	if err := out.Flush(); err != nil {
+		utils.Fatalf("Export error: %v", err)
+	}
+	fmt.Printf("Exported MEV data of blocks %d-%d in %v\n", from, to, time.Since(start))
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+func testMEVBlockReader(last uint64) mevBlockReader {
+	return func(number uint64) (*types.Block, types.Receipts) {
+		if number > last {
+			return nil, nil
+		}
+		return types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number)}), nil
+	}
+}
+
+func TestExportMEVCSV(t *testing.T) {
+	var (
+		out      bytes.Buffer
+		detector = equa.NewMEVDetector(&params.EquaConfig{}, types.LatestSigner(params.MergedTestChainConfig))
+	)
+	if err := writeMEVExport(&out, "csv", detector, testMEVBlockReader(10), 3, 5); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("row count mismatch: have %d, want 4", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(mevCSVHeader, ",") {
+		t.Errorf("header mismatch: have %v", rows[0])
+	}
+	for i, row := range rows[1:] {
+		if row[0] != "1" || row[1] != []string{"3", "4", "5"}[i] || row[3] != "none" {
+			t.Errorf("row %d mismatch: %v", i, row)
+		}
+	}
+}
+
+func TestExportMEVJSONLines(t *testing.T) {
+	var (
+		out      bytes.Buffer
+		detector = equa.NewMEVDetector(&params.EquaConfig{}, types.LatestSigner(params.MergedTestChainConfig))
+	)
+	if err := writeMEVExport(&out, "jsonl", detector, testMEVBlockReader(10), 0, 1); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	dec := json.NewDecoder(&out)
+	for want := uint64(0); want <= 1; want++ {
+		var block mevExportBlock
+		if err := dec.Decode(&block); err != nil {
+			t.Fatalf("block %d: invalid json: %v", want, err)
+		}
+		if block.Schema != mevExportSchema || block.Number != want || block.Findings == nil {
+			t.Errorf("block %d mismatch: %+v", want, block)
+		}
+	}
+}
+
+func TestExportMEVErrors(t *testing.T) {
+	detector := equa.NewMEVDetector(&params.EquaConfig{}, types.LatestSigner(params.MergedTestChainConfig))
+	for _, format := range []string{"parquet", "xml"} {
+		if err := writeMEVExport(new(bytes.Buffer), format, detector, testMEVBlockReader(10), 0, 1); err == nil {
+			t.Errorf("format %s: expected error", format)
+		}
+	}
+	if err := writeMEVExport(new(bytes.Buffer), "csv", detector, testMEVBlockReader(1), 0, 2); err == nil {
+		t.Error("expected error for missing block")
+	}
+}
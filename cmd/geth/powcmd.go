@@ -0,0 +1,126 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of go-equa.
+//
+// go-equa is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-equa is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-equa. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"text/tabwriter"
+	"time"
+
+	"github.com/equa/go-equa/cmd/utils"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	powBenchDifficultyFlag = &cli.Uint64Flag{
+		Name:  "difficulty",
+		Usage: "PoW difficulty of the benchmarked challenges",
+		Value: 100000,
+	}
+	powBenchDurationFlag = &cli.DurationFlag{
+		Name:  "duration",
+		Usage: "Time each solver is benchmarked for",
+		Value: 5 * time.Second,
+	}
+
+	powBenchCommand = &cli.Command{
+		Action: powBench,
+		Name:   "powbench",
+		Usage:  "Benchmark the hash rate of the EQUA PoW solvers",
+		Flags:  []cli.Flag{powBenchDifficultyFlag, powBenchDurationFlag, utils.EquaPoWThreadsFlag},
+		Description: `
+The powbench command solves PoW challenges of the given difficulty with every
+available solver for the given duration, and reports the blocks sealed per
+second and the hash rate each of them achieves on this machine. The batched
+solver runs on the number of threads given with --equa.powthreads.
+`,
+	}
+)
+
+// powBenchResult is the outcome of benchmarking a PoW solver.
+type powBenchResult struct {
+	solver  string
+	threads int
+	solved  int           // Challenges solved
+	hashes  uint64        // Nonces hashed, estimated from the solutions
+	elapsed time.Duration // Time spent solving
+}
+
+// benchPoWSolver solves challenges of the given difficulty with a solver until
+// the duration has passed.
+func benchPoWSolver(solver string, threads int, difficulty uint64, duration time.Duration) (*powBenchResult, error) {
+	pow := equa.NewLightPoW(&params.EquaConfig{PoWDifficulty: difficulty, Epoch: 1})
+	if err := pow.SetSolver(solver, threads); err != nil {
+		return nil, err
+	}
+	result := &powBenchResult{solver: solver}
+	_, result.threads = pow.Solver()
+
+	var (
+		stop   = make(chan struct{})
+		header = &types.Header{Number: big.NewInt(1)}
+		start  = time.Now()
+	)
+	for i := uint64(0); time.Since(start) < duration; i++ {
+		header.MixDigest = common.BytesToHash(binary.BigEndian.AppendUint64(nil, i))
+		nonce, _, err := pow.Solve(header, stop)
+		if err != nil {
+			continue // Challenge without a solution in the searched nonces
+		}
+		result.solved++
+		result.hashes += nonce + 1
+	}
+	result.elapsed = time.Since(start)
+	return result, nil
+}
+
+// printPoWBench writes the benchmark results as a table.
+func printPoWBench(w io.Writer, results []*powBenchResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOLVER\tTHREADS\tSOLVED\tSOLVED/S\tHASHRATE")
+	for _, r := range results {
+		seconds := r.elapsed.Seconds()
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.2f MH/s\n", r.solver, r.threads, r.solved, float64(r.solved)/seconds, float64(r.hashes)/seconds/1e6)
+	}
+	tw.Flush()
+}
+
+func powBench(ctx *cli.Context) error {
+	var (
+		difficulty = ctx.Uint64(powBenchDifficultyFlag.Name)
+		duration   = ctx.Duration(powBenchDurationFlag.Name)
+		threads    = ctx.Int(utils.EquaPoWThreadsFlag.Name)
+		results    []*powBenchResult
+	)
+	for _, solver := range equa.PoWSolvers {
+		fmt.Fprintf(ctx.App.Writer, "Benchmarking %s solver for %v\n", solver, duration)
+		result, err := benchPoWSolver(solver, threads, difficulty, duration)
+		if err != nil {
+			utils.Fatalf("Failed to benchmark %s solver: %v", solver, err)
+		}
+		results = append(results, result)
+	}
+	printPoWBench(ctx.App.Writer, results)
+	return nil
+}
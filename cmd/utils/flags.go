@@ -41,6 +41,7 @@ import (
 	"github.com/equa/go-equa/common"
 	"github.com/equa/go-equa/common/fdlimit"
 	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/consensus/equa"
 	"github.com/equa/go-equa/core"
 	"github.com/equa/go-equa/core/rawdb"
 	"github.com/equa/go-equa/core/txpool/blobpool"
@@ -878,6 +879,100 @@ var (
 		Category: flags.GasPriceCategory,
 	}
 
+	// EQUA ordering cross-check settings
+	EquaCrossCheckPeersFlag = &cli.StringFlag{
+		Name:     "equa.crosscheck.peers",
+		Usage:    "Comma separated RPC endpoints of nodes to cross-check block ordering scores with (disabled if empty)",
+		Category: flags.EquaCategory,
+	}
+	EquaCrossCheckSamplesFlag = &cli.IntFlag{
+		Name:     "equa.crosscheck.samples",
+		Usage:    "Number of random peers asked for the ordering score of each block",
+		Value:    ethconfig.Defaults.EquaCrossCheck.Samples,
+		Category: flags.EquaCategory,
+	}
+	EquaCrossCheckToleranceFlag = &cli.Float64Flag{
+		Name:     "equa.crosscheck.tolerance",
+		Usage:    "Ordering score difference at which a peer is considered to disagree",
+		Value:    ethconfig.Defaults.EquaCrossCheck.Tolerance,
+		Category: flags.EquaCategory,
+	}
+	EquaCrossCheckAlertFlag = &cli.IntFlag{
+		Name:     "equa.crosscheck.alert",
+		Usage:    "Number of divergent blocks among the last 100 checked at which an alert is raised",
+		Value:    ethconfig.Defaults.EquaCrossCheck.Alert,
+		Category: flags.EquaCategory,
+	}
+
+	// EQUA test network onboarding settings
+	EquaFaucetAccountFlag = &cli.StringFlag{
+		Name:     "equa.faucet.account",
+		Usage:    "Unlocked account funding faucet requests (default = etherbase)",
+		Category: flags.EquaCategory,
+	}
+	EquaFaucetAmountFlag = &flags.BigFlag{
+		Name:     "equa.faucet.amount",
+		Usage:    "Wei sent per faucet request (faucet disabled if unset)",
+		Category: flags.EquaCategory,
+	}
+	EquaFaucetPeriodFlag = &cli.DurationFlag{
+		Name:     "equa.faucet.period",
+		Usage:    "Minimum time between two faucet requests of an address or client",
+		Value:    ethconfig.Defaults.EquaFaucet.Period,
+		Category: flags.EquaCategory,
+	}
+	EquaFaucetReferralFlag = &cli.StringFlag{
+		Name:     "equa.faucet.referral",
+		Usage:    "URL of the staking helper unstaked addresses are referred to",
+		Category: flags.EquaCategory,
+	}
+
+	// EQUA validator management settings
+	EquaAdminFlag = &cli.BoolFlag{
+		Name:     "equa.admin",
+		Usage:    "Enable the equaadmin namespace managing the node, served over IPC and the authenticated RPC endpoint",
+		Category: flags.EquaCategory,
+	}
+	EquaAdminRateFlag = &cli.Float64Flag{
+		Name:     "equa.admin.rate",
+		Usage:    "Average number of equaadmin calls allowed per second",
+		Value:    ethconfig.Defaults.EquaAdmin.Rate,
+		Category: flags.EquaCategory,
+	}
+	EquaAdminBurstFlag = &cli.IntFlag{
+		Name:     "equa.admin.burst",
+		Usage:    "Number of equaadmin calls allowed in a burst",
+		Value:    ethconfig.Defaults.EquaAdmin.Burst,
+		Category: flags.EquaCategory,
+	}
+
+	// EQUA MEV detection settings
+	EquaMEVRulesFlag = &cli.StringFlag{
+		Name:     "equa.mevrules",
+		Usage:    "JSON or TOML file of the MEV detection rules, reloadable with equaadmin_reloadMEVRules (default = built-in rules)",
+		Category: flags.EquaCategory,
+	}
+
+	// EQUA encrypted mempool settings
+	EquaKeyShareFlag = &cli.StringFlag{
+		Name:     "equa.keyshare",
+		Usage:    "File of the validator's threshold key share, to publish decryption shares of encrypted transactions",
+		Category: flags.EquaCategory,
+	}
+
+	// EQUA PoW solver settings
+	EquaPoWSolverFlag = &cli.StringFlag{
+		Name:     "equa.powsolver",
+		Usage:    "PoW solver sealing blocks (generic, batched)",
+		Value:    ethconfig.Defaults.EquaPoWSolver,
+		Category: flags.EquaCategory,
+	}
+	EquaPoWThreadsFlag = &cli.IntFlag{
+		Name:     "equa.powthreads",
+		Usage:    "Number of threads the batched PoW solver runs on (0 = one per CPU)",
+		Category: flags.EquaCategory,
+	}
+
 	// Metrics flags
 	MetricsEnabledFlag = &cli.BoolFlag{
 		Name:     "metrics",
@@ -1454,6 +1549,56 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	}
 }
 
+func setEquaCrossCheck(ctx *cli.Context, stack *node.Node, cfg *equa.CrossCheckConfig) {
+	if ctx.IsSet(EquaCrossCheckPeersFlag.Name) {
+		cfg.Peers = SplitAndTrim(ctx.String(EquaCrossCheckPeersFlag.Name))
+	}
+	if ctx.IsSet(EquaCrossCheckSamplesFlag.Name) {
+		cfg.Samples = ctx.Int(EquaCrossCheckSamplesFlag.Name)
+	}
+	if ctx.IsSet(EquaCrossCheckToleranceFlag.Name) {
+		cfg.Tolerance = ctx.Float64(EquaCrossCheckToleranceFlag.Name)
+	}
+	if ctx.IsSet(EquaCrossCheckAlertFlag.Name) {
+		cfg.Alert = ctx.Int(EquaCrossCheckAlertFlag.Name)
+	}
+	if len(cfg.Peers) > 0 && cfg.Dir == "" {
+		cfg.Dir = stack.ResolvePath("crosscheck")
+	}
+}
+
+func setEquaFaucet(ctx *cli.Context, cfg *ethconfig.Config) {
+	faucet := &cfg.EquaFaucet
+	if ctx.IsSet(EquaFaucetAmountFlag.Name) {
+		faucet.Amount = flags.GlobalBig(ctx, EquaFaucetAmountFlag.Name)
+	}
+	if ctx.IsSet(EquaFaucetPeriodFlag.Name) {
+		faucet.Period = ctx.Duration(EquaFaucetPeriodFlag.Name)
+	}
+	if ctx.IsSet(EquaFaucetReferralFlag.Name) {
+		faucet.Referral = ctx.String(EquaFaucetReferralFlag.Name)
+	}
+	if ctx.IsSet(EquaFaucetAccountFlag.Name) {
+		addr := ctx.String(EquaFaucetAccountFlag.Name)
+		if !common.IsHexAddress(addr) {
+			Fatalf("-%s: invalid faucet account %q", EquaFaucetAccountFlag.Name, addr)
+		}
+		faucet.Account = common.HexToAddress(addr)
+	}
+}
+
+func setEquaAdmin(ctx *cli.Context, cfg *equa.AdminConfig) {
+	if ctx.IsSet(EquaAdminFlag.Name) {
+		cfg.Enabled = ctx.Bool(EquaAdminFlag.Name)
+	}
+	if ctx.IsSet(EquaAdminRateFlag.Name) {
+		cfg.Rate = ctx.Float64(EquaAdminRateFlag.Name)
+	}
+	if ctx.IsSet(EquaAdminBurstFlag.Name) {
+		cfg.Burst = ctx.Int(EquaAdminBurstFlag.Name)
+	}
+}
+
 func setTxPool(ctx *cli.Context, cfg *legacypool.Config) {
 	if ctx.IsSet(TxPoolLocalsFlag.Name) {
 		locals := strings.Split(ctx.String(TxPoolLocalsFlag.Name), ",")
@@ -1568,11 +1713,27 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	// Set configurations from CLI flags
 	setEtherbase(ctx, cfg)
 	setGPO(ctx, &cfg.GPO)
+	setEquaCrossCheck(ctx, stack, &cfg.EquaCrossCheck)
+	setEquaFaucet(ctx, cfg)
+	setEquaAdmin(ctx, &cfg.EquaAdmin)
 	setTxPool(ctx, &cfg.TxPool)
 	setBlobPool(ctx, &cfg.BlobPool)
 	setMiner(ctx, &cfg.Miner)
 	setRequiredBlocks(ctx, cfg)
 
+	if ctx.IsSet(EquaMEVRulesFlag.Name) {
+		cfg.EquaMEVRules = ctx.String(EquaMEVRulesFlag.Name)
+	}
+	if ctx.IsSet(EquaKeyShareFlag.Name) {
+		cfg.EquaKeyShare = ctx.String(EquaKeyShareFlag.Name)
+	}
+	if ctx.IsSet(EquaPoWSolverFlag.Name) {
+		cfg.EquaPoWSolver = ctx.String(EquaPoWSolverFlag.Name)
+	}
+	if ctx.IsSet(EquaPoWThreadsFlag.Name) {
+		cfg.EquaPoWThreads = ctx.Int(EquaPoWThreadsFlag.Name)
+	}
+
 	// Cap the cache allowance and tune the garbage collector
 	mem, err := gopsutil.VirtualMemory()
 	if err == nil {
@@ -111,3 +111,19 @@ type Engine interface {
 	// Close terminates any background threads maintained by the consensus engine.
 	Close() error
 }
+
+// ReceiptsFinalizer is implemented by consensus engines whose post-transaction
+// state modifications depend on the receipts of the block's transactions.
+type ReceiptsFinalizer interface {
+	// FinalizeWithReceipts is like Finalize, but is given the receipts of the
+	// transactions executed in the block. It may reject the block, if a check
+	// depending on the state it is processed with fails.
+	FinalizeWithReceipts(chain ChainHeaderReader, header *types.Header, state vm.StateDB, body *types.Body, receipts []*types.Receipt) error
+}
+
+// TxGroup is a sequence of transactions included in a block contiguously and in
+// order, a single transaction unless the transactions were bundled.
+type TxGroup struct {
+	Txs    []*types.Transaction
+	Atomic bool // Whether the transactions are included all-or-nothing
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/params"
+)
+
+// New validators, whether they joined by deposit or by registering with the
+// staking contract, do not become active right away. Like on the beacon chain
+// they enter an activation queue, become eligible for activation at the epoch
+// after the one they joined in and are activated at epoch boundaries, at most
+// the churn limit of them per epoch. This keeps the validator set from being
+// swamped within a single epoch.
+
+// PendingValidator is a validator waiting in the activation queue.
+type PendingValidator struct {
+	Address          common.Address `json:"address"`
+	Stake            *big.Int       `json:"stake"`
+	PublicKey        hexutil.Bytes  `json:"publicKey,omitempty"`
+	EligibilityEpoch uint64         `json:"eligibilityEpoch"`          // Epoch from which the validator can be activated
+	ActivationEpoch  uint64         `json:"activationEpoch,omitempty"` // Expected activation epoch, only set in queue reports
+
+	position uint64 // Position in the activation queue
+}
+
+// ValidatorQueue is the state of the activation and exit queues as reported
+// over the API.
+type ValidatorQueue struct {
+	Epoch      uint64              `json:"epoch"`      // Current epoch
+	ChurnLimit uint64              `json:"churnLimit"` // Validators activated per epoch at most
+	Activation []*PendingValidator `json:"activation"` // Validators awaiting activation, in activation order
+	Exits      []*VoluntaryExit    `json:"exits"`      // Voluntary exits awaiting their epoch
+}
+
+// enqueue adds stake to the activation queue, either as a new entry eligible
+// from the epoch after the given one or as a top-up of a queued one, which
+// keeps its eligibility and position.
+func (r *validatorRegistry) enqueue(addr common.Address, stake *big.Int, pubKey []byte, epoch uint64) {
+	reg := r.get(addr)
+	if reg.status == registrationQueued {
+		reg.stake.Add(reg.stake, stake)
+		if len(reg.key) == 0 {
+			reg.key = common.CopyBytes(pubKey)
+		}
+		r.put(reg)
+		return
+	}
+	r.initialize()
+	position := r.state.GetState(params.EquaValidatorsAddress, registryPositionsSlot).Big().Uint64()
+	r.state.SetState(params.EquaValidatorsAddress, registryPositionsSlot, common.BigToHash(new(big.Int).SetUint64(position+1)))
+
+	r.put(&registration{
+		address:  addr,
+		status:   registrationQueued,
+		stake:    new(big.Int).Set(stake),
+		slashed:  reg.slashed,
+		epoch:    epoch + 1,
+		position: position,
+		key:      common.CopyBytes(pubKey),
+	})
+}
+
+// activatable reports whether a queued validator can be activated at the given
+// epoch: it must be eligible and meet the minimum stake of the base class.
+func activatable(config *params.EquaConfig, pending *PendingValidator, epoch uint64) bool {
+	return pending.EligibilityEpoch <= epoch && pending.Stake.Cmp(baseClass(config).MinStake) >= 0
+}
+
+// activate activates the queued validators eligible at the given epoch, in
+// queue order and at most the churn limit of them, returning the activated
+// ones.
+func (r *validatorRegistry) activate(epoch uint64) []*PendingValidator {
+	var queue []*PendingValidator
+	for _, reg := range r.registrations(registrationQueued) {
+		queue = append(queue, &PendingValidator{
+			Address:          reg.address,
+			Stake:            reg.stake,
+			PublicKey:        reg.key,
+			EligibilityEpoch: reg.epoch,
+			position:         reg.position,
+		})
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].position < queue[j].position })
+
+	var activated []*PendingValidator
+	for _, pending := range queue {
+		if uint64(len(activated)) == r.config.ChurnLimit {
+			break
+		}
+		if !activatable(r.config, pending, epoch) {
+			continue
+		}
+		reg := r.get(pending.Address)
+		reg.status, reg.epoch, reg.position = registrationActive, 0, 0
+		r.put(reg)
+		activated = append(activated, pending)
+	}
+	return activated
+}
+
+// ValidatorQueue reports the activation and exit queues at the given epoch,
+// along with when the queued validators are expected to be activated if their
+// stake does not change.
+func (sm *StakeManager) ValidatorQueue(epoch uint64) *ValidatorQueue {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	queue := &ValidatorQueue{
+		Epoch:      epoch,
+		ChurnLimit: sm.config.ChurnLimit,
+		Activation: []*PendingValidator{},
+		Exits:      sm.pendingExits(),
+	}
+	// Simulate the coming epoch boundaries until every activatable validator
+	// has been placed
+	var (
+		waiting = make([]*PendingValidator, 0, len(sm.queue))
+		next    = epoch + 1
+	)
+	for _, pending := range sm.queue {
+		cpy := *pending
+		cpy.Stake = new(big.Int).Set(pending.Stake)
+		waiting = append(waiting, &cpy)
+	}
+	for len(waiting) > 0 && sm.config.ChurnLimit > 0 {
+		var (
+			remaining = waiting[:0]
+			activated uint64
+		)
+		for _, pending := range waiting {
+			if activated < sm.config.ChurnLimit && activatable(sm.config, pending, next) {
+				pending.ActivationEpoch = next
+				queue.Activation = append(queue.Activation, pending)
+				activated++
+				continue
+			}
+			remaining = append(remaining, pending)
+		}
+		waiting = remaining
+
+		// Stop at validators that will never be activated without a top-up
+		if activated == 0 {
+			stuck := true
+			for _, pending := range waiting {
+				if pending.EligibilityEpoch > next {
+					stuck = false
+				}
+			}
+			if stuck {
+				break
+			}
+		}
+		next++
+	}
+	// Validators short of the minimum stake are listed last, without an
+	// expected activation
+	queue.Activation = append(queue.Activation, waiting...)
+	return queue
+}
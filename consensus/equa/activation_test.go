@@ -0,0 +1,90 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that queued validators are activated in order at epoch boundaries, no
+// more than the churn limit per epoch and only once eligible and fully staked.
+func TestActivationQueue(t *testing.T) {
+	var (
+		ether      = big.NewInt(1e18)
+		full       = new(big.Int).Mul(big.NewInt(32), ether)
+		short      = new(big.Int).Mul(big.NewInt(16), ether)
+		config     = &params.EquaConfig{ChurnLimit: 2}
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		registry   = newValidatorRegistry(statedb, config)
+		sm         = NewStakeManager(config)
+	)
+	addrs := make([]common.Address, 5)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	// Queue three validators at epoch 0, one at epoch 1 and one short of stake,
+	// the first one in two deposits
+	registry.enqueue(addrs[0], short, nil, 0)
+	for _, addr := range addrs[1:3] {
+		registry.enqueue(addr, full, nil, 0)
+	}
+	registry.enqueue(addrs[0], short, nil, 1)
+	registry.enqueue(addrs[3], full, nil, 1)
+	registry.enqueue(addrs[4], short, nil, 0)
+
+	sm.load(statedb, common.Hash{1})
+	queue := sm.ValidatorQueue(0)
+	if len(queue.Activation) != 5 {
+		t.Fatalf("queue length mismatch: have %d, want 5", len(queue.Activation))
+	}
+	for i, want := range []uint64{1, 1, 2, 2, 0} {
+		if have := queue.Activation[i].ActivationEpoch; have != want {
+			t.Errorf("validator %d: expected activation mismatch: have %d, want %d", i, have, want)
+		}
+	}
+	// Nothing is activated before eligibility, then at most the churn limit
+	if activated := registry.activate(0); len(activated) != 0 {
+		t.Fatalf("activated %d validators before eligibility", len(activated))
+	}
+	if activated := registry.activate(1); len(activated) != 2 || activated[0].Address != addrs[0] || activated[1].Address != addrs[1] {
+		t.Fatalf("unexpected activations at epoch 1: %v", activated)
+	}
+	if activated := registry.activate(2); len(activated) != 2 || activated[0].Address != addrs[2] || activated[1].Address != addrs[3] {
+		t.Fatalf("unexpected activations at epoch 2: %v", activated)
+	}
+	if activated := registry.activate(3); len(activated) != 0 {
+		t.Fatalf("activated a validator short of stake")
+	}
+	// Topping up the remaining validator gets it activated
+	registry.enqueue(addrs[4], short, nil, 3)
+	if activated := registry.activate(4); len(activated) != 1 || activated[0].Address != addrs[4] {
+		t.Fatalf("topped up validator not activated: %v", activated)
+	}
+	sm.load(statedb, common.Hash{2})
+	if have := len(sm.GetValidators()); have != 5 {
+		t.Fatalf("validator count mismatch: have %d, want 5", have)
+	}
+	if len(sm.queue) != 0 {
+		t.Fatalf("activated validators still queued: %d", len(sm.queue))
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+
+	"github.com/equa/go-equa/log"
+	"golang.org/x/time/rate"
+)
+
+var (
+	errAdminRateLimited = errors.New("admin call rate limited")
+	errInvalidAdminRate = errors.New("admin call rate must be positive")
+)
+
+// AdminConfig configures the equaadmin namespace, serving the calls changing the
+// settings of the node. The namespace is only served over
+// IPC and the JWT-authenticated RPC endpoint.
+type AdminConfig struct {
+	Enabled bool    // Whether the admin namespace is served
+	Rate    float64 // Calls allowed per second, on average
+	Burst   int     // Calls allowed in a burst
+}
+
+// DefaultAdminConfig contains the default settings of the admin namespace.
+var DefaultAdminConfig = AdminConfig{
+	Rate:  1,
+	Burst: 10,
+}
+
+// AdminAPI exposes the node management functions of the EQUA engine to
+// the operator of the node. Calls are rate limited and every one of them is
+// logged for auditing.
+type AdminAPI struct {
+	equa    *Equa
+	limiter *rate.Limiter
+}
+
+// EnableAdminAPI serves the equaadmin namespace with the given settings.
+func (e *Equa) EnableAdminAPI(config AdminConfig) error {
+	if config.Rate <= 0 || config.Burst <= 0 {
+		return errInvalidAdminRate
+	}
+	e.admin = &AdminAPI{
+		equa:    e,
+		limiter: rate.NewLimiter(rate.Limit(config.Rate), config.Burst),
+	}
+	return nil
+}
+
+// call runs an admin call if the rate limit allows, logging its outcome along
+// with the given key-value context.
+func (api *AdminAPI) call(method string, fn func() error, ctx ...interface{}) error {
+	err := errAdminRateLimited
+	if api.limiter.Allow() {
+		err = fn()
+	}
+	ctx = append([]interface{}{"method", "equaadmin_" + method}, ctx...)
+	if err != nil {
+		log.Warn("Admin call failed", append(ctx, "err", err)...)
+	} else {
+		log.Info("Admin call", ctx...)
+	}
+	return err
+}
+
+// ReloadMEVRules reads the MEV detection rules from the configured file again,
+// applying them to the blocks analyzed from then on
+func (api *AdminAPI) ReloadMEVRules() (*MEVRules, error) {
+	var rules *MEVRules
+	err := api.call("reloadMEVRules", func() (err error) {
+		rules, err = api.equa.ReloadMEVRules()
+		return err
+	})
+	return rules, err
+}
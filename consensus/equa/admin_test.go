@@ -0,0 +1,52 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"testing"
+)
+
+// Tests that the admin namespace is only served if enabled and behind
+// authentication, and that its calls are rate limited.
+func TestAdminAPI(t *testing.T) {
+	engine := newTestEngine(t, 32)
+	if apis := engine.APIs(nil); len(apis) != 1 {
+		t.Fatalf("admin namespace served while disabled: %d namespaces", len(apis))
+	}
+	if err := engine.EnableAdminAPI(AdminConfig{Enabled: true}); !errors.Is(err, errInvalidAdminRate) {
+		t.Fatalf("zero rate: have %v, want %v", err, errInvalidAdminRate)
+	}
+	if err := engine.EnableAdminAPI(AdminConfig{Enabled: true, Rate: 1e-9, Burst: 3}); err != nil {
+		t.Fatalf("failed to enable admin namespace: %v", err)
+	}
+	apis := engine.APIs(nil)
+	if len(apis) != 2 || apis[1].Namespace != "equaadmin" || !apis[1].Authenticated || apis[1].Public {
+		t.Fatalf("admin namespace mismatch: have %+v", apis)
+	}
+	admin := engine.admin
+
+	// Failed calls count against the limit as well
+	for i := 0; i < 3; i++ {
+		if _, err := admin.ReloadMEVRules(); !errors.Is(err, errNoMEVRulesFile) {
+			t.Fatalf("reload without rules file: have %v, want %v", err, errNoMEVRulesFile)
+		}
+	}
+	if _, err := admin.ReloadMEVRules(); !errors.Is(err, errAdminRateLimited) {
+		t.Fatalf("call over the limit: have %v, want %v", err, errAdminRateLimited)
+	}
+}
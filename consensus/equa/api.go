@@ -5,11 +5,28 @@ package equa
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
 	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/state"
 	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/event"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+	"github.com/equa/go-equa/rpc"
+)
+
+// maxScanBlocks is the number of blocks a statistics query scans at most.
+const maxScanBlocks = 1024
+
+var (
+	errBlocksUnavailable   = errors.New("block bodies unavailable")
+	errReceiptsUnavailable = errors.New("block receipts unavailable")
+	errStateUnavailable    = errors.New("state unavailable")
 )
 
 // API exposes EQUA consensus engine related functions for RPC access.
@@ -33,6 +50,7 @@ func (api *API) GetValidators() map[string]interface{} {
 			"stake":     validator.Stake.String(),
 			"lastBlock": validator.LastBlock,
 			"slashed":   validator.Slashed,
+			"class":     api.equa.stakeManager.validatorClass(validator).Name,
 		}
 	}
 	result["validators"] = validatorList
@@ -58,35 +76,84 @@ func (api *API) GetValidator(address common.Address) map[string]interface{} {
 		"slashed":     validator.Slashed,
 		"slashAmount": validator.SlashAmount.String(),
 		"eligible":    api.equa.stakeManager.IsEligible(address),
+		"filter":      validator.Filter,
+		"class":       api.equa.stakeManager.validatorClass(validator).Name,
 	}
 }
 
-// GetMEVStats returns MEV statistics for recent blocks
-func (api *API) GetMEVStats(blockCount int) map[string]interface{} {
-	if blockCount <= 0 {
-		blockCount = 100
+// GetMEVStats returns the MEV detected in recent blocks and the share of it
+// burned, as recorded in the burn ledger, along with the block the ledger is
+// indexed up to in the background and the blocks left out of it for lack of
+// receipts
+func (api *API) GetMEVStats(blockCount int) (map[string]interface{}, error) {
+	first, last := api.scanRange(blockCount)
+
+	entry, err := api.equa.burnEntry(api.chain, last)
+	if err != nil {
+		return nil, err
 	}
+	totalMEV := new(big.Int).Set(entry.TotalMEV)
+	totalBurned := new(big.Int).Set(entry.TotalBurned)
+	blocksWithMEV := entry.TotalMEVBlocks
+	blocksUnavailable := entry.TotalUnavailable
 
-	currentBlock := api.chain.CurrentHeader().Number.Uint64()
-	startBlock := currentBlock - uint64(blockCount)
-	if startBlock > currentBlock {
-		startBlock = 0
+	if first > 0 {
+		parent, err := api.equa.burnEntry(api.chain, first-1)
+		if err != nil {
+			return nil, err
+		}
+		totalMEV.Sub(totalMEV, parent.TotalMEV)
+		totalBurned.Sub(totalBurned, parent.TotalBurned)
+		blocksWithMEV -= parent.TotalMEVBlocks
+		blocksUnavailable -= parent.TotalUnavailable
 	}
+	return map[string]interface{}{
+		"blockRange":        []uint64{first, last},
+		"totalMEV":          totalMEV.String(),
+		"totalBurned":       totalBurned.String(),
+		"blocksWithMEV":     int(blocksWithMEV),
+		"blocksUnavailable": int(blocksUnavailable),
+		"indexedBlock":      readBurnHead(api.equa.db),
+		"burnPercentage":    api.equa.config.MEVBurnPercentage,
+	}, nil
+}
 
-	totalMEV := big.NewInt(0)
-	totalBurned := big.NewInt(0)
-	blocksWithMEV := 0
+// GetMEVRules returns the protocol rules MEV is detected with in local analysis
+func (api *API) GetMEVRules() *MEVRules {
+	return api.equa.mevDetector.Rules()
+}
 
-	// This is a simplified version - real implementation would
-	// scan through blocks and calculate actual MEV
+// TraceMEV attributes the MEV detected in a canonical block to the transactions
+// and accounts involved, given the hash of the block or of a transaction in it.
+// Given a transaction, only the findings it takes part in are reported
+func (api *API) TraceMEV(hash common.Hash) (*MEVTrace, error) {
+	return api.equa.mevTrace(api.chain, hash)
+}
 
-	return map[string]interface{}{
-		"blockRange":     []uint64{startBlock, currentBlock},
-		"totalMEV":       totalMEV.String(),
-		"totalBurned":    totalBurned.String(),
-		"blocksWithMEV":  blocksWithMEV,
-		"burnPercentage": api.equa.config.MEVBurnPercentage,
+// GetTotalBurned returns the MEV burned and paid to proposers up to the current
+// head, as recorded in the burn ledger
+func (api *API) GetTotalBurned() (*BurnEntry, error) {
+	return api.equa.burnEntry(api.chain, api.chain.CurrentHeader().Number.Uint64())
+}
+
+// GetBurnHistory returns the burn ledger entries of the canonical blocks between
+// the given blocks, with the running totals up to each of them
+func (api *API) GetBurnHistory(fromBlock uint64, toBlock uint64) ([]*BurnEntry, error) {
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("invalid block range %d-%d", fromBlock, toBlock)
 	}
+	if toBlock-fromBlock >= maxScanBlocks {
+		return nil, fmt.Errorf("block range %d-%d exceeds %d blocks", fromBlock, toBlock, maxScanBlocks)
+	}
+	entries := make([]*BurnEntry, 0, toBlock-fromBlock+1)
+	for number := fromBlock; number <= toBlock; number++ {
+		entry, err := api.equa.burnEntry(api.chain, number)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
 }
 
 // GetConsensusInfo returns information about the consensus configuration
@@ -99,11 +166,24 @@ func (api *API) GetConsensusInfo() map[string]interface{} {
 		"powDifficulty":       api.equa.config.PoWDifficulty,
 		"validatorReward":     api.equa.config.ValidatorReward,
 		"slashingPercentage":  api.equa.config.SlashingPercentage,
+		"slashingPenalties":   slashingPenalties(api.equa.config),
+		"orderingPolicy":      api.equa.fairOrderer.Policy().Name(),
+		"orderingParams":      api.equa.fairOrderer.Policy().Params(),
 		"currentEpoch":        api.equa.epoch,
 		"currentBlockNumber":  api.equa.blockNumber,
 	}
 }
 
+// slashingPenalties returns the share of stake slashed for every violation by
+// name, as configured or defaulted
+func slashingPenalties(config *params.EquaConfig) map[string]uint64 {
+	penalties := make(map[string]uint64, len(params.EquaPenalties))
+	for _, penalty := range params.EquaPenalties {
+		penalties[penalty.Name] = config.SlashingPenalty(penalty.Name)
+	}
+	return penalties
+}
+
 // GetThresholdPublicKey returns the master public key for threshold encryption
 func (api *API) GetThresholdPublicKey() string {
 	if api.equa.thresholdCrypto.masterPubKey == nil {
@@ -132,37 +212,210 @@ func (api *API) ProposeBlock(ctx context.Context) (*types.Block, error) {
 	return nil, errors.New("block proposal not implemented in API")
 }
 
-// GetPoWDifficulty returns current PoW difficulty
+// GetPoWDifficulty returns the PoW difficulty of the next block
 func (api *API) GetPoWDifficulty() uint64 {
-	return api.equa.powEngine.GetDifficulty()
+	return api.equa.CalcDifficulty(api.chain, 0, api.chain.CurrentHeader()).Uint64()
 }
 
-// GetOrderingScore returns the ordering quality score for a block
-func (api *API) GetOrderingScore(blockNumber uint64) map[string]interface{} {
-	// Get block
+// GetPoWQuality returns the quality of the PoW solution sealed into a block, so
+// that it can be verified and compared independently of proposer selection
+func (api *API) GetPoWQuality(blockNumber uint64) map[string]interface{} {
 	header := api.chain.GetHeaderByNumber(blockNumber)
 	if header == nil {
 		return map[string]interface{}{
 			"error": "block not found",
 		}
 	}
+	return map[string]interface{}{
+		"blockNumber": blockNumber,
+		"hash":        header.Hash(),
+		"proposer":    header.Coinbase,
+		"quality":     api.equa.powEngine.SolutionQuality(header).String(),
+		"difficulty":  api.equa.powEngine.GetDifficulty(),
+	}
+}
 
-	// This would require access to transaction list and ordering analysis
-	// For now, return a placeholder
+// GetOrderingScore returns the ordering quality score for a block
+func (api *API) GetOrderingScore(blockNumber uint64) map[string]interface{} {
+	// Own proposals were scored while assembling them, answer without loading
+	// and re-scoring the block
+	if header := api.chain.GetHeaderByNumber(blockNumber); header != nil {
+		if own, ok := api.equa.ownAssessments.Get(header.TxHash); ok && own.proposer == header.Coinbase {
+			return map[string]interface{}{
+				"blockNumber":   blockNumber,
+				"blockHash":     header.Hash(),
+				"orderingScore": own.orderingScore,
+				"fairOrdering":  own.fairOrdering,
+				"mev":           own.mev,
+				"ownProposal":   true,
+			}
+		}
+	}
+	// Get block
+	block := api.getBlock(blockNumber)
+	if block == nil {
+		return map[string]interface{}{
+			"error": "block not found",
+		}
+	}
+	return map[string]interface{}{
+		"blockNumber":   blockNumber,
+		"blockHash":     block.Hash(),
+		"orderingScore": api.equa.fairOrderer.GetOrderingScore(block.Transactions()),
+		"fairOrdering":  api.equa.fairOrderer.ValidateOrdering(block.Transactions()),
+	}
+}
 
+// GetArrival returns the arrival time used to order a transaction along with
+// the timestamp receipts of the validators it is derived from
+func (api *API) GetArrival(hash common.Hash) map[string]interface{} {
+	timestamp, ok := api.equa.arrivals.Timestamp(hash)
+	if !ok {
+		return map[string]interface{}{
+			"error": "arrival unknown",
+		}
+	}
 	return map[string]interface{}{
-		"blockNumber":    blockNumber,
-		"orderingScore":  1.0, // Placeholder
-		"fairOrdering":   true,
+		"hash":      hash,
+		"timestamp": timestamp.UnixMilli(),
+		"receipts":  api.equa.arrivals.Receipts(hash),
 	}
 }
 
-// GetSlashingEvents returns recent slashing events
-func (api *API) GetSlashingEvents(blockCount int) []map[string]interface{} {
-	// This would return actual slashing events from recent blocks
-	// For now, return empty array
+// GetCacheStats returns the occupancy of the bounded caches of the engine and
+// the entries they dropped, by cache name
+func (api *API) GetCacheStats() map[string]*CacheStats {
+	return map[string]*CacheStats{
+		"arrivals": api.equa.arrivals.Stats(),
+	}
+}
 
-	return []map[string]interface{}{}
+// CrossCheckOrdering compares the ordering score of a block with the scores
+// reported by a sample of the configured peers
+func (api *API) CrossCheckOrdering(ctx context.Context, blockNumber uint64) (*CrossCheckReport, error) {
+	if api.equa.crossCheck == nil {
+		return nil, errCrossCheckDisabled
+	}
+	block := api.getBlock(blockNumber)
+	if block == nil {
+		return nil, errUnknownBlock
+	}
+	return api.equa.crossCheck.Check(ctx, block, chainReceipts(api.chain, block.Hash())), nil
+}
+
+// GetDivergenceHistory returns the recent blocks whose ordering score or MEV
+// verdict diverged from the ones reported by peers
+func (api *API) GetDivergenceHistory() ([]*CrossCheckReport, error) {
+	if api.equa.crossCheck == nil {
+		return nil, errCrossCheckDisabled
+	}
+	return api.equa.crossCheck.History(), nil
+}
+
+// getBlock retrieves a canonical block by number, or nil if the chain does not
+// give access to block bodies.
+func (api *API) getBlock(number uint64) *types.Block {
+	chain, ok := api.chain.(consensus.ChainReader)
+	if !ok {
+		return nil
+	}
+	header := chain.GetHeaderByNumber(number)
+	if header == nil {
+		return nil
+	}
+	return chain.GetBlock(header.Hash(), number)
+}
+
+// blockReceipts retrieves a canonical block by number along with its receipts,
+// failing if either is not available.
+func blockReceipts(chain consensus.ChainHeaderReader, number uint64) (*types.Block, types.Receipts, error) {
+	block, err := chainBlock(chain, number)
+	if err != nil {
+		return nil, nil, err
+	}
+	receipts := chainReceipts(chain, block.Hash())
+	if len(receipts) != len(block.Transactions()) {
+		return nil, nil, fmt.Errorf("%w: block %d", errReceiptsUnavailable, number)
+	}
+	return block, receipts, nil
+}
+
+// chainBlock retrieves a canonical block by number, failing if it is not
+// available.
+func chainBlock(chain consensus.ChainHeaderReader, number uint64) (*types.Block, error) {
+	reader, ok := chain.(consensus.ChainReader)
+	if !ok {
+		return nil, errBlocksUnavailable
+	}
+	header := reader.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownBlock, number)
+	}
+	block := reader.GetBlock(header.Hash(), number)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownBlock, number)
+	}
+	return block, nil
+}
+
+// scanRange returns the range of the given number of most recent blocks,
+// defaulting to 100 and capped at maxScanBlocks.
+func (api *API) scanRange(blockCount int) (uint64, uint64) {
+	if blockCount <= 0 {
+		blockCount = 100
+	}
+	count := uint64(min(blockCount, maxScanBlocks))
+
+	last := api.chain.CurrentHeader().Number.Uint64()
+	if last < count {
+		return 0, last
+	}
+	return last - count + 1, last
+}
+
+// GetSlashingEvents returns the slashable offenses detected in recent blocks, as
+// recorded in the slashing history, analyzing the blocks not recorded yet
+func (api *API) GetSlashingEvents(blockCount int) ([]*SlashingEvent, error) {
+	first, last := api.scanRange(blockCount)
+
+	events := []*SlashingEvent{}
+	for number := first; number <= last; number++ {
+		block, err := api.equa.slashingEvents(api.chain, number)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, block...)
+	}
+	return events, nil
+}
+
+// GetSlashingHistory returns the stored slashing events of a validator between
+// the given blocks, both detected in canonical blocks and reported as evidence
+func (api *API) GetSlashingHistory(validator common.Address, fromBlock uint64, toBlock uint64) ([]*SlashingEvent, error) {
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("invalid block range %d-%d", fromBlock, toBlock)
+	}
+	history, err := api.equa.slasher.History(validator, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	// Drop the events detected in blocks that have since been reorged out
+	events := history[:0]
+	for _, ev := range history {
+		if !ev.Evidence {
+			if header := api.chain.GetHeaderByNumber(ev.Number); header == nil || header.Hash() != ev.Hash {
+				continue
+			}
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// GetSlashingEvidence returns the slashing evidence still within its validity
+// window, ordered by block
+func (api *API) GetSlashingEvidence() []*Evidence {
+	return api.equa.slasher.PendingEvidence()
 }
 
 // IsValidator checks if an address is a validator
@@ -170,13 +423,557 @@ func (api *API) IsValidator(address common.Address) bool {
 	return api.equa.stakeManager.HasStake(address)
 }
 
-// GetValidatorKeyShare returns the key share for a validator (restricted access)
-func (api *API) GetValidatorKeyShare(address common.Address) string {
-	validator, exists := api.equa.stakeManager.GetValidator(address)
-	if !exists {
-		return ""
+// headState returns the state of the head block, if the chain provides it.
+func (api *API) headState() (*state.StateDB, error) {
+	chain, ok := api.chain.(interface {
+		State() (*state.StateDB, error)
+	})
+	if !ok {
+		return nil, errStateUnavailable
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStateUnavailable, err)
+	}
+	return statedb, nil
+}
+
+// GetSmoothingPool returns the reward smoothing pool participants in the epoch
+// of the head block and the rewards each has received from the pool, as of the
+// head state
+func (api *API) GetSmoothingPool() (map[string]interface{}, error) {
+	statedb, err := api.headState()
+	if err != nil {
+		return nil, err
+	}
+	epoch := scheduleEpoch(api.chain.CurrentHeader().Number.Uint64(), api.equa.config.Epoch)
+	members := api.equa.smoothingPoolMembers(statedb, epoch)
+
+	memberList := make([]map[string]interface{}, len(members))
+	for i, member := range members {
+		memberList[i] = map[string]interface{}{
+			"address":         member.address.Hex(),
+			"stake":           member.stake.String(),
+			"smoothedRewards": smoothedRewards(statedb, member.address).String(),
+		}
+	}
+	return map[string]interface{}{
+		"address": SmoothingPoolAddress.Hex(),
+		"count":   len(members),
+		"members": memberList,
+	}, nil
+}
+
+// GetValidatorRewards returns the rewards credited to an account in the
+// canonical blocks of an epoch range, including both ends, by epoch and kind.
+// Only blocks executed by this node are accounted for
+func (api *API) GetValidatorRewards(validator common.Address, fromEpoch uint64, toEpoch uint64) (*ValidatorRewards, error) {
+	return api.equa.validatorRewards(api.chain, validator, fromEpoch, toEpoch)
+}
+
+// GetEpochSummary returns the accounting of a finished epoch: the blocks
+// proposed, MEV detected, rewards credited and offenses of each validator
+func (api *API) GetEpochSummary(epoch uint64) (*EpochSummary, error) {
+	return api.equa.SummarizeEpoch(api.chain, epoch)
+}
+
+// GetValidatorPerformance returns the track record of a validator over a range
+// of finished epochs, including both ends: the blocks it was scheduled for and
+// proposed, the ordering score, MEV, rewards and offenses of its blocks, as
+// recorded in the epoch summaries, along with its current status and stake
+func (api *API) GetValidatorPerformance(validator common.Address, fromEpoch uint64, toEpoch uint64) (*ValidatorPerformance, error) {
+	return api.equa.validatorPerformance(api.chain, validator, fromEpoch, toEpoch)
+}
+
+// RequestExit verifies a signed voluntary exit against the head of the chain
+// and returns the data of the transaction carrying it on chain, which anyone
+// can send to the exit address. The exit must take effect at a later epoch
+// than the current one. Once processed, the validator no longer proposes and
+// its stake unbonds for the configured number of epochs
+func (api *API) RequestExit(exit VoluntaryExit) (hexutil.Bytes, error) {
+	statedb, err := api.headState()
+	if err != nil {
+		return nil, err
+	}
+	if err := newValidatorRegistry(statedb, api.equa.config).checkExit(&exit, api.equa.chainID, api.chain.CurrentHeader().Number.Uint64()/api.equa.config.Epoch); err != nil {
+		return nil, err
+	}
+	if queuedExitEpoch(statedb, exit.Validator) != 0 {
+		return nil, errExitAlreadyQueued
+	}
+	return exit.TxData()
+}
+
+// GetWithdrawals returns the stake of exited validators, unbonding or ready to
+// be withdrawn, optionally only that of the given validator
+func (api *API) GetWithdrawals(validator *common.Address) []*Withdrawal {
+	withdrawals := api.equa.stakeManager.Withdrawals(api.chain.CurrentHeader().Number.Uint64() / api.equa.config.Epoch)
+	if validator == nil {
+		return withdrawals
+	}
+	var filtered []*Withdrawal
+	for _, w := range withdrawals {
+		if w.Validator == *validator {
+			filtered = append(filtered, w)
+		}
+	}
+	return filtered
+}
+
+// VerifyDepositProof verifies a deposit into the staking contract against the
+// receipts of the local chain. Deposits are credited by the blocks emitting
+// them, this only proves that a deposit was made
+func (api *API) VerifyDepositProof(proof DepositProof) (*Deposit, error) {
+	// Only accept deposits from the canonical chain, side chain deposits may
+	// never materialise
+	header := api.chain.GetHeaderByHash(proof.BlockHash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if canonical := api.chain.GetHeaderByNumber(header.Number.Uint64()); canonical == nil || canonical.Hash() != header.Hash() {
+		return nil, errUnknownBlock
+	}
+	return VerifyDeposit(header, &proof, api.chain.Config().DepositContractAddress)
+}
+
+// GetPendingExits returns the voluntary exits awaiting processing
+func (api *API) GetPendingExits() []*VoluntaryExit {
+	return api.equa.stakeManager.PendingExits()
+}
+
+// GetValidatorQueue returns the validators awaiting activation, with the epoch
+// they are expected to be activated at, and the pending voluntary exits
+func (api *API) GetValidatorQueue() *ValidatorQueue {
+	return api.equa.stakeManager.ValidatorQueue(api.chain.CurrentHeader().Number.Uint64() / api.equa.config.Epoch)
+}
+
+// RegisterBuilder admits an external builder to submit bids, or updates its
+// registration
+func (api *API) RegisterBuilder(reg BuilderRegistration) error {
+	return api.equa.builderMarket.Register(&reg)
+}
+
+// GetBuilders returns the registered external builders
+func (api *API) GetBuilders() []*BuilderRegistration {
+	return api.equa.builderMarket.Builders()
+}
+
+// SubmitBuilderBid submits a payload signed by a registered builder, returning
+// the outcome of the MEV and fair ordering checks
+func (api *API) SubmitBuilderBid(bid BuilderBid) (*BidAudit, error) {
+	var baseFee *big.Int
+	if parent := api.chain.GetHeaderByHash(bid.ParentHash); parent != nil {
+		baseFee = nextBaseFee(api.chain.Config(), parent)
+	}
+	return api.equa.builderMarket.SubmitBid(&bid, baseFee)
+}
+
+// GetBidAudit returns the most recent builder bid evaluations
+func (api *API) GetBidAudit() []*BidAudit {
+	return api.equa.builderMarket.Audit()
+}
+
+// SimulateOrdering previews how the fair orderer would order the given raw
+// transactions, with their fairness scores, MEV risks and the sandwiches fair
+// ordering breaks up, without touching the chain state
+func (api *API) SimulateOrdering(txs []hexutil.Bytes) (*OrderingSimulation, error) {
+	head := api.chain.CurrentHeader()
+	seed, err := api.equa.blockOrderingSeed(api.chain, head.Number.Uint64()+1, head)
+	if err != nil {
+		return nil, err
+	}
+	return api.equa.SimulateOrdering(txs, nextBaseFee(api.chain.Config(), head), seed)
+}
+
+// GetInclusionList returns the inclusion list published in a block, along with
+// whether the next block included the listed transactions
+func (api *API) GetInclusionList(blockNumber uint64) (*InclusionListStatus, error) {
+	header := api.chain.GetHeaderByNumber(blockNumber)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	next := api.getBlock(blockNumber + 1)
+	if next != nil && next.ParentHash() != header.Hash() {
+		next = nil
+	}
+	return inclusionListStatus(api.equa.senders, header, next)
+}
+
+// GetOrderingClaim returns the ordering claim of a canonical block, with the
+// claimed arrival times if this node proposed the block
+func (api *API) GetOrderingClaim(blockNumber uint64) (*OrderingClaimStatus, error) {
+	return api.equa.orderingClaimStatus(api.chain, blockNumber, nil)
+}
+
+// VerifyOrderingClaim checks arrival times published by the proposer of a
+// canonical block against its ordering claim, reporting whether they yield the
+// claimed ordering score
+func (api *API) VerifyOrderingClaim(blockNumber uint64, arrivals []*TxArrival) (*OrderingClaimStatus, error) {
+	if arrivals == nil {
+		arrivals = []*TxArrival{}
+	}
+	return api.equa.orderingClaimStatus(api.chain, blockNumber, arrivals)
+}
+
+// BuildInclusionList returns the pending transactions this node would list for
+// inclusion if it sealed a block now
+func (api *API) BuildInclusionList() []common.Hash {
+	txs := api.equa.buildInclusionList(api.equa.senders, nil, nextBaseFee(api.chain.Config(), api.chain.CurrentHeader()))
+
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	return hashes
+}
+
+// DeclareFilter publishes a signed declaration of the contracts a validator
+// excludes from its blocks
+func (api *API) DeclareFilter(decl FilterDeclaration) error {
+	return api.equa.stakeManager.DeclareFilter(&decl)
+}
+
+// GetFilterDeclarations returns all published validator filter declarations
+func (api *API) GetFilterDeclarations() []*FilterDeclaration {
+	var decls []*FilterDeclaration
+	for _, validator := range api.equa.stakeManager.GetValidators() {
+		if validator.Filter != nil {
+			decls = append(decls, validator.Filter)
+		}
+	}
+	return decls
+}
+
+// GetValidatorClasses returns the validator classes, each validator falling in
+// the one with the highest minimum stake it meets
+func (api *API) GetValidatorClasses() []params.EquaValidatorClass {
+	return api.equa.stakeManager.Classes()
+}
+
+// epochSeed returns the shuffling randomness of an epoch, available once the
+// last block before it is part of the canonical chain
+func (api *API) epochSeed(epoch uint64) (common.Hash, error) {
+	header := api.chain.GetHeaderByNumber(shuffleBoundary(epoch, api.equa.config.Epoch))
+	if header == nil {
+		return common.Hash{}, errUnknownBlock
+	}
+	return shuffleSeed(header.Hash(), epoch), nil
+}
+
+// GetShuffleProof returns the committee assignment of a validator in the given
+// epoch, along with a proof that can be checked without reshuffling the set
+func (api *API) GetShuffleProof(validator common.Address, epoch uint64) (*ShuffleProof, error) {
+	seed, err := api.epochSeed(epoch)
+	if err != nil {
+		return nil, err
 	}
+	return api.equa.ProveShuffle(validator, epoch, seed)
+}
+
+// VerifyShuffleProof checks a committee assignment against the local chain and
+// validator set
+func (api *API) VerifyShuffleProof(proof ShuffleProof) error {
+	seed, err := api.epochSeed(proof.Epoch)
+	if err != nil {
+		return err
+	}
+	if proof.Seed != seed {
+		return errInvalidShuffleSeed
+	}
+	addrs := api.equa.stakeManager.sortedValidators()
+	if proof.Count != uint64(len(addrs)) || proof.Index >= proof.Count || addrs[proof.Index] != proof.Validator {
+		return errNotInValidatorSet
+	}
+	return VerifyShuffleProof(&proof, api.equa.config.Committees)
+}
+
+// GetFeatures returns the optional engine features and whether they are enabled
+func (api *API) GetFeatures() []FeatureStatus {
+	return api.equa.Features()
+}
 
-	// This should be restricted to authorized calls only
-	return common.Bytes2Hex(validator.KeyShare)
-}
\ No newline at end of file
+// ChainHead is the view of the chain external builders target their payloads at.
+type ChainHead struct {
+	Head         common.Hash    `json:"head"`
+	HeadNumber   uint64         `json:"headNumber"`
+	Safe         *common.Hash   `json:"safe"`         // Nil if no safe block is known
+	Finalized    *common.Hash   `json:"finalized"`    // Nil if no finalized block is known
+	Proposer     common.Address `json:"proposer"`     // Expected proposer of the next block
+	NextSlot     uint64         `json:"nextSlot"`     // Number of the next block
+	NextSlotTime uint64         `json:"nextSlotTime"` // Earliest timestamp of the next block
+	SlotDuration uint64         `json:"slotDuration"` // Seconds between blocks
+}
+
+// GetValidatorSet returns the validator set committed to by an epoch boundary
+// block, which the proposers of the epoch it ends were drawn from
+func (api *API) GetValidatorSet(number uint64) (*ValidatorSet, error) {
+	return api.equa.validatorSet(api.chain, number)
+}
+
+// GetProposerSchedule returns the proposer of every block of an epoch, by
+// default the one of the next block. Schedules of past epochs are only
+// available while still cached or while the state of their boundary block is
+// kept
+func (api *API) GetProposerSchedule(epoch *uint64) (*ProposerSchedule, error) {
+	head := api.chain.CurrentHeader()
+	current := scheduleEpoch(head.Number.Uint64()+1, api.equa.config.Epoch)
+	if epoch == nil {
+		epoch = &current
+	}
+	if *epoch > current {
+		return nil, fmt.Errorf("%w: epoch %d boundary", errUnknownBlock, *epoch)
+	}
+	boundary := api.chain.GetHeaderByNumber(*epoch * api.equa.config.Epoch)
+	if boundary == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownBlock, *epoch*api.equa.config.Epoch)
+	}
+	schedule, err := api.equa.proposerSchedule(api.chain, *epoch, boundary.Hash(), boundary.Root)
+	if errors.Is(err, errStateUnavailable) {
+		return nil, errScheduleUnavailable
+	}
+	return schedule, err
+}
+
+// GetChainHead returns the canonical, safe and finalized heads along with the
+// expected proposer and timing of the next block
+func (api *API) GetChainHead() (*ChainHead, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	number := head.Number.Uint64() + 1
+	proposer, err := api.equa.selectProposer(api.chain, number, head)
+	if err != nil {
+		return nil, err
+	}
+	result := &ChainHead{
+		Head:         head.Hash(),
+		HeadNumber:   head.Number.Uint64(),
+		Proposer:     proposer,
+		NextSlot:     number,
+		NextSlotTime: head.Time + api.equa.config.Period,
+		SlotDuration: api.equa.config.Period,
+	}
+	// Safe and finalized blocks are only tracked by full chains
+	if chain, ok := api.chain.(interface {
+		CurrentSafeBlock() *types.Header
+		CurrentFinalBlock() *types.Header
+	}); ok {
+		if safe := chain.CurrentSafeBlock(); safe != nil {
+			hash := safe.Hash()
+			result.Safe = &hash
+		}
+		if final := chain.CurrentFinalBlock(); final != nil {
+			hash := final.Hash()
+			result.Finalized = &hash
+		}
+	}
+	return result, nil
+}
+
+// GetScoreBreakdown returns the findings behind the MEV and ordering scores of
+// a block
+func (api *API) GetScoreBreakdown(blockNumber uint64) (*ScoreBreakdown, error) {
+	block := api.getBlock(blockNumber)
+	if block == nil {
+		return nil, errUnknownBlock
+	}
+	return api.equa.ExplainScores(block, chainReceipts(api.chain, block.Hash())), nil
+}
+
+// Health summarises the state of the validator set.
+type Health struct {
+	Head          uint64               `json:"head"`
+	Validators    int                  `json:"validators"`
+	TotalStake    *big.Int             `json:"totalStake"`
+	Concentration *ConcentrationReport `json:"concentration"`
+}
+
+// GetHealth returns the state of the validator set, including the estimated
+// concentration of validators on shared infrastructure
+func (api *API) GetHealth() *Health {
+	validators := api.equa.stakeManager.GetValidators()
+	return &Health{
+		Head:          api.chain.CurrentHeader().Number.Uint64(),
+		Validators:    len(validators),
+		TotalStake:    api.equa.stakeManager.GetTotalStake(),
+		Concentration: api.equa.correlation.Report(validators),
+	}
+}
+
+// DeclareNodeIdentity publishes signed, self-reported metadata about the node a
+// validator runs on, used to estimate validator correlation
+func (api *API) DeclareNodeIdentity(id NodeIdentity) error {
+	return api.equa.stakeManager.DeclareIdentity(&id)
+}
+
+// SendBundle queues a bundle of transactions for contiguous inclusion at the
+// arrival position of its earliest member, returning the bundle hash
+func (api *API) SendBundle(args BundleArgs) (common.Hash, error) {
+	if !api.equa.config.FeatureEnabled(FeatureBundles) {
+		return common.Hash{}, errBundlesDisabled
+	}
+	return api.equa.bundles.Add(&args)
+}
+
+// SendEncryptedTransaction submits an envelope, a signed transaction whose data
+// is "ENCR" followed by a transaction encrypted under the threshold public key,
+// returning its hash. The encrypted transaction is revealed once the envelope
+// is committed in a block. Envelopes must pay at least the base fee of the next
+// block and carry at most 64KB of ciphertext
+func (api *API) SendEncryptedTransaction(input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	return api.equa.SendEncryptedTransaction(tx, nextBaseFee(api.chain.Config(), api.chain.CurrentHeader()))
+}
+
+// GetEncryptedTransaction returns the progress of an envelope through the
+// commit-reveal flow, along with the share holders that published their
+// decryption shares for it
+func (api *API) GetEncryptedTransaction(hash common.Hash) (*EncryptedTransaction, error) {
+	return api.equa.encrypted.Get(hash, api.chain.CurrentHeader().Number.Uint64())
+}
+
+// GetUnrevealedTransactions returns the recently committed envelopes whose
+// transaction was not included within the reveal window, censored if it was
+// decrypted and withheld if the share holders missing did not publish enough
+// decryption shares
+func (api *API) GetUnrevealedTransactions() []*EncryptedTransaction {
+	return api.equa.encrypted.Unrevealed(api.chain.CurrentHeader().Number.Uint64())
+}
+
+// ReportFalseStatement checks a block against its proposer's compliance
+// statement, recording slashing evidence if the block contradicts it
+func (api *API) ReportFalseStatement(blockNumber uint64) (*Evidence, error) {
+	block := api.getBlock(blockNumber)
+	if block == nil {
+		return nil, errUnknownBlock
+	}
+	if err := CheckStatement(block); err != errStatementContradicts {
+		if err == nil {
+			err = errStatementHolds
+		}
+		return nil, err
+	}
+	ev := &Evidence{
+		Validator: block.Coinbase(),
+		Block:     blockNumber,
+		Violation: violationFalseStatement,
+	}
+	if err := api.equa.submitEvidence(ev, api.chain.CurrentHeader().Number.Uint64()); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// GetSlashingProof returns the proof that a block contradicts its proposer's
+// compliance statement, to be sent to the slashing address in a transaction
+func (api *API) GetSlashingProof(blockNumber uint64) (hexutil.Bytes, error) {
+	block := api.getBlock(blockNumber)
+	if block == nil {
+		return nil, errUnknownBlock
+	}
+	proof := &SlashingProof{Header: block.Header(), Transactions: block.Transactions()}
+	if _, err := proof.verify(); err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(proof)
+}
+
+// GetDoubleProposalProof returns the proof of a double proposal detected at the
+// given height, to be sent to the slashing address in a transaction
+func (api *API) GetDoubleProposalProof(validator common.Address, blockNumber uint64) (hexutil.Bytes, error) {
+	proof, ok := api.equa.doubleProposalProof(validator, blockNumber)
+	if !ok {
+		return nil, errUnknownDoubleProposal
+	}
+	return proof.encode()
+}
+
+// RequestFunds sends test funds from the faucet to an address, limited to one
+// request per address and client within the configured period
+func (api *API) RequestFunds(ctx context.Context, address common.Address) (common.Hash, error) {
+	if api.equa.faucet == nil {
+		return common.Hash{}, errFaucetDisabled
+	}
+	return api.equa.faucet.Fund(faucetClient(ctx), address)
+}
+
+// GetOnboarding returns the staking status of an address, with a referral to
+// the staking helper of the network if it has no stake yet
+func (api *API) GetOnboarding(address common.Address) (*Onboarding, error) {
+	if api.equa.faucet == nil {
+		return nil, errFaucetDisabled
+	}
+	return api.equa.faucet.Onboarding(api.equa.stakeManager, address), nil
+}
+
+// GetVersionSignaling aggregates the version signals of the blocks of the
+// current epoch, reporting the share of blocks ready for each feature
+func (api *API) GetVersionSignaling() (*VersionReport, error) {
+	head := api.chain.CurrentHeader().Number.Uint64()
+	epoch := head / api.equa.config.Epoch
+
+	var headers []*types.Header
+	for n := epoch * api.equa.config.Epoch; n <= head; n++ {
+		header := api.chain.GetHeaderByNumber(n)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		headers = append(headers, header)
+	}
+	return aggregateVersionSignals(api.equa.config, epoch, headers), nil
+}
+
+// NewSlashingEvent streams the slashing events detected in new canonical blocks
+// and the slashing evidence reported from then on
+func (api *API) NewSlashingEvent(ctx context.Context) (*rpc.Subscription, error) {
+	return subscribe(ctx, api.equa.SubscribeSlashingEvents)
+}
+
+// MevDetected streams the MEV detected in new canonical blocks
+func (api *API) MevDetected(ctx context.Context) (*rpc.Subscription, error) {
+	return subscribe(ctx, api.equa.SubscribeMEVEvents)
+}
+
+// ValidatorStatusChanged streams the changes in the status of validators
+func (api *API) ValidatorStatusChanged(ctx context.Context) (*rpc.Subscription, error) {
+	return subscribe(ctx, api.equa.SubscribeValidatorStatus)
+}
+
+// OrderingViolation streams the ordering violations found in new canonical
+// blocks
+func (api *API) OrderingViolation(ctx context.Context) (*rpc.Subscription, error) {
+	return subscribe(ctx, api.equa.SubscribeOrderingViolations)
+}
+
+// subscribe creates an RPC subscription forwarding the events of an engine feed
+// until the client unsubscribes.
+func subscribe[T any](ctx context.Context, feed func(chan<- T) event.Subscription) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	var (
+		rpcSub = notifier.CreateSubscription()
+		events = make(chan T, 128)
+		sub    = feed(events)
+	)
+	go func() {
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				notifier.Notify(rpcSub.ID, ev)
+			case <-rpcSub.Err():
+				return
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
@@ -0,0 +1,343 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/trie"
+)
+
+// testBlockChain is an in-memory chain of blocks with their receipts.
+type testBlockChain struct {
+	testHeaderChain
+	blocks   map[common.Hash]*types.Block
+	receipts map[common.Hash]types.Receipts
+}
+
+func (c *testBlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return c.blocks[hash]
+}
+
+// GetHeaderByHash returns the header with the given hash, including those of the
+// blocks no longer in the chain of headers.
+func (c *testBlockChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	if block := c.blocks[hash]; block != nil {
+		return block.Header()
+	}
+	return c.testHeaderChain.GetHeaderByHash(hash)
+}
+
+func (c *testBlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
+	return c.receipts[hash]
+}
+
+// Tests that the MEV statistics and slashing events are derived from the blocks
+// and receipts of the chain, and that missing data is reported as an error.
+func TestAPIChainData(t *testing.T) {
+	var (
+		proposer = common.Address{0x01}
+		engine   = newTestEngine(t, 32, proposer)
+		key, _   = crypto.GenerateKey()
+		signer   = types.LatestSignerForChainID(big.NewInt(1))
+		chain    = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+			receipts:        make(map[common.Hash]types.Receipts),
+		}
+	)
+	// Block 1 is empty, block 2 includes transactions paying increasing gas
+	// prices, an ordering the slasher flags as reordering
+	for number := int64(0); number < 3; number++ {
+		var (
+			txs      []*types.Transaction
+			receipts types.Receipts
+		)
+		for i := int64(0); number == 2 && i < 3; i++ {
+			tx := types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: uint64(i), To: &common.Address{0x02}, Gas: 21000, GasPrice: big.NewInt((i + 1) * 1e9)})
+			txs = append(txs, tx)
+			receipts = append(receipts, &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash(), GasUsed: 21000})
+		}
+		header := &types.Header{Number: big.NewInt(number), Coinbase: proposer, Difficulty: common.Big1}
+		if number > 0 {
+			header.ParentHash = chain.headers[number-1].Hash()
+		}
+		block := types.NewBlock(header, &types.Body{Transactions: txs}, receipts, trie.NewStackTrie(nil))
+		chain.headers = append(chain.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+		chain.receipts[block.Hash()] = receipts
+	}
+	api := &API{chain: chain, equa: engine}
+
+	// Blocks whose receipts are missing cannot be analyzed
+	receipts := chain.receipts[chain.headers[2].Hash()]
+	delete(chain.receipts, chain.headers[2].Hash())
+	if _, err := api.GetMEVStats(10); !errors.Is(err, errReceiptsUnavailable) {
+		t.Errorf("missing receipts: error mismatch: have %v, want %v", err, errReceiptsUnavailable)
+	}
+	chain.receipts[chain.headers[2].Hash()] = receipts
+
+	// Chains without block bodies cannot be analyzed either
+	api.chain = &chain.testHeaderChain
+	if _, err := api.GetMEVStats(10); !errors.Is(err, errBlocksUnavailable) {
+		t.Errorf("header chain: error mismatch: have %v, want %v", err, errBlocksUnavailable)
+	}
+	api.chain = chain
+
+	stats, err := api.GetMEVStats(10)
+	if err != nil {
+		t.Fatalf("failed to get MEV stats: %v", err)
+	}
+	if r := stats["blockRange"].([]uint64); r[0] != 0 || r[1] != 2 {
+		t.Errorf("block range mismatch: have %v, want [0 2]", r)
+	}
+	if stats["totalMEV"] != "0" || stats["blocksWithMEV"] != 0 {
+		t.Errorf("MEV detected in plain transfers: %v", stats)
+	}
+	events, err := api.GetSlashingEvents(1)
+	if err != nil {
+		t.Fatalf("failed to get slashing events: %v", err)
+	}
+	if len(events) != 1 || events[0].Number != 2 || events[0].Validator != proposer || events[0].Violation != "Transaction reordering" {
+		t.Errorf("slashing events mismatch: have %+v", events)
+	}
+
+	// Once analyzed, blocks are answered from the burn ledger without their bodies
+	api.chain = &chain.testHeaderChain
+	if stats, err := api.GetMEVStats(10); err != nil || stats["totalMEV"] != "0" {
+		t.Errorf("indexed MEV stats mismatch: have %v (%v)", stats, err)
+	}
+	if _, err := api.GetSlashingEvents(10); !errors.Is(err, errBlocksUnavailable) {
+		t.Errorf("header chain: error mismatch: have %v, want %v", err, errBlocksUnavailable)
+	}
+	// Analyzed blocks are answered from the slashing history
+	if events, err := api.GetSlashingEvents(1); err != nil || len(events) != 1 {
+		t.Errorf("stored slashing events mismatch: have %+v (%v)", events, err)
+	}
+}
+
+// Tests that the slashing history keeps detected events and evidence across
+// restarts, and leaves out the events of blocks reorged out.
+func TestSlashingHistory(t *testing.T) {
+	var (
+		proposer = common.Address{0x01}
+		engine   = newTestEngine(t, 32, proposer)
+		chain    = &testHeaderChain{config: newTestChainConfig(engine.config)}
+		api      = &API{chain: chain, equa: engine}
+	)
+	for number := int64(0); number <= 10; number++ {
+		chain.headers = append(chain.headers, &types.Header{Number: big.NewInt(number), Coinbase: proposer})
+	}
+	detected := []*SlashingEvent{{Number: 4, Hash: chain.headers[4].Hash(), Validator: proposer, Violation: "Transaction reordering", Percentage: 10}}
+	if err := engine.slasher.storeBlockEvents(4, chain.headers[4].Hash(), detected); err != nil {
+		t.Fatalf("failed to store block events: %v", err)
+	}
+	if err := engine.slasher.SubmitEvidence(&Evidence{Validator: proposer, Block: 7, Violation: violationFalseStatement}, 10); err != nil {
+		t.Fatalf("failed to submit evidence: %v", err)
+	}
+	if err := engine.slasher.SubmitEvidence(&Evidence{Validator: common.Address{0x02}, Block: 7, Violation: violationFalseStatement}, 10); err != nil {
+		t.Fatalf("failed to submit evidence: %v", err)
+	}
+	// The history survives a restart and is filtered by validator and range
+	engine.slasher = NewSlasher(engine.slasher.db, engine.config, engine.slasher.signer)
+	history, err := api.GetSlashingHistory(proposer, 0, 10)
+	if err != nil {
+		t.Fatalf("failed to get slashing history: %v", err)
+	}
+	if len(history) != 2 || history[0].Number != 4 || history[0].Evidence || history[1].Number != 7 || !history[1].Evidence {
+		t.Fatalf("slashing history mismatch: have %+v", history)
+	}
+	if history, _ := api.GetSlashingHistory(proposer, 5, 10); len(history) != 1 || history[0].Number != 7 {
+		t.Errorf("ranged slashing history mismatch: have %+v", history)
+	}
+	if _, err := api.GetSlashingHistory(proposer, 10, 5); err == nil {
+		t.Errorf("inverted range accepted")
+	}
+	// Events of blocks reorged out are dropped, evidence is kept
+	chain.headers[4] = &types.Header{Number: big.NewInt(4), Coinbase: common.Address{0x03}}
+	if history, _ := api.GetSlashingHistory(proposer, 0, 10); len(history) != 1 || history[0].Number != 7 {
+		t.Errorf("reorged slashing history mismatch: have %+v", history)
+	}
+}
+
+// Tests that the burn ledger carries the running totals from block to block,
+// survives restarts, indexes blocks replacing others in a reorg afresh and
+// serves the MEV statistics.
+func TestBurnLedger(t *testing.T) {
+	var (
+		proposer  = common.Address{0x01}
+		engine    = newTestEngine(t, 32, proposer)
+		bot, _    = crypto.GenerateKey()
+		victim, _ = crypto.GenerateKey()
+		funded    = []common.Address{crypto.PubkeyToAddress(bot.PublicKey), crypto.PubkeyToAddress(victim.PublicKey)}
+		chain     = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+			receipts:        make(map[common.Hash]types.Receipts),
+		}
+		api = &API{chain: chain, equa: engine}
+	)
+	// Import a chain whose block 2 carries a sandwich, the only MEV burned
+	imported, _ := importTestChain(t, engine, funded, 5, func(i int, b *core.BlockGen) {
+		if i == 1 {
+			for _, tx := range sandwichTxs(chain.config, bot, victim) {
+				b.AddTx(tx)
+			}
+		}
+	})
+	for number := uint64(0); number <= 5; number++ {
+		block := imported.GetBlockByNumber(number)
+		chain.headers = append(chain.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+		chain.receipts[block.Hash()] = imported.GetReceiptsByHash(block.Hash())
+	}
+	extend := func(number int64, coinbase common.Address) {
+		header := &types.Header{Number: big.NewInt(number), Coinbase: coinbase, Difficulty: common.Big1}
+		if number > 0 {
+			header.ParentHash = chain.headers[number-1].Hash()
+		}
+		block := types.NewBlockWithHeader(header)
+		chain.headers = append(chain.headers[:number], block.Header())
+		chain.blocks[block.Hash()] = block
+	}
+	burned, reward := engine.splitMEV(testSandwichProfit)
+
+	engine.indexBurns(chain)
+	if head := readBurnHead(engine.db); head != 5 {
+		t.Errorf("burn ledger head mismatch: have %d, want 5", head)
+	}
+	history, err := api.GetBurnHistory(0, 5)
+	if err != nil {
+		t.Fatalf("failed to get burn history: %v", err)
+	}
+	for i, entry := range history {
+		want := new(big.Int)
+		if i >= 2 {
+			want = burned
+		}
+		if entry.Number != uint64(i) || entry.Hash != chain.headers[i].Hash() || entry.TotalBurned.Cmp(want) != 0 {
+			t.Errorf("entry %d mismatch: have %+v, want total burned %v", i, entry, want)
+		}
+	}
+	// MEV statistics are the differences of the totals at the ends of the range
+	for i, test := range []struct {
+		blocks        int
+		mev, burned   string
+		blocksWithMEV int
+	}{
+		{10, testSandwichProfit.String(), burned.String(), 1},
+		{4, testSandwichProfit.String(), burned.String(), 1},
+		{3, "0", "0", 0},
+	} {
+		stats, err := api.GetMEVStats(test.blocks)
+		if err != nil {
+			t.Fatalf("test %d: failed to get MEV stats: %v", i, err)
+		}
+		if stats["totalMEV"] != test.mev || stats["totalBurned"] != test.burned || stats["blocksWithMEV"] != test.blocksWithMEV {
+			t.Errorf("test %d: MEV stats mismatch: have %v", i, stats)
+		}
+	}
+	if _, err := api.GetBurnHistory(5, 4); err == nil {
+		t.Errorf("inverted range accepted")
+	}
+	if _, err := api.GetBurnHistory(0, maxScanBlocks); err == nil {
+		t.Errorf("oversized range accepted")
+	}
+	// Blocks replacing others in a reorg are indexed on top of their ancestors,
+	// even once block bodies are no longer available
+	extend(4, common.Address{0x02})
+	extend(5, common.Address{0x02})
+	total, err := api.GetTotalBurned()
+	if err != nil {
+		t.Fatalf("failed to get total burned: %v", err)
+	}
+	if total.Number != 5 || total.Hash != chain.headers[5].Hash() || total.Proposer != (common.Address{0x02}) || total.TotalBurned.Cmp(burned) != 0 || total.TotalProposerReward.Cmp(reward) != 0 {
+		t.Errorf("reorged total mismatch: have %+v", total)
+	}
+	api.chain = &chain.testHeaderChain
+	if total, err := api.GetTotalBurned(); err != nil || total.TotalBurned.Cmp(burned) != 0 {
+		t.Errorf("stored total mismatch: have %+v (%v)", total, err)
+	}
+	extend(6, proposer)
+	if _, err := api.GetTotalBurned(); !errors.Is(err, errBlocksUnavailable) {
+		t.Errorf("header chain: error mismatch: have %v, want %v", err, errBlocksUnavailable)
+	}
+}
+
+// Tests that blocks whose receipts are unavailable are marked in the burn ledger
+// instead of stalling its indexing, and that the MEV statistics report them
+// along with the block the ledger is indexed up to.
+func TestBurnLedgerUnavailable(t *testing.T) {
+	var (
+		proposer  = common.Address{0x01}
+		engine    = newTestEngine(t, 32, proposer)
+		bot, _    = crypto.GenerateKey()
+		victim, _ = crypto.GenerateKey()
+		sender, _ = crypto.GenerateKey()
+		funded    = []common.Address{crypto.PubkeyToAddress(bot.PublicKey), crypto.PubkeyToAddress(victim.PublicKey), crypto.PubkeyToAddress(sender.PublicKey)}
+		chain     = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+			receipts:        make(map[common.Hash]types.Receipts),
+		}
+		api = &API{chain: chain, equa: engine}
+	)
+	// Block 1 carries a transfer whose receipt goes missing, block 3 a sandwich
+	imported, _ := importTestChain(t, engine, funded, 4, func(i int, b *core.BlockGen) {
+		switch i {
+		case 0:
+			signer := types.LatestSigner(chain.config)
+			b.AddTx(types.MustSignNewTx(sender, signer, &types.LegacyTx{To: &common.Address{0x02}, Gas: 21000, GasPrice: big.NewInt(params.GWei)}))
+		case 2:
+			for _, tx := range sandwichTxs(chain.config, bot, victim) {
+				b.AddTx(tx)
+			}
+		}
+	})
+	for number := uint64(0); number <= 4; number++ {
+		block := imported.GetBlockByNumber(number)
+		chain.headers = append(chain.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+		if number != 1 {
+			chain.receipts[block.Hash()] = imported.GetReceiptsByHash(block.Hash())
+		}
+	}
+	engine.indexBurns(chain)
+	if head := readBurnHead(engine.db); head != 4 {
+		t.Fatalf("burn ledger stalled: head %d, want 4", head)
+	}
+	if entry := readBurnEntry(engine.db, 1, chain.headers[1].Hash()); entry == nil || !entry.Unavailable {
+		t.Fatalf("block without receipts not marked: %+v", entry)
+	}
+	stats, err := api.GetMEVStats(10)
+	if err != nil {
+		t.Fatalf("failed to get MEV stats: %v", err)
+	}
+	if stats["totalMEV"] != testSandwichProfit.String() || stats["blocksUnavailable"] != 1 || stats["indexedBlock"] != uint64(4) {
+		t.Errorf("MEV stats mismatch: have %v", stats)
+	}
+	if stats, err := api.GetMEVStats(2); err != nil || stats["blocksUnavailable"] != 0 {
+		t.Errorf("MEV stats of available blocks mismatch: have %v (%v)", stats, err)
+	}
+}
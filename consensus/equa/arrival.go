@@ -0,0 +1,357 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/common/lru"
+	"github.com/equa/go-equa/common/mclock"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/event"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+)
+
+const (
+	arrivalMaxReceipts  = 256 // Validator receipts kept per transaction
+	arrivalChanSize     = 256 // Buffered transaction events from the pool
+	arrivalFutureWindow = 15 * time.Second
+)
+
+var errInvalidTimestampSig = errors.New("invalid timestamp receipt signature")
+
+var (
+	arrivalEvictMeter  = metrics.NewRegisteredMeter("equa/arrivals/evict", nil)  // Arrivals dropped to make room for new ones
+	arrivalExpireMeter = metrics.NewRegisteredMeter("equa/arrivals/expire", nil) // Arrivals dropped for outliving the TTL
+)
+
+// TimestampReceipt is a validator's signed statement of when it first saw a
+// transaction. The median of the times reported by the validators is used as
+// the arrival time of the transaction, so that every node holding the same
+// receipts orders it the same way and no single validator can move it.
+type TimestampReceipt struct {
+	Validator common.Address `json:"validator"`
+	Hash      common.Hash    `json:"hash"`      // Hash of the transaction
+	Seen      uint64         `json:"seen"`      // First-seen time in milliseconds since the Unix epoch
+	Signature hexutil.Bytes  `json:"signature"` // Signature over timestampSigData by the validator
+}
+
+// timestampSigData returns the data signed by a validator for a receipt. The
+// signature is made over its Keccak256 hash.
+func timestampSigData(validator common.Address, hash common.Hash, seen uint64) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{validator, hash, seen})
+	return append([]byte("equa-timestamp-receipt"), enc...)
+}
+
+// Verify checks that the receipt was signed by the validator it names.
+func (r *TimestampReceipt) Verify() error {
+	if len(r.Signature) != crypto.SignatureLength {
+		return errInvalidTimestampSig
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(timestampSigData(r.Validator, r.Hash, r.Seen)), r.Signature)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != r.Validator {
+		return errInvalidTimestampSig
+	}
+	return nil
+}
+
+// arrival is what is known about when a transaction arrived.
+type arrival struct {
+	local    time.Time                            // First seen by this node, zero if only known from receipts
+	receipts map[common.Address]*TimestampReceipt // First receipt of every validator
+	added    mclock.AbsTime                       // When the entry was created, to expire it
+}
+
+// CacheStats reports the occupancy of a bounded cache and what it dropped.
+type CacheStats struct {
+	Entries     int    `json:"entries"`
+	Capacity    int    `json:"capacity"`
+	TTL         uint64 `json:"ttl"`         // Seconds an entry is kept at most
+	Evictions   uint64 `json:"evictions"`   // Entries dropped to make room for new ones
+	Expirations uint64 `json:"expirations"` // Entries dropped for outliving the TTL
+}
+
+// ArrivalRecorder keeps the first-seen times of transactions, both as seen by
+// this node and as reported by validators in timestamp receipts. The number of
+// transactions remembered is bounded, the least recently used ones making room
+// for new ones, and entries expire once older than the configured TTL, by which
+// time their transactions have long been included or dropped from the pool.
+type ArrivalRecorder struct {
+	arrivals lru.BasicLRU[common.Hash, *arrival]
+	capacity int
+	ttl      time.Duration
+	clock    mclock.Clock
+	eligible func(common.Address) bool // Reports whether receipts of a validator count
+	feed     event.Feed                // Newly accepted receipts, to be gossiped
+	lock     sync.Mutex
+
+	evictions   uint64
+	expirations uint64
+}
+
+// NewArrivalRecorder creates a recorder of the configured size and TTL, counting
+// the receipts of the validators the given function deems eligible.
+func NewArrivalRecorder(config *params.EquaConfig, eligible func(common.Address) bool) *ArrivalRecorder {
+	return &ArrivalRecorder{
+		arrivals: lru.NewBasicLRU[common.Hash, *arrival](int(config.ArrivalCacheSize)),
+		capacity: int(config.ArrivalCacheSize),
+		ttl:      time.Duration(config.ArrivalCacheTTL) * time.Second,
+		clock:    mclock.System{},
+		eligible: eligible,
+	}
+}
+
+// get returns the arrival of a transaction, dropping it if expired. Arrivals
+// being updated are marked as recently used and added if missing. The lock must
+// be held.
+func (ar *ArrivalRecorder) get(hash common.Hash, update bool) (*arrival, bool) {
+	var (
+		now   = ar.clock.Now()
+		a     *arrival
+		found bool
+	)
+	if update {
+		a, found = ar.arrivals.Get(hash)
+	} else {
+		a, found = ar.arrivals.Peek(hash)
+	}
+	if found && ar.expired(a, now) {
+		ar.drop(hash)
+		found = false
+	}
+	if found || !update {
+		return a, found
+	}
+	// Make room by dropping the expired arrivals before evicting live ones
+	for {
+		oldest, a, ok := ar.arrivals.GetOldest()
+		if !ok || !ar.expired(a, now) {
+			break
+		}
+		ar.drop(oldest)
+	}
+	a = &arrival{receipts: make(map[common.Address]*TimestampReceipt), added: now}
+	if ar.arrivals.Add(hash, a) {
+		ar.evictions++
+		arrivalEvictMeter.Mark(1)
+	}
+	return a, true
+}
+
+// expired reports whether an arrival outlived the TTL.
+func (ar *ArrivalRecorder) expired(a *arrival, now mclock.AbsTime) bool {
+	return ar.ttl > 0 && now.Sub(a.added) > ar.ttl
+}
+
+// drop removes an expired arrival. The lock must be held.
+func (ar *ArrivalRecorder) drop(hash common.Hash) {
+	ar.arrivals.Remove(hash)
+	ar.expirations++
+	arrivalExpireMeter.Mark(1)
+}
+
+// Stats reports the occupancy of the recorder and the arrivals it dropped.
+func (ar *ArrivalRecorder) Stats() *CacheStats {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+
+	return &CacheStats{
+		Entries:     ar.arrivals.Len(),
+		Capacity:    ar.capacity,
+		TTL:         uint64(ar.ttl / time.Second),
+		Evictions:   ar.evictions,
+		Expirations: ar.expirations,
+	}
+}
+
+// Record notes the local arrival of transactions, returning the hashes of the
+// ones not seen before.
+func (ar *ArrivalRecorder) Record(hashes []common.Hash, now time.Time) []common.Hash {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+
+	var fresh []common.Hash
+	for _, hash := range hashes {
+		a, _ := ar.get(hash, true)
+		if a.local.IsZero() {
+			a.local = now
+			fresh = append(fresh, hash)
+		}
+	}
+	return fresh
+}
+
+// Add stores the receipts of eligible validators, returning the ones that were
+// not known before. Only the first receipt of a validator for a transaction is
+// kept, later ones cannot move its arrival time.
+func (ar *ArrivalRecorder) Add(receipts []*TimestampReceipt) []*TimestampReceipt {
+	limit := uint64(time.Now().Add(arrivalFutureWindow).UnixMilli())
+
+	valid := make([]*TimestampReceipt, 0, len(receipts))
+	for _, r := range receipts {
+		if r.Seen > limit || !ar.eligible(r.Validator) || r.Verify() != nil {
+			continue
+		}
+		valid = append(valid, r)
+	}
+	ar.lock.Lock()
+	var added []*TimestampReceipt
+	for _, r := range valid {
+		a, _ := ar.get(r.Hash, true)
+		if _, known := a.receipts[r.Validator]; known || len(a.receipts) >= arrivalMaxReceipts {
+			continue
+		}
+		a.receipts[r.Validator] = r
+		added = append(added, r)
+	}
+	ar.lock.Unlock()
+
+	if len(added) > 0 {
+		ar.feed.Send(added)
+	}
+	return added
+}
+
+// Timestamp returns the arrival time of a transaction: the median of the times
+// reported by eligible validators or, without any receipts, the time it was
+// first seen locally.
+func (ar *ArrivalRecorder) Timestamp(hash common.Hash) (time.Time, bool) {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+
+	a, ok := ar.get(hash, false)
+	if !ok {
+		return time.Time{}, false
+	}
+	seen := make([]uint64, 0, len(a.receipts))
+	for validator, r := range a.receipts {
+		if ar.eligible(validator) {
+			seen = append(seen, r.Seen)
+		}
+	}
+	if len(seen) == 0 {
+		return a.local, !a.local.IsZero()
+	}
+	// Take the lower median, so that with an even number of receipts the
+	// result is still a time reported by a validator
+	slices.Sort(seen)
+	return time.UnixMilli(int64(seen[(len(seen)-1)/2])), true
+}
+
+// Receipts returns the receipts known for a transaction, ordered by validator.
+func (ar *ArrivalRecorder) Receipts(hash common.Hash) []*TimestampReceipt {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+
+	a, ok := ar.get(hash, false)
+	if !ok {
+		return nil
+	}
+	receipts := make([]*TimestampReceipt, 0, len(a.receipts))
+	for _, r := range a.receipts {
+		receipts = append(receipts, r)
+	}
+	slices.SortFunc(receipts, func(a, b *TimestampReceipt) int {
+		return a.Validator.Cmp(b.Validator)
+	})
+	return receipts
+}
+
+// Subscribe subscribes to newly accepted receipts.
+func (ar *ArrivalRecorder) Subscribe(ch chan<- []*TimestampReceipt) event.Subscription {
+	return ar.feed.Subscribe(ch)
+}
+
+// txPoolSubscriber is the part of the transaction pool announcing new
+// transactions.
+type txPoolSubscriber interface {
+	SubscribeTransactions(ch chan<- core.NewTxsEvent, reorgs bool) event.Subscription
+}
+
+// StartArrivalTracking records when transactions enter the pool, signing
+// timestamp receipts for them while the engine is authorized as a validator,
+// until the engine is closed.
+func (e *Equa) StartArrivalTracking(pool txPoolSubscriber) {
+	ch := make(chan core.NewTxsEvent, arrivalChanSize)
+	sub := pool.SubscribeTransactions(ch, false)
+
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-ch:
+				e.recordArrivals(ev.Txs, time.Now())
+			case <-sub.Err():
+				return
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// recordArrivals notes the local arrival of transactions and, if this node is
+// an eligible validator, attests to it with timestamp receipts.
+func (e *Equa) recordArrivals(txs []*types.Transaction, now time.Time) {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	fresh := e.arrivals.Record(hashes, now)
+
+	e.lock.RLock()
+	signer, signFn := e.signer, e.signFn
+	e.lock.RUnlock()
+
+	if signFn == nil || len(fresh) == 0 || !e.stakeManager.IsEligible(signer) {
+		return
+	}
+	seen := uint64(now.UnixMilli())
+	receipts := make([]*TimestampReceipt, 0, len(fresh))
+	for _, hash := range fresh {
+		sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeEquaTimestamp, timestampSigData(signer, hash, seen))
+		if err != nil {
+			log.Debug("Failed to sign timestamp receipt", "err", err)
+			break
+		}
+		receipts = append(receipts, &TimestampReceipt{Validator: signer, Hash: hash, Seen: seen, Signature: sig})
+	}
+	e.arrivals.Add(receipts)
+}
+
+// AddTimestampReceipts imports timestamp receipts gossiped by peers, returning
+// the ones not known before.
+func (e *Equa) AddTimestampReceipts(receipts []*TimestampReceipt) []*TimestampReceipt {
+	return e.arrivals.Add(receipts)
+}
+
+// SubscribeTimestampReceipts subscribes to newly accepted timestamp receipts,
+// both signed locally and received from peers, to gossip them further.
+func (e *Equa) SubscribeTimestampReceipts(ch chan<- []*TimestampReceipt) event.Subscription {
+	return e.arrivals.Subscribe(ch)
+}
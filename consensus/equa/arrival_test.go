@@ -0,0 +1,153 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/mclock"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// recordTestArrivals records the local arrival of transactions a second apart,
+// in the order given.
+func recordTestArrivals(ar *ArrivalRecorder, txs []*types.Transaction) {
+	base := time.Now().Add(-time.Hour)
+	for i, tx := range txs {
+		ar.Record([]common.Hash{tx.Hash()}, base.Add(time.Duration(i)*time.Second))
+	}
+}
+
+// signTestReceipt creates a timestamp receipt signed with the given key.
+func signTestReceipt(t *testing.T, key *ecdsa.PrivateKey, hash common.Hash, seen time.Time) *TimestampReceipt {
+	t.Helper()
+
+	r := &TimestampReceipt{Validator: crypto.PubkeyToAddress(key.PublicKey), Hash: hash, Seen: uint64(seen.UnixMilli())}
+	sig, err := crypto.Sign(crypto.Keccak256(timestampSigData(r.Validator, r.Hash, r.Seen)), key)
+	if err != nil {
+		t.Fatalf("failed to sign receipt: %v", err)
+	}
+	r.Signature = sig
+	return r
+}
+
+// Tests that the arrival time of a transaction is the median of the times
+// attested by validators, falling back to the local first-seen time, and that
+// receipts cannot be forged or replaced.
+func TestArrivalRecorder(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	addrs := make([]common.Address, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	engine := newTestEngine(t, 32, addrs[:3]...)
+	ar := engine.arrivals
+
+	var (
+		base  = time.UnixMilli(time.Now().Add(-time.Minute).UnixMilli())
+		first = common.Hash{0x01}
+		other = common.Hash{0x02}
+	)
+	if _, ok := ar.Timestamp(first); ok {
+		t.Fatalf("timestamp of unseen transaction")
+	}
+	ar.Record([]common.Hash{first}, base.Add(10*time.Second))
+	if ts, ok := ar.Timestamp(first); !ok || !ts.Equal(base.Add(10*time.Second)) {
+		t.Fatalf("local timestamp mismatch: have %v", ts)
+	}
+	// Validator receipts take precedence, the outlier does not move the median
+	receipts := []*TimestampReceipt{
+		signTestReceipt(t, keys[0], first, base.Add(2*time.Second)),
+		signTestReceipt(t, keys[1], first, base.Add(3*time.Second)),
+		signTestReceipt(t, keys[2], first, base.Add(-time.Hour)),
+		signTestReceipt(t, keys[3], first, base), // Not a validator
+	}
+	forged := signTestReceipt(t, keys[0], other, base)
+	forged.Seen++
+	receipts = append(receipts, forged)
+
+	if added := ar.Add(receipts); len(added) != 3 {
+		t.Fatalf("accepted receipts mismatch: have %d, want 3", len(added))
+	}
+	if ts, _ := ar.Timestamp(first); !ts.Equal(base.Add(2 * time.Second)) {
+		t.Fatalf("median timestamp mismatch: have %v, want %v", ts, base.Add(2*time.Second))
+	}
+	if added := ar.Add([]*TimestampReceipt{signTestReceipt(t, keys[1], first, base.Add(-time.Hour))}); len(added) != 0 {
+		t.Fatalf("replacement receipt accepted")
+	}
+	if _, ok := ar.Timestamp(other); ok {
+		t.Fatalf("forged receipt accepted")
+	}
+	// Locally recorded arrivals are attested once the engine is authorized
+	engine.Authorize(addrs[0], func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), keys[0])
+	})
+	ch := make(chan []*TimestampReceipt, 1)
+	sub := engine.SubscribeTimestampReceipts(ch)
+	defer sub.Unsubscribe()
+
+	tx := newTestTransactions(t, 1)[0]
+	engine.recordArrivals([]*types.Transaction{tx}, base)
+	select {
+	case receipts := <-ch:
+		if len(receipts) != 1 || receipts[0].Validator != addrs[0] || receipts[0].Hash != tx.Hash() {
+			t.Fatalf("unexpected local receipts: %v", receipts)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no receipt announced for local arrival")
+	}
+}
+
+// Tests that the recorder keeps at most the configured number of arrivals,
+// evicting the least recently used ones, and drops arrivals outliving the TTL.
+func TestArrivalRecorderBounds(t *testing.T) {
+	var (
+		clock = new(mclock.Simulated)
+		ar    = NewArrivalRecorder(&params.EquaConfig{ArrivalCacheSize: 2, ArrivalCacheTTL: 60}, func(common.Address) bool { return true })
+		now   = time.Now()
+	)
+	ar.clock = clock
+
+	ar.Record([]common.Hash{{0x01}, {0x02}}, now)
+	clock.Run(30 * time.Second)
+	ar.Record([]common.Hash{{0x01}, {0x03}}, now) // Touches 0x01, evicting 0x02
+	if _, ok := ar.Timestamp(common.Hash{0x02}); ok {
+		t.Errorf("least recently used arrival not evicted")
+	}
+	if _, ok := ar.Timestamp(common.Hash{0x01}); !ok {
+		t.Errorf("recently used arrival evicted")
+	}
+	// Arrivals expire by age, however recently used
+	clock.Run(31 * time.Second)
+	if _, ok := ar.Timestamp(common.Hash{0x01}); ok {
+		t.Errorf("expired arrival still known")
+	}
+	if _, ok := ar.Timestamp(common.Hash{0x03}); !ok {
+		t.Errorf("live arrival expired")
+	}
+	want := &CacheStats{Entries: 1, Capacity: 2, TTL: 60, Evictions: 1, Expirations: 1}
+	if stats := ar.Stats(); *stats != *want {
+		t.Errorf("stats mismatch: have %+v, want %+v", stats, want)
+	}
+}
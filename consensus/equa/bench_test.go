@@ -0,0 +1,189 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// newBenchEngine creates an engine with the given number of validators holding
+// distinct stakes.
+func newBenchEngine(tb testing.TB, validators int) *Equa {
+	config := &params.EquaConfig{PoWDifficulty: 1000}
+	for i := 0; i < validators; i++ {
+		var addr common.Address
+		binary.BigEndian.PutUint64(addr[12:], uint64(i+1))
+
+		config.InitialValidators = append(config.InitialValidators, params.EquaInitialValidator{
+			Address: addr,
+			Stake:   new(big.Int).Mul(big.NewInt(int64(32+i%64)), big.NewInt(1e18)),
+		})
+	}
+	return New(newTestChainConfig(config), nil)
+}
+
+// newBenchTransactions creates n unsigned transactions with distinct hashes and
+// gas prices.
+func newBenchTransactions(n int) ([]*types.Transaction, []*types.Receipt) {
+	txs := make([]*types.Transaction, n)
+	receipts := make([]*types.Receipt, n)
+	for i := range txs {
+		to := common.Address{byte(i % 16)}
+		txs[i] = types.NewTransaction(uint64(i), to, big.NewInt(1), 21000, big.NewInt(int64(1e9+i%100)), nil)
+		receipts[i] = &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 21000, TxHash: txs[i].Hash()}
+	}
+	return txs, receipts
+}
+
+func BenchmarkOrderTransactions(b *testing.B) {
+	orderer := NewFairOrderer(&params.EquaConfig{})
+	txs, _ := newBenchTransactions(1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		orderer.OrderTransactions(txs, nil, common.Hash{})
+	}
+}
+
+func BenchmarkDetectMEV(b *testing.B) {
+	detector := NewMEVDetector(&params.EquaConfig{}, types.LatestSigner(params.MergedTestChainConfig))
+	txs, receipts := newBenchTransactions(1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		detector.DetectMEV(txs, receipts, nil)
+	}
+}
+
+// BenchmarkDetectMEVSwaps measures the analysis of blocks of swaps on the same
+// router, every layer of which needs a closer look.
+func BenchmarkDetectMEVSwaps(b *testing.B) {
+	detector := NewMEVDetector(&params.EquaConfig{}, types.LatestSigner(params.MergedTestChainConfig))
+	txs, receipts := newBenchTransactions(1000)
+	router := common.Address{0xaa}
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), router, big.NewInt(int64(i%3)), 100000, big.NewInt(int64(1e9+i%100)), []byte{0x38, 0xed, 0x17, 0x39})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		detector.DetectMEV(txs, receipts, nil)
+	}
+}
+
+func BenchmarkSelectProposer(b *testing.B) {
+	engine := newBenchEngine(b, 10000)
+	chain := &testHeaderChain{config: newTestChainConfig(engine.config), headers: []*types.Header{{Number: big.NewInt(0)}}}
+	parent := &types.Header{ParentHash: chain.headers[0].Hash(), Number: big.NewInt(1)}
+	chain.headers = append(chain.headers, parent)
+
+	// The schedule is drawn once per epoch, see BenchmarkProposerSchedule
+	if _, err := engine.selectProposer(chain, 2, parent); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.selectProposer(chain, 2, parent); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProposerSchedule(b *testing.B) {
+	var (
+		engine     = newBenchEngine(b, 10000)
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		proposers  = newValidatorRegistry(statedb, engine.config).proposers()
+	)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := drawSchedule(uint64(i), common.Hash{}, engine.config.Epoch, proposers); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSolve(b *testing.B) {
+	pow := NewLightPoW(&params.EquaConfig{PoWDifficulty: 1000, Epoch: 100})
+	header := &types.Header{Number: big.NewInt(1), MixDigest: common.Hash{0x01}}
+	stop := make(chan struct{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		header.Coinbase = common.BytesToAddress(binary.BigEndian.AppendUint64(nil, uint64(i)))
+		if _, _, err := pow.Solve(header, stop); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSolveBatched(b *testing.B) {
+	pow := NewLightPoW(&params.EquaConfig{PoWDifficulty: 1000, Epoch: 100})
+	if err := pow.SetSolver(PoWSolverBatched, 0); err != nil {
+		b.Fatal(err)
+	}
+	header := &types.Header{Number: big.NewInt(1), MixDigest: common.Hash{0x01}}
+	stop := make(chan struct{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		header.Coinbase = common.BytesToAddress(binary.BigEndian.AppendUint64(nil, uint64(i)))
+		if _, _, err := pow.Solve(header, stop); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// performanceBudgets are the upper bounds on the time taken by the consensus
+// hot paths on block production. They are deliberately loose so that they only
+// trip on algorithmic regressions, not on slow machines.
+var performanceBudgets = []struct {
+	name   string
+	bench  func(b *testing.B)
+	budget time.Duration
+}{
+	{"OrderTransactions/1000", BenchmarkOrderTransactions, 10 * time.Millisecond},
+	{"DetectMEV/1000", BenchmarkDetectMEV, 10 * time.Millisecond},
+	{"SelectProposer/10000", BenchmarkSelectProposer, 5 * time.Millisecond},
+	{"ProposerSchedule/10000", BenchmarkProposerSchedule, 500 * time.Millisecond},
+	{"Solve/1000", BenchmarkSolve, 10 * time.Millisecond},
+	{"SolveBatched/1000", BenchmarkSolveBatched, 10 * time.Millisecond},
+}
+
+// Tests that the consensus hot paths stay within their performance budgets.
+func TestPerformanceBudgets(t *testing.T) {
+	if testing.Short() || raceEnabled {
+		t.Skip("skipping performance budgets in short mode or with the race detector")
+	}
+	for _, budget := range performanceBudgets {
+		result := testing.Benchmark(budget.bench)
+		if result.N == 0 {
+			t.Errorf("%s: benchmark failed", budget.name)
+			continue
+		}
+		if took := time.Duration(result.NsPerOp()); took > budget.budget {
+			t.Errorf("%s: took %v per op, budget %v", budget.name, took, budget.budget)
+		}
+	}
+}
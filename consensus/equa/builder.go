@@ -0,0 +1,302 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+	"github.com/equa/go-equa/trie"
+)
+
+const (
+	maxBidParents = 16   // Number of parent blocks for which accepted bids are retained
+	maxBidAudits  = 1024 // Number of bid evaluations retained for auditing
+	maxBuilders   = 256  // Number of registered builders
+)
+
+var (
+	errEmptyBid               = errors.New("bid contains no transactions")
+	errUnknownBuilder         = errors.New("builder not registered")
+	errTooManyBuilders        = errors.New("too many registered builders")
+	errStaleRegistration      = errors.New("builder registration not newer than the current one")
+	errInvalidBuilderSig      = errors.New("invalid builder signature")
+	errMissingBuilderEndpoint = errors.New("builder registration without endpoint")
+)
+
+// BuilderRegistration announces an external builder, signed with the account
+// its bids are signed with. A builder registers again, with a later timestamp,
+// to change its endpoint.
+type BuilderRegistration struct {
+	Builder   common.Address `json:"builder"`
+	Endpoint  string         `json:"endpoint"`  // Where the builder can be reached, for operators to follow up on its bids
+	Timestamp uint64         `json:"timestamp"` // Unix time of the registration
+	Signature hexutil.Bytes  `json:"signature"` // Signature over builderRegistrationSigData by the builder
+}
+
+// builderRegistrationSigData returns the data signed by a builder to register.
+// The signature is made over its Keccak256 hash.
+func builderRegistrationSigData(builder common.Address, endpoint string, timestamp uint64) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{builder, endpoint, timestamp})
+	return append([]byte("equa-builder-registration"), enc...)
+}
+
+// Verify checks that the registration was signed by the builder it names.
+func (r *BuilderRegistration) Verify() error {
+	return verifyBuilderSig(r.Builder, builderRegistrationSigData(r.Builder, r.Endpoint, r.Timestamp), r.Signature)
+}
+
+// BuilderBid is a block payload offered by an external builder for building on
+// top of a given parent block. The builder signs its commitment to the order of
+// the transactions, attesting that they are included in arrival order.
+type BuilderBid struct {
+	Builder      common.Address  `json:"builder"`
+	ParentHash   common.Hash     `json:"parentHash"`
+	Transactions []hexutil.Bytes `json:"transactions"`
+	Value        *hexutil.Big    `json:"value"`
+	Signature    hexutil.Bytes   `json:"signature"` // Signature over builderBidSigData by the builder
+}
+
+// builderBidSigData returns the data signed by a builder for a bid, committing
+// to the transactions in their order by the root of their trie, the TxHash of
+// the block they would be included in. The signature is made over its
+// Keccak256 hash.
+func builderBidSigData(builder common.Address, parent common.Hash, value *big.Int, txRoot common.Hash) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{builder, parent, value, txRoot})
+	return append([]byte("equa-builder-bid"), enc...)
+}
+
+// verifyBuilderSig checks that data was signed by the given builder.
+func verifyBuilderSig(builder common.Address, data []byte, sig []byte) error {
+	if len(sig) != crypto.SignatureLength {
+		return errInvalidBuilderSig
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(data), sig)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != builder {
+		return errInvalidBuilderSig
+	}
+	return nil
+}
+
+// BidAudit records the outcome of evaluating a builder bid.
+type BidAudit struct {
+	Builder       common.Address `json:"builder"`
+	ParentHash    common.Hash    `json:"parentHash"`
+	Commitment    common.Hash    `json:"commitment"` // Root of the transactions the builder committed to
+	Value         *hexutil.Big   `json:"value"`
+	TxCount       int            `json:"txCount"`
+	OrderingScore float64        `json:"orderingScore"`
+	MEV           *hexutil.Big   `json:"mev"`
+	Accepted      bool           `json:"accepted"`
+	Reason        string         `json:"reason,omitempty"`
+	Time          uint64         `json:"time"`
+}
+
+// acceptedBid is a bid that passed the EQUA fairness checks.
+type acceptedBid struct {
+	value *big.Int
+	txs   []*types.Transaction
+}
+
+// BuilderMarket accepts payloads from registered external builders, admitting
+// only those that pass the MEV and fair ordering checks of the engine. If no
+// compliant bid exists for a parent block, the proposer builds the block
+// locally.
+type BuilderMarket struct {
+	config      *params.EquaConfig
+	fairOrderer *FairOrderer
+	mevDetector *MEVDetector
+
+	builders map[common.Address]*BuilderRegistration // Registered builders
+	best     map[common.Hash]*acceptedBid            // Most valuable accepted bid per parent block
+	parents  []common.Hash                           // Parents with accepted bids, oldest first
+	audit    []*BidAudit                             // Recent bid evaluations, oldest first
+	lock     sync.Mutex
+}
+
+// NewBuilderMarket creates a new builder market using the given fairness checks.
+func NewBuilderMarket(config *params.EquaConfig, fairOrderer *FairOrderer, mevDetector *MEVDetector) *BuilderMarket {
+	return &BuilderMarket{
+		config:      config,
+		fairOrderer: fairOrderer,
+		mevDetector: mevDetector,
+		builders:    make(map[common.Address]*BuilderRegistration),
+		best:        make(map[common.Hash]*acceptedBid),
+	}
+}
+
+// Register admits a builder to submit bids, or updates its registration.
+func (bm *BuilderMarket) Register(reg *BuilderRegistration) error {
+	if reg.Endpoint == "" {
+		return errMissingBuilderEndpoint
+	}
+	if err := reg.Verify(); err != nil {
+		return err
+	}
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	current, ok := bm.builders[reg.Builder]
+	switch {
+	case ok && current.Timestamp >= reg.Timestamp:
+		return errStaleRegistration
+	case !ok && len(bm.builders) >= maxBuilders:
+		return errTooManyBuilders
+	}
+	bm.builders[reg.Builder] = reg
+	log.Info("Registered builder", "builder", reg.Builder, "endpoint", reg.Endpoint)
+	return nil
+}
+
+// Builders returns the registered builders, ordered by address.
+func (bm *BuilderMarket) Builders() []*BuilderRegistration {
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	builders := make([]*BuilderRegistration, 0, len(bm.builders))
+	for _, reg := range bm.builders {
+		builders = append(builders, reg)
+	}
+	slices.SortFunc(builders, func(a, b *BuilderRegistration) int {
+		return a.Builder.Cmp(b.Builder)
+	})
+	return builders
+}
+
+// SubmitBid evaluates a builder bid and records the outcome in the audit log.
+// An error is only returned if the bid is malformed or not signed by a
+// registered builder, rejections for fairness reasons are reported through the
+// audit record. The transactions are priced for the base fee of the block
+// built, nil if unknown.
+func (bm *BuilderMarket) SubmitBid(bid *BuilderBid, baseFee *big.Int) (*BidAudit, error) {
+	if len(bid.Transactions) == 0 {
+		return nil, errEmptyBid
+	}
+	txs, err := decodeTransactions(bid.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	value := new(big.Int)
+	if bid.Value != nil {
+		value = bid.Value.ToInt()
+	}
+	bm.lock.Lock()
+	_, registered := bm.builders[bid.Builder]
+	bm.lock.Unlock()
+	if !registered {
+		return nil, errUnknownBuilder
+	}
+	commitment := types.DeriveSha(types.Transactions(txs), trie.NewStackTrie(nil))
+	if err := verifyBuilderSig(bid.Builder, builderBidSigData(bid.Builder, bid.ParentHash, value, commitment), bid.Signature); err != nil {
+		return nil, err
+	}
+	audit := &BidAudit{
+		Builder:       bid.Builder,
+		ParentHash:    bid.ParentHash,
+		Commitment:    commitment,
+		Value:         (*hexutil.Big)(value),
+		TxCount:       len(txs),
+		OrderingScore: bm.fairOrderer.GetOrderingScore(txs),
+		Time:          uint64(time.Now().Unix()),
+	}
+	// The bid is not executed, so only the MEV patterns recognizable from the
+	// transactions alone are detected, enough to reject bids that sandwich or
+	// frontrun users
+	mev := bm.mevDetector.detectPendingMEV(txs, baseFee)
+	audit.MEV = (*hexutil.Big)(mev)
+
+	switch {
+	case mev.Sign() > 0:
+		audit.Reason = "MEV detected"
+	case !bm.fairOrderer.ValidateOrdering(txs):
+		audit.Reason = "transactions not in arrival order"
+	case audit.OrderingScore*100 < float64(bm.config.BuilderMinOrderingScore):
+		audit.Reason = fmt.Sprintf("ordering score %.2f below minimum %d%%", audit.OrderingScore, bm.config.BuilderMinOrderingScore)
+	default:
+		audit.Accepted = true
+	}
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	bm.audit = append(bm.audit, audit)
+	if len(bm.audit) > maxBidAudits {
+		bm.audit = bm.audit[len(bm.audit)-maxBidAudits:]
+	}
+	if !audit.Accepted {
+		log.Debug("Rejected builder bid", "builder", bid.Builder, "parent", bid.ParentHash, "reason", audit.Reason)
+		return audit, nil
+	}
+	log.Info("Accepted builder bid", "builder", bid.Builder, "parent", bid.ParentHash, "value", value, "txs", len(txs))
+
+	if current, ok := bm.best[bid.ParentHash]; ok {
+		if current.value.Cmp(value) < 0 {
+			bm.best[bid.ParentHash] = &acceptedBid{value: value, txs: txs}
+		}
+		return audit, nil
+	}
+	bm.best[bid.ParentHash] = &acceptedBid{value: value, txs: txs}
+	bm.parents = append(bm.parents, bid.ParentHash)
+	if len(bm.parents) > maxBidParents {
+		delete(bm.best, bm.parents[0])
+		bm.parents = bm.parents[1:]
+	}
+	return audit, nil
+}
+
+// decodeTransactions decodes transactions in their binary encoding.
+func decodeTransactions(encs []hexutil.Bytes) ([]*types.Transaction, error) {
+	txs := make([]*types.Transaction, len(encs))
+	for i, enc := range encs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(enc); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		txs[i] = tx
+	}
+	return txs, nil
+}
+
+// BestBid returns the transactions of the most valuable accepted bid building
+// on the given parent, or nil if the block should be built locally.
+func (bm *BuilderMarket) BestBid(parent common.Hash) []*types.Transaction {
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	if bid, ok := bm.best[parent]; ok {
+		return bid.txs
+	}
+	return nil
+}
+
+// Audit returns the most recent bid evaluations, oldest first.
+func (bm *BuilderMarket) Audit() []*BidAudit {
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	return append([]*BidAudit(nil), bm.audit...)
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/trie"
+)
+
+// newTestTransactions creates n signed plain transfers from a fresh account.
+func newTestTransactions(t *testing.T, n int) []*types.Transaction {
+	t.Helper()
+
+	key, _ := crypto.GenerateKey()
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		tx, err := types.SignTx(types.NewTransaction(uint64(i), common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1e9), nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		txs[i] = tx
+	}
+	return txs
+}
+
+// encodeBid creates a builder bid for the given transactions, signed by the
+// builder with the given key.
+func encodeBid(t *testing.T, key *ecdsa.PrivateKey, parent common.Hash, value int64, txs []*types.Transaction) *BuilderBid {
+	t.Helper()
+
+	bid := &BuilderBid{Builder: crypto.PubkeyToAddress(key.PublicKey), ParentHash: parent, Value: (*hexutil.Big)(big.NewInt(value))}
+	for _, tx := range txs {
+		enc, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to encode transaction: %v", err)
+		}
+		bid.Transactions = append(bid.Transactions, enc)
+	}
+	root := types.DeriveSha(types.Transactions(txs), trie.NewStackTrie(nil))
+	sig, err := crypto.Sign(crypto.Keccak256(builderBidSigData(bid.Builder, parent, big.NewInt(value), root)), key)
+	if err != nil {
+		t.Fatalf("failed to sign bid: %v", err)
+	}
+	bid.Signature = sig
+	return bid
+}
+
+// signRegistration creates a builder registration signed with the given key.
+func signRegistration(t *testing.T, key *ecdsa.PrivateKey, endpoint string, timestamp uint64) *BuilderRegistration {
+	t.Helper()
+
+	reg := &BuilderRegistration{Builder: crypto.PubkeyToAddress(key.PublicKey), Endpoint: endpoint, Timestamp: timestamp}
+	sig, err := crypto.Sign(crypto.Keccak256(builderRegistrationSigData(reg.Builder, endpoint, timestamp)), key)
+	if err != nil {
+		t.Fatalf("failed to sign registration: %v", err)
+	}
+	reg.Signature = sig
+	return reg
+}
+
+// Tests that builder bids are only accepted if they pass the fair ordering
+// checks, and that the most valuable compliant bid is selected.
+func TestBuilderMarket(t *testing.T) {
+	engine := newTestEngine(t, 32)
+	market := engine.builderMarket
+	parent := common.Hash{0x01}
+
+	key, _ := crypto.GenerateKey()
+	if err := market.Register(signRegistration(t, key, "https://builder.example", 1)); err != nil {
+		t.Fatalf("failed to register builder: %v", err)
+	}
+
+	txs := newTestTransactions(t, 4)
+	recordTestArrivals(engine.arrivals, txs)
+
+	ordered := engine.fairOrderer.OrderTransactions(txs, nil, common.Hash{})
+	reversed := make([]*types.Transaction, len(ordered))
+	for i, tx := range ordered {
+		reversed[len(ordered)-1-i] = tx
+	}
+	if _, err := market.SubmitBid(&BuilderBid{ParentHash: parent}, nil); !errors.Is(err, errEmptyBid) {
+		t.Fatalf("empty bid: have %v, want %v", err, errEmptyBid)
+	}
+	if _, err := market.SubmitBid(&BuilderBid{ParentHash: parent, Transactions: []hexutil.Bytes{{0xde, 0xad}}}, nil); err == nil {
+		t.Fatalf("malformed bid accepted")
+	}
+	audit, err := market.SubmitBid(encodeBid(t, key, parent, 100, reversed), nil)
+	if err != nil {
+		t.Fatalf("failed to submit bid: %v", err)
+	}
+	if audit.Accepted {
+		t.Fatalf("reordered bid accepted")
+	}
+	if txs := engine.BestBid(parent); txs != nil {
+		t.Fatalf("rejected bid selected")
+	}
+	for _, value := range []int64{10, 30, 20} {
+		audit, err := market.SubmitBid(encodeBid(t, key, parent, value, ordered), nil)
+		if err != nil {
+			t.Fatalf("failed to submit bid: %v", err)
+		}
+		if !audit.Accepted {
+			t.Fatalf("fair bid rejected: %s", audit.Reason)
+		}
+	}
+	if txs := engine.BestBid(parent); len(txs) != len(ordered) {
+		t.Fatalf("accepted bid not selected")
+	}
+	if len(market.Audit()) != 4 {
+		t.Fatalf("audit log mismatch: have %d, want 4", len(market.Audit()))
+	}
+	if txs := engine.BestBid(common.Hash{0x02}); txs != nil {
+		t.Fatalf("bid selected for unknown parent")
+	}
+	// Switching the market off should stop payloads from being used
+	engine.config.Features = map[string]bool{FeatureBuilderMarket: false}
+	if txs := engine.BestBid(parent); txs != nil {
+		t.Fatalf("bid selected with builder market disabled")
+	}
+}
+
+// Tests that bids sandwiching a user are rejected, the MEV being detected from
+// the transactions of the bid without executing them.
+func TestBuilderBidSandwich(t *testing.T) {
+	engine := newTestEngine(t, 32)
+	market := engine.builderMarket
+	parent := common.Hash{0x01}
+
+	key, _ := crypto.GenerateKey()
+	if err := market.Register(signRegistration(t, key, "https://builder.example", 1)); err != nil {
+		t.Fatalf("failed to register builder: %v", err)
+	}
+	bot, _ := crypto.GenerateKey()
+	victim, _ := crypto.GenerateKey()
+	txs := sandwichTxs(newTestChainConfig(engine.config), bot, victim)
+	recordTestArrivals(engine.arrivals, txs)
+
+	audit, err := market.SubmitBid(encodeBid(t, key, parent, 100, txs), nil)
+	if err != nil {
+		t.Fatalf("failed to submit bid: %v", err)
+	}
+	if audit.Accepted || audit.Reason != "MEV detected" {
+		t.Fatalf("sandwich bid not rejected for MEV: accepted %v, reason %q", audit.Accepted, audit.Reason)
+	}
+	if audit.MEV.ToInt().Cmp(testSandwichProfit) != 0 {
+		t.Fatalf("MEV mismatch: have %v, want %v", audit.MEV, testSandwichProfit)
+	}
+	if txs := engine.BestBid(parent); txs != nil {
+		t.Fatalf("sandwich bid selected")
+	}
+}
+
+// Tests that only bids signed by registered builders are evaluated, and that
+// builders can only update their registration with a newer one.
+func TestBuilderRegistration(t *testing.T) {
+	var (
+		engine   = newTestEngine(t, 32)
+		market   = engine.builderMarket
+		parent   = common.Hash{0x01}
+		key, _   = crypto.GenerateKey()
+		tampered = signRegistration(t, key, "https://builder.example", 1)
+		txs      = newTestTransactions(t, 2)
+		builder  = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	recordTestArrivals(engine.arrivals, txs)
+	ordered := engine.fairOrderer.OrderTransactions(txs, nil, common.Hash{})
+
+	if _, err := market.SubmitBid(encodeBid(t, key, parent, 10, ordered), nil); !errors.Is(err, errUnknownBuilder) {
+		t.Fatalf("unregistered builder: have %v, want %v", err, errUnknownBuilder)
+	}
+	tampered.Endpoint = "https://attacker.example"
+	if err := market.Register(tampered); !errors.Is(err, errInvalidBuilderSig) {
+		t.Fatalf("tampered registration: have %v, want %v", err, errInvalidBuilderSig)
+	}
+	if err := market.Register(signRegistration(t, key, "", 1)); !errors.Is(err, errMissingBuilderEndpoint) {
+		t.Fatalf("registration without endpoint: have %v, want %v", err, errMissingBuilderEndpoint)
+	}
+	if err := market.Register(signRegistration(t, key, "https://builder.example", 2)); err != nil {
+		t.Fatalf("failed to register builder: %v", err)
+	}
+	if err := market.Register(signRegistration(t, key, "https://old.example", 2)); !errors.Is(err, errStaleRegistration) {
+		t.Fatalf("stale registration: have %v, want %v", err, errStaleRegistration)
+	}
+	if err := market.Register(signRegistration(t, key, "https://new.example", 3)); err != nil {
+		t.Fatalf("failed to update registration: %v", err)
+	}
+	if builders := market.Builders(); len(builders) != 1 || builders[0].Builder != builder || builders[0].Endpoint != "https://new.example" {
+		t.Fatalf("registered builders mismatch: have %v", builders)
+	}
+	// Bids must be signed by the builder over the transactions in their order
+	bid := encodeBid(t, key, parent, 10, ordered)
+	bid.Transactions[0], bid.Transactions[1] = bid.Transactions[1], bid.Transactions[0]
+	if _, err := market.SubmitBid(bid, nil); !errors.Is(err, errInvalidBuilderSig) {
+		t.Fatalf("reordered commitment: have %v, want %v", err, errInvalidBuilderSig)
+	}
+	bid = encodeBid(t, key, parent, 10, ordered)
+	bid.Value = (*hexutil.Big)(big.NewInt(11))
+	if _, err := market.SubmitBid(bid, nil); !errors.Is(err, errInvalidBuilderSig) {
+		t.Fatalf("inflated value: have %v, want %v", err, errInvalidBuilderSig)
+	}
+	audit, err := market.SubmitBid(encodeBid(t, key, parent, 10, ordered), nil)
+	if err != nil {
+		t.Fatalf("failed to submit bid: %v", err)
+	}
+	if want := types.DeriveSha(types.Transactions(ordered), trie.NewStackTrie(nil)); audit.Commitment != want || !audit.Accepted {
+		t.Fatalf("audit mismatch: have commitment %x, accepted %v", audit.Commitment, audit.Accepted)
+	}
+}
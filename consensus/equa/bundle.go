@@ -0,0 +1,174 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+)
+
+const (
+	maxBundleSize  = 16              // Maximum number of transactions in a bundle
+	maxBundles     = 256             // Maximum number of pending bundles
+	bundleLifetime = 2 * time.Minute // Time after which an unincluded bundle is dropped
+)
+
+var (
+	errEmptyBundle       = errors.New("bundle contains no transactions")
+	errBundleTooLarge    = errors.New("bundle too large")
+	errBundleDuplicateTx = errors.New("bundle contains duplicate transaction")
+	errBundleBlobTx      = errors.New("blob transactions cannot be bundled")
+	errBundlePoolFull    = errors.New("bundle pool full")
+	errBundlesDisabled   = errors.New("bundles not enabled")
+)
+
+// BundleArgs is a bundle of transactions as submitted over the API.
+type BundleArgs struct {
+	Transactions []hexutil.Bytes `json:"transactions"`
+	Atomic       bool            `json:"atomic"` // Whether the bundle is included all-or-nothing
+}
+
+// Bundle is a sequence of transactions to be included contiguously and in order.
+// Unlike builder bids, bundles gain no ordering advantage: a bundle is placed at
+// the arrival position of its earliest member, as if it were a single
+// transaction.
+type Bundle struct {
+	Hash   common.Hash
+	Txs    []*types.Transaction
+	Atomic bool
+
+	added time.Time
+}
+
+// BundlePool holds the bundles awaiting inclusion.
+type BundlePool struct {
+	bundles map[common.Hash]*Bundle
+	lock    sync.Mutex
+}
+
+// NewBundlePool creates an empty bundle pool.
+func NewBundlePool() *BundlePool {
+	return &BundlePool{
+		bundles: make(map[common.Hash]*Bundle),
+	}
+}
+
+// Add decodes and validates a bundle and queues it for inclusion, returning its
+// hash.
+func (bp *BundlePool) Add(args *BundleArgs) (common.Hash, error) {
+	if len(args.Transactions) == 0 {
+		return common.Hash{}, errEmptyBundle
+	}
+	if len(args.Transactions) > maxBundleSize {
+		return common.Hash{}, fmt.Errorf("%w: %d transactions, max %d", errBundleTooLarge, len(args.Transactions), maxBundleSize)
+	}
+	var (
+		txs    = make([]*types.Transaction, len(args.Transactions))
+		hashes = make([][]byte, 0, len(args.Transactions)+1)
+		seen   = make(map[common.Hash]bool)
+	)
+	for i, enc := range args.Transactions {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(enc); err != nil {
+			return common.Hash{}, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		if tx.Type() == types.BlobTxType {
+			return common.Hash{}, errBundleBlobTx
+		}
+		if seen[tx.Hash()] {
+			return common.Hash{}, fmt.Errorf("%w: %x", errBundleDuplicateTx, tx.Hash())
+		}
+		seen[tx.Hash()] = true
+		txs[i] = tx
+		hashes = append(hashes, tx.Hash().Bytes())
+	}
+	if args.Atomic {
+		hashes = append(hashes, []byte{0x01})
+	}
+	bundle := &Bundle{
+		Hash:   crypto.Keccak256Hash(hashes...),
+		Txs:    txs,
+		Atomic: args.Atomic,
+		added:  time.Now(),
+	}
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+
+	bp.expire()
+	if _, ok := bp.bundles[bundle.Hash]; !ok && len(bp.bundles) >= maxBundles {
+		return common.Hash{}, errBundlePoolFull
+	}
+	bp.bundles[bundle.Hash] = bundle
+	return bundle.Hash, nil
+}
+
+// expire drops the bundles that were not included within their lifetime. The
+// lock must be held.
+func (bp *BundlePool) expire() {
+	for hash, bundle := range bp.bundles {
+		if time.Since(bundle.added) > bundleLifetime {
+			delete(bp.bundles, hash)
+		}
+	}
+}
+
+// Pending returns the bundles awaiting inclusion, oldest first.
+func (bp *BundlePool) Pending() []*Bundle {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+
+	bp.expire()
+	bundles := make([]*Bundle, 0, len(bp.bundles))
+	for _, bundle := range bp.bundles {
+		bundles = append(bundles, bundle)
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		if !bundles[i].added.Equal(bundles[j].added) {
+			return bundles[i].added.Before(bundles[j].added)
+		}
+		return bundles[i].Hash.Cmp(bundles[j].Hash) < 0
+	})
+	return bundles
+}
+
+// Prune drops the bundles any of whose transactions were included in a block,
+// as they can no longer be included as a whole.
+func (bp *BundlePool) Prune(txs []*types.Transaction) {
+	included := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		included[tx.Hash()] = true
+	}
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+
+	for hash, bundle := range bp.bundles {
+		for _, tx := range bundle.Txs {
+			if included[tx.Hash()] {
+				delete(bp.bundles, hash)
+				break
+			}
+		}
+	}
+}
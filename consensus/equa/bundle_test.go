@@ -0,0 +1,104 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// newTestBundle creates a bundle of the given transactions.
+func newTestBundle(t *testing.T, pool *BundlePool, atomic bool, txs ...*types.Transaction) *Bundle {
+	t.Helper()
+
+	args := &BundleArgs{Atomic: atomic}
+	for _, tx := range txs {
+		enc, _ := tx.MarshalBinary()
+		args.Transactions = append(args.Transactions, enc)
+	}
+	hash, err := pool.Add(args)
+	if err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	for _, bundle := range pool.Pending() {
+		if bundle.Hash == hash {
+			return bundle
+		}
+	}
+	t.Fatalf("bundle %x not pending", hash)
+	return nil
+}
+
+// Tests that malformed bundles are rejected and that bundles are dropped once
+// any of their transactions is included.
+func TestBundlePool(t *testing.T) {
+	pool := NewBundlePool()
+	txs := newTestTransactions(t, 4)
+
+	if _, err := pool.Add(&BundleArgs{}); err != errEmptyBundle {
+		t.Fatalf("empty bundle: have %v, want %v", err, errEmptyBundle)
+	}
+	enc, _ := txs[0].MarshalBinary()
+	if _, err := pool.Add(&BundleArgs{Transactions: []hexutil.Bytes{enc, enc}}); !errors.Is(err, errBundleDuplicateTx) {
+		t.Fatalf("duplicate transaction: have %v, want %v", err, errBundleDuplicateTx)
+	}
+	if _, err := pool.Add(&BundleArgs{Transactions: make([]hexutil.Bytes, maxBundleSize+1)}); !errors.Is(err, errBundleTooLarge) {
+		t.Fatalf("oversized bundle: have %v, want %v", err, errBundleTooLarge)
+	}
+	newTestBundle(t, pool, true, txs[0], txs[1])
+	newTestBundle(t, pool, false, txs[2], txs[3])
+
+	pool.Prune(txs[1:2])
+	if pending := pool.Pending(); len(pending) != 1 || pending[0].Txs[0].Hash() != txs[2].Hash() {
+		t.Fatalf("pending bundles mismatch after pruning: %v", pending)
+	}
+}
+
+// Tests that bundled transactions are kept together, in bundle order, at the
+// fair position of their earliest member.
+func TestOrderWithBundles(t *testing.T) {
+	var (
+		orderer = NewFairOrderer(nil)
+		txs     = newTestTransactions(t, 6)
+	)
+	orderer.arrivals = NewArrivalRecorder(&params.EquaConfig{ArrivalCacheSize: 1024}, func(common.Address) bool { return true })
+	recordTestArrivals(orderer.arrivals, txs)
+
+	ordered := orderer.OrderTransactions(txs, nil, common.Hash{})
+	// Bundle the last and the second transaction, in reverse arrival order
+	bundle := newTestBundle(t, NewBundlePool(), true, ordered[5], ordered[1])
+
+	have := orderer.OrderWithBundles(ordered, []*Bundle{bundle}, nil, common.Hash{})
+	want := []*types.Transaction{ordered[0], ordered[5], ordered[1], ordered[2], ordered[3], ordered[4]}
+	for i := range want {
+		if have[i].Hash() != want[i].Hash() {
+			t.Fatalf("position %d: have %x, want %x", i, have[i].Hash(), want[i].Hash())
+		}
+	}
+	// Bundles not fully contained in the block are ordered individually
+	partial := orderer.OrderWithBundles(ordered[1:5], []*Bundle{bundle}, nil, common.Hash{})
+	for i, tx := range ordered[1:5] {
+		if partial[i] != tx {
+			t.Fatalf("partial bundle reordered transactions")
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/ethdb"
+	"github.com/equa/go-equa/log"
+)
+
+// burnIndexBatch is the number of blocks indexed into the burn ledger per round.
+const burnIndexBatch = 4096
+
+var errBurnLedgerBehind = errors.New("burn ledger not indexed up to block")
+
+// BurnEntry is the MEV burn accounting of a block, along with the running totals
+// of the chain up to and including it. The difference of the totals of two
+// blocks accounts for the blocks between them. Blocks whose receipts were not
+// available when indexed in the background are marked as such, and left out of
+// the totals.
+type BurnEntry struct {
+	Number              uint64         `json:"number"`
+	Hash                common.Hash    `json:"hash"`
+	Proposer            common.Address `json:"proposer"`
+	Unavailable         bool           `json:"unavailable,omitempty"` // Receipts of the block unavailable
+	MEV                 *big.Int       `json:"mev"`                   // MEV detected in the block
+	Burned              *big.Int       `json:"burned"`                // Share of the MEV burned
+	ProposerReward      *big.Int       `json:"proposerReward"`        // Share of the MEV paid to the proposer
+	TotalMEV            *big.Int       `json:"totalMEV"`              // MEV detected up to the block
+	TotalBurned         *big.Int       `json:"totalBurned"`           // MEV burned up to the block
+	TotalProposerReward *big.Int       `json:"totalProposerReward"`   // MEV paid to proposers up to the block
+	TotalMEVBlocks      uint64         `json:"totalMEVBlocks"`        // Blocks with MEV up to the block
+	TotalUnavailable    uint64         `json:"totalUnavailable"`      // Blocks left out up to the block
+}
+
+// burnKey is the database key of the burn ledger entry of a block.
+func burnKey(number uint64, hash common.Hash) []byte {
+	key := make([]byte, 0, len(rawdb.EquaBurnPrefix)+8+common.HashLength)
+	key = append(key, rawdb.EquaBurnPrefix...)
+	key = binary.BigEndian.AppendUint64(key, number)
+	return append(key, hash[:]...)
+}
+
+// readBurnEntry retrieves the burn ledger entry of a block, or nil if the block
+// has not been indexed.
+func readBurnEntry(db ethdb.KeyValueReader, number uint64, hash common.Hash) *BurnEntry {
+	blob, err := db.Get(burnKey(number, hash))
+	if err != nil {
+		return nil
+	}
+	entry := new(BurnEntry)
+	if err := json.Unmarshal(blob, entry); err != nil {
+		log.Error("Invalid burn ledger entry", "number", number, "hash", hash, "err", err)
+		return nil
+	}
+	return entry
+}
+
+// writeBurnEntry stores the burn ledger entry of a block.
+func writeBurnEntry(db ethdb.KeyValueWriter, entry *BurnEntry) error {
+	blob, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return db.Put(burnKey(entry.Number, entry.Hash), blob)
+}
+
+// readBurnHead retrieves the number of the latest block indexed into the burn
+// ledger, zero if none was.
+func readBurnHead(db ethdb.KeyValueReader) uint64 {
+	blob, err := db.Get(rawdb.EquaBurnHeadKey)
+	if err != nil || len(blob) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(blob)
+}
+
+// newBurnEntry accounts for the MEV burned in a block on top of the running
+// totals of its parent, nil for the genesis block.
+func (e *Equa) newBurnEntry(chain consensus.ChainHeaderReader, header *types.Header, parent *BurnEntry) (*BurnEntry, error) {
+	reader, ok := chain.(consensus.ChainReader)
+	if !ok {
+		return nil, errBlocksUnavailable
+	}
+	number := header.Number.Uint64()
+	block := reader.GetBlock(header.Hash(), number)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownBlock, number)
+	}
+	receipts := chainReceipts(chain, block.Hash())
+	if len(receipts) != len(block.Transactions()) {
+		return nil, fmt.Errorf("%w: block %d", errReceiptsUnavailable, number)
+	}
+	// Account for the MEV burned, detected with the rules of the state transition
+	mev := e.mevDetector.detectConsensusMEV(block.Transactions(), receipts, e.consensusBaseFee(header))
+	burned, reward := e.splitMEV(mev)
+
+	entry := &BurnEntry{
+		Number:              number,
+		Hash:                block.Hash(),
+		Proposer:            block.Coinbase(),
+		MEV:                 mev,
+		Burned:              burned,
+		ProposerReward:      reward,
+		TotalMEV:            new(big.Int).Set(mev),
+		TotalBurned:         new(big.Int).Set(burned),
+		TotalProposerReward: new(big.Int).Set(reward),
+	}
+	if mev.Sign() > 0 {
+		entry.TotalMEVBlocks = 1
+	}
+	if parent != nil {
+		entry.TotalMEV.Add(entry.TotalMEV, parent.TotalMEV)
+		entry.TotalBurned.Add(entry.TotalBurned, parent.TotalBurned)
+		entry.TotalProposerReward.Add(entry.TotalProposerReward, parent.TotalProposerReward)
+		entry.TotalMEVBlocks += parent.TotalMEVBlocks
+		entry.TotalUnavailable = parent.TotalUnavailable
+	}
+	return entry, nil
+}
+
+// unavailableBurnEntry marks a block whose receipts are unavailable in the burn
+// ledger, carrying the running totals of its parent over.
+func unavailableBurnEntry(header *types.Header, parent *BurnEntry) *BurnEntry {
+	entry := &BurnEntry{
+		Number:              header.Number.Uint64(),
+		Hash:                header.Hash(),
+		Proposer:            header.Coinbase,
+		Unavailable:         true,
+		MEV:                 new(big.Int),
+		Burned:              new(big.Int),
+		ProposerReward:      new(big.Int),
+		TotalMEV:            new(big.Int),
+		TotalBurned:         new(big.Int),
+		TotalProposerReward: new(big.Int),
+		TotalUnavailable:    1,
+	}
+	if parent != nil {
+		entry.TotalMEV.Set(parent.TotalMEV)
+		entry.TotalBurned.Set(parent.TotalBurned)
+		entry.TotalProposerReward.Set(parent.TotalProposerReward)
+		entry.TotalMEVBlocks = parent.TotalMEVBlocks
+		entry.TotalUnavailable += parent.TotalUnavailable
+	}
+	return entry
+}
+
+// burnEntry returns the burn ledger entry of a canonical block, indexing it and
+// the ancestors it is missing the totals of if not done before. Blocks that
+// replaced others in a reorg are indexed afresh.
+func (e *Equa) burnEntry(chain consensus.ChainHeaderReader, number uint64) (*BurnEntry, error) {
+	return e.indexBurnEntry(chain, number, false)
+}
+
+// indexBurnEntry is burnEntry, optionally marking the blocks whose receipts are
+// unavailable instead of failing on them.
+func (e *Equa) indexBurnEntry(chain consensus.ChainHeaderReader, number uint64, markUnavailable bool) (*BurnEntry, error) {
+	header := chain.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownBlock, number)
+	}
+	// Walk back to the closest indexed ancestor, or the genesis block, that the
+	// running totals continue from
+	var (
+		pending []*types.Header
+		entry   = readBurnEntry(e.db, number, header.Hash())
+	)
+	for entry == nil {
+		if len(pending) == maxScanBlocks {
+			return nil, fmt.Errorf("%w %d, indexed up to %d", errBurnLedgerBehind, number, readBurnHead(e.db))
+		}
+		pending = append(pending, header)
+		if header.Number.Sign() == 0 {
+			break
+		}
+		parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return nil, fmt.Errorf("%w: %d", errUnknownBlock, header.Number.Uint64()-1)
+		}
+		header, entry = parent, readBurnEntry(e.db, parent.Number.Uint64(), parent.Hash())
+	}
+	if len(pending) == 0 {
+		return entry, nil
+	}
+	batch := e.db.NewBatch()
+	for i := len(pending) - 1; i >= 0; i-- {
+		next, err := e.newBurnEntry(chain, pending[i], entry)
+		if errors.Is(err, errReceiptsUnavailable) && markUnavailable {
+			next, err = unavailableBurnEntry(pending[i], entry), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBurnEntry(batch, next); err != nil {
+			return nil, err
+		}
+		entry = next
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// StartBurnLedger starts indexing the MEV burned in the canonical chain into the
+// burn ledger, from the genesis block on, until the engine is closed.
+func (e *Equa) StartBurnLedger(chain consensus.ChainReader) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(e.config.Period) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.indexBurns(chain)
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// indexBurns indexes the canonical blocks following the latest indexed one into
+// the burn ledger, at most burnIndexBatch of them. Blocks whose receipts are
+// unavailable, e.g. pruned, are marked as such rather than holding the ledger
+// back.
+func (e *Equa) indexBurns(chain consensus.ChainHeaderReader) {
+	head := chain.CurrentHeader()
+	if head == nil {
+		return
+	}
+	var (
+		first       = min(readBurnHead(e.db), head.Number.Uint64())
+		last        = min(first+burnIndexBatch, head.Number.Uint64())
+		indexed     = first
+		unavailable int
+	)
+	for n := first; n <= last; n++ {
+		entry, err := e.indexBurnEntry(chain, n, true)
+		if err != nil {
+			log.Warn("Burn ledger indexing stalled", "number", n, "indexed", indexed, "err", err)
+			break
+		}
+		if entry.Unavailable {
+			unavailable++
+		}
+		indexed = n
+	}
+	if unavailable > 0 {
+		log.Warn("Left blocks without receipts out of burn ledger", "count", unavailable, "from", first, "to", indexed)
+	}
+	if err := e.db.Put(rawdb.EquaBurnHeadKey, binary.BigEndian.AppendUint64(nil, indexed)); err != nil {
+		log.Error("Failed to store burn ledger head", "number", indexed, "err", err)
+	}
+}
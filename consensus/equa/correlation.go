@@ -0,0 +1,169 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/equa/go-equa/common"
+)
+
+const (
+	timingSamples    = 32                     // Recent proposals kept per validator
+	timingMinSamples = 8                      // Proposals needed before a validator's timing is compared
+	timingBucket     = 100 * time.Millisecond // Resolution at which timing signatures are compared
+	timingMaxDelay   = 30 * time.Second       // Delays beyond this are from syncing, not live proposals
+)
+
+// Concentration risk levels, by the stake share of the largest group of
+// validators likely to fail together.
+const (
+	RiskLow      = "low"      // No correlated group can endanger finality
+	RiskElevated = "elevated" // A correlated group holds over a sixth of the stake
+	RiskCritical = "critical" // A correlated group holds a third of the stake, enough to stall finality
+)
+
+// CorrelationGroup is a set of validators sharing a trait that makes them
+// likely to fail at the same time.
+type CorrelationGroup struct {
+	Kind       string           `json:"kind"` // Shared trait: "subnet", "provider" or "timing"
+	Key        string           `json:"key"`  // Value of the shared trait
+	Validators []common.Address `json:"validators"`
+	StakeShare float64          `json:"stakeShare"` // Fraction of the total stake held by the group
+}
+
+// ConcentrationReport estimates how concentrated the validator set is on shared
+// infrastructure.
+type ConcentrationReport struct {
+	Validators    int                 `json:"validators"`    // Active validators
+	Identified    int                 `json:"identified"`    // Validators that reported a node identity
+	Timed         int                 `json:"timed"`         // Validators with enough proposals to compare timing
+	Groups        []*CorrelationGroup `json:"groups"`        // Groups of two or more, by descending stake share
+	MaxStakeShare float64             `json:"maxStakeShare"` // Stake share of the largest group
+	Risk          string              `json:"risk"`
+}
+
+// CorrelationMonitor tracks the arrival timing of the blocks proposed by each
+// validator. Validators whose blocks consistently arrive with the same delay
+// after their timestamp likely share a host or setup, even if they report
+// different identities or none at all.
+type CorrelationMonitor struct {
+	delays map[common.Address][]time.Duration
+	lock   sync.Mutex
+}
+
+// NewCorrelationMonitor creates a monitor without any recorded proposals.
+func NewCorrelationMonitor() *CorrelationMonitor {
+	return &CorrelationMonitor{
+		delays: make(map[common.Address][]time.Duration),
+	}
+}
+
+// RecordProposal records the delay between the timestamp of a block proposed by
+// the validator and its local arrival.
+func (cm *CorrelationMonitor) RecordProposal(validator common.Address, delay time.Duration) {
+	if delay < 0 || delay > timingMaxDelay {
+		return
+	}
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	delays := append(cm.delays[validator], delay)
+	if len(delays) > timingSamples {
+		delays = delays[len(delays)-timingSamples:]
+	}
+	cm.delays[validator] = delays
+}
+
+// timingSignature returns the median proposal delay of a validator rounded to
+// the comparison resolution, if enough proposals were recorded.
+func (cm *CorrelationMonitor) timingSignature(validator common.Address) (time.Duration, bool) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	if len(cm.delays[validator]) < timingMinSamples {
+		return 0, false
+	}
+	delays := slices.Clone(cm.delays[validator])
+	slices.Sort(delays)
+	return delays[len(delays)/2].Round(timingBucket), true
+}
+
+// Report groups the validators by shared subnet, hosting provider and timing
+// signature, and rates the concentration risk by the largest group's stake.
+func (cm *CorrelationMonitor) Report(validators []*Validator) *ConcentrationReport {
+	var (
+		report = &ConcentrationReport{Validators: len(validators), Risk: RiskLow}
+		total  = new(big.Int)
+		groups = make(map[[2]string][]*Validator)
+	)
+	for _, validator := range validators {
+		total.Add(total, validator.Stake)
+		if id := validator.Identity; id != nil {
+			report.Identified++
+			groups[[2]string{"subnet", id.Subnet()}] = append(groups[[2]string{"subnet", id.Subnet()}], validator)
+			if id.Provider != "" {
+				groups[[2]string{"provider", id.Provider}] = append(groups[[2]string{"provider", id.Provider}], validator)
+			}
+		}
+		if signature, ok := cm.timingSignature(validator.Address); ok {
+			report.Timed++
+			key := [2]string{"timing", fmt.Sprint(signature)}
+			groups[key] = append(groups[key], validator)
+		}
+	}
+	if total.Sign() == 0 {
+		return report
+	}
+	for key, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		group := &CorrelationGroup{Kind: key[0], Key: key[1]}
+		stake := new(big.Int)
+		for _, member := range members {
+			group.Validators = append(group.Validators, member.Address)
+			stake.Add(stake, member.Stake)
+		}
+		group.StakeShare, _ = new(big.Rat).SetFrac(stake, total).Float64()
+		report.Groups = append(report.Groups, group)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].StakeShare != report.Groups[j].StakeShare {
+			return report.Groups[i].StakeShare > report.Groups[j].StakeShare
+		}
+		if report.Groups[i].Kind != report.Groups[j].Kind {
+			return report.Groups[i].Kind < report.Groups[j].Kind
+		}
+		return report.Groups[i].Key < report.Groups[j].Key
+	})
+	if len(report.Groups) > 0 {
+		report.MaxStakeShare = report.Groups[0].StakeShare
+	}
+	switch {
+	case 3*report.MaxStakeShare >= 1:
+		report.Risk = RiskCritical
+	case 6*report.MaxStakeShare > 1:
+		report.Risk = RiskElevated
+	}
+	return report
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that node identities are only accepted if signed by their validator.
+func TestDeclareIdentity(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	engine := newTestEngine(t, 32, addr)
+
+	id := &NodeIdentity{Validator: addr, IP: "10.0.0.1", Provider: "cloud"}
+	if err := engine.stakeManager.DeclareIdentity(id); err != errInvalidIdentitySignature {
+		t.Fatalf("unsigned identity: have %v, want %v", err, errInvalidIdentitySignature)
+	}
+	if err := id.Sign(key); err != nil {
+		t.Fatalf("failed to sign identity: %v", err)
+	}
+	if err := engine.stakeManager.DeclareIdentity(id); err != nil {
+		t.Fatalf("failed to declare identity: %v", err)
+	}
+	id.Region = "eu"
+	if err := engine.stakeManager.DeclareIdentity(id); err != errInvalidIdentitySignature {
+		t.Fatalf("modified identity: have %v, want %v", err, errInvalidIdentitySignature)
+	}
+	bad := &NodeIdentity{Validator: addr, IP: "not-an-ip"}
+	bad.Sign(key)
+	if err := engine.stakeManager.DeclareIdentity(bad); err != errInvalidIdentityIP {
+		t.Fatalf("invalid ip: have %v, want %v", err, errInvalidIdentityIP)
+	}
+}
+
+// Tests that validators sharing a subnet or timing signature are grouped and
+// the concentration risk rated by the group's stake share.
+func TestConcentrationReport(t *testing.T) {
+	var validators []*Validator
+	for i := 0; i < 6; i++ {
+		validators = append(validators, &Validator{
+			Address: common.BytesToAddress([]byte{byte(i + 1)}),
+			Stake:   big.NewInt(32),
+		})
+	}
+	monitor := NewCorrelationMonitor()
+	if report := monitor.Report(validators); report.Risk != RiskLow || len(report.Groups) != 0 {
+		t.Fatalf("uncorrelated set reported as %s with %d groups", report.Risk, len(report.Groups))
+	}
+	// Two validators on the same /24 hold a third of the stake
+	validators[0].Identity = &NodeIdentity{IP: "192.168.1.10"}
+	validators[1].Identity = &NodeIdentity{IP: "192.168.1.20"}
+	validators[2].Identity = &NodeIdentity{IP: "192.168.2.10"}
+
+	report := monitor.Report(validators)
+	if report.Identified != 3 || len(report.Groups) != 1 {
+		t.Fatalf("subnet grouping mismatch: identified %d, groups %d", report.Identified, len(report.Groups))
+	}
+	if group := report.Groups[0]; group.Kind != "subnet" || group.Key != "192.168.1.0/24" || len(group.Validators) != 2 {
+		t.Fatalf("subnet group mismatch: %+v", group)
+	}
+	if report.Risk != RiskCritical {
+		t.Fatalf("risk mismatch: have %s, want %s", report.Risk, RiskCritical)
+	}
+	// Timing signatures only count once enough proposals are recorded
+	validators[0].Identity, validators[1].Identity = nil, nil
+	for i := 0; i < timingMinSamples; i++ {
+		monitor.RecordProposal(validators[3].Address, 420*time.Millisecond)
+		monitor.RecordProposal(validators[4].Address, 380*time.Millisecond)
+		monitor.RecordProposal(validators[5].Address, time.Hour)
+	}
+	report = monitor.Report(validators)
+	if report.Timed != 2 || len(report.Groups) != 1 || report.Groups[0].Kind != "timing" {
+		t.Fatalf("timing grouping mismatch: timed %d, groups %+v", report.Timed, report.Groups)
+	}
+}
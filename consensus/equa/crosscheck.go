@@ -0,0 +1,380 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
+	"github.com/equa/go-equa/rpc"
+)
+
+const (
+	crossCheckTimeout = 5 * time.Second // Time allowed for peers to report a score
+	crossCheckBacklog = 16              // Maximum number of blocks checked per head update
+	crossCheckHistory = 128             // Number of divergent reports kept for inspection
+	crossCheckWindow  = 100             // Number of recent checks the alert threshold applies to
+)
+
+var (
+	crossCheckMeter      = metrics.NewRegisteredMeter("equa/crosscheck/blocks", nil)
+	crossCheckDivMeter   = metrics.NewRegisteredMeter("equa/crosscheck/divergent", nil)
+	crossCheckMEVMeter   = metrics.NewRegisteredMeter("equa/crosscheck/mevdivergent", nil)
+	crossCheckAlertGauge = metrics.NewRegisteredGauge("equa/crosscheck/alert", nil)
+
+	errCrossCheckDisabled = errors.New("ordering cross-check not enabled")
+)
+
+// CrossCheckConfig configures the ordering cross-check, which compares the fair
+// ordering score and MEV verdict computed locally for each new block with the
+// ones reported by other nodes to detect buggy or malicious implementations.
+type CrossCheckConfig struct {
+	Peers     []string `toml:",omitempty"` // RPC endpoints of the nodes to compare against
+	Samples   int      // Number of peers asked per block
+	Tolerance float64  // Score difference at which a peer disagrees
+	Alert     int      // Divergent blocks among the recent checks at which an alert is raised
+	Dir       string   `toml:",omitempty"` // Directory to write diagnostic bundles to
+}
+
+// DefaultCrossCheckConfig contains the default settings of the ordering
+// cross-check. It is disabled unless peers are configured.
+var DefaultCrossCheckConfig = CrossCheckConfig{
+	Samples:   3,
+	Tolerance: 0.01,
+	Alert:     5,
+}
+
+// CrossCheckReport is the outcome of comparing the ordering score and MEV
+// verdict of a block with the ones reported by a sample of peers.
+type CrossCheckReport struct {
+	Number    uint64             `json:"number"`
+	Hash      common.Hash        `json:"hash"`
+	Local     float64            `json:"local"`
+	Peers     map[string]float64 `json:"peers"`
+	Failed    map[string]string  `json:"failed,omitempty"`
+	Divergent bool               `json:"divergent"`
+
+	LocalMEV     *big.Int            `json:"localMEV"`     // MEV detected locally, in wei
+	PeerMEV      map[string]*big.Int `json:"peerMEV"`      // MEV detected by the answering peers
+	MEVDivergent bool                `json:"mevDivergent"` // Whether peers disagree on the block containing MEV
+}
+
+// peerScore is the score breakdown reported by a peer for a block.
+type peerScore struct {
+	BlockHash     common.Hash `json:"hash"`
+	OrderingScore float64     `json:"orderingScore"`
+	MEV           *big.Int    `json:"mev"`
+}
+
+// OrderingCrossCheck asks a random sample of peers for their ordering score of
+// a block and compares them with the local one.
+type OrderingCrossCheck struct {
+	config      CrossCheckConfig
+	fairOrderer *FairOrderer
+	mevDetector *MEVDetector
+
+	// fetch retrieves the score of a block from a peer, replaceable in tests
+	fetch func(ctx context.Context, peer string, number uint64) (*peerScore, error)
+
+	rand    *rand.Rand
+	history []*CrossCheckReport // Recent divergent reports, oldest first
+	recent  []bool              // Divergence of the recent checks, oldest first
+	alert   bool                // Whether the alert threshold is currently exceeded
+	lock    sync.Mutex
+}
+
+// NewOrderingCrossCheck creates a cross-check against the configured peers.
+func NewOrderingCrossCheck(config CrossCheckConfig, fairOrderer *FairOrderer, mevDetector *MEVDetector) *OrderingCrossCheck {
+	if config.Samples <= 0 {
+		config.Samples = DefaultCrossCheckConfig.Samples
+	}
+	if config.Tolerance <= 0 {
+		config.Tolerance = DefaultCrossCheckConfig.Tolerance
+	}
+	if config.Alert <= 0 {
+		config.Alert = DefaultCrossCheckConfig.Alert
+	}
+	return &OrderingCrossCheck{
+		config:      config,
+		fairOrderer: fairOrderer,
+		mevDetector: mevDetector,
+		fetch:       fetchPeerScore,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// fetchPeerScore requests the score breakdown of a block over RPC.
+func fetchPeerScore(ctx context.Context, peer string, number uint64) (*peerScore, error) {
+	client, err := rpc.DialContext(ctx, peer)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var score peerScore
+	if err := client.CallContext(ctx, &score, "equa_getScoreBreakdown", number); err != nil {
+		return nil, err
+	}
+	return &score, nil
+}
+
+// sample returns a random subset of the configured peers.
+func (cc *OrderingCrossCheck) sample() []string {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	peers := make([]string, len(cc.config.Peers))
+	for i, j := range cc.rand.Perm(len(peers)) {
+		peers[i] = cc.config.Peers[j]
+	}
+	if len(peers) > cc.config.Samples {
+		peers = peers[:cc.config.Samples]
+	}
+	return peers
+}
+
+// Check compares the local ordering score and MEV verdict of the block with the
+// ones reported by a sample of peers. The receipts may be nil if they are not
+// available. Peers on a different fork or failing to answer are not counted.
+// The block is considered divergent if at least two peers answered and a strict
+// majority of them disagrees with the local score, or with whether the block
+// contains MEV at all, in which case a warning is logged and a diagnostic
+// bundle written.
+func (cc *OrderingCrossCheck) Check(ctx context.Context, block *types.Block, receipts types.Receipts) *CrossCheckReport {
+	report := &CrossCheckReport{
+		Number:   block.NumberU64(),
+		Hash:     block.Hash(),
+		Local:    cc.fairOrderer.GetOrderingScore(block.Transactions()),
+		Peers:    make(map[string]float64),
+		Failed:   make(map[string]string),
+		LocalMEV: new(big.Int),
+		PeerMEV:  make(map[string]*big.Int),
+	}
+	for _, finding := range cc.mevDetector.Analyze(block.Transactions(), receipts, block.BaseFee()) {
+		report.LocalMEV.Add(report.LocalMEV, finding.Profit)
+	}
+	ctx, cancel := context.WithTimeout(ctx, crossCheckTimeout)
+	defer cancel()
+
+	var (
+		peers = cc.sample()
+		lock  sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+
+			score, err := cc.fetch(ctx, peer, report.Number)
+			lock.Lock()
+			defer lock.Unlock()
+
+			switch {
+			case err != nil:
+				report.Failed[peer] = err.Error()
+			case score.BlockHash != report.Hash:
+				report.Failed[peer] = fmt.Sprintf("different block %x", score.BlockHash)
+			default:
+				report.Peers[peer] = score.OrderingScore
+				if score.MEV != nil {
+					report.PeerMEV[peer] = score.MEV
+				}
+			}
+		}(peer)
+	}
+	wg.Wait()
+
+	disagree := 0
+	for _, score := range report.Peers {
+		if math.Abs(score-report.Local) > cc.config.Tolerance {
+			disagree++
+		}
+	}
+	report.Divergent = len(report.Peers) >= 2 && 2*disagree > len(report.Peers)
+
+	// Amounts depend on receipt availability, only the verdict must agree
+	mevDisagree := 0
+	for _, mev := range report.PeerMEV {
+		if (mev.Sign() > 0) != (report.LocalMEV.Sign() > 0) {
+			mevDisagree++
+		}
+	}
+	report.MEVDivergent = len(report.PeerMEV) >= 2 && 2*mevDisagree > len(report.PeerMEV)
+
+	crossCheckMeter.Mark(1)
+	if report.Divergent {
+		crossCheckDivMeter.Mark(1)
+		log.Warn("Ordering score diverges from peers", "number", report.Number, "hash", report.Hash,
+			"local", report.Local, "peers", len(report.Peers), "disagree", disagree)
+	}
+	if report.MEVDivergent {
+		crossCheckMEVMeter.Mark(1)
+		log.Warn("MEV verdict diverges from peers", "number", report.Number, "hash", report.Hash,
+			"local", report.LocalMEV, "peers", len(report.PeerMEV), "disagree", mevDisagree)
+	}
+	if report.Divergent || report.MEVDivergent {
+		if err := cc.writeBundle(block, report); err != nil {
+			log.Error("Failed to write ordering diagnostics", "number", report.Number, "err", err)
+		}
+	}
+	cc.record(report)
+	return report
+}
+
+// record adds the outcome of a check to the divergence history, raising an
+// alert while the number of divergent blocks among the recent checks is at or
+// above the configured threshold.
+func (cc *OrderingCrossCheck) record(report *CrossCheckReport) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	divergent := report.Divergent || report.MEVDivergent
+	if divergent {
+		cc.history = append(cc.history, report)
+		if len(cc.history) > crossCheckHistory {
+			cc.history = cc.history[len(cc.history)-crossCheckHistory:]
+		}
+	}
+	cc.recent = append(cc.recent, divergent)
+	if len(cc.recent) > crossCheckWindow {
+		cc.recent = cc.recent[len(cc.recent)-crossCheckWindow:]
+	}
+	count := 0
+	for _, divergent := range cc.recent {
+		if divergent {
+			count++
+		}
+	}
+	switch alert := count >= cc.config.Alert; {
+	case alert && !cc.alert:
+		crossCheckAlertGauge.Update(1)
+		log.Error("Persistent divergence from peers, local scoring may be faulty or under attack",
+			"divergent", count, "checked", len(cc.recent))
+	case !alert && cc.alert:
+		crossCheckAlertGauge.Update(0)
+		log.Info("Divergence from peers back below alert threshold", "divergent", count, "checked", len(cc.recent))
+	}
+	cc.alert = count >= cc.config.Alert
+}
+
+// History returns the recent divergent reports, oldest first.
+func (cc *OrderingCrossCheck) History() []*CrossCheckReport {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	return slices.Clone(cc.history)
+}
+
+// crossCheckBundle is the diagnostic information written for a divergent block.
+type crossCheckBundle struct {
+	Report       *CrossCheckReport `json:"report"`
+	Transactions []common.Hash     `json:"transactions"` // Transactions in block order
+	FairOrder    []common.Hash     `json:"fairOrder"`    // Transactions in locally computed fair order
+	Peers        []string          `json:"peers"`        // Peers answering, sorted
+}
+
+// writeBundle stores the diagnostic bundle of a divergent block, if a directory
+// is configured.
+func (cc *OrderingCrossCheck) writeBundle(block *types.Block, report *CrossCheckReport) error {
+	if cc.config.Dir == "" {
+		return nil
+	}
+	bundle := &crossCheckBundle{Report: report}
+	for _, tx := range block.Transactions() {
+		bundle.Transactions = append(bundle.Transactions, tx.Hash())
+	}
+	for _, tx := range cc.fairOrderer.OrderTransactions(block.Transactions(), block.BaseFee(), statementSeed(block.Header())) {
+		bundle.FairOrder = append(bundle.FairOrder, tx.Hash())
+	}
+	for peer := range report.Peers {
+		bundle.Peers = append(bundle.Peers, peer)
+	}
+	sort.Strings(bundle.Peers)
+
+	blob, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cc.config.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("crosscheck-%d-%x.json", report.Number, report.Hash[:4])
+	return os.WriteFile(filepath.Join(cc.config.Dir, name), blob, 0644)
+}
+
+// loop cross-checks every new block behind the chain head until quit is closed.
+// Blocks are checked one behind the head to give peers time to import them.
+func (cc *OrderingCrossCheck) loop(chain consensus.ChainReader, period time.Duration, quit chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var last uint64
+	for {
+		select {
+		case <-ticker.C:
+			head := chain.CurrentHeader()
+			if head == nil || head.Number.Uint64() <= last+1 {
+				continue
+			}
+			number := head.Number.Uint64() - 1
+			// Skip ahead when starting or catching up, only recent blocks matter
+			if last == 0 || number-last > crossCheckBacklog {
+				last = number - 1
+			}
+			for n := last + 1; n <= number; n++ {
+				header := chain.GetHeaderByNumber(n)
+				if header == nil {
+					break
+				}
+				if block := chain.GetBlock(header.Hash(), n); block != nil {
+					cc.Check(context.Background(), block, chainReceipts(chain, block.Hash()))
+				}
+				last = n
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// chainReceipts retrieves the receipts of a block, if the chain gives access to
+// them.
+func chainReceipts(chain consensus.ChainHeaderReader, hash common.Hash) types.Receipts {
+	if chain, ok := chain.(interface {
+		GetReceiptsByHash(hash common.Hash) types.Receipts
+	}); ok {
+		return chain.GetReceiptsByHash(hash)
+	}
+	return nil
+}
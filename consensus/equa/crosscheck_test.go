@@ -0,0 +1,117 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that blocks are only flagged as divergent if a majority of the peers
+// answering for the same block disagree with the local ordering score.
+func TestOrderingCrossCheck(t *testing.T) {
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(7)}).WithBody(types.Body{Transactions: newTestTransactions(t, 5)})
+	fairOrderer := NewFairOrderer(&params.EquaConfig{})
+	mevDetector := NewMEVDetector(&params.EquaConfig{}, types.LatestSigner(params.MergedTestChainConfig))
+	local := fairOrderer.GetOrderingScore(block.Transactions())
+
+	tests := []struct {
+		name      string
+		scores    map[string]float64 // Scores reported for the block, missing peers fail
+		forked    map[string]bool    // Peers reporting a different block
+		divergent bool
+	}{
+		{name: "agreement", scores: map[string]float64{"a": local, "b": local, "c": local}},
+		{name: "single outlier", scores: map[string]float64{"a": local, "b": local, "c": local - 0.5}},
+		{name: "majority disagrees", scores: map[string]float64{"a": local - 0.5, "b": local - 0.4, "c": local}, divergent: true},
+		{name: "lone answer", scores: map[string]float64{"a": local - 0.5}},
+		{name: "forked peers", scores: map[string]float64{"a": local - 0.5, "b": local - 0.5, "c": local}, forked: map[string]bool{"a": true, "b": true}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		cc := NewOrderingCrossCheck(CrossCheckConfig{Peers: []string{"a", "b", "c", "d"}, Samples: 4, Dir: dir}, fairOrderer, mevDetector)
+		cc.fetch = func(ctx context.Context, peer string, number uint64) (*peerScore, error) {
+			score, ok := tt.scores[peer]
+			if !ok {
+				return nil, errors.New("unreachable")
+			}
+			hash := block.Hash()
+			if tt.forked[peer] {
+				hash[0] ^= 0xff
+			}
+			return &peerScore{BlockHash: hash, OrderingScore: score, MEV: new(big.Int)}, nil
+		}
+		report := cc.Check(context.Background(), block, nil)
+		if report.Divergent != tt.divergent {
+			t.Errorf("%s: divergent mismatch: have %v, want %v", tt.name, report.Divergent, tt.divergent)
+		}
+		if _, ok := report.Failed["d"]; !ok {
+			t.Errorf("%s: unreachable peer not reported", tt.name)
+		}
+		bundles, _ := os.ReadDir(dir)
+		if have := len(bundles) > 0; have != tt.divergent {
+			t.Errorf("%s: diagnostic bundle written: have %v, want %v", tt.name, have, tt.divergent)
+		}
+	}
+}
+
+// Tests that disagreement on whether a block contains MEV is detected, that
+// divergent blocks are kept in the history and that an alert is raised while
+// their number among the recent checks reaches the threshold.
+func TestMEVCrossCheck(t *testing.T) {
+	var (
+		block       = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(7)}).WithBody(types.Body{Transactions: newTestTransactions(t, 5)})
+		fairOrderer = NewFairOrderer(&params.EquaConfig{})
+		mevDetector = NewMEVDetector(&params.EquaConfig{}, types.LatestSigner(params.MergedTestChainConfig))
+		score       = fairOrderer.GetOrderingScore(block.Transactions())
+		peerMEV     map[string]int64
+	)
+	cc := NewOrderingCrossCheck(CrossCheckConfig{Peers: []string{"a", "b", "c"}, Samples: 3, Alert: 2}, fairOrderer, mevDetector)
+	cc.fetch = func(ctx context.Context, peer string, number uint64) (*peerScore, error) {
+		return &peerScore{BlockHash: block.Hash(), OrderingScore: score, MEV: big.NewInt(peerMEV[peer])}, nil
+	}
+	tests := []struct {
+		mev       map[string]int64
+		divergent bool
+		alert     bool
+	}{
+		{mev: map[string]int64{"b": 1e18}},                             // Lone dissent
+		{mev: map[string]int64{"a": 1e18, "b": 2e17}, divergent: true}, // Majority finds MEV missed locally
+		{mev: map[string]int64{}},                                      // Agreement
+		{mev: map[string]int64{"a": 1, "b": 1, "c": 1}, divergent: true, alert: true},
+	}
+	for i, tt := range tests {
+		peerMEV = tt.mev
+		report := cc.Check(context.Background(), block, nil)
+		if report.MEVDivergent != tt.divergent || report.Divergent {
+			t.Errorf("check %d: divergence mismatch: have %v/%v, want %v/false", i, report.MEVDivergent, report.Divergent, tt.divergent)
+		}
+		if cc.alert != tt.alert {
+			t.Errorf("check %d: alert mismatch: have %v, want %v", i, cc.alert, tt.alert)
+		}
+	}
+	history := cc.History()
+	if len(history) != 2 || history[0].Number != 7 || len(history[1].PeerMEV) != 3 {
+		t.Fatalf("history mismatch: have %d reports", len(history))
+	}
+}
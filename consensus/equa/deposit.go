@@ -0,0 +1,258 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+	"github.com/equa/go-equa/trie"
+	"github.com/equa/go-equa/trie/trienode"
+)
+
+// depositTopic is the topic of the DepositEvent emitted by the deposit contract.
+var depositTopic = common.HexToHash("0x649bbc62d0e31342afea4e5cd82d4049e7e1ee912fc0889aa790803be39038c5")
+
+// Deposits carry a proof of possession of the validator's BLS key, signed as for
+// the beacon chain deposit contract: a BLS signature in G2 under the public key
+// in G1, of the SSZ root of the deposit message (pubkey, withdrawal credentials,
+// amount) mixed with the deposit domain. The domain is that of the genesis fork
+// version, as deposits are valid across forks.
+var (
+	depositDST        = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+	depositDomainType = [4]byte{0x03, 0x00, 0x00, 0x00}
+)
+
+var (
+	errNoDepositContract     = errors.New("no deposit contract configured")
+	errInvalidDepositProof   = errors.New("invalid deposit receipt proof")
+	errNotDepositLog         = errors.New("log is not a deposit event")
+	errInvalidCredentials    = errors.New("deposit withdrawal credentials do not name an account")
+	errDepositAlreadyApplied = errors.New("deposit already applied")
+	errInvalidDepositSig     = errors.New("invalid deposit signature")
+)
+
+// DepositProof proves that a deposit event was emitted in a block, by proving
+// the inclusion of the receipt containing it in the block's receipt trie.
+type DepositProof struct {
+	BlockHash common.Hash     `json:"blockHash"` // Block containing the deposit
+	TxIndex   uint64          `json:"txIndex"`   // Index of the depositing transaction
+	LogIndex  uint64          `json:"logIndex"`  // Index of the deposit event within the receipt
+	Proof     []hexutil.Bytes `json:"proof"`     // Receipt trie nodes from the root to the receipt
+}
+
+// Deposit is a verified deposit into the staking contract.
+type Deposit struct {
+	Validator common.Address `json:"validator"` // Account named by the withdrawal credentials
+	PublicKey hexutil.Bytes  `json:"publicKey"` // BLS public key of the validator
+	Amount    *big.Int       `json:"amount"`    // Deposited amount in wei
+	Index     uint64         `json:"index"`     // Deposit counter of the contract
+}
+
+// VerifyDeposit checks the deposit proof against the receipt root of the given
+// header, which the caller must have obtained from its own chain, and decodes
+// the deposit emitted by the contract.
+func VerifyDeposit(header *types.Header, proof *DepositProof, contract common.Address) (*Deposit, error) {
+	if contract == (common.Address{}) {
+		return nil, errNoDepositContract
+	}
+	if header.Hash() != proof.BlockHash {
+		return nil, fmt.Errorf("%w: header %x, want %x", errInvalidDepositProof, header.Hash(), proof.BlockHash)
+	}
+	nodes := make(trienode.ProofList, len(proof.Proof))
+	for i, node := range proof.Proof {
+		nodes[i] = rlp.RawValue(node)
+	}
+	key := rlp.AppendUint64(nil, proof.TxIndex)
+	enc, err := trie.VerifyProof(header.ReceiptHash, key, nodes.Set())
+	if err != nil || enc == nil {
+		return nil, errInvalidDepositProof
+	}
+	receipt := new(types.Receipt)
+	if err := receipt.UnmarshalBinary(enc); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidDepositProof, err)
+	}
+	if proof.LogIndex >= uint64(len(receipt.Logs)) {
+		return nil, fmt.Errorf("%w: log %d of %d", errNotDepositLog, proof.LogIndex, len(receipt.Logs))
+	}
+	return depositFromLog(receipt.Logs[proof.LogIndex], contract)
+}
+
+// depositFromLog decodes the deposit emitted in a log by the deposit contract.
+func depositFromLog(event *types.Log, contract common.Address) (*Deposit, error) {
+	if event.Address != contract || len(event.Topics) == 0 || event.Topics[0] != depositTopic {
+		return nil, errNotDepositLog
+	}
+	request, err := types.DepositLogToRequest(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	return parseDepositRequest(request)
+}
+
+// depositKey is the storage slot recording that the deposit with the given
+// index was credited.
+func depositKey(index uint64) common.Hash {
+	key := common.BigToHash(new(big.Int).SetUint64(index))
+	return crypto.Keccak256Hash(key[:], registryDepositsSlot[:])
+}
+
+// creditDeposits credits the deposits emitted by the deposit contract in a block
+// to their validators in the validator registry, returning the number credited.
+// The receipts are those the block was executed with by the node itself, so no
+// deposit is taken on trust. Deposits of unknown validators are queued for
+// activation, those of exited ones are added to their unbonding stake. Every
+// deposit is only credited once.
+func (e *Equa) creditDeposits(chain consensus.ChainHeaderReader, header *types.Header, state vm.StateDB, receipts []*types.Receipt) int {
+	contract := chain.Config().DepositContractAddress
+	if contract == (common.Address{}) {
+		return 0
+	}
+	var (
+		registry = newValidatorRegistry(state, e.config)
+		epoch    = header.Number.Uint64() / e.config.Epoch
+		credited int
+	)
+	for _, receipt := range receipts {
+		for _, event := range receipt.Logs {
+			if event.Address != contract {
+				continue
+			}
+			deposit, err := depositFromLog(event, contract)
+			if err == nil && state.GetState(params.EquaValidatorsAddress, depositKey(deposit.Index)) != (common.Hash{}) {
+				err = errDepositAlreadyApplied
+			}
+			if err != nil {
+				log.Debug("Ignoring deposit", "number", header.Number, "tx", event.TxHash, "err", err)
+				continue
+			}
+			registry.initialize()
+			state.SetState(params.EquaValidatorsAddress, depositKey(deposit.Index), common.BigToHash(common.Big1))
+
+			switch reg := registry.get(deposit.Validator); reg.status {
+			case registrationActive, registrationExited:
+				reg.stake.Add(reg.stake, deposit.Amount)
+				registry.put(reg)
+			default:
+				registry.enqueue(deposit.Validator, deposit.Amount, deposit.PublicKey, epoch)
+			}
+			credited++
+			log.Debug("Credited deposit", "number", header.Number, "validator", deposit.Validator, "amount", deposit.Amount, "index", deposit.Index)
+		}
+	}
+	return credited
+}
+
+// parseDepositRequest decodes a deposit in the EIP-6110 request layout:
+// pubkey (48), withdrawal credentials (32), amount in gwei (8, little endian),
+// signature (96) and index (8, little endian). Deposits whose signature does not
+// prove possession of the key are rejected.
+func parseDepositRequest(request []byte) (*Deposit, error) {
+	credentials := request[48:80]
+
+	// Only execution address credentials (0x01 prefix, 11 zero bytes, address)
+	// name an account that can act as a validator here
+	if credentials[0] != 0x01 || !bytesAllZero(credentials[1:12]) {
+		return nil, errInvalidCredentials
+	}
+	if err := verifyDepositSignature(request[:48], credentials, request[80:88], request[88:184]); err != nil {
+		return nil, err
+	}
+	amount := new(big.Int).SetUint64(binary.LittleEndian.Uint64(request[80:88]))
+	amount.Mul(amount, big.NewInt(1e9))
+
+	return &Deposit{
+		Validator: common.BytesToAddress(credentials[12:]),
+		PublicKey: common.CopyBytes(request[:48]),
+		Amount:    amount,
+		Index:     binary.LittleEndian.Uint64(request[184:192]),
+	}, nil
+}
+
+// depositSigningRoot returns the root signed by a deposit: the SSZ root of the
+// deposit message mixed with the deposit domain. The amount is in gwei, little
+// endian, as laid out in the deposit request.
+func depositSigningRoot(pubkey, credentials, amount []byte) [32]byte {
+	var pubkeyChunks [64]byte
+	copy(pubkeyChunks[:], pubkey)
+	pubkeyRoot := sha256.Sum256(pubkeyChunks[:])
+
+	var amountChunk [32]byte
+	copy(amountChunk[:], amount)
+	left := sha256.Sum256(append(pubkeyRoot[:], credentials...))
+	right := sha256.Sum256(append(amountChunk[:], make([]byte, 32)...))
+	messageRoot := sha256.Sum256(append(left[:], right[:]...))
+
+	// The fork data root of the genesis fork version and an empty genesis
+	// validators root
+	forkDataRoot := sha256.Sum256(make([]byte, 64))
+	var domain [32]byte
+	copy(domain[:], depositDomainType[:])
+	copy(domain[4:], forkDataRoot[:28])
+
+	return sha256.Sum256(append(messageRoot[:], domain[:]...))
+}
+
+// verifyDepositSignature checks that the signature of a deposit proves the
+// possession of the deposited key.
+func verifyDepositSignature(pubkey, credentials, amount, signature []byte) error {
+	pk, ok := decodeG1(pubkey)
+	if !ok {
+		return errInvalidBLSPublicKey
+	}
+	sig, ok := decodeG2(signature)
+	if !ok {
+		return errInvalidDepositSig
+	}
+	root := depositSigningRoot(pubkey, credentials, amount)
+	h, err := bls12381.HashToG2(root[:], depositDST)
+	if err != nil {
+		return err
+	}
+	// e(pk, H(m)) == e(G1, sig)
+	var negG1 bls12381.G1Affine
+	_, _, g1, _ := bls12381.Generators()
+	negG1.Neg(&g1)
+	ok, err = bls12381.PairingCheck([]bls12381.G1Affine{*pk, negG1}, []bls12381.G2Affine{h, *sig})
+	if err != nil || !ok {
+		return errInvalidDepositSig
+	}
+	return nil
+}
+
+// bytesAllZero checks whether all bytes of b are zero.
+func bytesAllZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
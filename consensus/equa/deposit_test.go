@@ -0,0 +1,327 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/equa/go-equa/accounts/abi"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+	"github.com/equa/go-equa/trie"
+	"github.com/equa/go-equa/trie/trienode"
+	"github.com/equa/go-equa/triedb"
+)
+
+// depositKeys derives the BLS key of a validator, returning its secret and its
+// public key.
+func depositKeys(validator common.Address) (*big.Int, []byte) {
+	var secret fr.Element
+	secret.SetBytes(crypto.Keccak256(validator.Bytes()))
+
+	var pk bls12381.G1Affine
+	pk.ScalarMultiplicationBase(secret.BigInt(new(big.Int)))
+	enc := pk.Bytes()
+	return secret.BigInt(new(big.Int)), enc[:]
+}
+
+// signDeposit signs a deposit message with the given BLS secret.
+func signDeposit(t *testing.T, secret *big.Int, pubkey, credentials, amount []byte) []byte {
+	t.Helper()
+
+	root := depositSigningRoot(pubkey, credentials, amount)
+	h, err := bls12381.HashToG2(root[:], depositDST)
+	if err != nil {
+		t.Fatalf("failed to hash deposit: %v", err)
+	}
+	var sig bls12381.G2Affine
+	sig.ScalarMultiplication(&h, secret)
+	enc := sig.Bytes()
+	return enc[:]
+}
+
+// makeDepositLog creates a DepositEvent log crediting the given amount of gwei
+// to the validator, as emitted by the deposit contract, signed with the key of
+// the validator.
+func makeDepositLog(t *testing.T, contract, validator common.Address, gwei, index uint64) *types.Log {
+	t.Helper()
+
+	var (
+		secret, pubkey = depositKeys(validator)
+		credentials    = append(append([]byte{0x01}, make([]byte, 11)...), validator.Bytes()...)
+		amount         = binary.LittleEndian.AppendUint64(nil, gwei)
+	)
+	return packDepositLog(t, contract, pubkey, credentials, amount, signDeposit(t, secret, pubkey, credentials, amount), index)
+}
+
+// packDepositLog creates a DepositEvent log with the given fields, as emitted by
+// the deposit contract.
+func packDepositLog(t *testing.T, contract common.Address, pubkey, credentials, amount, signature []byte, index uint64) *types.Log {
+	t.Helper()
+
+	bytesT, _ := abi.NewType("bytes", "", nil)
+	event := abi.NewMethod("DepositEvent", "DepositEvent", abi.Function, "", false, false, abi.Arguments{
+		{Name: "pubkey", Type: bytesT},
+		{Name: "withdrawal_credentials", Type: bytesT},
+		{Name: "amount", Type: bytesT},
+		{Name: "signature", Type: bytesT},
+		{Name: "index", Type: bytesT},
+	}, nil)
+	data, err := event.Inputs.Pack(pubkey, credentials, amount, signature, binary.LittleEndian.AppendUint64(nil, index))
+	if err != nil {
+		t.Fatalf("failed to pack deposit: %v", err)
+	}
+	return &types.Log{Address: contract, Topics: []common.Hash{depositTopic}, Data: data}
+}
+
+// Tests that deposits are only credited with a signature proving possession of
+// the deposited key, over the deposit message in the deposit domain.
+func TestDepositSignature(t *testing.T) {
+	var (
+		contract       = common.HexToAddress("0x00000000000000000000000000000000000d3905")
+		validator      = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		forger         = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		secret, pubkey = depositKeys(validator)
+		forgerKey, _   = depositKeys(forger)
+		credentials    = append(append([]byte{0x01}, make([]byte, 11)...), validator.Bytes()...)
+		amount         = binary.LittleEndian.AppendUint64(nil, 32_000_000_000)
+	)
+	if _, err := depositFromLog(makeDepositLog(t, contract, validator, 32_000_000_000, 0), contract); err != nil {
+		t.Fatalf("signed deposit rejected: %v", err)
+	}
+	other := append(append([]byte{0x01}, make([]byte, 11)...), forger.Bytes()...)
+	forged := map[string]*types.Log{
+		"no signature":     packDepositLog(t, contract, pubkey, credentials, amount, make([]byte, 96), 0),
+		"other key":        packDepositLog(t, contract, pubkey, credentials, amount, signDeposit(t, forgerKey, pubkey, credentials, amount), 1),
+		"other amount":     packDepositLog(t, contract, pubkey, credentials, binary.LittleEndian.AppendUint64(nil, 1), signDeposit(t, secret, pubkey, credentials, amount), 2),
+		"other credential": packDepositLog(t, contract, pubkey, other, amount, signDeposit(t, secret, pubkey, credentials, amount), 3),
+	}
+	engine := newTestEngine(t, 32)
+	config := newTestChainConfig(engine.config)
+	config.DepositContractAddress = contract
+	header := &types.Header{Number: big.NewInt(1)}
+	chain := &testHeaderChain{config: config, headers: []*types.Header{header}}
+
+	for name, event := range forged {
+		if _, err := depositFromLog(event, contract); !errors.Is(err, errInvalidDepositSig) {
+			t.Errorf("%s: have %v, want %v", name, err, errInvalidDepositSig)
+		}
+		statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		receipts := []*types.Receipt{{Logs: []*types.Log{event}}}
+		if credited := engine.creditDeposits(chain, header, statedb, receipts); credited != 0 {
+			t.Errorf("%s: forged deposit credited", name)
+		}
+		for _, addr := range []common.Address{validator, forger} {
+			if reg := newValidatorRegistry(statedb, engine.config).get(addr); reg.status != registrationNone {
+				t.Errorf("%s: forged deposit registered %s", name, addr)
+			}
+		}
+	}
+}
+
+// Tests that deposits are only credited if their receipt is proven to be part
+// of the block, and only once.
+func TestVerifyDeposit(t *testing.T) {
+	var (
+		contract  = common.HexToAddress("0x00000000000000000000000000000000000d3905")
+		validator = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	)
+	receipts := types.Receipts{
+		{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*types.Log{}},
+		{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 90000, Logs: []*types.Log{
+			{Address: contract, Topics: []common.Hash{{0x01}}},
+			makeDepositLog(t, contract, validator, 32_000_000_000, 7),
+		}},
+	}
+	for _, receipt := range receipts {
+		receipt.Bloom = types.CreateBloom(receipt)
+	}
+	tr := trie.NewEmpty(triedb.NewDatabase(rawdb.NewMemoryDatabase(), nil))
+	for i := range receipts {
+		var buf bytes.Buffer
+		receipts.EncodeIndex(i, &buf)
+		tr.MustUpdate(rlp.AppendUint64(nil, uint64(i)), common.CopyBytes(buf.Bytes()))
+	}
+	header := &types.Header{Number: big.NewInt(1), ReceiptHash: tr.Hash()}
+	if want := types.DeriveSha(receipts, trie.NewStackTrie(nil)); header.ReceiptHash != want {
+		t.Fatalf("receipt root mismatch: have %x, want %x", header.ReceiptHash, want)
+	}
+	prove := func(index uint64, logIndex uint64) *DepositProof {
+		var nodes trienode.ProofList
+		if err := tr.Prove(rlp.AppendUint64(nil, index), &nodes); err != nil {
+			t.Fatalf("failed to prove receipt: %v", err)
+		}
+		proof := &DepositProof{BlockHash: header.Hash(), TxIndex: index, LogIndex: logIndex}
+		for _, node := range nodes {
+			proof.Proof = append(proof.Proof, hexutil.Bytes(node))
+		}
+		return proof
+	}
+	deposit, err := VerifyDeposit(header, prove(1, 1), contract)
+	if err != nil {
+		t.Fatalf("failed to verify deposit: %v", err)
+	}
+	if want := new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)); deposit.Validator != validator || deposit.Amount.Cmp(want) != 0 || deposit.Index != 7 {
+		t.Fatalf("deposit mismatch: have %+v", deposit)
+	}
+	// Proofs of other logs, other contracts or tampered receipts must fail
+	if _, err := VerifyDeposit(header, prove(1, 0), contract); !errors.Is(err, errNotDepositLog) {
+		t.Errorf("non-deposit log: have %v, want %v", err, errNotDepositLog)
+	}
+	if _, err := VerifyDeposit(header, prove(1, 1), common.HexToAddress("0xdead")); !errors.Is(err, errNotDepositLog) {
+		t.Errorf("foreign contract: have %v, want %v", err, errNotDepositLog)
+	}
+	tampered := prove(1, 1)
+	last := tampered.Proof[len(tampered.Proof)-1]
+	last[len(last)-1] ^= 0xff
+	if _, err := VerifyDeposit(header, tampered, contract); !errors.Is(err, errInvalidDepositProof) {
+		t.Errorf("tampered proof: have %v, want %v", err, errInvalidDepositProof)
+	}
+	moved := prove(0, 1)
+	moved.TxIndex = 1
+	if _, err := VerifyDeposit(header, moved, contract); !errors.Is(err, errInvalidDepositProof) {
+		t.Errorf("mismatched proof: have %v, want %v", err, errInvalidDepositProof)
+	}
+	// The deposit queues the validator exactly once, activating it at the next
+	// epoch boundary
+	engine := newTestEngine(t, 32)
+	config := newTestChainConfig(engine.config)
+	config.DepositContractAddress = contract
+	chain := &testHeaderChain{config: config, headers: []*types.Header{header}}
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	if credited := engine.creditDeposits(chain, header, statedb, receipts); credited != 1 {
+		t.Fatalf("credited deposits mismatch: have %d, want 1", credited)
+	}
+	registry := newValidatorRegistry(statedb, engine.config)
+	if reg := registry.get(validator); reg.status != registrationQueued || reg.stake.Cmp(deposit.Amount) != 0 {
+		t.Fatalf("depositor not queued: status %d, stake %v", reg.status, reg.stake)
+	}
+	if activated := registry.activate(1); len(activated) != 1 || registry.get(validator).status != registrationActive {
+		t.Fatalf("depositor not activated")
+	}
+	if credited := engine.creditDeposits(chain, header, statedb, receipts); credited != 0 {
+		t.Fatalf("replayed deposit credited")
+	}
+	if reg := registry.get(validator); reg.stake.Cmp(deposit.Amount) != 0 {
+		t.Fatalf("replayed deposit changed the stake: have %v, want %v", reg.stake, deposit.Amount)
+	}
+}
+
+// Tests that deposits emitted by the deposit contract are credited when the
+// block emitting them is imported, and only once.
+func TestImportDeposit(t *testing.T) {
+	var (
+		contract  = common.HexToAddress("0x00000000000000000000000000000000000d3905")
+		depositor = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		key, _    = crypto.GenerateKey()
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		engine    = newTestEngine(t, 32, validator)
+	)
+	// The deposit contract emits its calldata as a deposit event
+	code := append(append([]byte{byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.CALLDATACOPY), byte(vm.PUSH32)}, depositTopic[:]...),
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0, byte(vm.LOG1), byte(vm.STOP))
+
+	genesis := &core.Genesis{
+		Config: newTestChainConfig(engine.config),
+		Alloc: types.GenesisAlloc{
+			contract: {Code: code, Balance: new(big.Int)},
+			sender:   {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))},
+		},
+	}
+	genesis.Config.DepositContractAddress = contract
+
+	signer := types.LatestSigner(genesis.Config)
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, testImportEngine{engine}, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(validator)
+		data := makeDepositLog(t, contract, depositor, 32_000_000_000, 0).Data
+		b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{To: &contract, Gas: 100000, GasPrice: big.NewInt(params.GWei), Data: data}))
+	})
+	if queue := engine.stakeManager.ValidatorQueue(0); len(queue.Activation) != 0 {
+		t.Fatalf("deposit credited when assembling the block: %v", queue.Activation)
+	}
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), genesis, testImportEngine{engine}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	engine.loadValidators(chain)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block with deposit: %v", err)
+	}
+	engine.followChain(chain)
+	queue := engine.stakeManager.ValidatorQueue(0).Activation
+	if want := new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)); len(queue) != 1 || queue[0].Address != depositor || queue[0].Stake.Cmp(want) != 0 {
+		t.Fatalf("deposit not credited on import: %v", queue)
+	}
+	// The deposit is recorded in the state of the block, where a restarted node
+	// finds it
+	statedb, err := chain.StateAt(blocks[0].Root())
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	if reg := newValidatorRegistry(statedb, engine.config).get(depositor); reg.status != registrationQueued {
+		t.Fatalf("deposit not recorded in the state: status %d", reg.status)
+	}
+	restarted := NewStakeManager(engine.config)
+	restarted.load(statedb, blocks[0].Hash())
+	if queue := restarted.ValidatorQueue(0).Activation; len(queue) != 1 || queue[0].Address != depositor {
+		t.Fatalf("deposit not loaded from the state: %v", queue)
+	}
+	// Reorging onto a branch without the deposit drops it, reorging back
+	// credits it again, once
+	_, fork, _ := core.GenerateChainWithGenesis(genesis, testImportEngine{engine}, 2, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(validator)
+	})
+	if _, err := chain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to import fork: %v", err)
+	}
+	engine.followChain(chain)
+	if queue := engine.stakeManager.ValidatorQueue(0).Activation; len(queue) != 0 {
+		t.Fatalf("deposit of the abandoned branch kept: %v", queue)
+	}
+	_, blocks, _ = core.GenerateChainWithGenesis(genesis, testImportEngine{engine}, 3, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(validator)
+		if i == 0 {
+			data := makeDepositLog(t, contract, depositor, 32_000_000_000, 0).Data
+			b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{To: &contract, Gas: 100000, GasPrice: big.NewInt(params.GWei), Data: data}))
+		}
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to reorg back onto the deposit: %v", err)
+	}
+	engine.followChain(chain)
+	if queue := engine.stakeManager.ValidatorQueue(0).Activation; len(queue) != 1 || queue[0].Stake.Cmp(new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18))) != 0 {
+		t.Fatalf("deposit not credited once after the reorg: %v", queue)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+)
+
+var errInvalidDifficulty = errors.New("invalid difficulty")
+
+// With difficulty retargeting, the PoW difficulty of every block is derived
+// from the blocks of the retarget window before it, like the DAA of Bitcoin
+// Cash: the work done over the window is spread over the configured period per
+// block. Retargeting from the window average instead of the parent difficulty
+// keeps a run of fast or slow blocks from compounding the adjustments, and the
+// result is bounded around the average so a skewed timestamp cannot swing it.
+
+// calcDifficulty returns the PoW difficulty of the child of parent. Without
+// retargeting, or before the chain spans a full retarget window, it is the
+// configured difficulty.
+func (e *Equa) calcDifficulty(chain consensus.ChainHeaderReader, parent *types.Header) (*big.Int, error) {
+	window := e.config.RetargetWindow
+	if !e.config.FeatureEnabled(FeatureDifficultyRetargeting) || parent.Number.Uint64() < window {
+		return new(big.Int).SetUint64(e.config.PoWDifficulty), nil
+	}
+	// Sum up the difficulty of the blocks in the window, ending at the parent
+	var (
+		work     = new(big.Int)
+		ancestor = parent
+	)
+	for i := uint64(0); i < window; i++ {
+		work.Add(work, ancestor.Difficulty)
+		if ancestor = chain.GetHeader(ancestor.ParentHash, ancestor.Number.Uint64()-1); ancestor == nil {
+			return nil, consensus.ErrUnknownAncestor
+		}
+	}
+	timespan := parent.Time - ancestor.Time // Timestamps are strictly increasing
+
+	difficulty := new(big.Int).Mul(work, new(big.Int).SetUint64(e.config.Period))
+	difficulty.Div(difficulty, new(big.Int).SetUint64(timespan))
+
+	// Bound the change around the window average
+	average := new(big.Int).Div(work, new(big.Int).SetUint64(window))
+	if upper := mulDiv(average, 100+e.config.RetargetMaxChange, 100); difficulty.Cmp(upper) > 0 {
+		difficulty = upper
+	} else if lower := mulDiv(average, 100-e.config.RetargetMaxChange, 100); difficulty.Cmp(lower) < 0 {
+		difficulty = lower
+	}
+	// Keep the difficulty solvable and representable by the PoW engine
+	if difficulty.Cmp(new(big.Int).SetUint64(e.config.MinPoWDifficulty)) < 0 {
+		difficulty.SetUint64(e.config.MinPoWDifficulty)
+	}
+	if !difficulty.IsUint64() {
+		difficulty.SetUint64(math.MaxUint64)
+	}
+	return difficulty, nil
+}
+
+// verifyDifficulty checks that a header carries the difficulty retargeted from
+// its ancestors.
+func (e *Equa) verifyDifficulty(chain consensus.ChainHeaderReader, header, parent *types.Header) error {
+	want, err := e.calcDifficulty(chain, parent)
+	if err != nil {
+		return err
+	}
+	if header.Difficulty == nil || header.Difficulty.Cmp(want) != 0 {
+		return errInvalidDifficulty
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/equa/go-equa/common/hexutil"
+)
+
+// The distributed key generation lets validators create threshold key shares
+// without anyone learning the secret key. Every participant deals a random
+// polynomial of degree k-1, publishing commitments to its coefficients in G2
+// and handing each participant the polynomial evaluated at their index over a
+// private channel. Each participant checks the shares it received against the
+// commitments and sums them into its key share, while the master public key is
+// the sum of the committed constant terms. The secret is the sum of the dealt
+// constant terms, so it stays unknown as long as one dealer was honest.
+
+var (
+	errInvalidDealing   = errors.New("invalid DKG dealing")
+	errInvalidDKGShare  = errors.New("DKG share does not match the dealer's commitments")
+	errMissingDKGShare  = errors.New("missing DKG share")
+	errDuplicateDealing = errors.New("duplicate DKG dealer")
+)
+
+// DKGDealing is a participant's contribution to the distributed key generation.
+// The commitments are published to all participants, the shares are delivered
+// to their recipients only.
+type DKGDealing struct {
+	Dealer      uint64          `json:"dealer"`      // Share index of the dealing participant
+	Commitments []hexutil.Bytes `json:"commitments"` // Coefficients of the dealt polynomial times G2
+
+	coeffs []fr.Element // Dealt polynomial, kept by the dealer only
+}
+
+// NewDKGDealing deals a random polynomial for a threshold of k out of n shares
+// on behalf of the participant with the given share index.
+func NewDKGDealing(dealer uint64, n, k int) (*DKGDealing, error) {
+	if k < 1 || k > n || dealer == 0 || dealer > uint64(n) {
+		return nil, fmt.Errorf("%w: dealer %d, %d of %d", errInvalidThreshold, dealer, k, n)
+	}
+	coeffs, err := randomPolynomial(k)
+	if err != nil {
+		return nil, err
+	}
+	dealing := &DKGDealing{Dealer: dealer, coeffs: coeffs}
+	for i := range coeffs {
+		var c bls12381.G2Affine
+		c.ScalarMultiplicationBase(coeffs[i].BigInt(new(big.Int)))
+		enc := c.Bytes()
+		dealing.Commitments = append(dealing.Commitments, enc[:])
+	}
+	return dealing, nil
+}
+
+// Share returns the secret share dealt to the participant with the given index,
+// to be sent to it privately.
+func (d *DKGDealing) Share(recipient uint64) []byte {
+	share := evalPolynomial(d.coeffs, recipient)
+	enc := share.Bytes()
+	return enc[:]
+}
+
+// commitment evaluates the committed polynomial at x in the exponent, giving
+// the public key of the share dealt to participant x.
+func (d *DKGDealing) commitment(x uint64) (*bls12381.G2Affine, error) {
+	if len(d.Commitments) == 0 {
+		return nil, errInvalidDealing
+	}
+	var (
+		sum   bls12381.G2Affine
+		power = big.NewInt(1)
+		xb    = new(big.Int).SetUint64(x)
+	)
+	for _, enc := range d.Commitments {
+		c, ok := decodeG2(enc)
+		if !ok {
+			return nil, fmt.Errorf("%w: dealer %d commitment", errInvalidDealing, d.Dealer)
+		}
+		var term bls12381.G2Affine
+		term.ScalarMultiplication(c, power)
+		sum.Add(&sum, &term)
+
+		power.Mul(power, xb)
+		power.Mod(power, fr.Modulus())
+	}
+	return &sum, nil
+}
+
+// VerifyShare checks a share received from the dealer against its published
+// commitments. Participants complain about dealers whose shares fail, and the
+// ceremony is restarted without them.
+func (d *DKGDealing) VerifyShare(recipient uint64, share []byte) error {
+	var s fr.Element
+	if err := s.SetBytesCanonical(share); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidDKGShare, err)
+	}
+	want, err := d.commitment(recipient)
+	if err != nil {
+		return err
+	}
+	var have bls12381.G2Affine
+	have.ScalarMultiplicationBase(s.BigInt(new(big.Int)))
+	if !have.Equal(want) {
+		return errInvalidDKGShare
+	}
+	return nil
+}
+
+// FinishDKG completes the key generation for the participant with the given
+// index. It verifies the shares received from every dealer, keyed by dealer,
+// and returns the participant's key share and the master public key.
+func FinishDKG(index uint64, dealings []*DKGDealing, shares map[uint64][]byte) ([]byte, []byte, error) {
+	var secret fr.Element
+	for _, dealing := range dealings {
+		share, ok := shares[dealing.Dealer]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: dealer %d", errMissingDKGShare, dealing.Dealer)
+		}
+		if err := dealing.VerifyShare(index, share); err != nil {
+			return nil, nil, fmt.Errorf("dealer %d: %w", dealing.Dealer, err)
+		}
+		var s fr.Element
+		s.SetBytesCanonical(share)
+		secret.Add(&secret, &s)
+	}
+	publicKey, err := DKGPublicKey(dealings)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyShare := &KeyShare{Index: index, secret: secret}
+	return keyShare.Bytes(), publicKey, nil
+}
+
+// DKGPublicKey derives the master public key from the dealings of a ceremony.
+func DKGPublicKey(dealings []*DKGDealing) ([]byte, error) {
+	return sumCommitments(dealings, 0)
+}
+
+// DKGPublicShare derives the public key of a participant's key share from the
+// dealings of a ceremony, used to verify its decryption and signature shares.
+func DKGPublicShare(dealings []*DKGDealing, index uint64) ([]byte, error) {
+	return sumCommitments(dealings, index)
+}
+
+// sumCommitments sums the committed polynomials of all dealings at x.
+func sumCommitments(dealings []*DKGDealing, x uint64) ([]byte, error) {
+	if len(dealings) == 0 {
+		return nil, errInvalidDealing
+	}
+	var (
+		sum  bls12381.G2Affine
+		seen = make(map[uint64]bool)
+	)
+	for _, dealing := range dealings {
+		if seen[dealing.Dealer] {
+			return nil, fmt.Errorf("%w: %d", errDuplicateDealing, dealing.Dealer)
+		}
+		seen[dealing.Dealer] = true
+
+		if len(dealing.Commitments) != len(dealings[0].Commitments) {
+			return nil, fmt.Errorf("%w: dealer %d threshold mismatch", errInvalidDealing, dealing.Dealer)
+		}
+		point, err := dealing.commitment(x)
+		if err != nil {
+			return nil, err
+		}
+		sum.Add(&sum, point)
+	}
+	enc := sum.Bytes()
+	return enc[:], nil
+}
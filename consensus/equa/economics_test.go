@@ -0,0 +1,269 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// behavior is the strategy a simulated validator follows when proposing.
+type behavior int
+
+const (
+	honest     behavior = iota // Proposes fairly ordered blocks
+	mevSeeking                 // Extracts MEV from its own blocks whenever possible
+	offline                    // Never proposes
+)
+
+func (b behavior) String() string {
+	switch b {
+	case honest:
+		return "honest"
+	case mevSeeking:
+		return "mev-seeking"
+	case offline:
+		return "offline"
+	}
+	return "unknown"
+}
+
+// economicsScenario describes a validator population and the MEV environment
+// it operates in.
+type economicsScenario struct {
+	name   string
+	mix    map[behavior]int // Number of validators following each behavior
+	epochs uint64           // Number of epochs to simulate
+
+	mevChance    float64  // Probability that a mev-seeking proposer finds MEV in its block
+	mevProfit    *big.Int // MEV extracted from a block when found, in wei
+	detectChance float64  // Probability that the extraction is detected and slashed
+}
+
+// economicsResult aggregates the outcome for all validators of one behavior.
+type economicsResult struct {
+	validators int
+	stake      *big.Int // Initial stake of all validators
+	earned     *big.Int // Protocol rewards credited to the validators
+	extracted  *big.Int // Undetected MEV kept outside the protocol
+	slashed    *big.Int // Stake lost to slashing
+	slashings  int      // Number of validators slashed at least once
+}
+
+// net returns the total gain of the behavior group, including MEV kept outside
+// the protocol and stake lost to slashing.
+func (r *economicsResult) net() *big.Int {
+	net := new(big.Int).Add(r.earned, r.extracted)
+	return net.Sub(net, r.slashed)
+}
+
+// apr returns the annualised return of the behavior group relative to its
+// initial stake, in percent.
+func (r *economicsResult) apr(seconds uint64) float64 {
+	if r.stake.Sign() == 0 || seconds == 0 {
+		return 0
+	}
+	ratio := new(big.Float).Quo(new(big.Float).SetInt(r.net()), new(big.Float).SetInt(r.stake))
+	year := new(big.Float).SetFloat64(365 * 24 * 3600 / float64(seconds))
+	apr, _ := ratio.Mul(ratio, year).Float64()
+	return apr * 100
+}
+
+// sampleProposer picks a proposer among the given validators with probability
+// proportional to stake, modelling the long-run expectation of the proposer
+// schedule independently of its per-block randomness.
+func sampleProposer(rng *rand.Rand, validators []*Validator) common.Address {
+	milli := big.NewInt(1e15)
+
+	var total int64
+	weights := make([]int64, len(validators))
+	for i, validator := range validators {
+		weights[i] = new(big.Int).Div(validator.Stake, milli).Int64()
+		total += weights[i]
+	}
+	pick := rng.Int63n(total)
+	for i, weight := range weights {
+		if pick < weight {
+			return validators[i].Address
+		}
+		pick -= weight
+	}
+	return validators[len(validators)-1].Address
+}
+
+// simulateEconomics runs the scenario against the real reward, MEV burn and
+// slashing code of the engine with stake-proportional proposer sampling,
+// returning the per-behavior results and the simulated duration in seconds.
+func simulateEconomics(t *testing.T, scenario economicsScenario) (map[behavior]*economicsResult, uint64) {
+	t.Helper()
+
+	config := *params.EquaMainnetChainConfig.Equa
+	config.Epoch = 10
+	engine := New(newTestChainConfig(&config), rawdb.NewMemoryDatabase())
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	stake := new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18))
+
+	var (
+		behaviors = make(map[common.Address]behavior)
+		results   = make(map[behavior]*economicsResult)
+		rng       = rand.New(rand.NewSource(1))
+		index     = 0
+	)
+	for _, b := range []behavior{honest, mevSeeking, offline} {
+		results[b] = &economicsResult{
+			stake:     new(big.Int),
+			earned:    new(big.Int),
+			extracted: new(big.Int),
+			slashed:   new(big.Int),
+		}
+		for i := 0; i < scenario.mix[b]; i++ {
+			index++
+			addr := common.BigToAddress(big.NewInt(int64(index)))
+			if err := engine.stakeManager.AddValidator(addr, stake, nil); err != nil {
+				t.Fatalf("failed to add validator: %v", err)
+			}
+			behaviors[addr] = b
+			results[b].validators++
+			results[b].stake.Add(results[b].stake, stake)
+		}
+	}
+	blocks := scenario.epochs * config.Epoch
+	for number := uint64(1); number <= blocks; number++ {
+		proposer := sampleProposer(rng, engine.stakeManager.GetTopStakers(len(behaviors)))
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Coinbase: proposer}
+
+		switch behaviors[proposer] {
+		case offline:
+			continue
+
+		case mevSeeking:
+			if rng.Float64() >= scenario.mevChance {
+				break
+			}
+			if rng.Float64() >= scenario.detectChance {
+				results[mevSeeking].extracted.Add(results[mevSeeking].extracted, scenario.mevProfit)
+				break
+			}
+			// Detected extraction is burned and the proposer slashed
+			engine.distributeMEV(header, statedb, scenario.mevProfit)
+
+			validator, _ := engine.stakeManager.GetValidator(proposer)
+			before := new(big.Int).Set(validator.Stake)
+			if err := slashTestValidator(engine.stakeManager, proposer, config.SlashingPercentage); err != nil {
+				t.Fatalf("block %d: failed to slash: %v", number, err)
+			}
+			validator, _ = engine.stakeManager.GetValidator(proposer)
+			results[mevSeeking].slashed.Add(results[mevSeeking].slashed, before.Sub(before, validator.Stake))
+			results[mevSeeking].slashings++
+		}
+		engine.applyBlockRewards(header, statedb)
+	}
+	for addr, b := range behaviors {
+		results[b].earned.Add(results[b].earned, statedb.GetBalance(addr).ToBig())
+	}
+	return results, blocks * config.Period
+}
+
+// Tests the reward and penalty economics of the engine over thousands of
+// simulated epochs, reporting expected APR, slashing risk and the profitability
+// of MEV extraction for various validator behavior mixes.
+func TestEconomicsSimulation(t *testing.T) {
+	ether := big.NewInt(1e18)
+
+	tests := []struct {
+		scenario   economicsScenario
+		mevLoses   bool // Whether MEV extraction must be less profitable than honesty
+		offlineNil bool // Whether offline validators must earn nothing
+	}{
+		{
+			scenario: economicsScenario{
+				name:         "honest majority, strong detection",
+				mix:          map[behavior]int{honest: 12, mevSeeking: 2, offline: 1},
+				epochs:       1000,
+				mevChance:    0.5,
+				mevProfit:    new(big.Int).Mul(big.NewInt(5), ether),
+				detectChance: 0.9,
+			},
+			mevLoses:   true,
+			offlineNil: true,
+		},
+		{
+			scenario: economicsScenario{
+				name:         "large cartel, strong detection",
+				mix:          map[behavior]int{honest: 5, mevSeeking: 5, offline: 5},
+				epochs:       1000,
+				mevChance:    0.5,
+				mevProfit:    new(big.Int).Mul(big.NewInt(5), ether),
+				detectChance: 0.9,
+			},
+			mevLoses:   true,
+			offlineNil: true,
+		},
+		{
+			scenario: economicsScenario{
+				name:         "weak detection",
+				mix:          map[behavior]int{honest: 10, mevSeeking: 5},
+				epochs:       1000,
+				mevChance:    0.5,
+				mevProfit:    new(big.Int).Mul(big.NewInt(5), ether),
+				detectChance: 0.01,
+			},
+		},
+	}
+	for _, tt := range tests {
+		results, seconds := simulateEconomics(t, tt.scenario)
+
+		var table strings.Builder
+		fmt.Fprintf(&table, "%s (%d epochs):\n", tt.scenario.name, tt.scenario.epochs)
+		fmt.Fprintf(&table, "  %-12s %10s %14s %12s %10s\n", "behavior", "validators", "net/validator", "APR", "slashed")
+		for _, b := range []behavior{honest, mevSeeking, offline} {
+			r := results[b]
+			if r.validators == 0 {
+				continue
+			}
+			perValidator := new(big.Int).Div(r.net(), big.NewInt(int64(r.validators)))
+			perValidator.Div(perValidator, ether)
+			fmt.Fprintf(&table, "  %-12s %10d %14v %11.1f%% %9.0f%%\n", b, r.validators, perValidator,
+				r.apr(seconds), 100*float64(r.slashings)/float64(r.validators))
+		}
+		t.Log(table.String())
+
+		if results[honest].earned.Sign() <= 0 {
+			t.Errorf("%s: honest validators earned nothing", tt.scenario.name)
+		}
+		if tt.offlineNil && results[offline].earned.Sign() != 0 {
+			t.Errorf("%s: offline validators earned %v", tt.scenario.name, results[offline].earned)
+		}
+		if tt.mevLoses {
+			honestNet := new(big.Int).Mul(results[honest].net(), big.NewInt(int64(results[mevSeeking].validators)))
+			mevNet := new(big.Int).Mul(results[mevSeeking].net(), big.NewInt(int64(results[honest].validators)))
+			if mevNet.Cmp(honestNet) >= 0 {
+				t.Errorf("%s: MEV extraction profitable: %v vs honest %v", tt.scenario.name, results[mevSeeking].net(), results[honest].net())
+			}
+		}
+	}
+}
@@ -0,0 +1,682 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/common/lru"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/event"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+)
+
+// Encrypted transactions follow a commit-reveal flow. The sender encrypts its
+// transaction under the threshold public key and submits it as the data of an
+// envelope transaction, which is ordered and committed in a block like any
+// other. Only then do the key share holders publish their decryption shares, a
+// threshold of which reveals the transaction. Every node combining the shares
+// checks that the revealed transaction is included within the reveal window,
+// so a proposer censoring it or share holders withholding the decryption are
+// detected.
+
+const (
+	encryptedRevealWindow    = 8                // Blocks after its commitment an encrypted transaction must be included within
+	encryptedRetention       = 256              // Blocks a committed envelope is tracked for
+	encryptedPendingLifetime = 10 * time.Minute // Time after which an uncommitted envelope is dropped
+	maxEncryptedEnvelopes    = 4096             // Maximum number of tracked envelopes
+	maxEncryptedPayload      = 64 * 1024        // Maximum size of the ciphertext of a submitted envelope
+	maxIncludedTxs           = 65536            // Transactions of recent blocks remembered to detect reveals
+
+	// violationShareWithholding is the slashing violation for not publishing
+	// the decryption share of an envelope that was withheld as a result.
+	violationShareWithholding = "Decryption share withholding"
+)
+
+// Stages of an envelope in the commit-reveal flow.
+const (
+	encryptedStatusPending   = "pending"   // Submitted, not committed in a block yet
+	encryptedStatusCommitted = "committed" // Committed, awaiting a threshold of decryption shares
+	encryptedStatusDecrypted = "decrypted" // Decrypted, awaiting inclusion of the transaction
+	encryptedStatusRevealed  = "revealed"  // Transaction included within the reveal window
+	encryptedStatusLate      = "late"      // Transaction included after the reveal window
+	encryptedStatusInvalid   = "invalid"   // Decrypted to something other than a transaction
+	encryptedStatusWithheld  = "withheld"  // Not enough decryption shares within the reveal window
+	encryptedStatusCensored  = "censored"  // Decrypted, but the transaction was not included within the reveal window
+)
+
+var (
+	errEncryptedMempoolDisabled = errors.New("encrypted mempool not enabled")
+	errEncryptedPoolFull        = errors.New("encrypted transaction pool full")
+	errEncryptedTooLarge        = errors.New("encrypted transaction too large")
+	errEnvelopeUnderpriced      = errors.New("envelope fee cap below base fee")
+	errUnknownEncryptedTx       = errors.New("unknown encrypted transaction")
+	errInvalidDecryptionSig     = errors.New("invalid decryption share signature")
+)
+
+// EncryptedSubmitFn is a callback to add a transaction to the transaction pool.
+type EncryptedSubmitFn func(tx *types.Transaction) error
+
+// encryptedPayload returns the ciphertext carried by an envelope transaction.
+func encryptedPayload(tx *types.Transaction) ([]byte, bool) {
+	data := tx.Data()
+	if len(data) <= len(encryptedTxMarker) || string(data[:len(encryptedTxMarker)]) != encryptedTxMarker {
+		return nil, false
+	}
+	return data[len(encryptedTxMarker):], true
+}
+
+// DecryptionShare is a key share holder's contribution to the decryption of an
+// envelope committed in a block, signed with its validator account so that the
+// holders withholding their shares can be told apart.
+type DecryptionShare struct {
+	Validator common.Address `json:"validator"`
+	Envelope  common.Hash    `json:"envelope"`  // Hash of the envelope transaction
+	Share     hexutil.Bytes  `json:"share"`     // Share index and decryption share
+	Signature hexutil.Bytes  `json:"signature"` // Signature over decryptionShareSigData by the validator
+}
+
+// decryptionShareSigData returns the data signed by a validator for a decryption
+// share. The signature is made over its Keccak256 hash.
+func decryptionShareSigData(validator common.Address, envelope common.Hash, share []byte) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{validator, envelope, share})
+	return append([]byte("equa-decryption-share"), enc...)
+}
+
+// Verify checks that the share was signed by the validator it names.
+func (s *DecryptionShare) Verify() error {
+	if len(s.Signature) != crypto.SignatureLength {
+		return errInvalidDecryptionSig
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(decryptionShareSigData(s.Validator, s.Envelope, s.Share)), s.Signature)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != s.Validator {
+		return errInvalidDecryptionSig
+	}
+	return nil
+}
+
+// EncryptedTransaction is the progress of an envelope through the commit-reveal
+// flow, as reported over the API.
+type EncryptedTransaction struct {
+	Hash        common.Hash      `json:"hash"`                  // Hash of the envelope transaction
+	Status      string           `json:"status"`                // Stage of the flow, see the encryptedStatus constants
+	BlockNumber uint64           `json:"blockNumber,omitempty"` // Block committing the envelope
+	BlockHash   common.Hash      `json:"blockHash,omitempty"`
+	Shares      []common.Address `json:"shares"`                // Share holders that published their decryption share
+	Missing     []common.Address `json:"missing"`               // Share holders that did not
+	Transaction *common.Hash     `json:"transaction,omitempty"` // Hash of the revealed transaction
+	RevealedIn  uint64           `json:"revealedIn,omitempty"`  // Block the revealed transaction was included in
+}
+
+// encryptedEnvelope is the state of a tracked envelope.
+type encryptedEnvelope struct {
+	tx       *types.Transaction                  // Envelope, nil if only known from decryption shares
+	number   uint64                              // Block committing the envelope, zero if uncommitted
+	block    common.Hash                         // Hash of the committing block
+	shares   map[common.Address]*DecryptionShare // Decryption shares by share holder
+	inner    *types.Transaction                  // Revealed transaction, nil until decrypted
+	invalid  bool                                // Whether the envelope decrypted to garbage
+	reported bool                                // Whether the share holders withholding it were reported
+	added    time.Time
+}
+
+// EncryptedPool tracks envelopes from their submission or commitment until
+// their reveal, along with the decryption shares published for them.
+type EncryptedPool struct {
+	threshold *ThresholdCrypto
+	holders   []common.Address // Share holders by share index minus one
+
+	envelopes map[common.Hash]*encryptedEnvelope
+	included  lru.BasicLRU[common.Hash, uint64] // Blocks recent transactions were included in
+	scanned   uint64                            // Latest block scanned for envelopes and reveals
+	following bool                              // Whether the chain is followed, see since
+	since     uint64                            // Head when the chain started to be followed
+	keyShare  *KeyShare                         // Key share of the local validator, nil if none
+	submit    EncryptedSubmitFn                 // Adds transactions to the pool, nil until started
+	feed      event.Feed                        // Newly accepted decryption shares, to be gossiped
+	lock      sync.Mutex
+}
+
+// NewEncryptedPool creates an empty pool for envelopes encrypted under the
+// threshold key of the initial validators, which hold its shares.
+func NewEncryptedPool(config *params.EquaConfig, threshold *ThresholdCrypto) *EncryptedPool {
+	holders := make([]common.Address, len(config.InitialValidators))
+	for i, validator := range config.InitialValidators {
+		holders[i] = validator.Address
+	}
+	return &EncryptedPool{
+		threshold: threshold,
+		holders:   holders,
+		envelopes: make(map[common.Hash]*encryptedEnvelope),
+		included:  lru.NewBasicLRU[common.Hash, uint64](maxIncludedTxs),
+	}
+}
+
+// holder returns the validator holding the key share with the given index.
+func (p *EncryptedPool) holder(index uint64) (common.Address, bool) {
+	if index == 0 || index > uint64(len(p.holders)) {
+		return common.Address{}, false
+	}
+	return p.holders[index-1], true
+}
+
+// envelope returns the tracked envelope with the given hash, starting to track
+// it if there is room. The lock must be held.
+func (p *EncryptedPool) envelope(hash common.Hash) (*encryptedEnvelope, error) {
+	if env, ok := p.envelopes[hash]; ok {
+		return env, nil
+	}
+	if len(p.envelopes) >= maxEncryptedEnvelopes {
+		return nil, errEncryptedPoolFull
+	}
+	env := &encryptedEnvelope{shares: make(map[common.Address]*DecryptionShare), added: time.Now()}
+	p.envelopes[hash] = env
+	return env, nil
+}
+
+// Add validates an envelope submitted for inclusion and starts tracking it.
+// Committed envelopes are tracked whatever their size, the limit only applies to
+// submissions.
+func (p *EncryptedPool) Add(tx *types.Transaction) error {
+	ciphertext, ok := encryptedPayload(tx)
+	if !ok {
+		return errNotEncryptedTx
+	}
+	if len(ciphertext) > maxEncryptedPayload {
+		return fmt.Errorf("%w: %d bytes, limit %d", errEncryptedTooLarge, len(ciphertext), maxEncryptedPayload)
+	}
+	if tx.Type() == types.BlobTxType {
+		return fmt.Errorf("%w: blob transaction", errInvalidCiphertext)
+	}
+	if _, err := ciphertextPoint(ciphertext); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	env, err := p.envelope(tx.Hash())
+	if err != nil {
+		return err
+	}
+	env.tx = tx
+	return nil
+}
+
+// AddShares stores the valid decryption shares of share holders, returning the
+// ones that were not known before.
+func (p *EncryptedPool) AddShares(shares []*DecryptionShare) []*DecryptionShare {
+	valid := make([]*DecryptionShare, 0, len(shares))
+	for _, s := range shares {
+		index, _, err := decodeIndexedPoint(s.Share)
+		if err != nil {
+			continue
+		}
+		if holder, ok := p.holder(index); !ok || holder != s.Validator || s.Verify() != nil {
+			continue
+		}
+		valid = append(valid, s)
+	}
+	p.lock.Lock()
+	var added []*DecryptionShare
+	for _, s := range valid {
+		env, err := p.envelope(s.Envelope)
+		if err != nil {
+			break
+		}
+		if _, known := env.shares[s.Validator]; known {
+			continue
+		}
+		env.shares[s.Validator] = s
+		added = append(added, s)
+	}
+	p.lock.Unlock()
+
+	if len(added) > 0 {
+		p.feed.Send(added)
+	}
+	return added
+}
+
+// Subscribe subscribes to newly accepted decryption shares.
+func (p *EncryptedPool) Subscribe(ch chan<- []*DecryptionShare) event.Subscription {
+	return p.feed.Subscribe(ch)
+}
+
+// scan notes the envelopes committed in a block and the transactions it
+// includes. The lock must be held.
+func (p *EncryptedPool) scan(block *types.Block) {
+	number := block.NumberU64()
+	for _, tx := range block.Transactions() {
+		p.included.Add(tx.Hash(), number)
+
+		ciphertext, ok := encryptedPayload(tx)
+		if !ok {
+			continue
+		}
+		if _, err := ciphertextPoint(ciphertext); err != nil {
+			continue
+		}
+		env, err := p.envelope(tx.Hash())
+		if err != nil {
+			log.Debug("Dropping committed envelope", "hash", tx.Hash(), "err", err)
+			continue
+		}
+		env.tx, env.number, env.block = tx, number, block.Hash()
+	}
+	p.scanned = number
+}
+
+// decrypt combines the decryption shares of a committed envelope into the
+// revealed transaction. A share holder may publish a bad share to stall the
+// decryption, so with more shares than needed, each is left out in turn if
+// combining all of them fails. The lock must be held.
+func (p *EncryptedPool) decrypt(env *encryptedEnvelope) error {
+	ciphertext, _ := encryptedPayload(env.tx)
+
+	shares := make([][]byte, 0, len(env.shares))
+	for _, s := range env.shares {
+		shares = append(shares, s.Share)
+	}
+	plaintext, err := p.threshold.CombineDecryptionShares(ciphertext, shares)
+	for skip := 0; err != nil && len(shares) > p.threshold.threshold && skip < len(shares); skip++ {
+		plaintext, err = p.threshold.CombineDecryptionShares(ciphertext, slices.Delete(slices.Clone(shares), skip, skip+1))
+	}
+	if err != nil {
+		return err
+	}
+	inner := new(types.Transaction)
+	if err := inner.UnmarshalBinary(plaintext); err != nil {
+		env.invalid = true
+		return err
+	}
+	if _, nested := encryptedPayload(inner); nested {
+		env.invalid = true
+		return errInvalidCiphertext
+	}
+	env.inner = inner
+	return nil
+}
+
+// status reports the progress of an envelope given the current head. The lock
+// must be held.
+func (p *EncryptedPool) status(hash common.Hash, env *encryptedEnvelope, head uint64) *EncryptedTransaction {
+	status := &EncryptedTransaction{
+		Hash:        hash,
+		BlockNumber: env.number,
+		BlockHash:   env.block,
+		Shares:      []common.Address{},
+		Missing:     []common.Address{},
+	}
+	for _, holder := range p.holders {
+		if _, ok := env.shares[holder]; ok {
+			status.Shares = append(status.Shares, holder)
+		} else {
+			status.Missing = append(status.Missing, holder)
+		}
+	}
+	if env.inner != nil {
+		innerHash := env.inner.Hash()
+		status.Transaction = &innerHash
+		status.RevealedIn, _ = p.included.Peek(innerHash)
+	}
+	expired := env.number > 0 && head > env.number+encryptedRevealWindow
+	switch {
+	case env.number == 0:
+		status.Status = encryptedStatusPending
+	case env.invalid:
+		status.Status = encryptedStatusInvalid
+	case status.RevealedIn > env.number+encryptedRevealWindow:
+		status.Status = encryptedStatusLate
+	case status.RevealedIn > 0:
+		status.Status = encryptedStatusRevealed
+	case expired && env.inner != nil:
+		status.Status = encryptedStatusCensored
+	case expired:
+		status.Status = encryptedStatusWithheld
+	case env.inner != nil:
+		status.Status = encryptedStatusDecrypted
+	default:
+		status.Status = encryptedStatusCommitted
+	}
+	return status
+}
+
+// Get returns the progress of an envelope given the current head.
+func (p *EncryptedPool) Get(hash common.Hash, head uint64) (*EncryptedTransaction, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	env, ok := p.envelopes[hash]
+	if !ok || env.tx == nil {
+		return nil, errUnknownEncryptedTx
+	}
+	return p.status(hash, env, head), nil
+}
+
+// Unrevealed returns the committed envelopes whose transaction was not included
+// within the reveal window, either censored by the proposers or withheld by the
+// share holders, ordered by the block committing them.
+func (p *EncryptedPool) Unrevealed(head uint64) []*EncryptedTransaction {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var unrevealed []*EncryptedTransaction
+	for hash, env := range p.envelopes {
+		if env.tx == nil {
+			continue
+		}
+		status := p.status(hash, env, head)
+		if status.Status == encryptedStatusCensored || status.Status == encryptedStatusWithheld {
+			unrevealed = append(unrevealed, status)
+		}
+	}
+	slices.SortFunc(unrevealed, func(a, b *EncryptedTransaction) int {
+		if c := cmp.Compare(a.BlockNumber, b.BlockNumber); c != 0 {
+			return c
+		}
+		return a.Hash.Cmp(b.Hash)
+	})
+	return unrevealed
+}
+
+// expire drops the envelopes committed before the retention period and the
+// uncommitted ones past their lifetime. The lock must be held.
+func (p *EncryptedPool) expire(head uint64) {
+	for hash, env := range p.envelopes {
+		switch {
+		case env.number > 0 && env.number+encryptedRetention < head:
+			delete(p.envelopes, hash)
+		case env.number == 0 && time.Since(env.added) > encryptedPendingLifetime:
+			delete(p.envelopes, hash)
+		}
+	}
+}
+
+// UseKeyShare loads the threshold key share of the local validator from a file
+// holding it hex encoded, as written by the genesis ceremony. The validator
+// publishes decryption shares with it while the engine is authorized as the
+// share holder.
+func (e *Equa) UseKeyShare(file string) error {
+	blob, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	enc, err := hexutil.Decode(strings.TrimSpace(string(blob)))
+	if err != nil {
+		return fmt.Errorf("invalid key share %s: %v", file, err)
+	}
+	share, err := ParseKeyShare(enc)
+	if err != nil {
+		return fmt.Errorf("invalid key share %s: %v", file, err)
+	}
+	if _, ok := e.encrypted.holder(share.Index); !ok {
+		return fmt.Errorf("%w: index %d of %d", errInvalidKeyShare, share.Index, len(e.encrypted.holders))
+	}
+	e.encrypted.lock.Lock()
+	e.encrypted.keyShare = share
+	e.encrypted.lock.Unlock()
+	return nil
+}
+
+// SendEncryptedTransaction tracks an envelope and adds it to the transaction
+// pool, returning its hash. The fee of the encrypted transaction is unknown
+// until it is revealed, so the envelope itself must be includable at the given
+// base fee of the next block, nil before London. Envelopes waiting for the base
+// fee to drop would only outlive their tracking, see encryptedPendingLifetime.
+func (e *Equa) SendEncryptedTransaction(tx *types.Transaction, baseFee *big.Int) (common.Hash, error) {
+	if !e.featureEnabled(FeatureEncryptedMempool) {
+		return common.Hash{}, errEncryptedMempoolDisabled
+	}
+	if baseFee != nil && tx.GasFeeCapIntCmp(baseFee) < 0 {
+		return common.Hash{}, fmt.Errorf("%w: fee cap %v, base fee %v", errEnvelopeUnderpriced, tx.GasFeeCap(), baseFee)
+	}
+	e.encrypted.lock.Lock()
+	submit := e.encrypted.submit
+	e.encrypted.lock.Unlock()
+
+	if submit == nil {
+		return common.Hash{}, errEncryptedMempoolDisabled
+	}
+	if err := e.encrypted.Add(tx); err != nil {
+		return common.Hash{}, err
+	}
+	if err := submit(tx); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+// StartEncryptedMempool follows the canonical chain for committed envelopes,
+// publishing the decryption shares of the local validator and revealing the
+// envelopes with a threshold of shares into the transaction pool, until the
+// engine is closed. It does nothing unless the encrypted mempool is enabled.
+func (e *Equa) StartEncryptedMempool(chain consensus.ChainReader, submit EncryptedSubmitFn) {
+	if !e.featureEnabled(FeatureEncryptedMempool) {
+		return
+	}
+	e.encrypted.lock.Lock()
+	e.encrypted.submit = submit
+	e.encrypted.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(e.config.Period) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.processEncrypted(chain)
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// processEncrypted scans the canonical blocks added since the last round, then
+// shares in and reveals the decryption of the committed envelopes, reporting
+// the share holders withholding it.
+func (e *Equa) processEncrypted(chain consensus.ChainReader) {
+	head := chain.CurrentHeader()
+	if head == nil {
+		return
+	}
+	number := head.Number.Uint64()
+
+	p := e.encrypted
+	p.lock.Lock()
+	if !p.following {
+		p.following, p.since = true, number
+	}
+	first := p.scanned + 1
+	if number > encryptedRetention {
+		first = max(first, number-encryptedRetention)
+	}
+	for n := first; n <= number; n++ {
+		header := chain.GetHeaderByNumber(n)
+		if header == nil {
+			break
+		}
+		block := chain.GetBlock(header.Hash(), n)
+		if block == nil {
+			break
+		}
+		p.scan(block)
+	}
+	p.expire(number)
+
+	// Collect the envelopes awaiting the local share or the decryption
+	var (
+		share    = p.keyShare
+		holder   common.Address
+		pending  []*encryptedEnvelope
+		unshared []common.Hash
+	)
+	if share != nil {
+		holder, _ = p.holder(share.Index)
+	}
+	for hash, env := range p.envelopes {
+		if env.number == 0 || env.tx == nil || env.inner != nil || env.invalid {
+			continue
+		}
+		if share != nil {
+			if _, ok := env.shares[holder]; !ok {
+				unshared = append(unshared, hash)
+			}
+		}
+		pending = append(pending, env)
+	}
+	p.lock.Unlock()
+
+	if len(unshared) > 0 {
+		e.publishDecryptionShares(share, holder, unshared)
+	}
+	for _, env := range pending {
+		e.revealEncrypted(env)
+	}
+	e.reportWithholding(number)
+}
+
+// reportWithholding reports the share holders that did not publish their
+// decryption share of an envelope withheld as a result. Shares of envelopes
+// committed before the chain was followed may have been published unseen, so
+// these are not held against anyone.
+func (e *Equa) reportWithholding(head uint64) {
+	p := e.encrypted
+	p.lock.Lock()
+	var withholding []*Evidence
+	for hash, env := range p.envelopes {
+		if env.reported || env.tx == nil || env.number <= p.since {
+			continue
+		}
+		status := p.status(hash, env, head)
+		if status.Status != encryptedStatusWithheld {
+			continue
+		}
+		env.reported = true
+		for _, holder := range status.Missing {
+			withholding = append(withholding, &Evidence{
+				Validator: holder,
+				Block:     env.number + encryptedRevealWindow,
+				Violation: violationShareWithholding,
+			})
+		}
+	}
+	p.lock.Unlock()
+
+	for _, ev := range withholding {
+		if err := e.submitEvidence(ev, head); err == nil {
+			log.Warn("Decryption share withheld", "holder", ev.Validator, "block", ev.Block)
+		}
+	}
+}
+
+// publishDecryptionShares signs and publishes the decryption shares of the local
+// validator for committed envelopes, if it is authorized as the share holder.
+func (e *Equa) publishDecryptionShares(share *KeyShare, holder common.Address, envelopes []common.Hash) {
+	e.lock.RLock()
+	signer, signFn := e.signer, e.signFn
+	e.lock.RUnlock()
+
+	if signFn == nil || signer != holder {
+		log.Debug("Not authorized as key share holder", "signer", signer, "holder", holder)
+		return
+	}
+	shares := make([]*DecryptionShare, 0, len(envelopes))
+	for _, hash := range envelopes {
+		e.encrypted.lock.Lock()
+		env := e.encrypted.envelopes[hash]
+		e.encrypted.lock.Unlock()
+		if env == nil {
+			continue
+		}
+		ciphertext, _ := encryptedPayload(env.tx)
+		d, err := share.DecryptionShare(ciphertext)
+		if err != nil {
+			continue
+		}
+		sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeEquaDecryption, decryptionShareSigData(signer, hash, d))
+		if err != nil {
+			log.Debug("Failed to sign decryption share", "err", err)
+			break
+		}
+		shares = append(shares, &DecryptionShare{Validator: signer, Envelope: hash, Share: d, Signature: sig})
+	}
+	e.encrypted.AddShares(shares)
+}
+
+// revealEncrypted decrypts a committed envelope once a threshold of decryption
+// shares is known and adds the revealed transaction to the pool, arriving when
+// its envelope did so that fair ordering places it where it was committed to.
+func (e *Equa) revealEncrypted(env *encryptedEnvelope) {
+	p := e.encrypted
+	p.lock.Lock()
+	if len(env.shares) < p.threshold.threshold || env.inner != nil || env.invalid {
+		p.lock.Unlock()
+		return
+	}
+	err := p.decrypt(env)
+	inner, submit := env.inner, p.submit
+	var revealed bool
+	if inner != nil {
+		_, revealed = p.included.Peek(inner.Hash())
+	}
+	p.lock.Unlock()
+
+	if err != nil {
+		log.Debug("Failed to decrypt envelope", "hash", env.tx.Hash(), "shares", len(env.shares), "err", err)
+		return
+	}
+	if revealed || submit == nil {
+		return
+	}
+	seen, ok := e.arrivals.Timestamp(env.tx.Hash())
+	if !ok {
+		seen = time.Now()
+	}
+	e.recordArrivals([]*types.Transaction{inner}, seen)
+	if err := submit(inner); err != nil {
+		log.Debug("Failed to add revealed transaction", "hash", inner.Hash(), "envelope", env.tx.Hash(), "err", err)
+	}
+}
+
+// AddDecryptionShares imports decryption shares gossiped by peers, returning the
+// ones not known before.
+func (e *Equa) AddDecryptionShares(shares []*DecryptionShare) []*DecryptionShare {
+	return e.encrypted.AddShares(shares)
+}
+
+// SubscribeDecryptionShares subscribes to newly accepted decryption shares, both
+// published locally and received from peers, to gossip them further.
+func (e *Equa) SubscribeDecryptionShares(ch chan<- []*DecryptionShare) event.Subscription {
+	return e.encrypted.Subscribe(ch)
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// signTestDecryptionShare creates the decryption share of a key share holder for
+// an envelope.
+func signTestDecryptionShare(t *testing.T, key *ecdsa.PrivateKey, keyShare []byte, envelope *types.Transaction) *DecryptionShare {
+	t.Helper()
+
+	share, err := ParseKeyShare(keyShare)
+	if err != nil {
+		t.Fatalf("failed to parse key share: %v", err)
+	}
+	ciphertext, _ := encryptedPayload(envelope)
+	d, err := share.DecryptionShare(ciphertext)
+	if err != nil {
+		t.Fatalf("failed to create decryption share: %v", err)
+	}
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	sig, err := crypto.Sign(crypto.Keccak256(decryptionShareSigData(validator, envelope.Hash(), d)), key)
+	if err != nil {
+		t.Fatalf("failed to sign decryption share: %v", err)
+	}
+	return &DecryptionShare{Validator: validator, Envelope: envelope.Hash(), Share: d, Signature: sig}
+}
+
+// Tests the commit-reveal flow of encrypted transactions: envelopes are only
+// decrypted once committed and a threshold of share holders published their
+// decryption shares, and envelopes whose transaction is not included within the
+// reveal window are reported as censored or withheld, the share holders
+// withholding them facing slashing.
+func TestEncryptedMempool(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	addrs := make([]common.Address, len(keys))
+	config := &params.EquaConfig{
+		PoWDifficulty:   1000,
+		ThresholdShares: 2,
+		Features:        map[string]bool{FeatureEncryptedMempool: true},
+	}
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+		config.InitialValidators = append(config.InitialValidators, params.EquaInitialValidator{
+			Address: addrs[i],
+			Stake:   new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)),
+		})
+	}
+	keyShares, pubkey, err := NewThresholdCrypto(config).GenerateKeyShares(len(keys), 2)
+	if err != nil {
+		t.Fatalf("failed to generate key shares: %v", err)
+	}
+	config.ThresholdPublicKey = pubkey
+
+	var (
+		engine    = New(newTestChainConfig(config), rawdb.NewMemoryDatabase())
+		submitted []common.Hash
+		chain     = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(config)},
+			blocks:          make(map[common.Hash]*types.Block),
+		}
+		api    = &API{chain: chain, equa: engine}
+		signer = types.LatestSignerForChainID(big.NewInt(1))
+		sender = keys[0]
+	)
+	extend := func(txs ...*types.Transaction) {
+		number := int64(len(chain.headers))
+		header := &types.Header{Number: big.NewInt(number), Difficulty: common.Big1, BaseFee: big.NewInt(params.InitialBaseFee)}
+		if number > 0 {
+			header.ParentHash = chain.headers[number-1].Hash()
+		}
+		block := types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs})
+		chain.headers = append(chain.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+	}
+	seal := func(nonce uint64) (*types.Transaction, *types.Transaction) {
+		inner := newTestTransactions(t, 1)[0]
+		ciphertext, err := engine.thresholdCrypto.EncryptTransaction(inner)
+		if err != nil {
+			t.Fatalf("failed to encrypt transaction: %v", err)
+		}
+		data := append([]byte(encryptedTxMarker), ciphertext...)
+		envelope, err := types.SignTx(types.NewTransaction(nonce, common.Address{}, common.Big0, 100000, big.NewInt(1e9), data), signer, sender)
+		if err != nil {
+			t.Fatalf("failed to sign envelope: %v", err)
+		}
+		return envelope, inner
+	}
+	status := func(envelope *types.Transaction, want string) *EncryptedTransaction {
+		t.Helper()
+		have, err := api.GetEncryptedTransaction(envelope.Hash())
+		if err != nil {
+			t.Fatalf("failed to get encrypted transaction: %v", err)
+		}
+		if have.Status != want {
+			t.Fatalf("status mismatch: have %s, want %s", have.Status, want)
+		}
+		return have
+	}
+	// The first validator holds the first key share and publishes its
+	// decryption shares
+	file := filepath.Join(t.TempDir(), "validator.share")
+	if err := os.WriteFile(file, []byte(hexutil.Encode(keyShares[0])), 0600); err != nil {
+		t.Fatalf("failed to write key share: %v", err)
+	}
+	if err := engine.UseKeyShare(file); err != nil {
+		t.Fatalf("failed to load key share: %v", err)
+	}
+	engine.Authorize(addrs[0], func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), keys[0])
+	})
+	engine.encrypted.submit = func(tx *types.Transaction) error {
+		submitted = append(submitted, tx.Hash())
+		return nil
+	}
+	extend()
+
+	// Envelopes are pooled, but not decrypted before they are committed
+	revealed, revealedInner := seal(0)
+	censored, censoredInner := seal(1)
+	withheld, _ := seal(2)
+	for _, envelope := range []*types.Transaction{revealed, censored, withheld} {
+		enc, _ := envelope.MarshalBinary()
+		if _, err := api.SendEncryptedTransaction(enc); err != nil {
+			t.Fatalf("failed to send encrypted transaction: %v", err)
+		}
+	}
+	plain, _ := newTestTransactions(t, 1)[0].MarshalBinary()
+	if _, err := api.SendEncryptedTransaction(plain); err != errNotEncryptedTx {
+		t.Fatalf("plain transaction error mismatch: have %v, want %v", err, errNotEncryptedTx)
+	}
+	// Envelopes below the base fee or above the size limit are refused
+	for i, test := range []struct {
+		gasPrice int64
+		size     int
+		err      error
+	}{
+		{1, 0, errEnvelopeUnderpriced},
+		{1e9, maxEncryptedPayload + 1, errEncryptedTooLarge},
+	} {
+		data := append([]byte(encryptedTxMarker), make([]byte, test.size)...)
+		if test.size == 0 {
+			data = revealed.Data()
+		}
+		envelope, _ := types.SignTx(types.NewTransaction(3, common.Address{}, common.Big0, 100000, big.NewInt(test.gasPrice), data), signer, sender)
+		enc, _ := envelope.MarshalBinary()
+		if _, err := api.SendEncryptedTransaction(enc); !errors.Is(err, test.err) {
+			t.Fatalf("test %d: envelope error mismatch: have %v, want %v", i, err, test.err)
+		}
+	}
+	engine.processEncrypted(chain)
+	if have := status(revealed, encryptedStatusPending); len(have.Shares) != 0 {
+		t.Fatalf("decryption shared before commitment: %v", have.Shares)
+	}
+	// Once committed, the local share alone does not reach the threshold
+	extend(revealed, censored)
+	engine.processEncrypted(chain)
+	if have := status(revealed, encryptedStatusCommitted); !slices.Equal(have.Shares, addrs[:1]) || !slices.Equal(have.Missing, addrs[1:]) {
+		t.Fatalf("share holders mismatch: have %v missing %v", have.Shares, have.Missing)
+	}
+	// Shares of the wrong holder are refused, a second share reveals both
+	if added := engine.AddDecryptionShares([]*DecryptionShare{signTestDecryptionShare(t, keys[2], keyShares[1], revealed)}); len(added) != 0 {
+		t.Fatalf("share of wrong holder accepted")
+	}
+	engine.AddDecryptionShares([]*DecryptionShare{
+		signTestDecryptionShare(t, keys[1], keyShares[1], revealed),
+		signTestDecryptionShare(t, keys[1], keyShares[1], censored),
+	})
+	engine.processEncrypted(chain)
+	if have := status(revealed, encryptedStatusDecrypted); *have.Transaction != revealedInner.Hash() {
+		t.Fatalf("revealed transaction mismatch: have %x, want %x", *have.Transaction, revealedInner.Hash())
+	}
+	want := []common.Hash{revealed.Hash(), censored.Hash(), withheld.Hash(), revealedInner.Hash(), censoredInner.Hash()}
+	slices.SortFunc(submitted[3:], func(a, b common.Hash) int { return a.Cmp(b) })
+	slices.SortFunc(want[3:], func(a, b common.Hash) int { return a.Cmp(b) })
+	if !slices.Equal(submitted, want) {
+		t.Fatalf("submitted transactions mismatch: have %x, want %x", submitted, want)
+	}
+	// Only the included transaction counts as revealed after the window
+	extend(revealedInner, withheld)
+	for range encryptedRevealWindow + 1 {
+		extend()
+	}
+	engine.processEncrypted(chain)
+	if have := status(revealed, encryptedStatusRevealed); have.RevealedIn != 2 {
+		t.Fatalf("reveal block mismatch: have %d, want 2", have.RevealedIn)
+	}
+	if have := status(withheld, encryptedStatusWithheld); !slices.Equal(have.Missing, addrs[1:]) {
+		t.Fatalf("withholding share holders mismatch: have %v, want %v", have.Missing, addrs[1:])
+	}
+	unrevealed := api.GetUnrevealedTransactions()
+	if len(unrevealed) != 2 || unrevealed[0].Hash != censored.Hash() || unrevealed[0].Status != encryptedStatusCensored || unrevealed[1].Hash != withheld.Hash() {
+		t.Fatalf("unrevealed transactions mismatch: have %+v", unrevealed)
+	}
+	// The share holders withholding the decryption are reported, once
+	for i, addr := range addrs {
+		evidence := engine.slasher.Evidence(addr)
+		if want := i > 0; (len(evidence) == 1) != want || len(evidence) > 1 {
+			t.Fatalf("withholding evidence of holder %d mismatch: have %v, want %v", i, evidence, want)
+		}
+		if i > 0 && (evidence[0].Violation != violationShareWithholding || evidence[0].Block != 2+encryptedRevealWindow) {
+			t.Fatalf("withholding evidence mismatch: have %+v", evidence[0])
+		}
+	}
+	engine.processEncrypted(chain)
+	if evidence := engine.slasher.PendingEvidence(); len(evidence) != 2 {
+		t.Fatalf("withholding reported again: %v", evidence)
+	}
+}
@@ -20,30 +20,73 @@ package equa
 import (
 	"errors"
 	"math/big"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/lru"
 	"github.com/equa/go-equa/consensus"
 	"github.com/equa/go-equa/core/state"
 	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/core/vm"
 	"github.com/equa/go-equa/ethdb"
 	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
 	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
 	"github.com/equa/go-equa/rpc"
+	"github.com/equa/go-equa/trie"
+	"golang.org/x/crypto/sha3"
 )
 
 var (
-	errUnknownBlock      = errors.New("unknown block")
-	errInvalidPoW        = errors.New("invalid PoW solution")
-	errInvalidValidator  = errors.New("invalid validator")
-	errInsufficientStake = errors.New("insufficient stake")
-	errMEVDetected       = errors.New("MEV extraction detected")
+	errUnknownBlock     = errors.New("unknown block")
+	errInvalidPoW       = errors.New("invalid PoW solution")
+	errInvalidValidator = errors.New("invalid validator")
+	errMEVDetected      = errors.New("MEV extraction detected")
+	errInvalidSender    = errors.New("invalid transaction sender")
+
+	// errUnauthorizedProposer is returned if a header's coinbase does not match
+	// the proposer selected for its height.
+	errUnauthorizedProposer = errors.New("coinbase is not the selected proposer")
 )
 
+var (
+	sealTimer           = metrics.NewRegisteredTimer("equa/seal", nil)
+	powSolveTimer       = metrics.NewRegisteredTimer("equa/pow/solve", nil)
+	proposerSelectTimer = metrics.NewRegisteredTimer("equa/proposer/select", nil)
+
+	mevHistogram       = metrics.NewRegisteredHistogram("equa/mev", nil, metrics.NewExpDecaySample(1028, 0.015))             // MEV detected per block, in gwei
+	mevBlockMeter      = metrics.NewRegisteredMeter("equa/mev/blocks", nil)                                                  // Blocks with MEV detected
+	mevBurnedCounter   = metrics.NewRegisteredCounter("equa/mev/burned", nil)                                                // MEV burned, in gwei
+	orderingScoreGauge = metrics.NewRegisteredGaugeFloat64("equa/ordering/score", nil)                                       // Ordering score of the latest block
+	orderingHistogram  = metrics.NewRegisteredHistogram("equa/ordering/scores", nil, metrics.NewExpDecaySample(1028, 0.015)) // Ordering scores, in percent
+)
+
+// SmoothingPoolAddress is the account holding the proposal rewards of smoothing
+// pool members until they are distributed at the end of the epoch.
+var SmoothingPoolAddress = common.HexToAddress("0x00000000000000000000000000000000000e9a01")
+
+// ownAssessmentLimit is the number of locally assembled blocks whose verdict is
+// kept for answering queries without re-scoring them.
+const ownAssessmentLimit = 64
+
+// ownAssessment is the verdict on a block computed while assembling it.
+type ownAssessment struct {
+	proposer      common.Address
+	orderingScore float64
+	fairOrdering  bool
+	mev           *big.Int
+	credits       []*RewardCredit
+}
+
 // Equa is the EQUA hybrid consensus engine that combines PoS with lightweight PoW for anti-MEV protection.
 type Equa struct {
-	config *params.EquaConfig // Consensus engine configuration parameters
-	db     ethdb.Database      // Database to store and retrieve snapshot checkpoints
+	config  *params.EquaConfig // Consensus engine configuration parameters
+	chainID *big.Int           // Chain the engine runs on
+	senders *cachingSigner     // Signer of the chain, shared by the components to recover each sender once
+	db      ethdb.Database      // Database to store and retrieve snapshot checkpoints
 
 	// Core components
 	stakeManager    *StakeManager    // Manages validator stakes and selection
@@ -52,15 +95,43 @@ type Equa struct {
 	thresholdCrypto *ThresholdCrypto // Handles threshold encryption/decryption
 	slasher         *Slasher        // Handles slashing for malicious behavior
 	fairOrderer     *FairOrderer    // Implements fair transaction ordering
+	builderMarket   *BuilderMarket  // Admits payloads from external builders
+	crossCheck      *OrderingCrossCheck // Compares ordering scores with peers, nil if disabled
+	correlation     *CorrelationMonitor // Tracks proposal timing to detect correlated validators
+	bundles         *BundlePool         // Transaction bundles awaiting inclusion
+	encrypted       *EncryptedPool      // Encrypted transactions awaiting their reveal
+	faucet          *Faucet             // Test network onboarding endpoints, nil if disabled
+	admin           *AdminAPI           // Validator management namespace, nil if disabled
+	mevRulesFile    string              // File the MEV detection rules are loaded from, empty for the built-in ones
+	ownAssessments  *lru.Cache[common.Hash, *ownAssessment] // Verdicts on locally assembled blocks by transaction root
+	finalized       *lru.Cache[common.Hash, *finalization]  // Outcome of finalizing processed blocks by hash
+	schedules       *lru.Cache[common.Hash, *ProposerSchedule] // Proposer schedules by epoch boundary block
+	boundaries      *lru.Cache[common.Hash, common.Hash]       // Epoch boundary blocks seeding the schedule of the children of headers
+	proposals       *proposals          // Recently verified proposals, to detect double proposals
+	invalid         *invalidBlocks      // Rejected headers and proposers repeatedly signing invalid ones
+	arrivals        *ArrivalRecorder    // First-seen times of transactions, local and attested by validators
+	feeds           eventFeeds          // Feeds of the equa namespace subscriptions
 
 	// Runtime state
 	currentValidators map[common.Address]*Validator // Current validator set
 	blockNumber       uint64                        // Current block number
 	epoch             uint64                        // Current epoch
+
+	signer          common.Address    // Account signing the compliance statements of sealed blocks
+	signFn          SignerFn          // Signer function to authorize hashes with
+	inclusionSource InclusionSourceFn // Pending transactions inclusion lists are built from
+	lock            sync.RWMutex      // Protects the signer fields, the inclusion source and the MEV rules file
+
+	quit      chan struct{} // Terminates background threads
+	closeOnce sync.Once
 }
 
-// New creates a new EQUA consensus engine.
-func New(config *params.EquaConfig, db ethdb.Database) *Equa {
+// New creates a new EQUA consensus engine for the given chain, which must have
+// an EQUA configuration.
+func New(chainConfig *params.ChainConfig, db ethdb.Database) *Equa {
+	config := chainConfig.Equa
+	signer := newCachingSigner(types.LatestSigner(chainConfig), senderCacheLimit)
+
 	// Set default values if not specified
 	if config.Period == 0 {
 		config.Period = 12 // 12 seconds default
@@ -74,21 +145,82 @@ func New(config *params.EquaConfig, db ethdb.Database) *Equa {
 	if config.MEVBurnPercentage == 0 {
 		config.MEVBurnPercentage = 80 // 80% burn default
 	}
+	if config.EvidenceMaxAge == 0 {
+		config.EvidenceMaxAge = 2 // 2 epochs default
+	}
+	if config.BuilderMinOrderingScore == 0 {
+		config.BuilderMinOrderingScore = 90 // 90% ordering score default
+	}
+	if config.Committees == 0 {
+		config.Committees = 4 // 4 committees default
+	}
+	if config.UnbondingEpochs == 0 {
+		config.UnbondingEpochs = 7 // 7 epochs default, a week at the default epoch length
+	}
+	if config.ChurnLimit == 0 {
+		config.ChurnLimit = 4 // 4 activations per epoch default
+	}
+	if config.RetargetWindow == 0 {
+		config.RetargetWindow = 32 // 32 blocks default
+	}
+	if config.RetargetMaxChange == 0 {
+		config.RetargetMaxChange = 25 // 25% default
+	}
+	if config.MinPoWDifficulty == 0 {
+		config.MinPoWDifficulty = 1000 // 1000 default, the floor of AdjustDifficulty
+	}
+	if config.ArrivalCacheSize == 0 {
+		config.ArrivalCacheSize = 65536 // 65536 transactions default, well above the pool capacity
+	}
+	if config.ArrivalCacheTTL == 0 {
+		config.ArrivalCacheTTL = 3 * 60 * 60 // 3 hours default, the lifetime of queued pool transactions
+	}
+	if config.OrderingPolicy == "" {
+		config.OrderingPolicy = params.EquaOrderingFCFS // Strict FCFS default
+	}
+	if config.OrderingWindow == 0 {
+		config.OrderingWindow = 200 // 200 milliseconds default, about the propagation time of transactions
+	}
 
 	equa := &Equa{
 		config:            config,
+		chainID:           chainConfig.ChainID,
+		senders:           signer,
 		db:                db,
 		currentValidators: make(map[common.Address]*Validator),
+		quit:              make(chan struct{}),
 	}
 
 	// Initialize components
-	equa.stakeManager = NewStakeManager(db, config)
+	equa.stakeManager = NewStakeManager(config)
 	equa.powEngine = NewLightPoW(config)
-	equa.mevDetector = NewMEVDetector(config)
+	equa.mevDetector = NewMEVDetector(config, signer)
 	equa.thresholdCrypto = NewThresholdCrypto(config)
-	equa.slasher = NewSlasher(config)
+	equa.slasher = NewSlasher(db, config, signer)
+	equa.slasher.rules = equa.mevDetector.Rules
+	equa.arrivals = NewArrivalRecorder(config, equa.stakeManager.IsEligible)
 	equa.fairOrderer = NewFairOrderer(config)
-
+	equa.fairOrderer.arrivals = equa.arrivals
+	equa.fairOrderer.signer = signer
+	equa.builderMarket = NewBuilderMarket(config, equa.fairOrderer, equa.mevDetector)
+	equa.correlation = NewCorrelationMonitor()
+	equa.bundles = NewBundlePool()
+	equa.ownAssessments = lru.NewCache[common.Hash, *ownAssessment](ownAssessmentLimit)
+	equa.finalized = lru.NewCache[common.Hash, *finalization](finalizedLimit)
+	equa.schedules = lru.NewCache[common.Hash, *ProposerSchedule](scheduleCacheLimit)
+	equa.boundaries = lru.NewCache[common.Hash, common.Hash](boundaryCacheLimit)
+	equa.invalid = newInvalidBlocks()
+	equa.proposals = newProposals()
+
+	// Load the validator set and threshold key committed to at genesis
+	for _, validator := range config.InitialValidators {
+		equa.stakeManager.AddValidator(validator.Address, validator.Stake, validator.PublicKey)
+	}
+	if len(config.ThresholdPublicKey) > 0 {
+		equa.thresholdCrypto.SetMasterPublicKey(config.ThresholdPublicKey)
+	}
+	equa.encrypted = NewEncryptedPool(config, equa.thresholdCrypto)
+	reportFeatures(config)
 	return equa
 }
 
@@ -100,6 +232,21 @@ func (e *Equa) Author(header *types.Header) (common.Address, error) {
 
 // VerifyHeader checks whether a header conforms to the consensus rules.
 func (e *Equa) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header) error {
+	// Refuse headers rejected before without verifying them again
+	if err, ok := e.invalid.lookup(header.Hash()); ok {
+		return err
+	}
+	if err := e.verifyHeader(chain, header); err != nil {
+		e.recordInvalid(chain, header, err)
+		return err
+	}
+	return nil
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules.
+func (e *Equa) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header) error {
+	e.loadValidators(chain)
+
 	// Verify basic header fields
 	if header.Number == nil {
 		return errUnknownBlock
@@ -116,16 +263,68 @@ func (e *Equa) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Hea
 		return errors.New("invalid timestamp")
 	}
 
+	// Verify the difficulty was retargeted from the recent blocks
+	if e.config.FeatureEnabled(FeatureDifficultyRetargeting) {
+		if err := e.verifyDifficulty(chain, header, parent); err != nil {
+			return err
+		}
+	}
 	// Verify PoW solution
 	if !e.powEngine.Verify(header, parent) {
 		return errInvalidPoW
 	}
 
-	// Verify proposer has stake
-	if !e.stakeManager.HasStake(header.Coinbase) {
-		return errInvalidValidator
+	// Verify the proposer's compliance statement is well formed and signed. Its
+	// inputs are only checked against the body when disputed. Repeat offenders
+	// have it checked before the more expensive proposer selection.
+	statement := e.config.FeatureEnabled(FeatureComplianceStatements)
+	if statement && e.invalid.repeatOffender(header.Coinbase) {
+		if _, err := decodeStatement(header); err != nil {
+			return err
+		}
+		statement = false
 	}
-
+	// Verify the coinbase is bound to the proposer selected for this height and
+	// epoch boundaries commit to the validator set proposers were drawn from.
+	// Headers verified ahead of the processing of their parent are checked when
+	// the block is processed on top of it, in FinalizeWithReceipts.
+	if err := e.verifyScheduled(chain, header, parent); err != nil && !errors.Is(err, errStateUnavailable) {
+		return err
+	}
+	if statement {
+		if _, err := decodeStatement(header); err != nil {
+			return err
+		}
+	}
+	// Verify random batches were shuffled with the seed drawn for this height
+	if e.config.FeatureEnabled(FeatureComplianceStatements) {
+		if err := e.verifyBatchSeed(chain, header, parent); err != nil {
+			return err
+		}
+	}
+	// Verify the inclusion list for the next block is well formed and signed
+	if e.config.FeatureEnabled(FeatureInclusionLists) {
+		if _, err := inclusionList(e.senders, header); err != nil {
+			return err
+		}
+	}
+	// Verify the ordering claim of the proposer is present and signed
+	if e.config.FeatureEnabled(FeatureOrderingCommitments) {
+		claim, err := orderingClaim(header)
+		if err != nil {
+			return err
+		}
+		if claim == nil {
+			return errMissingOrderingClaim
+		}
+	}
+	// Remember the signed proposal to catch its proposer signing another block
+	// at the same height
+	if e.config.FeatureEnabled(FeatureComplianceStatements) {
+		e.recordProposal(chain, header)
+	}
+	// Track the arrival timing of live proposals for correlation monitoring
+	e.correlation.RecordProposal(header.Coinbase, time.Since(time.Unix(int64(header.Time), 0)))
 	return nil
 }
 
@@ -137,7 +336,7 @@ func (e *Equa) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types
 	results := make(chan error, len(headers))
 
 	go func() {
-		for i, header := range headers {
+		for _, header := range headers {
 			err := e.VerifyHeader(chain, header)
 
 			select {
@@ -154,12 +353,81 @@ func (e *Equa) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types
 	return abort, results
 }
 
+// verifyScheduled checks the fields of a header derived from the proposer
+// schedule covering it: its proposer and, at epoch boundaries, its validator set
+// commitment. The schedule is drawn from the state of the parent.
+func (e *Equa) verifyScheduled(chain consensus.ChainHeaderReader, header *types.Header, parent *types.Header) error {
+	schedule, err := e.blockSchedule(chain, header.Number.Uint64(), parent)
+	if err != nil {
+		return err
+	}
+	return e.checkScheduled(header, schedule)
+}
+
+// verifyProcessed checks the fields of a header derived from the proposer
+// schedule covering it, drawing the schedule from the state the block is
+// processed with, before its finalization. Blocks only change the proposers
+// fixed in the state while being finalized, so it holds those of the parent.
+func (e *Equa) verifyProcessed(chain consensus.ChainHeaderReader, header *types.Header, state vm.StateDB) error {
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	boundary, err := e.epochBoundary(chain, parent)
+	if err != nil {
+		return err
+	}
+	schedule, err := e.stateSchedule(scheduleEpoch(header.Number.Uint64(), e.config.Epoch), boundary, state)
+	if err != nil {
+		return err
+	}
+	return e.checkScheduled(header, schedule)
+}
+
+// checkScheduled checks the proposer of a header and, if enabled, its validator
+// set commitment against the given schedule covering it.
+func (e *Equa) checkScheduled(header *types.Header, schedule *ProposerSchedule) error {
+	if err := checkProposer(header, schedule); err != nil {
+		return err
+	}
+	if e.config.FeatureEnabled(FeatureValidatorSetCommits) {
+		return e.checkValidatorSet(header, schedule)
+	}
+	return nil
+}
+
 // VerifyUncles implements consensus.Engine, always returning an error for any
-// uncles as this consensus mechanism doesn't permit uncles.
-func (e *Equa) VerifyUncles(chain consensus.ChainHeaderReader, block *types.Block) error {
+// uncles as this consensus mechanism doesn't permit uncles. It also verifies the
+// proposer of the block, the inclusion list of its parent and its ordering claim.
+func (e *Equa) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
 	if len(block.Uncles()) > 0 {
 		return errors.New("uncles not allowed")
 	}
+	// Verify the proposer against the schedule drawn from the state of the
+	// parent, which is processed by now unless pruned, in which case the block is
+	// imported as a side chain and verified again once the state is regenerated
+	parent := chain.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	if err := e.verifyScheduled(chain, block.Header(), parent); err != nil {
+		if errors.Is(err, errStateUnavailable) {
+			return consensus.ErrPrunedAncestor
+		}
+		return err
+	}
+	// Verify the block includes the transactions listed by the parent proposer,
+	// this being the only hook with access to the body before execution
+	if e.config.FeatureEnabled(FeatureInclusionLists) {
+		if err := e.verifyInclusions(chain, block); err != nil {
+			return err
+		}
+	}
+	// Verify the proposer claimed the ordering of the block, the MEV claimed
+	// being checked once the block is processed
+	if e.config.FeatureEnabled(FeatureOrderingCommitments) {
+		return e.verifyOrderingClaim(block)
+	}
 	return nil
 }
 
@@ -171,17 +439,22 @@ func (e *Equa) Prepare(chain consensus.ChainHeaderReader, header *types.Header)
 	if parent == nil {
 		return errUnknownBlock
 	}
+	e.loadValidators(chain)
 
 	// Set basic header fields
 	header.Time = uint64(time.Now().Unix())
-	header.Difficulty = big.NewInt(int64(e.config.PoWDifficulty))
+	difficulty, err := e.calcDifficulty(chain, parent)
+	if err != nil {
+		return err
+	}
+	header.Difficulty = difficulty
 
 	// Update block number and epoch
 	e.blockNumber = header.Number.Uint64()
 	e.epoch = e.blockNumber / e.config.Epoch
 
-	// Select proposer using hybrid PoS+PoW
-	proposer, err := e.selectProposer(header.Number.Uint64(), parent)
+	// Select the proposer scheduled for this height
+	proposer, err := e.selectProposer(chain, header.Number.Uint64(), parent)
 	if err != nil {
 		return err
 	}
@@ -195,86 +468,371 @@ func (e *Equa) Prepare(chain consensus.ChainHeaderReader, header *types.Header)
 }
 
 // Finalize implements consensus.Engine, accumulating the block rewards,
-// setting the final state and assembling the block.
-func (e *Equa) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) {
+// setting the final state and assembling the block. Without the receipts of the
+// block no MEV is detected in it, imported blocks are finalized with them, see
+// FinalizeWithReceipts.
+func (e *Equa) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state vm.StateDB, body *types.Body) {
+	result := e.finalize(chain, header, state, body, nil)
+	e.recordRewards(header, result.credits)
+	e.finalized.Add(header.Hash(), result)
+}
+
+// FinalizeWithReceipts implements consensus.ReceiptsFinalizer, finalizing an
+// imported block with the receipts the MEV burned in it is detected from. The
+// proposer of the block is verified first against the proposers fixed in the
+// state it is processed with, as headers verified ahead of the processing of
+// their parent could not be, and the MEV claimed by the proposer against the
+// one detected.
+//
+// Blocks are also processed to regenerate historical states and before their
+// state root is validated, so besides the state only the reward ledger is
+// written here, its entries only counting once the block is canonical. The
+// outcome is kept for the block to be accounted for once written as canonical,
+// see StartChainFollower.
+func (e *Equa) FinalizeWithReceipts(chain consensus.ChainHeaderReader, header *types.Header, state vm.StateDB, body *types.Body, receipts []*types.Receipt) error {
+	if err := e.verifyProcessed(chain, header, state); err != nil {
+		return err
+	}
+	result := e.finalize(chain, header, state, body, receipts)
+	if e.config.FeatureEnabled(FeatureOrderingCommitments) {
+		if err := verifyClaimedMEV(header, result.mev); err != nil {
+			return err
+		}
+	}
+	e.recordRewards(header, result.credits)
+	e.finalized.Add(header.Hash(), result)
+	return nil
+}
+
+// toGwei converts an amount of wei to gwei for metrics, which only take 64 bits.
+func toGwei(wei *big.Int) int64 {
+	return new(big.Int).Div(wei, big.NewInt(params.GWei)).Int64()
+}
+
+// finalization is the outcome of finalizing a block: the rewards credited,
+// recorded into the reward ledger along with the block, and the parts applied
+// to the engine itself only once the block is written as canonical.
+type finalization struct {
+	mev        *big.Int        // MEV detected in the block
+	credits    []*RewardCredit // Rewards credited in the block
+	validators bool            // Whether the block changed the validator registry
+}
+
+// finalize accumulates the block rewards and sets the final state. Blocks are
+// finalized both when assembled and when imported, so finalize only changes the
+// state: the changes to the engine itself are returned, to be applied once the
+// block is written as canonical.
+func (e *Equa) finalize(chain consensus.ChainHeaderReader, header *types.Header, state vm.StateDB, body *types.Body, receipts []*types.Receipt) *finalization {
+	// Record the smoothing pool joins and leaves of the block
+	e.processSmoothingMembership(header, state, body.Transactions)
+
+	// Queue the voluntary exits carried by the block
+	exits := e.queueExits(header, state, body.Transactions)
+
+	// Credit the deposits made in the block
+	deposits := e.creditDeposits(chain, header, state, receipts)
+
 	// Process MEV detection and burning
-	e.processMEVAndRewards(header, state, txs, receipts)
+	mev, credits := e.processMEVAndRewards(header, state, body.Transactions, receipts)
+
+	// Slash the offenders proven by evidence transactions
+	var slashings int
+	if e.featureEnabled(FeatureSlashingExecution) {
+		slashings = e.executeSlashing(header, state, body.Transactions, receipts)
+	}
 
 	// Apply block rewards
-	e.applyBlockRewards(header, state)
+	credits = append(credits, e.applyBlockRewards(header, state))
+
+	// Share the smoothing pool, derive the validator set from the staking
+	// contract, process voluntary exits and activations and fix the proposers of
+	// the next epoch at epoch boundaries
+	number := header.Number.Uint64()
+	boundary := number%e.config.Epoch == 0
+	if boundary {
+		credits = append(credits, e.distributeSmoothingPool(header, state)...)
+
+		var (
+			epoch    = number / e.config.Epoch
+			registry = newValidatorRegistry(state, e.config)
+		)
+		if e.stakingEnabled() {
+			registry.syncStaking(readStakingRegistry(state, e.config.StakingContract), epoch)
+		}
+		for _, w := range registry.processExits(dueExits(state, epoch), epoch) {
+			log.Info("Validator exited", "validator", w.Validator, "epoch", epoch)
+		}
+		for _, pending := range registry.activate(epoch) {
+			log.Info("Validator activated", "validator", pending.Address, "stake", pending.Stake, "epoch", epoch)
+		}
+		registry.fixProposers()
+	}
+	return &finalization{
+		mev:        mev,
+		credits:    credits,
+		validators: boundary || deposits > 0 || len(exits) > 0 || slashings > 0,
+	}
 }
 
 // FinalizeAndAssemble implements consensus.Engine, accumulating the block rewards,
 // setting the final state and assembling the block.
-func (e *Equa) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
-	// Decrypt transactions if they are encrypted
-	if e.hasEncryptedTxs(txs) {
-		decryptedTxs, err := e.decryptTransactions(txs)
-		if err != nil {
-			return nil, err
-		}
-		txs = decryptedTxs
-	}
-
-	// Apply fair ordering
-	orderedTxs := e.fairOrderer.OrderTransactions(txs)
+func (e *Equa) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, body *types.Body, receipts []*types.Receipt) (*types.Block, error) {
+	// Encrypted transactions are not decrypted here: the transactions were
+	// executed already, so the envelopes stay and the revealed transactions
+	// are included in a later block, see StartEncryptedMempool
+	// The transactions were executed in the order of the ordering policy
+	// already, see OrderBlock, so they are assembled as they are
+	txs := body.Transactions
 
 	// Finalize the block
-	e.Finalize(chain, header, state, orderedTxs, uncles, receipts)
+	result := e.finalize(chain, header, state, body, receipts)
+
+	// Assign the final state root to header
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 
-	// Assemble and return the final block
-	return types.NewBlock(header, orderedTxs, uncles, receipts, nil), nil
+	// Assemble the final block, keeping the verdict on it for when it is queried.
+	// Blocks after Shanghai carry a withdrawals list, even if empty.
+	withdrawals := body.Withdrawals
+	if withdrawals == nil && chain.Config().IsShanghai(header.Number, header.Time) {
+		withdrawals = make([]*types.Withdrawal, 0)
+	}
+	block := types.NewBlock(header, &types.Body{Transactions: txs, Withdrawals: withdrawals}, receipts, trie.NewStackTrie(nil))
+	e.ownAssessments.Add(block.TxHash(), &ownAssessment{
+		proposer:      header.Coinbase,
+		orderingScore: e.fairOrderer.GetOrderingScore(txs),
+		fairOrdering:  e.fairOrderer.ValidateOrdering(txs),
+		mev:           result.mev,
+		credits:       result.credits,
+	})
+	return block, nil
 }
 
 // Seal implements consensus.Engine, attempting to create a sealed block using
 // the local signing credentials.
 func (e *Equa) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	start := time.Now()
 	header := types.CopyHeader(block.Header())
 
+	// Commit to the ordered transactions in a signed compliance statement
+	if e.featureEnabled(FeatureComplianceStatements) {
+		seed, err := e.batchSeed(chain, header)
+		if err != nil {
+			return err
+		}
+		if err := e.signStatement(header, block.Transactions(), seed); err != nil {
+			return err
+		}
+	}
+	// Commit to the validator set the proposers of the epoch were drawn from
+	if e.featureEnabled(FeatureValidatorSetCommits) && header.Number.Uint64()%e.config.Epoch == 0 {
+		if err := e.commitValidatorSet(chain, header); err != nil {
+			return err
+		}
+	}
+	// Announce the release and supported features of this node
+	if e.featureEnabled(FeatureVersionSignaling) {
+		header.Extra = append(header.Extra, localVersionSignal().encode()...)
+	}
+
 	// Solve lightweight PoW
+	solveStart := time.Now()
 	nonce, mixDigest, err := e.powEngine.Solve(header, stop)
 	if err != nil {
 		return err
 	}
+	powSolveTimer.UpdateSince(solveStart)
 
 	// Update header with PoW solution
 	header.Nonce = types.EncodeNonce(nonce)
 	header.MixDigest = mixDigest
 
+	// Never publish two different blocks signed for the same height, the stop
+	// channel only aborts sealing blocks that were not published yet
+	if e.featureEnabled(FeatureComplianceStatements) {
+		if err := e.recordSealed(header); err != nil {
+			return err
+		}
+	}
+	// Record the rewards credited in the block, which is written without being
+	// processed again
+	if own, ok := e.ownAssessments.Get(header.TxHash); ok && own.proposer == header.Coinbase {
+		e.recordRewards(header, own.credits)
+	}
 	// Send the sealed block
 	select {
 	case results <- block.WithSeal(header):
+		sealTimer.UpdateSince(start)
 	default:
-		log.Warn("Sealing result is not read by miner", "sealhash", types.SealHash(header))
+		log.Warn("Sealing result is not read by miner", "sealhash", e.SealHash(header))
 	}
 
 	return nil
 }
 
+// BestBid returns the transactions of the most valuable builder bid that passed
+// the EQUA fairness checks for the given parent block. If nil is returned, the
+// block should be built locally.
+func (e *Equa) BestBid(parent common.Hash) []*types.Transaction {
+	if !e.featureEnabled(FeatureBuilderMarket) {
+		return nil
+	}
+	return e.builderMarket.BestBid(parent)
+}
+
+// OrderBlock orders the pending transactions of a block with the ordering
+// policy, for the miner to execute them in that order. The pending bundles are
+// placed among them at the arrival position of their earliest member, and the
+// transactions of the same sender keep their nonce order.
+func (e *Equa) OrderBlock(chain consensus.ChainHeaderReader, header *types.Header, txs []*types.Transaction) ([]consensus.TxGroup, error) {
+	seed, err := e.batchSeed(chain, header)
+	if err != nil {
+		return nil, err
+	}
+	var shuffle common.Hash
+	if seed != nil {
+		shuffle = *seed
+	}
+	// Bundled transactions need not be pooled, order them along with the others
+	var bundles []*Bundle
+	if e.featureEnabled(FeatureBundles) {
+		var (
+			pooled  = make(map[common.Hash]bool, len(txs))
+			bundled = make(map[common.Hash]bool)
+		)
+		for _, tx := range txs {
+			pooled[tx.Hash()] = true
+		}
+		for _, bundle := range e.bundles.Pending() {
+			// Transactions are bundled once, by the oldest bundle holding them
+			if slices.ContainsFunc(bundle.Txs, func(tx *types.Transaction) bool { return bundled[tx.Hash()] }) {
+				continue
+			}
+			for _, tx := range bundle.Txs {
+				bundled[tx.Hash()] = true
+				if !pooled[tx.Hash()] {
+					txs = append(txs, tx)
+				}
+			}
+			bundles = append(bundles, bundle)
+		}
+	}
+	units := e.fairOrderer.orderUnits(txs, bundles, header.BaseFee, shuffle)
+
+	groups := make([]consensus.TxGroup, len(units))
+	for i, unit := range units {
+		groups[i] = consensus.TxGroup{Txs: unit.Txs, Atomic: unit.Atomic}
+	}
+	return groups, nil
+}
+
 // SealHash returns the hash of a block prior to it being sealed.
-func (e *Equa) SealHash(header *types.Header) common.Hash {
-	return types.SealHash(header)
+func (e *Equa) SealHash(header *types.Header) (hash common.Hash) {
+	hasher := sha3.NewLegacyKeccak256()
+
+	enc := []interface{}{
+		header.ParentHash,
+		header.UncleHash,
+		header.Coinbase,
+		header.Root,
+		header.TxHash,
+		header.ReceiptHash,
+		header.Bloom,
+		header.Difficulty,
+		header.Number,
+		header.GasLimit,
+		header.GasUsed,
+		header.Time,
+		header.Extra,
+	}
+	if header.BaseFee != nil {
+		enc = append(enc, header.BaseFee)
+	}
+	rlp.Encode(hasher, enc)
+	hasher.Sum(hash[:0])
+	return hash
 }
 
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
 // that a new block should have based on the previous blocks in the chain and the
 // current time.
 func (e *Equa) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
-	// EQUA uses fixed lightweight PoW difficulty
-	return big.NewInt(int64(e.config.PoWDifficulty))
+	difficulty, err := e.calcDifficulty(chain, parent)
+	if err != nil {
+		return new(big.Int).SetUint64(e.config.PoWDifficulty)
+	}
+	return difficulty
 }
 
-// APIs implements consensus.Engine, returning the user facing RPC API.
+// APIs implements consensus.Engine, returning the user facing RPC API and, if
+// enabled, the validator management namespace.
 func (e *Equa) APIs(chain consensus.ChainHeaderReader) []rpc.API {
-	return []rpc.API{{
+	apis := []rpc.API{{
 		Namespace: "equa",
 		Version:   "1.0",
 		Service:   &API{equa: e, chain: chain},
 		Public:    true,
 	}}
+	if e.admin != nil {
+		apis = append(apis, rpc.API{
+			Namespace:     "equaadmin",
+			Version:       "1.0",
+			Service:       e.admin,
+			Authenticated: true,
+		})
+	}
+	return apis
+}
+
+// StartOrderingCrossCheck starts comparing the ordering score of new blocks with
+// the scores reported by the configured peers, until the engine is closed.
+func (e *Equa) StartOrderingCrossCheck(chain consensus.ChainReader, config CrossCheckConfig) {
+	e.crossCheck = NewOrderingCrossCheck(config, e.fairOrderer, e.mevDetector)
+	go e.crossCheck.loop(chain, time.Duration(e.config.Period)*time.Second, e.quit)
+}
+
+// EnableFaucet enables the test network onboarding endpoints, transferring the
+// faucet funds with the given callback.
+func (e *Equa) EnableFaucet(config FaucetConfig, send FaucetSendFn) error {
+	faucet, err := NewFaucet(config, e.chainID, send)
+	if err != nil {
+		return err
+	}
+	e.faucet = faucet
+	return nil
+}
+
+// UseMEVRules loads the MEV detection rules of local analysis from a file, which
+// is read again when the rules are reloaded.
+func (e *Equa) UseMEVRules(file string) error {
+	e.lock.Lock()
+	e.mevRulesFile = file
+	e.lock.Unlock()
+
+	_, err := e.ReloadMEVRules()
+	return err
+}
+
+// ReloadMEVRules reads the MEV detection rules from the configured file again,
+// keeping the current rules if the file is invalid.
+func (e *Equa) ReloadMEVRules() (*MEVRules, error) {
+	e.lock.RLock()
+	file := e.mevRulesFile
+	e.lock.RUnlock()
+
+	if file == "" {
+		return nil, errNoMEVRulesFile
+	}
+	rules, err := LoadMEVRules(file)
+	if err != nil {
+		return nil, err
+	}
+	e.mevDetector.SetRules(rules)
+	log.Info("Loaded MEV detection rules", "file", file, "swaps", len(rules.SwapSelectors), "liquidations", len(rules.LiquidationSelectors), "routers", len(rules.Routers))
+	return rules, nil
 }
 
-// Close implements consensus.Engine. It's a noop for EQUA as there are no background threads.
+// Close implements consensus.Engine, terminating any background threads.
 func (e *Equa) Close() error {
+	e.closeOnce.Do(func() { close(e.quit) })
 	return nil
 }
\ No newline at end of file
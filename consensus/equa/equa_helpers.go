@@ -4,208 +4,232 @@
 package equa
 
 import (
-	"errors"
+	"fmt"
 	"math/big"
-	"math/rand"
 	"time"
 
 	"github.com/equa/go-equa/common"
-	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/consensus/misc/eip1559"
+	"github.com/equa/go-equa/core/tracing"
 	"github.com/equa/go-equa/core/types"
-	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/params"
 )
 
-// selectProposer selects the next block proposer using hybrid PoS+PoW
-func (e *Equa) selectProposer(blockNumber uint64, parent *types.Header) (common.Address, error) {
-	// Get top validators by stake
-	topValidators := e.stakeManager.GetTopStakers(100)
-	if len(topValidators) == 0 {
-		return common.Address{}, errors.New("no validators available")
+// selectProposer returns the proposer of a block from the proposer schedule of
+// its epoch. The schedule only depends on the epoch boundary block and the stake
+// distribution after it, so every node arrives at the same proposer for a given
+// slot.
+func (e *Equa) selectProposer(chain consensus.ChainHeaderReader, blockNumber uint64, parent *types.Header) (common.Address, error) {
+	defer proposerSelectTimer.UpdateSince(time.Now())
+
+	schedule, err := e.blockSchedule(chain, blockNumber, parent)
+	if err != nil {
+		return common.Address{}, err
 	}
+	return schedule.Proposer(blockNumber), nil
+}
 
-	// For genesis block, select randomly
-	if blockNumber == 1 {
-		rand.Seed(time.Now().UnixNano())
-		return topValidators[rand.Intn(len(topValidators))].Address, nil
+// processMEVAndRewards handles MEV detection and reward distribution, returning
+// the MEV detected in the block and the reward credited for it.
+func (e *Equa) processMEVAndRewards(header *types.Header, state vm.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*big.Int, []*RewardCredit) {
+	// Detect MEV in the block, with the rules every node shares
+	totalMEV := e.mevDetector.detectConsensusMEV(txs, receipts, e.consensusBaseFee(header))
+
+	var credits []*RewardCredit
+	if totalMEV.Cmp(big.NewInt(0)) > 0 {
+		credits = append(credits, e.distributeMEV(header, state, totalMEV))
 	}
+	return totalMEV, credits
+}
 
-	// Use PoW to add randomness to validator selection
-	challenge := e.powEngine.GenerateChallenge(parent.Hash(), big.NewInt(int64(blockNumber)))
+// distributeMEV burns the configured share of the MEV detected in a block and
+// pays the remainder to the proposer, returning the reward credited.
+func (e *Equa) distributeMEV(header *types.Header, state vm.StateDB, totalMEV *big.Int) *RewardCredit {
+	// Split the MEV into the burned share (80%) and the proposer reward (20%)
+	burnAmount, proposerMEVReward := e.splitMEV(totalMEV)
 
-	// Each validator competes with weighted PoW
-	bestScore := big.NewInt(0)
-	var selectedValidator common.Address
+	// Burn MEV: send to zero address
+	burnAddress := common.Address{}
+	state.AddBalance(burnAddress, toUint256(burnAmount), tracing.BalanceChangeUnspecified)
 
-	for _, validator := range topValidators {
-		// Simple PoW competition: hash(challenge + validator_address)
-		data := append(challenge.Bytes(), validator.Address.Bytes()...)
-		hash := crypto.Keccak256Hash(data)
+	// Give MEV reward to proposer
+	credit := e.creditProposer(header, state, RewardMEV, proposerMEVReward)
 
-		// Calculate weighted score: hash_quality * stake_weight
-		stakeWeight := e.stakeManager.GetStakeWeight(validator.Address)
-		hashQuality := e.powEngine.CalculateQuality(hash)
+	// Emit MEV burn event
+	// TODO: Add event emission
+	return credit
+}
 
-		score := new(big.Int).Mul(hashQuality, stakeWeight)
+// splitMEV divides the MEV detected in a block into the share burned and the
+// share paid to the proposer.
+func (e *Equa) splitMEV(totalMEV *big.Int) (*big.Int, *big.Int) {
+	burned := percentOf(totalMEV, e.config.MEVBurnPercentage)
+	return burned, new(big.Int).Sub(totalMEV, burned)
+}
 
-		if score.Cmp(bestScore) > 0 {
-			bestScore = score
-			selectedValidator = validator.Address
-		}
+// applyBlockRewards applies block rewards to the proposer, returning the reward
+// credited.
+func (e *Equa) applyBlockRewards(header *types.Header, state vm.StateDB) *RewardCredit {
+	// Block reward: 2 EQUA per block, scaled by the class of the proposer's stake
+	// as registered in the state
+	multiplier := uint64(100)
+	if reg := newValidatorRegistry(state, e.config).get(header.Coinbase); reg.status == registrationActive {
+		multiplier = classRewardMultiplier(e.config, reg.stake)
 	}
+	blockReward := percentOf(new(big.Int).SetUint64(e.config.ValidatorReward), multiplier)
+	return e.creditProposer(header, state, RewardBlock, blockReward)
+}
 
-	if selectedValidator == (common.Address{}) {
-		// Fallback: select by stake only
-		return topValidators[0].Address, nil
+// txSender recovers the sender of a transaction with the chain's signer.
+func txSender(signer types.Signer, tx *types.Transaction) (common.Address, error) {
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w %x: %v", errInvalidSender, tx.Hash(), err)
 	}
-
-	return selectedValidator, nil
+	return from, nil
 }
 
-// processMEVAndRewards handles MEV detection and reward distribution
-func (e *Equa) processMEVAndRewards(header *types.Header, state *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) {
-	// Detect MEV in the block
-	totalMEV := e.mevDetector.DetectMEV(txs, receipts)
-
-	if totalMEV.Cmp(big.NewInt(0)) > 0 {
-		// Calculate burn amount (80% of MEV)
-		burnAmount := new(big.Int).Mul(totalMEV, big.NewInt(int64(e.config.MEVBurnPercentage)))
-		burnAmount.Div(burnAmount, big.NewInt(100))
-
-		// Calculate proposer reward (20% of MEV)
-		proposerMEVReward := new(big.Int).Sub(totalMEV, burnAmount)
-
-		// Burn MEV: send to zero address
-		burnAddress := common.Address{}
-		state.AddBalance(burnAddress, burnAmount)
-
-		// Give MEV reward to proposer
-		state.AddBalance(header.Coinbase, proposerMEVReward)
-
-		// Emit MEV burn event
-		// TODO: Add event emission
+// effectiveGasPrice returns the gas price a transaction pays in a block of the
+// given base fee, or its gas price if the base fee is nil. The gas price of a
+// dynamic fee transaction is its fee cap, which overstates what it pays and bids
+// for ordering.
+func effectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasPrice()
 	}
+	price := new(big.Int).Add(baseFee, tx.GasTipCap())
+	if price.Cmp(tx.GasFeeCap()) > 0 {
+		return tx.GasFeeCap()
+	}
+	return price
 }
 
-// applyBlockRewards applies block rewards to the proposer
-func (e *Equa) applyBlockRewards(header *types.Header, state *state.StateDB) {
-	// Block reward: 2 EQUA per block
-	blockReward := big.NewInt(int64(e.config.ValidatorReward))
-	state.AddBalance(header.Coinbase, blockReward)
+// nextBaseFee returns the base fee of the block after the given header, the one
+// pending transactions are priced with, or nil before London.
+func nextBaseFee(config *params.ChainConfig, parent *types.Header) *big.Int {
+	if !config.IsLondon(new(big.Int).Add(parent.Number, common.Big1)) {
+		return nil
+	}
+	return eip1559.CalcBaseFee(config, parent)
+}
 
-	// Update proposer's last block
-	e.stakeManager.UpdateLastBlock(header.Coinbase, header.Number.Uint64())
+// consensusBaseFee returns the base fee the MEV and slashing heuristics of the
+// state transition price a block's transactions with. It is nil, pricing them at
+// their gas price, unless effective gas prices are enabled.
+func (e *Equa) consensusBaseFee(header *types.Header) *big.Int {
+	if !e.config.FeatureEnabled(FeatureEffectiveGasPrice) {
+		return nil
+	}
+	return header.BaseFee
 }
 
-// hasEncryptedTxs checks if there are encrypted transactions in the block
-func (e *Equa) hasEncryptedTxs(txs []*types.Transaction) bool {
-	// Simple check: look for transactions with special flag or format
-	// In a full implementation, this would check for EncryptedTransaction type
-	for _, tx := range txs {
-		// Placeholder: check if transaction data starts with encryption marker
-		data := tx.Data()
-		if len(data) > 4 && string(data[:4]) == "ENCR" {
-			return true
-		}
+// creditProposer pays a proposal reward of the given kind to the block's
+// proposer, or into the smoothing pool if the proposer participates in it,
+// returning the credit.
+func (e *Equa) creditProposer(header *types.Header, state vm.StateDB, kind string, amount *big.Int) *RewardCredit {
+	recipient := header.Coinbase
+	if e.inSmoothingPool(state, header.Coinbase, scheduleEpoch(header.Number.Uint64(), e.config.Epoch)) {
+		recipient = SmoothingPoolAddress
 	}
-	return false
+	state.AddBalance(recipient, toUint256(amount), tracing.BalanceIncreaseRewardMineBlock)
+	return &RewardCredit{Recipient: recipient, Kind: kind, Amount: amount}
 }
 
-// decryptTransactions decrypts encrypted transactions using threshold cryptography
-func (e *Equa) decryptTransactions(txs []*types.Transaction) ([]*types.Transaction, error) {
-	decryptedTxs := make([]*types.Transaction, 0, len(txs))
-
-	for _, tx := range txs {
-		if e.isEncryptedTx(tx) {
-			// Get validator key shares
-			validators := e.stakeManager.GetValidators()
-			if len(validators) < int(e.config.ThresholdShares) {
-				return nil, errors.New("insufficient validators for threshold decryption")
-			}
-
-			// Collect key shares
-			keyShares := make([][]byte, 0, len(validators))
-			validatorAddrs := make([]common.Address, 0, len(validators))
-
-			for _, validator := range validators {
-				keyShares = append(keyShares, validator.KeyShare)
-				validatorAddrs = append(validatorAddrs, validator.Address)
-
-				if len(keyShares) >= int(e.config.ThresholdShares) {
-					break
-				}
-			}
-
-			// Decrypt transaction
-			decryptedTx, err := e.thresholdCrypto.DecryptTransaction(tx, keyShares)
-			if err != nil {
-				// Skip invalid encrypted transactions
-				continue
-			}
-
-			decryptedTxs = append(decryptedTxs, decryptedTx)
-		} else {
-			// Keep non-encrypted transactions as-is
-			decryptedTxs = append(decryptedTxs, tx)
+// distributeSmoothingPool shares the rewards accumulated in the smoothing pool
+// among the members of the epoch ending with the given boundary block, pro-rata
+// to their stake, returning the shares credited. Any rounding remainder stays in
+// the pool for the next epoch.
+func (e *Equa) distributeSmoothingPool(header *types.Header, state vm.StateDB) []*RewardCredit {
+	members := e.smoothingPoolMembers(state, scheduleEpoch(header.Number.Uint64(), e.config.Epoch))
+	if len(members) == 0 {
+		return nil
+	}
+	pooled := state.GetBalance(SmoothingPoolAddress).ToBig()
+	if pooled.Sign() == 0 {
+		return nil
+	}
+	totalStake := new(big.Int)
+	for _, member := range members {
+		totalStake.Add(totalStake, member.stake)
+	}
+	if totalStake.Sign() == 0 {
+		return nil
+	}
+	var (
+		distributed = new(big.Int)
+		credits     []*RewardCredit
+	)
+	for _, member := range members {
+		share := new(big.Int).Mul(pooled, member.stake)
+		share.Div(share, totalStake)
+		if share.Sign() == 0 {
+			continue
 		}
+		state.AddBalance(member.address, toUint256(share), tracing.BalanceIncreaseRewardMineBlock)
+		paid := new(big.Int).Add(smoothedRewards(state, member.address), share)
+		setSmoothingState(state, smoothingKey(member.address, smoothingPaidSlot), common.BigToHash(paid))
+		distributed.Add(distributed, share)
+		credits = append(credits, &RewardCredit{Recipient: member.address, Kind: RewardSmoothing, Amount: share})
 	}
-
-	return decryptedTxs, nil
+	state.SubBalance(SmoothingPoolAddress, toUint256(distributed), tracing.BalanceChangeUnspecified)
+	return credits
 }
 
-// isEncryptedTx checks if a transaction is encrypted
-func (e *Equa) isEncryptedTx(tx *types.Transaction) bool {
-	// Simple check for encrypted transaction marker
-	data := tx.Data()
-	return len(data) > 4 && string(data[:4]) == "ENCR"
+// slashingViolation is a slashable offense detected in a block.
+type slashingViolation struct {
+	reason     string // Kind of violation, as understood by CalculateSlashingAmount
+	percentage uint64 // Share of the proposer's stake to slash
 }
 
-// checkSlashingConditions checks for slashing conditions and applies penalties
-func (e *Equa) checkSlashingConditions(header *types.Header, txs []*types.Transaction, receipts []*types.Receipt) error {
-	proposer := header.Coinbase
-
+// detectSlashingViolations runs the slashing detectors over the transactions
+// and receipts of a block, returning the offenses of its proposer.
+func (e *Equa) detectSlashingViolations(header *types.Header, txs []*types.Transaction, receipts []*types.Receipt) []slashingViolation {
+	var (
+		proposer = header.Coinbase
+		baseFee  = e.consensusBaseFee(header)
+	)
+	var violations []slashingViolation
 	// Check for MEV extraction by proposer
-	if e.slasher.DetectMEVExtraction(proposer, txs, receipts) {
-		err := e.stakeManager.SlashValidator(proposer, e.config.SlashingPercentage, "MEV extraction")
-		if err != nil {
-			return err
-		}
+	if e.slasher.DetectMEVExtraction(proposer, txs, receipts, baseFee) {
+		violations = append(violations, slashingViolation{"MEV extraction", e.slasher.SlashingPercentage("MEV extraction")})
 	}
-
 	// Check for transaction reordering
-	if e.slasher.DetectTxReordering(txs) {
-		err := e.stakeManager.SlashValidator(proposer, 10, "Transaction reordering")
-		if err != nil {
-			return err
-		}
+	if e.slasher.DetectTxReordering(txs, baseFee) {
+		violations = append(violations, slashingViolation{"Transaction reordering", e.slasher.SlashingPercentage("Transaction reordering")})
 	}
-
-	// Check for censorship
-	if e.slasher.DetectCensorship(txs) {
-		err := e.stakeManager.SlashValidator(proposer, 20, "Transaction censorship")
-		if err != nil {
-			return err
-		}
+	// Check for censorship, unless the block complies with a publicly declared
+	// filter, in which case the exclusions are overt rather than covert
+	if e.slasher.DetectCensorship(txs, baseFee) && !e.declaredFilterApplies(proposer, txs) {
+		violations = append(violations, slashingViolation{"Transaction censorship", e.slasher.SlashingPercentage("Transaction censorship")})
 	}
-
-	return nil
+	return violations
 }
 
-// validateProposer checks if the block proposer is valid
-func (e *Equa) validateProposer(header *types.Header, parent *types.Header) error {
-	// Check if proposer has sufficient stake
-	if !e.stakeManager.IsEligible(header.Coinbase) {
-		return errInsufficientStake
-	}
+// declaredFilterApplies checks whether the proposer has declared a contract
+// filter and the block complies with it.
+func (e *Equa) declaredFilterApplies(proposer common.Address, txs []*types.Transaction) bool {
+	validator, exists := e.stakeManager.GetValidator(proposer)
+	return exists && validator.Filter != nil && validator.Filter.Complies(txs)
+}
 
-	// Verify proposer was correctly selected
-	expectedProposer, err := e.selectProposer(header.Number.Uint64(), parent)
+// validateProposer checks if the block proposer is valid. Proposers are drawn
+// from the eligible validators fixed in the state at the epoch boundary, so the
+// one scheduled is eligible by construction.
+func (e *Equa) validateProposer(chain consensus.ChainHeaderReader, header *types.Header, parent *types.Header) error {
+	schedule, err := e.blockSchedule(chain, header.Number.Uint64(), parent)
 	if err != nil {
 		return err
 	}
+	return checkProposer(header, schedule)
+}
 
-	if header.Coinbase != expectedProposer {
-		return errInvalidValidator
+// checkProposer checks that the coinbase of a header is the proposer scheduled
+// for its height in the given schedule.
+func checkProposer(header *types.Header, schedule *ProposerSchedule) error {
+	if expected := schedule.Proposer(header.Number.Uint64()); header.Coinbase != expected {
+		return fmt.Errorf("%w: have %s, want %s", errUnauthorizedProposer, header.Coinbase, expected)
 	}
-
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,626 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+	"github.com/holiman/uint256"
+)
+
+// newTestChainConfig returns a chain config with all forks enabled, using the
+// given EQUA configuration.
+func newTestChainConfig(config *params.EquaConfig) *params.ChainConfig {
+	chainConfig := *params.MergedTestChainConfig
+	chainConfig.Ethash = nil
+	chainConfig.Equa = config
+	return &chainConfig
+}
+
+// newTestEngine creates an EQUA engine backed by an in-memory database with the
+// given validators, each staking the given amount of whole EQUA.
+func newTestEngine(t *testing.T, stake int64, validators ...common.Address) *Equa {
+	t.Helper()
+
+	config := &params.EquaConfig{PoWDifficulty: 1000}
+	for _, addr := range validators {
+		config.InitialValidators = append(config.InitialValidators, params.EquaInitialValidator{
+			Address: addr,
+			Stake:   new(big.Int).Mul(big.NewInt(stake), big.NewInt(1e18)),
+		})
+	}
+	return New(newTestChainConfig(config), rawdb.NewMemoryDatabase())
+}
+
+// testHeaderChain is an in-memory chain of headers, indexed by number, along
+// with their states.
+type testHeaderChain struct {
+	config  *params.ChainConfig
+	headers []*types.Header
+	states  state.Database
+}
+
+func (c *testHeaderChain) Config() *params.ChainConfig  { return c.config }
+func (c *testHeaderChain) CurrentHeader() *types.Header { return c.headers[len(c.headers)-1] }
+
+func (c *testHeaderChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.GetHeaderByNumber(number); header != nil && header.Hash() == hash {
+		return header
+	}
+	return nil
+}
+
+func (c *testHeaderChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number < uint64(len(c.headers)) {
+		return c.headers[number]
+	}
+	return nil
+}
+
+// StateAt returns the state with the given root, headers without one standing
+// for the empty state.
+func (c *testHeaderChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	if c.states == nil {
+		c.states = state.NewDatabaseForTesting()
+	}
+	if root == (common.Hash{}) {
+		root = types.EmptyRootHash
+	}
+	return state.New(root, c.states)
+}
+
+func (c *testHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, header := range c.headers {
+		if header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
+
+// testImportEngine is an EQUA engine accepting any header, for generated blocks
+// to be imported without sealing them.
+type testImportEngine struct {
+	*Equa
+}
+
+func (e testImportEngine) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header) error {
+	return nil
+}
+
+func (e testImportEngine) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header) (chan<- struct{}, <-chan error) {
+	results := make(chan error, len(headers))
+	for range headers {
+		results <- nil
+	}
+	return make(chan struct{}), results
+}
+
+// firstTestSchedule draws the proposer schedule of the first epoch of a chain
+// with the given genesis from the validators of the engine.
+func firstTestSchedule(t *testing.T, engine *Equa, genesis *core.Genesis) *ProposerSchedule {
+	t.Helper()
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	schedule, err := drawSchedule(0, genesis.ToBlock().Hash(), engine.config.Epoch, newValidatorRegistry(statedb, engine.config).proposers())
+	if err != nil {
+		t.Fatalf("failed to draw schedule: %v", err)
+	}
+	return schedule
+}
+
+// importTestChain generates blocks proposed as scheduled by the validators of
+// the engine, which must not change along the chain, on top of a genesis funding
+// the given accounts, and imports them into a new chain the engine follows.
+func importTestChain(t *testing.T, engine *Equa, funded []common.Address, n int, gen func(int, *core.BlockGen)) (*core.BlockChain, []*types.Block) {
+	t.Helper()
+
+	genesis := &core.Genesis{
+		Config: newTestChainConfig(engine.config),
+		Alloc:  make(types.GenesisAlloc),
+	}
+	for _, addr := range funded {
+		genesis.Alloc[addr] = types.Account{Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))}
+	}
+	schedule := firstTestSchedule(t, engine, genesis)
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, testImportEngine{engine}, n, func(i int, b *core.BlockGen) {
+		// Later epochs are drawn from the same validators, seeded with the
+		// boundary block ending the previous one
+		if number := uint64(i + 1); number == schedule.First+uint64(len(schedule.Proposers)) {
+			next, err := drawSchedule(schedule.Epoch+1, b.PrevBlock(i-1).Hash(), engine.config.Epoch, schedule.validators)
+			if err != nil {
+				t.Fatalf("failed to draw schedule: %v", err)
+			}
+			schedule = next
+		}
+		b.SetCoinbase(schedule.Proposer(uint64(i + 1)))
+		gen(i, b)
+	})
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), genesis, testImportEngine{engine}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	engine.loadValidators(chain)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	engine.followChain(chain)
+	return chain, blocks
+}
+
+// testSandwichProfit is the MEV extracted by the transactions of sandwichTxs.
+var testSandwichProfit = new(big.Int).Sub(big.NewInt(1e18), big.NewInt(1))
+
+// sandwichTxs signs a swap of the victim wrapped by two swaps of the bot on the
+// same router, the first transactions of both accounts.
+func sandwichTxs(config *params.ChainConfig, bot, victim *ecdsa.PrivateKey) []*types.Transaction {
+	var (
+		router = common.Address{0xaa}
+		swap   = []byte{0x38, 0xed, 0x17, 0x39, 0x00}
+		signer = types.LatestSigner(config)
+	)
+	sign := func(key *ecdsa.PrivateKey, nonce uint64, value *big.Int) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: nonce, To: &router, Value: value, Gas: 100000, GasPrice: big.NewInt(params.GWei), Data: swap})
+	}
+	return []*types.Transaction{
+		sign(bot, 0, big.NewInt(1)),
+		sign(victim, 0, big.NewInt(1)),
+		sign(bot, 1, big.NewInt(1e18)),
+	}
+}
+
+// Tests that the MEV detected in an imported block is burned, the receipts it is
+// detected from being available on import.
+func TestImportMEVBurn(t *testing.T) {
+	var (
+		validator = common.Address{0x01}
+		bot, _    = crypto.GenerateKey()
+		victim, _ = crypto.GenerateKey()
+		engine    = newTestEngine(t, 32, validator)
+		funded    = []common.Address{crypto.PubkeyToAddress(bot.PublicKey), crypto.PubkeyToAddress(victim.PublicKey)}
+	)
+	chain, blocks := importTestChain(t, engine, funded, 1, func(i int, b *core.BlockGen) {
+		for _, tx := range sandwichTxs(newTestChainConfig(engine.config), bot, victim) {
+			b.AddTx(tx)
+		}
+	})
+	statedb, err := chain.StateAt(blocks[0].Root())
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	burned := statedb.GetBalance(common.Address{})
+	if burned.IsZero() {
+		t.Fatal("no MEV burned in imported sandwich")
+	}
+	if want, _ := engine.splitMEV(testSandwichProfit); burned.ToBig().Cmp(want) != 0 {
+		t.Fatalf("burn mismatch: have %v, want %v", burned, want)
+	}
+}
+
+// Tests that proposer selection is reproducible and that headers carrying a
+// coinbase other than the selected proposer are refused.
+func TestValidateProposer(t *testing.T) {
+	validators := []common.Address{
+		common.HexToAddress("0x1000000000000000000000000000000000000001"),
+		common.HexToAddress("0x2000000000000000000000000000000000000002"),
+		common.HexToAddress("0x3000000000000000000000000000000000000003"),
+	}
+	engine := newTestEngine(t, 32, validators...)
+
+	chain := &testHeaderChain{config: newTestChainConfig(engine.config)}
+	for number := int64(0); number < 10; number++ {
+		header := &types.Header{Number: big.NewInt(number), Time: uint64(number)}
+		if number > 0 {
+			header.ParentHash = chain.CurrentHeader().Hash()
+		}
+		chain.headers = append(chain.headers, header)
+	}
+	parent := chain.CurrentHeader()
+	selected, err := engine.selectProposer(chain, 10, parent)
+	if err != nil {
+		t.Fatalf("failed to select proposer: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := engine.selectProposer(chain, 10, parent)
+		if err != nil {
+			t.Fatalf("failed to reselect proposer: %v", err)
+		}
+		if again != selected {
+			t.Fatalf("proposer selection not deterministic: have %s, want %s", again, selected)
+		}
+	}
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(10), Coinbase: selected}
+	if err := engine.validateProposer(chain, header, parent); err != nil {
+		t.Fatalf("selected proposer rejected: %v", err)
+	}
+	for _, addr := range validators {
+		if addr == selected {
+			continue
+		}
+		header.Coinbase = addr
+		if err := engine.validateProposer(chain, header, parent); !errors.Is(err, errUnauthorizedProposer) {
+			t.Errorf("mis-attributed block from %s: have %v, want %v", addr, err, errUnauthorizedProposer)
+		}
+	}
+	header.Coinbase = common.HexToAddress("0xdead")
+	if err := engine.validateProposer(chain, header, parent); !errors.Is(err, errUnauthorizedProposer) {
+		t.Errorf("unstaked proposer: have %v, want %v", err, errUnauthorizedProposer)
+	}
+}
+
+// Tests that the proposer of a block whose parent state is unavailable is not
+// taken on trust: the block is left to be imported once the state is there, and
+// its proposer is checked when it is processed.
+func TestDeferredProposerCheck(t *testing.T) {
+	validators := []common.Address{
+		common.HexToAddress("0x1000000000000000000000000000000000000001"),
+		common.HexToAddress("0x2000000000000000000000000000000000000002"),
+		common.HexToAddress("0x3000000000000000000000000000000000000003"),
+	}
+	engine := newTestEngine(t, 32, validators...)
+
+	// The state of the parent, that of its ancestors, is missing
+	chain := &testBlockChain{
+		testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+		blocks:          make(map[common.Hash]*types.Block),
+	}
+	for number := int64(0); number < 10; number++ {
+		header := &types.Header{Number: big.NewInt(number), Time: uint64(number), Root: common.Hash{0x01}}
+		if number > 0 {
+			header.ParentHash = chain.CurrentHeader().Hash()
+		}
+		chain.headers = append(chain.headers, header)
+	}
+	parent := chain.CurrentHeader()
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	schedule, err := drawSchedule(0, chain.headers[0].Hash(), engine.config.Epoch, newValidatorRegistry(statedb, engine.config).proposers())
+	if err != nil {
+		t.Fatalf("failed to draw schedule: %v", err)
+	}
+	selected := schedule.Proposer(10)
+	var other common.Address
+	for _, addr := range validators {
+		if addr != selected {
+			other = addr
+		}
+	}
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(10), Coinbase: other}
+	if err := engine.verifyScheduled(chain, header, parent); !errors.Is(err, errStateUnavailable) {
+		t.Fatalf("proposer checked without the parent state: %v", err)
+	}
+	if err := engine.VerifyUncles(chain, types.NewBlockWithHeader(header)); !errors.Is(err, consensus.ErrPrunedAncestor) {
+		t.Fatalf("block accepted without the parent state: have %v, want %v", err, consensus.ErrPrunedAncestor)
+	}
+	// Processing the block on the state checks the proposer
+	if err := engine.FinalizeWithReceipts(chain, header, statedb.Copy(), &types.Body{}, nil); !errors.Is(err, errUnauthorizedProposer) {
+		t.Fatalf("mis-attributed block processed: have %v, want %v", err, errUnauthorizedProposer)
+	}
+	header.Coinbase = selected
+	if err := engine.FinalizeWithReceipts(chain, header, statedb.Copy(), &types.Body{}, nil); err != nil {
+		t.Fatalf("scheduled block rejected: %v", err)
+	}
+}
+
+// Tests that proposal rewards of smoothing pool members are pooled and shared
+// pro-rata to stake, while non-members keep their own rewards, membership and
+// payouts being kept in the state. Joins and leaves take effect from the next
+// epoch, so validators joining late in an epoch do not share its pool.
+func TestSmoothingPool(t *testing.T) {
+	var (
+		smallKey, _ = crypto.GenerateKey()
+		largeKey, _ = crypto.GenerateKey()
+		soloKey, _  = crypto.GenerateKey()
+		small       = crypto.PubkeyToAddress(smallKey.PublicKey)
+		large       = crypto.PubkeyToAddress(largeKey.PublicKey)
+		solo        = crypto.PubkeyToAddress(soloKey.PublicKey)
+	)
+	engine := newTestEngine(t, 32, small, solo)
+	engine.config.InitialValidators = append(engine.config.InitialValidators, params.EquaInitialValidator{
+		Address: large,
+		Stake:   new(big.Int).Mul(big.NewInt(96), big.NewInt(1e18)),
+	})
+	engine.config.Epoch = 4
+	engine.config.ValidatorReward = 1000
+
+	signer := types.LatestSigner(newTestChainConfig(engine.config))
+	membership := func(key *ecdsa.PrivateKey, nonce uint64, data []byte) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: nonce, To: &SmoothingPoolAddress, Gas: 100000, GasPrice: big.NewInt(params.GWei), Data: data})
+	}
+	header := func(number int64, coinbase common.Address) *types.Header {
+		return &types.Header{Number: big.NewInt(number), Coinbase: coinbase}
+	}
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	engine.processSmoothingMembership(header(1, small), statedb, []*types.Transaction{
+		membership(smallKey, 0, smoothingJoin),
+		membership(largeKey, 0, smoothingJoin),
+		membership(largeKey, 1, []byte("other")),
+	})
+	if members := engine.smoothingPoolMembers(statedb, 0); len(members) != 0 {
+		t.Fatalf("joins in effect in the epoch they were made in: %v", members)
+	}
+	// Only the small member and the solo validator propose during the next
+	// epoch, the solo validator joining in the last block before the boundary
+	engine.applyBlockRewards(header(5, small), statedb)
+	engine.applyBlockRewards(header(6, small), statedb)
+	engine.processSmoothingMembership(header(7, solo), statedb, []*types.Transaction{membership(soloKey, 0, smoothingJoin)})
+	engine.applyBlockRewards(header(7, solo), statedb)
+
+	if have := statedb.GetBalance(small); !have.IsZero() {
+		t.Fatalf("pool member paid directly: %v", have)
+	}
+	if have, want := statedb.GetBalance(SmoothingPoolAddress), uint256.NewInt(2000); !have.Eq(want) {
+		t.Fatalf("pool balance mismatch: have %v, want %v", have, want)
+	}
+	engine.distributeSmoothingPool(header(8, small), statedb)
+
+	for addr, want := range map[common.Address]uint64{small: 500, large: 1500, solo: 1000, SmoothingPoolAddress: 0} {
+		if have := statedb.GetBalance(addr); !have.Eq(uint256.NewInt(want)) {
+			t.Errorf("balance mismatch for %s: have %v, want %d", addr, have, want)
+		}
+	}
+	for addr, want := range map[common.Address]int64{small: 500, large: 1500, solo: 0} {
+		if have := smoothedRewards(statedb, addr); have.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("smoothed rewards mismatch for %s: have %v, want %d", addr, have, want)
+		}
+	}
+	// The pool keeps its storage once emptied
+	statedb.Finalise(true)
+	if !statedb.Exist(SmoothingPoolAddress) {
+		t.Fatalf("emptied pool deleted")
+	}
+	engine.processSmoothingMembership(header(9, large), statedb, []*types.Transaction{membership(smallKey, 1, smoothingLeave)})
+	if members := engine.smoothingPoolMembers(statedb, 2); len(members) != 3 {
+		t.Fatalf("pool members mismatch before leave takes effect: have %d, want 3", len(members))
+	}
+	members := engine.smoothingPoolMembers(statedb, 3)
+	if len(members) != 2 || slices.ContainsFunc(members, func(reg *registration) bool { return reg.address == small }) {
+		t.Fatalf("pool members mismatch once leave takes effect: %v", members)
+	}
+	// Stake held by the engine alone does not make a member
+	offchainKey, _ := crypto.GenerateKey()
+	offchain := crypto.PubkeyToAddress(offchainKey.PublicKey)
+	engine.stakeManager.AddValidator(offchain, new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)), nil)
+	engine.processSmoothingMembership(header(9, large), statedb, []*types.Transaction{membership(offchainKey, 0, smoothingJoin)})
+	if engine.inSmoothingPool(statedb, offchain, 3) {
+		t.Fatalf("validator unregistered in state joined the pool")
+	}
+}
+
+// Tests that the rewards paid from the smoothing pool are accounted for once
+// in the state of imported blocks, the block being finalized both when it is
+// assembled and when it is imported. The validator joins in the first epoch and
+// shares the pool of the second.
+func TestImportSmoothingPool(t *testing.T) {
+	var (
+		key, _    = crypto.GenerateKey()
+		validator = crypto.PubkeyToAddress(key.PublicKey)
+		engine    = newTestEngine(t, 32, validator)
+	)
+	engine.config.Epoch = 2
+	engine.config.ValidatorReward = 1000
+
+	signer := types.LatestSigner(newTestChainConfig(engine.config))
+	chain, blocks := importTestChain(t, engine, []common.Address{validator}, 4, func(i int, b *core.BlockGen) {
+		if i == 0 {
+			b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{To: &SmoothingPoolAddress, Gas: 100000, GasPrice: big.NewInt(params.GWei), Data: smoothingJoin}))
+		}
+	})
+	statedb, err := chain.StateAt(blocks[3].Root())
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	if !statedb.GetBalance(SmoothingPoolAddress).IsZero() {
+		t.Fatalf("pool not distributed at the epoch boundary: %v", statedb.GetBalance(SmoothingPoolAddress))
+	}
+	if have, want := smoothedRewards(statedb, validator), big.NewInt(2000); have.Cmp(want) != 0 {
+		t.Fatalf("smoothed rewards mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that senders are recovered with the chain's signer for every supported
+// transaction type, and that transactions signed for another chain are rejected
+// instead of being attributed to the zero address.
+func TestTxSender(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		config = params.MergedTestChainConfig
+		signer = types.LatestSigner(config)
+		to     = common.Address{0x01}
+	)
+	txs := map[string]types.TxData{
+		"legacy": &types.LegacyTx{Nonce: 0, To: &to, Gas: 21000, GasPrice: big.NewInt(1)},
+		"dynamic": &types.DynamicFeeTx{ChainID: config.ChainID, To: &to, Gas: 21000,
+			GasFeeCap: big.NewInt(1), GasTipCap: big.NewInt(1)},
+		"blob": &types.BlobTx{ChainID: uint256.MustFromBig(config.ChainID), To: to, Gas: 21000,
+			GasFeeCap: uint256.NewInt(1), GasTipCap: uint256.NewInt(1), BlobFeeCap: uint256.NewInt(1),
+			BlobHashes: []common.Hash{{0x01}}},
+	}
+	for name, data := range txs {
+		tx := types.MustSignNewTx(key, signer, data)
+		if from, err := txSender(signer, tx); err != nil || from != addr {
+			t.Errorf("%s: sender mismatch: have %x (%v), want %x", name, from, err, addr)
+		}
+	}
+	foreign := types.LatestSignerForChainID(new(big.Int).Add(config.ChainID, common.Big1))
+	tx := types.MustSignNewTx(key, foreign, &types.DynamicFeeTx{ChainID: foreign.ChainID(), To: &to, Gas: 21000})
+	if _, err := txSender(signer, tx); !errors.Is(err, errInvalidSender) {
+		t.Errorf("foreign transaction: error mismatch: have %v, want %v", err, errInvalidSender)
+	}
+}
+
+// Tests that senders are recovered once across decoded copies of a transaction.
+func TestCachingSigner(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		config = params.MergedTestChainConfig
+		signer = newCachingSigner(types.LatestSigner(config), 16)
+		to     = common.Address{0x01}
+	)
+	tx := types.MustSignNewTx(key, signer, &types.DynamicFeeTx{ChainID: config.ChainID, To: &to, Gas: 21000})
+	if from, err := txSender(signer, tx); err != nil || from != addr {
+		t.Fatalf("sender mismatch: have %x (%v), want %x", from, err, addr)
+	}
+	if _, ok := signer.senders.Get(tx.Hash()); !ok {
+		t.Fatalf("sender not cached")
+	}
+	blob, _ := tx.MarshalBinary()
+	decoded := new(types.Transaction)
+	if err := decoded.UnmarshalBinary(blob); err != nil {
+		t.Fatalf("failed to decode transaction: %v", err)
+	}
+	signer.senders.Add(decoded.Hash(), common.Address{0xff})
+	if from, _ := txSender(signer, decoded); from != (common.Address{0xff}) {
+		t.Errorf("decoded transaction recovered again: have %x", from)
+	}
+	if !signer.Equal(types.LatestSigner(config)) || !signer.Equal(newCachingSigner(types.LatestSigner(config), 1)) {
+		t.Errorf("caching signer not equal to the signer it wraps")
+	}
+	foreign := types.LatestSignerForChainID(new(big.Int).Add(config.ChainID, common.Big1))
+	tx = types.MustSignNewTx(key, foreign, &types.DynamicFeeTx{ChainID: foreign.ChainID(), To: &to, Gas: 21000})
+	if _, err := txSender(signer, tx); !errors.Is(err, errInvalidSender) {
+		t.Errorf("foreign transaction: error mismatch: have %v, want %v", err, errInvalidSender)
+	}
+	if signer.senders.Contains(tx.Hash()) {
+		t.Errorf("failed recovery cached")
+	}
+}
+
+// Tests that the ordering score of locally assembled blocks is answered from the
+// verdict computed during assembly, and only for the local proposal.
+func TestOwnAssessment(t *testing.T) {
+	var (
+		proposer = common.Address{0x01}
+		engine   = newTestEngine(t, 32, proposer)
+		chain    = &testHeaderChain{config: newTestChainConfig(engine.config)}
+		txs      = newTestTransactions(t, 3)
+	)
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	header := &types.Header{Number: big.NewInt(1), Coinbase: proposer, Difficulty: common.Big1}
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb, &types.Body{Transactions: txs}, nil)
+	if err != nil {
+		t.Fatalf("failed to assemble block: %v", err)
+	}
+	chain.headers = []*types.Header{{Number: common.Big0}, block.Header()}
+	api := &API{chain: chain, equa: engine}
+
+	score := api.GetOrderingScore(1)
+	if score["ownProposal"] != true || score["orderingScore"] != engine.fairOrderer.GetOrderingScore(block.Transactions()) {
+		t.Fatalf("own proposal not answered from assembly: %v", score)
+	}
+	// The same transactions proposed by another validator are scored afresh
+	other := block.Header()
+	other.Coinbase = common.Address{0x02}
+	chain.headers[1] = other
+	if score := api.GetOrderingScore(1); score["ownProposal"] != nil {
+		t.Fatalf("foreign proposal answered from assembly: %v", score)
+	}
+}
+
+// Tests that assembling and processing a block, epoch boundary included, leave
+// the engine alone: the activations, the last proposed blocks and the slashing
+// evidence only change, and the rewards recorded only count, once the block is
+// written as canonical.
+func TestAssembleWithoutSideEffects(t *testing.T) {
+	var (
+		proposer = common.Address{0x01}
+		joiner   = common.Address{0x02}
+		engine   = newTestEngine(t, 32, proposer)
+	)
+	engine.config.Epoch = 2
+	engine.config.ValidatorReward = 1000
+
+	ev := &Evidence{Validator: proposer, Block: 0, Violation: violationFalseStatement}
+	if err := engine.slasher.SubmitEvidence(ev, 0); err != nil {
+		t.Fatalf("failed to submit evidence: %v", err)
+	}
+	engine.config.EvidenceMaxAge = 0
+
+	chain := &testBlockChain{
+		testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config), states: state.NewDatabaseForTesting()},
+		blocks:          make(map[common.Hash]*types.Block),
+	}
+	statedb, _ := state.New(types.EmptyRootHash, chain.states)
+	newValidatorRegistry(statedb, engine.config).enqueue(joiner, new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)), nil, 0)
+	genesis := &types.Header{Number: common.Big0}
+	parent := &types.Header{Number: common.Big1, ParentHash: genesis.Hash(), Root: statedb.IntermediateRoot(true)}
+	chain.headers = append(chain.headers, genesis, parent)
+	engine.stakeManager.load(statedb, parent.Hash())
+
+	header := &types.Header{Number: big.NewInt(2), Coinbase: proposer, ParentHash: parent.Hash(), Difficulty: big.NewInt(1)}
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb.Copy(), &types.Body{}, nil)
+	if err != nil {
+		t.Fatalf("failed to assemble block: %v", err)
+	}
+	// Neither assembling nor processing the block touches the engine
+	if err := engine.FinalizeWithReceipts(chain, block.Header(), statedb, &types.Body{}, nil); err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if reg := newValidatorRegistry(statedb, engine.config).get(joiner); reg.status != registrationActive {
+		t.Fatalf("joiner not activated in the state: status %d", reg.status)
+	}
+	if _, active := engine.stakeManager.GetValidator(joiner); active {
+		t.Errorf("joiner activated in the engine before the block was written")
+	}
+	if validator, _ := engine.stakeManager.GetValidator(proposer); validator.LastBlock != 0 {
+		t.Errorf("last block updated before the block was written: %d", validator.LastBlock)
+	}
+	if len(engine.slasher.evidence) != 1 {
+		t.Errorf("evidence pruned before the block was written")
+	}
+	if rewards, _ := engine.validatorRewards(chain, proposer, 1, 1); len(rewards.Epochs) != 0 {
+		t.Errorf("rewards recorded before the block was written: %v", rewards.Epochs)
+	}
+	// Writing the block as canonical applies them
+	if root, _ := statedb.Commit(2, true, false); root != block.Root() {
+		t.Fatalf("state root mismatch: have %x, want %x", root, block.Root())
+	}
+	chain.headers = append(chain.headers, block.Header())
+	chain.blocks[block.Hash()] = block
+	engine.followChain(chain)
+
+	if _, active := engine.stakeManager.GetValidator(joiner); !active {
+		t.Errorf("joiner not activated once written")
+	}
+	if validator, _ := engine.stakeManager.GetValidator(proposer); validator.LastBlock != 2 {
+		t.Errorf("last block not updated once written: %d", validator.LastBlock)
+	}
+	if len(engine.slasher.evidence) != 0 {
+		t.Errorf("expired evidence kept once written")
+	}
+	if rewards, _ := engine.validatorRewards(chain, proposer, 1, 1); len(rewards.Epochs) != 1 {
+		t.Errorf("rewards not recorded once written: %v", rewards.Epochs)
+	}
+	if engine.stakeManager.followed() != block.Hash() {
+		t.Errorf("written block not followed")
+	}
+}
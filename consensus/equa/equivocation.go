@@ -0,0 +1,197 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/lru"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/rlp"
+)
+
+// A proposer signs the compliance statement of its block over the parent, the
+// height and the transactions of the block. Two statements of the same proposer
+// for different blocks at the same height prove that it proposed twice, which
+// is slashed in full like double signing on the beacon chain. Anyone who saw
+// both headers can prove it, the headers carry everything needed.
+
+// violationDoubleProposal is the slashing violation for signing the compliance
+// statements of two different blocks at the same height.
+const violationDoubleProposal = "Double proposal"
+
+const (
+	// proposalMemory is the number of signed proposals remembered by height and
+	// proposer to detect double proposals.
+	proposalMemory = 1024
+
+	// doubleProposalProofType is the leading byte of evidence transactions
+	// carrying a DoubleProposalProof, telling them apart from the RLP list of a
+	// SlashingProof.
+	doubleProposalProofType = 0x01
+)
+
+var (
+	errNotDoubleProposal     = errors.New("headers do not prove a double proposal")
+	errDoubleProposal        = errors.New("refusing to seal a second block at the same height")
+	errUnknownDoubleProposal = errors.New("no double proposal detected")
+)
+
+// DoubleProposalProof proves that a validator signed the compliance statements
+// of two different blocks at the same height.
+type DoubleProposalProof struct {
+	First  *types.Header
+	Second *types.Header
+}
+
+// verify checks that the proof shows a double proposal, returning the evidence
+// of the offense.
+func (p *DoubleProposalProof) verify() (*Evidence, error) {
+	if p.First == nil || p.Second == nil || p.First.Number == nil || p.Second.Number == nil {
+		return nil, fmt.Errorf("%w: missing header", errNotDoubleProposal)
+	}
+	if p.First.Number.Cmp(p.Second.Number) != 0 || p.First.Coinbase != p.Second.Coinbase {
+		return nil, fmt.Errorf("%w: different heights or proposers", errNotDoubleProposal)
+	}
+	first, err := decodeStatement(p.First)
+	if err != nil {
+		return nil, err
+	}
+	second, err := decodeStatement(p.Second)
+	if err != nil {
+		return nil, err
+	}
+	// Sealing the same block twice is fine, signing two different ones is not
+	firstHash := crypto.Keccak256Hash(statementSigData(p.First, first.Policy, first.Inputs))
+	secondHash := crypto.Keccak256Hash(statementSigData(p.Second, second.Policy, second.Inputs))
+	if firstHash == secondHash {
+		return nil, fmt.Errorf("%w: same block signed", errNotDoubleProposal)
+	}
+	return &Evidence{
+		Validator: p.First.Coinbase,
+		Block:     p.First.Number.Uint64(),
+		Violation: violationDoubleProposal,
+	}, nil
+}
+
+// offense returns the header of the block the offense was committed in.
+func (p *DoubleProposalProof) offense() *types.Header {
+	return p.Second
+}
+
+// encode returns the proof as the data of an evidence transaction.
+func (p *DoubleProposalProof) encode() ([]byte, error) {
+	enc, err := rlp.EncodeToBytes(p)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{doubleProposalProofType}, enc...), nil
+}
+
+// proposalKey identifies the proposal of a validator at a height.
+type proposalKey struct {
+	number   uint64
+	proposer common.Address
+}
+
+// proposals remembers the headers of recently verified proposals, along with
+// the double proposals they revealed.
+type proposals struct {
+	seen    *lru.Cache[proposalKey, *types.Header]
+	doubles *lru.Cache[common.Hash, *DoubleProposalProof] // Proofs by evidence hash
+}
+
+// newProposals creates an empty proposal memory.
+func newProposals() *proposals {
+	return &proposals{
+		seen:    lru.NewCache[proposalKey, *types.Header](proposalMemory),
+		doubles: lru.NewCache[common.Hash, *DoubleProposalProof](proposalMemory),
+	}
+}
+
+// recordProposal remembers a verified header carrying a compliance statement,
+// reporting its proposer if it signed a different block at the same height
+// before.
+func (e *Equa) recordProposal(chain consensus.ChainHeaderReader, header *types.Header) {
+	key := proposalKey{number: header.Number.Uint64(), proposer: header.Coinbase}
+	prev, ok := e.proposals.seen.Get(key)
+	if !ok {
+		e.proposals.seen.Add(key, header)
+		return
+	}
+	proof := &DoubleProposalProof{First: prev, Second: header}
+	ev, err := proof.verify()
+	if err != nil {
+		return
+	}
+	e.proposals.doubles.Add(ev.Hash(), proof)
+
+	// The header may be ahead of the chain while syncing, it is verified though
+	head := max(chain.CurrentHeader().Number.Uint64(), ev.Block)
+	if err := e.submitEvidence(ev, head); err == nil {
+		log.Warn("Double proposal detected", "proposer", header.Coinbase, "number", header.Number, "first", prev.Hash(), "second", header.Hash())
+	}
+}
+
+// doubleProposalProof returns the proof of a detected double proposal.
+func (e *Equa) doubleProposalProof(validator common.Address, number uint64) (*DoubleProposalProof, bool) {
+	ev := &Evidence{Validator: validator, Block: number, Violation: violationDoubleProposal}
+	return e.proposals.doubles.Get(ev.Hash())
+}
+
+// signedProposal is the latest proposal sealed locally, persisted so that a
+// restarted node does not seal a conflicting one.
+type signedProposal struct {
+	Signer common.Address
+	Number uint64
+	Hash   common.Hash // Hash of the signed statement data
+}
+
+// recordSealed checks that a sealed header does not conflict with a proposal
+// sealed before, recording it as the latest one if so. Statements are signed
+// for every block the miner assembles, but only sealed blocks are published, so
+// a proposal only counts once sealed. Headers for the same block can be sealed
+// again at a height.
+func (e *Equa) recordSealed(header *types.Header) error {
+	statement, err := decodeStatement(header)
+	if err != nil {
+		return err
+	}
+	var (
+		number = header.Number.Uint64()
+		hash   = crypto.Keccak256Hash(statementSigData(header, statement.Policy, statement.Inputs))
+	)
+	if blob, err := e.db.Get(rawdb.EquaSignedProposalKey); err == nil {
+		last := new(signedProposal)
+		if err := rlp.DecodeBytes(blob, last); err == nil && last.Signer == header.Coinbase {
+			if number < last.Number || (number == last.Number && hash != last.Hash) {
+				return fmt.Errorf("%w: sealed block %d already", errDoubleProposal, last.Number)
+			}
+		}
+	}
+	blob, err := rlp.EncodeToBytes(&signedProposal{Signer: header.Coinbase, Number: number, Hash: hash})
+	if err != nil {
+		return err
+	}
+	return e.db.Put(rawdb.EquaSignedProposalKey, blob)
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/tracing"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+	"github.com/holiman/uint256"
+)
+
+// Tests that a proposer signing two different blocks at the same height is
+// detected, that the proof slashes its whole stake once included, and that the
+// local node refuses to seal a conflicting block itself.
+func TestDoubleProposal(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000000e9a02")
+		engine   = newTestEngine(t, 32)
+		ether    = big.NewInt(1e18)
+		key, _   = crypto.GenerateKey()
+		offender = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	engine.config.StakingContract = contract
+	engine.config.Features = map[string]bool{FeatureComplianceStatements: true, FeatureSlashingExecution: true}
+	engine.Authorize(offender, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	chain := &testHeaderChain{
+		config:  newTestChainConfig(engine.config),
+		headers: []*types.Header{{Number: big.NewInt(10)}},
+	}
+	// Sign two blocks at the same height, and the first one a second time
+	sign := func(txHash common.Hash, nonce uint64) *types.Header {
+		header := &types.Header{Number: big.NewInt(5), Coinbase: offender, TxHash: txHash, Nonce: types.EncodeNonce(nonce)}
+		if err := engine.signStatement(header, nil, nil); err != nil {
+			t.Fatalf("failed to sign statement: %v", err)
+		}
+		return header
+	}
+	first, resealed, second := sign(common.Hash{0x01}, 1), sign(common.Hash{0x01}, 2), sign(common.Hash{0x02}, 1)
+
+	engine.recordProposal(chain, first)
+	engine.recordProposal(chain, resealed)
+	if _, ok := engine.doubleProposalProof(offender, 5); ok {
+		t.Fatalf("resealed block reported as double proposal")
+	}
+	engine.recordProposal(chain, second)
+	proof, ok := engine.doubleProposalProof(offender, 5)
+	if !ok {
+		t.Fatalf("double proposal not detected")
+	}
+	ev := &Evidence{Validator: offender, Block: 5, Violation: violationDoubleProposal}
+	if _, ok := engine.slasher.evidence[ev.Hash()]; !ok {
+		t.Errorf("double proposal evidence not submitted")
+	}
+	// Including the proof burns the whole stake, once
+	data, err := proof.encode()
+	if err != nil {
+		t.Fatalf("failed to encode proof: %v", err)
+	}
+	reporter, _ := crypto.GenerateKey()
+	evidence := types.MustSignNewTx(reporter, types.LatestSignerForChainID(big.NewInt(1)), &types.LegacyTx{
+		To: &params.EquaSlashingAddress, Gas: 1000000, GasPrice: big.NewInt(1e9), Data: data,
+	})
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	testRegistry(statedb, contract, map[common.Address]int64{offender: 64}, offender)
+	statedb.AddBalance(contract, uint256.MustFromBig(new(big.Int).Mul(big.NewInt(64), ether)), tracing.BalanceChangeUnspecified)
+
+	header := &types.Header{Number: big.NewInt(10), Coinbase: common.Address{0x01}}
+	for i := 0; i < 2; i++ {
+		engine.finalize(chain, header, statedb, &types.Body{Transactions: []*types.Transaction{evidence}}, nil)
+	}
+	if stake := statedb.GetState(contract, stakingStakeKey(offender)).Big(); stake.Sign() != 0 {
+		t.Errorf("double proposer not slashed in full: stake %v", stake)
+	}
+	if burned := statedb.GetBalance(common.Address{}).ToBig(); burned.Cmp(new(big.Int).Mul(big.NewInt(64), ether)) != 0 {
+		t.Errorf("burned stake mismatch: have %v, want 64 ether", burned)
+	}
+	// Proofs of a resealed block are rejected
+	if _, err := (&DoubleProposalProof{First: first, Second: resealed}).verify(); !errors.Is(err, errNotDoubleProposal) {
+		t.Errorf("resealed block proof error mismatch: have %v, want %v", err, errNotDoubleProposal)
+	}
+	// The local node seals the same block again, but no conflicting one
+	for i, test := range []struct {
+		header *types.Header
+		err    error
+	}{
+		{first, nil},
+		{resealed, nil},
+		{second, errDoubleProposal},
+		{sign(common.Hash{0x03}, 1), errDoubleProposal},
+	} {
+		if err := engine.recordSealed(test.header); !errors.Is(err, test.err) {
+			t.Errorf("test %d: seal error mismatch: have %v, want %v", i, err, test.err)
+		}
+	}
+	next := &types.Header{Number: big.NewInt(6), Coinbase: offender, TxHash: common.Hash{0x02}}
+	if err := engine.signStatement(next, nil, nil); err != nil {
+		t.Fatalf("failed to sign statement: %v", err)
+	}
+	if err := engine.recordSealed(next); err != nil {
+		t.Errorf("next block not sealed: %v", err)
+	}
+	if err := engine.recordSealed(first); !errors.Is(err, errDoubleProposal) {
+		t.Errorf("seal error for past block mismatch: have %v, want %v", err, errDoubleProposal)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/event"
+	"github.com/equa/go-equa/log"
+)
+
+// Statuses of a validator as reported by validatorStatusChanged notifications.
+const (
+	ValidatorStatusUnknown = "unknown" // Not known to the stake manager
+	ValidatorStatusPending = "pending" // Queued for activation
+	ValidatorStatusActive  = "active"  // In the validator set
+	ValidatorStatusExiting = "exiting" // In the validator set with a voluntary exit pending
+	ValidatorStatusSlashed = "slashed" // In the validator set, but slashed
+	ValidatorStatusExited  = "exited"  // Out of the validator set, stake unbonding or withdrawn
+)
+
+// MEVEvent is the MEV detected in a canonical block.
+type MEVEvent struct {
+	Number   uint64         `json:"number"`
+	Hash     common.Hash    `json:"hash"`
+	Proposer common.Address `json:"proposer"`
+	MEV      *big.Int       `json:"mev"`    // MEV detected in the block
+	Burned   *big.Int       `json:"burned"` // Share of the MEV burned
+}
+
+// OrderingViolationEvent reports the transaction pairs of a canonical block that
+// were not included in fair order.
+type OrderingViolationEvent struct {
+	Number     uint64         `json:"number"`
+	Hash       common.Hash    `json:"hash"`
+	Proposer   common.Address `json:"proposer"`
+	Violations int            `json:"violations"` // Pairs ordered unfairly
+	Pairs      int            `json:"pairs"`      // Pairs checked
+}
+
+// ValidatorStatusEvent is a change in the status of a validator, observed at the
+// given canonical block.
+type ValidatorStatusEvent struct {
+	Number    uint64         `json:"number"`
+	Validator common.Address `json:"validator"`
+	Previous  string         `json:"previous"`
+	Status    string         `json:"status"`
+}
+
+// eventFeeds are the feeds of the equa namespace subscriptions.
+type eventFeeds struct {
+	slashing event.Feed // Slashing events of new canonical blocks and new evidence
+	mev      event.Feed // MEV detected in new canonical blocks
+	status   event.Feed // Validator status changes
+	ordering event.Feed // Ordering violations in new canonical blocks
+}
+
+// SubscribeSlashingEvents subscribes to the slashing events detected in new
+// canonical blocks and to newly reported evidence.
+func (e *Equa) SubscribeSlashingEvents(ch chan<- *SlashingEvent) event.Subscription {
+	return e.feeds.slashing.Subscribe(ch)
+}
+
+// SubscribeMEVEvents subscribes to the MEV detected in new canonical blocks.
+func (e *Equa) SubscribeMEVEvents(ch chan<- *MEVEvent) event.Subscription {
+	return e.feeds.mev.Subscribe(ch)
+}
+
+// SubscribeValidatorStatus subscribes to the status changes of validators.
+func (e *Equa) SubscribeValidatorStatus(ch chan<- *ValidatorStatusEvent) event.Subscription {
+	return e.feeds.status.Subscribe(ch)
+}
+
+// SubscribeOrderingViolations subscribes to the ordering violations found in new
+// canonical blocks.
+func (e *Equa) SubscribeOrderingViolations(ch chan<- *OrderingViolationEvent) event.Subscription {
+	return e.feeds.ordering.Subscribe(ch)
+}
+
+// submitEvidence adds slashing evidence to the slasher, announcing it to the
+// slashing event subscribers.
+func (e *Equa) submitEvidence(ev *Evidence, head uint64) error {
+	if err := e.slasher.SubmitEvidence(ev, head); err != nil {
+		return err
+	}
+	e.feeds.slashing.Send(&SlashingEvent{Number: ev.Block, Validator: ev.Validator, Violation: ev.Violation, Percentage: e.slasher.SlashingPercentage(ev.Violation), Evidence: true})
+	return nil
+}
+
+// validatorStatuses returns the status of every validator known to the stake
+// manager.
+func (sm *StakeManager) validatorStatuses() map[common.Address]string {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	statuses := make(map[common.Address]string, len(sm.validators)+len(sm.queue)+len(sm.withdrawals))
+	for addr := range sm.withdrawals {
+		statuses[addr] = ValidatorStatusExited
+	}
+	for _, pending := range sm.queue {
+		statuses[pending.Address] = ValidatorStatusPending
+	}
+	for addr, validator := range sm.validators {
+		switch {
+		case validator.Slashed:
+			statuses[addr] = ValidatorStatusSlashed
+		case sm.exits[addr] != nil:
+			statuses[addr] = ValidatorStatusExiting
+		default:
+			statuses[addr] = ValidatorStatusActive
+		}
+	}
+	return statuses
+}
+
+// StartEventStream starts publishing the events of new canonical blocks and the
+// validator status changes to the subscribers, until the engine is closed.
+func (e *Equa) StartEventStream(chain consensus.ChainReader) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(e.config.Period) * time.Second)
+		defer ticker.Stop()
+
+		var (
+			head     = chain.CurrentHeader()
+			statuses = e.stakeManager.validatorStatuses()
+		)
+		for {
+			select {
+			case <-ticker.C:
+				head = e.publishBlockEvents(chain, head)
+				statuses = e.publishStatusChanges(chain, statuses)
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// publishBlockEvents publishes the events of the canonical blocks following the
+// given one, or following the point the chain forked from it at if it was
+// reorged out, going back at most maxScanBlocks blocks from the head. It returns
+// the head the events were published up to.
+func (e *Equa) publishBlockEvents(chain consensus.ChainReader, last *types.Header) *types.Header {
+	head := chain.CurrentHeader()
+	if head == nil || last == nil {
+		return head
+	}
+	first := last.Number.Uint64() + 1
+	for n := last.Number.Uint64(); n > 0; n-- {
+		if header := chain.GetHeaderByNumber(n); header != nil && header.Hash() == last.Hash() {
+			break
+		}
+		if last = chain.GetHeader(last.ParentHash, n-1); last == nil {
+			break
+		}
+		first = n
+	}
+	if number := head.Number.Uint64(); number >= maxScanBlocks && first < number-maxScanBlocks+1 {
+		first = number - maxScanBlocks + 1
+	}
+	for n := first; n <= head.Number.Uint64(); n++ {
+		if err := e.publishBlock(chain, n); err != nil {
+			log.Debug("Failed to publish block events", "number", n, "err", err)
+			return chain.GetHeaderByNumber(n - 1)
+		}
+	}
+	return head
+}
+
+// publishBlock publishes the slashing events, MEV and ordering violations of a
+// canonical block.
+func (e *Equa) publishBlock(chain consensus.ChainReader, number uint64) error {
+	block, receipts, err := blockReceipts(chain, number)
+	if err != nil {
+		return err
+	}
+	events, err := e.slashingEvents(chain, number)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		e.feeds.slashing.Send(ev)
+	}
+	if mev := e.mevDetector.DetectMEV(block.Transactions(), receipts, block.BaseFee()); mev.Sign() > 0 {
+		e.feeds.mev.Send(&MEVEvent{
+			Number:   number,
+			Hash:     block.Hash(),
+			Proposer: block.Coinbase(),
+			MEV:      mev,
+			Burned:   percentOf(mev, e.config.MEVBurnPercentage),
+		})
+	}
+	if violations, pairs := e.fairOrderer.OrderingViolations(block.Transactions()); violations > 0 {
+		e.feeds.ordering.Send(&OrderingViolationEvent{
+			Number:     number,
+			Hash:       block.Hash(),
+			Proposer:   block.Coinbase(),
+			Violations: violations,
+			Pairs:      pairs,
+		})
+	}
+	return nil
+}
+
+// publishStatusChanges publishes the differences between the given validator
+// statuses and the current ones, returning the current ones.
+func (e *Equa) publishStatusChanges(chain consensus.ChainReader, previous map[common.Address]string) map[common.Address]string {
+	var (
+		number  = chain.CurrentHeader().Number.Uint64()
+		current = e.stakeManager.validatorStatuses()
+	)
+	for addr, status := range current {
+		if prev, ok := previous[addr]; !ok || prev != status {
+			if !ok {
+				prev = ValidatorStatusUnknown
+			}
+			e.feeds.status.Send(&ValidatorStatusEvent{Number: number, Validator: addr, Previous: prev, Status: status})
+		}
+	}
+	for addr, prev := range previous {
+		if _, ok := current[addr]; !ok {
+			e.feeds.status.Send(&ValidatorStatusEvent{Number: number, Validator: addr, Previous: prev, Status: ValidatorStatusUnknown})
+		}
+	}
+	return current
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/rpc"
+	"github.com/equa/go-equa/trie"
+)
+
+// Tests that the events of new canonical blocks and validator status changes
+// are streamed to equa_subscribe subscribers.
+func TestEventSubscriptions(t *testing.T) {
+	var (
+		proposer = common.Address{0x01}
+		joiner   = common.Address{0x03}
+		engine   = newTestEngine(t, 32, proposer)
+		key, _   = crypto.GenerateKey()
+		signer   = types.LatestSignerForChainID(big.NewInt(1))
+		chain    = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+			receipts:        make(map[common.Hash]types.Receipts),
+		}
+	)
+	addBlock := func(txs []*types.Transaction) {
+		var receipts types.Receipts
+		for _, tx := range txs {
+			receipts = append(receipts, &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash(), GasUsed: 21000})
+		}
+		header := &types.Header{Number: big.NewInt(int64(len(chain.headers))), Coinbase: proposer, Difficulty: common.Big1}
+		if len(chain.headers) > 0 {
+			header.ParentHash = chain.CurrentHeader().Hash()
+		}
+		block := types.NewBlock(header, &types.Body{Transactions: txs}, receipts, trie.NewStackTrie(nil))
+		chain.headers = append(chain.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+		chain.receipts[block.Hash()] = receipts
+	}
+	addBlock(nil)
+
+	// Subscribe to every topic through an in-process RPC server
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("equa", &API{chain: chain, equa: engine}); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var (
+		slashings  = make(chan *SlashingEvent, 16)
+		orderings  = make(chan *OrderingViolationEvent, 16)
+		statuses   = make(chan *ValidatorStatusEvent, 16)
+		mevs       = make(chan *MEVEvent, 16)
+		ctx        = context.Background()
+		statusSnap = engine.stakeManager.validatorStatuses()
+	)
+	for topic, ch := range map[string]any{"newSlashingEvent": slashings, "orderingViolation": orderings, "validatorStatusChanged": statuses, "mevDetected": mevs} {
+		sub, err := client.Subscribe(ctx, "equa", ch, topic)
+		if err != nil {
+			t.Fatalf("failed to subscribe to %s: %v", topic, err)
+		}
+		defer sub.Unsubscribe()
+	}
+	// A block paying increasing gas prices is flagged for reordering, and its
+	// transactions were seen in reverse order
+	var (
+		txs  []*types.Transaction
+		base = time.Now()
+	)
+	for i := int64(0); i < 3; i++ {
+		tx := types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: uint64(i), To: &common.Address{0x02}, Gas: 21000, GasPrice: big.NewInt((i + 1) * 1e9)})
+		engine.recordArrivals([]*types.Transaction{tx}, base.Add(-time.Duration(i)*time.Second))
+		txs = append(txs, tx)
+	}
+	addBlock(txs)
+	if head := engine.publishBlockEvents(chain, chain.headers[0]); head.Number.Uint64() != 1 {
+		t.Fatalf("events published up to block %d, want 1", head.Number.Uint64())
+	}
+	select {
+	case ev := <-slashings:
+		if ev.Number != 1 || ev.Validator != proposer || ev.Violation != "Transaction reordering" {
+			t.Errorf("slashing event mismatch: have %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("slashing event not streamed")
+	}
+	select {
+	case ev := <-orderings:
+		if ev.Number != 1 || ev.Proposer != proposer || ev.Violations == 0 {
+			t.Errorf("ordering violation mismatch: have %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ordering violation not streamed")
+	}
+	select {
+	case ev := <-mevs:
+		t.Errorf("MEV reported in plain transfers: %+v", ev)
+	default:
+	}
+	// Queueing a validator and slashing another one are reported as changes
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	newValidatorRegistry(statedb, engine.config).enqueue(joiner, big.NewInt(1), nil, 0)
+	engine.stakeManager.load(statedb, common.Hash{1})
+	if err := slashTestValidator(engine.stakeManager, proposer, 10); err != nil {
+		t.Fatalf("failed to slash: %v", err)
+	}
+	engine.publishStatusChanges(chain, statusSnap)
+
+	changes := make(map[common.Address]*ValidatorStatusEvent)
+	for len(changes) < 2 {
+		select {
+		case ev := <-statuses:
+			changes[ev.Validator] = ev
+		case <-time.After(time.Second):
+			t.Fatalf("status changes not streamed, have %d", len(changes))
+		}
+	}
+	if ev := changes[joiner]; ev.Previous != ValidatorStatusUnknown || ev.Status != ValidatorStatusPending {
+		t.Errorf("joiner status change mismatch: have %+v", ev)
+	}
+	if ev := changes[proposer]; ev.Previous != ValidatorStatusActive || ev.Status != ValidatorStatusSlashed {
+		t.Errorf("proposer status change mismatch: have %+v", ev)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/tracing"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+)
+
+// Voluntary exits are carried on chain, so that every node queues them at the
+// same block. Anyone holding a signed exit can send it to params.EquaExitAddress
+// in a transaction carrying the RLP encoding of the exit, and the block
+// including it queues the exit while being finalized. Queued exits are recorded
+// in the storage of the exit address, laid out like that of a contract with:
+//
+//	address[] queue;                           // slot 0
+//	mapping(address => uint256) exitEpochs;    // slot 1
+//
+// until they are processed at the epoch boundary they are due at. The queue is
+// kept in the state rather than derived from the validator set, which differs
+// between assembling an epoch boundary block and importing it.
+var (
+	exitQueueSlot  = common.Hash{}
+	exitEpochsSlot = common.BigToHash(common.Big1)
+)
+
+var (
+	errInvalidExitSignature = errors.New("invalid voluntary exit signature")
+	errExitAlreadyQueued    = errors.New("voluntary exit already queued")
+	errExitEpochPassed      = errors.New("voluntary exit epoch already reached")
+)
+
+// VoluntaryExit is a message signed by a validator requesting to leave the
+// validator set of a chain. Exits are queued and processed at the first epoch
+// transition at or after the requested epoch.
+type VoluntaryExit struct {
+	Validator common.Address `json:"validator"` // Validator requesting the exit
+	Epoch     uint64         `json:"epoch"`     // Earliest epoch at which the exit takes effect
+	Signature hexutil.Bytes  `json:"signature"` // Signature over SigHash by the validator's account key
+}
+
+// SigHash returns the hash signed by the validator to exit on the chain with the
+// given ID, so that the exit cannot be replayed on another network the
+// validator stakes on.
+func (exit *VoluntaryExit) SigHash(chainID *big.Int) common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{chainID, exit.Validator, exit.Epoch})
+	return crypto.Keccak256Hash([]byte("equa-voluntary-exit"), enc)
+}
+
+// Sign signs the exit on the chain with the given ID with the given key, which
+// must belong to the validator.
+func (exit *VoluntaryExit) Sign(key *ecdsa.PrivateKey, chainID *big.Int) error {
+	sig, err := crypto.Sign(exit.SigHash(chainID).Bytes(), key)
+	if err != nil {
+		return err
+	}
+	exit.Signature = sig
+	return nil
+}
+
+// Verify checks that the exit was signed by the validator it refers to, on the
+// chain with the given ID.
+func (exit *VoluntaryExit) Verify(chainID *big.Int) error {
+	if len(exit.Signature) != crypto.SignatureLength {
+		return errInvalidExitSignature
+	}
+	pubkey, err := crypto.SigToPub(exit.SigHash(chainID).Bytes(), exit.Signature)
+	if err != nil {
+		return errInvalidExitSignature
+	}
+	if crypto.PubkeyToAddress(*pubkey) != exit.Validator {
+		return errInvalidExitSignature
+	}
+	return nil
+}
+
+// TxData returns the data of a transaction carrying the exit on chain, to be
+// sent to params.EquaExitAddress.
+func (exit *VoluntaryExit) TxData() ([]byte, error) {
+	return rlp.EncodeToBytes(exit)
+}
+
+// exitKey is the storage slot of a validator's exit epoch.
+func exitKey(addr common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(addr[:], 32), exitEpochsSlot[:])
+}
+
+// exitQueueKey is the storage slot of the entry of the exit queue at the given
+// index.
+func exitQueueKey(index uint64) common.Hash {
+	base := crypto.Keccak256Hash(exitQueueSlot[:]).Big()
+	return common.BigToHash(base.Add(base, new(big.Int).SetUint64(index)))
+}
+
+// queuedExitEpoch returns the epoch of a validator's exit queued on chain, zero
+// if it has none.
+func queuedExitEpoch(state vm.StateDB, addr common.Address) uint64 {
+	return state.GetState(params.EquaExitAddress, exitKey(addr)).Big().Uint64()
+}
+
+// checkExit verifies a signed voluntary exit requested at the given epoch of the
+// chain with the given ID against the registry: it must be signed for the chain
+// by an active validator that was not slashed and take effect at a later epoch,
+// so that a validator cannot leave the set it is validating in.
+func (r *validatorRegistry) checkExit(exit *VoluntaryExit, chainID *big.Int, epoch uint64) error {
+	if err := exit.Verify(chainID); err != nil {
+		return err
+	}
+	if exit.Epoch <= epoch {
+		return fmt.Errorf("%w: exit epoch %d, current epoch %d", errExitEpochPassed, exit.Epoch, epoch)
+	}
+	if reg := r.get(exit.Validator); reg.status != registrationActive || reg.slashed.Sign() > 0 {
+		return errInvalidValidator
+	}
+	return nil
+}
+
+// queueExits queues the voluntary exits carried by the transactions of a block,
+// returning the queued ones. Exits are checked against the registry as left by
+// the parent block, which transactions cannot modify. Invalid exits and those
+// of validators exiting already are ignored, the transactions are still
+// included.
+func (e *Equa) queueExits(header *types.Header, state vm.StateDB, txs []*types.Transaction) []*VoluntaryExit {
+	var (
+		number   = header.Number.Uint64()
+		registry = newValidatorRegistry(state, e.config)
+		queued   []*VoluntaryExit
+	)
+	for _, tx := range txs {
+		if tx.To() == nil || *tx.To() != params.EquaExitAddress {
+			continue
+		}
+		exit := new(VoluntaryExit)
+		err := rlp.DecodeBytes(tx.Data(), exit)
+		if err == nil {
+			err = registry.checkExit(exit, e.chainID, number/e.config.Epoch)
+		}
+		if err == nil && queuedExitEpoch(state, exit.Validator) != 0 {
+			err = errExitAlreadyQueued
+		}
+		if err != nil {
+			log.Debug("Ignoring voluntary exit", "number", number, "tx", tx.Hash(), "err", err)
+			continue
+		}
+		// Give the exit address a nonce, accounts without one are deleted as
+		// empty regardless of their storage
+		if state.GetNonce(params.EquaExitAddress) == 0 {
+			state.SetNonce(params.EquaExitAddress, 1, tracing.NonceChangeUnspecified)
+		}
+		length := state.GetState(params.EquaExitAddress, exitQueueSlot).Big().Uint64()
+		state.SetState(params.EquaExitAddress, exitQueueKey(length), common.BytesToHash(exit.Validator[:]))
+		state.SetState(params.EquaExitAddress, exitQueueSlot, common.BigToHash(new(big.Int).SetUint64(length+1)))
+		state.SetState(params.EquaExitAddress, exitKey(exit.Validator), common.BigToHash(new(big.Int).SetUint64(exit.Epoch)))
+		queued = append(queued, exit)
+	}
+	return queued
+}
+
+// dueExits returns the exits queued on chain that are due at the given epoch,
+// in queue order, and removes them from the queue.
+func dueExits(state vm.StateDB, epoch uint64) []*VoluntaryExit {
+	var (
+		length  = state.GetState(params.EquaExitAddress, exitQueueSlot).Big().Uint64()
+		due     []*VoluntaryExit
+		pending []common.Address
+	)
+	for i := uint64(0); i < length; i++ {
+		addr := common.BytesToAddress(state.GetState(params.EquaExitAddress, exitQueueKey(i)).Bytes())
+		exitEpoch := queuedExitEpoch(state, addr)
+		if exitEpoch > epoch {
+			pending = append(pending, addr)
+			continue
+		}
+		state.SetState(params.EquaExitAddress, exitKey(addr), common.Hash{})
+		due = append(due, &VoluntaryExit{Validator: addr, Epoch: exitEpoch})
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	for i := uint64(0); i < length; i++ {
+		var entry common.Hash
+		if i < uint64(len(pending)) {
+			entry = common.BytesToHash(pending[i][:])
+		}
+		state.SetState(params.EquaExitAddress, exitQueueKey(i), entry)
+	}
+	state.SetState(params.EquaExitAddress, exitQueueSlot, common.BigToHash(new(big.Int).SetUint64(uint64(len(pending)))))
+	return due
+}
+
+// queuedExits returns the exits queued on chain, in queue order.
+func queuedExits(state vm.StateDB) []*VoluntaryExit {
+	var (
+		length = state.GetState(params.EquaExitAddress, exitQueueSlot).Big().Uint64()
+		exits  []*VoluntaryExit
+	)
+	for i := uint64(0); i < length; i++ {
+		addr := common.BytesToAddress(state.GetState(params.EquaExitAddress, exitQueueKey(i)).Bytes())
+		exits = append(exits, &VoluntaryExit{Validator: addr, Epoch: queuedExitEpoch(state, addr)})
+	}
+	return exits
+}
+
+// processExits removes the validators whose voluntary exit is due at the given
+// epoch from the validator set, returning the stake of the exited validators,
+// which enters its unbonding period.
+func (r *validatorRegistry) processExits(exits []*VoluntaryExit, epoch uint64) []*Withdrawal {
+	var withdrawals []*Withdrawal
+	for _, exit := range exits {
+		reg := r.get(exit.Validator)
+		if reg.status != registrationActive {
+			continue
+		}
+		reg.status, reg.epoch = registrationExited, epoch
+		r.put(reg)
+
+		withdrawals = append(withdrawals, &Withdrawal{
+			Validator:         exit.Validator,
+			Address:           exit.Validator,
+			Amount:            reg.stake,
+			ExitEpoch:         epoch,
+			WithdrawableEpoch: epoch + r.config.UnbondingEpochs,
+		})
+	}
+	return withdrawals
+}
+
+// Withdrawal is the stake of an exited validator. The stake stays bonded for
+// the unbonding period after the exit, during which the validator can still be
+// slashed for offenses committed while validating, and can be withdrawn to the
+// account named by the withdrawal credentials afterwards.
+type Withdrawal struct {
+	Validator         common.Address `json:"validator"`
+	Address           common.Address `json:"address"`           // Account named by the withdrawal credentials
+	Amount            *big.Int       `json:"amount"`            // Stake at the exit, less any amount slashed since
+	ExitEpoch         uint64         `json:"exitEpoch"`         // Epoch the validator left the validator set at
+	WithdrawableEpoch uint64         `json:"withdrawableEpoch"` // Epoch from which the stake can be withdrawn
+	Withdrawable      bool           `json:"withdrawable"`      // Whether the unbonding period is over
+	Withdrawn         bool           `json:"withdrawn"`         // Whether the stake left the staking contract
+}
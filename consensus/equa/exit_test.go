@@ -0,0 +1,305 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// exitTx wraps a signed voluntary exit into a transaction carrying it on chain.
+func exitTx(t *testing.T, exit *VoluntaryExit) *types.Transaction {
+	t.Helper()
+
+	data, err := exit.TxData()
+	if err != nil {
+		t.Fatalf("failed to encode exit: %v", err)
+	}
+	return types.NewTx(&types.LegacyTx{To: &params.EquaExitAddress, Gas: 100000, Data: data})
+}
+
+// Tests that voluntary exits carried on chain must be signed by the exiting
+// validator and are only processed once their epoch is reached.
+func TestVoluntaryExit(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	engine := newTestEngine(t, 32, addr)
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	header := &types.Header{Number: big.NewInt(1)}
+
+	forged := &VoluntaryExit{Validator: addr, Epoch: 3}
+	if err := forged.Sign(other, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	if queued := engine.queueExits(header, statedb, []*types.Transaction{exitTx(t, forged)}); len(queued) != 0 {
+		t.Fatalf("forged exit queued: %v", queued)
+	}
+	// Exits signed for another chain cannot be replayed
+	replayed := &VoluntaryExit{Validator: addr, Epoch: 3}
+	if err := replayed.Sign(key, new(big.Int).Add(engine.chainID, common.Big1)); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	if queued := engine.queueExits(header, statedb, []*types.Transaction{exitTx(t, replayed)}); len(queued) != 0 {
+		t.Fatalf("exit of another chain queued: %v", queued)
+	}
+	exit := &VoluntaryExit{Validator: addr, Epoch: 3}
+	if err := exit.Sign(key, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	if queued := engine.queueExits(header, statedb, []*types.Transaction{exitTx(t, exit), exitTx(t, exit)}); len(queued) != 1 {
+		t.Fatalf("queued exit count mismatch: have %d, want 1", len(queued))
+	}
+	if have := queuedExitEpoch(statedb, addr); have != 3 {
+		t.Fatalf("queued exit epoch mismatch: have %d, want 3", have)
+	}
+	if due := dueExits(statedb, 2); len(due) != 0 {
+		t.Fatalf("exit due early: %v", due)
+	}
+	due := dueExits(statedb, 3)
+	if len(due) != 1 || due[0].Validator != addr {
+		t.Fatalf("exit not due: %v", due)
+	}
+	if queuedExitEpoch(statedb, addr) != 0 || statedb.GetState(params.EquaExitAddress, exitQueueSlot) != (common.Hash{}) {
+		t.Fatalf("processed exit still queued")
+	}
+	newValidatorRegistry(statedb, engine.config).processExits(due, 3)
+	engine.stakeManager.load(statedb, common.Hash{1})
+	if engine.stakeManager.HasStake(addr) {
+		t.Fatalf("validator still staked after exit")
+	}
+}
+
+// Tests that an exit sent on chain by any account is queued by every node
+// importing the block, and processed at the epoch boundary it is due at.
+func TestImportVoluntaryExit(t *testing.T) {
+	var (
+		key, _     = crypto.GenerateKey()
+		relayer, _ = crypto.GenerateKey()
+		addr       = crypto.PubkeyToAddress(key.PublicKey)
+		other      = common.Address{0x01}
+	)
+	// Blocks are assembled and imported by different engines, as by the
+	// proposer and the other nodes
+	newEngine := func() *Equa {
+		engine := newTestEngine(t, 32, addr, other)
+		engine.config.Epoch = 2
+		return engine
+	}
+	proposer, importer := newEngine(), newEngine()
+
+	exit := &VoluntaryExit{Validator: addr, Epoch: 1}
+	if err := exit.Sign(key, proposer.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	genesis := &core.Genesis{
+		Config: newTestChainConfig(proposer.config),
+		Alloc: types.GenesisAlloc{
+			crypto.PubkeyToAddress(relayer.PublicKey): {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))},
+		},
+	}
+	var (
+		signer   = types.LatestSigner(genesis.Config)
+		schedule = firstTestSchedule(t, proposer, genesis)
+	)
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, testImportEngine{proposer}, 2, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(schedule.Proposer(uint64(i + 1)))
+		if i == 0 {
+			data, _ := exit.TxData()
+			b.AddTx(types.MustSignNewTx(relayer, signer, &types.LegacyTx{To: &params.EquaExitAddress, Gas: 100000, GasPrice: big.NewInt(params.GWei), Data: data}))
+		}
+	})
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), genesis, testImportEngine{importer}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	importer.loadValidators(chain)
+	if _, err := chain.InsertChain(blocks[:1]); err != nil {
+		t.Fatalf("failed to import block with exit: %v", err)
+	}
+	importer.followChain(chain)
+	if pending := importer.stakeManager.PendingExits(); len(pending) != 1 || pending[0].Validator != addr {
+		t.Fatalf("exit not queued on import: %v", pending)
+	}
+	if _, err := chain.InsertChain(blocks[1:]); err != nil {
+		t.Fatalf("failed to import epoch boundary: %v", err)
+	}
+	importer.followChain(chain)
+	if importer.stakeManager.HasStake(addr) {
+		t.Fatalf("validator still staked after exit")
+	}
+	if pending := importer.stakeManager.PendingExits(); len(pending) != 0 {
+		t.Fatalf("exit still pending after processing: %v", pending)
+	}
+	statedb, err := chain.StateAt(blocks[1].Root())
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	if queuedExitEpoch(statedb, addr) != 0 {
+		t.Fatalf("processed exit still recorded in the state")
+	}
+}
+
+// Tests the exit lifecycle: exits must name a future epoch, validators stop
+// proposing once their exit epoch is reached and their stake unbonds, still
+// slashable, before it becomes withdrawable.
+func TestExitLifecycle(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	other := common.Address{0x01}
+
+	engine := newTestEngine(t, 32, addr, other)
+	engine.config.Epoch = 10
+	engine.config.UnbondingEpochs = 2
+
+	chain := &testHeaderChain{config: newTestChainConfig(engine.config), states: state.NewDatabaseForTesting()}
+	extend := func(last int64, root common.Hash) {
+		for number := int64(len(chain.headers)); number <= last; number++ {
+			header := &types.Header{Number: big.NewInt(number), Root: root}
+			if number > 0 {
+				header.ParentHash = chain.CurrentHeader().Hash()
+			}
+			chain.headers = append(chain.headers, header)
+		}
+	}
+	extend(15, types.EmptyRootHash)
+	api := &API{chain: chain, equa: engine}
+
+	statedb, _ := state.New(types.EmptyRootHash, chain.states)
+	registry := newValidatorRegistry(statedb, engine.config)
+
+	exit := &VoluntaryExit{Validator: addr, Epoch: 1}
+	if err := exit.Sign(key, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	if err := registry.checkExit(exit, engine.chainID, 1); !errors.Is(err, errExitEpochPassed) {
+		t.Fatalf("past exit: have %v, want %v", err, errExitEpochPassed)
+	}
+	exit = &VoluntaryExit{Validator: addr, Epoch: 2}
+	if err := exit.Sign(key, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	if err := registry.checkExit(exit, engine.chainID, 1); err != nil {
+		t.Fatalf("failed to check exit: %v", err)
+	}
+	// Validators missing from the registry cannot exit, even if the engine
+	// knows them
+	strangerKey, _ := crypto.GenerateKey()
+	stranger := &VoluntaryExit{Validator: crypto.PubkeyToAddress(strangerKey.PublicKey), Epoch: 2}
+	if err := stranger.Sign(strangerKey, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	engine.stakeManager.AddValidator(stranger.Validator, new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)), nil)
+	if err := registry.checkExit(stranger, engine.chainID, 1); !errors.Is(err, errInvalidValidator) {
+		t.Fatalf("unregistered exit: have %v, want %v", err, errInvalidValidator)
+	}
+	if queued := engine.queueExits(chain.CurrentHeader(), statedb, []*types.Transaction{exitTx(t, exit)}); len(queued) != 1 {
+		t.Fatalf("exit not queued")
+	}
+	// Past the exit epoch, the validator is no longer scheduled once the exit is
+	// processed at the epoch boundary
+	registry = newValidatorRegistry(statedb, engine.config)
+	registry.processExits(dueExits(statedb, 2), 2)
+	registry.fixProposers()
+	root, _ := statedb.Commit(20, false, false)
+	statedb, _ = state.New(root, chain.states)
+	engine.stakeManager.load(statedb, chain.CurrentHeader().Hash())
+
+	extend(30, root)
+	for number := uint64(21); number <= 30; number++ {
+		proposer, err := engine.selectProposer(chain, number, chain.headers[number-1])
+		if err != nil {
+			t.Fatalf("failed to select proposer: %v", err)
+		}
+		if proposer != other {
+			t.Fatalf("block %d: exiting validator selected", number)
+		}
+	}
+	if err := slashTestValidator(engine.stakeManager, addr, 50); err != nil {
+		t.Fatalf("failed to slash unbonding validator: %v", err)
+	}
+	withdrawals := api.GetWithdrawals(&addr)
+	if len(withdrawals) != 1 {
+		t.Fatalf("withdrawals mismatch: have %d, want 1", len(withdrawals))
+	}
+	stake := new(big.Int).Mul(big.NewInt(16), big.NewInt(1e18))
+	if w := withdrawals[0]; w.Address != addr || w.Amount.Cmp(stake) != 0 || w.ExitEpoch != 2 || w.WithdrawableEpoch != 4 || w.Withdrawable {
+		t.Fatalf("unexpected withdrawal: %+v", w)
+	}
+	if withdrawals := api.GetWithdrawals(&other); len(withdrawals) != 0 {
+		t.Fatalf("unexpected withdrawals of active validator: %v", withdrawals)
+	}
+	if withdrawals := engine.stakeManager.Withdrawals(4); !withdrawals[0].Withdrawable {
+		t.Fatalf("stake not withdrawable after unbonding")
+	}
+}
+
+// Tests that exits are verified against the head of the chain before their
+// transaction data is handed out over the API.
+func TestRequestExit(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		other, _ = crypto.GenerateKey()
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		engine   = newTestEngine(t, 32, addr, crypto.PubkeyToAddress(other.PublicKey))
+	)
+	queued := &VoluntaryExit{Validator: addr, Epoch: 1}
+	if err := queued.Sign(key, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	signer := types.LatestSigner(newTestChainConfig(engine.config))
+	chain, _ := importTestChain(t, engine, []common.Address{addr}, 1, func(i int, b *core.BlockGen) {
+		data, _ := queued.TxData()
+		b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{To: &params.EquaExitAddress, Gas: 100000, GasPrice: big.NewInt(params.GWei), Data: data}))
+	})
+	api := &API{chain: chain, equa: engine}
+
+	if _, err := api.RequestExit(*queued); !errors.Is(err, errExitAlreadyQueued) {
+		t.Fatalf("queued exit: have %v, want %v", err, errExitAlreadyQueued)
+	}
+	exit := &VoluntaryExit{Validator: crypto.PubkeyToAddress(other.PublicKey), Epoch: 0}
+	if err := exit.Sign(other, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	if _, err := api.RequestExit(*exit); !errors.Is(err, errExitEpochPassed) {
+		t.Fatalf("past exit: have %v, want %v", err, errExitEpochPassed)
+	}
+	exit = &VoluntaryExit{Validator: crypto.PubkeyToAddress(other.PublicKey), Epoch: 1}
+	if err := exit.Sign(other, engine.chainID); err != nil {
+		t.Fatalf("failed to sign exit: %v", err)
+	}
+	data, err := api.RequestExit(*exit)
+	if err != nil {
+		t.Fatalf("failed to request exit: %v", err)
+	}
+	if want, _ := exit.TxData(); !bytes.Equal(data, want) {
+		t.Fatalf("exit data mismatch: have %x, want %x", data, want)
+	}
+}
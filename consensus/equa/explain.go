@@ -0,0 +1,71 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+)
+
+// ScoreBreakdown justifies the MEV and ordering scores of a block, so that a
+// disputed score can be traced back to the findings it was derived from.
+type ScoreBreakdown struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+
+	OrderingScore      float64 `json:"orderingScore"`      // Fraction of transaction pairs in arrival order
+	OrderingViolations int     `json:"orderingViolations"` // Adjacent pairs out of arrival order
+	OrderingPairs      int     `json:"orderingPairs"`      // Adjacent pairs checked
+
+	MEV        *big.Int       `json:"mev"`        // Total estimated MEV profit in wei
+	Categories map[string]int `json:"categories"` // Number of findings per MEV category
+	Findings   []*MEVFinding  `json:"findings"`   // Individual MEV findings
+
+	// Confidence is the fraction of transactions whose receipt was available
+	// to the MEV detectors. Without receipts, profits cannot be estimated and
+	// the MEV score is a lower bound.
+	Confidence float64 `json:"confidence"`
+}
+
+// ExplainScores computes the score breakdown of a block. The receipts may be
+// nil if they are not available.
+func (e *Equa) ExplainScores(block *types.Block, receipts types.Receipts) *ScoreBreakdown {
+	txs := block.Transactions()
+	violations, pairs := e.fairOrderer.OrderingViolations(txs)
+
+	breakdown := &ScoreBreakdown{
+		Number:             block.NumberU64(),
+		Hash:               block.Hash(),
+		OrderingScore:      e.fairOrderer.GetOrderingScore(txs),
+		OrderingViolations: violations,
+		OrderingPairs:      pairs,
+		MEV:                new(big.Int),
+		Categories:         make(map[string]int),
+		Findings:           e.mevDetector.Analyze(txs, receipts, block.BaseFee()),
+		Confidence:         1,
+	}
+	for _, finding := range breakdown.Findings {
+		breakdown.MEV.Add(breakdown.MEV, finding.Profit)
+		breakdown.Categories[finding.Category]++
+	}
+	if len(txs) > 0 {
+		breakdown.Confidence = float64(min(len(receipts), len(txs))) / float64(len(txs))
+	}
+	return breakdown
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+)
+
+// Tests that the score breakdown matches the ordering score and accounts for
+// every out-of-order transaction pair.
+func TestExplainScores(t *testing.T) {
+	engine := newTestEngine(t, 32)
+
+	txs := newTestTransactions(t, 4)
+	recordTestArrivals(engine.arrivals, txs)
+
+	ordered := engine.fairOrderer.OrderTransactions(txs, nil, common.Hash{})
+	reversed := make([]*types.Transaction, len(ordered))
+	for i, tx := range ordered {
+		reversed[len(ordered)-1-i] = tx
+	}
+	for _, test := range []struct {
+		txs        []*types.Transaction
+		violations int
+	}{
+		{ordered, 0},
+		{reversed, 3},
+	} {
+		block := types.NewBlockWithHeader(&types.Header{}).WithBody(types.Body{Transactions: test.txs})
+		breakdown := engine.ExplainScores(block, nil)
+
+		if breakdown.OrderingViolations != test.violations || breakdown.OrderingPairs != 3 {
+			t.Errorf("violations mismatch: have %d/%d, want %d/3", breakdown.OrderingViolations, breakdown.OrderingPairs, test.violations)
+		}
+		if score := engine.fairOrderer.GetOrderingScore(test.txs); breakdown.OrderingScore != score {
+			t.Errorf("ordering score mismatch: have %v, want %v", breakdown.OrderingScore, score)
+		}
+		if breakdown.Confidence != 0 {
+			t.Errorf("confidence without receipts: have %v, want 0", breakdown.Confidence)
+		}
+		if len(breakdown.Findings) != 0 || breakdown.MEV.Sign() != 0 {
+			t.Errorf("unexpected MEV findings: %v", breakdown.Findings)
+		}
+	}
+}
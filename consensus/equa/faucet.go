@@ -0,0 +1,188 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rpc"
+)
+
+var (
+	faucetMeter = metrics.NewRegisteredMeter("equa/faucet/requests", nil)
+
+	errFaucetDisabled    = errors.New("faucet not enabled")
+	errFaucetMainnet     = errors.New("faucet not available on the main network")
+	errFaucetRateLimited = errors.New("faucet request rate limited")
+)
+
+// FaucetConfig configures the onboarding endpoints of public test networks: a
+// rate-limited faucet and the referral of unstaked addresses to an external
+// staking helper. Stake is only gained by depositing into the deposit contract.
+type FaucetConfig struct {
+	Account  common.Address `toml:",omitempty"` // Unlocked account funding faucet requests
+	Amount   *big.Int       `toml:",omitempty"` // Wei sent per request, faucet disabled if nil
+	Period   time.Duration  // Minimum time between two requests of an address or client
+	Referral string         `toml:",omitempty"` // URL of the staking helper unstaked addresses are referred to
+}
+
+// DefaultFaucetConfig contains the default settings of the onboarding endpoints.
+// They are disabled unless a faucet amount or referral is set.
+var DefaultFaucetConfig = FaucetConfig{
+	Period: 24 * time.Hour,
+}
+
+// Enabled reports whether any of the onboarding endpoints is configured.
+func (c *FaucetConfig) Enabled() bool {
+	return c.Amount != nil || c.Referral != ""
+}
+
+// FaucetSendFn is a callback to transfer funds from the faucet account, returning
+// the hash of the submitted transaction.
+type FaucetSendFn func(from, to common.Address, amount *big.Int) (common.Hash, error)
+
+// Onboarding tells the operator of an address what is left to do to validate.
+type Onboarding struct {
+	Address  common.Address `json:"address"`
+	Staked   bool           `json:"staked"`
+	Eligible bool           `json:"eligible"`
+	Referral string         `json:"referral,omitempty"` // Staking helper URL for unstaked addresses
+}
+
+// Faucet serves the onboarding endpoints of a test network.
+type Faucet struct {
+	config   FaucetConfig
+	referral *url.URL // Parsed staking helper URL, nil if not configured
+	send     FaucetSendFn
+
+	last map[string]time.Time // Time of the last granted request per address or client
+	now  func() time.Time     // Current time, replaceable in tests
+	lock sync.Mutex
+}
+
+// NewFaucet creates the onboarding endpoints for the given chain, refusing to
+// run on the main network.
+func NewFaucet(config FaucetConfig, chainID *big.Int, send FaucetSendFn) (*Faucet, error) {
+	if chainID != nil && chainID.Cmp(params.EquaMainnetChainConfig.ChainID) == 0 {
+		return nil, errFaucetMainnet
+	}
+	if config.Period <= 0 {
+		config.Period = DefaultFaucetConfig.Period
+	}
+	f := &Faucet{
+		config: config,
+		send:   send,
+		last:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+	if config.Referral != "" {
+		referral, err := url.Parse(config.Referral)
+		if err != nil {
+			return nil, fmt.Errorf("invalid staking helper URL: %v", err)
+		}
+		f.referral = referral
+	}
+	return f, nil
+}
+
+// allow grants a request of the given keys, failing if any of them was granted
+// one within the configured period. The caller must hold the lock.
+func (f *Faucet) allow(keys ...string) error {
+	now := f.now()
+	for key, last := range f.last {
+		if now.Sub(last) >= f.config.Period {
+			delete(f.last, key)
+		}
+	}
+	for _, key := range keys {
+		if last, ok := f.last[key]; ok {
+			return fmt.Errorf("%w: retry in %v", errFaucetRateLimited, last.Add(f.config.Period).Sub(now).Round(time.Second))
+		}
+	}
+	for _, key := range keys {
+		f.last[key] = now
+	}
+	return nil
+}
+
+// Fund sends the configured amount to an address. Every address and client is
+// granted at most one request per period.
+func (f *Faucet) Fund(client string, to common.Address) (common.Hash, error) {
+	if f.config.Amount == nil || f.send == nil {
+		return common.Hash{}, errFaucetDisabled
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	keys := []string{to.Hex()}
+	if client != "" {
+		keys = append(keys, client)
+	}
+	if err := f.allow(keys...); err != nil {
+		return common.Hash{}, err
+	}
+	hash, err := f.send(f.config.Account, to, f.config.Amount)
+	if err != nil {
+		// Failed transfers don't count against the limit
+		for _, key := range keys {
+			delete(f.last, key)
+		}
+		return common.Hash{}, err
+	}
+	faucetMeter.Mark(1)
+	log.Info("Sent faucet funds", "to", to, "amount", f.config.Amount, "tx", hash)
+	return hash, nil
+}
+
+// Onboarding reports the staking status of an address, referring it to the
+// staking helper if it has no stake yet.
+func (f *Faucet) Onboarding(sm *StakeManager, addr common.Address) *Onboarding {
+	status := &Onboarding{
+		Address:  addr,
+		Staked:   sm.HasStake(addr),
+		Eligible: sm.IsEligible(addr),
+	}
+	if !status.Staked && f.referral != nil {
+		referral := *f.referral
+		query := referral.Query()
+		query.Set("address", addr.Hex())
+		referral.RawQuery = query.Encode()
+		status.Referral = referral.String()
+	}
+	return status
+}
+
+// faucetClient identifies the client of an RPC request by its host, so that a
+// client cannot get around the rate limit by reconnecting.
+func faucetClient(ctx context.Context) string {
+	addr := rpc.PeerInfoFromContext(ctx).RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that faucet requests are limited per address and per client, and that
+// failed transfers do not count against the limit.
+func TestFaucetRateLimit(t *testing.T) {
+	var (
+		now   = time.Unix(1700000000, 0)
+		fail  bool
+		sent  []common.Address
+		alice = common.Address{0xa}
+		bob   = common.Address{0xb}
+	)
+	send := func(from, to common.Address, amount *big.Int) (common.Hash, error) {
+		if fail {
+			return common.Hash{}, errors.New("pool full")
+		}
+		sent = append(sent, to)
+		return common.Hash{byte(len(sent))}, nil
+	}
+	faucet, err := NewFaucet(FaucetConfig{Amount: big.NewInt(1), Period: time.Hour}, params.EquaTestnetChainConfig.ChainID, send)
+	if err != nil {
+		t.Fatalf("failed to create faucet: %v", err)
+	}
+	faucet.now = func() time.Time { return now }
+
+	if _, err := faucet.Fund("10.0.0.1", alice); err != nil {
+		t.Fatalf("first request rejected: %v", err)
+	}
+	if _, err := faucet.Fund("10.0.0.2", alice); !errors.Is(err, errFaucetRateLimited) {
+		t.Errorf("repeated address: error mismatch: have %v, want %v", err, errFaucetRateLimited)
+	}
+	if _, err := faucet.Fund("10.0.0.1", bob); !errors.Is(err, errFaucetRateLimited) {
+		t.Errorf("repeated client: error mismatch: have %v, want %v", err, errFaucetRateLimited)
+	}
+	fail = true
+	if _, err := faucet.Fund("10.0.0.2", bob); err == nil {
+		t.Fatalf("failed transfer reported as sent")
+	}
+	fail = false
+	if _, err := faucet.Fund("10.0.0.2", bob); err != nil {
+		t.Errorf("request after failed transfer rejected: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := faucet.Fund("10.0.0.1", alice); err != nil {
+		t.Errorf("request after period rejected: %v", err)
+	}
+	if len(sent) != 3 {
+		t.Errorf("transfer count mismatch: have %d, want 3", len(sent))
+	}
+}
+
+// Tests that the onboarding endpoints are refused on the main network and that
+// only unstaked addresses are referred to the staking helper.
+func TestFaucetGating(t *testing.T) {
+	config := FaucetConfig{Amount: big.NewInt(1), Referral: "https://stake.example.org/join?ref=node"}
+	if _, err := NewFaucet(config, params.EquaMainnetChainConfig.ChainID, nil); !errors.Is(err, errFaucetMainnet) {
+		t.Fatalf("mainnet faucet: error mismatch: have %v, want %v", err, errFaucetMainnet)
+	}
+	var (
+		engine = newTestEngine(t, 32)
+		addr   = common.Address{0xa}
+	)
+	faucet, _ := NewFaucet(config, params.EquaTestnetChainConfig.ChainID, nil)
+	status := faucet.Onboarding(engine.stakeManager, addr)
+	if want := "https://stake.example.org/join?address=" + addr.Hex() + "&ref=node"; status.Staked || status.Referral != want {
+		t.Errorf("unstaked onboarding mismatch: have %+v, want referral %s", status, want)
+	}
+	engine.stakeManager.AddValidator(addr, new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)), nil)
+	if status := faucet.Onboarding(engine.stakeManager, addr); !status.Staked || status.Referral != "" {
+		t.Errorf("staked onboarding mismatch: have %+v", status)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
+	"github.com/equa/go-equa/params"
+)
+
+// Feature names of the optional engine subsystems, see params.EquaFeatures.
+const (
+	FeatureEncryptedMempool      = "encrypted-mempool"
+	FeatureBuilderMarket         = "builder-market"
+	FeatureBundles               = "bundles"
+	FeatureComplianceStatements  = "compliance-statements"
+	FeatureVersionSignaling      = "version-signaling"
+	FeatureSlashingExecution     = "slashing-execution"
+	FeatureDifficultyRetargeting = "difficulty-retargeting"
+	FeatureInclusionLists        = "inclusion-lists"
+	FeatureValidatorSetCommits   = "validator-set-commitments"
+	FeatureOrderingCommitments   = "ordering-commitments"
+	FeatureEffectiveGasPrice     = "effective-gas-price"
+)
+
+// featureMetrics tracks whether a feature is enabled and how often its code
+// path is taken, so operators can follow a staged rollout.
+type featureMetrics struct {
+	enabled *metrics.Gauge
+	used    *metrics.Meter
+}
+
+var featureTelemetry = make(map[string]*featureMetrics)
+
+func init() {
+	for _, feature := range params.EquaFeatures {
+		featureTelemetry[feature.Name] = &featureMetrics{
+			enabled: metrics.NewRegisteredGauge("equa/features/"+feature.Name+"/enabled", nil),
+			used:    metrics.NewRegisteredMeter("equa/features/"+feature.Name+"/used", nil),
+		}
+	}
+}
+
+// reportFeatures logs the enabled features, warning about experimental ones,
+// and publishes their state.
+func reportFeatures(config *params.EquaConfig) {
+	for _, feature := range params.EquaFeatures {
+		enabled := config.FeatureEnabled(feature.Name)
+		if enabled {
+			featureTelemetry[feature.Name].enabled.Update(1)
+		} else {
+			featureTelemetry[feature.Name].enabled.Update(0)
+		}
+		switch {
+		case enabled && feature.Experimental:
+			log.Warn("Experimental EQUA feature enabled, not recommended for production", "feature", feature.Name, "description", feature.Description)
+		case enabled != feature.Default:
+			log.Info("EQUA feature overridden", "feature", feature.Name, "enabled", enabled)
+		}
+	}
+}
+
+// featureEnabled reports whether the named feature is enabled, counting the
+// check as a use of the feature if so. It must be called on the feature's
+// code path only.
+func (e *Equa) featureEnabled(name string) bool {
+	if !e.config.FeatureEnabled(name) {
+		return false
+	}
+	if telemetry := featureTelemetry[name]; telemetry != nil {
+		telemetry.used.Mark(1)
+	}
+	return true
+}
+
+// Features returns the known features along with whether they are enabled.
+func (e *Equa) Features() []FeatureStatus {
+	features := make([]FeatureStatus, 0, len(params.EquaFeatures))
+	for _, feature := range params.EquaFeatures {
+		features = append(features, FeatureStatus{
+			Name:         feature.Name,
+			Description:  feature.Description,
+			Experimental: feature.Experimental,
+			Enabled:      e.config.FeatureEnabled(feature.Name),
+		})
+	}
+	return features
+}
+
+// FeatureStatus is the state of a feature as reported over the API.
+type FeatureStatus struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Experimental bool   `json:"experimental"`
+	Enabled      bool   `json:"enabled"`
+}
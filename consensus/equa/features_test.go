@@ -0,0 +1,55 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"testing"
+
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that features fall back to their defaults unless configured, and that
+// experimental features are disabled by default.
+func TestFeatureDefaults(t *testing.T) {
+	for _, feature := range params.EquaFeatures {
+		if feature.Experimental && feature.Default {
+			t.Errorf("experimental feature %s enabled by default", feature.Name)
+		}
+	}
+	engine := newTestEngine(t, 32)
+	if engine.featureEnabled(FeatureEncryptedMempool) {
+		t.Errorf("encrypted mempool enabled by default")
+	}
+	if !engine.featureEnabled(FeatureBuilderMarket) {
+		t.Errorf("builder market disabled by default")
+	}
+	engine.config.Features = map[string]bool{FeatureEncryptedMempool: true, FeatureBuilderMarket: false}
+	if !engine.featureEnabled(FeatureEncryptedMempool) {
+		t.Errorf("encrypted mempool not enabled by configuration")
+	}
+	if engine.featureEnabled(FeatureBuilderMarket) {
+		t.Errorf("builder market not disabled by configuration")
+	}
+	if engine.featureEnabled("unknown") {
+		t.Errorf("unknown feature enabled")
+	}
+	for _, status := range engine.Features() {
+		if status.Enabled != engine.config.Features[status.Name] {
+			t.Errorf("feature %s status mismatch: have %v", status.Name, status.Enabled)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/rlp"
+)
+
+var errInvalidFilterSignature = errors.New("invalid filter declaration signature")
+
+// FilterDeclaration is a public, signed statement by a validator listing the
+// contracts it will not interact with in the blocks it proposes (e.g. because
+// of legal requirements). Blocks complying with a declared filter are not
+// treated as covert censorship.
+type FilterDeclaration struct {
+	Validator common.Address   `json:"validator"` // Validator declaring the filter
+	Contracts []common.Address `json:"contracts"` // Contracts excluded from the validator's blocks
+	Signature hexutil.Bytes    `json:"signature"` // Signature over SigHash by the validator's account key
+}
+
+// SigHash returns the hash signed by the validator.
+func (decl *FilterDeclaration) SigHash() common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{decl.Validator, decl.Contracts})
+	return crypto.Keccak256Hash([]byte("equa-filter-declaration"), enc)
+}
+
+// Sign signs the declaration with the given key, which must belong to the
+// validator.
+func (decl *FilterDeclaration) Sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(decl.SigHash().Bytes(), key)
+	if err != nil {
+		return err
+	}
+	decl.Signature = sig
+	return nil
+}
+
+// Verify checks that the declaration was signed by the validator it refers to.
+func (decl *FilterDeclaration) Verify() error {
+	if len(decl.Signature) != crypto.SignatureLength {
+		return errInvalidFilterSignature
+	}
+	pubkey, err := crypto.SigToPub(decl.SigHash().Bytes(), decl.Signature)
+	if err != nil {
+		return errInvalidFilterSignature
+	}
+	if crypto.PubkeyToAddress(*pubkey) != decl.Validator {
+		return errInvalidFilterSignature
+	}
+	return nil
+}
+
+// Filters checks whether the declaration excludes the given contract.
+func (decl *FilterDeclaration) Filters(contract common.Address) bool {
+	for _, filtered := range decl.Contracts {
+		if filtered == contract {
+			return true
+		}
+	}
+	return false
+}
+
+// Complies checks that none of the transactions interact with a contract
+// excluded by the declaration.
+func (decl *FilterDeclaration) Complies(txs []*types.Transaction) bool {
+	for _, tx := range txs {
+		if tx.To() != nil && decl.Filters(*tx.To()) {
+			return false
+		}
+	}
+	return true
+}
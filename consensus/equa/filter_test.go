@@ -0,0 +1,68 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that filter declarations must be signed by the declaring validator and
+// that only blocks complying with a declared filter are exempt from covert
+// censorship checks.
+func TestFilterDeclaration(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	sanctioned := common.HexToAddress("0x5a0c710000000000000000000000000000000001")
+
+	engine := newTestEngine(t, 32, addr)
+
+	forged := &FilterDeclaration{Validator: addr, Contracts: []common.Address{sanctioned}}
+	if err := forged.Sign(other); err != nil {
+		t.Fatalf("failed to sign declaration: %v", err)
+	}
+	if err := engine.stakeManager.DeclareFilter(forged); !errors.Is(err, errInvalidFilterSignature) {
+		t.Fatalf("forged declaration: have %v, want %v", err, errInvalidFilterSignature)
+	}
+	compliant := []*types.Transaction{
+		types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil),
+	}
+	violating := append(compliant, types.NewTransaction(1, sanctioned, big.NewInt(1), 21000, big.NewInt(1), nil))
+
+	if engine.declaredFilterApplies(addr, compliant) {
+		t.Fatalf("filter applied without declaration")
+	}
+	decl := &FilterDeclaration{Validator: addr, Contracts: []common.Address{sanctioned}}
+	if err := decl.Sign(key); err != nil {
+		t.Fatalf("failed to sign declaration: %v", err)
+	}
+	if err := engine.stakeManager.DeclareFilter(decl); err != nil {
+		t.Fatalf("failed to declare filter: %v", err)
+	}
+	if !engine.declaredFilterApplies(addr, compliant) {
+		t.Errorf("compliant block not covered by declared filter")
+	}
+	if engine.declaredFilterApplies(addr, violating) {
+		t.Errorf("block touching filtered contract covered by declared filter")
+	}
+}
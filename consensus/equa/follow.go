@@ -0,0 +1,144 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/event"
+	"github.com/equa/go-equa/log"
+)
+
+const (
+	finalizedLimit     = 256 // Processed blocks whose finalization outcome is kept until written
+	chainEventChanSize = 16  // Buffered canonical block events from the chain
+)
+
+// chainSubscriber is the part of the blockchain announcing new canonical blocks.
+type chainSubscriber interface {
+	consensus.ChainReader
+	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+}
+
+// StartChainFollower starts applying the canonical blocks to the engine once
+// they are validated and written: the validators loaded from the state, the
+// blocks they proposed last, the pending bundles and slashing evidence and the
+// metrics follow the canonical chain, until the engine is closed.
+func (e *Equa) StartChainFollower(chain chainSubscriber) {
+	ch := make(chan core.ChainEvent, chainEventChanSize)
+	sub := chain.SubscribeChainEvent(ch)
+
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-ch:
+				e.followChain(chain)
+			case <-sub.Err():
+				return
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// followChain applies the canonical blocks written since the block the stake
+// manager follows, going back at most maxScanBlocks blocks from the head. The
+// validators are loaded again from the state of the head if any of the blocks
+// changed the validator registry, or if the followed block was reorged out.
+func (e *Equa) followChain(chain consensus.ChainReader) {
+	if !e.stakeManager.loaded() {
+		e.loadValidators(chain)
+		return
+	}
+	head := chain.CurrentHeader()
+	if head == nil {
+		return
+	}
+	// Collect the blocks from the head back to the followed one, or to the point
+	// the chain forked from it at. The followed block may also be gone, e.g.
+	// after rewinding the chain
+	last := chain.GetHeaderByHash(e.stakeManager.followed())
+	var (
+		headers []*types.Header
+		changed bool
+	)
+	for last != nil && last.Number.Uint64() > head.Number.Uint64() {
+		last, changed = chain.GetHeader(last.ParentHash, last.Number.Uint64()-1), true
+	}
+	header := head
+	for header != nil && last != nil && header.Hash() != last.Hash() && len(headers) < maxScanBlocks {
+		headers = append(headers, header)
+		if header.Number.Uint64() == last.Number.Uint64() {
+			last, changed = chain.GetHeader(last.ParentHash, last.Number.Uint64()-1), true
+		}
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	if header == nil || last == nil || header.Hash() != last.Hash() {
+		changed = true
+	}
+	for i := len(headers) - 1; i >= 0; i-- {
+		if e.applyBlock(chain, headers[i]) {
+			changed = true
+		}
+	}
+	if !changed {
+		e.stakeManager.follow(head.Hash())
+		return
+	}
+	statedb, err := stateAt(chain, head.Root)
+	if err != nil {
+		log.Debug("Validator registry unavailable", "number", head.Number, "err", err)
+		return
+	}
+	e.stakeManager.load(statedb, head.Hash())
+}
+
+// applyBlock applies a canonical block to the engine, reporting whether it may
+// have changed the validator registry. Blocks whose finalization outcome is not
+// known, e.g. written before a restart, are left out of the MEV metrics.
+func (e *Equa) applyBlock(chain consensus.ChainReader, header *types.Header) bool {
+	number := header.Number.Uint64()
+	result, known := e.finalized.Get(header.Hash())
+	if known {
+		if result.mev.Sign() > 0 {
+			burned, _ := e.splitMEV(result.mev)
+			mevBlockMeter.Mark(1)
+			mevBurnedCounter.Inc(toGwei(burned))
+		}
+		mevHistogram.Update(toGwei(result.mev))
+	}
+	e.stakeManager.UpdateLastBlock(header.Coinbase, number)
+
+	// Drop the bundles that can no longer be included as a whole, and the
+	// slashing evidence that can no longer be acted upon at epoch boundaries
+	if block := chain.GetBlock(header.Hash(), number); block != nil {
+		e.bundles.Prune(block.Transactions())
+
+		score := e.fairOrderer.GetOrderingScore(block.Transactions())
+		orderingScoreGauge.Update(score)
+		orderingHistogram.Update(int64(score * 100))
+	}
+	if number%e.config.Epoch == 0 {
+		if pruned := e.slasher.PruneEvidence(number); pruned > 0 {
+			log.Debug("Pruned expired slashing evidence", "number", number, "count", pruned)
+		}
+	}
+	return !known || result.validators
+}
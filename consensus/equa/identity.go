@@ -0,0 +1,93 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"net"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/rlp"
+)
+
+var (
+	errInvalidIdentitySignature = errors.New("invalid node identity signature")
+	errInvalidIdentityIP        = errors.New("invalid node identity IP address")
+)
+
+// NodeIdentity is optional, self-reported metadata about the infrastructure a
+// validator runs on, signed by the validator. It is only used to estimate how
+// correlated validator failures might be and carries no consensus weight.
+type NodeIdentity struct {
+	Validator common.Address `json:"validator"`          // Validator describing its node
+	IP        string         `json:"ip"`                 // Public IP address of the node
+	Provider  string         `json:"provider,omitempty"` // Hosting provider, if any
+	Region    string         `json:"region,omitempty"`   // Geographic region of the node
+	Signature hexutil.Bytes  `json:"signature"`          // Signature over SigHash by the validator's account key
+}
+
+// SigHash returns the hash signed by the validator.
+func (id *NodeIdentity) SigHash() common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{id.Validator, id.IP, id.Provider, id.Region})
+	return crypto.Keccak256Hash([]byte("equa-node-identity"), enc)
+}
+
+// Sign signs the identity with the given key, which must belong to the
+// validator.
+func (id *NodeIdentity) Sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(id.SigHash().Bytes(), key)
+	if err != nil {
+		return err
+	}
+	id.Signature = sig
+	return nil
+}
+
+// Verify checks that the identity is well formed and was signed by the
+// validator it refers to.
+func (id *NodeIdentity) Verify() error {
+	if net.ParseIP(id.IP) == nil {
+		return errInvalidIdentityIP
+	}
+	if len(id.Signature) != crypto.SignatureLength {
+		return errInvalidIdentitySignature
+	}
+	pubkey, err := crypto.SigToPub(id.SigHash().Bytes(), id.Signature)
+	if err != nil {
+		return errInvalidIdentitySignature
+	}
+	if crypto.PubkeyToAddress(*pubkey) != id.Validator {
+		return errInvalidIdentitySignature
+	}
+	return nil
+}
+
+// Subnet returns the network range the node's address falls into: the /24 for
+// IPv4 and the /48 for IPv6, which usually belong to a single operator.
+func (id *NodeIdentity) Subnet() string {
+	ip := net.ParseIP(id.IP)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
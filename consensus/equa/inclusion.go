@@ -0,0 +1,306 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/rlp"
+)
+
+// A proposer publishes an inclusion list in the compliance statement of its
+// block: the pending transactions that waited the longest, which the next block
+// must include. The list carries the transactions themselves, so the next
+// proposer can include them even if they never reached its pool. A block may
+// skip a listed transaction only for reasons visible without executing it: it
+// includes another transaction of the same sender, which may have replaced or
+// invalidated the listed one, it has no gas left for it, or its base fee is
+// above the fee cap of the transaction. Anything else is censorship, and the
+// block is rejected.
+
+const (
+	maxInclusionListTxs  = 16        // Transactions an inclusion list names at most
+	maxInclusionListSize = 64 * 1024 // Encoded size of the listed transactions at most
+)
+
+var (
+	errInvalidInclusionList     = errors.New("malformed inclusion list")
+	errInvalidInclusionListSig  = errors.New("inclusion list not signed by proposer")
+	errInclusionListUnsatisfied = errors.New("block skips transactions of the inclusion list")
+	errNoInclusionList          = errors.New("no inclusion list")
+)
+
+// InclusionSourceFn is a callback returning the executable pending transactions,
+// at most the lowest nonce one per sender, to build inclusion lists from.
+type InclusionSourceFn func() []*types.Transaction
+
+// InclusionList is a proposer's signed list of pending transactions the next
+// block must include, carried in the compliance statement of its block.
+type InclusionList struct {
+	Transactions []*types.Transaction
+	Signature    []byte // Proposer's signature over inclusionListSigData
+}
+
+// inclusionListSigData returns the data signed by the proposer for the list of
+// its block. The signature is made over its Keccak256 hash.
+func inclusionListSigData(header *types.Header, txs []*types.Transaction) []byte {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	enc, _ := rlp.EncodeToBytes([]interface{}{header.ParentHash, header.Number, header.Coinbase, hashes})
+	return append([]byte("equa-inclusion-list"), enc...)
+}
+
+// verify checks that the list is within bounds, free of duplicates and blob
+// transactions, holds signed transactions only and is signed by the proposer of
+// the header carrying it.
+func (l *InclusionList) verify(signer types.Signer, header *types.Header) error {
+	if len(l.Transactions) > maxInclusionListTxs {
+		return fmt.Errorf("%w: %d transactions, max %d", errInvalidInclusionList, len(l.Transactions), maxInclusionListTxs)
+	}
+	var (
+		size uint64
+		seen = make(map[common.Hash]bool)
+	)
+	for _, tx := range l.Transactions {
+		if tx.Type() == types.BlobTxType {
+			return fmt.Errorf("%w: blob transaction %x", errInvalidInclusionList, tx.Hash())
+		}
+		if seen[tx.Hash()] {
+			return fmt.Errorf("%w: duplicate transaction %x", errInvalidInclusionList, tx.Hash())
+		}
+		if _, err := types.Sender(signer, tx); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidInclusionList, err)
+		}
+		seen[tx.Hash()] = true
+		size += tx.Size()
+	}
+	if size > maxInclusionListSize {
+		return fmt.Errorf("%w: %d bytes, max %d", errInvalidInclusionList, size, maxInclusionListSize)
+	}
+	if len(l.Signature) != crypto.SignatureLength {
+		return errInvalidInclusionListSig
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(inclusionListSigData(header, l.Transactions)), l.Signature)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != header.Coinbase {
+		return errInvalidInclusionListSig
+	}
+	return nil
+}
+
+// inclusionList returns the inclusion list published in a header, or nil if it
+// carries none.
+func inclusionList(signer types.Signer, header *types.Header) (*InclusionList, error) {
+	statement, err := decodeStatement(header)
+	if errors.Is(err, errMissingStatement) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if statement.InclusionList == nil {
+		return nil, nil
+	}
+	if err := statement.InclusionList.verify(signer, header); err != nil {
+		return nil, err
+	}
+	return statement.InclusionList, nil
+}
+
+// UseInclusionSource sets the callback inclusion lists are built from when
+// sealing blocks. Without one, the published lists are empty.
+func (e *Equa) UseInclusionSource(source InclusionSourceFn) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.inclusionSource = source
+}
+
+// buildInclusionList selects the pending transactions the block after one
+// including txs must include: the earliest arrivals whose senders do not send
+// any of txs, within the bounds of a list. Candidates of unknown arrival are
+// ordered by their effective gas price for the base fee.
+func (e *Equa) buildInclusionList(signer types.Signer, txs []*types.Transaction, baseFee *big.Int) []*types.Transaction {
+	e.lock.RLock()
+	source := e.inclusionSource
+	e.lock.RUnlock()
+
+	if source == nil {
+		return nil
+	}
+	// Senders of the block have their nonces moved, their pending transactions
+	// may not be executable anymore
+	senders := make(map[common.Address]bool)
+	for _, tx := range txs {
+		if from, err := types.Sender(signer, tx); err == nil {
+			senders[from] = true
+		}
+	}
+	var candidates []*types.Transaction
+	for _, tx := range source() {
+		if tx.Type() == types.BlobTxType {
+			continue
+		}
+		if from, err := types.Sender(signer, tx); err != nil || senders[from] {
+			continue
+		}
+		candidates = append(candidates, tx)
+	}
+	var (
+		list []*types.Transaction
+		size uint64
+	)
+	// The listed block states its shuffle seed, candidates of random batches
+	// are only shuffled with the zero seed to pick them
+	for _, tx := range e.fairOrderer.OrderTransactions(candidates, baseFee, common.Hash{}) {
+		if len(list) == maxInclusionListTxs {
+			break
+		}
+		if size+tx.Size() > maxInclusionListSize {
+			continue
+		}
+		list = append(list, tx)
+		size += tx.Size()
+	}
+	return list
+}
+
+// signInclusionList builds the inclusion list published in a header for the
+// block after it and signs it with the given account.
+func (e *Equa) signInclusionList(header *types.Header, txs []*types.Transaction, signer common.Address, signFn SignerFn) (*InclusionList, error) {
+	list := &InclusionList{
+		Transactions: e.buildInclusionList(e.senders, txs, header.BaseFee),
+	}
+	sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeEquaInclusionList, inclusionListSigData(header, list.Transactions))
+	if err != nil {
+		return nil, err
+	}
+	list.Signature = sig
+	return list, nil
+}
+
+// InclusionList returns the transactions listed by the proposer of the parent
+// block, which the miner should include before any other transactions.
+func (e *Equa) InclusionList(parent *types.Header) []*types.Transaction {
+	if !e.featureEnabled(FeatureInclusionLists) {
+		return nil
+	}
+	list, err := inclusionList(e.senders, parent)
+	if err != nil || list == nil {
+		return nil
+	}
+	return list.Transactions
+}
+
+// unsatisfiedInclusions returns the transactions of an inclusion list that a
+// block skips without a reason.
+func unsatisfiedInclusions(signer types.Signer, list *InclusionList, block *types.Block) []common.Hash {
+	if len(list.Transactions) == 0 {
+		return nil
+	}
+	var (
+		included = make(map[common.Hash]bool)
+		senders  = make(map[common.Address]bool)
+	)
+	for _, tx := range block.Transactions() {
+		included[tx.Hash()] = true
+		if from, err := types.Sender(signer, tx); err == nil {
+			senders[from] = true
+		}
+	}
+	var (
+		remaining = block.GasLimit() - min(block.GasUsed(), block.GasLimit())
+		missing   []common.Hash
+	)
+	for _, tx := range list.Transactions {
+		if included[tx.Hash()] || tx.Gas() > remaining {
+			continue
+		}
+		if block.BaseFee() != nil && tx.GasFeeCap().Cmp(block.BaseFee()) < 0 {
+			continue
+		}
+		// Senders of listed transactions were recovered when verifying the list
+		if from, _ := types.Sender(signer, tx); senders[from] {
+			continue
+		}
+		missing = append(missing, tx.Hash())
+	}
+	return missing
+}
+
+// verifyInclusions checks that a block includes the transactions listed by the
+// proposer of its parent, unless it has a reason to skip them.
+func (e *Equa) verifyInclusions(chain consensus.ChainHeaderReader, block *types.Block) error {
+	parent := chain.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	list, err := inclusionList(e.senders, parent)
+	if err != nil || list == nil {
+		return err
+	}
+	if missing := unsatisfiedInclusions(e.senders, list, block); len(missing) > 0 {
+		log.Debug("Block skips listed transactions", "number", block.Number(), "hash", block.Hash(), "missing", len(missing))
+		return fmt.Errorf("%w: %d of %d, first %x", errInclusionListUnsatisfied, len(missing), len(list.Transactions), missing[0])
+	}
+	return nil
+}
+
+// InclusionListStatus reports the inclusion list published in a block, and
+// whether the block after it honored the list.
+type InclusionListStatus struct {
+	Number       uint64         `json:"number"` // Block publishing the list
+	Proposer     common.Address `json:"proposer"`
+	Transactions []common.Hash  `json:"transactions"`        // Listed transactions, in list order
+	Satisfied    *bool          `json:"satisfied,omitempty"` // Whether the next block honored the list, if it exists
+	Missing      []common.Hash  `json:"missing,omitempty"`   // Listed transactions the next block skipped without a reason
+}
+
+// inclusionListStatus reports the inclusion list published in a header, checked
+// against the next block if it is not nil.
+func inclusionListStatus(signer types.Signer, header *types.Header, next *types.Block) (*InclusionListStatus, error) {
+	list, err := inclusionList(signer, header)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return nil, errNoInclusionList
+	}
+	status := &InclusionListStatus{
+		Number:       header.Number.Uint64(),
+		Proposer:     header.Coinbase,
+		Transactions: make([]common.Hash, len(list.Transactions)),
+	}
+	for i, tx := range list.Transactions {
+		status.Transactions[i] = tx.Hash()
+	}
+	if next != nil {
+		status.Missing = unsatisfiedInclusions(signer, list, next)
+		satisfied := len(status.Missing) == 0
+		status.Satisfied = &satisfied
+	}
+	return status, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that proposers publish signed inclusion lists of the earliest pending
+// transactions, and that the next block must include them unless it has a
+// reason to skip them.
+func TestInclusionList(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	proposer := crypto.PubkeyToAddress(key.PublicKey)
+
+	engine := newTestEngine(t, 32, proposer)
+	engine.config.Features = map[string]bool{FeatureComplianceStatements: true, FeatureInclusionLists: true}
+	engine.Authorize(proposer, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	// Pending transactions of distinct senders, the last one sending in the
+	// block publishing the list
+	var pending []*types.Transaction
+	for i := 0; i < 4; i++ {
+		pending = append(pending, newTestTransactions(t, 1)...)
+	}
+	recordTestArrivals(engine.arrivals, pending)
+	engine.UseInclusionSource(func() []*types.Transaction {
+		return []*types.Transaction{pending[2], pending[0], pending[3], pending[1]}
+	})
+	chain := &testBlockChain{
+		testHeaderChain: testHeaderChain{
+			config:  newTestChainConfig(engine.config),
+			headers: []*types.Header{{Number: big.NewInt(0)}},
+		},
+		blocks: make(map[common.Hash]*types.Block),
+	}
+	header := &types.Header{ParentHash: chain.headers[0].Hash(), Number: big.NewInt(1), Coinbase: proposer}
+	if err := engine.signStatement(header, pending[3:], nil); err != nil {
+		t.Fatalf("failed to sign statement: %v", err)
+	}
+	chain.headers = append(chain.headers, header)
+
+	signer := types.LatestSigner(chain.config)
+	list, err := inclusionList(signer, header)
+	if err != nil {
+		t.Fatalf("failed to decode inclusion list: %v", err)
+	}
+	listed := engine.InclusionList(header)
+	if !slices.EqualFunc(listed, pending[:3], func(a, b *types.Transaction) bool { return a.Hash() == b.Hash() }) {
+		t.Fatalf("listed transactions mismatch: have %d, want %d in arrival order", len(listed), 3)
+	}
+	// The list is bound to the proposer and the block
+	other := types.CopyHeader(header)
+	other.Coinbase = common.Address{0x01}
+	if err := list.verify(signer, other); err != errInvalidInclusionListSig {
+		t.Fatalf("list of other proposer: have %v, want %v", err, errInvalidInclusionListSig)
+	}
+	forged := &InclusionList{Transactions: pending, Signature: list.Signature}
+	if err := forged.verify(signer, header); err != errInvalidInclusionListSig {
+		t.Fatalf("extended list: have %v, want %v", err, errInvalidInclusionListSig)
+	}
+	duplicate := &InclusionList{Transactions: []*types.Transaction{pending[0], pending[0]}}
+	if err := duplicate.verify(signer, header); !errors.Is(err, errInvalidInclusionList) {
+		t.Fatalf("duplicate listing: have %v, want %v", err, errInvalidInclusionList)
+	}
+	// The next block must include the listed transactions, unless it has a
+	// reason to skip them
+	replacement := newTestTransactions(t, 1)[0]
+	tests := []struct {
+		name    string
+		txs     []*types.Transaction
+		gasUsed uint64
+		baseFee *big.Int
+		missing int
+	}{
+		{"all included", pending[:3], 63000, nil, 0},
+		{"one skipped", pending[:2], 42000, nil, 1},
+		{"all skipped", nil, 0, nil, 3},
+		{"block full", nil, 990000, nil, 0},
+		{"fee cap below base fee", nil, 0, big.NewInt(2e9), 0},
+		{"unrelated transaction", []*types.Transaction{replacement}, 21000, nil, 3},
+	}
+	for _, tt := range tests {
+		block := types.NewBlockWithHeader(&types.Header{
+			ParentHash: header.Hash(),
+			Number:     big.NewInt(2),
+			Coinbase:   proposer,
+			GasLimit:   1000000,
+			GasUsed:    tt.gasUsed,
+			BaseFee:    tt.baseFee,
+		}).WithBody(types.Body{Transactions: tt.txs})
+
+		if missing := unsatisfiedInclusions(signer, list, block); len(missing) != tt.missing {
+			t.Errorf("%s: missing transactions mismatch: have %d, want %d", tt.name, len(missing), tt.missing)
+		}
+		err := engine.VerifyUncles(chain, block)
+		if tt.missing > 0 && !errors.Is(err, errInclusionListUnsatisfied) {
+			t.Errorf("%s: have %v, want %v", tt.name, err, errInclusionListUnsatisfied)
+		}
+		if tt.missing == 0 && err != nil {
+			t.Errorf("%s: block rejected: %v", tt.name, err)
+		}
+	}
+	// The API reports the list along with whether the next block honored it
+	api := &API{chain: chain, equa: engine}
+	if _, err := api.GetInclusionList(0); err != errNoInclusionList {
+		t.Fatalf("block without list: have %v, want %v", err, errNoInclusionList)
+	}
+	status, err := api.GetInclusionList(1)
+	if err != nil {
+		t.Fatalf("failed to get inclusion list: %v", err)
+	}
+	if len(status.Transactions) != 3 || status.Satisfied != nil {
+		t.Fatalf("pending list mismatch: have %d transactions, satisfied %v", len(status.Transactions), status.Satisfied)
+	}
+	next := types.NewBlockWithHeader(&types.Header{ParentHash: header.Hash(), Number: big.NewInt(2), GasLimit: 1000000}).WithBody(types.Body{Transactions: pending[1:3]})
+	chain.headers = append(chain.headers, next.Header())
+	chain.blocks[next.Hash()] = next
+
+	if status, err = api.GetInclusionList(1); err != nil {
+		t.Fatalf("failed to get inclusion list: %v", err)
+	}
+	if status.Satisfied == nil || *status.Satisfied || !slices.Equal(status.Missing, []common.Hash{pending[0].Hash()}) {
+		t.Fatalf("skipped transaction not reported: satisfied %v, missing %v", status.Satisfied, status.Missing)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/holiman/uint256"
+)
+
+// Consensus amounts are kept in big.Int (or uint256 when touching state) all the
+// way through. The helpers below are the only places they are scaled, so that a
+// value out of range panics instead of being silently truncated.
+
+// mulDiv returns x*y/z, rounded down, without intermediate overflow.
+func mulDiv(x *big.Int, y, z uint64) *big.Int {
+	if z == 0 {
+		panic("equa: division by zero")
+	}
+	r := new(big.Int).Mul(x, new(big.Int).SetUint64(y))
+	return r.Div(r, new(big.Int).SetUint64(z))
+}
+
+// percentOf returns the given percentage of an amount, rounded down.
+func percentOf(amount *big.Int, percent uint64) *big.Int {
+	return mulDiv(amount, percent, 100)
+}
+
+// toUint256 converts an amount for use in the state, panicking if it is
+// negative or does not fit into 256 bits.
+func toUint256(amount *big.Int) *uint256.Int {
+	if amount.Sign() < 0 {
+		panic(fmt.Sprintf("equa: negative amount %v", amount))
+	}
+	v, overflow := uint256.FromBig(amount)
+	if overflow {
+		panic(fmt.Sprintf("equa: amount %v overflows 256 bits", amount))
+	}
+	return v
+}
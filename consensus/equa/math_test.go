@@ -0,0 +1,160 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+var (
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	maxUint64  = new(big.Int).SetUint64(math.MaxUint64)
+)
+
+// Tests that percentages of arbitrarily large amounts never exceed the amount
+// and that complementary percentages add up to the amount, less rounding.
+func TestPercentOfProperties(t *testing.T) {
+	check := func(seed [32]byte, percent uint8) bool {
+		amount := new(big.Int).SetBytes(seed[:])
+		p := uint64(percent) % 101
+
+		part, rest := percentOf(amount, p), percentOf(amount, 100-p)
+		if part.Sign() < 0 || part.Cmp(amount) > 0 {
+			return false
+		}
+		sum := new(big.Int).Add(part, rest)
+		diff := new(big.Int).Sub(amount, sum)
+		return diff.Sign() >= 0 && diff.Cmp(big.NewInt(1)) <= 0
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, amount := range []*big.Int{maxUint64, maxUint256} {
+		if have := percentOf(amount, 100); have.Cmp(amount) != 0 {
+			t.Errorf("100%% of %v: have %v", amount, have)
+		}
+	}
+	if have, want := mulDiv(maxUint256, math.MaxUint64, math.MaxUint64), maxUint256; have.Cmp(want) != 0 {
+		t.Errorf("mulDiv overflowed: have %v, want %v", have, want)
+	}
+}
+
+// Tests that amounts which cannot be represented in the state fail loudly
+// instead of wrapping around.
+func TestToUint256Overflow(t *testing.T) {
+	if have := toUint256(maxUint256); have.ToBig().Cmp(maxUint256) != 0 {
+		t.Fatalf("max amount mangled: have %v, want %v", have, maxUint256)
+	}
+	for _, amount := range []*big.Int{big.NewInt(-1), new(big.Int).Add(maxUint256, big.NewInt(1))} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("amount %v converted silently", amount)
+				}
+			}()
+			toUint256(amount)
+		}()
+	}
+}
+
+// Tests the reward, MEV, stake weight and slashing math with values far beyond
+// those a uint64 or int64 can hold.
+func TestConsensusMathExtremeValues(t *testing.T) {
+	var (
+		proposer = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		other    = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	engine := newTestEngine(t, 32, other)
+	engine.config.ValidatorReward = math.MaxUint64
+	engine.config.ValidatorClasses = []params.EquaValidatorClass{
+		{Name: "standard", MinStake: big.NewInt(1), RewardMultiplier: 1000},
+	}
+	huge := new(big.Int).Lsh(big.NewInt(1), 200)
+	engine.config.InitialValidators = append(engine.config.InitialValidators, params.EquaInitialValidator{Address: proposer, Stake: huge})
+	engine.stakeManager.AddValidator(proposer, huge, nil)
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	header := &types.Header{Number: big.NewInt(1), Coinbase: proposer}
+
+	// Block rewards scaled beyond 64 bits must not wrap
+	engine.applyBlockRewards(header, statedb)
+	if have, want := statedb.GetBalance(proposer).ToBig(), new(big.Int).Mul(maxUint64, big.NewInt(10)); have.Cmp(want) != 0 {
+		t.Fatalf("block reward mismatch: have %v, want %v", have, want)
+	}
+	// MEV burn and proposer share must add up for amounts beyond 64 bits
+	before := statedb.GetBalance(proposer).ToBig()
+	mev := new(big.Int).Lsh(big.NewInt(1), 250)
+	engine.distributeMEV(header, statedb, mev)
+
+	burned := statedb.GetBalance(common.Address{}).ToBig()
+	paid := new(big.Int).Sub(statedb.GetBalance(proposer).ToBig(), before)
+	if sum := new(big.Int).Add(burned, paid); sum.Cmp(mev) != 0 {
+		t.Fatalf("MEV not conserved: burned %v + paid %v != %v", burned, paid, mev)
+	}
+	// Stake weights of validators with huge stakes remain within bounds
+	if have := engine.stakeManager.GetStakeWeight(proposer); have.Cmp(big.NewInt(10000)) > 0 {
+		t.Fatalf("stake weight out of bounds: %v", have)
+	}
+	// Slashing beyond the whole stake must be refused
+	if err := slashTestValidator(engine.stakeManager, proposer, 101); !errors.Is(err, errInvalidSlashPercentage) {
+		t.Fatalf("oversized slash: have %v, want %v", err, errInvalidSlashPercentage)
+	}
+	if err := slashTestValidator(engine.stakeManager, proposer, 100); err != nil {
+		t.Fatalf("failed to slash: %v", err)
+	}
+	if validator, _ := engine.stakeManager.GetValidator(proposer); validator.Stake.Sign() != 0 {
+		t.Fatalf("stake left after full slash: %v", validator.Stake)
+	}
+}
+
+// Tests that PoW difficulty adjustment and solve time estimation saturate
+// instead of overflowing at the edges of the difficulty range.
+func TestDifficultyExtremeValues(t *testing.T) {
+	pow := NewLightPoW(&params.EquaConfig{PoWDifficulty: math.MaxUint64, Epoch: 1})
+	if have := pow.EstimateSolveTime(); have != time.Duration(math.MaxInt64) {
+		t.Errorf("solve time not saturated: have %v", have)
+	}
+	// Blocks far too fast push the difficulty up, which must saturate
+	fast := []*types.Header{{Time: 100}, {Time: 101}, {Time: 102}}
+	pow.AdjustDifficulty(fast, time.Minute)
+	if have := pow.GetDifficulty(); have != math.MaxUint64 {
+		t.Errorf("difficulty wrapped: have %d", have)
+	}
+	// Out of order timestamps must not be mistaken for huge intervals
+	backwards := []*types.Header{{Time: 200}, {Time: 100}}
+	pow.AdjustDifficulty(backwards, time.Minute)
+	if have := pow.GetDifficulty(); have != math.MaxUint64 {
+		t.Errorf("difficulty changed on out of order blocks: have %d", have)
+	}
+	// Slow blocks at the minimum difficulty stay at the minimum
+	pow.SetDifficulty(1000)
+	slow := []*types.Header{{Time: 0}, {Time: math.MaxUint64}}
+	pow.AdjustDifficulty(slow, time.Second)
+	if have := pow.GetDifficulty(); have != 1000 {
+		t.Errorf("difficulty below minimum: have %d", have)
+	}
+}
@@ -5,50 +5,189 @@ package equa
 
 import (
 	"bytes"
+	"errors"
 	"math/big"
+	"sync/atomic"
 
 	"github.com/equa/go-equa/common"
 	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/log"
 	"github.com/equa/go-equa/params"
 )
 
 // MEVDetector detects Maximum Extractable Value (MEV) in blocks
 type MEVDetector struct {
-	config             *params.EquaConfig
-	minProfitThreshold *big.Int
+	config  *params.EquaConfig
+	signer  types.Signer               // Signer of the chain, used to recover transaction senders
+	builtin *MEVRules                  // Rules the MEV burned in the state transition is detected with
+	rules   atomic.Pointer[MEVRules] // Rules of the operator, used for local analysis
 }
 
 // NewMEVDetector creates a new MEV detector
-func NewMEVDetector(config *params.EquaConfig) *MEVDetector {
-	return &MEVDetector{
-		config:             config,
-		minProfitThreshold: big.NewInt(1e17), // 0.1 EQUA minimum profit to be considered MEV
+func NewMEVDetector(config *params.EquaConfig, signer types.Signer) *MEVDetector {
+	md := &MEVDetector{
+		config:  config,
+		signer:  signer,
+		builtin: DefaultMEVRules(),
 	}
+	md.rules.Store(md.builtin)
+	return md
 }
 
-// DetectMEV detects and quantifies MEV in a block
-func (md *MEVDetector) DetectMEV(txs []*types.Transaction, receipts []*types.Receipt) *big.Int {
-	totalMEV := big.NewInt(0)
+// Rules returns the rules MEV is detected with in local analysis.
+func (md *MEVDetector) Rules() *MEVRules {
+	return md.rules.Load()
+}
+
+// SetRules replaces the rules MEV is detected with in local analysis.
+func (md *MEVDetector) SetRules(rules *MEVRules) {
+	md.rules.Store(rules)
+}
+
+// MEV categories reported by the detector
+const (
+	MEVSandwich    = "sandwich"
+	MEVArbitrage   = "arbitrage"
+	MEVLiquidation = "liquidation"
+	MEVFrontrun    = "frontrun"
+)
+
+// MEVFinding is a single instance of MEV extraction detected in a block.
+type MEVFinding struct {
+	Category string       `json:"category"`         // Kind of MEV extracted
+	TxIndex  int          `json:"txIndex"`          // Position of the extracting transaction
+	TxHash   common.Hash  `json:"txHash"`           // Hash of the extracting transaction
+	Victim   *common.Hash `json:"victim,omitempty"` // Transaction extracted from, if identifiable
+	Profit   *big.Int     `json:"profit"`           // Estimated profit in wei
+}
 
+// DetectMEV detects and quantifies MEV in a block. Transactions are priced at
+// their effective gas price for the block's base fee, or at their gas price if
+// the base fee is nil.
+func (md *MEVDetector) DetectMEV(txs []*types.Transaction, receipts []*types.Receipt, baseFee *big.Int) *big.Int {
+	return totalProfit(md.Analyze(txs, receipts, baseFee))
+}
+
+// detectConsensusMEV quantifies the MEV in a block with the built-in rules, for
+// the state transition to be the same on every node.
+func (md *MEVDetector) detectConsensusMEV(txs []*types.Transaction, receipts []*types.Receipt, baseFee *big.Int) *big.Int {
+	return totalProfit(md.analyze(md.builtin, txs, receipts, baseFee))
+}
+
+// detectPendingMEV quantifies the MEV in transactions not executed yet, such as
+// those of builder bids, with the patterns whose profit estimate only depends on
+// the transactions: sandwiches, liquidations and frontrunning. Arbitrage is only
+// told apart by the logs of executed transactions, so it is not detected.
+func (md *MEVDetector) detectPendingMEV(txs []*types.Transaction, baseFee *big.Int) *big.Int {
+	rules := md.Rules()
+	classes, candidates := classifyTransactions(rules, txs, nil)
+	if !candidates {
+		return big.NewInt(0)
+	}
+	// Blank receipts stand in for the outcome the detection layers require
+	pending := make([]*types.Receipt, len(txs))
+	for i := range pending {
+		pending[i] = new(types.Receipt)
+	}
+	var findings []*MEVFinding
+	findings = append(findings, md.detectSandwichAttacks(rules, txs, pending, classes)...)
+	findings = append(findings, md.detectLiquidations(rules, txs, pending, classes)...)
+	findings = append(findings, md.detectFrontrunning(rules, txs, pending, classes, baseFee)...)
+	return totalProfit(findings)
+}
+
+// Analyze detects MEV in a block, returning every instance found.
+func (md *MEVDetector) Analyze(txs []*types.Transaction, receipts []*types.Receipt, baseFee *big.Int) []*MEVFinding {
+	return md.analyze(md.Rules(), txs, receipts, baseFee)
+}
+
+// analyze detects MEV in a block with the given rules.
+func (md *MEVDetector) analyze(rules *MEVRules, txs []*types.Transaction, receipts []*types.Receipt, baseFee *big.Int) []*MEVFinding {
+	// Empty blocks and plain transfers carry no MEV, skip analyzing them
+	classes, candidates := classifyTransactions(rules, txs, receipts)
+	if !candidates {
+		return nil
+	}
 	// Detect different types of MEV
-	sandwichMEV := md.detectSandwichAttacks(txs, receipts)
-	totalMEV.Add(totalMEV, sandwichMEV)
+	var findings []*MEVFinding
+	findings = append(findings, md.detectSandwichAttacks(rules, txs, receipts, classes)...)
+	findings = append(findings, md.detectArbitrage(rules, txs, receipts, classes)...)
+	findings = append(findings, md.detectLiquidations(rules, txs, receipts, classes)...)
+	findings = append(findings, md.detectFrontrunning(rules, txs, receipts, classes, baseFee)...)
+	return findings
+}
+
+// txClass is the classification of a transaction shared by the detection
+// layers, computed once per analyzed block.
+type txClass struct {
+	to          common.Address // Contract called
+	selector    []byte         // Function selector called, nil if not a contract call
+	swap        bool           // Token swap on a recognized router
+	liquidation bool           // Call of a liquidation function
+	logs        bool           // Receipt available and carrying logs
+}
+
+// classifyTransactions classifies the transactions of a block for the detection
+// layers. Every layer looks for contract calls or the logs they emit, so it
+// reports false without classifying if there are none.
+func classifyTransactions(rules *MEVRules, txs []*types.Transaction, receipts []*types.Receipt) ([]txClass, bool) {
+	candidates := false
+	for i, tx := range txs {
+		if len(tx.Data()) >= 4 || (i < len(receipts) && len(receipts[i].Logs) > 0) {
+			candidates = true
+			break
+		}
+	}
+	if !candidates {
+		return nil, false
+	}
+	classes := make([]txClass, len(txs))
+	for i, tx := range txs {
+		class := &classes[i]
+		class.logs = i < len(receipts) && len(receipts[i].Logs) > 0
 
-	arbitrageMEV := md.detectArbitrage(txs, receipts)
-	totalMEV.Add(totalMEV, arbitrageMEV)
+		if to := tx.To(); to != nil && len(tx.Data()) >= 4 {
+			class.to, class.selector = *to, tx.Data()[:4]
+			class.swap = containsSelector(rules.SwapSelectors, class.selector) && rules.isRouter(class.to)
+			class.liquidation = containsSelector(rules.LiquidationSelectors, class.selector)
+		}
+	}
+	return classes, true
+}
 
-	liquidationMEV := md.detectLiquidations(txs, receipts)
-	totalMEV.Add(totalMEV, liquidationMEV)
+// sameCall checks if two classified transactions call the same function of the
+// same contract.
+func sameCall(a, b *txClass) bool {
+	return a.selector != nil && a.to == b.to && bytes.Equal(a.selector, b.selector)
+}
 
-	frontrunMEV := md.detectFrontrunning(txs, receipts)
-	totalMEV.Add(totalMEV, frontrunMEV)
+// totalProfit sums the profits of MEV findings.
+func totalProfit(findings []*MEVFinding) *big.Int {
+	total := big.NewInt(0)
+	for _, finding := range findings {
+		total.Add(total, finding.Profit)
+	}
+	return total
+}
 
-	return totalMEV
+// newMEVFinding creates a finding for the transaction at the given index.
+func newMEVFinding(category string, txs []*types.Transaction, index int, victim *types.Transaction, profit *big.Int) *MEVFinding {
+	finding := &MEVFinding{
+		Category: category,
+		TxIndex:  index,
+		TxHash:   txs[index].Hash(),
+		Profit:   profit,
+	}
+	if victim != nil {
+		hash := victim.Hash()
+		finding.Victim = &hash
+	}
+	return finding
 }
 
 // detectSandwichAttacks detects sandwich attacks in transactions
-func (md *MEVDetector) detectSandwichAttacks(txs []*types.Transaction, receipts []*types.Receipt) *big.Int {
-	totalMEV := big.NewInt(0)
+func (md *MEVDetector) detectSandwichAttacks(rules *MEVRules, txs []*types.Transaction, receipts []*types.Receipt, classes []txClass) []*MEVFinding {
+	var findings []*MEVFinding
 
 	// Look for sandwich pattern: Bot TX → Victim TX → Bot TX
 	for i := 1; i < len(txs)-1; i++ {
@@ -57,196 +196,116 @@ func (md *MEVDetector) detectSandwichAttacks(txs []*types.Transaction, receipts
 		nextTx := txs[i+1]
 
 		// Check if same address before and after (sandwich pattern)
-		if prevTx.To() != nil && nextTx.To() != nil &&
-		   *prevTx.To() == *nextTx.To() && // same contract
-		   bytes.Equal(prevTx.Data()[:4], nextTx.Data()[:4]) && // same function
-		   prevTx.From() == nextTx.From() && // same bot
-		   prevTx.From() != currTx.From() { // different from victim
-
-			// Check if these are swap transactions (DEX interactions)
-			if md.isSwapTransaction(prevTx) && md.isSwapTransaction(currTx) && md.isSwapTransaction(nextTx) {
-				// Calculate profit from sandwich
-				profit := md.calculateSandwichProfit(prevTx, nextTx, receipts[i-1], receipts[i+1])
-				if profit.Cmp(md.minProfitThreshold) > 0 {
-					totalMEV.Add(totalMEV, profit)
-				}
+		if i+1 >= len(receipts) {
+			break
+		}
+		// Only recover the senders of swaps wrapped by two calls of the same function
+		if !classes[i-1].swap || !classes[i].swap || !classes[i+1].swap || !sameCall(&classes[i-1], &classes[i+1]) {
+			continue
+		}
+		if md.isSandwich(rules, prevTx, currTx, nextTx) {
+			// Calculate profit from sandwich
+			profit := md.calculateSandwichProfit(prevTx, nextTx, receipts[i-1], receipts[i+1])
+			if profit.Cmp(rules.minProfit()) > 0 {
+				findings = append(findings, newMEVFinding(MEVSandwich, txs, i-1, currTx, profit))
 			}
 		}
 	}
 
-	return totalMEV
+	return findings
+}
+
+// isSandwich checks if a swap is wrapped by two swaps of another sender calling
+// the same function of the same contract.
+func (md *MEVDetector) isSandwich(rules *MEVRules, prevTx, currTx, nextTx *types.Transaction) bool {
+	if prevTx.To() == nil || nextTx.To() == nil ||
+	   len(prevTx.Data()) < 4 || len(nextTx.Data()) < 4 ||
+	   *prevTx.To() != *nextTx.To() || // same contract
+	   !bytes.Equal(prevTx.Data()[:4], nextTx.Data()[:4]) { // same function
+		return false
+	}
+	// Transactions whose sender cannot be recovered cannot be attributed
+	prevFrom, err1 := txSender(md.signer, prevTx)
+	currFrom, err2 := txSender(md.signer, currTx)
+	nextFrom, err3 := txSender(md.signer, nextTx)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		log.Trace("Skipping sandwich check", "victim", currTx.Hash(), "err", err)
+		return false
+	}
+	if prevFrom != nextFrom || // same bot
+	   prevFrom == currFrom { // different from victim
+		return false
+	}
+	// Check if these are swap transactions (DEX interactions)
+	return rules.isSwap(prevTx) && rules.isSwap(currTx) && rules.isSwap(nextTx)
 }
 
 // detectArbitrage detects arbitrage opportunities
-func (md *MEVDetector) detectArbitrage(txs []*types.Transaction, receipts []*types.Receipt) *big.Int {
-	totalMEV := big.NewInt(0)
+func (md *MEVDetector) detectArbitrage(rules *MEVRules, txs []*types.Transaction, receipts []*types.Receipt, classes []txClass) []*MEVFinding {
+	var findings []*MEVFinding
 
-	for i, tx := range txs {
-		if i >= len(receipts) {
+	for i := range txs {
+		if !classes[i].logs {
 			continue
 		}
 
 		receipt := receipts[i]
 
 		// Look for transactions that interact with multiple DEXs
-		if md.isArbitrageTransaction(tx, receipt) {
+		if rules.isArbitrage(receipt) {
 			profit := md.calculateArbitrageProfit(receipt)
-			if profit.Cmp(md.minProfitThreshold) > 0 {
-				totalMEV.Add(totalMEV, profit)
+			if profit.Cmp(rules.minProfit()) > 0 {
+				findings = append(findings, newMEVFinding(MEVArbitrage, txs, i, nil, profit))
 			}
 		}
 	}
 
-	return totalMEV
+	return findings
 }
 
 // detectLiquidations detects liquidation MEV
-func (md *MEVDetector) detectLiquidations(txs []*types.Transaction, receipts []*types.Receipt) *big.Int {
-	totalMEV := big.NewInt(0)
+func (md *MEVDetector) detectLiquidations(rules *MEVRules, txs []*types.Transaction, receipts []*types.Receipt, classes []txClass) []*MEVFinding {
+	var findings []*MEVFinding
 
-	for i, tx := range txs {
+	for i := range txs {
 		if i >= len(receipts) {
 			continue
 		}
 
-		if md.isLiquidationTransaction(tx) {
+		if classes[i].liquidation {
 			profit := md.calculateLiquidationProfit(receipts[i])
-			if profit.Cmp(md.minProfitThreshold) > 0 {
-				totalMEV.Add(totalMEV, profit)
+			if profit.Cmp(rules.minProfit()) > 0 {
+				findings = append(findings, newMEVFinding(MEVLiquidation, txs, i, nil, profit))
 			}
 		}
 	}
 
-	return totalMEV
+	return findings
 }
 
 // detectFrontrunning detects frontrunning attacks
-func (md *MEVDetector) detectFrontrunning(txs []*types.Transaction, receipts []*types.Receipt) *big.Int {
-	totalMEV := big.NewInt(0)
+func (md *MEVDetector) detectFrontrunning(rules *MEVRules, txs []*types.Transaction, receipts []*types.Receipt, classes []txClass, baseFee *big.Int) []*MEVFinding {
+	var findings []*MEVFinding
 
 	// Look for transactions with much higher gas prices that execute same function before another tx
 	for i := 0; i < len(txs)-1; i++ {
 		tx1 := txs[i]
 		tx2 := txs[i+1]
 
+		if i >= len(receipts) {
+			break
+		}
+
 		// Check if tx1 frontran tx2
-		if md.isFrontrunning(tx1, tx2) {
+		if sameCall(&classes[i], &classes[i+1]) && rules.isFrontrun(tx1, tx2, baseFee) {
 			profit := md.calculateFrontrunProfit(receipts[i])
-			if profit.Cmp(md.minProfitThreshold) > 0 {
-				totalMEV.Add(totalMEV, profit)
+			if profit.Cmp(rules.minProfit()) > 0 {
+				findings = append(findings, newMEVFinding(MEVFrontrun, txs, i, tx2, profit))
 			}
 		}
 	}
 
-	return totalMEV
-}
-
-// isSwapTransaction checks if a transaction is a token swap
-func (md *MEVDetector) isSwapTransaction(tx *types.Transaction) bool {
-	if tx.To() == nil || len(tx.Data()) < 4 {
-		return false
-	}
-
-	// Common DEX function selectors
-	swapSelectors := [][]byte{
-		{0x38, 0xed, 0x17, 0x39}, // swapExactTokensForTokens (Uniswap V2)
-		{0x8e, 0x3c, 0x5e, 0x16}, // swapExactTokensForETH (Uniswap V2)
-		{0x7f, 0xf3, 0x6a, 0xb5}, // swapExactETHForTokens (Uniswap V2)
-		{0x41, 0x4b, 0xf3, 0x89}, // exactInputSingle (Uniswap V3)
-		{0xc0, 0x4b, 0x8d, 0x59}, // exactInput (Uniswap V3)
-	}
-
-	selector := tx.Data()[:4]
-	for _, swapSelector := range swapSelectors {
-		if bytes.Equal(selector, swapSelector) {
-			return true
-		}
-	}
-
-	return false
-}
-
-// isArbitrageTransaction checks if transaction performs arbitrage
-func (md *MEVDetector) isArbitrageTransaction(tx *types.Transaction, receipt *types.Receipt) bool {
-	// Arbitrage typically involves multiple swaps in same transaction
-	swapEventCount := 0
-
-	// Count swap events in logs
-	for _, log := range receipt.Logs {
-		if md.isSwapEvent(log) {
-			swapEventCount++
-		}
-	}
-
-	// Arbitrage usually has 2+ swaps
-	return swapEventCount >= 2
-}
-
-// isLiquidationTransaction checks if transaction is a liquidation
-func (md *MEVDetector) isLiquidationTransaction(tx *types.Transaction) bool {
-	if tx.To() == nil || len(tx.Data()) < 4 {
-		return false
-	}
-
-	// Common liquidation function selectors
-	liquidationSelectors := [][]byte{
-		{0x24, 0x96, 0x96, 0xf8}, // liquidateBorrow (Compound)
-		{0x5c, 0x19, 0xa9, 0x5c}, // liquidationCall (Aave)
-	}
-
-	selector := tx.Data()[:4]
-	for _, liqSelector := range liquidationSelectors {
-		if bytes.Equal(selector, liqSelector) {
-			return true
-		}
-	}
-
-	return false
-}
-
-// isFrontrunning checks if tx1 frontran tx2
-func (md *MEVDetector) isFrontrunning(tx1, tx2 *types.Transaction) bool {
-	// Basic frontrunning detection:
-	// 1. Same target contract
-	// 2. Same function
-	// 3. Much higher gas price
-	// 4. Similar transaction value/parameters
-
-	if tx1.To() == nil || tx2.To() == nil {
-		return false
-	}
-
-	if *tx1.To() != *tx2.To() {
-		return false
-	}
-
-	if len(tx1.Data()) < 4 || len(tx2.Data()) < 4 {
-		return false
-	}
-
-	// Same function selector
-	if !bytes.Equal(tx1.Data()[:4], tx2.Data()[:4]) {
-		return false
-	}
-
-	// tx1 has significantly higher gas price (potential frontrun)
-	gasPriceDiff := new(big.Int).Sub(tx1.GasPrice(), tx2.GasPrice())
-	threshold := new(big.Int).Mul(tx2.GasPrice(), big.NewInt(20)) // 20x higher
-	threshold.Div(threshold, big.NewInt(100))
-
-	return gasPriceDiff.Cmp(threshold) > 0
-}
-
-// isSwapEvent checks if a log represents a swap event
-func (md *MEVDetector) isSwapEvent(log *types.Log) bool {
-	// Uniswap V2 Swap event topic
-	swapTopic := common.HexToHash("0xd78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822")
-
-	if len(log.Topics) > 0 && log.Topics[0] == swapTopic {
-		return true
-	}
-
-	return false
+	return findings
 }
 
 // Helper functions to calculate profits (simplified implementations)
@@ -255,7 +314,7 @@ func (md *MEVDetector) calculateSandwichProfit(frontrun, backrun *types.Transact
 	// Simplified: estimate profit based on gas used and transaction values
 	// In reality, this would analyze token transfers and price impacts
 
-	if frontrun.Value().Cmp(backrun.Value()) <= 0 {
+	if backrun.Value().Cmp(frontrun.Value()) <= 0 {
 		return big.NewInt(0)
 	}
 
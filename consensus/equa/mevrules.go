@@ -0,0 +1,171 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/common/math"
+	"github.com/equa/go-equa/core/types"
+	"github.com/naoina/toml"
+)
+
+var errNoMEVRulesFile = errors.New("no MEV rules file configured")
+
+// MEVRules are the protocol specifics the MEV detector recognizes extraction by.
+// Operators can load their own to follow new protocols, they are only applied to
+// the local analysis of blocks: the MEV burned in the state transition is always
+// detected with the built-in rules, which every node shares.
+type MEVRules struct {
+	Routers              []common.Address      `json:"routers"`              // Contracts swaps are recognized on, any contract if empty
+	SwapSelectors        []hexutil.Bytes       `json:"swapSelectors"`        // Function selectors of swaps
+	LiquidationSelectors []hexutil.Bytes       `json:"liquidationSelectors"` // Function selectors of liquidations
+	SwapEvents           []common.Hash         `json:"swapEvents"`           // Event signatures of swaps, two or more in a transaction being arbitrage
+	MinProfit            *math.HexOrDecimal256 `json:"minProfit"`            // Profit in wei above which extraction is MEV
+	FrontrunPremium      uint64                `json:"frontrunPremium"`      // Gas price premium in percent over the next transaction of a frontrun
+}
+
+// DefaultMEVRules returns the built-in MEV detection rules, covering Uniswap,
+// Compound and Aave.
+func DefaultMEVRules() *MEVRules {
+	return &MEVRules{
+		SwapSelectors: []hexutil.Bytes{
+			{0x38, 0xed, 0x17, 0x39}, // swapExactTokensForTokens (Uniswap V2)
+			{0x8e, 0x3c, 0x5e, 0x16}, // swapExactTokensForETH (Uniswap V2)
+			{0x7f, 0xf3, 0x6a, 0xb5}, // swapExactETHForTokens (Uniswap V2)
+			{0x41, 0x4b, 0xf3, 0x89}, // exactInputSingle (Uniswap V3)
+			{0xc0, 0x4b, 0x8d, 0x59}, // exactInput (Uniswap V3)
+		},
+		LiquidationSelectors: []hexutil.Bytes{
+			{0x24, 0x96, 0x96, 0xf8}, // liquidateBorrow (Compound)
+			{0x5c, 0x19, 0xa9, 0x5c}, // liquidationCall (Aave)
+		},
+		SwapEvents: []common.Hash{
+			common.HexToHash("0xd78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822"), // Swap (Uniswap V2)
+		},
+		MinProfit:       (*math.HexOrDecimal256)(big.NewInt(1e17)), // 0.1 EQUA
+		FrontrunPremium: 20,
+	}
+}
+
+// LoadMEVRules reads MEV detection rules from a JSON or TOML file, chosen by its
+// extension. Rules missing from the file keep their built-in values.
+func LoadMEVRules(file string) (*MEVRules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rules := DefaultMEVRules()
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(rules)
+	case ".toml":
+		err = toml.Unmarshal(data, rules)
+	default:
+		return nil, fmt.Errorf("unsupported MEV rules format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid MEV rules %s: %v", file, err)
+	}
+	if err := rules.validate(); err != nil {
+		return nil, fmt.Errorf("invalid MEV rules %s: %v", file, err)
+	}
+	return rules, nil
+}
+
+// validate checks that the rules are well formed.
+func (r *MEVRules) validate() error {
+	for _, sel := range slices.Concat(r.SwapSelectors, r.LiquidationSelectors) {
+		if len(sel) != 4 {
+			return fmt.Errorf("function selector %s is not 4 bytes", sel)
+		}
+	}
+	if r.MinProfit == nil || (*big.Int)(r.MinProfit).Sign() < 0 {
+		return errors.New("minimum profit must be set and not negative")
+	}
+	return nil
+}
+
+// minProfit returns the profit above which extraction is MEV.
+func (r *MEVRules) minProfit() *big.Int {
+	return (*big.Int)(r.MinProfit)
+}
+
+// isRouter checks if swaps are recognized on a contract.
+func (r *MEVRules) isRouter(addr common.Address) bool {
+	return len(r.Routers) == 0 || slices.Contains(r.Routers, addr)
+}
+
+// hasSelector checks if a transaction calls a function with one of the given
+// selectors.
+func hasSelector(tx *types.Transaction, selectors []hexutil.Bytes) bool {
+	if tx.To() == nil || len(tx.Data()) < 4 {
+		return false
+	}
+	return containsSelector(selectors, tx.Data()[:4])
+}
+
+// containsSelector checks if a function selector is one of the given ones.
+func containsSelector(selectors []hexutil.Bytes, selector []byte) bool {
+	return slices.ContainsFunc(selectors, func(sel hexutil.Bytes) bool { return bytes.Equal(sel, selector) })
+}
+
+// isSwap checks if a transaction is a token swap.
+func (r *MEVRules) isSwap(tx *types.Transaction) bool {
+	return hasSelector(tx, r.SwapSelectors) && r.isRouter(*tx.To())
+}
+
+// isArbitrage checks if a transaction performed arbitrage, which usually takes
+// two or more swaps.
+func (r *MEVRules) isArbitrage(receipt *types.Receipt) bool {
+	swaps := 0
+	for _, log := range receipt.Logs {
+		if len(log.Topics) > 0 && slices.Contains(r.SwapEvents, log.Topics[0]) {
+			swaps++
+		}
+	}
+	return swaps >= 2
+}
+
+// isFrontrun checks if tx1 frontran tx2: it calls the same function of the same
+// contract at an effective gas price well above that of tx2.
+func (r *MEVRules) isFrontrun(tx1, tx2 *types.Transaction, baseFee *big.Int) bool {
+	if tx1.To() == nil || tx2.To() == nil || *tx1.To() != *tx2.To() {
+		return false
+	}
+	if len(tx1.Data()) < 4 || len(tx2.Data()) < 4 || !bytes.Equal(tx1.Data()[:4], tx2.Data()[:4]) {
+		return false
+	}
+	price1, price2 := effectiveGasPrice(tx1, baseFee), effectiveGasPrice(tx2, baseFee)
+	premium := new(big.Int).Sub(price1, price2)
+	threshold := new(big.Int).Mul(price2, new(big.Int).SetUint64(r.FrontrunPremium))
+	threshold.Div(threshold, big.NewInt(100))
+
+	return premium.Cmp(threshold) > 0
+}
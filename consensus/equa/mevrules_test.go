@@ -0,0 +1,210 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/math"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+	"golang.org/x/time/rate"
+)
+
+// Tests that MEV rules files override the built-in rules they set, in both
+// supported formats, and that malformed rules are rejected.
+func TestLoadMEVRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	router := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	for _, file := range []string{
+		write("rules.json", `{"routers": ["0x00000000000000000000000000000000000000aa"], "liquidationSelectors": ["0x01020304"], "minProfit": "0x10"}`),
+		write("rules.toml", "Routers = [\"0x00000000000000000000000000000000000000aa\"]\nLiquidationSelectors = [\"0x01020304\"]\nMinProfit = \"16\"\n"),
+	} {
+		rules, err := LoadMEVRules(file)
+		if err != nil {
+			t.Fatalf("%s: failed to load rules: %v", file, err)
+		}
+		if len(rules.Routers) != 1 || rules.Routers[0] != router {
+			t.Errorf("%s: routers mismatch: have %v", file, rules.Routers)
+		}
+		if len(rules.LiquidationSelectors) != 1 || rules.LiquidationSelectors[0].String() != "0x01020304" {
+			t.Errorf("%s: liquidation selectors mismatch: have %v", file, rules.LiquidationSelectors)
+		}
+		if rules.minProfit().Int64() != 16 {
+			t.Errorf("%s: minimum profit mismatch: have %v, want 16", file, rules.minProfit())
+		}
+		// Rules missing from the file keep their built-in values
+		if defaults := DefaultMEVRules(); len(rules.SwapSelectors) != len(defaults.SwapSelectors) || rules.FrontrunPremium != defaults.FrontrunPremium {
+			t.Errorf("%s: built-in rules not kept: have %+v", file, rules)
+		}
+	}
+	for name, content := range map[string]string{
+		"selector.json": `{"swapSelectors": ["0x0102"]}`,
+		"unknown.json":  `{"swapSelector": ["0x01020304"]}`,
+		"negative.json": `{"minProfit": "-1"}`,
+		"unknown.toml":  "SwapSelector = [\"0x01020304\"]\n",
+		"rules.yaml":    "",
+	} {
+		if _, err := LoadMEVRules(write(name, content)); err == nil {
+			t.Errorf("%s: invalid rules accepted", name)
+		}
+	}
+}
+
+// Tests that reloaded MEV rules apply to local analysis only, the MEV burned in
+// the state transition being detected with the built-in rules.
+func TestReloadMEVRules(t *testing.T) {
+	var (
+		engine   = newTestEngine(t, 32)
+		api      = &API{equa: engine}
+		admin    = &AdminAPI{equa: engine, limiter: rate.NewLimiter(rate.Inf, 0)}
+		key, _   = crypto.GenerateKey()
+		signer   = types.LatestSignerForChainID(big.NewInt(1))
+		file     = filepath.Join(t.TempDir(), "rules.json")
+		tx       = types.MustSignNewTx(key, signer, &types.LegacyTx{To: &common.Address{0x02}, Gas: 50000, GasPrice: big.NewInt(1e9), Data: []byte{0x01, 0x02, 0x03, 0x04}})
+		txs      = []*types.Transaction{tx}
+		receipts = []*types.Receipt{{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash()}}
+	)
+	if _, err := admin.ReloadMEVRules(); !errors.Is(err, errNoMEVRulesFile) {
+		t.Fatalf("reload without file: error mismatch: have %v, want %v", err, errNoMEVRulesFile)
+	}
+	if mev := engine.mevDetector.DetectMEV(txs, receipts, nil); mev.Sign() != 0 {
+		t.Fatalf("MEV detected with built-in rules: %v", mev)
+	}
+	if err := os.WriteFile(file, []byte(`{"liquidationSelectors": ["0x01020304"], "minProfit": "0"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.UseMEVRules(file); err != nil {
+		t.Fatalf("failed to use rules: %v", err)
+	}
+	if mev := engine.mevDetector.DetectMEV(txs, receipts, nil); mev.Sign() == 0 {
+		t.Errorf("liquidation not detected with loaded rules")
+	}
+	if mev := engine.mevDetector.detectConsensusMEV(txs, receipts, nil); mev.Sign() != 0 {
+		t.Errorf("loaded rules applied to the state transition: %v", mev)
+	}
+	// Invalid files leave the current rules in place
+	if err := os.WriteFile(file, []byte(`{"liquidationSelectors": ["0x01"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.ReloadMEVRules(); err == nil {
+		t.Fatalf("invalid rules reloaded")
+	}
+	if rules := api.GetMEVRules(); len(rules.LiquidationSelectors) != 1 || rules.LiquidationSelectors[0].String() != "0x01020304" {
+		t.Errorf("rules replaced by invalid file: have %+v", rules)
+	}
+	if err := os.WriteFile(file, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.ReloadMEVRules(); err != nil {
+		t.Fatalf("failed to reload rules: %v", err)
+	}
+	if mev := engine.mevDetector.DetectMEV(txs, receipts, nil); mev.Sign() != 0 {
+		t.Errorf("MEV detected after reloading built-in rules: %v", mev)
+	}
+}
+
+// Tests that blocks of plain transfers are not analyzed any further, while
+// transfers emitting swap events, e.g. to a contract's fallback, still are.
+func TestAnalyzeTransfers(t *testing.T) {
+	var (
+		detector = NewMEVDetector(&params.EquaConfig{}, types.LatestSignerForChainID(big.NewInt(1)))
+		rules    = DefaultMEVRules()
+		txs, rs  = newBenchTransactions(4)
+	)
+	rules.MinProfit = (*math.HexOrDecimal256)(new(big.Int))
+
+	if _, candidates := classifyTransactions(rules, txs, rs); candidates {
+		t.Fatalf("plain transfers classified as MEV candidates")
+	}
+	if findings := detector.analyze(rules, txs, rs, nil); len(findings) != 0 {
+		t.Fatalf("MEV found in plain transfers: %v", findings)
+	}
+	swap := &types.Log{Topics: []common.Hash{rules.SwapEvents[0]}}
+	rs[2].Logs = []*types.Log{swap, swap}
+
+	findings := detector.analyze(rules, txs, rs, nil)
+	if len(findings) != 1 || findings[0].Category != MEVArbitrage || findings[0].TxIndex != 2 {
+		t.Fatalf("arbitrage by transfer not found: %v", findings)
+	}
+}
+
+// Tests that dynamic fee transactions are priced at what they pay rather than
+// their fee cap, and that the state transition only does so if enabled.
+func TestEffectiveGasPrice(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		signer  = types.LatestSigner(params.MergedTestChainConfig)
+		to      = common.Address{0xaa}
+		data    = []byte{0x01, 0x02, 0x03, 0x04}
+		baseFee = big.NewInt(10)
+	)
+	// A generous fee cap with a tip matching the legacy gas price behind it
+	dynamic := types.MustSignNewTx(key, signer, &types.DynamicFeeTx{ChainID: params.MergedTestChainConfig.ChainID, Nonce: 0, To: &to, Gas: 50000,
+		GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(1), Data: data})
+	legacy := types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 1, To: &to, Gas: 50000, GasPrice: big.NewInt(11), Data: data})
+
+	if price := effectiveGasPrice(dynamic, baseFee); price.Int64() != 11 {
+		t.Errorf("dynamic fee price mismatch: have %v, want 11", price)
+	}
+	if price := effectiveGasPrice(dynamic, big.NewInt(200)); price.Int64() != 100 {
+		t.Errorf("capped price mismatch: have %v, want 100", price)
+	}
+	if price := effectiveGasPrice(dynamic, nil); price.Int64() != 100 {
+		t.Errorf("price without base fee mismatch: have %v, want 100", price)
+	}
+	rules := DefaultMEVRules()
+	if !rules.isFrontrun(dynamic, legacy, nil) {
+		t.Errorf("fee cap not taken as gas price without base fee")
+	}
+	if rules.isFrontrun(dynamic, legacy, baseFee) {
+		t.Errorf("equal effective gas prices flagged as frontrun")
+	}
+	var (
+		slasher = NewSlasher(rawdb.NewMemoryDatabase(), &params.EquaConfig{}, signer)
+		cheap   = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 2, To: &to, Gas: 21000, GasPrice: big.NewInt(9)})
+	)
+	if !slasher.DetectCensorship([]*types.Transaction{dynamic, cheap}, nil) {
+		t.Errorf("fee cap gap not flagged without base fee")
+	}
+	if slasher.DetectCensorship([]*types.Transaction{dynamic, cheap}, baseFee) {
+		t.Errorf("close effective gas prices flagged as censorship")
+	}
+	engine := newTestEngine(t, 1)
+	header := &types.Header{BaseFee: baseFee}
+	if fee := engine.consensusBaseFee(header); fee != nil {
+		t.Errorf("base fee used with effective gas prices disabled: %v", fee)
+	}
+	engine.config.Features = map[string]bool{FeatureEffectiveGasPrice: true}
+	if fee := engine.consensusBaseFee(header); fee != baseFee {
+		t.Errorf("base fee mismatch: have %v, want %v", fee, baseFee)
+	}
+}
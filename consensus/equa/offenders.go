@@ -0,0 +1,127 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/lru"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
+)
+
+const (
+	invalidHeaderMemory = 1024 // Number of rejected headers remembered
+	repeatOffense       = 3    // Attributable invalid proposals making a repeat offender
+
+	// violationInvalidBlock is the slashing violation for repeatedly proposing
+	// signed blocks that fail verification.
+	violationInvalidBlock = "Invalid block"
+)
+
+var (
+	invalidHeaderMeter = metrics.NewRegisteredMeter("equa/invalid/headers", nil)
+	invalidCachedMeter = metrics.NewRegisteredMeter("equa/invalid/cached", nil)
+)
+
+// invalidBlocks tracks rejected headers, so that repeated submissions of the
+// same invalid header are refused without verifying them again and proposers
+// repeatedly signing invalid blocks can be penalized.
+type invalidBlocks struct {
+	known    *lru.Cache[common.Hash, error] // Verification errors of recently rejected headers
+	offenses map[common.Address]int         // Attributable invalid proposals per proposer
+	lock     sync.Mutex
+}
+
+func newInvalidBlocks() *invalidBlocks {
+	return &invalidBlocks{
+		known:    lru.NewCache[common.Hash, error](invalidHeaderMemory),
+		offenses: make(map[common.Address]int),
+	}
+}
+
+// lookup returns the error a header was rejected with earlier, if any.
+func (ib *invalidBlocks) lookup(hash common.Hash) (error, bool) {
+	err, ok := ib.known.Get(hash)
+	if ok {
+		invalidCachedMeter.Mark(1)
+	}
+	return err, ok
+}
+
+// repeatOffender reports whether a proposer has signed enough invalid blocks
+// to have its proposals pre-checked cheaply.
+func (ib *invalidBlocks) repeatOffender(proposer common.Address) bool {
+	ib.lock.Lock()
+	defer ib.lock.Unlock()
+
+	return ib.offenses[proposer] >= repeatOffense
+}
+
+// add remembers a rejected header. If the rejection is attributable to the
+// proposer, the offense is counted and the new count returned.
+func (ib *invalidBlocks) add(header *types.Header, err error, attributable bool) int {
+	invalidHeaderMeter.Mark(1)
+	ib.known.Add(header.Hash(), err)
+	if !attributable {
+		return 0
+	}
+	ib.lock.Lock()
+	defer ib.lock.Unlock()
+
+	ib.offenses[header.Coinbase]++
+	return ib.offenses[header.Coinbase]
+}
+
+// deterministicFailure reports whether a header verification error depends on
+// the header and its parent only, and will thus never go away.
+func deterministicFailure(err error) bool {
+	return errors.Is(err, errInvalidPoW) || errors.Is(err, errMissingStatement) ||
+		errors.Is(err, errInvalidStatement) || errors.Is(err, errUnknownPolicy) ||
+		errors.Is(err, errInvalidStatementSig)
+}
+
+// recordInvalid tracks a header that failed verification. The header counts
+// against its proposer only if the proposer signed it, as an unsigned coinbase
+// can be forged by anyone. Repeat offenders are reported to the slasher.
+func (e *Equa) recordInvalid(chain consensus.ChainHeaderReader, header *types.Header, err error) {
+	if !deterministicFailure(err) {
+		return
+	}
+	attributable := false
+	if errors.Is(err, errInvalidPoW) && e.config.FeatureEnabled(FeatureComplianceStatements) {
+		_, serr := decodeStatement(header)
+		attributable = serr == nil
+	}
+	offenses := e.invalid.add(header, err, attributable)
+	if offenses < repeatOffense {
+		return
+	}
+	head := chain.CurrentHeader().Number.Uint64()
+	ev := &Evidence{
+		Validator: header.Coinbase,
+		Block:     min(header.Number.Uint64(), head),
+		Violation: violationInvalidBlock,
+	}
+	if err := e.submitEvidence(ev, head); err == nil {
+		log.Warn("Repeated invalid proposals", "proposer", header.Coinbase, "offenses", offenses, "number", header.Number)
+	}
+}
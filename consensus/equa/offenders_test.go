@@ -0,0 +1,78 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that rejected headers are refused from the cache, and that only invalid
+// headers signed by their proposer count against it, turning it into a repeat
+// offender reported to the slasher.
+func TestInvalidBlockOffenses(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		proposer = crypto.PubkeyToAddress(key.PublicKey)
+		victim   = common.Address{0x01}
+		engine   = newTestEngine(t, 32, proposer, victim)
+		genesis  = &types.Header{Number: common.Big0}
+		chain    = &testHeaderChain{config: newTestChainConfig(engine.config), headers: []*types.Header{genesis}}
+	)
+	engine.config.Features = map[string]bool{FeatureComplianceStatements: true}
+	engine.Authorize(proposer, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	// Headers carrying a forged coinbase are rejected but not attributed
+	for i := 0; i < repeatOffense; i++ {
+		forged := &types.Header{ParentHash: genesis.Hash(), Number: common.Big1, Time: uint64(i + 1), Coinbase: victim}
+		if err := engine.VerifyHeader(chain, forged); !errors.Is(err, errInvalidPoW) {
+			t.Fatalf("forged header %d: error mismatch: have %v, want %v", i, err, errInvalidPoW)
+		}
+	}
+	if engine.invalid.repeatOffender(victim) || len(engine.slasher.Evidence(victim)) > 0 {
+		t.Fatalf("forged headers attributed to coinbase")
+	}
+	// Signed invalid headers count against their proposer
+	for i := 0; i < repeatOffense; i++ {
+		header := &types.Header{ParentHash: genesis.Hash(), Number: common.Big1, Time: uint64(i + 1), Coinbase: proposer}
+		if err := engine.signStatement(header, nil, nil); err != nil {
+			t.Fatalf("failed to sign statement: %v", err)
+		}
+		for j := 0; j < 2; j++ {
+			if err := engine.VerifyHeader(chain, header); !errors.Is(err, errInvalidPoW) {
+				t.Fatalf("signed header %d: error mismatch: have %v, want %v", i, err, errInvalidPoW)
+			}
+		}
+	}
+	if !engine.invalid.repeatOffender(proposer) {
+		t.Errorf("proposer not a repeat offender")
+	}
+	evidence := engine.slasher.Evidence(proposer)
+	if len(evidence) != 1 || evidence[0].Violation != violationInvalidBlock {
+		t.Fatalf("evidence mismatch: have %v", evidence)
+	}
+	if amount := engine.slasher.CalculateSlashingAmount(violationInvalidBlock, big.NewInt(100)); amount.Int64() != 5 {
+		t.Errorf("slashing amount mismatch: have %v, want 5", amount)
+	}
+}
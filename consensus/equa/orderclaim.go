@@ -0,0 +1,313 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/ethdb"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
+	"github.com/equa/go-equa/rlp"
+)
+
+// Proposers claim the ordering metadata of their block in its compliance
+// statement: a commitment to the arrival times they ordered the transactions
+// by, the ordering score those yield and the MEV detected in the block. The MEV
+// only depends on the block and its receipts and is checked by every node when
+// processing the block. Arrival times differ
+// between nodes, so the score cannot be; instead the proposer publishes the
+// arrival times it committed to, from which anyone can recompute the claimed
+// score. Disputes over the ordering of a block are then settled by the signed
+// claim rather than by the scores nodes happen to compute locally.
+
+const (
+	maxOrderingScore = 10000 // Ordering score of a block in arrival order, in basis points
+
+	// orderingScoreDrift is the difference, in basis points, between a claimed
+	// ordering score and the one computed from local arrival times above which
+	// the claim is reported as disputed.
+	orderingScoreDrift = 1000
+)
+
+var (
+	errMissingOrderingClaim    = errors.New("missing ordering claim")
+	errInvalidOrderingClaim    = errors.New("malformed ordering claim")
+	errInvalidOrderingClaimSig = errors.New("ordering claim not signed by proposer")
+	errOrderingClaimMEV        = errors.New("ordering claim MEV mismatch")
+	errArrivalsMismatch        = errors.New("arrival times do not match claim")
+	errUnassembledBlock        = errors.New("block not assembled locally")
+)
+
+// orderingDisputeMeter counts the imported blocks whose claimed ordering score
+// is far from the one computed from local arrival times.
+var orderingDisputeMeter = metrics.NewRegisteredMeter("equa/ordering/disputed", nil)
+
+// TxArrival is the arrival time of a transaction as claimed by a proposer.
+type TxArrival struct {
+	Hash common.Hash `json:"hash"`
+	Seen uint64      `json:"seen"` // Unix time in milliseconds, zero if unknown to the proposer
+}
+
+// OrderingClaim is a proposer's signed claim of the ordering metadata of its
+// block, carried in the compliance statement.
+type OrderingClaim struct {
+	Arrivals  common.Hash // Commitment to the arrival times of the transactions, in block order
+	Score     uint64      // Ordering score the arrival times yield, in basis points
+	MEV       *big.Int    // MEV detected in the block with the built-in rules
+	Signature []byte      // Proposer's signature over orderingClaimSigData
+}
+
+// arrivalsCommitment returns the commitment to the arrival times of a block's
+// transactions.
+func arrivalsCommitment(arrivals []*TxArrival) common.Hash {
+	enc, _ := rlp.EncodeToBytes(arrivals)
+	return crypto.Keccak256Hash([]byte("equa-arrivals"), enc)
+}
+
+// arrivalsScore returns the ordering score, in basis points, of transactions
+// with the given arrival times.
+func arrivalsScore(arrivals []*TxArrival) uint64 {
+	violations, total := countOrderingViolations(len(arrivals), func(i int) (time.Time, bool) {
+		return time.UnixMilli(int64(arrivals[i].Seen)), arrivals[i].Seen != 0
+	})
+	if total == 0 {
+		return maxOrderingScore
+	}
+	return uint64(total-violations) * maxOrderingScore / uint64(total)
+}
+
+// orderingClaimSigData returns the data signed by the proposer for the claim of
+// its block. The signature is made over its Keccak256 hash.
+func orderingClaimSigData(header *types.Header, claim *OrderingClaim) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{header.ParentHash, header.Number, header.Coinbase, header.TxHash, claim.Arrivals, claim.Score, claim.MEV})
+	return append([]byte("equa-ordering-claim"), enc...)
+}
+
+// verify checks that the claim is well formed and signed by the proposer of the
+// header carrying it.
+func (c *OrderingClaim) verify(header *types.Header) error {
+	if c.Score > maxOrderingScore || c.MEV == nil {
+		return errInvalidOrderingClaim
+	}
+	if len(c.Signature) != crypto.SignatureLength {
+		return errInvalidOrderingClaimSig
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(orderingClaimSigData(header, c)), c.Signature)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != header.Coinbase {
+		return errInvalidOrderingClaimSig
+	}
+	return nil
+}
+
+// orderingClaim returns the ordering claim of a header, or nil if it carries
+// none.
+func orderingClaim(header *types.Header) (*OrderingClaim, error) {
+	statement, err := decodeStatement(header)
+	if errors.Is(err, errMissingStatement) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if statement.Ordering == nil {
+		return nil, nil
+	}
+	if err := statement.Ordering.verify(header); err != nil {
+		return nil, err
+	}
+	return statement.Ordering, nil
+}
+
+// writeArrivals stores the arrival times claimed for a block by their
+// commitment.
+func writeArrivals(db ethdb.KeyValueWriter, hash common.Hash, arrivals []*TxArrival) error {
+	blob, err := json.Marshal(arrivals)
+	if err != nil {
+		return err
+	}
+	return db.Put(append(common.CopyBytes(rawdb.EquaArrivalsPrefix), hash[:]...), blob)
+}
+
+// readArrivals retrieves the arrival times claimed for a block by their
+// commitment, or nil if they are not stored.
+func readArrivals(db ethdb.KeyValueReader, hash common.Hash) []*TxArrival {
+	blob, err := db.Get(append(common.CopyBytes(rawdb.EquaArrivalsPrefix), hash[:]...))
+	if err != nil {
+		return nil
+	}
+	var arrivals []*TxArrival
+	if err := json.Unmarshal(blob, &arrivals); err != nil || arrivalsCommitment(arrivals) != hash {
+		return nil
+	}
+	return arrivals
+}
+
+// localArrivals returns the arrival times this node knows of a block's
+// transactions.
+func (e *Equa) localArrivals(txs []*types.Transaction) []*TxArrival {
+	arrivals := make([]*TxArrival, len(txs))
+	for i, tx := range txs {
+		arrivals[i] = &TxArrival{Hash: tx.Hash()}
+		if seen, ok := e.fairOrderer.getTransactionTimestamp(tx); ok {
+			arrivals[i].Seen = uint64(seen.UnixMilli())
+		}
+	}
+	return arrivals
+}
+
+// signOrderingClaim claims the ordering metadata of a block with the given
+// account, storing the arrival times committed to for publication. The block
+// must have been assembled locally, the MEV claimed being the one detected from
+// its receipts while finalizing it.
+func (e *Equa) signOrderingClaim(header *types.Header, txs []*types.Transaction, signer common.Address, signFn SignerFn) (*OrderingClaim, error) {
+	own, ok := e.ownAssessments.Get(header.TxHash)
+	if !ok || own.proposer != header.Coinbase {
+		return nil, errUnassembledBlock
+	}
+	arrivals := e.localArrivals(txs)
+	claim := &OrderingClaim{
+		Arrivals: arrivalsCommitment(arrivals),
+		Score:    arrivalsScore(arrivals),
+		MEV:      new(big.Int).Set(own.mev),
+	}
+	if err := writeArrivals(e.db, claim.Arrivals, arrivals); err != nil {
+		return nil, err
+	}
+	sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeEquaOrderingClaim, orderingClaimSigData(header, claim))
+	if err != nil {
+		return nil, err
+	}
+	claim.Signature = sig
+	return claim, nil
+}
+
+// verifyOrderingClaim checks that a block carries an ordering claim, and reports
+// claimed ordering scores far from the one computed from local arrival times.
+// The MEV claimed is checked once the block is processed, see verifyClaimedMEV.
+func (e *Equa) verifyOrderingClaim(block *types.Block) error {
+	claim, err := orderingClaim(block.Header())
+	if err != nil {
+		return err
+	}
+	if claim == nil {
+		return errMissingOrderingClaim
+	}
+	local := arrivalsScore(e.localArrivals(block.Transactions()))
+	if max(local, claim.Score)-min(local, claim.Score) > orderingScoreDrift {
+		orderingDisputeMeter.Mark(1)
+		log.Debug("Disputed ordering claim", "number", block.Number(), "hash", block.Hash(), "proposer", block.Coinbase(), "claimed", claim.Score, "local", local)
+	}
+	return nil
+}
+
+// verifyClaimedMEV checks the MEV claimed for a block against the one detected
+// from the receipts of its transactions while processing it.
+func verifyClaimedMEV(header *types.Header, mev *big.Int) error {
+	claim, err := orderingClaim(header)
+	if err != nil {
+		return err
+	}
+	if claim == nil {
+		return errMissingOrderingClaim
+	}
+	if claim.MEV.Cmp(mev) != 0 {
+		return fmt.Errorf("%w: have %v, want %v", errOrderingClaimMEV, claim.MEV, mev)
+	}
+	return nil
+}
+
+// OrderingClaimStatus is the ordering claim of a block, checked against local
+// arrival times and, if known, the arrival times committed to.
+type OrderingClaimStatus struct {
+	Number     uint64         `json:"number"`
+	Hash       common.Hash    `json:"hash"`
+	Proposer   common.Address `json:"proposer"`
+	Arrivals   common.Hash    `json:"arrivals"`   // Commitment to the claimed arrival times
+	Score      uint64         `json:"score"`      // Claimed ordering score, in basis points
+	MEV        *big.Int       `json:"mev"`        // Claimed MEV, checked on import
+	LocalScore uint64         `json:"localScore"` // Ordering score from this node's arrival times, in basis points
+
+	// Published are the arrival times committed to, if known, and Consistent
+	// whether they yield the claimed score.
+	Published  []*TxArrival `json:"published,omitempty"`
+	Consistent *bool        `json:"consistent,omitempty"`
+}
+
+// orderingClaimStatus checks the ordering claim of a canonical block. If the
+// arrival times are nil, the ones stored when claiming the block, if sealed
+// locally, are checked.
+func (e *Equa) orderingClaimStatus(chain consensus.ChainHeaderReader, number uint64, arrivals []*TxArrival) (*OrderingClaimStatus, error) {
+	block, err := chainBlock(chain, number)
+	if err != nil {
+		return nil, err
+	}
+	claim, err := orderingClaim(block.Header())
+	if err != nil {
+		return nil, err
+	}
+	if claim == nil {
+		return nil, errMissingOrderingClaim
+	}
+	status := &OrderingClaimStatus{
+		Number:     number,
+		Hash:       block.Hash(),
+		Proposer:   block.Coinbase(),
+		Arrivals:   claim.Arrivals,
+		Score:      claim.Score,
+		MEV:        claim.MEV,
+		LocalScore: arrivalsScore(e.localArrivals(block.Transactions())),
+	}
+	if arrivals == nil {
+		arrivals = readArrivals(e.db, claim.Arrivals)
+	} else if err := checkArrivals(block, claim, arrivals); err != nil {
+		return nil, err
+	}
+	if arrivals != nil {
+		consistent := arrivalsScore(arrivals) == claim.Score
+		status.Published, status.Consistent = arrivals, &consistent
+	}
+	return status, nil
+}
+
+// checkArrivals checks that arrival times are the ones a claim commits to, for
+// the transactions of the block.
+func checkArrivals(block *types.Block, claim *OrderingClaim, arrivals []*TxArrival) error {
+	txs := block.Transactions()
+	if len(arrivals) != len(txs) {
+		return fmt.Errorf("%w: have %d arrivals, want %d", errArrivalsMismatch, len(arrivals), len(txs))
+	}
+	for i, tx := range txs {
+		if arrivals[i].Hash != tx.Hash() {
+			return fmt.Errorf("%w: arrival %d of %x, want %x", errArrivalsMismatch, i, arrivals[i].Hash, tx.Hash())
+		}
+	}
+	if arrivalsCommitment(arrivals) != claim.Arrivals {
+		return fmt.Errorf("%w: commitment %x", errArrivalsMismatch, claim.Arrivals)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/rlp"
+)
+
+// Tests that proposers claim the arrival times, ordering score and MEV of their
+// blocks, that the MEV claimed is checked against the one detected from the
+// receipts when processing the block and that published arrival times can be
+// checked against the claim.
+func TestOrderingClaim(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	proposer := crypto.PubkeyToAddress(key.PublicKey)
+
+	engine := newTestEngine(t, 32, proposer)
+	engine.config.Features = map[string]bool{FeatureComplianceStatements: true, FeatureOrderingCommitments: true}
+	engine.Authorize(proposer, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	// The block includes a sandwich, its transactions in reverse arrival order
+	bot, _ := crypto.GenerateKey()
+	victim, _ := crypto.GenerateKey()
+	txs := sandwichTxs(newTestChainConfig(engine.config), bot, victim)
+	recordTestArrivals(engine.arrivals, []*types.Transaction{txs[2], txs[1], txs[0]})
+	receipts := []*types.Receipt{{Status: types.ReceiptStatusSuccessful}, {Status: types.ReceiptStatusSuccessful}, {Status: types.ReceiptStatusSuccessful}}
+
+	chain := &testBlockChain{
+		testHeaderChain: testHeaderChain{
+			config:  newTestChainConfig(engine.config),
+			headers: []*types.Header{{Number: big.NewInt(0)}},
+		},
+		blocks: make(map[common.Hash]*types.Block),
+	}
+	chain.blocks[chain.headers[0].Hash()] = types.NewBlockWithHeader(chain.headers[0])
+
+	// Only blocks assembled locally can be claimed
+	header := &types.Header{ParentHash: chain.headers[0].Hash(), Number: big.NewInt(1), Coinbase: proposer, Difficulty: common.Big1}
+	if err := engine.signStatement(types.CopyHeader(header), txs, nil); err != errUnassembledBlock {
+		t.Fatalf("foreign block claimed: have %v, want %v", err, errUnassembledBlock)
+	}
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb.Copy(), &types.Body{Transactions: txs}, receipts)
+	if err != nil {
+		t.Fatalf("failed to assemble block: %v", err)
+	}
+	header = block.Header()
+	if err := engine.signStatement(header, txs, nil); err != nil {
+		t.Fatalf("failed to sign statement: %v", err)
+	}
+	block = block.WithSeal(header)
+	chain.headers = append(chain.headers, block.Header())
+	chain.blocks[block.Hash()] = block
+
+	claim, err := orderingClaim(header)
+	if err != nil {
+		t.Fatalf("failed to decode ordering claim: %v", err)
+	}
+	if claim == nil || claim.Score != 0 || claim.MEV.Cmp(testSandwichProfit) != 0 {
+		t.Fatalf("claim mismatch: have %+v, want MEV %v", claim, testSandwichProfit)
+	}
+	if err := engine.VerifyUncles(chain, block); err != nil {
+		t.Fatalf("block rejected: %v", err)
+	}
+	if err := engine.FinalizeWithReceipts(chain, header, statedb.Copy(), &types.Body{Transactions: txs}, receipts); err != nil {
+		t.Fatalf("block rejected on processing: %v", err)
+	}
+	// The claim is bound to the proposer
+	other := types.CopyHeader(header)
+	other.Coinbase = common.Address{0x01}
+	if err := claim.verify(other); err != errInvalidOrderingClaimSig {
+		t.Fatalf("claim of other proposer: have %v, want %v", err, errInvalidOrderingClaimSig)
+	}
+	// Blocks claiming MEV other than the one detected must be rejected
+	statement, err := decodeStatement(header)
+	if err != nil {
+		t.Fatalf("failed to decode statement: %v", err)
+	}
+	forged := &OrderingClaim{Arrivals: claim.Arrivals, Score: claim.Score, MEV: new(big.Int)}
+	if forged.Signature, err = crypto.Sign(crypto.Keccak256(orderingClaimSigData(header, forged)), key); err != nil {
+		t.Fatalf("failed to sign claim: %v", err)
+	}
+	statement.Ordering = forged
+	forgedHeader := types.CopyHeader(header)
+	if forgedHeader.Extra, err = rlp.EncodeToBytes(statement); err != nil {
+		t.Fatalf("failed to encode statement: %v", err)
+	}
+	if err := engine.FinalizeWithReceipts(chain, forgedHeader, statedb.Copy(), &types.Body{Transactions: txs}, receipts); !errors.Is(err, errOrderingClaimMEV) {
+		t.Fatalf("forged MEV: have %v, want %v", err, errOrderingClaimMEV)
+	}
+	// Blocks without a claim must be rejected as well
+	statement.Ordering = nil
+	bareHeader := types.CopyHeader(header)
+	if bareHeader.Extra, err = rlp.EncodeToBytes(statement); err != nil {
+		t.Fatalf("failed to encode statement: %v", err)
+	}
+	if err := engine.VerifyUncles(chain, block.WithSeal(bareHeader)); err != errMissingOrderingClaim {
+		t.Fatalf("missing claim: have %v, want %v", err, errMissingOrderingClaim)
+	}
+	// The proposer publishes the arrival times it claimed
+	api := &API{chain: chain, equa: engine}
+	status, err := api.GetOrderingClaim(1)
+	if err != nil {
+		t.Fatalf("failed to get ordering claim: %v", err)
+	}
+	if len(status.Published) != 3 || status.Consistent == nil || !*status.Consistent || status.LocalScore != 0 {
+		t.Fatalf("status mismatch: published %d, consistent %v, local score %d", len(status.Published), status.Consistent, status.LocalScore)
+	}
+	// Anyone can check the published arrival times against the claim
+	if status, err = api.VerifyOrderingClaim(1, status.Published); err != nil || !*status.Consistent {
+		t.Fatalf("published arrivals rejected: %v", err)
+	}
+	tampered := make([]*TxArrival, len(status.Published))
+	for i, arrival := range status.Published {
+		tampered[len(tampered)-1-i] = &TxArrival{Hash: arrival.Hash, Seen: arrival.Seen}
+	}
+	if _, err := api.VerifyOrderingClaim(1, tampered); !errors.Is(err, errArrivalsMismatch) {
+		t.Fatalf("reordered arrivals: have %v, want %v", err, errArrivalsMismatch)
+	}
+	tampered = []*TxArrival{status.Published[0], status.Published[1], {Hash: status.Published[2].Hash}}
+	if _, err := api.VerifyOrderingClaim(1, tampered); !errors.Is(err, errArrivalsMismatch) {
+		t.Fatalf("altered arrival: have %v, want %v", err, errArrivalsMismatch)
+	}
+	if _, err := api.GetOrderingClaim(0); err != errMissingOrderingClaim {
+		t.Fatalf("block without claim: have %v, want %v", err, errMissingOrderingClaim)
+	}
+}
+
+// Tests that ordering scores are computed from the arrival times claimed,
+// ignoring transactions of unknown arrival.
+func TestArrivalsScore(t *testing.T) {
+	tests := []struct {
+		seen  []uint64
+		score uint64
+	}{
+		{nil, maxOrderingScore},
+		{[]uint64{0, 0}, maxOrderingScore},
+		{[]uint64{1, 2, 3}, maxOrderingScore},
+		{[]uint64{3, 2, 1}, 0},
+		{[]uint64{1, 3, 2}, maxOrderingScore / 2},
+		{[]uint64{1, 0, 2}, maxOrderingScore},
+		{[]uint64{2, 0, 1, 3, 4}, maxOrderingScore * 2 / 3},
+	}
+	for i, tt := range tests {
+		var arrivals []*TxArrival
+		for _, seen := range tt.seen {
+			arrivals = append(arrivals, &TxArrival{Seen: seen})
+		}
+		if score := arrivalsScore(arrivals); score != tt.score {
+			t.Errorf("test %d: score mismatch: have %d, want %d", i, score, tt.score)
+		}
+	}
+}
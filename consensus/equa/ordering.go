@@ -4,93 +4,127 @@
 package equa
 
 import (
-	"sort"
+	"math/big"
 	"time"
 
+	"github.com/equa/go-equa/common"
 	"github.com/equa/go-equa/core/types"
 	"github.com/equa/go-equa/params"
 )
 
-// FairOrderer implements fair transaction ordering using First-Come-First-Served (FCFS)
+// FairOrderer implements fair transaction ordering, First-Come-First-Served (FCFS) unless configured otherwise
 type FairOrderer struct {
-	config *params.EquaConfig
+	config   *params.EquaConfig
+	policy   OrderingPolicy   // Policy the transactions of sealed blocks are ordered with
+	arrivals *ArrivalRecorder // Source of arrival times, nil if none are known
+	signer   types.Signer     // Signer recovering the senders to keep the nonce order of, nil if none is kept
 }
 
 // NewFairOrderer creates a new fair orderer
 func NewFairOrderer(config *params.EquaConfig) *FairOrderer {
 	return &FairOrderer{
 		config: config,
+		policy: newOrderingPolicy(config),
 	}
 }
 
+// Policy returns the policy transactions are ordered with.
+func (fo *FairOrderer) Policy() OrderingPolicy {
+	return fo.policy
+}
+
 // OrderTransactions orders transactions fairly based on timestamp of arrival
-func (fo *FairOrderer) OrderTransactions(txs []*types.Transaction) []*types.Transaction {
+func (fo *FairOrderer) OrderTransactions(txs []*types.Transaction, baseFee *big.Int, seed common.Hash) []*types.Transaction {
+	return fo.OrderWithBundles(txs, nil, baseFee, seed)
+}
+
+// OrderWithBundles orders transactions with the ordering policy, keeping the
+// members of each bundle fully contained in txs together and in bundle order.
+// A bundle takes the position of its earliest arriving member, so bundling
+// gains no advantage over sending the transactions individually. Transactions
+// are priced at their effective gas price for the base fee, or at their gas
+// price if it is nil, and shuffled with the seed if the policy does so.
+func (fo *FairOrderer) OrderWithBundles(txs []*types.Transaction, bundles []*Bundle, baseFee *big.Int, seed common.Hash) []*types.Transaction {
 	if len(txs) <= 1 {
 		return txs
 	}
-
-	// Create a slice of transaction wrappers with timestamps
-	type txWrapper struct {
-		tx        *types.Transaction
-		timestamp time.Time
-		gasPrice  uint64
+	// Extract ordered transactions
+	ordered := make([]*types.Transaction, 0, len(txs))
+	for _, unit := range fo.orderUnits(txs, bundles, baseFee, seed) {
+		ordered = append(ordered, unit.Txs...)
 	}
+	return ordered
+}
 
-	wrapped := make([]txWrapper, len(txs))
+// orderUnits orders transactions like OrderWithBundles, returning the ordering
+// units, each either a single transaction or a bundle.
+func (fo *FairOrderer) orderUnits(txs []*types.Transaction, bundles []*Bundle, baseFee *big.Int, seed common.Hash) []OrderingUnit {
+	// Create a slice of ordering units with timestamps, each either a single
+	// transaction or a bundle
+	index := make(map[common.Hash]int, len(txs))
 	for i, tx := range txs {
-		wrapped[i] = txWrapper{
-			tx:        tx,
-			timestamp: fo.getTransactionTimestamp(tx),
-			gasPrice:  tx.GasPrice().Uint64(),
+		index[tx.Hash()] = i
+	}
+	var (
+		units   = make([]OrderingUnit, 0, len(txs))
+		bundled = make(map[int]bool)
+	)
+	for _, bundle := range bundles {
+		members := make([]int, 0, len(bundle.Txs))
+		for _, tx := range bundle.Txs {
+			if i, ok := index[tx.Hash()]; ok && !bundled[i] {
+				members = append(members, i)
+			}
 		}
+		if len(members) != len(bundle.Txs) {
+			continue
+		}
+		unit := OrderingUnit{GasPrice: effectiveGasPrice(bundle.Txs[0], baseFee), Atomic: bundle.Atomic}
+		for _, i := range members {
+			bundled[i] = true
+			unit.Txs = append(unit.Txs, txs[i])
+			if ts, ok := fo.getTransactionTimestamp(txs[i]); ok && (!unit.Known || ts.Before(unit.Arrival)) {
+				unit.Arrival, unit.Known = ts, true
+			}
+		}
+		units = append(units, unit)
 	}
-
-	// Sort by timestamp (FCFS), with gas price as tiebreaker
-	sort.Slice(wrapped, func(i, j int) bool {
-		// First, compare timestamps
-		if !wrapped[i].timestamp.Equal(wrapped[j].timestamp) {
-			return wrapped[i].timestamp.Before(wrapped[j].timestamp)
+	for i, tx := range txs {
+		if !bundled[i] {
+			ts, known := fo.getTransactionTimestamp(tx)
+			units = append(units, OrderingUnit{
+				Txs:      []*types.Transaction{tx},
+				Arrival:  ts,
+				Known:    known,
+				GasPrice: effectiveGasPrice(tx, baseFee),
+			})
 		}
-
-		// If timestamps are equal (or very close), use gas price as tiebreaker
-		return wrapped[i].gasPrice > wrapped[j].gasPrice
-	})
-
-	// Extract ordered transactions
-	ordered := make([]*types.Transaction, len(txs))
-	for i, w := range wrapped {
-		ordered[i] = w.tx
 	}
-
-	return ordered
+	fo.policy.Order(units, seed)
+	if fo.signer != nil {
+		keepNonceOrder(fo.signer, units)
+	}
+	return units
 }
 
-// getTransactionTimestamp gets the timestamp when transaction was received
-func (fo *FairOrderer) getTransactionTimestamp(tx *types.Transaction) time.Time {
-	// In a real implementation, this would be stored when the transaction
-	// first arrives at the mempool. For now, we'll use a placeholder.
-
-	// Try to extract timestamp from transaction hash (deterministic ordering)
-	hash := tx.Hash()
-
-	// Convert first 8 bytes of hash to timestamp-like value
-	timestamp := int64(0)
-	for i := 0; i < 8 && i < len(hash); i++ {
-		timestamp = (timestamp << 8) | int64(hash[i])
+// getTransactionTimestamp gets the timestamp when transaction was received, the
+// median of the first-seen times attested by validators if any. It reports
+// false if the arrival of the transaction is unknown.
+func (fo *FairOrderer) getTransactionTimestamp(tx *types.Transaction) (time.Time, bool) {
+	if fo.arrivals == nil {
+		return time.Time{}, false
 	}
-
-	// Use it as offset from a base time
-	baseTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
-	return baseTime.Add(time.Duration(timestamp) * time.Nanosecond)
+	return fo.arrivals.Timestamp(tx.Hash())
 }
 
-// SeparateByPriority separates transactions into priority tiers
-func (fo *FairOrderer) SeparateByPriority(txs []*types.Transaction) (urgent, normal []*types.Transaction) {
+// SeparateByPriority separates transactions into priority tiers by their
+// effective gas price for the base fee, or by gas price if it is nil.
+func (fo *FairOrderer) SeparateByPriority(txs []*types.Transaction, baseFee *big.Int) (urgent, normal []*types.Transaction) {
 	// High gas price threshold for urgent transactions
-	urgentThreshold := uint64(1000000000000) // 1000 gwei
+	urgentThreshold := big.NewInt(1000000000000) // 1000 gwei
 
 	for _, tx := range txs {
-		if tx.GasPrice().Uint64() >= urgentThreshold {
+		if effectiveGasPrice(tx, baseFee).Cmp(urgentThreshold) >= 0 {
 			urgent = append(urgent, tx)
 		} else {
 			normal = append(normal, tx)
@@ -106,16 +140,19 @@ func (fo *FairOrderer) ValidateOrdering(txs []*types.Transaction) bool {
 		return true
 	}
 
-	// Check if transactions are in timestamp order
-	for i := 1; i < len(txs); i++ {
-		prevTime := fo.getTransactionTimestamp(txs[i-1])
-		currTime := fo.getTransactionTimestamp(txs[i])
-
+	// Check if transactions of known arrival are in timestamp order
+	var prevTime time.Time
+	for _, tx := range txs {
+		currTime, ok := fo.getTransactionTimestamp(tx)
+		if !ok {
+			continue
+		}
 		// Allow some tolerance for network latency (100ms)
 		tolerance := time.Millisecond * 100
 		if currTime.Add(tolerance).Before(prevTime) {
 			return false
 		}
+		prevTime = currTime
 	}
 
 	return true
@@ -123,21 +160,42 @@ func (fo *FairOrderer) ValidateOrdering(txs []*types.Transaction) bool {
 
 // GetOrderingScore calculates a score for transaction ordering quality
 func (fo *FairOrderer) GetOrderingScore(txs []*types.Transaction) float64 {
-	if len(txs) <= 1 {
+	violations, total := fo.OrderingViolations(txs)
+	if total == 0 {
 		return 1.0
 	}
+	return float64(total-violations) / float64(total)
+}
 
-	violations := 0
-	total := len(txs) - 1
-
-	for i := 1; i < len(txs); i++ {
-		prevTime := fo.getTransactionTimestamp(txs[i-1])
-		currTime := fo.getTransactionTimestamp(txs[i])
+// OrderingViolations returns the number of consecutive transaction pairs that
+// are out of arrival order, along with the number of pairs checked. Only
+// transactions of known arrival are compared.
+func (fo *FairOrderer) OrderingViolations(txs []*types.Transaction) (violations int, total int) {
+	return countOrderingViolations(len(txs), func(i int) (time.Time, bool) {
+		return fo.getTransactionTimestamp(txs[i])
+	})
+}
 
-		if currTime.Before(prevTime) {
-			violations++
+// countOrderingViolations returns the number of consecutive pairs of the n
+// transactions of known arrival that are out of arrival order, along with the
+// number of pairs checked.
+func countOrderingViolations(n int, timestamp func(i int) (time.Time, bool)) (violations int, total int) {
+	var (
+		prevTime time.Time
+		seen     bool
+	)
+	for i := 0; i < n; i++ {
+		currTime, ok := timestamp(i)
+		if !ok {
+			continue
 		}
+		if seen {
+			if currTime.Before(prevTime) {
+				violations++
+			}
+			total++
+		}
+		prevTime, seen = currTime, true
 	}
-
-	return float64(total-violations) / float64(total)
-}
\ No newline at end of file
+	return violations, total
+}
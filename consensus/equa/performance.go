@@ -0,0 +1,128 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+)
+
+// maxPerformanceEpochs is the number of epochs a performance query covers at
+// most.
+const maxPerformanceEpochs = 64
+
+var errInvalidPerformanceRange = errors.New("invalid performance epoch range")
+
+// ValidatorPerformance is the track record of a validator over a range of
+// finished epochs, compiled from the epoch summaries, along with its current
+// standing.
+type ValidatorPerformance struct {
+	Validator     common.Address   `json:"validator"`
+	FromEpoch     uint64           `json:"fromEpoch"`
+	ToEpoch       uint64           `json:"toEpoch"`
+	Status        string           `json:"status"`          // Current status, see the ValidatorStatus constants
+	Stake         *big.Int         `json:"stake,omitempty"` // Current stake, nil if not in the validator set
+	Class         string           `json:"class,omitempty"` // Current validator class
+	Expected      int              `json:"expected"`        // Blocks the validator was scheduled to propose
+	Proposed      int              `json:"proposed"`        // Blocks proposed
+	Unscheduled   int              `json:"unscheduled"`     // Blocks of the range whose proposer schedule was no longer known
+	OrderingScore *float64         `json:"orderingScore"`   // Share of the transaction pairs of known arrival proposed in order, nil if none
+	MEV           *big.Int         `json:"mev"`             // MEV detected in the proposed blocks
+	Rewards       *big.Int         `json:"rewards"`         // Rewards credited, as recorded in the reward ledger
+	Slashings     []*SlashingEvent `json:"slashings"`       // Offenses detected or slashed in the range
+	Evidence      []*Evidence      `json:"evidence"`        // Pending slashing evidence, regardless of the range
+}
+
+// scheduledProposer returns the proposer a block was scheduled for, if the
+// schedule covering it is still cached. Schedules are not drawn afresh, as they
+// depend on the validator set of their epoch.
+func (e *Equa) scheduledProposer(chain consensus.ChainHeaderReader, header *types.Header) (common.Address, bool) {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return common.Address{}, false
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return common.Address{}, false
+	}
+	boundary, err := e.epochBoundary(chain, parent)
+	if err != nil {
+		return common.Address{}, false
+	}
+	schedule, ok := e.schedules.Get(boundary)
+	if !ok || schedule.Epoch != scheduleEpoch(number, e.config.Epoch) {
+		return common.Address{}, false
+	}
+	return schedule.Proposer(number), true
+}
+
+// validatorPerformance compiles the track record of a validator over a range of
+// finished epochs, including both ends, from their summaries.
+func (e *Equa) validatorPerformance(chain consensus.ChainHeaderReader, validator common.Address, fromEpoch, toEpoch uint64) (*ValidatorPerformance, error) {
+	if toEpoch < fromEpoch || toEpoch-fromEpoch >= maxPerformanceEpochs {
+		return nil, fmt.Errorf("%w %d-%d, at most %d epochs", errInvalidPerformanceRange, fromEpoch, toEpoch, maxPerformanceEpochs)
+	}
+	perf := &ValidatorPerformance{
+		Validator: validator,
+		FromEpoch: fromEpoch,
+		ToEpoch:   toEpoch,
+		Status:    ValidatorStatusUnknown,
+		MEV:       new(big.Int),
+		Rewards:   new(big.Int),
+		Slashings: []*SlashingEvent{},
+		Evidence:  e.slasher.Evidence(validator),
+	}
+	if status, ok := e.stakeManager.validatorStatuses()[validator]; ok {
+		perf.Status = status
+	}
+	if v, ok := e.stakeManager.GetValidator(validator); ok {
+		perf.Stake, perf.Class = new(big.Int).Set(v.Stake), e.stakeManager.validatorClass(v).Name
+	}
+	var violations, pairs int
+	for epoch := fromEpoch; epoch <= toEpoch; epoch++ {
+		summary, err := e.SummarizeEpoch(chain, epoch)
+		if err != nil {
+			return nil, err
+		}
+		perf.Unscheduled += summary.Unscheduled
+		for _, v := range summary.Validators {
+			if v.Address != validator {
+				continue
+			}
+			perf.Expected += v.Expected
+			perf.Proposed += v.Proposed
+			perf.MEV.Add(perf.MEV, v.MEV)
+			perf.Rewards.Add(perf.Rewards, v.Rewards)
+			perf.Slashings = append(perf.Slashings, v.Slashings...)
+			violations += v.OrderingViolations
+			pairs += v.OrderingPairs
+		}
+	}
+	if pairs > 0 {
+		score := float64(pairs-violations) / float64(pairs)
+		perf.OrderingScore = &score
+	}
+	if perf.Evidence == nil {
+		perf.Evidence = []*Evidence{}
+	}
+	return perf, nil
+}
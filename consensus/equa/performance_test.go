@@ -0,0 +1,111 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+)
+
+// Tests that the performance of a validator is compiled from the summaries of
+// the epochs in range: the blocks it was scheduled for against the ones it
+// proposed, and the ordering of the transactions it proposed.
+func TestValidatorPerformance(t *testing.T) {
+	var (
+		validators = []common.Address{{0x01}, {0x02}, {0x03}}
+		engine     = newTestEngine(t, 32, validators...)
+		chain      = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+			receipts:        make(map[common.Hash]types.Receipts),
+		}
+		api = &API{chain: chain, equa: engine}
+	)
+	engine.config.Epoch = 4
+
+	// The first block includes a transaction out of arrival order
+	txs := newTestTransactions(t, 3)
+	recordTestArrivals(engine.arrivals, txs)
+	txs[1], txs[2] = txs[2], txs[1]
+
+	// Every block is proposed as scheduled, but the sixth
+	var (
+		expected = make(map[common.Address]int)
+		proposed = make(map[common.Address]int)
+	)
+	for number := int64(0); number < 8; number++ {
+		header := &types.Header{Number: big.NewInt(number), Difficulty: common.Big1}
+		var body types.Body
+		if number > 0 {
+			parent := chain.headers[number-1]
+			schedule, err := engine.blockSchedule(chain, uint64(number), parent)
+			if err != nil {
+				t.Fatalf("failed to schedule block %d: %v", number, err)
+			}
+			header.ParentHash, header.Coinbase = parent.Hash(), schedule.Proposer(uint64(number))
+			expected[header.Coinbase]++
+			if number == 6 {
+				for _, addr := range validators {
+					if addr != header.Coinbase {
+						header.Coinbase = addr
+						break
+					}
+				}
+			}
+			proposed[header.Coinbase]++
+		}
+		if number == 1 {
+			body.Transactions = txs
+		}
+		block := types.NewBlockWithHeader(header).WithBody(body)
+		chain.headers = append(chain.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+		var receipts types.Receipts
+		for _, tx := range body.Transactions {
+			receipts = append(receipts, &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash(), GasUsed: 21000})
+		}
+		chain.receipts[block.Hash()] = receipts
+	}
+	for _, addr := range validators {
+		perf, err := api.GetValidatorPerformance(addr, 0, 1)
+		if err != nil {
+			t.Fatalf("failed to get performance: %v", err)
+		}
+		if perf.Status != ValidatorStatusActive || perf.Stake == nil || perf.Unscheduled != 0 {
+			t.Errorf("validator %x standing mismatch: have %+v", addr, perf)
+		}
+		if perf.Expected != expected[addr] || perf.Proposed != proposed[addr] {
+			t.Errorf("validator %x proposals mismatch: have %d of %d, want %d of %d", addr, perf.Proposed, perf.Expected, proposed[addr], expected[addr])
+		}
+		switch proposer := chain.headers[1].Coinbase; {
+		case addr == proposer && (perf.OrderingScore == nil || *perf.OrderingScore != 0.5):
+			t.Errorf("validator %x ordering score mismatch: have %v, want 0.5", addr, perf.OrderingScore)
+		case addr != proposer && perf.OrderingScore != nil:
+			t.Errorf("validator %x scored without proposing transactions: %v", addr, *perf.OrderingScore)
+		}
+	}
+	if _, err := api.GetValidatorPerformance(validators[0], 1, 0); !errors.Is(err, errInvalidPerformanceRange) {
+		t.Errorf("inverted range error mismatch: have %v, want %v", err, errInvalidPerformanceRange)
+	}
+	if _, err := api.GetValidatorPerformance(validators[0], 0, 2); !errors.Is(err, errEpochInProgress) {
+		t.Errorf("unfinished epoch error mismatch: have %v, want %v", err, errEpochInProgress)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+var (
+	errMissingBatchSeed    = errors.New("missing shuffle seed of random batches")
+	errUnexpectedBatchSeed = errors.New("shuffle seed stated without random batches")
+	errInvalidBatchSeed    = errors.New("shuffle seed not drawn for block")
+)
+
+// OrderingUnit is a single transaction, or a bundle of transactions kept
+// together, ordered as a whole by an ordering policy.
+type OrderingUnit struct {
+	Txs      []*types.Transaction
+	Arrival  time.Time // Earliest arrival time of the transactions
+	Known    bool      // Whether the arrival time is known
+	GasPrice *big.Int  // Effective gas price of the first transaction
+	Atomic   bool      // Whether the unit is a bundle included all-or-nothing
+}
+
+// OrderingPolicy decides the order in which the transactions of a sealed block
+// are included. Units of unknown arrival follow the others, ordered by gas
+// price, under every policy.
+type OrderingPolicy interface {
+	// Name returns the name the policy is configured with.
+	Name() string
+
+	// ID returns the identifier of the policy in compliance statements.
+	ID() uint64
+
+	// Params returns the parameters of the policy by name.
+	Params() map[string]interface{}
+
+	// Order sorts the units in place. Policies ordering randomly draw from the
+	// seed, see orderingSeed.
+	Order(units []OrderingUnit, seed common.Hash)
+}
+
+// newOrderingPolicy creates the ordering policy selected by the configuration,
+// strict first-come-first-served ordering if none is.
+func newOrderingPolicy(config *params.EquaConfig) OrderingPolicy {
+	if config == nil {
+		return fcfsPolicy{}
+	}
+	window := time.Duration(config.OrderingWindow) * time.Millisecond
+	switch config.OrderingPolicy {
+	case params.EquaOrderingPriorityAuction:
+		return &priorityAuctionPolicy{window: window}
+	case params.EquaOrderingRandomBatch:
+		return &randomBatchPolicy{window: window}
+	default:
+		return fcfsPolicy{}
+	}
+}
+
+// fcfsPolicy orders units strictly by arrival time, with gas price as the
+// tiebreaker.
+type fcfsPolicy struct{}
+
+func (fcfsPolicy) Name() string                   { return params.EquaOrderingFCFS }
+func (fcfsPolicy) ID() uint64                     { return OrderingPolicyFCFS }
+func (fcfsPolicy) Params() map[string]interface{} { return map[string]interface{}{} }
+
+func (fcfsPolicy) Order(units []OrderingUnit, seed common.Hash) {
+	sort.SliceStable(units, func(i, j int) bool {
+		if units[i].Known != units[j].Known {
+			return units[i].Known
+		}
+		if !units[i].Arrival.Equal(units[j].Arrival) {
+			return units[i].Arrival.Before(units[j].Arrival)
+		}
+		return units[i].GasPrice.Cmp(units[j].GasPrice) > 0
+	})
+}
+
+// priorityAuctionPolicy orders units by the arrival time window they fall in,
+// auctioning the positions within a window by gas price. Latency races within a
+// window gain nothing, while bids cannot move a transaction ahead of earlier
+// windows.
+type priorityAuctionPolicy struct {
+	window time.Duration
+}
+
+func (p *priorityAuctionPolicy) Name() string { return params.EquaOrderingPriorityAuction }
+func (p *priorityAuctionPolicy) ID() uint64   { return OrderingPolicyPriorityAuction }
+
+func (p *priorityAuctionPolicy) Params() map[string]interface{} {
+	return map[string]interface{}{"window": p.window.Milliseconds()}
+}
+
+func (p *priorityAuctionPolicy) Order(units []OrderingUnit, seed common.Hash) {
+	sort.SliceStable(units, func(i, j int) bool {
+		if units[i].Known != units[j].Known {
+			return units[i].Known
+		}
+		if units[i].Known {
+			if wi, wj := arrivalWindow(units[i], p.window), arrivalWindow(units[j], p.window); wi != wj {
+				return wi < wj
+			}
+		}
+		if c := units[i].GasPrice.Cmp(units[j].GasPrice); c != 0 {
+			return c > 0
+		}
+		return units[i].Arrival.Before(units[j].Arrival)
+	})
+}
+
+// randomBatchPolicy orders units by the arrival time window they fall in, in a
+// random order within a window. Neither latency nor bids decide the position of
+// a transaction within its batch.
+type randomBatchPolicy struct {
+	window time.Duration
+}
+
+func (p *randomBatchPolicy) Name() string { return params.EquaOrderingRandomBatch }
+func (p *randomBatchPolicy) ID() uint64   { return OrderingPolicyRandomBatch }
+
+func (p *randomBatchPolicy) Params() map[string]interface{} {
+	return map[string]interface{}{"window": p.window.Milliseconds()}
+}
+
+func (p *randomBatchPolicy) Order(units []OrderingUnit, seed common.Hash) {
+	fcfsPolicy{}.Order(units, seed)
+
+	for start := 0; start < len(units) && units[start].Known; {
+		end, window := start+1, arrivalWindow(units[start], p.window)
+		for end < len(units) && units[end].Known && arrivalWindow(units[end], p.window) == window {
+			end++
+		}
+		deterministicShuffle(units[start:end], seed)
+		start = end
+	}
+}
+
+// arrivalWindow returns the index of the arrival time window a unit of known
+// arrival falls in.
+func arrivalWindow(unit OrderingUnit, window time.Duration) int64 {
+	if window <= 0 {
+		return unit.Arrival.UnixNano()
+	}
+	return unit.Arrival.UnixNano() / int64(window)
+}
+
+// deterministicShuffle orders units by a rank drawn from the seed for their
+// first transaction. Units are ranked independently of each other, so adding or
+// dropping a transaction, a dust one say, does not change the relative order of
+// the others.
+func deterministicShuffle(units []OrderingUnit, seed common.Hash) {
+	if len(units) <= 1 {
+		return
+	}
+	ranks := make([]common.Hash, len(units))
+	order := make([]int, len(units))
+	for i, unit := range units {
+		ranks[i] = crypto.Keccak256Hash(seed[:], unit.Txs[0].Hash().Bytes())
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(ranks[order[i]][:], ranks[order[j]][:]) < 0
+	})
+	shuffled := make([]OrderingUnit, len(units))
+	for i, k := range order {
+		shuffled[i] = units[k]
+	}
+	copy(units, shuffled)
+}
+
+// keepNonceOrder sorts the single transaction units of each sender by nonce
+// within the positions the policy placed them at, for the transactions of the
+// sender to be executable in order. Bundles keep their position, as do the
+// transactions whose sender cannot be recovered.
+func keepNonceOrder(signer types.Signer, units []OrderingUnit) {
+	positions := make(map[common.Address][]int)
+	for i, unit := range units {
+		if len(unit.Txs) != 1 {
+			continue
+		}
+		if from, err := types.Sender(signer, unit.Txs[0]); err == nil {
+			positions[from] = append(positions[from], i)
+		}
+	}
+	for _, slots := range positions {
+		if len(slots) < 2 {
+			continue
+		}
+		sorted := make([]OrderingUnit, len(slots))
+		for j, i := range slots {
+			sorted[j] = units[i]
+		}
+		sort.SliceStable(sorted, func(a, b int) bool {
+			return sorted[a].Txs[0].Nonce() < sorted[b].Txs[0].Nonce()
+		})
+		for j, i := range slots {
+			units[i] = sorted[j]
+		}
+	}
+}
+
+// orderingSeed derives the randomness the transactions of a block are shuffled
+// with from the seed of the proposer schedule covering it. The schedule seed is
+// fixed an epoch ahead by the epoch boundary block, so unlike the transactions
+// or the parent hash, the proposer of a block has no say in it.
+func orderingSeed(scheduleSeed common.Hash, number uint64) common.Hash {
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], number)
+	return crypto.Keccak256Hash([]byte("equa-ordering-seed"), scheduleSeed[:], enc[:])
+}
+
+// blockOrderingSeed returns the randomness the transactions of the child of
+// parent with the given number are shuffled with.
+func (e *Equa) blockOrderingSeed(chain consensus.ChainHeaderReader, number uint64, parent *types.Header) (common.Hash, error) {
+	boundary, err := e.epochBoundary(chain, parent)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return orderingSeed(proposerSeed(boundary, scheduleEpoch(number, e.config.Epoch)), number), nil
+}
+
+// batchSeed returns the seed the transactions of a block are shuffled with if
+// the random batch policy orders them, nil otherwise.
+func (e *Equa) batchSeed(chain consensus.ChainHeaderReader, header *types.Header) (*common.Hash, error) {
+	if e.fairOrderer.Policy().ID() != OrderingPolicyRandomBatch {
+		return nil, nil
+	}
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	seed, err := e.blockOrderingSeed(chain, header.Number.Uint64(), parent)
+	if err != nil {
+		return nil, err
+	}
+	return &seed, nil
+}
+
+// verifyBatchSeed checks that the compliance statement of a header sealed with
+// the random batch policy states the seed drawn for its height.
+func (e *Equa) verifyBatchSeed(chain consensus.ChainHeaderReader, header *types.Header, parent *types.Header) error {
+	statement, err := decodeStatement(header)
+	if err != nil {
+		return err
+	}
+	if statement.Policy != OrderingPolicyRandomBatch {
+		if statement.Seed != nil {
+			return errUnexpectedBatchSeed
+		}
+		return nil
+	}
+	if statement.Seed == nil {
+		return errMissingBatchSeed
+	}
+	seed, err := e.blockOrderingSeed(chain, header.Number.Uint64(), parent)
+	if err != nil {
+		return err
+	}
+	if *statement.Seed != seed {
+		return fmt.Errorf("%w: have %x, want %x", errInvalidBatchSeed, *statement.Seed, seed)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// newTestUnits creates ordering units arriving at the given offsets, in
+// milliseconds from a window boundary, at the given gas prices. Negative
+// offsets are unknown arrivals.
+func newTestUnits(offsets []int64, prices []int64) []OrderingUnit {
+	units := make([]OrderingUnit, len(offsets))
+	for i := range offsets {
+		units[i] = OrderingUnit{
+			Txs:      []*types.Transaction{types.NewTransaction(uint64(i), common.Address{}, nil, 21000, big.NewInt(prices[i]), nil)},
+			GasPrice: big.NewInt(prices[i]),
+		}
+		if offsets[i] >= 0 {
+			units[i].Arrival, units[i].Known = time.UnixMilli(1_000_000+offsets[i]), true
+		}
+	}
+	return units
+}
+
+// unitNonces returns the nonces of the transactions of units, identifying them.
+func unitNonces(units []OrderingUnit) []uint64 {
+	nonces := make([]uint64, len(units))
+	for i, unit := range units {
+		nonces[i] = unit.Txs[0].Nonce()
+	}
+	return nonces
+}
+
+// Tests that the ordering policies order units of known arrival by arrival or
+// arrival window as configured, and the others by gas price last.
+func TestOrderingPolicies(t *testing.T) {
+	var (
+		offsets = []int64{0, 50, 150, 250, -1, -1}
+		prices  = []int64{1, 3, 2, 5, 1, 9}
+	)
+	tests := []struct {
+		policy string
+		id     uint64
+		want   []uint64
+	}{
+		{params.EquaOrderingFCFS, OrderingPolicyFCFS, []uint64{0, 1, 2, 3, 5, 4}},
+		{params.EquaOrderingPriorityAuction, OrderingPolicyPriorityAuction, []uint64{1, 2, 0, 3, 5, 4}},
+	}
+	for _, tt := range tests {
+		policy := newOrderingPolicy(&params.EquaConfig{OrderingPolicy: tt.policy, OrderingWindow: 200})
+		if policy.Name() != tt.policy {
+			t.Errorf("policy name mismatch: have %s, want %s", policy.Name(), tt.policy)
+		}
+		if policy.ID() != tt.id {
+			t.Errorf("%s: policy id mismatch: have %d, want %d", tt.policy, policy.ID(), tt.id)
+		}
+		units := newTestUnits(offsets, prices)
+		policy.Order(units, common.Hash{})
+		if have := unitNonces(units); !slices.Equal(have, tt.want) {
+			t.Errorf("%s: order mismatch: have %v, want %v", tt.policy, have, tt.want)
+		}
+	}
+	if policy := newOrderingPolicy(nil); policy.Name() != params.EquaOrderingFCFS {
+		t.Errorf("default policy mismatch: have %s, want %s", policy.Name(), params.EquaOrderingFCFS)
+	}
+	// Random batches are shuffled within their window only, reproducibly
+	policy := newOrderingPolicy(&params.EquaConfig{OrderingPolicy: params.EquaOrderingRandomBatch, OrderingWindow: 200})
+	if window := policy.Params()["window"]; window != int64(200) {
+		t.Errorf("window mismatch: have %v, want 200", window)
+	}
+	units := newTestUnits(offsets, prices)
+	policy.Order(units, common.Hash{})
+	have := unitNonces(units)
+
+	batch := slices.Clone(have[:3])
+	slices.Sort(batch)
+	if !slices.Equal(batch, []uint64{0, 1, 2}) || !slices.Equal(have[3:], []uint64{3, 5, 4}) {
+		t.Errorf("units shuffled across windows: %v", have)
+	}
+	reversed := newTestUnits(offsets, prices)
+	slices.Reverse(reversed)
+	policy.Order(reversed, common.Hash{})
+	if again := unitNonces(reversed); !slices.Equal(again, have) {
+		t.Errorf("shuffle not reproducible: have %v, want %v", again, have)
+	}
+}
+
+// Tests that random batches are shuffled by seed, and that adding a transaction
+// to a batch does not change the relative order of the others.
+func TestDeterministicShuffle(t *testing.T) {
+	var (
+		units = newTestUnits([]int64{0, 1, 2, 3, 4, 5, 6, 7}, []int64{1, 1, 1, 1, 1, 1, 1, 1})
+		seed  = common.Hash{0x01}
+	)
+	shuffled := slices.Clone(units)
+	deterministicShuffle(shuffled, seed)
+	order := unitNonces(shuffled)
+
+	other := slices.Clone(units)
+	deterministicShuffle(other, common.Hash{0x02})
+	if slices.Equal(unitNonces(other), order) {
+		t.Errorf("shuffle independent of seed: %v", order)
+	}
+	dusted := append(slices.Clone(units), newTestUnits([]int64{8}, []int64{1})...)
+	dusted[8].Txs[0] = types.NewTransaction(100, common.Address{0xdd}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	deterministicShuffle(dusted, seed)
+
+	have := slices.DeleteFunc(unitNonces(dusted), func(nonce uint64) bool { return nonce == 100 })
+	if !slices.Equal(have, order) {
+		t.Errorf("dust transaction reordered batch: have %v, want %v", have, order)
+	}
+}
+
+// Tests that headers sealed with the random batch policy must state the shuffle
+// seed drawn for their height, and others none.
+func TestBatchSeed(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		proposer = crypto.PubkeyToAddress(key.PublicKey)
+		engine   = newTestEngine(t, 32, proposer)
+		genesis  = &types.Header{Number: big.NewInt(0)}
+		chain    = &testHeaderChain{config: newTestChainConfig(engine.config), headers: []*types.Header{genesis}}
+	)
+	engine.Authorize(proposer, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	sign := func(seed *common.Hash) *types.Header {
+		header := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash(), Coinbase: proposer}
+		if err := engine.signStatement(header, nil, seed); err != nil {
+			t.Fatalf("failed to sign statement: %v", err)
+		}
+		return header
+	}
+	// Headers of other policies state no seed
+	if seed, err := engine.batchSeed(chain, sign(nil)); err != nil || seed != nil {
+		t.Fatalf("seed drawn for first-come-first-served ordering: %v, %v", seed, err)
+	}
+	drawn, err := engine.blockOrderingSeed(chain, 1, genesis)
+	if err != nil {
+		t.Fatalf("failed to draw seed: %v", err)
+	}
+	if err := engine.verifyBatchSeed(chain, sign(&drawn), genesis); !errors.Is(err, errUnexpectedBatchSeed) {
+		t.Errorf("unexpected seed error mismatch: have %v, want %v", err, errUnexpectedBatchSeed)
+	}
+	// Random batches require the drawn seed
+	engine.config.OrderingPolicy = params.EquaOrderingRandomBatch
+	engine.fairOrderer.policy = newOrderingPolicy(engine.config)
+
+	if seed, err := engine.batchSeed(chain, sign(nil)); err != nil || seed == nil || *seed != drawn {
+		t.Fatalf("batch seed mismatch: have %v (%v), want %x", seed, err, drawn)
+	}
+	tests := []struct {
+		seed *common.Hash
+		err  error
+	}{
+		{&drawn, nil},
+		{nil, errMissingBatchSeed},
+		{&common.Hash{0x01}, errInvalidBatchSeed},
+	}
+	for i, tt := range tests {
+		if err := engine.verifyBatchSeed(chain, sign(tt.seed), genesis); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if seed := statementSeed(sign(&drawn)); seed != drawn {
+		t.Errorf("stated seed mismatch: have %x, want %x", seed, drawn)
+	}
+}
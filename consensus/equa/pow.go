@@ -4,9 +4,10 @@
 package equa
 
 import (
-	"crypto/sha256"
 	"encoding/binary"
+	"math"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/equa/go-equa/common"
@@ -19,18 +20,19 @@ import (
 type LightPoW struct {
 	config *params.EquaConfig
 	target *big.Int
+
+	solver     string // Solver sealing blocks, see PoWSolvers
+	threads    int    // Threads the solver runs on
+	solverLock sync.RWMutex
 }
 
 // NewLightPoW creates a new lightweight PoW engine
 func NewLightPoW(config *params.EquaConfig) *LightPoW {
 	// Calculate target from difficulty
 	// target = 2^256 / difficulty
-	maxTarget := new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)
-	target := new(big.Int).Div(maxTarget, big.NewInt(int64(config.PoWDifficulty)))
-
 	return &LightPoW{
 		config: config,
-		target: target,
+		target: powTarget(config.PoWDifficulty),
 	}
 }
 
@@ -59,16 +61,25 @@ func (pow *LightPoW) GenerateChallenge(parentHash common.Hash, blockNumber *big.
 	return crypto.Keccak256Hash(data)
 }
 
-// Solve attempts to solve the PoW challenge
+// Solve attempts to solve the PoW challenge with the selected solver
 func (pow *LightPoW) Solve(header *types.Header, stop <-chan struct{}) (uint64, common.Hash, error) {
+	target := pow.headerTarget(header)
+	if solver, threads := pow.Solver(); solver == PoWSolverBatched {
+		return solveBatched(header.MixDigest, header.Coinbase, target, threads, stop)
+	}
+	return pow.solveGeneric(header, target, stop)
+}
+
+// solveGeneric searches the nonces for a solution on a single thread, hashing
+// them the way verification does
+func (pow *LightPoW) solveGeneric(header *types.Header, target *big.Int, stop <-chan struct{}) (uint64, common.Hash, error) {
 	challenge := header.MixDigest
 	nonce := uint64(0)
-	maxIterations := uint64(1000000) // Limit iterations to prevent DoS
 
-	for nonce < maxIterations {
+	for nonce < powMaxIterations {
 		select {
 		case <-stop:
-			return 0, common.Hash{}, errors.New("sealing stopped")
+			return 0, common.Hash{}, errPoWStopped
 		default:
 		}
 
@@ -77,14 +88,14 @@ func (pow *LightPoW) Solve(header *types.Header, stop <-chan struct{}) (uint64,
 		hashInt := new(big.Int).SetBytes(hash[:])
 
 		// Check if hash meets target
-		if hashInt.Cmp(pow.target) <= 0 {
+		if hashInt.Cmp(target) <= 0 {
 			return nonce, hash, nil
 		}
 
 		nonce++
 	}
 
-	return 0, common.Hash{}, errors.New("failed to find valid nonce")
+	return 0, common.Hash{}, errPoWExhausted
 }
 
 // Verify checks if a PoW solution is valid
@@ -100,7 +111,16 @@ func (pow *LightPoW) Verify(header *types.Header, parent *types.Header) bool {
 	hash := pow.calculateHash(header.MixDigest, header.Coinbase, nonce)
 	hashInt := new(big.Int).SetBytes(hash[:])
 
-	return hashInt.Cmp(pow.target) <= 0
+	return hashInt.Cmp(pow.headerTarget(header)) <= 0
+}
+
+// headerTarget returns the PoW target a header is sealed against: the one of
+// its own difficulty if retargeted, the configured one otherwise.
+func (pow *LightPoW) headerTarget(header *types.Header) *big.Int {
+	if pow.config.FeatureEnabled(FeatureDifficultyRetargeting) && header.Difficulty != nil && header.Difficulty.IsUint64() {
+		return powTarget(header.Difficulty.Uint64())
+	}
+	return pow.target
 }
 
 // calculateHash computes the hash for PoW verification
@@ -127,19 +147,28 @@ func (pow *LightPoW) SetDifficulty(difficulty uint64) {
 	pow.config.PoWDifficulty = difficulty
 
 	// Recalculate target
-	maxTarget := new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)
-	pow.target = new(big.Int).Div(maxTarget, big.NewInt(int64(difficulty)))
+	pow.target = powTarget(difficulty)
+}
+
+// powTarget returns the PoW target for a difficulty, target = 2^256 / difficulty.
+// A zero difficulty is treated as one.
+func powTarget(difficulty uint64) *big.Int {
+	if difficulty == 0 {
+		difficulty = 1
+	}
+	maxTarget := new(big.Int).Lsh(big.NewInt(1), 256)
+	return maxTarget.Div(maxTarget, new(big.Int).SetUint64(difficulty))
 }
 
 // EstimateSolveTime estimates time to solve PoW based on current difficulty
 func (pow *LightPoW) EstimateSolveTime() time.Duration {
 	// Rough estimate: difficulty / (hash_rate)
-	// Assuming ~1M hashes per second on average CPU
-	hashRate := float64(1000000) // 1M hashes/sec
-	expectedHashes := float64(pow.config.PoWDifficulty) / 2
-
-	seconds := expectedHashes / hashRate
-	return time.Duration(seconds * float64(time.Second))
+	// Assuming ~1M hashes per second on average CPU, i.e. 1 hash per microsecond
+	expectedHashes := pow.config.PoWDifficulty / 2
+	if expectedHashes > uint64(math.MaxInt64/int64(time.Microsecond)) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(expectedHashes) * time.Microsecond
 }
 
 // CalculateQuality calculates the quality of a PoW solution
@@ -156,40 +185,45 @@ func (pow *LightPoW) CalculateQuality(hash common.Hash) *big.Int {
 	return quality
 }
 
+// SolutionQuality returns the quality of the PoW solution sealed into a header.
+func (pow *LightPoW) SolutionQuality(header *types.Header) *big.Int {
+	hash := pow.calculateHash(header.MixDigest, header.Coinbase, header.Nonce.Uint64())
+	return pow.CalculateQuality(hash)
+}
+
 // AdjustDifficulty adjusts difficulty based on recent block times
 func (pow *LightPoW) AdjustDifficulty(recentBlocks []*types.Header, targetTime time.Duration) {
 	if len(recentBlocks) < 2 {
 		return
 	}
 
-	// Calculate average time between blocks
-	totalTime := int64(0)
-	for i := 1; i < len(recentBlocks); i++ {
-		timeDiff := int64(recentBlocks[i].Time - recentBlocks[i-1].Time)
-		totalTime += timeDiff
+	// Calculate the time spanned by the blocks, ignoring out of order timestamps
+	first, last := recentBlocks[0].Time, recentBlocks[len(recentBlocks)-1].Time
+	if last <= first || targetTime <= 0 {
+		return
 	}
-
-	avgTime := time.Duration(totalTime / int64(len(recentBlocks)-1)) * time.Second
-	targetTimeSeconds := targetTime.Seconds()
-	avgTimeSeconds := avgTime.Seconds()
+	elapsed := new(big.Int).Mul(new(big.Int).SetUint64(last-first), big.NewInt(int64(time.Second)))
 
 	// Adjust difficulty: if blocks too fast, increase difficulty
 	// if blocks too slow, decrease difficulty
-	adjustment := targetTimeSeconds / avgTimeSeconds
-
-	newDifficulty := float64(pow.config.PoWDifficulty) * adjustment
+	// newDifficulty = difficulty * targetTime / (elapsed / intervals)
+	current := new(big.Int).SetUint64(pow.config.PoWDifficulty)
+	newDifficulty := new(big.Int).Mul(current, big.NewInt(int64(targetTime)))
+	newDifficulty.Mul(newDifficulty, big.NewInt(int64(len(recentBlocks)-1)))
+	newDifficulty.Div(newDifficulty, elapsed)
 
 	// Limit adjustment to prevent wild swings
-	if adjustment > 1.5 {
-		newDifficulty = float64(pow.config.PoWDifficulty) * 1.5
-	} else if adjustment < 0.5 {
-		newDifficulty = float64(pow.config.PoWDifficulty) * 0.5
+	if upper := mulDiv(current, 3, 2); newDifficulty.Cmp(upper) > 0 {
+		newDifficulty = upper
+	} else if lower := mulDiv(current, 1, 2); newDifficulty.Cmp(lower) < 0 {
+		newDifficulty = lower
 	}
-
-	// Ensure minimum difficulty
-	if newDifficulty < 1000 {
-		newDifficulty = 1000
+	// Ensure minimum difficulty and that it remains representable
+	if newDifficulty.Cmp(big.NewInt(1000)) < 0 {
+		newDifficulty.SetUint64(1000)
 	}
-
-	pow.SetDifficulty(uint64(newDifficulty))
+	if !newDifficulty.IsUint64() {
+		newDifficulty.SetUint64(math.MaxUint64)
+	}
+	pow.SetDifficulty(newDifficulty.Uint64())
 }
\ No newline at end of file
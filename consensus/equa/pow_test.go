@@ -0,0 +1,153 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that the quality of a sealed PoW solution can be recomputed from the
+// header alone.
+func TestSolutionQuality(t *testing.T) {
+	pow := NewLightPoW(&params.EquaConfig{PoWDifficulty: 1000, Epoch: 100})
+
+	header := &types.Header{
+		Number:    big.NewInt(1),
+		Coinbase:  common.HexToAddress("0x1000000000000000000000000000000000000001"),
+		MixDigest: common.Hash{0x01},
+	}
+	nonce, _, err := pow.Solve(header, make(chan struct{}))
+	if err != nil {
+		t.Fatalf("failed to solve PoW: %v", err)
+	}
+	header.Nonce = types.EncodeNonce(nonce)
+
+	if quality := pow.SolutionQuality(header); quality.Sign() <= 0 {
+		t.Fatalf("valid solution has no quality: %v", quality)
+	}
+	header.Coinbase = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	if quality := pow.SolutionQuality(header); quality.Cmp(big.NewInt(1000)) > 0 {
+		t.Fatalf("solution quality not bound to proposer: %v", quality)
+	}
+}
+
+// Tests that the PoW difficulty is retargeted from the block times of the
+// retarget window, bounded around the window average, once enabled.
+func TestDifficultyRetargeting(t *testing.T) {
+	engine := New(newTestChainConfig(&params.EquaConfig{Period: 12, PoWDifficulty: 10000, RetargetWindow: 4}), rawdb.NewMemoryDatabase())
+
+	// newChain creates a chain of blocks of the configured difficulty, apart
+	// by the given number of seconds
+	newChain := func(blocks int, interval uint64) *testHeaderChain {
+		chain := &testHeaderChain{
+			config:  newTestChainConfig(engine.config),
+			headers: []*types.Header{{Number: big.NewInt(0), Difficulty: big.NewInt(10000)}},
+		}
+		for i := 1; i <= blocks; i++ {
+			parent := chain.headers[i-1]
+			chain.headers = append(chain.headers, &types.Header{
+				ParentHash: parent.Hash(),
+				Number:     big.NewInt(int64(i)),
+				Time:       parent.Time + interval,
+				Difficulty: big.NewInt(10000),
+			})
+		}
+		return chain
+	}
+	fast := newChain(4, 6)
+	if difficulty := engine.CalcDifficulty(fast, 0, fast.CurrentHeader()); difficulty.Uint64() != 10000 {
+		t.Errorf("difficulty retargeted while disabled: %v", difficulty)
+	}
+	engine.config.Features = map[string]bool{FeatureDifficultyRetargeting: true}
+
+	tests := []struct {
+		blocks   int
+		interval uint64
+		want     uint64
+	}{
+		{3, 6, 10000},  // Shorter than the window
+		{4, 12, 10000}, // On period
+		{4, 10, 12000}, // Fast blocks
+		{4, 6, 12500},  // Too fast, bounded by the maximum change
+		{8, 15, 8000},  // Slow blocks, only the last window counting
+		{4, 24, 7500},  // Too slow, bounded by the maximum change
+	}
+	for i, tt := range tests {
+		chain := newChain(tt.blocks, tt.interval)
+		parent := chain.CurrentHeader()
+		if difficulty := engine.CalcDifficulty(chain, 0, parent); difficulty.Uint64() != tt.want {
+			t.Errorf("test %d: difficulty mismatch: have %v, want %d", i, difficulty, tt.want)
+		}
+		header := &types.Header{ParentHash: parent.Hash(), Number: new(big.Int).Add(parent.Number, common.Big1), Difficulty: new(big.Int).SetUint64(tt.want)}
+		if err := engine.verifyDifficulty(chain, header, parent); err != nil {
+			t.Errorf("test %d: retargeted difficulty rejected: %v", i, err)
+		}
+		header.Difficulty = big.NewInt(10001)
+		if err := engine.verifyDifficulty(chain, header, parent); !errors.Is(err, errInvalidDifficulty) {
+			t.Errorf("test %d: wrong difficulty error mismatch: have %v, want %v", i, err, errInvalidDifficulty)
+		}
+	}
+	// Retargeting never goes below the minimum difficulty
+	engine.config.MinPoWDifficulty = 9000
+	slow := newChain(4, 48)
+	if difficulty := engine.CalcDifficulty(slow, 0, slow.CurrentHeader()); difficulty.Uint64() != 9000 {
+		t.Errorf("difficulty below minimum: %v", difficulty)
+	}
+}
+
+// Tests that every solver seals solutions meeting the target, hashed the way
+// verification does, and stops when sealing is aborted.
+func TestPoWSolvers(t *testing.T) {
+	pow := NewLightPoW(&params.EquaConfig{PoWDifficulty: 5000, Epoch: 100})
+	if err := pow.SetSolver("gpu", 1); !errors.Is(err, errUnknownSolver) {
+		t.Errorf("unknown solver error mismatch: have %v, want %v", err, errUnknownSolver)
+	}
+	header := &types.Header{
+		Number:   big.NewInt(1),
+		Coinbase: common.HexToAddress("0x1000000000000000000000000000000000000001"),
+	}
+	for _, solver := range PoWSolvers {
+		if err := pow.SetSolver(solver, 4); err != nil {
+			t.Fatalf("failed to select %s solver: %v", solver, err)
+		}
+		for i := byte(0); i < 8; i++ {
+			header.MixDigest = common.Hash{i}
+			nonce, hash, err := pow.Solve(header, make(chan struct{}))
+			if err != nil {
+				t.Fatalf("%s solver: failed to solve challenge %d: %v", solver, i, err)
+			}
+			if want := pow.calculateHash(header.MixDigest, header.Coinbase, nonce); hash != want {
+				t.Errorf("%s solver: hash mismatch: have %x, want %x", solver, hash, want)
+			}
+			if new(big.Int).SetBytes(hash[:]).Cmp(pow.target) > 0 {
+				t.Errorf("%s solver: solution %d misses the target", solver, nonce)
+			}
+		}
+		stop := make(chan struct{})
+		close(stop)
+		if _, _, err := pow.Solve(header, stop); !errors.Is(err, errPoWStopped) {
+			t.Errorf("%s solver: aborted sealing error mismatch: have %v, want %v", solver, err, errPoWStopped)
+		}
+	}
+}
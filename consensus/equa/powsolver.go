@@ -0,0 +1,185 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/crypto"
+)
+
+// The PoW hash is Keccak256 over the challenge, the proposer and the nonce. The
+// generic solver computes it the way verification does, allocating the input
+// and a big integer per nonce. The batched solver hashes a prebuilt input with
+// a reused Keccak state, compares the digest with the target bytes directly and
+// spreads batches of nonces over several threads, which is what makes the
+// difference on commodity CPUs. Both search the same nonces, so they accept the
+// same headers, but may seal different solutions.
+
+// PoW solvers selectable with LightPoW.SetSolver.
+const (
+	PoWSolverGeneric = "generic" // Single threaded, hashing like verification
+	PoWSolverBatched = "batched" // Multi-threaded, allocation-free batches of nonces
+)
+
+// PoWSolvers lists the available PoW solvers.
+var PoWSolvers = []string{PoWSolverGeneric, PoWSolverBatched}
+
+const (
+	powMaxIterations = 1000000 // Nonces searched at most, to bound the sealing time
+	powBatchSize     = 4096    // Nonces a solver thread searches between checks for abortion
+)
+
+var (
+	errPoWStopped     = errors.New("sealing stopped")
+	errPoWExhausted   = errors.New("failed to find valid nonce")
+	errUnknownSolver  = errors.New("unknown PoW solver")
+	errInvalidThreads = errors.New("invalid PoW solver thread count")
+)
+
+// SetSolver selects the solver used to seal blocks and the number of threads
+// it runs on, zero meaning one per CPU. The generic solver runs on one thread.
+func (pow *LightPoW) SetSolver(name string, threads int) error {
+	switch {
+	case name != PoWSolverGeneric && name != PoWSolverBatched:
+		return fmt.Errorf("%w: %q", errUnknownSolver, name)
+	case threads < 0:
+		return fmt.Errorf("%w: %d", errInvalidThreads, threads)
+	}
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+	pow.solverLock.Lock()
+	defer pow.solverLock.Unlock()
+
+	pow.solver, pow.threads = name, threads
+	return nil
+}
+
+// Solver returns the selected solver and the number of threads it runs on.
+func (pow *LightPoW) Solver() (string, int) {
+	pow.solverLock.RLock()
+	defer pow.solverLock.RUnlock()
+
+	if pow.solver == "" {
+		return PoWSolverGeneric, 1
+	}
+	return pow.solver, pow.threads
+}
+
+// UsePoWSolver selects the solver blocks are sealed with and the number of
+// threads it runs on, zero meaning one per CPU.
+func (e *Equa) UsePoWSolver(name string, threads int) error {
+	return e.powEngine.SetSolver(name, threads)
+}
+
+// powHasher computes PoW hashes of a challenge and proposer without allocating.
+type powHasher struct {
+	state crypto.KeccakState
+	input [common.HashLength + common.AddressLength + 8]byte
+}
+
+// newPoWHasher creates a hasher for the nonces of a challenge and proposer.
+func newPoWHasher(challenge common.Hash, proposer common.Address) *powHasher {
+	h := &powHasher{state: crypto.NewKeccakState()}
+	copy(h.input[:], challenge[:])
+	copy(h.input[common.HashLength:], proposer[:])
+	return h
+}
+
+// hash computes the PoW hash of a nonce into out.
+func (h *powHasher) hash(nonce uint64, out *common.Hash) {
+	binary.BigEndian.PutUint64(h.input[common.HashLength+common.AddressLength:], nonce)
+	h.state.Reset()
+	h.state.Write(h.input[:])
+	h.state.Read(out[:])
+}
+
+// solveBatched searches the nonces for a hash at or below the target on the
+// given number of threads, each taking batches of consecutive nonces.
+func solveBatched(challenge common.Hash, proposer common.Address, target *big.Int, threads int, stop <-chan struct{}) (uint64, common.Hash, error) {
+	// Compare digests with the target as bytes, a target beyond 256 bits is met
+	// by every hash
+	var limit common.Hash
+	if target.BitLen() > 256 {
+		limit = common.MaxHash
+	} else {
+		target.FillBytes(limit[:])
+	}
+	var (
+		next  atomic.Uint64
+		done  = make(chan struct{})
+		once  sync.Once
+		found struct {
+			nonce uint64
+			hash  common.Hash
+			ok    bool
+		}
+		wg sync.WaitGroup
+	)
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			hasher := newPoWHasher(challenge, proposer)
+			var hash common.Hash
+			for {
+				select {
+				case <-stop:
+					return
+				case <-done:
+					return
+				default:
+				}
+				first := next.Add(powBatchSize) - powBatchSize
+				if first >= powMaxIterations {
+					return
+				}
+				for nonce := first; nonce < min(first+powBatchSize, powMaxIterations); nonce++ {
+					hasher.hash(nonce, &hash)
+					if bytes.Compare(hash[:], limit[:]) <= 0 {
+						once.Do(func() {
+							found.nonce, found.hash, found.ok = nonce, hash, true
+							close(done)
+						})
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if found.ok {
+		return found.nonce, found.hash, nil
+	}
+	select {
+	case <-stop:
+		return 0, common.Hash{}, errPoWStopped
+	default:
+		return 0, common.Hash{}, errPoWExhausted
+	}
+}
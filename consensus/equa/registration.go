@@ -0,0 +1,123 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+)
+
+var (
+	errInvalidRegistrationSignature = errors.New("invalid validator registration signature")
+	errMissingRegistrationKey       = errors.New("validator registration has no public key")
+	errMissingRegistrationStake     = errors.New("validator registration has no stake")
+)
+
+// ValidatorRegistration is a message signed by a prospective validator of a new
+// network, requesting to be part of the initial validator set committed to in
+// the genesis.
+type ValidatorRegistration struct {
+	Validator common.Address `json:"validator"` // Account of the prospective validator
+	PublicKey hexutil.Bytes  `json:"publicKey"` // BLS public key of the validator
+	Stake     *hexutil.Big   `json:"stake"`     // Stake in wei allocated to the validator at genesis
+	Signature hexutil.Bytes  `json:"signature"` // Signature over SigHash by the validator's account key
+}
+
+// SigHash returns the hash signed by the validator.
+func (reg *ValidatorRegistration) SigHash() common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{reg.Validator, []byte(reg.PublicKey), reg.Stake.ToInt()})
+	return crypto.Keccak256Hash([]byte("equa-validator-registration"), enc)
+}
+
+// Sign signs the registration with the given key, which must belong to the
+// validator.
+func (reg *ValidatorRegistration) Sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(reg.SigHash().Bytes(), key)
+	if err != nil {
+		return err
+	}
+	reg.Signature = sig
+	return nil
+}
+
+// Verify checks that the registration is complete and was signed by the
+// validator it refers to.
+func (reg *ValidatorRegistration) Verify() error {
+	if len(reg.PublicKey) == 0 {
+		return errMissingRegistrationKey
+	}
+	if reg.Stake == nil || reg.Stake.ToInt().Sign() <= 0 {
+		return errMissingRegistrationStake
+	}
+	if len(reg.Signature) != crypto.SignatureLength {
+		return errInvalidRegistrationSignature
+	}
+	pubkey, err := crypto.SigToPub(reg.SigHash().Bytes(), reg.Signature)
+	if err != nil {
+		return errInvalidRegistrationSignature
+	}
+	if crypto.PubkeyToAddress(*pubkey) != reg.Validator {
+		return errInvalidRegistrationSignature
+	}
+	return nil
+}
+
+// InitialValidators verifies a set of registrations and converts them into the
+// initial validator set of a genesis configuration. The result is sorted by
+// address, so all participants of a ceremony derive the same set regardless of
+// the order they collected the registrations in.
+func InitialValidators(regs []*ValidatorRegistration) ([]params.EquaInitialValidator, error) {
+	validators := make([]params.EquaInitialValidator, 0, len(regs))
+	seen := make(map[common.Address]bool)
+	for _, reg := range regs {
+		if err := reg.Verify(); err != nil {
+			return nil, fmt.Errorf("registration of %s: %w", reg.Validator, err)
+		}
+		if seen[reg.Validator] {
+			return nil, fmt.Errorf("duplicate registration of %s", reg.Validator)
+		}
+		seen[reg.Validator] = true
+
+		validators = append(validators, params.EquaInitialValidator{
+			Address:   reg.Validator,
+			Stake:     new(big.Int).Set(reg.Stake.ToInt()),
+			PublicKey: common.CopyBytes(reg.PublicKey),
+		})
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i].Address[:], validators[j].Address[:]) < 0
+	})
+	return validators, nil
+}
+
+// ValidatorSetCommitment returns the hash committing to the initial validator
+// set and threshold key of a genesis configuration. It is stored in the extra
+// data of the genesis block, making the genesis hash depend on both.
+func ValidatorSetCommitment(config *params.EquaConfig) common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{config.InitialValidators, []byte(config.ThresholdPublicKey)})
+	return crypto.Keccak256Hash([]byte("equa-genesis-validators"), enc)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that validator registrations must be signed by the registering validator
+// and convert into an initial validator set independent of their order.
+func TestValidatorRegistration(t *testing.T) {
+	var (
+		keys  = make([]*ecdsa.PrivateKey, 3)
+		regs  = make([]*ValidatorRegistration, 3)
+		stake = new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18))
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		regs[i] = &ValidatorRegistration{
+			Validator: crypto.PubkeyToAddress(keys[i].PublicKey),
+			PublicKey: hexutil.Bytes{byte(i + 1)},
+			Stake:     (*hexutil.Big)(stake),
+		}
+		if err := regs[i].Sign(keys[i]); err != nil {
+			t.Fatalf("failed to sign registration: %v", err)
+		}
+	}
+	forged := *regs[0]
+	forged.Stake = (*hexutil.Big)(new(big.Int).Add(stake, big.NewInt(1)))
+	if err := forged.Verify(); !errors.Is(err, errInvalidRegistrationSignature) {
+		t.Fatalf("forged registration: have %v, want %v", err, errInvalidRegistrationSignature)
+	}
+	if _, err := InitialValidators([]*ValidatorRegistration{regs[0], regs[1], regs[0]}); err == nil {
+		t.Fatalf("duplicate registration accepted")
+	}
+	forward, err := InitialValidators(regs)
+	if err != nil {
+		t.Fatalf("failed to convert registrations: %v", err)
+	}
+	backward, err := InitialValidators([]*ValidatorRegistration{regs[2], regs[1], regs[0]})
+	if err != nil {
+		t.Fatalf("failed to convert registrations: %v", err)
+	}
+	var (
+		config    = &params.EquaConfig{PoWDifficulty: 1000, InitialValidators: forward, ThresholdPublicKey: hexutil.Bytes{0x01}}
+		reordered = &params.EquaConfig{PoWDifficulty: 1000, InitialValidators: backward, ThresholdPublicKey: hexutil.Bytes{0x01}}
+	)
+	if have, want := ValidatorSetCommitment(reordered), ValidatorSetCommitment(config); have != want {
+		t.Fatalf("commitment depends on registration order: have %x, want %x", have, want)
+	}
+	engine := New(newTestChainConfig(config), rawdb.NewMemoryDatabase())
+	for _, reg := range regs {
+		if !engine.stakeManager.IsEligible(reg.Validator) {
+			t.Errorf("initial validator %s not loaded", reg.Validator)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/tracing"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/params"
+)
+
+// The validator registry is kept in the state, so that every node derives the
+// same validators from the chain alone, across restarts, reorgs and snap syncs.
+// Deposits, activations and exits are recorded in the storage of
+// params.EquaValidatorsAddress while blocks are finalized, laid out like that of
+// a contract with:
+//
+//	address[] accounts;                          // slot 0
+//	mapping(address => Registration) entries;    // slot 1
+//	mapping(uint256 => bool) deposits;           // slot 2
+//	uint256 positions;                           // slot 3
+//	Proposer[] proposers;                        // slot 4
+//
+//	struct Registration {
+//		uint256 status;      // registrationQueued, registrationActive, ...
+//		uint256 stake;       // Stake, queued stake or unbonding stake
+//		uint256 slashed;     // Amount slashed in total
+//		uint256 epoch;       // Eligibility epoch if queued, exit epoch if exited
+//		uint256 position;    // Position in the activation queue if queued
+//		bytes32[2] key;      // BLS public key, left aligned
+//		uint256 keyLength;   // Length of the BLS public key
+//	}
+//
+//	struct Proposer {
+//		address validator;
+//		uint256 stake;
+//		uint256 weight;
+//	}
+//
+// The accounts list every validator ever registered, in registration order, the
+// deposits the indices of the deposits credited and positions the number of
+// validators ever queued for activation. The proposers are the validator set the
+// proposer schedule is drawn from, fixed at every epoch boundary so that it can
+// be read from the state of any block of the epoch. The registry of a chain holds
+// the initial validators of its configuration until first written to.
+var (
+	registryAccountsSlot  = common.Hash{}
+	registryEntriesSlot   = common.BigToHash(common.Big1)
+	registryDepositsSlot  = common.BigToHash(common.Big2)
+	registryPositionsSlot = common.BigToHash(common.Big3)
+	registryProposersSlot = common.BigToHash(big.NewInt(4))
+)
+
+// proposerFields is the number of storage slots of an entry of the proposers.
+const proposerFields = 3
+
+// Status of a validator in the registry.
+const (
+	registrationNone      = iota // Not registered, or removed from the staking contract
+	registrationQueued           // Awaiting activation
+	registrationActive           // In the validator set
+	registrationExited           // Exited, its stake unbonding
+	registrationWithdrawn        // Exited and withdrawn from the staking contract
+)
+
+// Fields of a registration, as offsets from its first storage slot.
+const (
+	registrationStatusField = iota
+	registrationStakeField
+	registrationSlashedField
+	registrationEpochField
+	registrationPositionField
+	registrationKeyField // Two slots
+	_
+	registrationKeyLengthField
+)
+
+// registration is the entry of a validator in the registry.
+type registration struct {
+	address  common.Address
+	status   uint64
+	stake    *big.Int
+	slashed  *big.Int
+	epoch    uint64
+	position uint64
+	key      []byte
+}
+
+// validatorRegistry reads and writes the validator registry kept in a state.
+type validatorRegistry struct {
+	state  vm.StateDB
+	config *params.EquaConfig
+}
+
+// newValidatorRegistry returns the validator registry kept in the given state.
+func newValidatorRegistry(state vm.StateDB, config *params.EquaConfig) *validatorRegistry {
+	return &validatorRegistry{state: state, config: config}
+}
+
+// arraySlot is the storage slot of the element at the given index of the array
+// whose length is kept in the given slot.
+func arraySlot(slot common.Hash, index uint64) common.Hash {
+	base := crypto.Keccak256Hash(slot[:]).Big()
+	return common.BigToHash(base.Add(base, new(big.Int).SetUint64(index)))
+}
+
+// registrationSlot is the storage slot of a field of a validator's registration.
+func registrationSlot(addr common.Address, field uint64) common.Hash {
+	base := crypto.Keccak256Hash(common.LeftPadBytes(addr[:], 32), registryEntriesSlot[:]).Big()
+	return common.BigToHash(base.Add(base, new(big.Int).SetUint64(field)))
+}
+
+// initialized reports whether the registry was written to, and no longer holds
+// the initial validators of the configuration only.
+func (r *validatorRegistry) initialized() bool {
+	return r.state.GetNonce(params.EquaValidatorsAddress) != 0
+}
+
+// initialize writes the initial validators of the configuration into the
+// registry, unless written to before. The registry is given a nonce, accounts
+// without one are deleted as empty regardless of their storage.
+func (r *validatorRegistry) initialize() {
+	if r.initialized() {
+		return
+	}
+	r.state.SetNonce(params.EquaValidatorsAddress, 1, tracing.NonceChangeUnspecified)
+	for _, validator := range r.config.InitialValidators {
+		r.put(&registration{
+			address: validator.Address,
+			status:  registrationActive,
+			stake:   new(big.Int).Set(validator.Stake),
+			slashed: new(big.Int),
+			key:     validator.PublicKey,
+		})
+	}
+	r.fixProposers()
+}
+
+// get returns the registration of a validator, with status registrationNone if
+// it never registered.
+func (r *validatorRegistry) get(addr common.Address) *registration {
+	reg := &registration{address: addr, stake: new(big.Int), slashed: new(big.Int)}
+	if !r.initialized() {
+		for _, validator := range r.config.InitialValidators {
+			if validator.Address == addr {
+				reg.status, reg.key = registrationActive, common.CopyBytes(validator.PublicKey)
+				reg.stake.Set(validator.Stake)
+			}
+		}
+		return reg
+	}
+	read := func(field uint64) common.Hash {
+		return r.state.GetState(params.EquaValidatorsAddress, registrationSlot(addr, field))
+	}
+	reg.status = read(registrationStatusField).Big().Uint64()
+	reg.stake = read(registrationStakeField).Big()
+	reg.slashed = read(registrationSlashedField).Big()
+	reg.epoch = read(registrationEpochField).Big().Uint64()
+	reg.position = read(registrationPositionField).Big().Uint64()
+
+	if length := read(registrationKeyLengthField).Big().Uint64(); length > 0 {
+		key := append(read(registrationKeyField).Bytes(), read(registrationKeyField+1).Bytes()...)
+		reg.key = key[:min(length, uint64(len(key)))]
+	}
+	return reg
+}
+
+// put writes the registration of a validator, adding it to the accounts if it
+// was never registered.
+func (r *validatorRegistry) put(reg *registration) {
+	r.initialize()
+
+	write := func(field uint64, value common.Hash) {
+		r.state.SetState(params.EquaValidatorsAddress, registrationSlot(reg.address, field), value)
+	}
+	if r.get(reg.address).status == registrationNone && reg.status != registrationNone {
+		length := r.state.GetState(params.EquaValidatorsAddress, registryAccountsSlot).Big().Uint64()
+		r.state.SetState(params.EquaValidatorsAddress, arraySlot(registryAccountsSlot, length), common.BytesToHash(reg.address[:]))
+		r.state.SetState(params.EquaValidatorsAddress, registryAccountsSlot, common.BigToHash(new(big.Int).SetUint64(length+1)))
+	}
+	write(registrationStatusField, common.BigToHash(new(big.Int).SetUint64(reg.status)))
+	write(registrationStakeField, common.BigToHash(reg.stake))
+	write(registrationSlashedField, common.BigToHash(reg.slashed))
+	write(registrationEpochField, common.BigToHash(new(big.Int).SetUint64(reg.epoch)))
+	write(registrationPositionField, common.BigToHash(new(big.Int).SetUint64(reg.position)))
+
+	var key [2 * common.HashLength]byte
+	length := copy(key[:], reg.key)
+	write(registrationKeyField, common.BytesToHash(key[:common.HashLength]))
+	write(registrationKeyField+1, common.BytesToHash(key[common.HashLength:]))
+	write(registrationKeyLengthField, common.BigToHash(big.NewInt(int64(length))))
+}
+
+// accounts returns every validator ever registered, in registration order.
+// Validators removed and registered again are listed once.
+func (r *validatorRegistry) accounts() []common.Address {
+	if !r.initialized() {
+		addrs := make([]common.Address, len(r.config.InitialValidators))
+		for i, validator := range r.config.InitialValidators {
+			addrs[i] = validator.Address
+		}
+		return addrs
+	}
+	var (
+		length = r.state.GetState(params.EquaValidatorsAddress, registryAccountsSlot).Big().Uint64()
+		seen   = make(map[common.Address]bool)
+		addrs  []common.Address
+	)
+	for i := uint64(0); i < length; i++ {
+		addr := common.BytesToAddress(r.state.GetState(params.EquaValidatorsAddress, arraySlot(registryAccountsSlot, i)).Bytes())
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// registrations returns the registrations of the given statuses, ordered by
+// address.
+func (r *validatorRegistry) registrations(statuses ...uint64) []*registration {
+	var regs []*registration
+	for _, addr := range r.accounts() {
+		reg := r.get(addr)
+		for _, status := range statuses {
+			if reg.status == status {
+				regs = append(regs, reg)
+				break
+			}
+		}
+	}
+	sort.Slice(regs, func(i, j int) bool {
+		return bytes.Compare(regs[i].address[:], regs[j].address[:]) < 0
+	})
+	return regs
+}
+
+// eligibleProposers returns the validator set proposers are drawn from: the
+// active validators that were not slashed and meet the minimum stake of the base
+// class, ordered by address and weighted by their share of the active stake,
+// capped as configured for their class.
+func (r *validatorRegistry) eligibleProposers() []*ValidatorSetEntry {
+	var (
+		active = r.registrations(registrationActive)
+		total  = new(big.Int)
+		set    []*ValidatorSetEntry
+	)
+	for _, reg := range active {
+		total.Add(total, reg.stake)
+	}
+	if total.Sign() == 0 {
+		return nil
+	}
+	for _, reg := range active {
+		if reg.slashed.Sign() > 0 || reg.stake.Cmp(baseClass(r.config).MinStake) < 0 {
+			continue
+		}
+		weight := new(big.Int).Mul(reg.stake, big.NewInt(10000))
+		weight.Div(weight, total)
+		if class := stakeClass(r.config, reg.stake); class.MaxWeight > 0 && weight.Uint64() > class.MaxWeight {
+			weight.SetUint64(class.MaxWeight)
+		}
+		if weight.Sign() == 0 {
+			continue
+		}
+		set = append(set, &ValidatorSetEntry{Address: reg.address, Stake: new(big.Int).Set(reg.stake), Weight: weight.Uint64()})
+	}
+	return set
+}
+
+// fixProposers records the validator set proposers are drawn from until the
+// next epoch boundary. Until the registry is written to, the proposers are the
+// initial validators and nothing needs to be recorded.
+func (r *validatorRegistry) fixProposers() {
+	if !r.initialized() {
+		return
+	}
+	var (
+		set    = r.eligibleProposers()
+		length = r.state.GetState(params.EquaValidatorsAddress, registryProposersSlot).Big().Uint64()
+	)
+	write := func(index uint64, value common.Hash) {
+		r.state.SetState(params.EquaValidatorsAddress, arraySlot(registryProposersSlot, index), value)
+	}
+	for i, entry := range set {
+		index := uint64(i) * proposerFields
+		write(index, common.BytesToHash(entry.Address[:]))
+		write(index+1, common.BigToHash(entry.Stake))
+		write(index+2, common.BigToHash(new(big.Int).SetUint64(entry.Weight)))
+	}
+	for index := uint64(len(set)) * proposerFields; index < length*proposerFields; index++ {
+		write(index, common.Hash{})
+	}
+	r.state.SetState(params.EquaValidatorsAddress, registryProposersSlot, common.BigToHash(new(big.Int).SetUint64(uint64(len(set)))))
+}
+
+// proposers returns the validator set proposers are drawn from, as fixed at the
+// last epoch boundary.
+func (r *validatorRegistry) proposers() []*ValidatorSetEntry {
+	if !r.initialized() {
+		return r.eligibleProposers()
+	}
+	var (
+		length = r.state.GetState(params.EquaValidatorsAddress, registryProposersSlot).Big().Uint64()
+		set    = make([]*ValidatorSetEntry, length)
+	)
+	read := func(index uint64) common.Hash {
+		return r.state.GetState(params.EquaValidatorsAddress, arraySlot(registryProposersSlot, index))
+	}
+	for i := range set {
+		index := uint64(i) * proposerFields
+		set[i] = &ValidatorSetEntry{
+			Address: common.BytesToAddress(read(index).Bytes()),
+			Stake:   read(index + 1).Big(),
+			Weight:  read(index + 2).Big().Uint64(),
+		}
+	}
+	return set
+}
+
+// stateAt returns the state with the given root, if the chain provides states.
+func stateAt(chain consensus.ChainHeaderReader, root common.Hash) (*state.StateDB, error) {
+	reader, ok := chain.(interface {
+		StateAt(root common.Hash) (*state.StateDB, error)
+	})
+	if !ok {
+		return nil, errStateUnavailable
+	}
+	statedb, err := reader.StateAt(root)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStateUnavailable, err)
+	}
+	return statedb, nil
+}
+
+// loadValidators loads the validators recorded in the state of the head block
+// into the stake manager, once after startup. Until then, and if the chain does
+// not provide the state, the stake manager holds the initial validators.
+func (e *Equa) loadValidators(chain consensus.ChainHeaderReader) {
+	if e.stakeManager.loaded() {
+		return
+	}
+	head := chain.CurrentHeader()
+	if head == nil {
+		return
+	}
+	statedb, err := stateAt(chain, head.Root)
+	if err != nil {
+		log.Debug("Validator registry unavailable", "number", head.Number, "err", err)
+		return
+	}
+	e.stakeManager.load(statedb, head.Hash())
+	log.Info("Loaded validator registry", "number", head.Number, "validators", len(e.stakeManager.GetValidators()))
+}
+
+// load replaces the validators, the activation queue, the pending exits and the
+// withdrawals with those recorded in the state of the block with the given hash.
+// What validators declared about themselves and the blocks they proposed last
+// are kept, being local to the node.
+func (sm *StakeManager) load(state vm.StateDB, hash common.Hash) {
+	var (
+		registry = newValidatorRegistry(state, sm.config)
+		exits    = queuedExits(state)
+	)
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	previous := sm.validators
+	sm.validators = make(map[common.Address]*Validator)
+	sm.totalStake = new(big.Int)
+	sm.queue = nil
+	sm.withdrawals = make(map[common.Address]*Withdrawal)
+
+	for _, reg := range registry.registrations(registrationActive, registrationQueued, registrationExited, registrationWithdrawn) {
+		switch reg.status {
+		case registrationActive:
+			validator := &Validator{
+				Address:     reg.address,
+				Stake:       reg.stake,
+				PublicKey:   reg.key,
+				Slashed:     reg.slashed.Sign() > 0,
+				SlashAmount: reg.slashed,
+				Withdrawal:  reg.address,
+			}
+			if prev, ok := previous[reg.address]; ok {
+				validator.LastBlock, validator.Filter, validator.Identity = prev.LastBlock, prev.Filter, prev.Identity
+			}
+			sm.validators[reg.address] = validator
+			sm.totalStake.Add(sm.totalStake, validator.Stake)
+
+		case registrationQueued:
+			sm.queue = append(sm.queue, &PendingValidator{
+				Address:          reg.address,
+				Stake:            reg.stake,
+				PublicKey:        reg.key,
+				EligibilityEpoch: reg.epoch,
+				position:         reg.position,
+			})
+
+		case registrationExited, registrationWithdrawn:
+			sm.withdrawals[reg.address] = &Withdrawal{
+				Validator:         reg.address,
+				Address:           reg.address,
+				Amount:            reg.stake,
+				ExitEpoch:         reg.epoch,
+				WithdrawableEpoch: reg.epoch + sm.config.UnbondingEpochs,
+				Withdrawn:         reg.status == registrationWithdrawn,
+			}
+		}
+	}
+	sort.SliceStable(sm.queue, func(i, j int) bool { return sm.queue[i].position < sm.queue[j].position })
+
+	sm.exits = make(map[common.Address]*VoluntaryExit, len(exits))
+	for _, exit := range exits {
+		sm.exits[exit.Validator] = exit
+	}
+	sm.head = hash
+}
+
+// loaded reports whether the stake manager was loaded from the state of a block.
+func (sm *StakeManager) loaded() bool {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	return sm.head != (common.Hash{})
+}
+
+// followed returns the block the stake manager was loaded from or followed up
+// to.
+func (sm *StakeManager) followed() common.Hash {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	return sm.head
+}
+
+// follow moves the stake manager on to a block extending the one it follows
+// without changing the validator registry.
+func (sm *StakeManager) follow(hash common.Hash) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sm.head = hash
+}
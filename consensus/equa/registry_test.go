@@ -0,0 +1,61 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+)
+
+// Tests that registrations are read back from the state as written, keys ending
+// in zero bytes included.
+func TestRegistrationRoundTrip(t *testing.T) {
+	engine := newTestEngine(t, 32, common.Address{0x01})
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	registry := newValidatorRegistry(statedb, engine.config)
+
+	key := bytes.Repeat([]byte{0xab}, 48)
+	key[47] = 0x00
+	want := &registration{
+		address:  common.Address{0x02},
+		status:   registrationQueued,
+		stake:    big.NewInt(32),
+		slashed:  big.NewInt(1),
+		epoch:    3,
+		position: 4,
+		key:      key,
+	}
+	registry.put(want)
+
+	have := registry.get(want.address)
+	if have.status != want.status || have.stake.Cmp(want.stake) != 0 || have.slashed.Cmp(want.slashed) != 0 || have.epoch != want.epoch || have.position != want.position {
+		t.Fatalf("registration mismatch: have %+v, want %+v", have, want)
+	}
+	if !bytes.Equal(have.key, key) {
+		t.Fatalf("key mismatch: have %x, want %x", have.key, key)
+	}
+	// Registrations without a key read back without one
+	registry.put(&registration{address: common.Address{0x03}, status: registrationQueued, stake: new(big.Int), slashed: new(big.Int)})
+	if have := registry.get(common.Address{0x03}); have.key != nil {
+		t.Fatalf("key of keyless registration: have %x", have.key)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/log"
+)
+
+// maxRewardEpochs is the number of epochs a reward query covers at most.
+const maxRewardEpochs = 64
+
+// Kinds of rewards credited when finalizing a block.
+const (
+	RewardBlock     = "block"     // Block reward of the proposer
+	RewardMEV       = "mev"       // Share of the MEV detected in the block paid to the proposer
+	RewardSmoothing = "smoothing" // Share of the smoothing pool paid to a member
+)
+
+var errInvalidRewardRange = errors.New("invalid epoch range")
+
+// RewardCredit is a reward credited to an account when finalizing a block.
+// Rewards of smoothing pool members are credited to the pool until shared.
+type RewardCredit struct {
+	Recipient common.Address `json:"recipient"`
+	Kind      string         `json:"kind"`
+	Amount    *big.Int       `json:"amount"`
+}
+
+// rewardKey is the database key of the rewards credited to an account in a
+// block.
+func rewardKey(recipient common.Address, number uint64, hash common.Hash) []byte {
+	key := make([]byte, 0, len(rawdb.EquaRewardPrefix)+common.AddressLength+8+common.HashLength)
+	key = append(key, rawdb.EquaRewardPrefix...)
+	key = append(key, recipient[:]...)
+	key = binary.BigEndian.AppendUint64(key, number)
+	return append(key, hash[:]...)
+}
+
+// recordRewards stores the rewards credited in a processed or sealed block into
+// the reward ledger, by recipient. The ledger is written along with the block
+// rather than once the block is followed, so that no block is missed across
+// restarts. Blocks that do not end up canonical keep their entries, they are
+// told apart from canonical ones by hash when queried.
+func (e *Equa) recordRewards(header *types.Header, credits []*RewardCredit) {
+	byRecipient := make(map[common.Address][]*RewardCredit)
+	for _, credit := range credits {
+		if credit.Amount.Sign() > 0 {
+			byRecipient[credit.Recipient] = append(byRecipient[credit.Recipient], credit)
+		}
+	}
+	var (
+		number = header.Number.Uint64()
+		hash   = header.Hash()
+		batch  = e.db.NewBatch()
+	)
+	for recipient, credits := range byRecipient {
+		blob, err := json.Marshal(credits)
+		if err != nil {
+			log.Error("Failed to encode rewards", "number", number, "recipient", recipient, "err", err)
+			return
+		}
+		if err := batch.Put(rewardKey(recipient, number, hash), blob); err != nil {
+			log.Error("Failed to store rewards", "number", number, "recipient", recipient, "err", err)
+			return
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to store rewards", "number", number, "hash", hash, "err", err)
+	}
+}
+
+// EpochRewards are the rewards credited to an account in the canonical blocks
+// of an epoch.
+type EpochRewards struct {
+	Epoch   uint64              `json:"epoch"`
+	Blocks  int                 `json:"blocks"`  // Blocks crediting the account
+	Rewards map[string]*big.Int `json:"rewards"` // Amounts credited by kind
+	Total   *big.Int            `json:"total"`
+}
+
+// ValidatorRewards are the rewards credited to an account over a range of
+// epochs, as recorded when finalizing the blocks. Blocks this node did not
+// execute, e.g. before a snap sync pivot, are not accounted for.
+type ValidatorRewards struct {
+	Validator common.Address  `json:"validator"`
+	FromEpoch uint64          `json:"fromEpoch"`
+	ToEpoch   uint64          `json:"toEpoch"`
+	Epochs    []*EpochRewards `json:"epochs"` // Epochs of the range crediting the account
+	Total     *big.Int        `json:"total"`
+}
+
+// validatorRewards sums up the rewards credited to an account in the canonical
+// blocks of an epoch range, including both ends.
+func (e *Equa) validatorRewards(chain consensus.ChainHeaderReader, validator common.Address, fromEpoch, toEpoch uint64) (*ValidatorRewards, error) {
+	if toEpoch < fromEpoch || toEpoch-fromEpoch >= maxRewardEpochs {
+		return nil, fmt.Errorf("%w %d-%d, at most %d epochs", errInvalidRewardRange, fromEpoch, toEpoch, maxRewardEpochs)
+	}
+	rewards := &ValidatorRewards{
+		Validator: validator,
+		FromEpoch: fromEpoch,
+		ToEpoch:   toEpoch,
+		Epochs:    []*EpochRewards{},
+		Total:     new(big.Int),
+	}
+	var (
+		prefix = append(append([]byte{}, rawdb.EquaRewardPrefix...), validator[:]...)
+		start  = binary.BigEndian.AppendUint64(nil, fromEpoch*e.config.Epoch)
+		end    = (toEpoch + 1) * e.config.Epoch
+	)
+	it := e.db.NewIterator(prefix, start)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()[len(prefix):]
+		if len(key) != 8+common.HashLength {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key)
+		if number >= end {
+			break
+		}
+		// Only blocks of the canonical chain count, others were reorged out
+		if header := chain.GetHeaderByNumber(number); header == nil || header.Hash() != common.BytesToHash(key[8:]) {
+			continue
+		}
+		var credits []*RewardCredit
+		if err := json.Unmarshal(it.Value(), &credits); err != nil {
+			log.Error("Invalid reward ledger entry", "number", number, "recipient", validator, "err", err)
+			continue
+		}
+		epoch := number / e.config.Epoch
+		if n := len(rewards.Epochs); n == 0 || rewards.Epochs[n-1].Epoch != epoch {
+			rewards.Epochs = append(rewards.Epochs, &EpochRewards{Epoch: epoch, Rewards: make(map[string]*big.Int), Total: new(big.Int)})
+		}
+		current := rewards.Epochs[len(rewards.Epochs)-1]
+		current.Blocks++
+		for _, credit := range credits {
+			if current.Rewards[credit.Kind] == nil {
+				current.Rewards[credit.Kind] = new(big.Int)
+			}
+			current.Rewards[credit.Kind].Add(current.Rewards[credit.Kind], credit.Amount)
+			current.Total.Add(current.Total, credit.Amount)
+			rewards.Total.Add(rewards.Total, credit.Amount)
+		}
+	}
+	return rewards, it.Error()
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that the rewards credited when finalizing blocks are recorded in the
+// ledger and summed up by epoch, counting canonical blocks only.
+func TestValidatorRewards(t *testing.T) {
+	var (
+		alice  = common.Address{0x01}
+		bob    = common.Address{0x02}
+		engine = newTestEngine(t, 32, alice, bob)
+		chain  = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+		}
+	)
+	engine.config.Epoch = 4
+	engine.config.ValidatorReward = 1000
+
+	// Rewards are recorded once the blocks are written as canonical. A block
+	// reorged out of the chain keeps its ledger entry, but doesn't count
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	chain.headers = append(chain.headers, &types.Header{Number: common.Big0})
+	engine.followChain(chain)
+
+	side := &types.Header{Number: big.NewInt(2), ParentHash: chain.headers[0].Hash(), Coinbase: alice, Difficulty: common.Big2}
+	for i := 1; i < 10; i++ {
+		coinbase := alice
+		if i%3 == 2 {
+			coinbase = bob
+		}
+		header := &types.Header{Number: big.NewInt(int64(i)), ParentHash: chain.CurrentHeader().Hash(), Coinbase: coinbase, Difficulty: common.Big1}
+		if i == 2 {
+			side.ParentHash = header.ParentHash
+			chain.headers = append(chain.headers, side)
+			engine.Finalize(chain, side, statedb, &types.Body{})
+			engine.followChain(chain)
+			chain.headers, chain.blocks[side.Hash()] = chain.headers[:i], types.NewBlockWithHeader(side)
+		}
+		chain.headers = append(chain.headers, header)
+		engine.Finalize(chain, header, statedb, &types.Body{})
+		engine.followChain(chain)
+	}
+	rewards, err := engine.validatorRewards(chain, alice, 0, 1)
+	if err != nil {
+		t.Fatalf("failed to query rewards: %v", err)
+	}
+	// Alice proposed blocks 1 and 3 of epoch 0 and blocks 4, 6 and 7 of epoch 1
+	blocks := []int{2, 3}
+	if len(rewards.Epochs) != len(blocks) {
+		t.Fatalf("epoch count mismatch: have %d, want %d", len(rewards.Epochs), len(blocks))
+	}
+	for i, epoch := range rewards.Epochs {
+		if epoch.Epoch != uint64(i) || epoch.Blocks != blocks[i] {
+			t.Errorf("epoch %d: have epoch %d with %d blocks, want %d blocks", i, epoch.Epoch, epoch.Blocks, blocks[i])
+		}
+		if have, want := epoch.Rewards[RewardBlock], int64(blocks[i]*1000); have == nil || have.Int64() != want {
+			t.Errorf("epoch %d: block reward mismatch: have %v, want %d", i, have, want)
+		}
+	}
+	if rewards.Total.Int64() != 5000 {
+		t.Errorf("total mismatch: have %v, want 5000", rewards.Total)
+	}
+	// Later epochs are out of range and the range is bounded
+	if rewards, err := engine.validatorRewards(chain, bob, 2, 2); err != nil || rewards.Total.Int64() != 1000 {
+		t.Errorf("epoch 2 rewards mismatch: have %v (%v), want 1000", rewards, err)
+	}
+	if _, err := engine.validatorRewards(chain, alice, 1, 0); !errors.Is(err, errInvalidRewardRange) {
+		t.Errorf("inverted range: have %v, want %v", err, errInvalidRewardRange)
+	}
+	if _, err := engine.validatorRewards(chain, alice, 0, maxRewardEpochs); !errors.Is(err, errInvalidRewardRange) {
+		t.Errorf("oversized range: have %v, want %v", err, errInvalidRewardRange)
+	}
+}
+
+// Tests that block rewards are scaled by the class of the proposer's stake as
+// registered in the state the block is finalized on, whatever the validators
+// the engine follows.
+func TestBlockRewardClass(t *testing.T) {
+	var (
+		ether    = big.NewInt(1e18)
+		proposer = common.Address{0x01}
+		engine   = newTestEngine(t, 32, proposer)
+	)
+	engine.config.ValidatorReward = 1000
+	engine.config.ValidatorClasses = []params.EquaValidatorClass{
+		{Name: "high", MinStake: new(big.Int).Mul(big.NewInt(1000), ether), RewardMultiplier: 150},
+		{Name: "standard", MinStake: new(big.Int).Mul(big.NewInt(32), ether)},
+	}
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	registry := newValidatorRegistry(statedb, engine.config)
+	reg := registry.get(proposer)
+	reg.stake = new(big.Int).Mul(big.NewInt(1000), ether)
+	registry.put(reg)
+
+	header := &types.Header{Number: big.NewInt(1), Coinbase: proposer}
+	if credit := engine.applyBlockRewards(header, statedb); credit.Amount.Int64() != 1500 {
+		t.Errorf("registered class reward mismatch: have %v, want 1500", credit.Amount)
+	}
+	if multiplier := engine.stakeManager.RewardMultiplier(proposer); multiplier != 100 {
+		t.Fatalf("engine followed the unwritten state: multiplier %d", multiplier)
+	}
+	header.Coinbase = common.Address{0x02}
+	if credit := engine.applyBlockRewards(header, statedb); credit.Amount.Int64() != 1000 {
+		t.Errorf("unregistered proposer reward mismatch: have %v, want 1000", credit.Amount)
+	}
+}
+
+// Tests that the rewards of imported blocks are recorded along with the blocks,
+// so that an engine restarted before following them still accounts for them.
+func TestValidatorRewardsRestart(t *testing.T) {
+	var (
+		validator = common.Address{0x01}
+		engine    = newTestEngine(t, 32, validator)
+		genesis   = &core.Genesis{Config: newTestChainConfig(engine.config)}
+	)
+	engine.config.ValidatorReward = 1000
+
+	schedule := firstTestSchedule(t, engine, genesis)
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, testImportEngine{engine}, 4, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(schedule.Proposer(uint64(i + 1)))
+	})
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), genesis, testImportEngine{engine}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	engine.loadValidators(chain)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	// Restart the engine on the same database before it follows the blocks
+	restarted := New(newTestChainConfig(engine.config), engine.db)
+
+	rewards, err := restarted.validatorRewards(chain, validator, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to query rewards: %v", err)
+	}
+	want := percentOf(big.NewInt(1000), classRewardMultiplier(engine.config, engine.config.InitialValidators[0].Stake))
+	want.Mul(want, big.NewInt(int64(len(blocks))))
+	if len(rewards.Epochs) != 1 || rewards.Epochs[0].Blocks != len(blocks) || rewards.Total.Cmp(want) != 0 {
+		t.Fatalf("rewards mismatch after restart: have %d epochs, total %v, want %d blocks, total %v", len(rewards.Epochs), rewards.Total, len(blocks), want)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+)
+
+const (
+	scheduleCacheLimit = 4     // Proposer schedules kept, covering the epochs around the head
+	boundaryCacheLimit = 16384 // Headers whose epoch boundary ancestor is remembered
+)
+
+var (
+	errNoProposers         = errors.New("no validators available")
+	errScheduleUnavailable = errors.New("proposer schedule unavailable")
+)
+
+// ProposerSchedule is the proposer of every block of an epoch. The validator set
+// proposers are drawn from is fixed in the state when an epoch boundary block is
+// processed, so a schedule covers the blocks following a boundary block up to
+// and including the next one. It is derived from that set and from the hash of
+// the boundary block, which are both fixed before the first block it covers, so
+// every node arrives at the same schedule and no proposer can grind the next
+// slot by varying its own block.
+type ProposerSchedule struct {
+	Epoch        uint64           `json:"epoch"`
+	Boundary     common.Hash      `json:"boundary"`     // Epoch boundary block the schedule is seeded with
+	Seed         common.Hash      `json:"seed"`         // Randomness the proposers are drawn with
+	First        uint64           `json:"first"`        // Number of the first block covered
+	Proposers    []common.Address `json:"proposers"`    // Proposer of each block, from the first one
+	ValidatorSet common.Hash      `json:"validatorSet"` // Commitment to the validator set the proposers are drawn from
+
+	validators []*ValidatorSetEntry // Validator set the proposers are drawn from, by address
+}
+
+// Proposer returns the scheduled proposer of a block, which must be covered by
+// the schedule.
+func (s *ProposerSchedule) Proposer(number uint64) common.Address {
+	return s.Proposers[number-s.First]
+}
+
+// scheduleEpoch returns the epoch whose proposer schedule covers a block.
+func scheduleEpoch(number, epochLength uint64) uint64 {
+	if number == 0 {
+		return 0
+	}
+	return (number - 1) / epochLength
+}
+
+// proposerSeed derives the randomness of the proposer schedule of an epoch from
+// the hash of its boundary block.
+func proposerSeed(boundary common.Hash, epoch uint64) common.Hash {
+	var number [8]byte
+	binary.BigEndian.PutUint64(number[:], epoch)
+	return crypto.Keccak256Hash([]byte("equa-proposer"), boundary.Bytes(), number[:])
+}
+
+// drawProposer draws the proposer of a slot from validators of the given
+// weights. As in compute_proposer_index of the Eth2 spec, candidates are drawn
+// uniformly and accepted with a probability proportional to their weight, which
+// makes the selection stake weighted without summing up the stakes.
+func drawProposer(seed common.Hash, slot uint64, weights []uint64, maxWeight uint64) int {
+	var buf [common.HashLength + 16]byte
+	copy(buf[:], seed[:])
+	binary.BigEndian.PutUint64(buf[common.HashLength:], slot)
+
+	for i := uint64(0); ; i++ {
+		binary.BigEndian.PutUint64(buf[common.HashLength+8:], i)
+		digest := crypto.Keccak256(buf[:])
+
+		candidate := binary.BigEndian.Uint64(digest[:8]) % uint64(len(weights))
+		if weights[candidate]*255 >= maxWeight*uint64(digest[8]) {
+			return int(candidate)
+		}
+	}
+}
+
+// drawSchedule draws the proposer schedule of an epoch of the given length,
+// seeded by the given boundary block, from a validator set ordered by address.
+func drawSchedule(epoch uint64, boundary common.Hash, length uint64, validators []*ValidatorSetEntry) (*ProposerSchedule, error) {
+	if len(validators) == 0 {
+		return nil, errNoProposers
+	}
+	var (
+		weights   = make([]uint64, len(validators))
+		maxWeight uint64
+	)
+	for i, validator := range validators {
+		weights[i] = validator.Weight
+		maxWeight = max(maxWeight, validator.Weight)
+	}
+	schedule := &ProposerSchedule{
+		Epoch:        epoch,
+		Boundary:     boundary,
+		Seed:         proposerSeed(boundary, epoch),
+		First:        epoch*length + 1,
+		Proposers:    make([]common.Address, length),
+		ValidatorSet: validatorSetHash(validators),
+		validators:   validators,
+	}
+	for slot := range schedule.Proposers {
+		schedule.Proposers[slot] = validators[drawProposer(schedule.Seed, uint64(slot), weights, maxWeight)].Address
+	}
+	return schedule, nil
+}
+
+// epochBoundary returns the hash of the epoch boundary block seeding the proposer
+// schedule of the child of parent, which is parent itself or one of its
+// ancestors. The boundaries found are remembered for the headers walked over, so
+// extending a chain only takes a single step back.
+func (e *Equa) epochBoundary(chain consensus.ChainHeaderReader, parent *types.Header) (common.Hash, error) {
+	var (
+		target   = scheduleEpoch(parent.Number.Uint64()+1, e.config.Epoch) * e.config.Epoch
+		header   = parent
+		visited  []common.Hash
+		boundary common.Hash
+	)
+	for {
+		hash := header.Hash()
+		if header.Number.Uint64() == target {
+			boundary = hash
+			break
+		}
+		if cached, ok := e.boundaries.Get(hash); ok {
+			boundary = cached
+			break
+		}
+		visited = append(visited, hash)
+		if header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return common.Hash{}, consensus.ErrUnknownAncestor
+		}
+	}
+	for _, hash := range visited {
+		e.boundaries.Add(hash, boundary)
+	}
+	return boundary, nil
+}
+
+// proposerSchedule returns the proposer schedule of an epoch seeded by the given
+// boundary block, drawing it from the proposers fixed in the state with the given
+// root if not done before. The root must be that of the boundary block or of a
+// later block of the epoch.
+func (e *Equa) proposerSchedule(chain consensus.ChainHeaderReader, epoch uint64, boundary common.Hash, root common.Hash) (*ProposerSchedule, error) {
+	if schedule, ok := e.schedules.Get(boundary); ok {
+		return schedule, nil
+	}
+	statedb, err := stateAt(chain, root)
+	if err != nil {
+		return nil, err
+	}
+	return e.stateSchedule(epoch, boundary, statedb)
+}
+
+// stateSchedule returns the proposer schedule of an epoch seeded by the given
+// boundary block, drawing it from the proposers fixed in the given state if not
+// done before. The state must be that of the boundary block or of a later block
+// of the epoch, before its finalization.
+func (e *Equa) stateSchedule(epoch uint64, boundary common.Hash, state vm.StateDB) (*ProposerSchedule, error) {
+	if schedule, ok := e.schedules.Get(boundary); ok {
+		return schedule, nil
+	}
+	schedule, err := drawSchedule(epoch, boundary, e.config.Epoch, newValidatorRegistry(state, e.config).proposers())
+	if err != nil {
+		return nil, err
+	}
+	// Keep the validator set around for the boundary block committing to it
+	if e.config.FeatureEnabled(FeatureValidatorSetCommits) {
+		if err := writeValidatorSet(e.db, schedule.ValidatorSet, schedule.validators); err != nil {
+			log.Error("Failed to store validator set", "epoch", epoch, "hash", schedule.ValidatorSet, "err", err)
+		}
+	}
+	e.schedules.Add(boundary, schedule)
+	return schedule, nil
+}
+
+// blockSchedule returns the proposer schedule covering the child of parent with
+// the given number, which needs the state of parent unless computed before.
+func (e *Equa) blockSchedule(chain consensus.ChainHeaderReader, number uint64, parent *types.Header) (*ProposerSchedule, error) {
+	boundary, err := e.epochBoundary(chain, parent)
+	if err != nil {
+		return nil, err
+	}
+	return e.proposerSchedule(chain, scheduleEpoch(number, e.config.Epoch), boundary, parent.Root)
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+)
+
+// Tests that proposer schedules are the same on every node, weighted by stake,
+// seeded by the epoch boundary block and fixed for the whole epoch.
+func TestProposerSchedule(t *testing.T) {
+	var (
+		small = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		large = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	newEngine := func() *Equa {
+		engine := newTestEngine(t, 32, small)
+		engine.config.Epoch = 1000
+		return engine
+	}
+	engine, other := newEngine(), newEngine()
+
+	// Register the large validator before the epoch boundary, then slash it
+	// within the epoch
+	chain := &testHeaderChain{config: newTestChainConfig(engine.config), states: state.NewDatabaseForTesting()}
+	statedb, _ := state.New(types.EmptyRootHash, chain.states)
+	registry := newValidatorRegistry(statedb, engine.config)
+	registry.put(&registration{address: large, status: registrationActive, stake: new(big.Int).Mul(big.NewInt(96), big.NewInt(1e18)), slashed: new(big.Int)})
+	registry.fixProposers()
+	boundaryRoot, _ := statedb.Commit(0, false, false)
+
+	statedb, _ = state.New(boundaryRoot, chain.states)
+	if _, err := newValidatorRegistry(statedb, engine.config).slash(large, 100); err != nil {
+		t.Fatalf("failed to slash: %v", err)
+	}
+	slashedRoot, _ := statedb.Commit(0, false, false)
+
+	for number := int64(0); number <= 1500; number++ {
+		header := &types.Header{Number: big.NewInt(number), Root: boundaryRoot}
+		if number > 0 {
+			header.ParentHash = chain.CurrentHeader().Hash()
+		}
+		if number >= 1200 {
+			header.Root = slashedRoot
+		}
+		chain.headers = append(chain.headers, header)
+	}
+	// Both engines agree on every proposer of the epoch
+	for number := uint64(1001); number <= 1500; number++ {
+		have, err := engine.selectProposer(chain, number, chain.headers[number-1])
+		if err != nil {
+			t.Fatalf("block %d: failed to select proposer: %v", number, err)
+		}
+		want, _ := other.selectProposer(chain, number, chain.headers[number-1])
+		if have != want {
+			t.Fatalf("block %d: proposer mismatch: have %s, want %s", number, have, want)
+		}
+	}
+	schedule, err := engine.proposerSchedule(chain, 1, chain.headers[1000].Hash(), chain.headers[1000].Root)
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	if schedule.First != 1001 || len(schedule.Proposers) != 1000 {
+		t.Fatalf("schedule range mismatch: first %d, %d proposers", schedule.First, len(schedule.Proposers))
+	}
+	// The validator with three times the stake proposes about three times as often
+	var slots int
+	for _, proposer := range schedule.Proposers {
+		if proposer == large {
+			slots++
+		}
+	}
+	if slots < 700 || slots > 800 {
+		t.Errorf("stake weighting off: large validator has %d of 1000 slots, want about 750", slots)
+	}
+	// Stake changes within the epoch leave the schedule alone, even for a node
+	// drawing it from the state of a later block of the epoch
+	if proposer, _ := newEngine().selectProposer(chain, 1400, chain.headers[1399]); proposer != schedule.Proposer(1400) {
+		t.Errorf("schedule changed within the epoch")
+	}
+	// A different boundary block seeds a different schedule
+	fork, _ := other.proposerSchedule(chain, 1, common.Hash{0x01}, boundaryRoot)
+	differs := false
+	for i := range fork.Proposers {
+		if fork.Proposers[i] != schedule.Proposers[i] {
+			differs = true
+			break
+		}
+	}
+	if !differs {
+		t.Errorf("schedule independent of the boundary block")
+	}
+	// Schedules are served while cached or while the state of their boundary
+	// block is available
+	api := &API{chain: chain, equa: engine}
+	if have, err := api.GetProposerSchedule(nil); err != nil || have != schedule {
+		t.Errorf("current schedule mismatch: %v", err)
+	}
+	epoch := uint64(0)
+	if have, err := api.GetProposerSchedule(&epoch); err != nil || have.First != 1 {
+		t.Errorf("past schedule unavailable: %v", err)
+	}
+	chain.headers[0].Root = common.Hash{0x01}
+	api.equa = newEngine()
+	if _, err := api.GetProposerSchedule(&epoch); err != errScheduleUnavailable {
+		t.Errorf("past schedule without state: have %v, want %v", err, errScheduleUnavailable)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/lru"
+	"github.com/equa/go-equa/core/types"
+)
+
+// senderCacheLimit is the number of transaction senders remembered by the
+// engine, a few blocks' worth of transactions along with the pool's inclusion
+// list candidates.
+const senderCacheLimit = 16384
+
+// cachingSigner is a signer remembering the senders it recovered by transaction
+// hash. Transactions cache their sender themselves, but the engine recovers
+// senders of many transactions decoded anew, inclusion lists of parent headers
+// and blocks read back for the API among them; sharing one cachingSigner
+// between the engine components recovers each sender once.
+type cachingSigner struct {
+	types.Signer
+	senders *lru.Cache[common.Hash, common.Address]
+}
+
+// newCachingSigner wraps a signer with a sender cache of the given size.
+func newCachingSigner(signer types.Signer, size int) *cachingSigner {
+	return &cachingSigner{
+		Signer:  signer,
+		senders: lru.NewCache[common.Hash, common.Address](size),
+	}
+}
+
+// Sender returns the sender of a transaction, recovering it only if unknown.
+// The hash of a transaction covers its signature, so a cached sender can only
+// belong to the transaction it is found by.
+func (s *cachingSigner) Sender(tx *types.Transaction) (common.Address, error) {
+	hash := tx.Hash()
+	if from, ok := s.senders.Get(hash); ok {
+		return from, nil
+	}
+	from, err := s.Signer.Sender(tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	s.senders.Add(hash, from)
+	return from, nil
+}
+
+// Equal returns true if the given signer is the same as the wrapped one, so
+// that senders cached in transactions by either are reused by the other.
+func (s *cachingSigner) Equal(other types.Signer) bool {
+	if cs, ok := other.(*cachingSigner); ok {
+		other = cs.Signer
+	}
+	return s.Signer.Equal(other)
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/crypto"
+)
+
+// shuffleRounds is the number of swap-or-not rounds, as in the Eth2 spec.
+const shuffleRounds = 90
+
+var (
+	errNotInValidatorSet  = errors.New("validator not in active set")
+	errInvalidShuffleSeed = errors.New("shuffle seed does not match epoch randomness")
+	errInvalidShuffle     = errors.New("shuffle proof does not match assignment")
+)
+
+// ShuffleProof is the committee assignment of a validator in an epoch, along
+// with everything needed to check it. Verifying a proof only re-evaluates the
+// swap-or-not network for a single index instead of shuffling the whole set.
+type ShuffleProof struct {
+	Validator common.Address `json:"validator"` // Assigned validator
+	Epoch     uint64         `json:"epoch"`     // Epoch of the assignment
+	Seed      common.Hash    `json:"seed"`      // Epoch randomness the shuffle is seeded with
+	Index     uint64         `json:"index"`     // Position of the validator in the address-sorted active set
+	Count     uint64         `json:"count"`     // Size of the active set
+	Position  uint64         `json:"position"`  // Position of the validator after shuffling
+	Committee uint64         `json:"committee"` // Committee the position falls into
+}
+
+// shuffleSeed derives the shuffling randomness of an epoch from the hash of the
+// last block before it, which is fixed once the epoch starts.
+func shuffleSeed(boundary common.Hash, epoch uint64) common.Hash {
+	var number [8]byte
+	binary.BigEndian.PutUint64(number[:], epoch)
+	return crypto.Keccak256Hash([]byte("equa-shuffle"), boundary.Bytes(), number[:])
+}
+
+// shuffleBoundary returns the number of the block whose hash seeds the shuffle
+// of an epoch. Epoch zero is seeded by the genesis block.
+func shuffleBoundary(epoch, epochLength uint64) uint64 {
+	if epoch == 0 {
+		return 0
+	}
+	return epoch*epochLength - 1
+}
+
+// computeShuffledIndex returns the position of index in the swap-or-not shuffle
+// of count elements, following compute_shuffled_index of the Eth2 spec.
+func computeShuffledIndex(index, count uint64, seed common.Hash) uint64 {
+	if index >= count {
+		panic(fmt.Sprintf("equa: shuffle index %d out of range %d", index, count))
+	}
+	buf := make([]byte, 0, common.HashLength+1+4)
+	for round := 0; round < shuffleRounds; round++ {
+		buf = append(append(buf[:0], seed[:]...), byte(round))
+		digest := sha256.Sum256(buf)
+		pivot := binary.LittleEndian.Uint64(digest[:8]) % count
+
+		flip := (pivot + count - index) % count
+		position := max(index, flip)
+
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(position/256))
+		source := sha256.Sum256(buf)
+		if (source[(position%256)/8]>>(position%8))&1 == 1 {
+			index = flip
+		}
+	}
+	return index
+}
+
+// committeeOf returns the committee a shuffled position falls into when count
+// validators are split into committees of near equal size.
+func committeeOf(position, count, committees uint64) uint64 {
+	return position * committees / count
+}
+
+// sortedValidators returns the addresses of the active validators in ascending
+// order, which is the order the shuffle permutes.
+func (sm *StakeManager) sortedValidators() []common.Address {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	return sm.validatorAddresses()
+}
+
+// validatorAddresses returns the addresses of the active validators in
+// ascending order, the lock being held.
+func (sm *StakeManager) validatorAddresses() []common.Address {
+	validators := sm.activeValidators()
+	addrs := make([]common.Address, len(validators))
+	for i, validator := range validators {
+		addrs[i] = validator.Address
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+	return addrs
+}
+
+// ProveShuffle computes the committee assignment of a validator in the active
+// set for the given epoch seed.
+func (e *Equa) ProveShuffle(validator common.Address, epoch uint64, seed common.Hash) (*ShuffleProof, error) {
+	addrs := e.stakeManager.sortedValidators()
+	index := sort.Search(len(addrs), func(i int) bool {
+		return bytes.Compare(addrs[i][:], validator[:]) >= 0
+	})
+	if index == len(addrs) || addrs[index] != validator {
+		return nil, errNotInValidatorSet
+	}
+	count := uint64(len(addrs))
+	position := computeShuffledIndex(uint64(index), count, seed)
+
+	return &ShuffleProof{
+		Validator: validator,
+		Epoch:     epoch,
+		Seed:      seed,
+		Index:     uint64(index),
+		Count:     count,
+		Position:  position,
+		Committee: committeeOf(position, count, e.config.Committees),
+	}, nil
+}
+
+// VerifyShuffleProof checks that the position and committee claimed by a proof
+// follow from its seed, index and set size. The caller is responsible for
+// checking the seed and the validator's index against its own chain.
+func VerifyShuffleProof(proof *ShuffleProof, committees uint64) error {
+	if proof.Index >= proof.Count {
+		return fmt.Errorf("%w: index %d out of range %d", errInvalidShuffle, proof.Index, proof.Count)
+	}
+	position := computeShuffledIndex(proof.Index, proof.Count, proof.Seed)
+	if position != proof.Position {
+		return fmt.Errorf("%w: position %d, want %d", errInvalidShuffle, proof.Position, position)
+	}
+	if committee := committeeOf(position, proof.Count, committees); committee != proof.Committee {
+		return fmt.Errorf("%w: committee %d, want %d", errInvalidShuffle, proof.Committee, committee)
+	}
+	return nil
+}
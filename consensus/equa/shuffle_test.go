@@ -0,0 +1,99 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that the swap-or-not shuffle is a permutation for a range of set sizes.
+func TestShufflePermutation(t *testing.T) {
+	seed := crypto.Keccak256Hash([]byte("seed"))
+	for _, count := range []uint64{1, 2, 3, 7, 100, 257, 1000} {
+		seen := make(map[uint64]bool)
+		for i := uint64(0); i < count; i++ {
+			position := computeShuffledIndex(i, count, seed)
+			if position >= count {
+				t.Fatalf("count %d: index %d shuffled out of range: %d", count, i, position)
+			}
+			if seen[position] {
+				t.Fatalf("count %d: position %d assigned twice", count, position)
+			}
+			seen[position] = true
+		}
+	}
+	// Different seeds should yield different permutations
+	other := crypto.Keccak256Hash([]byte("other"))
+	same := true
+	for i := uint64(0); i < 100; i++ {
+		if computeShuffledIndex(i, 100, seed) != computeShuffledIndex(i, 100, other) {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Error("shuffle does not depend on the seed")
+	}
+}
+
+// Tests that shuffle proofs for every validator verify and that tampered proofs
+// are rejected.
+func TestShuffleProof(t *testing.T) {
+	var validators []common.Address
+	for i := 0; i < 20; i++ {
+		validators = append(validators, common.BytesToAddress([]byte{byte(i + 1)}))
+	}
+	engine := newTestEngine(t, 32, validators...)
+	seed := shuffleSeed(common.HexToHash("0x01"), 3)
+
+	sizes := make(map[uint64]int)
+	for _, validator := range validators {
+		proof, err := engine.ProveShuffle(validator, 3, seed)
+		if err != nil {
+			t.Fatalf("failed to prove %x: %v", validator, err)
+		}
+		if err := VerifyShuffleProof(proof, engine.config.Committees); err != nil {
+			t.Fatalf("valid proof of %x rejected: %v", validator, err)
+		}
+		sizes[proof.Committee]++
+	}
+	for committee := uint64(0); committee < engine.config.Committees; committee++ {
+		if sizes[committee] != len(validators)/int(engine.config.Committees) {
+			t.Errorf("committee %d: size mismatch: have %d", committee, sizes[committee])
+		}
+	}
+	proof, _ := engine.ProveShuffle(validators[0], 3, seed)
+	for name, tamper := range map[string]func(p *ShuffleProof){
+		"position":  func(p *ShuffleProof) { p.Position = (p.Position + 1) % p.Count },
+		"committee": func(p *ShuffleProof) { p.Committee++ },
+		"seed":      func(p *ShuffleProof) { p.Seed = common.Hash{} },
+		"index":     func(p *ShuffleProof) { p.Index = p.Count },
+	} {
+		tampered := *proof
+		tamper(&tampered)
+		if err := VerifyShuffleProof(&tampered, engine.config.Committees); !errors.Is(err, errInvalidShuffle) {
+			t.Errorf("%s: tampered proof error mismatch: have %v", name, err)
+		}
+	}
+	if _, err := engine.ProveShuffle(common.HexToAddress("0xff"), 3, seed); err != errNotInValidatorSet {
+		t.Errorf("unknown validator error mismatch: have %v", err)
+	}
+}
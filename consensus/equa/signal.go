@@ -0,0 +1,136 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/version"
+)
+
+const versionSignalLength = 16 // Magic (4), version (4) and feature bitfield (8)
+
+// versionSignalMagic marks a version signal trailing the extra-data of a header.
+var versionSignalMagic = []byte("eqvs")
+
+// VersionSignal is the software version and feature readiness a proposer
+// announces in the extra-data of its blocks, so coordinated upgrades can track
+// how much of the network runs a release supporting a pending fork.
+type VersionSignal struct {
+	Version  uint32 // Release of the proposer, major<<16 | minor<<8 | patch
+	Features uint64 // Bit i is set if the release supports params.EquaFeatures[i]
+}
+
+// localVersionSignal returns the signal of the running release.
+func localVersionSignal() *VersionSignal {
+	signal := &VersionSignal{Version: uint32(version.Major<<16 | version.Minor<<8 | version.Patch)}
+	for i := range params.EquaFeatures {
+		if i < 64 {
+			signal.Features |= 1 << i
+		}
+	}
+	return signal
+}
+
+// String returns the release of the signal in dotted form.
+func (s *VersionSignal) String() string {
+	return fmt.Sprintf("%d.%d.%d", s.Version>>16, s.Version>>8&0xff, s.Version&0xff)
+}
+
+// encode returns the signal in its extra-data trailer layout.
+func (s *VersionSignal) encode() []byte {
+	enc := make([]byte, versionSignalLength)
+	copy(enc, versionSignalMagic)
+	binary.BigEndian.PutUint32(enc[4:], s.Version)
+	binary.BigEndian.PutUint64(enc[8:], s.Features)
+	return enc
+}
+
+// splitVersionSignal separates a version signal trailer from the rest of the
+// extra-data, returning a nil signal if there is none.
+func splitVersionSignal(extra []byte) ([]byte, *VersionSignal) {
+	if len(extra) < versionSignalLength {
+		return extra, nil
+	}
+	rest, trailer := extra[:len(extra)-versionSignalLength], extra[len(extra)-versionSignalLength:]
+	if !bytes.Equal(trailer[:4], versionSignalMagic) {
+		return extra, nil
+	}
+	return rest, &VersionSignal{
+		Version:  binary.BigEndian.Uint32(trailer[4:]),
+		Features: binary.BigEndian.Uint64(trailer[8:]),
+	}
+}
+
+// FeatureReadiness is the share of an epoch's blocks signaling support for a
+// feature.
+type FeatureReadiness struct {
+	Feature string  `json:"feature"`
+	Enabled bool    `json:"enabled"` // Whether the feature is enabled locally
+	Ready   float64 `json:"ready"`   // Percentage of blocks signaling support
+}
+
+// VersionReport aggregates the version signals of the blocks of an epoch.
+type VersionReport struct {
+	Epoch     uint64             `json:"epoch"`
+	First     uint64             `json:"first"` // First block aggregated
+	Last      uint64             `json:"last"`  // Last block aggregated
+	Blocks    int                `json:"blocks"`
+	Signaling int                `json:"signaling"` // Blocks carrying a version signal
+	Versions  map[string]int     `json:"versions"`  // Signaling blocks per release
+	Readiness []FeatureReadiness `json:"readiness"`
+}
+
+// aggregateVersionSignals builds the version report of the given headers of an
+// epoch. Blocks without a signal count as not ready for any feature.
+func aggregateVersionSignals(config *params.EquaConfig, epoch uint64, headers []*types.Header) *VersionReport {
+	report := &VersionReport{
+		Epoch:    epoch,
+		Blocks:   len(headers),
+		Versions: make(map[string]int),
+	}
+	if len(headers) > 0 {
+		report.First = headers[0].Number.Uint64()
+		report.Last = headers[len(headers)-1].Number.Uint64()
+	}
+	ready := make([]int, len(params.EquaFeatures))
+	for _, header := range headers {
+		_, signal := splitVersionSignal(header.Extra)
+		if signal == nil {
+			continue
+		}
+		report.Signaling++
+		report.Versions[signal.String()]++
+		for i := range ready {
+			if i < 64 && signal.Features&(1<<i) != 0 {
+				ready[i]++
+			}
+		}
+	}
+	for i, feature := range params.EquaFeatures {
+		readiness := FeatureReadiness{Feature: feature.Name, Enabled: config.FeatureEnabled(feature.Name)}
+		if report.Blocks > 0 {
+			readiness.Ready = 100 * float64(ready[i]) / float64(report.Blocks)
+		}
+		report.Readiness = append(report.Readiness, readiness)
+	}
+	return report
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that version signals round-trip through the extra-data trailer and that
+// extra-data without a signal is left untouched.
+func TestVersionSignalEncoding(t *testing.T) {
+	signal := &VersionSignal{Version: 1<<16 | 17<<8 | 2, Features: 0b101}
+	extra := append([]byte("statement"), signal.encode()...)
+
+	rest, decoded := splitVersionSignal(extra)
+	if string(rest) != "statement" || decoded == nil || *decoded != *signal {
+		t.Fatalf("signal mismatch: have %q %v, want %q %v", rest, decoded, "statement", signal)
+	}
+	if decoded.String() != "1.17.2" {
+		t.Errorf("version mismatch: have %s, want 1.17.2", decoded)
+	}
+	for _, extra := range [][]byte{nil, []byte("statement"), make([]byte, versionSignalLength)} {
+		if rest, signal := splitVersionSignal(extra); signal != nil || len(rest) != len(extra) {
+			t.Errorf("signal found in %x", extra)
+		}
+	}
+}
+
+// Tests that readiness is reported as the share of all blocks of the epoch
+// signaling a feature, counting blocks without signal as not ready.
+func TestVersionSignalAggregation(t *testing.T) {
+	var (
+		old     = &VersionSignal{Version: 1 << 16, Features: 0b1}
+		current = localVersionSignal()
+		headers []*types.Header
+	)
+	for i, signal := range []*VersionSignal{current, current, old, nil} {
+		header := &types.Header{Number: big.NewInt(int64(100 + i))}
+		if signal != nil {
+			header.Extra = signal.encode()
+		}
+		headers = append(headers, header)
+	}
+	report := aggregateVersionSignals(&params.EquaConfig{}, 1, headers)
+	if report.First != 100 || report.Last != 103 || report.Blocks != 4 || report.Signaling != 3 {
+		t.Fatalf("report mismatch: have %+v", report)
+	}
+	if report.Versions[current.String()] != 2 || report.Versions["1.0.0"] != 1 {
+		t.Errorf("version counts mismatch: have %v", report.Versions)
+	}
+	for i, readiness := range report.Readiness {
+		want := 50.0
+		if i == 0 {
+			want = 75
+		}
+		if readiness.Ready != want {
+			t.Errorf("feature %s readiness mismatch: have %v, want %v", readiness.Feature, readiness.Ready, want)
+		}
+	}
+}
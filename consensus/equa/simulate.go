@@ -0,0 +1,187 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/types"
+)
+
+// maxSimulatedTxs is the number of transactions an ordering simulation accepts
+// at most, as fairness scores are computed over every pair of them.
+const maxSimulatedTxs = 1024
+
+var (
+	errNoSimulatedTxs       = errors.New("no transactions to simulate")
+	errTooManySimulatedTxs  = errors.New("too many transactions to simulate")
+	errDuplicateSimulatedTx = errors.New("duplicate transaction")
+)
+
+// MEV risk of a transaction by the pattern it was found in. Without receipts
+// profits cannot be estimated, so the risk only reflects how telling the
+// pattern is: a sandwich is unambiguous, a liquidation may well be benign.
+var mevRiskScores = map[string]float64{
+	MEVSandwich:    1.0,
+	MEVFrontrun:    0.75,
+	MEVLiquidation: 0.5,
+}
+
+// OrderingSimulation previews how the fair orderer would order a set of
+// transactions, without executing them or touching the chain state.
+type OrderingSimulation struct {
+	Order         []common.Hash           `json:"order"`         // Transactions in fair order
+	OrderingScore float64                 `json:"orderingScore"` // Fraction of adjacent pairs of the submitted order in arrival order
+	Transactions  []*SimulatedTransaction `json:"transactions"`  // Per transaction results, in submitted order
+	Sandwiches    []*SandwichSeparation   `json:"sandwiches"`    // Sandwiches found in the submitted order
+}
+
+// SimulatedTransaction is the outcome of an ordering simulation for a single
+// transaction.
+type SimulatedTransaction struct {
+	Hash     common.Hash     `json:"hash"`
+	Index    int             `json:"index"`             // Position in the submitted order
+	Position int             `json:"position"`          // Position in the fair order
+	Arrival  *hexutil.Uint64 `json:"arrival,omitempty"` // Arrival time in unix milliseconds, if known
+
+	// FairnessScore is the fraction of the other transactions of known arrival
+	// the transaction is submitted in arrival order with. Transactions of
+	// unknown arrival cannot be judged and score one.
+	FairnessScore float64 `json:"fairnessScore"`
+
+	MEVRisk     float64  `json:"mevRisk"`               // Risk of extracting MEV between zero and one
+	MEVPatterns []string `json:"mevPatterns,omitempty"` // MEV categories the transaction matched
+}
+
+// SandwichSeparation is a sandwich found in the submitted order, reporting
+// whether fair ordering broke it up.
+type SandwichSeparation struct {
+	Frontrun  common.Hash `json:"frontrun"`
+	Victim    common.Hash `json:"victim"`
+	Backrun   common.Hash `json:"backrun"`
+	Separated bool        `json:"separated"` // Whether the victim is no longer wrapped in the fair order
+}
+
+// SimulateOrdering orders the given transactions fairly and runs the ordering
+// and MEV checks on them. MEV patterns are matched in the submitted order with
+// the local rules, structurally since the transactions are not executed. The
+// transactions are priced for the given base fee, nil if unknown, and shuffled
+// with the given seed if the ordering policy does so.
+func (e *Equa) SimulateOrdering(encs []hexutil.Bytes, baseFee *big.Int, seed common.Hash) (*OrderingSimulation, error) {
+	switch {
+	case len(encs) == 0:
+		return nil, errNoSimulatedTxs
+	case len(encs) > maxSimulatedTxs:
+		return nil, fmt.Errorf("%w: have %d, max %d", errTooManySimulatedTxs, len(encs), maxSimulatedTxs)
+	}
+	txs, err := decodeTransactions(encs)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[common.Hash]int, len(txs))
+	for i, tx := range txs {
+		if _, ok := index[tx.Hash()]; ok {
+			return nil, fmt.Errorf("%w %x", errDuplicateSimulatedTx, tx.Hash())
+		}
+		index[tx.Hash()] = i
+	}
+	ordered := e.fairOrderer.OrderTransactions(txs, baseFee, seed)
+
+	sim := &OrderingSimulation{
+		Order:         make([]common.Hash, len(ordered)),
+		OrderingScore: e.fairOrderer.GetOrderingScore(txs),
+		Transactions:  make([]*SimulatedTransaction, len(txs)),
+	}
+	position := make(map[common.Hash]int, len(ordered))
+	for i, tx := range ordered {
+		sim.Order[i] = tx.Hash()
+		position[tx.Hash()] = i
+	}
+	for i, tx := range txs {
+		sim.Transactions[i] = &SimulatedTransaction{
+			Hash:          tx.Hash(),
+			Index:         i,
+			Position:      position[tx.Hash()],
+			FairnessScore: 1,
+		}
+	}
+	e.scoreFairness(txs, sim.Transactions)
+
+	// Match the MEV patterns the detector can recognize without receipts
+	rules := e.mevDetector.Rules()
+	flag := func(i int, category string) {
+		result := sim.Transactions[i]
+		result.MEVPatterns = append(result.MEVPatterns, category)
+		result.MEVRisk = max(result.MEVRisk, mevRiskScores[category])
+	}
+	for i, tx := range txs {
+		if hasSelector(tx, rules.LiquidationSelectors) {
+			flag(i, MEVLiquidation)
+		}
+		if i+1 < len(txs) && rules.isFrontrun(tx, txs[i+1], baseFee) {
+			flag(i, MEVFrontrun)
+		}
+		if i > 0 && i+1 < len(txs) && e.mevDetector.isSandwich(rules, txs[i-1], tx, txs[i+1]) {
+			flag(i-1, MEVSandwich)
+			flag(i+1, MEVSandwich)
+
+			front, back := position[txs[i-1].Hash()], position[txs[i+1].Hash()]
+			sim.Sandwiches = append(sim.Sandwiches, &SandwichSeparation{
+				Frontrun:  txs[i-1].Hash(),
+				Victim:    tx.Hash(),
+				Backrun:   txs[i+1].Hash(),
+				Separated: front+1 != position[tx.Hash()] || back-1 != position[tx.Hash()],
+			})
+		}
+	}
+	return sim, nil
+}
+
+// scoreFairness computes the fairness scores of the transactions in submitted
+// order, from their arrival times.
+func (e *Equa) scoreFairness(txs []*types.Transaction, results []*SimulatedTransaction) {
+	type arrival struct {
+		index int
+		time  int64
+	}
+	var known []arrival
+	for i, tx := range txs {
+		if ts, ok := e.fairOrderer.getTransactionTimestamp(tx); ok {
+			ms := hexutil.Uint64(ts.UnixMilli())
+			results[i].Arrival = &ms
+			known = append(known, arrival{index: i, time: ts.UnixMilli()})
+		}
+	}
+	if len(known) < 2 {
+		return
+	}
+	for _, a := range known {
+		fair := 0
+		for _, b := range known {
+			// Pairs are submitted in arrival order if the earlier one comes first,
+			// ties being in order either way
+			if a.index != b.index && (a.time == b.time || (a.index < b.index) == (a.time < b.time)) {
+				fair++
+			}
+		}
+		results[a.index].FairnessScore = float64(fair) / float64(len(known)-1)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that ordering simulations report the fair order of the transactions,
+// their fairness scores and MEV risks, and the sandwiches fair ordering breaks.
+func TestSimulateOrdering(t *testing.T) {
+	engine := newTestEngine(t, 32)
+
+	var (
+		signer    = types.LatestSignerForChainID(big.NewInt(1))
+		bot, _    = crypto.GenerateKey()
+		victim, _ = crypto.GenerateKey()
+		router    = common.Address{0xaa}
+		swap      = []byte{0x38, 0xed, 0x17, 0x39, 0x00}
+	)
+	sign := func(nonce uint64, value int64, key *ecdsa.PrivateKey) *types.Transaction {
+		signed, err := types.SignTx(types.NewTransaction(nonce, router, big.NewInt(value), 100000, big.NewInt(1e9), swap), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return signed
+	}
+	var (
+		front = sign(0, 1, bot)
+		swept = sign(0, 1, victim)
+		back  = sign(1, 2, bot)
+	)
+	// The victim arrived first, the frontrun was inserted before it
+	base := time.Now().Add(-time.Hour)
+	engine.arrivals.Record([]common.Hash{swept.Hash()}, base)
+	engine.arrivals.Record([]common.Hash{front.Hash()}, base.Add(time.Second))
+	engine.arrivals.Record([]common.Hash{back.Hash()}, base.Add(2*time.Second))
+
+	var encs []hexutil.Bytes
+	for _, tx := range []*types.Transaction{front, swept, back} {
+		enc, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to encode transaction: %v", err)
+		}
+		encs = append(encs, enc)
+	}
+	sim, err := engine.SimulateOrdering(encs, nil, common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to simulate ordering: %v", err)
+	}
+	if want := []common.Hash{swept.Hash(), front.Hash(), back.Hash()}; !slices.Equal(sim.Order, want) {
+		t.Fatalf("order mismatch: have %v, want %v", sim.Order, want)
+	}
+	for i, want := range []struct {
+		position int
+		fairness float64
+		risk     float64
+	}{{1, 0.5, 1}, {0, 0.5, 0}, {2, 1, 1}} {
+		result := sim.Transactions[i]
+		if result.Position != want.position || result.FairnessScore != want.fairness || result.MEVRisk != want.risk {
+			t.Errorf("transaction %d: have position %d, fairness %v, risk %v, want %d, %v, %v", i, result.Position, result.FairnessScore, result.MEVRisk, want.position, want.fairness, want.risk)
+		}
+		if result.Arrival == nil {
+			t.Errorf("transaction %d: arrival missing", i)
+		}
+	}
+	if len(sim.Sandwiches) != 1 || sim.Sandwiches[0].Victim != swept.Hash() || !sim.Sandwiches[0].Separated {
+		t.Fatalf("sandwich not reported as separated: %+v", sim.Sandwiches)
+	}
+	// Malformed requests should be rejected
+	if _, err := engine.SimulateOrdering(nil, nil, common.Hash{}); !errors.Is(err, errNoSimulatedTxs) {
+		t.Errorf("empty simulation: have %v, want %v", err, errNoSimulatedTxs)
+	}
+	if _, err := engine.SimulateOrdering([]hexutil.Bytes{encs[0], encs[0]}, nil, common.Hash{}); !errors.Is(err, errDuplicateSimulatedTx) {
+		t.Errorf("duplicate simulation: have %v, want %v", err, errDuplicateSimulatedTx)
+	}
+	if _, err := engine.SimulateOrdering([]hexutil.Bytes{{0xde, 0xad}}, nil, common.Hash{}); err == nil {
+		t.Errorf("malformed transaction accepted")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/ethdb"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/metrics"
+)
+
+const (
+	slashingBacklog    = 1024 // Blocks behind the head analyzed when catching up
+	maxSlashingHistory = 1024 // Events returned by a single history query
+)
+
+var errSlashingHistoryLimit = errors.New("too many slashing events, narrow the block range")
+
+var (
+	slashDetectedMeter = metrics.NewRegisteredMeter("equa/slashing/detected", nil) // Offenses detected in canonical blocks
+	slashExecutedMeter = metrics.NewRegisteredMeter("equa/slashing/executed", nil) // Slashings executed by evidence transactions
+	slashEvidenceMeter = metrics.NewRegisteredMeter("equa/slashing/evidence", nil) // Slashing evidence reported
+)
+
+// SlashingEvent is a slashable offense of a validator, either detected in a
+// canonical block or reported as slashing evidence.
+type SlashingEvent struct {
+	Number     uint64         `json:"number"`
+	Hash       common.Hash    `json:"hash"`                 // Block the offense was committed in, zero for evidence reported off chain
+	Validator  common.Address `json:"validator"`            // Proposer of the block
+	Violation  string         `json:"violation"`            // Kind of violation
+	Percentage uint64         `json:"percentage,omitempty"` // Share of the stake slashable for it
+	Evidence   bool           `json:"evidence,omitempty"`   // Reported as evidence rather than detected locally
+	Executed   bool           `json:"executed,omitempty"`   // Slashed on chain by an evidence transaction
+}
+
+// id distinguishes the event from the other events of its validator at the
+// same height.
+func (ev *SlashingEvent) id() common.Hash {
+	return crypto.Keccak256Hash(ev.Hash[:], []byte(ev.Violation))
+}
+
+// slashingKey is the database key of a slashing event in the history of its
+// validator.
+func slashingKey(validator common.Address, number uint64, id common.Hash) []byte {
+	key := make([]byte, 0, len(rawdb.EquaSlashingPrefix)+common.AddressLength+8+common.HashLength)
+	key = append(key, rawdb.EquaSlashingPrefix...)
+	key = append(key, validator[:]...)
+	key = binary.BigEndian.AppendUint64(key, number)
+	return append(key, id[:]...)
+}
+
+// slashingBlockKey is the database key of the slashing events detected in a
+// block.
+func slashingBlockKey(number uint64, hash common.Hash) []byte {
+	key := make([]byte, 0, len(rawdb.EquaSlashingBlockPrefix)+8+common.HashLength)
+	key = append(key, rawdb.EquaSlashingBlockPrefix...)
+	key = binary.BigEndian.AppendUint64(key, number)
+	return append(key, hash[:]...)
+}
+
+// storeSlashingEvents adds events to the histories of their validators.
+func storeSlashingEvents(db ethdb.KeyValueWriter, events []*SlashingEvent) error {
+	for _, ev := range events {
+		blob, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if err := db.Put(slashingKey(ev.Validator, ev.Number, ev.id()), blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeBlockEvents persists the events detected in a block, marking the block
+// as analyzed even if there were none.
+func (s *Slasher) storeBlockEvents(number uint64, hash common.Hash, events []*SlashingEvent) error {
+	blob, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	batch := s.db.NewBatch()
+	if err := batch.Put(slashingBlockKey(number, hash), blob); err != nil {
+		return err
+	}
+	if err := storeSlashingEvents(batch, events); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// analyzed reports whether the slashing events of a block have been stored.
+func (s *Slasher) analyzed(number uint64, hash common.Hash) bool {
+	ok, _ := s.db.Has(slashingBlockKey(number, hash))
+	return ok
+}
+
+// blockEvents returns the stored slashing events of a block, or false if the
+// block has not been analyzed.
+func (s *Slasher) blockEvents(number uint64, hash common.Hash) ([]*SlashingEvent, bool) {
+	blob, err := s.db.Get(slashingBlockKey(number, hash))
+	if err != nil {
+		return nil, false
+	}
+	var events []*SlashingEvent
+	if err := json.Unmarshal(blob, &events); err != nil {
+		log.Error("Invalid stored slashing events", "number", number, "hash", hash, "err", err)
+		return nil, false
+	}
+	return events, true
+}
+
+// History returns the stored slashing events of a validator between the given
+// blocks inclusive, ordered by block. Events detected in blocks that were later
+// reorged out are included, it is up to the caller to drop them.
+func (s *Slasher) History(validator common.Address, from, to uint64) ([]*SlashingEvent, error) {
+	prefix := append(common.CopyBytes(rawdb.EquaSlashingPrefix), validator[:]...)
+	it := s.db.NewIterator(prefix, binary.BigEndian.AppendUint64(nil, from))
+	defer it.Release()
+
+	events := []*SlashingEvent{}
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8+common.HashLength {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(prefix):]) > to {
+			break
+		}
+		if len(events) == maxSlashingHistory {
+			return nil, errSlashingHistoryLimit
+		}
+		ev := new(SlashingEvent)
+		if err := json.Unmarshal(it.Value(), ev); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, it.Error()
+}
+
+// slashingEvents returns the slashing events detected in a canonical block,
+// analyzing the block and persisting its events if not done before.
+func (e *Equa) slashingEvents(chain consensus.ChainHeaderReader, number uint64) ([]*SlashingEvent, error) {
+	header := chain.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownBlock, number)
+	}
+	if events, ok := e.slasher.blockEvents(number, header.Hash()); ok {
+		return events, nil
+	}
+	block, receipts, err := blockReceipts(chain, number)
+	if err != nil {
+		return nil, err
+	}
+	events := []*SlashingEvent{}
+	for _, violation := range e.detectSlashingViolations(block.Header(), block.Transactions(), receipts) {
+		events = append(events, &SlashingEvent{
+			Number:     number,
+			Hash:       block.Hash(),
+			Validator:  block.Coinbase(),
+			Violation:  violation.reason,
+			Percentage: violation.percentage,
+		})
+	}
+	// Record the slashings executed by the evidence transactions of the block,
+	// the offenses and blocks they refer to are older
+	if e.config.FeatureEnabled(FeatureSlashingExecution) {
+		for _, tx := range block.Transactions() {
+			if !isSlashingEvidence(tx) {
+				continue
+			}
+			proof, ev, err := e.slashingEvidence(tx, number)
+			if err != nil {
+				continue
+			}
+			events = append(events, &SlashingEvent{
+				Number:     ev.Block,
+				Hash:       proof.offense().Hash(),
+				Validator:  ev.Validator,
+				Violation:  ev.Violation,
+				Percentage: e.slasher.SlashingPercentage(ev.Violation),
+				Evidence:   true,
+				Executed:   true,
+			})
+		}
+	}
+	if err := e.slasher.storeBlockEvents(number, block.Hash(), events); err != nil {
+		return nil, err
+	}
+	for _, ev := range events {
+		if ev.Executed {
+			slashExecutedMeter.Mark(1)
+		} else {
+			slashDetectedMeter.Mark(1)
+		}
+	}
+	return events, nil
+}
+
+// StartSlashingMonitor starts recording the slashing events detected in new
+// blocks, until the engine is closed.
+func (e *Equa) StartSlashingMonitor(chain consensus.ChainReader) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(e.config.Period) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.analyzeSlashing(chain)
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// analyzeSlashing records the slashing events of the canonical blocks not yet
+// analyzed, going back at most slashingBacklog blocks from the head. Blocks that
+// replaced others in a reorg are analyzed afresh.
+func (e *Equa) analyzeSlashing(chain consensus.ChainHeaderReader) {
+	head := chain.CurrentHeader()
+	if head == nil {
+		return
+	}
+	last := head.Number.Uint64()
+	first := last + 1
+	for n := last; n > 0 && last-n < slashingBacklog; n-- {
+		header := chain.GetHeaderByNumber(n)
+		if header == nil || e.slasher.analyzed(n, header.Hash()) {
+			break
+		}
+		first = n
+	}
+	for n := first; n <= last; n++ {
+		if _, err := e.slashingEvents(chain, n); err != nil {
+			log.Debug("Failed to analyze block for slashing", "number", n, "err", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/tracing"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+	"github.com/equa/go-equa/trie"
+	"github.com/holiman/uint256"
+)
+
+// Slashing is executed on chain for offenses anyone can prove from signed data
+// alone, so that every node reaches the same verdict. A reporter sends a
+// transaction to params.EquaSlashingAddress carrying a SlashingProof or a
+// DoubleProposalProof, and the block including it slashes the offender while
+// being finalized. The hashes of the executed evidence are recorded in the
+// storage of the slashing address, each holding the number of the block that
+// executed it, so an offense is only slashed once. Every execution adds a log
+// to the receipt of the evidence transaction, emitted by the slashing address
+// with the topics
+//
+//	ValidatorSlashed(address indexed validator, bytes32 indexed evidence, uint256 slashed, uint256 burned)
+//
+// so that explorers and log filters can follow the slashings.
+
+var errInvalidSlashingProof = errors.New("invalid slashing proof")
+
+// slashedTopic is the topic of the log of an executed slashing.
+var slashedTopic = crypto.Keccak256Hash([]byte("ValidatorSlashed(address,bytes32,uint256,uint256)"))
+
+// SlashingProof proves that a validator signed a false compliance statement:
+// the header of its block, carrying the signed statement, and the transactions
+// of the block, which the statement does not commit to.
+type SlashingProof struct {
+	Header       *types.Header
+	Transactions []*types.Transaction
+}
+
+// verify checks that the proof shows a false compliance statement, returning
+// the evidence of the offense.
+func (p *SlashingProof) verify() (*Evidence, error) {
+	if p.Header == nil || p.Header.Number == nil {
+		return nil, fmt.Errorf("%w: missing header", errInvalidSlashingProof)
+	}
+	if types.DeriveSha(types.Transactions(p.Transactions), trie.NewStackTrie(nil)) != p.Header.TxHash {
+		return nil, fmt.Errorf("%w: transactions do not match header", errInvalidSlashingProof)
+	}
+	block := types.NewBlockWithHeader(p.Header).WithBody(types.Body{Transactions: p.Transactions})
+	if err := CheckStatement(block); err != errStatementContradicts {
+		if err == nil {
+			err = errStatementHolds
+		}
+		return nil, err
+	}
+	return &Evidence{
+		Validator: p.Header.Coinbase,
+		Block:     p.Header.Number.Uint64(),
+		Violation: violationFalseStatement,
+	}, nil
+}
+
+// slashingProof is a proof of an offense carried by an evidence transaction.
+type slashingProof interface {
+	verify() (*Evidence, error)
+	offense() *types.Header // Header of the block the offense was committed in
+}
+
+// offense returns the header of the block the offense was committed in.
+func (p *SlashingProof) offense() *types.Header {
+	return p.Header
+}
+
+// decodeSlashingProof decodes the proof carried by an evidence transaction. A
+// leading type byte selects the proof, its absence meaning a SlashingProof.
+func decodeSlashingProof(data []byte) (slashingProof, error) {
+	var proof slashingProof = new(SlashingProof)
+	if len(data) > 0 && data[0] == doubleProposalProofType {
+		proof, data = new(DoubleProposalProof), data[1:]
+	}
+	if err := rlp.DecodeBytes(data, proof); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSlashingProof, err)
+	}
+	return proof, nil
+}
+
+// slashingEvidence decodes and verifies the proof carried by an evidence
+// transaction included in the block with the given number.
+func (e *Equa) slashingEvidence(tx *types.Transaction, number uint64) (slashingProof, *Evidence, error) {
+	proof, err := decodeSlashingProof(tx.Data())
+	if err != nil {
+		return nil, nil, err
+	}
+	ev, err := proof.verify()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := e.slasher.VerifyEvidence(ev, number); err != nil {
+		return nil, nil, err
+	}
+	return proof, ev, nil
+}
+
+// isSlashingEvidence reports whether a transaction submits slashing evidence.
+func isSlashingEvidence(tx *types.Transaction) bool {
+	return tx.To() != nil && *tx.To() == params.EquaSlashingAddress
+}
+
+// executeSlashing slashes the validators proven by the evidence transactions of
+// a block to have offended, returning the number of offenses slashed. The
+// slashed stake is recorded in the validator registry, stake held by the
+// staking contract is debited from it and burned as well, and a log is added to
+// the receipt of the evidence transaction. Invalid, expired and already executed
+// evidence is ignored, the transactions are still included.
+func (e *Equa) executeSlashing(header *types.Header, state vm.StateDB, txs []*types.Transaction, receipts []*types.Receipt) int {
+	var (
+		number   = header.Number.Uint64()
+		registry = newValidatorRegistry(state, e.config)
+		executed int
+	)
+	for i, tx := range txs {
+		if !isSlashingEvidence(tx) {
+			continue
+		}
+		_, ev, err := e.slashingEvidence(tx, number)
+		if err != nil {
+			log.Debug("Ignoring slashing evidence", "number", number, "tx", tx.Hash(), "err", err)
+			continue
+		}
+		key := ev.Hash()
+		if state.GetState(params.EquaSlashingAddress, key) != (common.Hash{}) {
+			continue
+		}
+		// Give the slashing address a nonce, accounts without one are deleted
+		// as empty regardless of their storage
+		if state.GetNonce(params.EquaSlashingAddress) == 0 {
+			state.SetNonce(params.EquaSlashingAddress, 1, tracing.NonceChangeUnspecified)
+		}
+		state.SetState(params.EquaSlashingAddress, key, common.BigToHash(header.Number))
+
+		slashed, err := registry.slash(ev.Validator, e.slasher.SlashingPercentage(ev.Violation))
+		if err != nil {
+			log.Debug("Offender not slashable in the validator registry", "validator", ev.Validator, "err", err)
+			slashed = new(big.Int)
+		}
+		burned := new(big.Int)
+		if e.stakingEnabled() {
+			burned = e.slashStake(state, ev)
+		}
+		if i < len(receipts) {
+			addReceiptLog(receipts, i, &types.Log{
+				Address:     params.EquaSlashingAddress,
+				Topics:      []common.Hash{slashedTopic, common.BytesToHash(ev.Validator[:]), key},
+				Data:        append(common.BigToHash(slashed).Bytes(), common.BigToHash(burned).Bytes()...),
+				BlockNumber: number,
+			})
+		}
+		executed++
+		log.Info("Executed slashing", "number", number, "validator", ev.Validator, "block", ev.Block, "violation", ev.Violation, "slashed", slashed, "burned", burned)
+	}
+	return executed
+}
+
+// addReceiptLog adds a log emitted by the consensus rules to the receipt of the
+// transaction with the given index, renumbering the logs of the block and
+// updating the bloom of the receipt.
+func addReceiptLog(receipts []*types.Receipt, index int, event *types.Log) {
+	receipt := receipts[index]
+	event.TxHash, event.TxIndex, event.BlockHash = receipt.TxHash, uint(index), receipt.BlockHash
+	receipt.Logs = append(receipt.Logs, event)
+	receipt.Bloom = types.CreateBloom(receipt)
+
+	var n uint
+	for _, receipt := range receipts {
+		for _, l := range receipt.Logs {
+			l.Index = n
+			n++
+		}
+	}
+}
+
+// slash slashes the given share of the stake of a validator in the registry,
+// active and exited validators whose stake is unbonding alike, returning the
+// amount slashed.
+func (r *validatorRegistry) slash(addr common.Address, percentage uint64) (*big.Int, error) {
+	if percentage > 100 {
+		return nil, errInvalidSlashPercentage
+	}
+	reg := r.get(addr)
+	if reg.status != registrationActive && reg.status != registrationExited {
+		return nil, errInvalidValidator
+	}
+	amount := percentOf(reg.stake, percentage)
+	reg.stake.Sub(reg.stake, amount)
+	reg.slashed.Add(reg.slashed, amount)
+	r.put(reg)
+	return amount, nil
+}
+
+// slashStake debits the stake of an offender from the staking contract and burns
+// it, returning the amount burned.
+func (e *Equa) slashStake(state vm.StateDB, ev *Evidence) *big.Int {
+	var (
+		contract = e.config.StakingContract
+		slot     = stakingStakeKey(ev.Validator)
+		stake    = state.GetState(contract, slot).Big()
+		amount   = e.slasher.CalculateSlashingAmount(ev.Violation, stake)
+	)
+	state.SetState(contract, slot, common.BigToHash(new(big.Int).Sub(stake, amount)))
+
+	// Burn the slashed stake, sending it to the zero address like burned MEV
+	burned := uint256.MustFromBig(amount)
+	if balance := state.GetBalance(contract); balance.Lt(burned) {
+		burned = balance.Clone()
+	}
+	state.SubBalance(contract, burned, tracing.BalanceChangeUnspecified)
+	state.AddBalance(common.Address{}, burned, tracing.BalanceChangeUnspecified)
+	return burned.ToBig()
+}
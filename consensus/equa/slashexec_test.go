@@ -0,0 +1,234 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/tracing"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+	"github.com/equa/go-equa/rlp"
+	"github.com/equa/go-equa/trie"
+	"github.com/holiman/uint256"
+)
+
+// newTestSlashingProof creates the proof of a block whose proposer signed a
+// compliance statement for fewer transactions than the block includes.
+func newTestSlashingProof(t *testing.T, engine *Equa, number int64) *SlashingProof {
+	t.Helper()
+
+	key, _ := crypto.GenerateKey()
+	offender := crypto.PubkeyToAddress(key.PublicKey)
+	engine.Authorize(offender, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	txs := newTestTransactions(t, 3)
+	header := &types.Header{
+		Number:   big.NewInt(number),
+		Coinbase: offender,
+		TxHash:   types.DeriveSha(types.Transactions(txs), trie.NewStackTrie(nil)),
+	}
+	if err := engine.signStatement(header, txs[:2], nil); err != nil {
+		t.Fatalf("failed to sign statement: %v", err)
+	}
+	return &SlashingProof{Header: header, Transactions: txs}
+}
+
+// newTestEvidenceTx creates a transaction submitting a slashing proof.
+func newTestEvidenceTx(t *testing.T, proof *SlashingProof) *types.Transaction {
+	t.Helper()
+
+	data, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		t.Fatalf("failed to encode proof: %v", err)
+	}
+	key, _ := crypto.GenerateKey()
+	return types.MustSignNewTx(key, types.LatestSignerForChainID(big.NewInt(1)), &types.LegacyTx{
+		To: &params.EquaSlashingAddress, Gas: 1000000, GasPrice: big.NewInt(1e9), Data: data,
+	})
+}
+
+// Tests that evidence transactions proving a false compliance statement debit
+// and burn the offender's stake in the staking contract exactly once, and that
+// evidence against compliant blocks is ignored.
+func TestSlashingExecution(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000000e9a02")
+		engine   = newTestEngine(t, 32)
+		chain    = &testHeaderChain{config: newTestChainConfig(engine.config)}
+		ether    = big.NewInt(1e18)
+	)
+	engine.config.StakingContract = contract
+	engine.config.Features = map[string]bool{FeatureSlashingExecution: true}
+
+	proof := newTestSlashingProof(t, engine, 5)
+	offender := proof.Header.Coinbase
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	testRegistry(statedb, contract, map[common.Address]int64{offender: 64}, offender)
+	statedb.AddBalance(contract, uint256.MustFromBig(new(big.Int).Mul(big.NewInt(64), ether)), tracing.BalanceChangeUnspecified)
+
+	// Evidence against a compliant block is not executed
+	compliant := &SlashingProof{Header: types.CopyHeader(proof.Header), Transactions: proof.Transactions[:2]}
+	compliant.Header.TxHash = types.DeriveSha(types.Transactions(compliant.Transactions), trie.NewStackTrie(nil))
+	if err := engine.signStatement(compliant.Header, compliant.Transactions, nil); err != nil {
+		t.Fatalf("failed to sign statement: %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(10), Coinbase: common.Address{0x01}}
+	engine.finalize(chain, header, statedb, &types.Body{Transactions: []*types.Transaction{newTestEvidenceTx(t, compliant)}}, nil)
+	if stake := statedb.GetState(contract, stakingStakeKey(offender)).Big(); stake.Cmp(new(big.Int).Mul(big.NewInt(64), ether)) != 0 {
+		t.Fatalf("compliant proposer slashed: stake %v", stake)
+	}
+	// Evidence of the false statement halves the stake, repeating it does not
+	evidence := newTestEvidenceTx(t, proof)
+	for i := 0; i < 2; i++ {
+		engine.finalize(chain, header, statedb, &types.Body{Transactions: []*types.Transaction{evidence}}, nil)
+	}
+	want := new(big.Int).Mul(big.NewInt(32), ether)
+	if stake := statedb.GetState(contract, stakingStakeKey(offender)).Big(); stake.Cmp(want) != 0 {
+		t.Errorf("slashed stake mismatch: have %v, want %v", stake, want)
+	}
+	if balance := statedb.GetBalance(contract).ToBig(); balance.Cmp(want) != 0 {
+		t.Errorf("contract balance mismatch: have %v, want %v", balance, want)
+	}
+	if burned := statedb.GetBalance(common.Address{}).ToBig(); burned.Cmp(want) != 0 {
+		t.Errorf("burned stake mismatch: have %v, want %v", burned, want)
+	}
+	ev := &Evidence{Validator: offender, Block: 5, Violation: violationFalseStatement}
+	if record := statedb.GetState(params.EquaSlashingAddress, ev.Hash()); record.Big().Uint64() != 10 {
+		t.Errorf("execution record mismatch: have %x, want block 10", record)
+	}
+	// Evidence outside the validity window is not executed
+	stale := newTestSlashingProof(t, engine, 5)
+	header = &types.Header{Number: big.NewInt(int64(5 + engine.slasher.evidenceWindow() + 1)), Coinbase: common.Address{0x01}}
+	testRegistry(statedb, contract, map[common.Address]int64{stale.Header.Coinbase: 64}, stale.Header.Coinbase)
+	engine.finalize(chain, header, statedb, &types.Body{Transactions: []*types.Transaction{newTestEvidenceTx(t, stale)}}, nil)
+	if stake := statedb.GetState(contract, stakingStakeKey(stale.Header.Coinbase)).Big(); stake.Cmp(new(big.Int).Mul(big.NewInt(64), ether)) != 0 {
+		t.Errorf("expired evidence executed: stake %v", stake)
+	}
+}
+
+// Tests that stake not held on chain is slashed in the validator registry kept
+// in the state, only once, and that the slashing is logged in the receipt of
+// the evidence transaction.
+func TestSlashingExecutionOffChainStake(t *testing.T) {
+	engine := newTestEngine(t, 32)
+	engine.config.Features = map[string]bool{FeatureSlashingExecution: true}
+
+	proof := newTestSlashingProof(t, engine, 5)
+	offender := proof.Header.Coinbase
+	engine.config.InitialValidators = []params.EquaInitialValidator{{Address: offender, Stake: new(big.Int).Mul(big.NewInt(64), big.NewInt(1e18))}}
+
+	var (
+		chain    = &testHeaderChain{config: newTestChainConfig(engine.config)}
+		header   = &types.Header{Number: big.NewInt(10), Coinbase: common.Address{0x01}}
+		evidence = newTestEvidenceTx(t, proof)
+		other    = newTestTransactions(t, 1)[0]
+		body     = &types.Body{Transactions: []*types.Transaction{evidence, other}}
+		half     = new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18))
+	)
+	newReceipts := func() []*types.Receipt {
+		return []*types.Receipt{
+			{TxHash: evidence.Hash(), Logs: []*types.Log{{Address: common.Address{0x02}, Index: 0}}},
+			{TxHash: other.Hash(), Logs: []*types.Log{{Address: common.Address{0x03}, Index: 1}}},
+		}
+	}
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	receipts := newReceipts()
+	engine.finalize(chain, header, statedb, body, receipts)
+
+	reg := newValidatorRegistry(statedb, engine.config).get(offender)
+	if reg.stake.Cmp(half) != 0 || reg.slashed.Cmp(half) != 0 {
+		t.Fatalf("registry slashing mismatch: stake %v, slashed %v, want %v", reg.stake, reg.slashed, half)
+	}
+	// The slashing is logged in the receipt of the evidence transaction, after
+	// its own logs and before those of the later transactions
+	logs := receipts[0].Logs
+	if len(logs) != 2 || logs[1].Address != params.EquaSlashingAddress || logs[1].Index != 1 || logs[1].TxHash != evidence.Hash() {
+		t.Fatalf("slashing log mismatch: %+v", logs)
+	}
+	ev := &Evidence{Validator: offender, Block: 5, Violation: violationFalseStatement}
+	if topics := logs[1].Topics; len(topics) != 3 || topics[0] != slashedTopic || common.BytesToAddress(topics[1][:]) != offender || topics[2] != ev.Hash() {
+		t.Errorf("slashing log topics mismatch: %v", topics)
+	}
+	if slashed := new(big.Int).SetBytes(logs[1].Data[:32]); slashed.Cmp(half) != 0 {
+		t.Errorf("logged slashed amount mismatch: have %v, want %v", slashed, half)
+	}
+	if index := receipts[1].Logs[0].Index; index != 2 {
+		t.Errorf("later log not renumbered: index %d", index)
+	}
+	if !receipts[0].Bloom.Test(slashedTopic[:]) {
+		t.Errorf("slashing log missing from the receipt bloom")
+	}
+	// Executing the evidence again on the same branch neither slashes nor logs
+	receipts = newReceipts()
+	engine.finalize(chain, header, statedb, body, receipts)
+	if reg := newValidatorRegistry(statedb, engine.config).get(offender); reg.stake.Cmp(half) != 0 {
+		t.Errorf("evidence slashed twice: stake %v", reg.stake)
+	}
+	if len(receipts[0].Logs) != 1 {
+		t.Errorf("evidence logged twice")
+	}
+	// A restarted node finds the slashing in the state
+	restarted := NewStakeManager(engine.config)
+	restarted.load(statedb, header.Hash())
+	if validator, _ := restarted.GetValidator(offender); !validator.Slashed || validator.Stake.Cmp(half) != 0 {
+		t.Errorf("slashing lost after restart: slashed %v, stake %v", validator.Slashed, validator.Stake)
+	}
+}
+
+// Tests that blocks executing slashing evidence are imported with the slashing
+// log in the receipt of the evidence transaction, the receipt root and bloom
+// assembled with it matching those of the importing node.
+func TestImportSlashingExecution(t *testing.T) {
+	var (
+		key, _    = crypto.GenerateKey()
+		reporter  = crypto.PubkeyToAddress(key.PublicKey)
+		validator = common.Address{0x01}
+		engine    = newTestEngine(t, 32, validator)
+	)
+	engine.config.Features = map[string]bool{FeatureSlashingExecution: true}
+	proof := newTestSlashingProof(t, engine, 0)
+	offender := proof.Header.Coinbase
+	engine.config.InitialValidators = append(engine.config.InitialValidators, params.EquaInitialValidator{Address: offender, Stake: new(big.Int).Mul(big.NewInt(64), big.NewInt(1e18))})
+
+	data, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		t.Fatalf("failed to encode proof: %v", err)
+	}
+	signer := types.LatestSigner(newTestChainConfig(engine.config))
+	chain, blocks := importTestChain(t, engine, []common.Address{reporter}, 1, func(i int, b *core.BlockGen) {
+		b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{To: &params.EquaSlashingAddress, Gas: 1000000, GasPrice: big.NewInt(params.GWei), Data: data}))
+	})
+	receipts := chain.GetReceiptsByHash(blocks[0].Hash())
+	if len(receipts) != 1 || len(receipts[0].Logs) != 1 || receipts[0].Logs[0].Topics[0] != slashedTopic {
+		t.Fatalf("slashing log not in the stored receipt: %v", receipts)
+	}
+	if !blocks[0].Bloom().Test(slashedTopic[:]) {
+		t.Errorf("slashing log missing from the header bloom")
+	}
+	if validator, _ := engine.stakeManager.GetValidator(offender); !validator.Slashed {
+		t.Errorf("offender not slashed on import")
+	}
+}
@@ -4,32 +4,160 @@
 package equa
 
 import (
+	"encoding/binary"
+	"errors"
 	"math/big"
+	"sort"
+	"sync"
 
 	"github.com/equa/go-equa/common"
 	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/ethdb"
 	"github.com/equa/go-equa/params"
 )
 
+var (
+	errEvidenceExpired   = errors.New("evidence outside validity window")
+	errEvidenceFuture    = errors.New("evidence from future block")
+	errEvidenceDuplicate = errors.New("evidence already known")
+)
+
+// Evidence is a claim that a validator committed a slashable offense at a
+// given block.
+type Evidence struct {
+	Validator common.Address // Validator accused of the offense
+	Block     uint64         // Block at which the offense was committed
+	Violation string         // Kind of violation, as understood by CalculateSlashingAmount
+}
+
+// Hash returns the unique identifier of the evidence.
+func (ev *Evidence) Hash() common.Hash {
+	var block [8]byte
+	binary.BigEndian.PutUint64(block[:], ev.Block)
+	return crypto.Keccak256Hash(ev.Validator.Bytes(), block[:], []byte(ev.Violation))
+}
+
 // Slasher detects malicious behavior and applies penalties
 type Slasher struct {
+	db     ethdb.KeyValueStore // Database keeping the slashing history
 	config *params.EquaConfig
+	signer types.Signer     // Signer of the chain, used to recover transaction senders
+	rules  func() *MEVRules // Rules DEX interactions are recognized by, those of local MEV analysis
+
+	evidence map[common.Hash]*Evidence // Accepted evidence still within the validity window
+	lock     sync.RWMutex
 }
 
 // NewSlasher creates a new slasher
-func NewSlasher(config *params.EquaConfig) *Slasher {
+func NewSlasher(db ethdb.KeyValueStore, config *params.EquaConfig, signer types.Signer) *Slasher {
+	builtin := DefaultMEVRules()
 	return &Slasher{
-		config: config,
+		db:       db,
+		config:   config,
+		signer:   signer,
+		rules:    func() *MEVRules { return builtin },
+		evidence: make(map[common.Hash]*Evidence),
+	}
+}
+
+// evidenceWindow returns the number of blocks after an offense during which
+// evidence for it is accepted.
+func (s *Slasher) evidenceWindow() uint64 {
+	return s.config.EvidenceMaxAge * s.config.Epoch
+}
+
+// VerifyEvidence checks that the evidence refers to an offense that is still
+// slashable at the given head block.
+func (s *Slasher) VerifyEvidence(ev *Evidence, head uint64) error {
+	if ev.Block > head {
+		return errEvidenceFuture
+	}
+	if head-ev.Block > s.evidenceWindow() {
+		return errEvidenceExpired
+	}
+	return nil
+}
+
+// SubmitEvidence verifies the evidence against the given head block and adds it
+// to the evidence store and the slashing history of the validator.
+func (s *Slasher) SubmitEvidence(ev *Evidence, head uint64) error {
+	if err := s.VerifyEvidence(ev, head); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hash := ev.Hash()
+	if _, ok := s.evidence[hash]; ok {
+		return errEvidenceDuplicate
+	}
+	event := &SlashingEvent{Number: ev.Block, Validator: ev.Validator, Violation: ev.Violation, Evidence: true}
+	if err := storeSlashingEvents(s.db, []*SlashingEvent{event}); err != nil {
+		return err
+	}
+	s.evidence[hash] = ev
+	slashEvidenceMeter.Mark(1)
+	return nil
+}
+
+// Evidence returns all stored evidence against the given validator.
+func (s *Slasher) Evidence(validator common.Address) []*Evidence {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var list []*Evidence
+	for _, ev := range s.evidence {
+		if ev.Validator == validator {
+			list = append(list, ev)
+		}
 	}
+	return list
 }
 
-// DetectMEVExtraction detects if a validator extracted MEV
-func (s *Slasher) DetectMEVExtraction(validator common.Address, txs []*types.Transaction, receipts []*types.Receipt) bool {
+// PendingEvidence returns all stored evidence, ordered by block.
+func (s *Slasher) PendingEvidence() []*Evidence {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	list := make([]*Evidence, 0, len(s.evidence))
+	for _, ev := range s.evidence {
+		list = append(list, ev)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Block != list[j].Block {
+			return list[i].Block < list[j].Block
+		}
+		return list[i].Hash().Cmp(list[j].Hash()) < 0
+	})
+	return list
+}
+
+// PruneEvidence drops all evidence that has fallen out of the validity window
+// at the given head block, returning the number of entries removed.
+func (s *Slasher) PruneEvidence(head uint64) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pruned := 0
+	for hash, ev := range s.evidence {
+		if ev.Block < head && head-ev.Block > s.evidenceWindow() {
+			delete(s.evidence, hash)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// DetectMEVExtraction detects if a validator extracted MEV. Transactions are
+// priced at their effective gas price for the block's base fee, or at their gas
+// price if the base fee is nil.
+func (s *Slasher) DetectMEVExtraction(validator common.Address, txs []*types.Transaction, receipts []*types.Receipt, baseFee *big.Int) bool {
 	// Check if validator inserted their own transactions for MEV
 	for _, tx := range txs {
-		if tx.From() == validator {
+		if from, err := txSender(s.signer, tx); err == nil && from == validator {
 			// Check if this transaction appears to be MEV extraction
-			if s.isMEVTransaction(tx) {
+			if s.isMEVTransaction(tx, baseFee) {
 				return true
 			}
 		}
@@ -40,7 +168,7 @@ func (s *Slasher) DetectMEVExtraction(validator common.Address, txs []*types.Tra
 }
 
 // DetectTxReordering detects if transactions were maliciously reordered
-func (s *Slasher) DetectTxReordering(txs []*types.Transaction) bool {
+func (s *Slasher) DetectTxReordering(txs []*types.Transaction, baseFee *big.Int) bool {
 	if len(txs) <= 1 {
 		return false
 	}
@@ -51,7 +179,7 @@ func (s *Slasher) DetectTxReordering(txs []*types.Transaction) bool {
 
 	for i := 1; i < len(txs); i++ {
 		// Simple check: compare gas prices vs expected timestamp order
-		if txs[i].GasPrice().Cmp(txs[i-1].GasPrice()) > 0 {
+		if effectiveGasPrice(txs[i], baseFee).Cmp(effectiveGasPrice(txs[i-1], baseFee)) > 0 {
 			// Higher gas price transaction after lower one might indicate reordering
 			violations++
 		}
@@ -62,7 +190,7 @@ func (s *Slasher) DetectTxReordering(txs []*types.Transaction) bool {
 }
 
 // DetectCensorship detects if transactions were censored
-func (s *Slasher) DetectCensorship(txs []*types.Transaction) bool {
+func (s *Slasher) DetectCensorship(txs []*types.Transaction, baseFee *big.Int) bool {
 	// In a real implementation, this would compare against mempool state
 	// to see if high-gas transactions were deliberately excluded
 
@@ -73,8 +201,8 @@ func (s *Slasher) DetectCensorship(txs []*types.Transaction) bool {
 
 	// Look for large gaps in gas prices that might indicate censorship
 	for i := 1; i < len(txs); i++ {
-		prevGas := txs[i-1].GasPrice()
-		currGas := txs[i].GasPrice()
+		prevGas := effectiveGasPrice(txs[i-1], baseFee)
+		currGas := effectiveGasPrice(txs[i], baseFee)
 
 		// If there's a large gap, it might indicate censorship
 		if prevGas.Cmp(currGas) > 0 {
@@ -112,12 +240,12 @@ func (s *Slasher) DetectValidatorCollusion(validators []common.Address, blocks [
 }
 
 // isMEVTransaction checks if a transaction is likely MEV extraction
-func (s *Slasher) isMEVTransaction(tx *types.Transaction) bool {
+func (s *Slasher) isMEVTransaction(tx *types.Transaction, baseFee *big.Int) bool {
 	// Check for common MEV patterns
 
 	// Very high gas price (potential frontrunning)
 	highGasThreshold := big.NewInt(1000000000000000) // 1000 gwei
-	if tx.GasPrice().Cmp(highGasThreshold) > 0 {
+	if effectiveGasPrice(tx, baseFee).Cmp(highGasThreshold) > 0 {
 		return true
 	}
 
@@ -140,7 +268,7 @@ func (s *Slasher) detectSuspiciousOrdering(validator common.Address, txs []*type
 	beneficialOrderings := 0
 
 	for i, tx := range txs {
-		if tx.From() == validator {
+		if from, err := txSender(s.signer, tx); err == nil && from == validator {
 			validatorTxCount++
 
 			// Check if validator's transaction is positioned to extract MEV
@@ -154,26 +282,11 @@ func (s *Slasher) detectSuspiciousOrdering(validator common.Address, txs []*type
 	return validatorTxCount > 0 && beneficialOrderings > validatorTxCount/2
 }
 
-// isDEXInteraction checks if transaction interacts with a DEX
+// isDEXInteraction checks if a transaction swaps on a DEX, as recognized by the
+// MEV detection rules: by the function it calls and, if the rules list routers,
+// the contract it calls.
 func (s *Slasher) isDEXInteraction(tx *types.Transaction) bool {
-	if tx.To() == nil || len(tx.Data()) < 4 {
-		return false
-	}
-
-	// Common DEX contract addresses (simplified)
-	dexAddresses := []common.Address{
-		common.HexToAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"), // Uniswap V2 Router
-		common.HexToAddress("0xE592427A0AEce92De3Edee1F18E0157C05861564"), // Uniswap V3 Router
-		common.HexToAddress("0xd9e1cE17f2641f24aE83637ab66a2cca9C378B9F"), // SushiSwap Router
-	}
-
-	for _, dexAddr := range dexAddresses {
-		if *tx.To() == dexAddr {
-			return true
-		}
-	}
-
-	return false
+	return s.rules().isSwap(tx)
 }
 
 // isFlashloanTransaction checks if transaction uses flashloans
@@ -206,23 +319,24 @@ func (s *Slasher) couldExtractMEV(tx1, tx2 *types.Transaction) bool {
 
 // CalculateSlashingAmount calculates how much to slash based on violation severity
 func (s *Slasher) CalculateSlashingAmount(violation string, stake *big.Int) *big.Int {
-	percentage := uint64(0)
-
-	switch violation {
-	case "MEV extraction":
-		percentage = s.config.SlashingPercentage
-	case "Transaction reordering":
-		percentage = 10
-	case "Transaction censorship":
-		percentage = 20
-	case "Validator collusion":
-		percentage = 100 // Total slash for collusion
-	default:
-		percentage = 5 // Default minor slash
-	}
+	return percentOf(stake, s.SlashingPercentage(violation))
+}
 
-	slashAmount := new(big.Int).Mul(stake, big.NewInt(int64(percentage)))
-	slashAmount.Div(slashAmount, big.NewInt(100))
+// violationPenalties maps violations to the names their slashing penalties are
+// configured under in the chain config.
+var violationPenalties = map[string]string{
+	"MEV extraction":          params.EquaPenaltyMEVExtraction,
+	"Transaction reordering":  "transaction-reordering",
+	"Transaction censorship":  "transaction-censorship",
+	"Validator collusion":     "validator-collusion",
+	violationFalseStatement:   "false-statement",
+	violationInvalidBlock:     "invalid-block",
+	violationDoubleProposal:   "double-proposal",
+	violationShareWithholding: "share-withholding",
+}
 
-	return slashAmount
+// SlashingPercentage returns the share of the stake slashed for a violation, as
+// configured in the penalty schedule of the chain.
+func (s *Slasher) SlashingPercentage(violation string) uint64 {
+	return s.config.SlashingPenalty(violationPenalties[violation])
 }
\ No newline at end of file
@@ -0,0 +1,144 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that evidence is only accepted within the configured validity window
+// and that expired evidence is pruned from the store.
+func TestEvidenceValidityWindow(t *testing.T) {
+	slasher := NewSlasher(rawdb.NewMemoryDatabase(), &params.EquaConfig{Epoch: 100, EvidenceMaxAge: 2}, types.LatestSigner(params.MergedTestChainConfig))
+	validator := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	tests := []struct {
+		block, head uint64
+		err         error
+	}{
+		{block: 500, head: 500, err: nil},
+		{block: 300, head: 500, err: nil},
+		{block: 299, head: 500, err: errEvidenceExpired},
+		{block: 501, head: 500, err: errEvidenceFuture},
+	}
+	for i, tt := range tests {
+		ev := &Evidence{Validator: validator, Block: tt.block, Violation: "MEV extraction"}
+		if err := slasher.VerifyEvidence(ev, tt.head); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	ev := &Evidence{Validator: validator, Block: 300, Violation: "MEV extraction"}
+	if err := slasher.SubmitEvidence(ev, 500); err != nil {
+		t.Fatalf("failed to submit evidence: %v", err)
+	}
+	if err := slasher.SubmitEvidence(ev, 500); !errors.Is(err, errEvidenceDuplicate) {
+		t.Fatalf("duplicate evidence: have %v, want %v", err, errEvidenceDuplicate)
+	}
+	if pruned := slasher.PruneEvidence(500); pruned != 0 {
+		t.Fatalf("pruned live evidence: %d entries", pruned)
+	}
+	if pruned := slasher.PruneEvidence(501); pruned != 1 {
+		t.Fatalf("expired evidence not pruned: have %d, want 1", pruned)
+	}
+	if list := slasher.Evidence(validator); len(list) != 0 {
+		t.Fatalf("expired evidence still stored: %d entries", len(list))
+	}
+}
+
+// Tests that slashing penalties default to the built-in schedule, can be set
+// per violation in the genesis config and are validated.
+func TestSlashingPenalties(t *testing.T) {
+	var config params.EquaConfig
+	if err := json.Unmarshal([]byte(`{"slashingPercentage": 40, "slashingPenalties": {"transaction-censorship": 35, "other": 1}}`), &config); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	slasher := NewSlasher(rawdb.NewMemoryDatabase(), &config, types.LatestSigner(params.MergedTestChainConfig))
+
+	tests := []struct {
+		violation  string
+		percentage uint64
+	}{
+		{"MEV extraction", 40},
+		{"Transaction reordering", 10},
+		{"Transaction censorship", 35},
+		{violationFalseStatement, 50},
+		{violationDoubleProposal, 100},
+		{"Unknown", 1},
+	}
+	for _, tt := range tests {
+		if percentage := slasher.SlashingPercentage(tt.violation); percentage != tt.percentage {
+			t.Errorf("%s: penalty mismatch: have %d%%, want %d%%", tt.violation, percentage, tt.percentage)
+		}
+	}
+	config.SlashingPenalties[params.EquaPenaltyMEVExtraction] = 60
+	if percentage := slasher.SlashingPercentage("MEV extraction"); percentage != 60 {
+		t.Errorf("configured MEV penalty mismatch: have %d%%, want 60%%", percentage)
+	}
+	if err := newTestChainConfig(&config).CheckConfigForkOrder(); err != nil {
+		t.Errorf("valid penalties rejected: %v", err)
+	}
+	for _, penalties := range []map[string]uint64{{"unknown": 10}, {"invalid-block": 101}} {
+		config := &params.EquaConfig{Epoch: 100, SlashingPenalties: penalties}
+		if err := newTestChainConfig(config).CheckConfigForkOrder(); err == nil {
+			t.Errorf("invalid penalties %v accepted", penalties)
+		}
+	}
+}
+
+// Tests that the slasher recognizes DEX interactions by the MEV detection rules
+// of the engine, on any contract unless the rules list routers.
+func TestDEXInteraction(t *testing.T) {
+	var (
+		engine = newTestEngine(t, 32)
+		router = common.Address{0xaa}
+		swap   = []byte{0x38, 0xed, 0x17, 0x39} // swapExactTokensForTokens
+		call   = func(to common.Address, data []byte) *types.Transaction {
+			return types.NewTx(&types.LegacyTx{To: &to, Gas: 100000, GasPrice: big.NewInt(1e9), Data: data})
+		}
+	)
+	tests := []struct {
+		tx     *types.Transaction
+		routed bool // Whether the interaction is recognized once the rules list the router
+	}{
+		{call(router, swap), true},
+		{call(common.Address{0xbb}, swap), false},
+	}
+	for i, tt := range tests {
+		if !engine.slasher.isDEXInteraction(tt.tx) {
+			t.Errorf("test %d: swap not recognized with built-in rules", i)
+		}
+	}
+	if engine.slasher.isDEXInteraction(call(router, []byte{0x01, 0x02, 0x03, 0x04})) {
+		t.Errorf("unknown function recognized as swap")
+	}
+	rules := DefaultMEVRules()
+	rules.Routers = []common.Address{router}
+	engine.mevDetector.SetRules(rules)
+	for i, tt := range tests {
+		if have := engine.slasher.isDEXInteraction(tt.tx); have != tt.routed {
+			t.Errorf("test %d: interaction mismatch with listed routers: have %v, want %v", i, have, tt.routed)
+		}
+	}
+}
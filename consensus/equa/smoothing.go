@@ -0,0 +1,153 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/tracing"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+)
+
+// Smoothing pool membership is kept in the state, so that every node pays the
+// same rewards. A validator joins or leaves the pool by sending a transaction to
+// SmoothingPoolAddress carrying smoothingJoin or smoothingLeave as its data, the
+// block including it recording the request while being finalized. Requests take
+// effect from the epoch after the one of the block, so that the pool shared at
+// the end of an epoch only goes to the validators that were members throughout
+// it. Members can also be set at genesis, in the storage of the pool allocated
+// with a nonce. The storage of the pool is laid out like that of a contract with:
+//
+//	mapping(address => bool) members;       // slot 0
+//	mapping(address => uint256) paid;       // slot 1
+//	mapping(address => bool) requested;     // slot 2
+//	mapping(address => uint256) effective;  // slot 3
+//
+// where members holds the membership in effect before the last request of each
+// validator, paid the rewards each member received from the pool in total,
+// requested the membership last requested and effective the epoch it takes
+// effect from, zero if none was.
+var (
+	smoothingMembersSlot   = common.Hash{}
+	smoothingPaidSlot      = common.BigToHash(common.Big1)
+	smoothingRequestedSlot = common.BigToHash(common.Big2)
+	smoothingEffectiveSlot = common.BigToHash(big.NewInt(3))
+
+	smoothingJoin  = []byte("join")
+	smoothingLeave = []byte("leave")
+)
+
+// smoothingKey is the storage slot of a validator's entry in the given mapping
+// of the smoothing pool.
+func smoothingKey(addr common.Address, slot common.Hash) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(addr[:], 32), slot[:])
+}
+
+// setSmoothingState writes to the storage of the smoothing pool, giving it a
+// nonce first, as accounts without one are deleted as empty regardless of their
+// storage.
+func setSmoothingState(state vm.StateDB, key, value common.Hash) {
+	if state.GetNonce(SmoothingPoolAddress) == 0 {
+		state.SetNonce(SmoothingPoolAddress, 1, tracing.NonceChangeUnspecified)
+	}
+	state.SetState(SmoothingPoolAddress, key, value)
+}
+
+// smoothingFlag encodes a membership for the storage of the smoothing pool.
+func smoothingFlag(member bool) common.Hash {
+	if member {
+		return common.BigToHash(common.Big1)
+	}
+	return common.Hash{}
+}
+
+// processSmoothingMembership records the smoothing pool joins and leaves sent in
+// the transactions of a block, to take effect from the next epoch. Transactions
+// whose sender cannot be recovered or carrying other data are ignored, they are
+// still included.
+func (e *Equa) processSmoothingMembership(header *types.Header, state vm.StateDB, txs []*types.Transaction) {
+	epoch := scheduleEpoch(header.Number.Uint64(), e.config.Epoch)
+	for _, tx := range txs {
+		if tx.To() == nil || *tx.To() != SmoothingPoolAddress {
+			continue
+		}
+		var member bool
+		switch {
+		case bytes.Equal(tx.Data(), smoothingJoin):
+			member = true
+		case bytes.Equal(tx.Data(), smoothingLeave):
+		default:
+			continue
+		}
+		from, err := txSender(e.senders, tx)
+		if err != nil {
+			log.Debug("Ignoring smoothing pool membership", "tx", tx.Hash(), "err", err)
+			continue
+		}
+		// Settle the membership in effect until the request takes effect, any
+		// earlier request of the epoch being superseded
+		setSmoothingState(state, smoothingKey(from, smoothingMembersSlot), smoothingFlag(smoothingMember(state, from, epoch)))
+		setSmoothingState(state, smoothingKey(from, smoothingRequestedSlot), smoothingFlag(member))
+		setSmoothingState(state, smoothingKey(from, smoothingEffectiveSlot), common.BigToHash(new(big.Int).SetUint64(epoch+1)))
+	}
+}
+
+// smoothingMember checks if a validator is a member of the smoothing pool in the
+// given epoch, regardless of its registration.
+func smoothingMember(state vm.StateDB, addr common.Address, epoch uint64) bool {
+	slot := smoothingMembersSlot
+	if effective := state.GetState(SmoothingPoolAddress, smoothingKey(addr, smoothingEffectiveSlot)).Big(); effective.Sign() != 0 && effective.Uint64() <= epoch {
+		slot = smoothingRequestedSlot
+	}
+	return state.GetState(SmoothingPoolAddress, smoothingKey(addr, slot)) != (common.Hash{})
+}
+
+// inSmoothingPool checks if a validator participates in the smoothing pool in
+// the given epoch, being registered as active and not slashed in the given state.
+func (e *Equa) inSmoothingPool(state vm.StateDB, addr common.Address, epoch uint64) bool {
+	reg := newValidatorRegistry(state, e.config).get(addr)
+	if reg.status != registrationActive || reg.slashed.Sign() != 0 {
+		return false
+	}
+	return smoothingMember(state, addr, epoch)
+}
+
+// smoothingPoolMembers returns the registrations of the validators participating
+// in the smoothing pool in the given epoch, ordered by address.
+func (e *Equa) smoothingPoolMembers(state vm.StateDB, epoch uint64) []*registration {
+	var members []*registration
+	for _, reg := range newValidatorRegistry(state, e.config).registrations(registrationActive) {
+		if reg.slashed.Sign() != 0 {
+			continue
+		}
+		if smoothingMember(state, reg.address, epoch) {
+			members = append(members, reg)
+		}
+	}
+	return members
+}
+
+// smoothedRewards returns the rewards a validator received from the smoothing
+// pool in total.
+func smoothedRewards(state vm.StateDB, addr common.Address) *big.Int {
+	return state.GetState(SmoothingPoolAddress, smoothingKey(addr, smoothingPaidSlot)).Big()
+}
@@ -4,84 +4,218 @@
 package equa
 
 import (
+	"bytes"
+	"container/heap"
+	"errors"
 	"math/big"
 	"sort"
+	"sync"
 
 	"github.com/equa/go-equa/common"
-	"github.com/equa/go-equa/ethdb"
 	"github.com/equa/go-equa/params"
 )
 
+// defaultValidatorClass is the validator class used if the chain config does
+// not define any.
+var defaultValidatorClass = params.EquaValidatorClass{
+	Name:     "standard",
+	MinStake: new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)), // 32 EQUA minimum stake
+}
+
+var errInvalidSlashPercentage = errors.New("slashing percentage exceeds 100")
+
 // Validator represents a validator in the EQUA network
 type Validator struct {
 	Address     common.Address // Validator's address
 	Stake       *big.Int       // Amount staked
-	KeyShare    []byte         // BLS key share for threshold encryption
 	PublicKey   []byte         // BLS public key
 	LastBlock   uint64         // Last block proposed
 	Slashed     bool           // Whether validator has been slashed
 	SlashAmount *big.Int       // Amount slashed
+
+	Withdrawal common.Address // Account the stake is withdrawn to, named by the withdrawal credentials
+
+	Filter   *FilterDeclaration // Publicly declared contract filter, if any
+	Identity *NodeIdentity      // Self-reported node identity, if any
 }
 
-// StakeManager manages validator stakes and selection
+// StakeManager manages validator stakes and selection. The validators are
+// recorded in the state, see validatorRegistry, the stake manager holding those
+// of the block it was last loaded from.
 type StakeManager struct {
-	config     *params.EquaConfig
-	db         ethdb.Database
-	validators map[common.Address]*Validator
-	totalStake *big.Int
+	config *params.EquaConfig
+
+	lock        sync.RWMutex // Protects the fields below
+	validators  map[common.Address]*Validator
+	totalStake  *big.Int
+	exits       map[common.Address]*VoluntaryExit // Voluntary exits queued on chain, awaiting their epoch
+	withdrawals map[common.Address]*Withdrawal    // Stake of exited validators, by validator
+	queue       []*PendingValidator               // Validators awaiting activation, in queue order
+	head        common.Hash                       // Block the validators were loaded from, zero if not loaded yet
 }
 
 // NewStakeManager creates a new stake manager
-func NewStakeManager(db ethdb.Database, config *params.EquaConfig) *StakeManager {
+func NewStakeManager(config *params.EquaConfig) *StakeManager {
 	return &StakeManager{
-		config:     config,
-		db:         db,
-		validators: make(map[common.Address]*Validator),
-		totalStake: big.NewInt(0),
+		config:      config,
+		validators:  make(map[common.Address]*Validator),
+		totalStake:  big.NewInt(0),
+		exits:       make(map[common.Address]*VoluntaryExit),
+		withdrawals: make(map[common.Address]*Withdrawal),
 	}
 }
 
 // AddValidator adds a new validator to the set
-func (sm *StakeManager) AddValidator(addr common.Address, stake *big.Int, keyShare, pubKey []byte) error {
+func (sm *StakeManager) AddValidator(addr common.Address, stake *big.Int, pubKey []byte) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sm.addValidator(addr, stake, pubKey)
+	return nil
+}
+
+// addValidator adds a new validator to the set, the lock being held.
+func (sm *StakeManager) addValidator(addr common.Address, stake *big.Int, pubKey []byte) {
 	validator := &Validator{
 		Address:     addr,
 		Stake:       new(big.Int).Set(stake),
-		KeyShare:    keyShare,
 		PublicKey:   pubKey,
 		LastBlock:   0,
 		Slashed:     false,
 		SlashAmount: big.NewInt(0),
+
+		Withdrawal: addr,
 	}
 
 	sm.validators[addr] = validator
 	sm.totalStake.Add(sm.totalStake, stake)
-
-	return nil
 }
 
 // RemoveValidator removes a validator from the set
 func (sm *StakeManager) RemoveValidator(addr common.Address) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sm.removeValidator(addr)
+	return nil
+}
+
+// removeValidator removes a validator from the set, the lock being held.
+func (sm *StakeManager) removeValidator(addr common.Address) {
 	if validator, exists := sm.validators[addr]; exists {
 		sm.totalStake.Sub(sm.totalStake, validator.Stake)
 		delete(sm.validators, addr)
 	}
+}
+
+// DeclareFilter verifies a signed filter declaration and publishes it as the
+// validator's contract filter, replacing any previous declaration.
+func (sm *StakeManager) DeclareFilter(decl *FilterDeclaration) error {
+	if err := decl.Verify(); err != nil {
+		return err
+	}
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	validator, exists := sm.validators[decl.Validator]
+	if !exists {
+		return errInvalidValidator
+	}
+	validator.Filter = decl
 	return nil
 }
 
+// DeclareIdentity verifies a signed node identity and records it for the
+// validator, replacing any previous one.
+func (sm *StakeManager) DeclareIdentity(id *NodeIdentity) error {
+	if err := id.Verify(); err != nil {
+		return err
+	}
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	validator, exists := sm.validators[id.Validator]
+	if !exists {
+		return errInvalidValidator
+	}
+	validator.Identity = id
+	return nil
+}
+
+// PendingExits returns the voluntary exits that have not been processed yet.
+func (sm *StakeManager) PendingExits() []*VoluntaryExit {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	return sm.pendingExits()
+}
+
+// pendingExits returns the voluntary exits that have not been processed yet,
+// ordered by validator, the lock being held.
+func (sm *StakeManager) pendingExits() []*VoluntaryExit {
+	exits := make([]*VoluntaryExit, 0, len(sm.exits))
+	for _, exit := range sm.exits {
+		exits = append(exits, exit)
+	}
+	sort.Slice(exits, func(i, j int) bool {
+		return bytes.Compare(exits[i].Validator[:], exits[j].Validator[:]) < 0
+	})
+	return exits
+}
+
+// Withdrawals returns the stake of the exited validators as of the given epoch,
+// ordered by validator.
+func (sm *StakeManager) Withdrawals(epoch uint64) []*Withdrawal {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	return sm.withdrawalsAt(epoch)
+}
+
+// withdrawalsAt returns the stake of the exited validators as of the given
+// epoch, the lock being held.
+func (sm *StakeManager) withdrawalsAt(epoch uint64) []*Withdrawal {
+	withdrawals := make([]*Withdrawal, 0, len(sm.withdrawals))
+	for _, w := range sm.withdrawals {
+		cpy := *w
+		cpy.Amount = new(big.Int).Set(w.Amount)
+		cpy.Withdrawable = epoch >= w.WithdrawableEpoch
+		withdrawals = append(withdrawals, &cpy)
+	}
+	sort.Slice(withdrawals, func(i, j int) bool {
+		return bytes.Compare(withdrawals[i].Validator[:], withdrawals[j].Validator[:]) < 0
+	})
+	return withdrawals
+}
+
 // HasStake checks if an address has stake
 func (sm *StakeManager) HasStake(addr common.Address) bool {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
 	validator, exists := sm.validators[addr]
 	return exists && validator.Stake.Cmp(big.NewInt(0)) > 0 && !validator.Slashed
 }
 
 // GetValidator returns validator information
 func (sm *StakeManager) GetValidator(addr common.Address) (*Validator, bool) {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
 	validator, exists := sm.validators[addr]
 	return validator, exists
 }
 
 // GetValidators returns all active validators
 func (sm *StakeManager) GetValidators() []*Validator {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	return sm.activeValidators()
+}
+
+// activeValidators returns all active validators, the lock being held.
+func (sm *StakeManager) activeValidators() []*Validator {
 	validators := make([]*Validator, 0, len(sm.validators))
 	for _, validator := range sm.validators {
 		if !validator.Slashed && validator.Stake.Cmp(big.NewInt(0)) > 0 {
@@ -93,22 +227,65 @@ func (sm *StakeManager) GetValidators() []*Validator {
 
 // GetTopStakers returns the top N validators by stake
 func (sm *StakeManager) GetTopStakers(n int) []*Validator {
-	validators := sm.GetValidators()
-
-	// Sort by stake descending
-	sort.Slice(validators, func(i, j int) bool {
-		return validators[i].Stake.Cmp(validators[j].Stake) > 0
-	})
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
 
+	validators := sm.activeValidators()
 	if n > len(validators) {
 		n = len(validators)
 	}
+	if n <= 0 {
+		return nil
+	}
+	// Keep the best n validators in a heap with the weakest on top, which is
+	// considerably cheaper than sorting large validator sets
+	top := make(weakestFirst, 0, n)
+	for _, validator := range validators {
+		switch {
+		case len(top) < n:
+			heap.Push(&top, validator)
+		case rankedBefore(validator, top[0]):
+			top[0] = validator
+			heap.Fix(&top, 0)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool { return rankedBefore(top[i], top[j]) })
+	return top
+}
 
-	return validators[:n]
+// rankedBefore reports whether validator a ranks before b by stake, breaking
+// ties by address so that every node derives the same ordering.
+func rankedBefore(a, b *Validator) bool {
+	if c := a.Stake.Cmp(b.Stake); c != 0 {
+		return c > 0
+	}
+	return bytes.Compare(a.Address[:], b.Address[:]) < 0
+}
+
+// weakestFirst is a heap of validators with the lowest ranked one on top.
+type weakestFirst []*Validator
+
+func (h weakestFirst) Len() int           { return len(h) }
+func (h weakestFirst) Less(i, j int) bool { return rankedBefore(h[j], h[i]) }
+func (h weakestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *weakestFirst) Push(x any)        { *h = append(*h, x.(*Validator)) }
+func (h *weakestFirst) Pop() any {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
 }
 
 // GetStakeWeight returns the stake weight for a validator (stake / total_stake)
 func (sm *StakeManager) GetStakeWeight(addr common.Address) *big.Int {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	return sm.stakeWeight(addr)
+}
+
+// stakeWeight returns the stake weight for a validator, the lock being held.
+func (sm *StakeManager) stakeWeight(addr common.Address) *big.Int {
 	validator, exists := sm.validators[addr]
 	if !exists || validator.Slashed {
 		return big.NewInt(0)
@@ -121,34 +298,21 @@ func (sm *StakeManager) GetStakeWeight(addr common.Address) *big.Int {
 	// Return stake weight as percentage (stake * 10000 / totalStake)
 	weight := new(big.Int).Mul(validator.Stake, big.NewInt(10000))
 	weight.Div(weight, sm.totalStake)
-	return weight
-}
 
-// SlashValidator slashes a validator for malicious behavior
-func (sm *StakeManager) SlashValidator(addr common.Address, percentage uint64, reason string) error {
-	validator, exists := sm.validators[addr]
-	if !exists {
-		return errInvalidValidator
+	// Cap the weight as configured for the validator's class
+	if class := sm.validatorClass(validator); class.MaxWeight > 0 {
+		if limit := new(big.Int).SetUint64(class.MaxWeight); weight.Cmp(limit) > 0 {
+			weight = limit
+		}
 	}
-
-	// Calculate slash amount
-	slashAmount := new(big.Int).Mul(validator.Stake, big.NewInt(int64(percentage)))
-	slashAmount.Div(slashAmount, big.NewInt(100))
-
-	// Apply slash
-	validator.Slashed = true
-	validator.SlashAmount.Add(validator.SlashAmount, slashAmount)
-	validator.Stake.Sub(validator.Stake, slashAmount)
-	sm.totalStake.Sub(sm.totalStake, slashAmount)
-
-	// Log slashing event
-	// TODO: Emit slashing event
-
-	return nil
+	return weight
 }
 
 // UpdateLastBlock updates the last block proposed by a validator
 func (sm *StakeManager) UpdateLastBlock(addr common.Address, blockNumber uint64) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
 	if validator, exists := sm.validators[addr]; exists {
 		validator.LastBlock = blockNumber
 	}
@@ -156,31 +320,101 @@ func (sm *StakeManager) UpdateLastBlock(addr common.Address, blockNumber uint64)
 
 // GetTotalStake returns the total stake in the network
 func (sm *StakeManager) GetTotalStake() *big.Int {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
 	return new(big.Int).Set(sm.totalStake)
 }
 
 // IsEligible checks if a validator is eligible to propose/validate
 func (sm *StakeManager) IsEligible(addr common.Address) bool {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
 	validator, exists := sm.validators[addr]
 	if !exists {
 		return false
 	}
 
-	// Must have stake, not be slashed, and meet minimum requirements
-	minStake := big.NewInt(32) // 32 EQUA minimum stake
-	minStake.Mul(minStake, big.NewInt(1e18))
+	// Must have stake, not be slashed, and meet the minimum of its class
+	minStake := sm.validatorClass(validator).MinStake
 
 	return !validator.Slashed &&
 		   validator.Stake.Cmp(minStake) >= 0
 }
 
-// GetKeyShares returns key shares for threshold decryption
-func (sm *StakeManager) GetKeyShares(validators []common.Address) [][]byte {
-	shares := make([][]byte, 0, len(validators))
-	for _, addr := range validators {
-		if validator, exists := sm.validators[addr]; exists && !validator.Slashed {
-			shares = append(shares, validator.KeyShare)
+// Classes returns the validator classes, each validator falling in the one with
+// the highest minimum stake it meets.
+func (sm *StakeManager) Classes() []params.EquaValidatorClass {
+	return validatorClasses(sm.config)
+}
+
+// baseClass returns the validator class with the lowest minimum stake, the one
+// a validator needs to meet to be eligible at all.
+func (sm *StakeManager) baseClass() *params.EquaValidatorClass {
+	return baseClass(sm.config)
+}
+
+// validatorClass returns the class of a validator, see stakeClass.
+func (sm *StakeManager) validatorClass(validator *Validator) *params.EquaValidatorClass {
+	return stakeClass(sm.config, validator.Stake)
+}
+
+// validatorClasses returns the validator classes of the configuration, the
+// default class if it defines none.
+func validatorClasses(config *params.EquaConfig) []params.EquaValidatorClass {
+	if len(config.ValidatorClasses) == 0 {
+		return []params.EquaValidatorClass{defaultValidatorClass}
+	}
+	return config.ValidatorClasses
+}
+
+// baseClass returns the validator class of the configuration with the lowest
+// minimum stake.
+func baseClass(config *params.EquaConfig) *params.EquaValidatorClass {
+	classes := validatorClasses(config)
+	base := &classes[0]
+	for i := range classes {
+		if classes[i].MinStake.Cmp(base.MinStake) < 0 {
+			base = &classes[i]
 		}
 	}
-	return shares
-}
\ No newline at end of file
+	return base
+}
+
+// stakeClass returns the class of a validator with the given stake, the one
+// with the highest minimum stake the validator meets. Being derived from the
+// stake, the class is the same on every node. Validators short of every minimum
+// are in the base class, and not eligible.
+func stakeClass(config *params.EquaConfig, stake *big.Int) *params.EquaValidatorClass {
+	classes := validatorClasses(config)
+	class := baseClass(config)
+	for i := range classes {
+		if stake.Cmp(classes[i].MinStake) >= 0 && classes[i].MinStake.Cmp(class.MinStake) > 0 {
+			class = &classes[i]
+		}
+	}
+	return class
+}
+
+// RewardMultiplier returns the block reward multiplier, in percent, of the
+// class of the given validator.
+func (sm *StakeManager) RewardMultiplier(addr common.Address) uint64 {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	validator, exists := sm.validators[addr]
+	if !exists {
+		return 100
+	}
+	return classRewardMultiplier(sm.config, validator.Stake)
+}
+
+// classRewardMultiplier returns the block reward multiplier, in percent, of the
+// class of the given stake.
+func classRewardMultiplier(config *params.EquaConfig, stake *big.Int) uint64 {
+	if multiplier := stakeClass(config, stake).RewardMultiplier; multiplier != 0 {
+		return multiplier
+	}
+	return 100
+}
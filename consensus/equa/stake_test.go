@@ -0,0 +1,145 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that validators fall in the class with the highest minimum stake they
+// meet, and that classes apply their own weight cap and reward multiplier.
+func TestValidatorClasses(t *testing.T) {
+	ether := big.NewInt(1e18)
+	config := &params.EquaConfig{
+		ValidatorClasses: []params.EquaValidatorClass{
+			{Name: "high", MinStake: new(big.Int).Mul(big.NewInt(1000), ether), MaxWeight: 5000, RewardMultiplier: 150},
+			{Name: "standard", MinStake: new(big.Int).Mul(big.NewInt(32), ether)},
+		},
+	}
+	sm := NewStakeManager(config)
+
+	var (
+		small = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		large = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		short = common.HexToAddress("0x3000000000000000000000000000000000000003")
+	)
+	sm.AddValidator(small, new(big.Int).Mul(big.NewInt(32), ether), nil)
+	sm.AddValidator(large, new(big.Int).Mul(big.NewInt(1000), ether), nil)
+	sm.AddValidator(short, new(big.Int).Mul(big.NewInt(31), ether), nil)
+
+	for addr, want := range map[common.Address]string{small: "standard", large: "high", short: "standard"} {
+		if validator, _ := sm.GetValidator(addr); sm.validatorClass(validator).Name != want {
+			t.Errorf("validator %x class mismatch: have %q, want %q", addr, sm.validatorClass(validator).Name, want)
+		}
+	}
+	if weight := sm.GetStakeWeight(large); weight.Uint64() != 5000 {
+		t.Errorf("weight cap mismatch: have %v, want 5000", weight)
+	}
+	if multiplier := sm.RewardMultiplier(large); multiplier != 150 {
+		t.Errorf("reward multiplier mismatch: have %d, want 150", multiplier)
+	}
+	if multiplier := sm.RewardMultiplier(small); multiplier != 100 {
+		t.Errorf("default reward multiplier mismatch: have %d, want 100", multiplier)
+	}
+	if !sm.IsEligible(small) || !sm.IsEligible(large) {
+		t.Errorf("validators meeting their class minimum not eligible")
+	}
+	if sm.IsEligible(short) {
+		t.Errorf("validator short of every class minimum eligible")
+	}
+	// Validators slashed below the minimum of their class fall in a lower one
+	if err := slashTestValidator(sm, large, 10); err != nil {
+		t.Fatalf("failed to slash: %v", err)
+	}
+	if validator, _ := sm.GetValidator(large); sm.validatorClass(validator).Name != "standard" {
+		t.Errorf("slashed validator class mismatch: have %q, want %q", sm.validatorClass(validator).Name, "standard")
+	}
+	if multiplier := sm.RewardMultiplier(large); multiplier != 100 {
+		t.Errorf("slashed reward multiplier mismatch: have %d, want 100", multiplier)
+	}
+}
+
+// Tests that the validator set can be read over the API while blocks change it,
+// which the race detector checks.
+func TestStakeManagerConcurrency(t *testing.T) {
+	var (
+		config     = &params.EquaConfig{Epoch: 10, ChurnLimit: 4}
+		sm         = NewStakeManager(config)
+		stake      = new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18))
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		registry   = newValidatorRegistry(statedb, config)
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := byte(0); i < 100; i++ {
+			addr := common.Address{i}
+			registry.put(&registration{address: addr, status: registrationActive, stake: new(big.Int).Set(stake), slashed: new(big.Int)})
+			registry.slash(addr, 10)
+			sm.load(statedb, common.Hash{i, 1})
+			registry.processExits([]*VoluntaryExit{{Validator: addr, Epoch: 1}}, 1)
+			sm.load(statedb, common.Hash{i, 2})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := byte(0); i < 100; i++ {
+			sm.GetValidators()
+			sm.GetStakeWeight(common.Address{i})
+			sm.Withdrawals(1)
+			sm.ValidatorQueue(1)
+		}
+	}()
+	wg.Wait()
+}
+
+// slashTestValidator slashes a validator as a block executing slashing evidence
+// would: the validators and queues of the stake manager are recorded in a
+// registry, the validator is slashed in it and the registry is loaded back.
+func slashTestValidator(sm *StakeManager, addr common.Address, percentage uint64) error {
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	registry := newValidatorRegistry(statedb, &params.EquaConfig{})
+	registry.initialize()
+
+	sm.lock.RLock()
+	head := sm.head
+	for _, validator := range sm.validators {
+		registry.put(&registration{address: validator.Address, status: registrationActive, stake: new(big.Int).Set(validator.Stake), slashed: new(big.Int).Set(validator.SlashAmount), key: validator.PublicKey})
+	}
+	for _, pending := range sm.queue {
+		registry.put(&registration{address: pending.Address, status: registrationQueued, stake: new(big.Int).Set(pending.Stake), slashed: new(big.Int), epoch: pending.EligibilityEpoch, position: pending.position})
+	}
+	for _, w := range sm.withdrawals {
+		registry.put(&registration{address: w.Validator, status: registrationExited, stake: new(big.Int).Set(w.Amount), slashed: new(big.Int), epoch: w.ExitEpoch})
+	}
+	sm.lock.RUnlock()
+
+	if _, err := registry.slash(addr, percentage); err != nil {
+		return err
+	}
+	sm.load(statedb, head)
+	return nil
+}
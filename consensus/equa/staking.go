@@ -0,0 +1,129 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/vm"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/log"
+)
+
+// maxStakingValidators is the number of registry entries read from the staking
+// contract, bounding the work done at an epoch boundary.
+const maxStakingValidators = 1 << 16
+
+// The staking contract keeps its registry in the first two storage slots, as
+// laid out by the Solidity compiler for:
+//
+//	address[] validators;                  // slot 0
+//	mapping(address => uint256) stakes;    // slot 1
+//
+// Registrations append to the list, stake increases and withdrawals update the
+// mapping. Entries with zero stake have withdrawn.
+var (
+	stakingValidatorsSlot = common.Hash{}
+	stakingStakesSlot     = common.BigToHash(common.Big1)
+)
+
+// StakingEntry is a validator registered in the staking contract.
+type StakingEntry struct {
+	Address common.Address `json:"address"`
+	Stake   *big.Int       `json:"stake"`
+}
+
+// stakingStakeKey is the storage slot of a validator's stake in the staking
+// contract.
+func stakingStakeKey(addr common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(addr[:], 32), stakingStakesSlot[:])
+}
+
+// readStakingRegistry reads the validators with non-zero stake from the storage
+// of the staking contract.
+func readStakingRegistry(state vm.StateDB, contract common.Address) []StakingEntry {
+	length := state.GetState(contract, stakingValidatorsSlot).Big()
+	if length.Cmp(big.NewInt(maxStakingValidators)) > 0 {
+		log.Warn("Staking registry truncated", "length", length, "limit", maxStakingValidators)
+		length.SetUint64(maxStakingValidators)
+	}
+	var (
+		base    = crypto.Keccak256Hash(stakingValidatorsSlot[:]).Big()
+		seen    = make(map[common.Address]bool)
+		entries []StakingEntry
+	)
+	for i := uint64(0); i < length.Uint64(); i++ {
+		slot := common.BigToHash(new(big.Int).Add(base, new(big.Int).SetUint64(i)))
+		addr := common.BytesToAddress(state.GetState(contract, slot).Bytes())
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		stake := state.GetState(contract, stakingStakeKey(addr)).Big()
+		if stake.Sign() == 0 {
+			continue
+		}
+		entries = append(entries, StakingEntry{Address: addr, Stake: stake})
+	}
+	return entries
+}
+
+// syncStaking aligns the validator registry with the registry of the staking
+// contract at the given epoch. Validators no longer registered are removed, new
+// registrations are queued for activation and the stakes of active and queued
+// validators are updated, queued ones keeping their place in the queue.
+// Validators that left through a voluntary exit are not readmitted while still
+// registered, their stake counting as withdrawn once they are not.
+func (r *validatorRegistry) syncStaking(entries []StakingEntry, epoch uint64) {
+	registered := make(map[common.Address]bool, len(entries))
+	for _, entry := range entries {
+		registered[entry.Address] = true
+	}
+	for _, reg := range r.registrations(registrationActive, registrationQueued, registrationExited) {
+		if registered[reg.address] {
+			continue
+		}
+		if reg.status == registrationExited {
+			reg.status = registrationWithdrawn
+		} else {
+			reg.status, reg.stake, reg.epoch, reg.position = registrationNone, new(big.Int), 0, 0
+		}
+		r.put(reg)
+	}
+	for _, entry := range entries {
+		reg := r.get(entry.Address)
+		switch reg.status {
+		case registrationExited:
+			// Not readmitted until withdrawn
+		case registrationActive, registrationQueued:
+			if reg.stake.Cmp(entry.Stake) != 0 {
+				reg.stake = new(big.Int).Set(entry.Stake)
+				r.put(reg)
+			}
+		default:
+			r.enqueue(entry.Address, entry.Stake, nil, epoch)
+		}
+	}
+}
+
+// stakingEnabled reports whether the validator set is derived from a staking
+// contract.
+func (e *Equa) stakingEnabled() bool {
+	return e.config.StakingContract != (common.Address{})
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// testRegistry writes a staking contract registry into the state.
+func testRegistry(statedb *state.StateDB, contract common.Address, stakes map[common.Address]int64, order ...common.Address) {
+	statedb.SetState(contract, stakingValidatorsSlot, common.BigToHash(big.NewInt(int64(len(order)))))
+	base := crypto.Keccak256Hash(stakingValidatorsSlot[:]).Big()
+	for i, addr := range order {
+		slot := common.BigToHash(new(big.Int).Add(base, big.NewInt(int64(i))))
+		statedb.SetState(contract, slot, common.BytesToHash(addr[:]))
+	}
+	for addr, stake := range stakes {
+		slot := crypto.Keccak256Hash(common.LeftPadBytes(addr[:], 32), stakingStakesSlot[:])
+		statedb.SetState(contract, slot, common.BigToHash(new(big.Int).Mul(big.NewInt(stake), big.NewInt(1e18))))
+	}
+}
+
+// Tests that the validator set follows registrations, stake increases and
+// withdrawals in the staking contract, and that voluntary exits are honoured
+// until the validator withdraws.
+func TestStakingRegistry(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000000e9a02")
+		genesis  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		joiner   = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		leaver   = common.HexToAddress("0x3000000000000000000000000000000000000003")
+		ether    = big.NewInt(1e18)
+	)
+	config := &params.EquaConfig{
+		StakingContract:   contract,
+		ChurnLimit:        4,
+		InitialValidators: []params.EquaInitialValidator{{Address: genesis, Stake: new(big.Int).Mul(big.NewInt(32), ether)}},
+	}
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	registry := newValidatorRegistry(statedb, config)
+	sm := NewStakeManager(config)
+
+	testRegistry(statedb, contract, map[common.Address]int64{genesis: 64, joiner: 32, leaver: 32}, genesis, joiner, leaver, joiner)
+	registry.syncStaking(readStakingRegistry(statedb, contract), 0)
+	sm.load(statedb, common.Hash{1})
+
+	if have := len(sm.GetValidators()); have != 1 {
+		t.Fatalf("registrations activated before the epoch boundary: have %d validators", have)
+	}
+	// Syncing again keeps the queued registrations eligible
+	registry.syncStaking(readStakingRegistry(statedb, contract), 1)
+	registry.activate(1)
+	sm.load(statedb, common.Hash{2})
+	if have := len(sm.GetValidators()); have != 3 {
+		t.Fatalf("validator count mismatch: have %d, want 3", have)
+	}
+	if validator, _ := sm.GetValidator(genesis); validator.Stake.Cmp(new(big.Int).Mul(big.NewInt(64), ether)) != 0 {
+		t.Fatalf("stake increase not applied: have %v", validator.Stake)
+	}
+	if have, want := sm.GetTotalStake(), new(big.Int).Mul(big.NewInt(128), ether); have.Cmp(want) != 0 {
+		t.Fatalf("total stake mismatch: have %v, want %v", have, want)
+	}
+	// Exit one validator, withdraw another one and make sure the exit holds
+	registry.processExits([]*VoluntaryExit{{Validator: leaver, Epoch: 1}}, 1)
+
+	testRegistry(statedb, contract, map[common.Address]int64{joiner: 0}, genesis, joiner, leaver)
+	registry.syncStaking(readStakingRegistry(statedb, contract), 1)
+	sm.load(statedb, common.Hash{3})
+
+	if validators := sm.GetValidators(); len(validators) != 1 || validators[0].Address != genesis {
+		t.Fatalf("unexpected validators after withdrawal: %v", validators)
+	}
+	// Commit the state and make sure a fresh stake manager, as after a restart,
+	// loads the same validators from it
+	root, err := statedb.Commit(0, false, false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = state.New(root, statedb.Database())
+	restored := NewStakeManager(config)
+	restored.load(statedb, common.Hash{4})
+	if have, want := restored.GetTotalStake(), sm.GetTotalStake(); have.Cmp(want) != 0 {
+		t.Fatalf("restored total stake mismatch: have %v, want %v", have, want)
+	}
+	newValidatorRegistry(statedb, config).syncStaking(readStakingRegistry(statedb, contract), 2)
+	restored.load(statedb, common.Hash{5})
+	if _, exists := restored.GetValidator(leaver); exists {
+		t.Fatalf("exited validator readmitted after restart")
+	}
+	if w := restored.Withdrawals(2); len(w) != 1 || w[0].Validator != leaver || w[0].Withdrawn {
+		t.Fatalf("unexpected withdrawals of the exited validator: %v", w)
+	}
+}
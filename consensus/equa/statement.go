@@ -0,0 +1,195 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/rlp"
+)
+
+// Ordering policies stated in compliance statements, see OrderingPolicy. The
+// canonical one is first come first served by arrival time, with bundles placed
+// at their earliest member.
+const (
+	OrderingPolicyFCFS            = 1
+	OrderingPolicyPriorityAuction = 2
+	OrderingPolicyRandomBatch     = 3
+)
+
+// violationFalseStatement is the slashing violation for a block contradicting
+// its proposer's compliance statement.
+const violationFalseStatement = "False compliance statement"
+
+var (
+	errMissingStatement     = errors.New("missing compliance statement")
+	errInvalidStatement     = errors.New("malformed compliance statement")
+	errUnknownPolicy        = errors.New("unknown ordering policy")
+	errInvalidStatementSig  = errors.New("compliance statement not signed by proposer")
+	errStatementContradicts = errors.New("block contradicts compliance statement")
+	errStatementHolds       = errors.New("block complies with compliance statement")
+	errMissingSigner        = errors.New("no signer authorized to sign compliance statements")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
+
+// ComplianceStatement is a proposer's signed assertion, carried in the extra-data
+// of its block, that it ordered the block's transactions with the given policy
+// and did not add any after ordering. It commits to the set of transactions
+// handed to the orderer, so a block including anything else is provable
+// evidence of a false statement.
+type ComplianceStatement struct {
+	Policy    uint64      // Ordering policy applied
+	Inputs    common.Hash // Commitment to the transactions handed to the orderer
+	Signature []byte      // Proposer's signature over the statement and header
+
+	InclusionList *InclusionList `rlp:"optional,nil"` // Transactions the next block must include, signed separately
+	Ordering      *OrderingClaim `rlp:"optional,nil"` // Arrival times, ordering score and MEV of the block, signed separately
+	Seed          *common.Hash   `rlp:"optional,nil"` // Randomness random batches were shuffled with, checked against the chain
+}
+
+// orderingInputs returns the commitment to a set of transactions, independent
+// of their order.
+func orderingInputs(txs []*types.Transaction) common.Hash {
+	hashes := make([][]byte, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash().Bytes()
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i], hashes[j]) < 0 })
+	return crypto.Keccak256Hash(hashes...)
+}
+
+// statementSigData returns the data signed by the proposer, binding the
+// statement to the block's position and contents. The signature is made over
+// its Keccak256 hash.
+func statementSigData(header *types.Header, policy uint64, inputs common.Hash) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{header.ParentHash, header.Number, header.Coinbase, header.TxHash, policy, inputs})
+	return append([]byte("equa-compliance-statement"), enc...)
+}
+
+// decodeStatement extracts the compliance statement from a header's extra-data,
+// ignoring any validator set commitment and version signal, and checks that it
+// is well formed and signed by the header's coinbase.
+func decodeStatement(header *types.Header) (*ComplianceStatement, error) {
+	extra, _ := splitVersionSignal(header.Extra)
+	extra, _ = splitValidatorSet(extra)
+	if len(extra) == 0 {
+		return nil, errMissingStatement
+	}
+	statement := new(ComplianceStatement)
+	if err := rlp.DecodeBytes(extra, statement); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidStatement, err)
+	}
+	if statement.Policy < OrderingPolicyFCFS || statement.Policy > OrderingPolicyRandomBatch {
+		return nil, fmt.Errorf("%w: %d", errUnknownPolicy, statement.Policy)
+	}
+	if len(statement.Signature) != crypto.SignatureLength {
+		return nil, errInvalidStatementSig
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(statementSigData(header, statement.Policy, statement.Inputs)), statement.Signature)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != header.Coinbase {
+		return nil, errInvalidStatementSig
+	}
+	return statement, nil
+}
+
+// statementSeed returns the shuffle seed stated in the compliance statement of a
+// header, or the zero hash if it states none.
+func statementSeed(header *types.Header) common.Hash {
+	if statement, err := decodeStatement(header); err == nil && statement.Seed != nil {
+		return *statement.Seed
+	}
+	return common.Hash{}
+}
+
+// CheckStatement verifies a block against the compliance statement of its
+// proposer, returning errStatementContradicts if the block includes
+// transactions other than the ones committed to as ordering inputs.
+func CheckStatement(block *types.Block) error {
+	statement, err := decodeStatement(block.Header())
+	if err != nil {
+		return err
+	}
+	if orderingInputs(block.Transactions()) != statement.Inputs {
+		return errStatementContradicts
+	}
+	return nil
+}
+
+// Authorize injects a signing account into the consensus engine, used to sign
+// the compliance statements of the blocks it seals.
+func (e *Equa) Authorize(signer common.Address, signFn SignerFn) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.signer = signer
+	e.signFn = signFn
+}
+
+// signStatement attaches a compliance statement for the block's transactions
+// to the header, signed by the authorized signer, stating the shuffle seed of
+// random batches if not nil.
+func (e *Equa) signStatement(header *types.Header, txs []*types.Transaction, seed *common.Hash) error {
+	e.lock.RLock()
+	signer, signFn := e.signer, e.signFn
+	e.lock.RUnlock()
+
+	if signFn == nil {
+		return errMissingSigner
+	}
+	if signer != header.Coinbase {
+		return fmt.Errorf("%w: have %s, want %s", errUnauthorizedProposer, signer, header.Coinbase)
+	}
+	statement := &ComplianceStatement{
+		Policy: e.fairOrderer.Policy().ID(),
+		Inputs: orderingInputs(txs),
+		Seed:   seed,
+	}
+	data := statementSigData(header, statement.Policy, statement.Inputs)
+	sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeEquaStatement, data)
+	if err != nil {
+		return err
+	}
+	statement.Signature = sig
+
+	// Publish the pending transactions the next block must include
+	if e.featureEnabled(FeatureInclusionLists) {
+		if statement.InclusionList, err = e.signInclusionList(header, txs, signer, signFn); err != nil {
+			return err
+		}
+	}
+	// Claim the ordering metadata of the block
+	if e.featureEnabled(FeatureOrderingCommitments) {
+		if statement.Ordering, err = e.signOrderingClaim(header, txs, signer, signFn); err != nil {
+			return err
+		}
+	}
+	extra, err := rlp.EncodeToBytes(statement)
+	if err != nil {
+		return err
+	}
+	header.Extra = extra
+	return nil
+}
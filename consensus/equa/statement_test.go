@@ -0,0 +1,86 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/accounts"
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that compliance statements are bound to their proposer and block, and
+// that blocks including transactions beyond the committed inputs are detected.
+func TestComplianceStatement(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	engine := newTestEngine(t, 32, signer)
+	header := &types.Header{Number: big.NewInt(1), Coinbase: signer}
+	txs := newTestTransactions(t, 3)
+
+	if err := engine.signStatement(header, txs, nil); err != errMissingSigner {
+		t.Fatalf("unauthorized signing: have %v, want %v", err, errMissingSigner)
+	}
+	engine.Authorize(signer, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	})
+	if err := engine.signStatement(header, txs, nil); err != nil {
+		t.Fatalf("failed to sign statement: %v", err)
+	}
+	if _, err := decodeStatement(header); err != nil {
+		t.Fatalf("valid statement rejected: %v", err)
+	}
+	signaled := types.CopyHeader(header)
+	signaled.Extra = append(signaled.Extra, localVersionSignal().encode()...)
+	if _, err := decodeStatement(signaled); err != nil {
+		t.Fatalf("statement with version signal rejected: %v", err)
+	}
+	block := types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs})
+	if err := CheckStatement(block); err != nil {
+		t.Fatalf("compliant block rejected: %v", err)
+	}
+	// Transactions injected after ordering contradict the statement
+	injected := types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: append(txs, newTestTransactions(t, 1)...)})
+	if err := CheckStatement(injected); err != errStatementContradicts {
+		t.Fatalf("injected transaction: have %v, want %v", err, errStatementContradicts)
+	}
+	// The statement is bound to the proposer and the block
+	other := types.CopyHeader(header)
+	other.Coinbase = common.Address{0x01}
+	if _, err := decodeStatement(other); err != errInvalidStatementSig {
+		t.Fatalf("statement of other proposer: have %v, want %v", err, errInvalidStatementSig)
+	}
+	other = types.CopyHeader(header)
+	other.Number = big.NewInt(2)
+	if _, err := decodeStatement(other); err != errInvalidStatementSig {
+		t.Fatalf("statement of other block: have %v, want %v", err, errInvalidStatementSig)
+	}
+	other.Extra = []byte{0x01}
+	if _, err := decodeStatement(other); !errors.Is(err, errInvalidStatement) {
+		t.Fatalf("malformed statement: have %v, want %v", err, errInvalidStatement)
+	}
+	// Only the selected proposer can sign
+	header.Coinbase = common.Address{0x01}
+	if err := engine.signStatement(header, txs, nil); !errors.Is(err, errUnauthorizedProposer) {
+		t.Fatalf("signing for other proposer: have %v, want %v", err, errUnauthorizedProposer)
+	}
+}
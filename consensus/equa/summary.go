@@ -0,0 +1,223 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/log"
+)
+
+var errEpochInProgress = errors.New("epoch not finished")
+
+// EpochSummary is the accounting of a finished epoch of the canonical chain.
+type EpochSummary struct {
+	Epoch       uint64                   `json:"epoch"`
+	First       uint64                   `json:"first"`  // First block of the epoch
+	Last        uint64                   `json:"last"`   // Last block of the epoch
+	Hash        common.Hash              `json:"hash"`   // Hash of the last block, identifying the chain summarized
+	MEV         *big.Int                 `json:"mev"`    // MEV detected in the blocks of the epoch
+	Burned      *big.Int                 `json:"burned"` // Share of the MEV burned
+	Rewards     *big.Int                 `json:"rewards"`
+	Slashings   int                      `json:"slashings"`   // Offenses detected or slashed in the epoch
+	Unscheduled int                      `json:"unscheduled"` // Blocks whose proposer schedule was no longer known, expected of no one
+	Validators  []*ValidatorEpochSummary `json:"validators"`  // Validators active in the epoch, by address
+}
+
+// ValidatorEpochSummary is the activity of a validator in an epoch.
+type ValidatorEpochSummary struct {
+	Address            common.Address   `json:"address"`
+	Expected           int              `json:"expected"`           // Blocks the validator was scheduled to propose
+	Proposed           int              `json:"proposed"`           // Blocks proposed
+	OrderingViolations int              `json:"orderingViolations"` // Pairs of transactions of known arrival proposed out of order
+	OrderingPairs      int              `json:"orderingPairs"`      // Pairs of transactions of known arrival proposed
+	MEV                *big.Int         `json:"mev"`                // MEV detected in the proposed blocks
+	Rewards            *big.Int         `json:"rewards"`            // Rewards credited, as recorded in the reward ledger
+	Slashings          []*SlashingEvent `json:"slashings"`
+}
+
+// epochSummaryKey is the database key of the summary of an epoch ending with
+// the given block.
+func epochSummaryKey(epoch uint64, hash common.Hash) []byte {
+	key := make([]byte, 0, len(rawdb.EquaEpochSummaryPrefix)+8+common.HashLength)
+	key = append(key, rawdb.EquaEpochSummaryPrefix...)
+	key = binary.BigEndian.AppendUint64(key, epoch)
+	return append(key, hash[:]...)
+}
+
+// SummarizeEpoch returns the summary of a finished epoch of the canonical chain,
+// summarizing it and storing the summary if not done before. Epochs replaced in
+// a reorg are summarized afresh.
+func (e *Equa) SummarizeEpoch(chain consensus.ChainHeaderReader, epoch uint64) (*EpochSummary, error) {
+	last := (epoch+1)*e.config.Epoch - 1
+	header := chain.GetHeaderByNumber(last)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %d", errEpochInProgress, epoch)
+	}
+	if blob, err := e.db.Get(epochSummaryKey(epoch, header.Hash())); err == nil {
+		summary := new(EpochSummary)
+		err := json.Unmarshal(blob, summary)
+		if err == nil {
+			return summary, nil
+		}
+		log.Error("Invalid stored epoch summary", "epoch", epoch, "err", err)
+	}
+	summary, err := e.summarizeEpoch(chain, epoch)
+	if err != nil {
+		return nil, err
+	}
+	summary.Hash = header.Hash()
+
+	blob, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.db.Put(epochSummaryKey(epoch, summary.Hash), blob); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// summarizeEpoch accounts for the blocks, ordering, MEV, rewards and offenses of
+// each validator over a finished epoch of the canonical chain.
+func (e *Equa) summarizeEpoch(chain consensus.ChainHeaderReader, epoch uint64) (*EpochSummary, error) {
+	summary := &EpochSummary{
+		Epoch:   epoch,
+		First:   epoch * e.config.Epoch,
+		Last:    (epoch+1)*e.config.Epoch - 1,
+		MEV:     new(big.Int),
+		Burned:  new(big.Int),
+		Rewards: new(big.Int),
+	}
+	validators := make(map[common.Address]*ValidatorEpochSummary)
+	validator := func(addr common.Address) *ValidatorEpochSummary {
+		if validators[addr] == nil {
+			validators[addr] = &ValidatorEpochSummary{Address: addr, MEV: new(big.Int), Rewards: new(big.Int), Slashings: []*SlashingEvent{}}
+		}
+		return validators[addr]
+	}
+	// The genesis block has no proposer, only account for the blocks after it
+	for n := max(summary.First, 1); n <= summary.Last; n++ {
+		block, receipts, err := blockReceipts(chain, n)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			mev       = e.mevDetector.detectConsensusMEV(block.Transactions(), receipts, e.consensusBaseFee(block.Header()))
+			burned, _ = e.splitMEV(mev)
+			proposer  = validator(block.Coinbase())
+		)
+		proposer.Proposed++
+		proposer.MEV.Add(proposer.MEV, mev)
+		violations, pairs := e.fairOrderer.OrderingViolations(block.Transactions())
+		proposer.OrderingViolations += violations
+		proposer.OrderingPairs += pairs
+
+		if scheduled, ok := e.scheduledProposer(chain, block.Header()); ok {
+			validator(scheduled).Expected++
+		} else {
+			summary.Unscheduled++
+		}
+		summary.MEV.Add(summary.MEV, mev)
+		summary.Burned.Add(summary.Burned, burned)
+
+		events, err := e.slashingEvents(chain, n)
+		if err != nil {
+			return nil, err
+		}
+		for _, ev := range events {
+			offender := validator(ev.Validator)
+			offender.Slashings = append(offender.Slashings, ev)
+			summary.Slashings++
+		}
+	}
+	// Rewards are credited to proposers and smoothing pool members, which need
+	// not have proposed in the epoch
+	candidates := make(map[common.Address]bool)
+	for addr := range validators {
+		candidates[addr] = true
+	}
+	for _, v := range e.stakeManager.GetValidators() {
+		candidates[v.Address] = true
+	}
+	for addr := range candidates {
+		rewards, err := e.validatorRewards(chain, addr, epoch, epoch)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := validators[addr]; ok || rewards.Total.Sign() > 0 {
+			v := validator(addr)
+			v.Rewards = rewards.Total
+			summary.Rewards.Add(summary.Rewards, v.Rewards)
+			summary.Validators = append(summary.Validators, v)
+		}
+	}
+	slices.SortFunc(summary.Validators, func(a, b *ValidatorEpochSummary) int {
+		return bytes.Compare(a.Address[:], b.Address[:])
+	})
+	return summary, nil
+}
+
+// StartEpochSummaries starts summarizing the epochs of the canonical chain as
+// they finish, until the engine is closed. Earlier epochs are summarized when
+// first requested.
+func (e *Equa) StartEpochSummaries(chain consensus.ChainReader) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(e.config.Period) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.summarizeLastEpoch(chain)
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// summarizeLastEpoch summarizes the latest finished epoch of the canonical chain
+// if not done before.
+func (e *Equa) summarizeLastEpoch(chain consensus.ChainHeaderReader) {
+	head := chain.CurrentHeader()
+	if head == nil || head.Number.Uint64()+1 < e.config.Epoch {
+		return
+	}
+	epoch := (head.Number.Uint64()+1)/e.config.Epoch - 1
+	if header := chain.GetHeaderByNumber((epoch+1)*e.config.Epoch - 1); header != nil {
+		if ok, _ := e.db.Has(epochSummaryKey(epoch, header.Hash())); ok {
+			return
+		}
+	}
+	summary, err := e.SummarizeEpoch(chain, epoch)
+	if err != nil {
+		log.Debug("Failed to summarize epoch", "epoch", epoch, "err", err)
+		return
+	}
+	log.Info("Summarized epoch", "epoch", epoch, "validators", len(summary.Validators), "mev", summary.MEV, "rewards", summary.Rewards, "slashings", summary.Slashings)
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/state"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+)
+
+// Tests that finished epochs are summarized per validator from the blocks and
+// the reward ledger, and that the summaries are stored for the chain they were
+// made of.
+func TestEpochSummary(t *testing.T) {
+	var (
+		alice  = common.Address{0x01}
+		bob    = common.Address{0x02}
+		carol  = common.Address{0x03}
+		engine = newTestEngine(t, 32, alice, bob, carol)
+		chain  = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+		}
+	)
+	engine.config.Epoch = 4
+	engine.config.ValidatorReward = 1000
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	addBlock := func(number int64, coinbase common.Address, extra []byte) *types.Block {
+		header := &types.Header{Number: big.NewInt(number), Coinbase: coinbase, Difficulty: common.Big1, Extra: extra}
+		if number > 0 {
+			header.ParentHash = chain.headers[number-1].Hash()
+		}
+		block := types.NewBlockWithHeader(header)
+		chain.headers = append(chain.headers[:number], header)
+		chain.blocks[block.Hash()] = block
+		engine.Finalize(chain, header, statedb, &types.Body{})
+		engine.followChain(chain)
+		return block
+	}
+	// Alice proposes every block but the ones Bob proposes at odd heights of
+	// the second epoch, Carol never proposes
+	for i := int64(0); i < 8; i++ {
+		coinbase := alice
+		if i >= 4 && i%2 == 1 {
+			coinbase = bob
+		}
+		addBlock(i, coinbase, nil)
+	}
+	summary, err := engine.SummarizeEpoch(chain, 1)
+	if err != nil {
+		t.Fatalf("failed to summarize epoch: %v", err)
+	}
+	if summary.First != 4 || summary.Last != 7 || summary.Hash != chain.headers[7].Hash() {
+		t.Errorf("epoch bounds mismatch: have %d-%d %x", summary.First, summary.Last, summary.Hash)
+	}
+	if len(summary.Validators) != 2 || summary.Validators[0].Address != alice || summary.Validators[1].Address != bob {
+		t.Fatalf("validators mismatch: have %d", len(summary.Validators))
+	}
+	for _, v := range summary.Validators {
+		if v.Proposed != 2 || v.Rewards.Int64() != 2000 || len(v.Slashings) != 0 {
+			t.Errorf("validator %s mismatch: proposed %d, rewards %v, slashings %d", v.Address, v.Proposed, v.Rewards, len(v.Slashings))
+		}
+	}
+	if summary.Rewards.Int64() != 4000 {
+		t.Errorf("total rewards mismatch: have %v, want 4000", summary.Rewards)
+	}
+	if ok, _ := engine.db.Has(epochSummaryKey(1, summary.Hash)); !ok {
+		t.Error("summary not stored")
+	}
+	// The genesis block isn't attributed to any proposer
+	if summary, err := engine.SummarizeEpoch(chain, 0); err != nil || len(summary.Validators) != 1 || summary.Validators[0].Proposed != 3 {
+		t.Errorf("genesis epoch mismatch: have %+v (%v)", summary, err)
+	}
+	if _, err := engine.SummarizeEpoch(chain, 2); !errors.Is(err, errEpochInProgress) {
+		t.Errorf("unfinished epoch: have %v, want %v", err, errEpochInProgress)
+	}
+	// A reorg replacing the end of the epoch is summarized afresh
+	addBlock(7, alice, []byte("reorg"))
+	summary, err = engine.SummarizeEpoch(chain, 1)
+	if err != nil {
+		t.Fatalf("failed to summarize reorged epoch: %v", err)
+	}
+	if summary.Hash != chain.headers[7].Hash() || summary.Validators[0].Proposed != 3 || summary.Validators[1].Proposed != 1 {
+		t.Errorf("reorged epoch mismatch: have %x, proposed %d and %d", summary.Hash, summary.Validators[0].Proposed, summary.Validators[1].Proposed)
+	}
+}
+
+// Tests that the MEV of an epoch is detected from the receipts of its blocks,
+// the same as when the blocks were processed.
+func TestEpochSummaryMEV(t *testing.T) {
+	var (
+		validator = common.Address{0x01}
+		bot, _    = crypto.GenerateKey()
+		victim, _ = crypto.GenerateKey()
+		engine    = newTestEngine(t, 32, validator)
+		funded    = []common.Address{crypto.PubkeyToAddress(bot.PublicKey), crypto.PubkeyToAddress(victim.PublicKey)}
+	)
+	engine.config.Epoch = 4
+
+	chain, _ := importTestChain(t, engine, funded, 4, func(i int, b *core.BlockGen) {
+		if i == 1 {
+			for _, tx := range sandwichTxs(newTestChainConfig(engine.config), bot, victim) {
+				b.AddTx(tx)
+			}
+		}
+	})
+	summary, err := engine.SummarizeEpoch(chain, 0)
+	if err != nil {
+		t.Fatalf("failed to summarize epoch: %v", err)
+	}
+	burned, _ := engine.splitMEV(testSandwichProfit)
+	if summary.MEV.Cmp(testSandwichProfit) != 0 || summary.Burned.Cmp(burned) != 0 {
+		t.Errorf("MEV mismatch: have %v burned %v, want %v burned %v", summary.MEV, summary.Burned, testSandwichProfit, burned)
+	}
+	if len(summary.Validators) != 1 || summary.Validators[0].MEV.Cmp(testSandwichProfit) != 0 {
+		t.Errorf("proposer MEV mismatch: have %+v", summary.Validators)
+	}
+}
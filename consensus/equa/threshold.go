@@ -4,13 +4,58 @@
 package equa
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"math/big"
 
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
 	"github.com/equa/go-equa/core/types"
 	"github.com/equa/go-equa/params"
 )
 
+// Threshold encryption uses hashed ElGamal over the BLS12-381 pairing. The
+// master public key is s·G2 for the shared secret s. A message is encrypted
+// under the key derived from e(r·G1, s·G2) and carries U = r·G1. Holders of a
+// share s_i publish decryption shares s_i·U, any threshold of which combine to
+// s·U and hence to e(s·U, G2), the same key. Signatures are BLS signatures in
+// G1 under public keys in G2, so the same key shares serve both.
+
+// encryptedTxMarker prefixes the data of transactions carrying an encrypted
+// transaction.
+const encryptedTxMarker = "ENCR"
+
+const (
+	keyShareLength     = 8 + fr.Bytes                                // Share index and secret share
+	pointShareLength   = 8 + bls12381.SizeOfG1AffineCompressed       // Share index and s_i·P, for decryption and signature shares
+	ciphertextOverhead = bls12381.SizeOfG1AffineCompressed + 12 + 16 // U, GCM nonce and tag
+)
+
+// signatureDST is the domain separation tag for hashing messages to G1.
+var signatureDST = []byte("EQUA_BLS_SIG_BLS12381G1_XMD:SHA-256_SSWU_RO_NUL_")
+
+var (
+	errNoThresholdKey      = errors.New("no threshold public key")
+	errInvalidThresholdKey = errors.New("invalid threshold public key")
+	errInvalidKeyShare     = errors.New("invalid key share")
+	errInvalidPointShare   = errors.New("invalid decryption or signature share")
+	errInvalidCiphertext   = errors.New("invalid threshold ciphertext")
+	errInvalidSignature    = errors.New("invalid BLS signature")
+	errInvalidBLSPublicKey = errors.New("invalid BLS public key")
+	errInsufficientShares  = errors.New("insufficient shares")
+	errDuplicateShare      = errors.New("duplicate share index")
+	errInvalidThreshold    = errors.New("invalid threshold parameters")
+	errNotEncryptedTx      = errors.New("transaction is not encrypted")
+	errNoSignatures        = errors.New("no signatures to aggregate")
+	errDecryptionFailed    = errors.New("threshold decryption failed")
+)
+
 // ThresholdCrypto handles threshold encryption and decryption
 type ThresholdCrypto struct {
 	config       *params.EquaConfig
@@ -31,76 +76,480 @@ func (tc *ThresholdCrypto) SetMasterPublicKey(pubKey []byte) {
 	tc.masterPubKey = pubKey
 }
 
-// EncryptTransaction encrypts a transaction using threshold encryption
-func (tc *ThresholdCrypto) EncryptTransaction(tx *types.Transaction) ([]byte, error) {
-	// Placeholder implementation
-	// In reality, this would use BLS threshold encryption
+// KeyShare is a share of the threshold secret key. Shares are points of a
+// polynomial whose constant term is the secret, evaluated at their index.
+type KeyShare struct {
+	Index  uint64
+	secret fr.Element
+}
+
+// ParseKeyShare decodes a key share from its index and secret share.
+func ParseKeyShare(enc []byte) (*KeyShare, error) {
+	if len(enc) != keyShareLength {
+		return nil, fmt.Errorf("%w: length %d", errInvalidKeyShare, len(enc))
+	}
+	share := &KeyShare{Index: binary.BigEndian.Uint64(enc)}
+	if share.Index == 0 {
+		return nil, fmt.Errorf("%w: zero index", errInvalidKeyShare)
+	}
+	if err := share.secret.SetBytesCanonical(enc[8:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidKeyShare, err)
+	}
+	return share, nil
+}
+
+// Bytes encodes the key share.
+func (ks *KeyShare) Bytes() []byte {
+	enc := make([]byte, keyShareLength)
+	binary.BigEndian.PutUint64(enc, ks.Index)
+	secret := ks.secret.Bytes()
+	copy(enc[8:], secret[:])
+	return enc
+}
+
+// PublicKey returns the public key of the share, s_i·G2.
+func (ks *KeyShare) PublicKey() []byte {
+	var pk bls12381.G2Affine
+	pk.ScalarMultiplicationBase(ks.secret.BigInt(new(big.Int)))
+	enc := pk.Bytes()
+	return enc[:]
+}
 
-	// Serialize transaction
+// DecryptionShare computes the share's contribution to decrypting the given
+// ciphertext. It reveals nothing about the share or the plaintext on its own.
+func (ks *KeyShare) DecryptionShare(ciphertext []byte) ([]byte, error) {
+	u, err := ciphertextPoint(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	var d bls12381.G1Affine
+	d.ScalarMultiplication(u, ks.secret.BigInt(new(big.Int)))
+	return encodeIndexedPoint(ks.Index, &d), nil
+}
+
+// Sign creates the share's partial signature of a message. A threshold of
+// partial signatures combines into a signature under the master public key.
+func (ks *KeyShare) Sign(msg []byte) ([]byte, error) {
+	h, err := bls12381.HashToG1(msg, signatureDST)
+	if err != nil {
+		return nil, err
+	}
+	var sig bls12381.G1Affine
+	sig.ScalarMultiplication(&h, ks.secret.BigInt(new(big.Int)))
+	return encodeIndexedPoint(ks.Index, &sig), nil
+}
+
+// EncryptTransaction encrypts a transaction under the master public key. The
+// ciphertext is submitted as the data of a transaction prefixed with "ENCR".
+func (tc *ThresholdCrypto) EncryptTransaction(tx *types.Transaction) ([]byte, error) {
 	txBytes, err := tx.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
+	return tc.Encrypt(txBytes)
+}
 
-	// Simple XOR encryption for now (not secure, just for structure)
-	key := make([]byte, 32)
-	rand.Read(key)
+// Encrypt encrypts a message under the master public key.
+func (tc *ThresholdCrypto) Encrypt(msg []byte) ([]byte, error) {
+	if len(tc.masterPubKey) == 0 {
+		return nil, errNoThresholdKey
+	}
+	pk, ok := decodeG2(tc.masterPubKey)
+	if !ok {
+		return nil, errInvalidThresholdKey
+	}
+	var r fr.Element
+	if _, err := r.SetRandom(); err != nil {
+		return nil, err
+	}
+	var u bls12381.G1Affine
+	u.ScalarMultiplicationBase(r.BigInt(new(big.Int)))
 
-	encrypted := make([]byte, len(txBytes))
-	for i, b := range txBytes {
-		encrypted[i] = b ^ key[i%32]
+	gt, err := bls12381.Pair([]bls12381.G1Affine{u}, []bls12381.G2Affine{*pk})
+	if err != nil {
+		return nil, err
 	}
+	aead, err := thresholdAEAD(&gt)
+	if err != nil {
+		return nil, err
+	}
+	uBytes := u.Bytes()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(msg)+ciphertextOverhead)
+	out = append(out, uBytes[:]...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, msg, uBytes[:]), nil
+}
 
-	return encrypted, nil
+// VerifyDecryptionShare checks that a decryption share of a ciphertext was
+// computed with the key share whose public key is given.
+func (tc *ThresholdCrypto) VerifyDecryptionShare(ciphertext, decryptionShare, publicShare []byte) error {
+	u, err := ciphertextPoint(ciphertext)
+	if err != nil {
+		return err
+	}
+	_, d, err := decodeIndexedPoint(decryptionShare)
+	if err != nil {
+		return err
+	}
+	pk, ok := decodeG2(publicShare)
+	if !ok {
+		return errInvalidBLSPublicKey
+	}
+	// e(s_i·U, G2) == e(U, s_i·G2)
+	var negU bls12381.G1Affine
+	negU.Neg(u)
+	_, _, _, g2 := bls12381.Generators()
+	ok, err = bls12381.PairingCheck([]bls12381.G1Affine{*d, negU}, []bls12381.G2Affine{g2, *pk})
+	if err != nil || !ok {
+		return errInvalidPointShare
+	}
+	return nil
 }
 
-// DecryptTransaction decrypts a transaction using validator key shares
-func (tc *ThresholdCrypto) DecryptTransaction(tx *types.Transaction, keyShares [][]byte) (*types.Transaction, error) {
-	// Placeholder implementation
-	// This would reconstruct the private key from shares and decrypt
+// CombineDecryptionShares decrypts a ciphertext from a threshold of decryption
+// shares. Shares should be verified beforehand, a single bad one fails the
+// decryption.
+func (tc *ThresholdCrypto) CombineDecryptionShares(ciphertext []byte, shares [][]byte) ([]byte, error) {
+	if _, err := ciphertextPoint(ciphertext); err != nil {
+		return nil, err
+	}
+	d, err := tc.combinePoints(shares)
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, g2 := bls12381.Generators()
+	gt, err := bls12381.Pair([]bls12381.G1Affine{*d}, []bls12381.G2Affine{g2})
+	if err != nil {
+		return nil, err
+	}
+	aead, err := thresholdAEAD(&gt)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ad     = ciphertext[:bls12381.SizeOfG1AffineCompressed]
+		nonce  = ciphertext[len(ad) : len(ad)+aead.NonceSize()]
+		sealed = ciphertext[len(ad)+aead.NonceSize():]
+	)
+	msg, err := aead.Open(nil, nonce, sealed, ad)
+	if err != nil {
+		return nil, errDecryptionFailed
+	}
+	return msg, nil
+}
 
-	if len(keyShares) < tc.threshold {
-		return nil, errors.New("insufficient key shares for decryption")
+// DecryptTransaction decrypts an encrypted transaction by combining the
+// decryption shares published for it by a threshold of key share holders. The
+// key shares themselves never leave their holders, see DecryptionShare.
+func (tc *ThresholdCrypto) DecryptTransaction(tx *types.Transaction, decryptionShares [][]byte) (*types.Transaction, error) {
+	data := tx.Data()
+	if len(data) <= len(encryptedTxMarker) || string(data[:len(encryptedTxMarker)]) != encryptedTxMarker {
+		return nil, errNotEncryptedTx
 	}
+	ciphertext := data[len(encryptedTxMarker):]
 
-	// For now, just return the original transaction
-	return tx, nil
+	txBytes, err := tc.CombineDecryptionShares(ciphertext, decryptionShares)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := new(types.Transaction)
+	if err := decrypted.UnmarshalBinary(txBytes); err != nil {
+		return nil, err
+	}
+	return decrypted, nil
 }
 
-// GenerateKeyShares generates key shares for validators
+// GenerateKeyShares splits a fresh secret key into n shares, any k of which can
+// decrypt and sign, returning the shares and the master public key. The caller
+// acts as a trusted dealer and learns the secret; validators that do not want
+// to rely on one run the distributed key generation instead, see DKGDealing.
 func (tc *ThresholdCrypto) GenerateKeyShares(n, k int) ([][]byte, []byte, error) {
-	// Generate master key
-	masterKey := make([]byte, 32)
-	rand.Read(masterKey)
-
-	// Generate public key (simplified)
-	publicKey := make([]byte, 64)
-	rand.Read(publicKey)
-
-	// Generate shares using Shamir's Secret Sharing (simplified)
+	if k < 1 || k > n {
+		return nil, nil, fmt.Errorf("%w: %d of %d", errInvalidThreshold, k, n)
+	}
+	coeffs, err := randomPolynomial(k)
+	if err != nil {
+		return nil, nil, err
+	}
 	shares := make([][]byte, n)
-	for i := 0; i < n; i++ {
-		share := make([]byte, 32)
-		rand.Read(share)
-		shares[i] = share
+	for i := range shares {
+		share := &KeyShare{Index: uint64(i + 1), secret: evalPolynomial(coeffs, uint64(i+1))}
+		shares[i] = share.Bytes()
 	}
+	var pk bls12381.G2Affine
+	pk.ScalarMultiplicationBase(coeffs[0].BigInt(new(big.Int)))
+	enc := pk.Bytes()
 
-	tc.masterPubKey = publicKey
-	return shares, publicKey, nil
+	tc.masterPubKey = enc[:]
+	return shares, tc.masterPubKey, nil
 }
 
-// VerifyKeyShare verifies that a key share is valid
+// VerifyKeyShare verifies that a key share matches the public key of the share
 func (tc *ThresholdCrypto) VerifyKeyShare(share []byte, validatorPubKey []byte) bool {
-	// Placeholder: always return true for now
-	return len(share) == 32
+	ks, err := ParseKeyShare(share)
+	if err != nil {
+		return false
+	}
+	want, ok := decodeG2(validatorPubKey)
+	if !ok {
+		return false
+	}
+	enc := want.Bytes()
+	return bytes.Equal(ks.PublicKey(), enc[:])
 }
 
-// CombineShares combines key shares to reconstruct the master key
+// CombineShares combines key shares to reconstruct the master secret key
 func (tc *ThresholdCrypto) CombineShares(shares [][]byte) ([]byte, error) {
 	if len(shares) < tc.threshold {
-		return nil, errors.New("insufficient shares")
+		return nil, errInsufficientShares
+	}
+	parsed := make([]*KeyShare, len(shares))
+	indices := make([]uint64, len(shares))
+	for i, enc := range shares {
+		share, err := ParseKeyShare(enc)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i], indices[i] = share, share.Index
+	}
+	if err := checkDistinct(indices); err != nil {
+		return nil, err
+	}
+	var secret fr.Element
+	for i, share := range parsed {
+		lambda := lagrangeAtZero(indices, i)
+		var term fr.Element
+		term.Mul(&lambda, &share.secret)
+		secret.Add(&secret, &term)
+	}
+	enc := secret.Bytes()
+	return enc[:], nil
+}
+
+// CombineSignatures combines a threshold of partial signatures of the same
+// message into a signature under the master public key.
+func (tc *ThresholdCrypto) CombineSignatures(shares [][]byte) ([]byte, error) {
+	sig, err := tc.combinePoints(shares)
+	if err != nil {
+		return nil, err
+	}
+	enc := sig.Bytes()
+	return enc[:], nil
+}
+
+// VerifySignature checks a BLS signature of a message under a public key.
+func VerifySignature(pubkey, msg, sig []byte) error {
+	pk, ok := decodeG2(pubkey)
+	if !ok {
+		return errInvalidBLSPublicKey
+	}
+	s, ok := decodeG1(sig)
+	if !ok {
+		return errInvalidSignature
+	}
+	h, err := bls12381.HashToG1(msg, signatureDST)
+	if err != nil {
+		return err
+	}
+	// e(sig, G2) == e(H(m), pk)
+	var negH bls12381.G1Affine
+	negH.Neg(&h)
+	_, _, _, g2 := bls12381.Generators()
+	ok, err = bls12381.PairingCheck([]bls12381.G1Affine{*s, negH}, []bls12381.G2Affine{g2, *pk})
+	if err != nil || !ok {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// AggregateSignatures aggregates BLS signatures of the same message by
+// different keys. The aggregate verifies under the aggregate of the keys.
+func AggregateSignatures(sigs [][]byte) ([]byte, error) {
+	if len(sigs) == 0 {
+		return nil, errNoSignatures
+	}
+	var agg bls12381.G1Affine
+	for _, enc := range sigs {
+		s, ok := decodeG1(enc)
+		if !ok {
+			return nil, errInvalidSignature
+		}
+		agg.Add(&agg, s)
+	}
+	enc := agg.Bytes()
+	return enc[:], nil
+}
+
+// AggregatePublicKeys aggregates BLS public keys for verifying an aggregate
+// signature. Keys must come with a proof of possession, e.g. a signed
+// registration, to rule out rogue key attacks.
+func AggregatePublicKeys(pubkeys [][]byte) ([]byte, error) {
+	if len(pubkeys) == 0 {
+		return nil, errInvalidBLSPublicKey
+	}
+	var agg bls12381.G2Affine
+	for _, enc := range pubkeys {
+		pk, ok := decodeG2(enc)
+		if !ok {
+			return nil, errInvalidBLSPublicKey
+		}
+		agg.Add(&agg, pk)
+	}
+	enc := agg.Bytes()
+	return enc[:], nil
+}
+
+// combinePoints interpolates a threshold of indexed G1 points, s_i·P, to s·P.
+func (tc *ThresholdCrypto) combinePoints(shares [][]byte) (*bls12381.G1Affine, error) {
+	if len(shares) < tc.threshold || len(shares) == 0 {
+		return nil, errInsufficientShares
+	}
+	points := make([]*bls12381.G1Affine, len(shares))
+	indices := make([]uint64, len(shares))
+	for i, enc := range shares {
+		index, point, err := decodeIndexedPoint(enc)
+		if err != nil {
+			return nil, err
+		}
+		points[i], indices[i] = point, index
+	}
+	if err := checkDistinct(indices); err != nil {
+		return nil, err
 	}
+	var sum bls12381.G1Affine
+	for i, point := range points {
+		lambda := lagrangeAtZero(indices, i)
+		var term bls12381.G1Affine
+		term.ScalarMultiplication(point, lambda.BigInt(new(big.Int)))
+		sum.Add(&sum, &term)
+	}
+	return &sum, nil
+}
+
+// ciphertextPoint decodes the ephemeral point U of a ciphertext.
+func ciphertextPoint(ciphertext []byte) (*bls12381.G1Affine, error) {
+	if len(ciphertext) < ciphertextOverhead {
+		return nil, errInvalidCiphertext
+	}
+	u, ok := decodeG1(ciphertext[:bls12381.SizeOfG1AffineCompressed])
+	if !ok {
+		return nil, errInvalidCiphertext
+	}
+	return u, nil
+}
+
+// thresholdAEAD derives the symmetric cipher from the pairing value shared by
+// the encrypting party and the decryption shares.
+func thresholdAEAD(gt *bls12381.GT) (cipher.AEAD, error) {
+	enc := gt.Bytes()
+	key := sha256.Sum256(enc[:])
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encodeIndexedPoint encodes a share index followed by a compressed G1 point.
+func encodeIndexedPoint(index uint64, p *bls12381.G1Affine) []byte {
+	enc := make([]byte, 8, pointShareLength)
+	binary.BigEndian.PutUint64(enc, index)
+	point := p.Bytes()
+	return append(enc, point[:]...)
+}
+
+// decodeIndexedPoint decodes a share index followed by a compressed G1 point.
+func decodeIndexedPoint(enc []byte) (uint64, *bls12381.G1Affine, error) {
+	if len(enc) != pointShareLength {
+		return 0, nil, errInvalidPointShare
+	}
+	index := binary.BigEndian.Uint64(enc)
+	if index == 0 {
+		return 0, nil, errInvalidPointShare
+	}
+	p, ok := decodeG1(enc[8:])
+	if !ok {
+		return 0, nil, errInvalidPointShare
+	}
+	return index, p, nil
+}
 
-	// Placeholder: just return first share
-	return shares[0], nil
-}
\ No newline at end of file
+// decodeG1 decodes a compressed G1 point, rejecting the point at infinity and
+// points outside the prime order subgroup.
+func decodeG1(enc []byte) (*bls12381.G1Affine, bool) {
+	p := new(bls12381.G1Affine)
+	if n, err := p.SetBytes(enc); err != nil || n != len(enc) || p.IsInfinity() {
+		return nil, false
+	}
+	return p, true
+}
+
+// decodeG2 decodes a compressed G2 point, rejecting the point at infinity and
+// points outside the prime order subgroup.
+func decodeG2(enc []byte) (*bls12381.G2Affine, bool) {
+	p := new(bls12381.G2Affine)
+	if n, err := p.SetBytes(enc); err != nil || n != len(enc) || p.IsInfinity() {
+		return nil, false
+	}
+	return p, true
+}
+
+// randomPolynomial returns k random coefficients of a polynomial of degree k-1.
+func randomPolynomial(k int) ([]fr.Element, error) {
+	coeffs := make([]fr.Element, k)
+	for i := range coeffs {
+		if _, err := coeffs[i].SetRandom(); err != nil {
+			return nil, err
+		}
+	}
+	return coeffs, nil
+}
+
+// evalPolynomial evaluates a polynomial at x using Horner's method.
+func evalPolynomial(coeffs []fr.Element, x uint64) fr.Element {
+	var xe, result fr.Element
+	xe.SetUint64(x)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result.Mul(&result, &xe)
+		result.Add(&result, &coeffs[i])
+	}
+	return result
+}
+
+// lagrangeAtZero returns the Lagrange coefficient of the i-th index for
+// interpolating the polynomial through the given indices at zero.
+func lagrangeAtZero(indices []uint64, i int) fr.Element {
+	var num, den, xi fr.Element
+	num.SetOne()
+	den.SetOne()
+	xi.SetUint64(indices[i])
+	for j, index := range indices {
+		if j == i {
+			continue
+		}
+		var xj, diff fr.Element
+		xj.SetUint64(index)
+		diff.Sub(&xj, &xi)
+		num.Mul(&num, &xj)
+		den.Mul(&den, &diff)
+	}
+	den.Inverse(&den)
+	num.Mul(&num, &den)
+	return num
+}
+
+// checkDistinct ensures no share index is used twice.
+func checkDistinct(indices []uint64) error {
+	seen := make(map[uint64]bool, len(indices))
+	for _, index := range indices {
+		if seen[index] {
+			return fmt.Errorf("%w: %d", errDuplicateShare, index)
+		}
+		seen[index] = true
+	}
+	return nil
+}
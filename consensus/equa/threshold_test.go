@@ -0,0 +1,206 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that a transaction encrypted under the master key is recovered from the
+// decryption shares of any threshold of key shares, but not from fewer.
+func TestThresholdEncryption(t *testing.T) {
+	tc := NewThresholdCrypto(&params.EquaConfig{ThresholdShares: 3})
+	shares, _, err := tc.GenerateKeyShares(5, 3)
+	if err != nil {
+		t.Fatalf("failed to generate key shares: %v", err)
+	}
+	tx := newTestTransactions(t, 1)[0]
+	ciphertext, err := tc.EncryptTransaction(tx)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	carrier := types.NewTx(&types.LegacyTx{Data: append([]byte(encryptedTxMarker), ciphertext...)})
+
+	decryptionShares := make([][]byte, len(shares))
+	for i, enc := range shares {
+		share, _ := ParseKeyShare(enc)
+		if decryptionShares[i], err = share.DecryptionShare(ciphertext); err != nil {
+			t.Fatalf("failed to create decryption share: %v", err)
+		}
+	}
+	decrypted, err := tc.DecryptTransaction(carrier, [][]byte{decryptionShares[4], decryptionShares[0], decryptionShares[2]})
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if decrypted.Hash() != tx.Hash() {
+		t.Fatalf("decrypted transaction mismatch: have %x, want %x", decrypted.Hash(), tx.Hash())
+	}
+	if _, err := tc.DecryptTransaction(carrier, decryptionShares[:2]); !errors.Is(err, errInsufficientShares) {
+		t.Fatalf("decrypted below threshold: %v", err)
+	}
+	// A forged share is caught by verification and spoils the combination
+	share, _ := ParseKeyShare(shares[1])
+	forged, _ := ParseKeyShare(shares[3])
+	forged.Index = share.Index
+
+	good, _ := share.DecryptionShare(ciphertext)
+	bad, _ := forged.DecryptionShare(ciphertext)
+	if err := tc.VerifyDecryptionShare(ciphertext, good, share.PublicKey()); err != nil {
+		t.Fatalf("valid decryption share rejected: %v", err)
+	}
+	if err := tc.VerifyDecryptionShare(ciphertext, bad, share.PublicKey()); err == nil {
+		t.Fatalf("forged decryption share accepted")
+	}
+	others := make([][]byte, 2)
+	for i, enc := range [][]byte{shares[0], shares[2]} {
+		ks, _ := ParseKeyShare(enc)
+		others[i], _ = ks.DecryptionShare(ciphertext)
+	}
+	if _, err := tc.CombineDecryptionShares(ciphertext, append(others, bad)); !errors.Is(err, errDecryptionFailed) {
+		t.Fatalf("decryption with forged share: have %v, want %v", err, errDecryptionFailed)
+	}
+	if _, err := tc.CombineDecryptionShares(ciphertext, append(others, others[0])); !errors.Is(err, errDuplicateShare) {
+		t.Fatalf("decryption with duplicate share: have %v, want %v", err, errDuplicateShare)
+	}
+}
+
+// Tests that partial signatures combine into a signature under the master key
+// and that plain signatures aggregate.
+func TestThresholdSignatures(t *testing.T) {
+	tc := NewThresholdCrypto(&params.EquaConfig{ThresholdShares: 2})
+	shares, pubkey, err := tc.GenerateKeyShares(3, 2)
+	if err != nil {
+		t.Fatalf("failed to generate key shares: %v", err)
+	}
+	msg := []byte("finalized checkpoint")
+
+	var (
+		partials [][]byte
+		pubkeys  [][]byte
+	)
+	for _, enc := range shares {
+		share, _ := ParseKeyShare(enc)
+		partial, err := share.Sign(msg)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		partials = append(partials, partial)
+		pubkeys = append(pubkeys, share.PublicKey())
+		if !tc.VerifyKeyShare(enc, share.PublicKey()) {
+			t.Fatalf("key share %d does not match its public key", share.Index)
+		}
+	}
+	sig, err := tc.CombineSignatures(partials[1:])
+	if err != nil {
+		t.Fatalf("failed to combine signatures: %v", err)
+	}
+	if err := VerifySignature(pubkey, msg, sig); err != nil {
+		t.Fatalf("threshold signature rejected: %v", err)
+	}
+	if err := VerifySignature(pubkey, []byte("other"), sig); err == nil {
+		t.Fatalf("threshold signature accepted for another message")
+	}
+	// Strip the indices to aggregate the partial signatures as plain ones
+	plain := make([][]byte, len(partials))
+	for i, partial := range partials {
+		plain[i] = partial[8:]
+	}
+	agg, err := AggregateSignatures(plain)
+	if err != nil {
+		t.Fatalf("failed to aggregate signatures: %v", err)
+	}
+	aggkey, err := AggregatePublicKeys(pubkeys)
+	if err != nil {
+		t.Fatalf("failed to aggregate public keys: %v", err)
+	}
+	if err := VerifySignature(aggkey, msg, agg); err != nil {
+		t.Fatalf("aggregate signature rejected: %v", err)
+	}
+	if err := VerifySignature(pubkey, msg, agg); err == nil {
+		t.Fatalf("aggregate signature accepted under the master key")
+	}
+}
+
+// Tests that the distributed key generation yields shares usable for threshold
+// decryption and rejects shares not matching the dealer's commitments.
+func TestDKG(t *testing.T) {
+	const n, k = 4, 3
+
+	dealings := make([]*DKGDealing, n)
+	for i := range dealings {
+		dealing, err := NewDKGDealing(uint64(i+1), n, k)
+		if err != nil {
+			t.Fatalf("failed to deal: %v", err)
+		}
+		dealings[i] = dealing
+	}
+	var (
+		keyShares [][]byte
+		publicKey []byte
+	)
+	for i := uint64(1); i <= n; i++ {
+		received := make(map[uint64][]byte)
+		for _, dealing := range dealings {
+			received[dealing.Dealer] = dealing.Share(i)
+		}
+		share, pubkey, err := FinishDKG(i, dealings, received)
+		if err != nil {
+			t.Fatalf("participant %d failed to finish: %v", i, err)
+		}
+		if publicKey != nil && string(pubkey) != string(publicKey) {
+			t.Fatalf("participant %d derived a different public key", i)
+		}
+		publicShare, err := DKGPublicShare(dealings, i)
+		if err != nil {
+			t.Fatalf("failed to derive public share: %v", err)
+		}
+		tc := NewThresholdCrypto(&params.EquaConfig{ThresholdShares: k})
+		if !tc.VerifyKeyShare(share, publicShare) {
+			t.Fatalf("participant %d key share does not match its public share", i)
+		}
+		keyShares, publicKey = append(keyShares, share), pubkey
+	}
+	tc := NewThresholdCrypto(&params.EquaConfig{ThresholdShares: k})
+	tc.SetMasterPublicKey(publicKey)
+
+	ciphertext, err := tc.Encrypt([]byte("sealed bid"))
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	var decryptionShares [][]byte
+	for _, enc := range keyShares[1:] {
+		share, _ := ParseKeyShare(enc)
+		decryptionShare, _ := share.DecryptionShare(ciphertext)
+		decryptionShares = append(decryptionShares, decryptionShare)
+	}
+	msg, err := tc.CombineDecryptionShares(ciphertext, decryptionShares)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if string(msg) != "sealed bid" {
+		t.Fatalf("plaintext mismatch: have %q", msg)
+	}
+	// A dealer handing out a share off its polynomial is caught
+	received := map[uint64][]byte{1: dealings[0].Share(1), 2: dealings[1].Share(3), 3: dealings[2].Share(1), 4: dealings[3].Share(1)}
+	if _, _, err := FinishDKG(1, dealings, received); !errors.Is(err, errInvalidDKGShare) {
+		t.Fatalf("bad dealer share: have %v, want %v", err, errInvalidDKGShare)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+)
+
+var errUnknownTraceTarget = errors.New("unknown block or transaction")
+
+// mevProfitMethods describes how the profit of each category of MEV findings is
+// estimated, so that explorers can qualify the figures they show.
+var mevProfitMethods = map[string]string{
+	MEVSandwich:    "value of the backrun less the value of the frontrun",
+	MEVArbitrage:   "flat estimate per transaction emitting two or more swap events",
+	MEVLiquidation: "flat estimate of the liquidation bonus",
+	MEVFrontrun:    "flat estimate per transaction outbidding the next call of the same function",
+}
+
+// MEVAttribution is an MEV finding attributed to the transactions and accounts
+// involved in it.
+type MEVAttribution struct {
+	Category     string          `json:"category"`
+	TxIndex      int             `json:"txIndex"`                // Position of the extracting transaction, the frontrun of a sandwich
+	TxHash       common.Hash     `json:"txHash"`                 // Hash of the extracting transaction
+	Backrun      *common.Hash    `json:"backrun,omitempty"`      // Transaction closing a sandwich
+	Victim       *common.Hash    `json:"victim,omitempty"`       // Transaction extracted from, if identifiable
+	Extractor    common.Address  `json:"extractor"`              // Sender of the extracting transaction
+	VictimSender *common.Address `json:"victimSender,omitempty"` // Sender of the victim transaction
+	Contract     *common.Address `json:"contract,omitempty"`     // Contract called by the extracting transaction
+	Profit       *big.Int        `json:"profit"`                 // Estimated profit in wei
+	ProfitMethod string          `json:"profitMethod"`           // How the profit was estimated
+
+	// Evidence is the hash of the slashing evidence for MEV extraction against
+	// the proposer, set if the proposer sent the extracting transaction and the
+	// slasher flags the block.
+	Evidence *common.Hash `json:"evidence,omitempty"`
+}
+
+// MEVTrace is the MEV detected in a block, attributed per transaction.
+type MEVTrace struct {
+	Number       uint64            `json:"number"`
+	Hash         common.Hash       `json:"hash"`
+	Proposer     common.Address    `json:"proposer"`
+	Transaction  *common.Hash      `json:"transaction,omitempty"` // Transaction the trace is restricted to, if any
+	Profit       *big.Int          `json:"profit"`                // Total estimated profit of the attributions
+	Attributions []*MEVAttribution `json:"attributions"`
+}
+
+// traceMEV attributes the MEV detected in a block with the local rules. If tx is
+// not nil, only the findings the transaction takes part in are reported.
+func (e *Equa) traceMEV(block *types.Block, receipts types.Receipts, tx *common.Hash) *MEVTrace {
+	var (
+		txs      = block.Transactions()
+		signer   = e.mevDetector.signer
+		proposer = block.Coinbase()
+		index    = make(map[common.Hash]int, len(txs))
+	)
+	for i, tx := range txs {
+		index[tx.Hash()] = i
+	}
+	var evidence *common.Hash
+	if e.slasher.DetectMEVExtraction(proposer, txs, receipts, e.consensusBaseFee(block.Header())) {
+		hash := (&Evidence{Validator: proposer, Block: block.NumberU64(), Violation: "MEV extraction"}).Hash()
+		evidence = &hash
+	}
+	trace := &MEVTrace{
+		Number:       block.NumberU64(),
+		Hash:         block.Hash(),
+		Proposer:     proposer,
+		Transaction:  tx,
+		Profit:       new(big.Int),
+		Attributions: []*MEVAttribution{},
+	}
+	for _, finding := range e.mevDetector.Analyze(txs, receipts, block.BaseFee()) {
+		attribution := &MEVAttribution{
+			Category:     finding.Category,
+			TxIndex:      finding.TxIndex,
+			TxHash:       finding.TxHash,
+			Victim:       finding.Victim,
+			Contract:     txs[finding.TxIndex].To(),
+			Profit:       finding.Profit,
+			ProfitMethod: mevProfitMethods[finding.Category],
+		}
+		attribution.Extractor, _ = txSender(signer, txs[finding.TxIndex])
+		if finding.Category == MEVSandwich && finding.TxIndex+2 < len(txs) {
+			backrun := txs[finding.TxIndex+2].Hash()
+			attribution.Backrun = &backrun
+		}
+		if finding.Victim != nil {
+			if from, err := txSender(signer, txs[index[*finding.Victim]]); err == nil {
+				attribution.VictimSender = &from
+			}
+		}
+		if evidence != nil && attribution.Extractor == proposer {
+			attribution.Evidence = evidence
+		}
+		if tx != nil && !attribution.involves(*tx) {
+			continue
+		}
+		trace.Attributions = append(trace.Attributions, attribution)
+		trace.Profit.Add(trace.Profit, attribution.Profit)
+	}
+	return trace
+}
+
+// involves reports whether a transaction takes part in the attributed finding.
+func (a *MEVAttribution) involves(tx common.Hash) bool {
+	return a.TxHash == tx || (a.Backrun != nil && *a.Backrun == tx) || (a.Victim != nil && *a.Victim == tx)
+}
+
+// mevTrace attributes the MEV detected in a canonical block, given the hash of
+// the block or of one of its transactions.
+func (e *Equa) mevTrace(chain consensus.ChainHeaderReader, hash common.Hash) (*MEVTrace, error) {
+	var (
+		number uint64
+		tx     *common.Hash
+	)
+	if header := chain.GetHeaderByHash(hash); header != nil {
+		number = header.Number.Uint64()
+		if canonical := chain.GetHeaderByNumber(number); canonical == nil || canonical.Hash() != hash {
+			return nil, fmt.Errorf("%w: block %x not canonical", errUnknownTraceTarget, hash)
+		}
+	} else if lookup := rawdb.ReadTxLookupEntry(e.db, hash); lookup != nil {
+		number, tx = *lookup, &hash
+	} else {
+		return nil, fmt.Errorf("%w %x", errUnknownTraceTarget, hash)
+	}
+	block, receipts, err := blockReceipts(chain, number)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil && block.Transaction(*tx) == nil {
+		return nil, fmt.Errorf("%w %x", errUnknownTraceTarget, hash)
+	}
+	return e.traceMEV(block, receipts, tx), nil
+}
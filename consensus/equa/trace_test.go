@@ -0,0 +1,127 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/math"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/trie"
+)
+
+// Tests that MEV traces attribute the findings of a block to the transactions
+// and accounts involved, and can be restricted to a single transaction.
+func TestTraceMEV(t *testing.T) {
+	var (
+		signer    = types.LatestSignerForChainID(big.NewInt(1))
+		bot, _    = crypto.GenerateKey()
+		victim, _ = crypto.GenerateKey()
+		proposer  = crypto.PubkeyToAddress(bot.PublicKey)
+		router    = common.Address{0xaa}
+		swap      = []byte{0x38, 0xed, 0x17, 0x39, 0x00}
+		engine    = newTestEngine(t, 32, proposer)
+		chain     = &testBlockChain{
+			testHeaderChain: testHeaderChain{config: newTestChainConfig(engine.config)},
+			blocks:          make(map[common.Hash]*types.Block),
+			receipts:        make(map[common.Hash]types.Receipts),
+		}
+	)
+	rules := DefaultMEVRules()
+	rules.MinProfit = (*math.HexOrDecimal256)(new(big.Int))
+	engine.mevDetector.SetRules(rules)
+
+	sign := func(nonce uint64, gasPrice int64, key *ecdsa.PrivateKey) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: nonce, To: &router, Gas: 100000, GasPrice: big.NewInt(gasPrice), Data: swap})
+	}
+	// The proposer frontruns a swap, outbidding it well above the slasher's
+	// gas price threshold
+	var (
+		front = sign(0, 2e15, bot)
+		swept = sign(0, 1e9, victim)
+		other = sign(1, 1e9, victim)
+		txs   = []*types.Transaction{front, swept, other}
+	)
+	var receipts types.Receipts
+	for _, tx := range txs {
+		receipts = append(receipts, &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash(), GasUsed: 21000})
+	}
+	for number := int64(0); number < 2; number++ {
+		header := &types.Header{Number: big.NewInt(number), Coinbase: proposer, Difficulty: common.Big1}
+		block := types.NewBlock(header, nil, nil, trie.NewStackTrie(nil))
+		if number == 1 {
+			block = types.NewBlock(header, &types.Body{Transactions: txs}, receipts, trie.NewStackTrie(nil))
+			rawdb.WriteTxLookupEntriesByBlock(engine.db, block)
+			chain.receipts[block.Hash()] = receipts
+		}
+		chain.headers = append(chain.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+	}
+	api := &API{chain: chain, equa: engine}
+
+	trace, err := api.TraceMEV(chain.headers[1].Hash())
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if trace.Number != 1 || trace.Proposer != proposer || trace.Transaction != nil || len(trace.Attributions) != 1 {
+		t.Fatalf("block trace mismatch: %+v", trace)
+	}
+	attribution := trace.Attributions[0]
+	if attribution.Category != MEVFrontrun || attribution.TxHash != front.Hash() || attribution.Extractor != proposer {
+		t.Errorf("extraction mismatch: have %s by %x in %x", attribution.Category, attribution.Extractor, attribution.TxHash)
+	}
+	if attribution.Victim == nil || *attribution.Victim != swept.Hash() || attribution.VictimSender == nil || *attribution.VictimSender != crypto.PubkeyToAddress(victim.PublicKey) {
+		t.Errorf("victim mismatch: have %v sent by %v", attribution.Victim, attribution.VictimSender)
+	}
+	if attribution.Contract == nil || *attribution.Contract != router {
+		t.Errorf("contract mismatch: have %v, want %x", attribution.Contract, router)
+	}
+	if attribution.Profit.Cmp(trace.Profit) != 0 || attribution.ProfitMethod != mevProfitMethods[MEVFrontrun] {
+		t.Errorf("profit mismatch: have %v by %q, total %v", attribution.Profit, attribution.ProfitMethod, trace.Profit)
+	}
+	evidence := (&Evidence{Validator: proposer, Block: 1, Violation: "MEV extraction"}).Hash()
+	if attribution.Evidence == nil || *attribution.Evidence != evidence {
+		t.Errorf("evidence mismatch: have %v, want %x", attribution.Evidence, evidence)
+	}
+	// Traces of a transaction only report the findings it takes part in
+	for _, tx := range []*types.Transaction{front, swept} {
+		trace, err := api.TraceMEV(tx.Hash())
+		if err != nil {
+			t.Fatalf("failed to trace transaction %x: %v", tx.Hash(), err)
+		}
+		if trace.Transaction == nil || *trace.Transaction != tx.Hash() || len(trace.Attributions) != 1 {
+			t.Errorf("transaction %x: trace mismatch: %+v", tx.Hash(), trace)
+		}
+	}
+	trace, err = api.TraceMEV(other.Hash())
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	if len(trace.Attributions) != 0 || trace.Profit.Sign() != 0 {
+		t.Errorf("uninvolved transaction attributed: %+v", trace.Attributions)
+	}
+	// Unknown hashes cannot be traced
+	if _, err := api.TraceMEV(common.Hash{0x01}); !errors.Is(err, errUnknownTraceTarget) {
+		t.Errorf("unknown hash: error mismatch: have %v, want %v", err, errUnknownTraceTarget)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/ethdb"
+	"github.com/equa/go-equa/rlp"
+)
+
+// Epoch boundary blocks commit to the validator set the proposers of their
+// schedule were drawn from, i.e. the one covering the epoch they end, in a
+// trailer of their extra-data following any compliance statement and preceding
+// any version signal. With the set and the headers, a node can recompute the
+// proposer of every block of the epoch without replaying the validator state.
+
+const validatorSetTrailerLength = 4 + common.HashLength // Magic (4) and validator set hash (32)
+
+// validatorSetMagic marks a validator set commitment in the extra-data of a
+// header.
+var validatorSetMagic = []byte("eqvc")
+
+var (
+	errMissingValidatorSet     = errors.New("missing validator set commitment")
+	errUnexpectedValidatorSet  = errors.New("validator set commitment outside epoch boundary")
+	errValidatorSetMismatch    = errors.New("validator set commitment mismatch")
+	errValidatorSetUnavailable = errors.New("validator set unavailable")
+)
+
+// ValidatorSetEntry is a validator of the set proposers are drawn from, along
+// with the weight it is drawn with.
+type ValidatorSetEntry struct {
+	Address common.Address `json:"address"`
+	Stake   *big.Int       `json:"stake"`
+	Weight  uint64         `json:"weight"`
+}
+
+// ValidatorSet is a validator set committed to by an epoch boundary block.
+type ValidatorSet struct {
+	Number     uint64               `json:"number"` // Epoch boundary block committing to the set
+	Hash       common.Hash          `json:"hash"`   // Commitment to the set
+	Validators []*ValidatorSetEntry `json:"validators"`
+}
+
+// validatorSetHash returns the commitment to a validator set ordered by address.
+func validatorSetHash(validators []*ValidatorSetEntry) common.Hash {
+	enc, _ := rlp.EncodeToBytes(validators)
+	return crypto.Keccak256Hash([]byte("equa-validator-set"), enc)
+}
+
+// splitValidatorSet separates a validator set commitment trailer from the rest
+// of the extra-data, which must not carry a version signal anymore. It returns a
+// nil commitment if there is none.
+func splitValidatorSet(extra []byte) ([]byte, *common.Hash) {
+	if len(extra) < validatorSetTrailerLength {
+		return extra, nil
+	}
+	rest, trailer := extra[:len(extra)-validatorSetTrailerLength], extra[len(extra)-validatorSetTrailerLength:]
+	if !bytes.Equal(trailer[:4], validatorSetMagic) {
+		return extra, nil
+	}
+	hash := common.BytesToHash(trailer[4:])
+	return rest, &hash
+}
+
+// validatorSetCommitment returns the validator set commitment of a header, or
+// nil if it carries none.
+func validatorSetCommitment(header *types.Header) *common.Hash {
+	extra, _ := splitVersionSignal(header.Extra)
+	_, hash := splitValidatorSet(extra)
+	return hash
+}
+
+// writeValidatorSet stores a validator set by its commitment.
+func writeValidatorSet(db ethdb.KeyValueWriter, hash common.Hash, validators []*ValidatorSetEntry) error {
+	blob, err := json.Marshal(validators)
+	if err != nil {
+		return err
+	}
+	return db.Put(append(common.CopyBytes(rawdb.EquaValidatorSetPrefix), hash[:]...), blob)
+}
+
+// readValidatorSet retrieves a validator set by its commitment, or nil if it is
+// not stored.
+func readValidatorSet(db ethdb.KeyValueReader, hash common.Hash) []*ValidatorSetEntry {
+	blob, err := db.Get(append(common.CopyBytes(rawdb.EquaValidatorSetPrefix), hash[:]...))
+	if err != nil {
+		return nil
+	}
+	var validators []*ValidatorSetEntry
+	if err := json.Unmarshal(blob, &validators); err != nil || validatorSetHash(validators) != hash {
+		return nil
+	}
+	return validators
+}
+
+// commitValidatorSet appends the commitment to the validator set of the schedule
+// covering an epoch boundary block to its extra-data.
+func (e *Equa) commitValidatorSet(chain consensus.ChainHeaderReader, header *types.Header) error {
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	schedule, err := e.blockSchedule(chain, header.Number.Uint64(), parent)
+	if err != nil {
+		return err
+	}
+	header.Extra = append(append(header.Extra, validatorSetMagic...), schedule.ValidatorSet[:]...)
+	return nil
+}
+
+// verifyValidatorSet checks that epoch boundary headers commit to the validator
+// set of the schedule covering them, and that no other header carries one.
+func (e *Equa) verifyValidatorSet(chain consensus.ChainHeaderReader, header *types.Header, parent *types.Header) error {
+	schedule, err := e.blockSchedule(chain, header.Number.Uint64(), parent)
+	if err != nil {
+		return err
+	}
+	return e.checkValidatorSet(header, schedule)
+}
+
+// checkValidatorSet checks the validator set commitment of a header against the
+// given schedule covering it.
+func (e *Equa) checkValidatorSet(header *types.Header, schedule *ProposerSchedule) error {
+	commitment := validatorSetCommitment(header)
+	if number := header.Number.Uint64(); number%e.config.Epoch != 0 {
+		if commitment != nil {
+			return errUnexpectedValidatorSet
+		}
+		return nil
+	}
+	if commitment == nil {
+		return errMissingValidatorSet
+	}
+	if *commitment != schedule.ValidatorSet {
+		return fmt.Errorf("%w: have %x, want %x", errValidatorSetMismatch, *commitment, schedule.ValidatorSet)
+	}
+	return nil
+}
+
+// validatorSet returns the validator set committed to by a canonical epoch
+// boundary block.
+func (e *Equa) validatorSet(chain consensus.ChainHeaderReader, number uint64) (*ValidatorSet, error) {
+	header := chain.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownBlock, number)
+	}
+	commitment := validatorSetCommitment(header)
+	if commitment == nil {
+		return nil, fmt.Errorf("%w: block %d", errMissingValidatorSet, number)
+	}
+	validators := readValidatorSet(e.db, *commitment)
+	if validators == nil {
+		return nil, fmt.Errorf("%w: %x", errValidatorSetUnavailable, *commitment)
+	}
+	return &ValidatorSet{Number: number, Hash: *commitment, Validators: validators}, nil
+}
+
+// LightProposer returns the proposer scheduled for a block from the validator
+// set committed to by the epoch boundary block ending its schedule and the hash
+// of the boundary block seeding it, allowing proposer eligibility to be checked
+// from headers alone. The set must match the commitment.
+func LightProposer(number, epochLength uint64, seed common.Hash, set *ValidatorSet) (common.Address, error) {
+	if number == 0 {
+		return common.Address{}, errNoProposers
+	}
+	if validatorSetHash(set.Validators) != set.Hash {
+		return common.Address{}, errValidatorSetMismatch
+	}
+	schedule, err := drawSchedule(scheduleEpoch(number, epochLength), seed, epochLength, set.Validators)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return schedule.Proposer(number), nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package equa
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/params"
+)
+
+// Tests that epoch boundary headers commit to the validator set proposers were
+// drawn from, and that the stored set lets the proposers be recomputed from the
+// headers alone.
+func TestValidatorSetCommitment(t *testing.T) {
+	var (
+		small = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		large = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	engine := newTestEngine(t, 32, small)
+	engine.config.InitialValidators = append(engine.config.InitialValidators, params.EquaInitialValidator{Address: large, Stake: new(big.Int).Mul(big.NewInt(96), big.NewInt(1e18))})
+	engine.config.Epoch = 8
+	engine.config.Features = map[string]bool{FeatureValidatorSetCommits: true}
+
+	chain := &testHeaderChain{config: newTestChainConfig(engine.config)}
+	for number := int64(0); number < 8; number++ {
+		header := &types.Header{Number: big.NewInt(number)}
+		if number > 0 {
+			header.ParentHash = chain.CurrentHeader().Hash()
+		}
+		chain.headers = append(chain.headers, header)
+	}
+	// The boundary block commits ahead of any version signal
+	parent := chain.headers[7]
+	boundary := &types.Header{Number: big.NewInt(8), ParentHash: parent.Hash(), Extra: []byte{0xc0}}
+	if err := engine.commitValidatorSet(chain, boundary); err != nil {
+		t.Fatalf("failed to commit to validator set: %v", err)
+	}
+	boundary.Extra = append(boundary.Extra, localVersionSignal().encode()...)
+	if err := engine.verifyValidatorSet(chain, boundary, parent); err != nil {
+		t.Fatalf("valid commitment rejected: %v", err)
+	}
+	if extra, _ := splitVersionSignal(boundary.Extra); len(extra) != 1+validatorSetTrailerLength {
+		t.Fatalf("trailer length mismatch: have %d", len(extra))
+	}
+	tampered := types.CopyHeader(boundary)
+	tampered.Extra[1+4] ^= 0xff
+	if err := engine.verifyValidatorSet(chain, tampered, parent); !errors.Is(err, errValidatorSetMismatch) {
+		t.Errorf("tampered commitment: have %v, want %v", err, errValidatorSetMismatch)
+	}
+	missing := &types.Header{Number: big.NewInt(8), ParentHash: parent.Hash()}
+	if err := engine.verifyValidatorSet(chain, missing, parent); !errors.Is(err, errMissingValidatorSet) {
+		t.Errorf("missing commitment: have %v, want %v", err, errMissingValidatorSet)
+	}
+	unexpected := &types.Header{Number: big.NewInt(7), ParentHash: chain.headers[6].Hash(), Extra: boundary.Extra}
+	if err := engine.verifyValidatorSet(chain, unexpected, chain.headers[6]); !errors.Is(err, errUnexpectedValidatorSet) {
+		t.Errorf("commitment off boundary: have %v, want %v", err, errUnexpectedValidatorSet)
+	}
+	// The committed set reproduces every proposer of the epoch
+	chain.headers = append(chain.headers, boundary)
+	set, err := engine.validatorSet(chain, 8)
+	if err != nil {
+		t.Fatalf("failed to retrieve validator set: %v", err)
+	}
+	if len(set.Validators) != 2 || set.Validators[0].Address != small || set.Validators[1].Address != large {
+		t.Fatalf("validator set mismatch: have %d validators", len(set.Validators))
+	}
+	for number := uint64(1); number <= 8; number++ {
+		want, err := engine.selectProposer(chain, number, chain.headers[number-1])
+		if err != nil {
+			t.Fatalf("block %d: failed to select proposer: %v", number, err)
+		}
+		if have, err := LightProposer(number, 8, chain.headers[0].Hash(), set); err != nil || have != want {
+			t.Errorf("block %d: light proposer mismatch: have %s (%v), want %s", number, have, err, want)
+		}
+	}
+	set.Validators[0].Stake = big.NewInt(1)
+	if _, err := LightProposer(1, 8, chain.headers[0].Hash(), set); !errors.Is(err, errValidatorSetMismatch) {
+		t.Errorf("forged set: have %v, want %v", err, errValidatorSetMismatch)
+	}
+	if _, err := engine.validatorSet(chain, 7); !errors.Is(err, errMissingValidatorSet) {
+		t.Errorf("block without commitment: have %v, want %v", err, errMissingValidatorSet)
+	}
+}
@@ -416,6 +416,12 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		preimages          stat
 		beaconHeaders      stat
 		cliqueSnaps        stat
+		equaSlashing       stat
+		equaBurns          stat
+		equaRewards        stat
+		equaEpochs         stat
+		equaValidatorSets  stat
+		equaArrivals       stat
 		bloomBits          stat
 		filterMapRows      stat
 		filterMapLastBlock stat
@@ -501,6 +507,22 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 				beaconHeaders.add(size)
 			case bytes.HasPrefix(key, CliqueSnapshotPrefix) && len(key) == 7+common.HashLength:
 				cliqueSnaps.add(size)
+			case bytes.HasPrefix(key, EquaSlashingPrefix) && len(key) == len(EquaSlashingPrefix)+common.AddressLength+8+common.HashLength:
+				equaSlashing.add(size)
+			case bytes.HasPrefix(key, EquaSlashingBlockPrefix) && len(key) == len(EquaSlashingBlockPrefix)+8+common.HashLength:
+				equaSlashing.add(size)
+			case bytes.HasPrefix(key, EquaBurnPrefix) && len(key) == len(EquaBurnPrefix)+8+common.HashLength:
+				equaBurns.add(size)
+			case bytes.Equal(key, EquaBurnHeadKey):
+				equaBurns.add(size)
+			case bytes.HasPrefix(key, EquaRewardPrefix) && len(key) == len(EquaRewardPrefix)+common.AddressLength+8+common.HashLength:
+				equaRewards.add(size)
+			case bytes.HasPrefix(key, EquaEpochSummaryPrefix) && len(key) == len(EquaEpochSummaryPrefix)+8+common.HashLength:
+				equaEpochs.add(size)
+			case bytes.HasPrefix(key, EquaValidatorSetPrefix) && len(key) == len(EquaValidatorSetPrefix)+common.HashLength:
+				equaValidatorSets.add(size)
+			case bytes.HasPrefix(key, EquaArrivalsPrefix) && len(key) == len(EquaArrivalsPrefix)+common.HashLength:
+				equaArrivals.add(size)
 
 			// new log index
 			case bytes.HasPrefix(key, filterMapRowPrefix) && len(key) <= len(filterMapRowPrefix)+9:
@@ -623,6 +645,12 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Storage snapshot", storageSnaps.sizeString(), storageSnaps.countString()},
 		{"Key-Value store", "Beacon sync headers", beaconHeaders.sizeString(), beaconHeaders.countString()},
 		{"Key-Value store", "Clique snapshots", cliqueSnaps.sizeString(), cliqueSnaps.countString()},
+		{"Key-Value store", "EQUA slashing history", equaSlashing.sizeString(), equaSlashing.countString()},
+		{"Key-Value store", "EQUA burn ledger", equaBurns.sizeString(), equaBurns.countString()},
+		{"Key-Value store", "EQUA reward ledger", equaRewards.sizeString(), equaRewards.countString()},
+		{"Key-Value store", "EQUA epoch summaries", equaEpochs.sizeString(), equaEpochs.countString()},
+		{"Key-Value store", "EQUA validator sets", equaValidatorSets.sizeString(), equaValidatorSets.countString()},
+		{"Key-Value store", "EQUA claimed arrivals", equaArrivals.sizeString(), equaArrivals.countString()},
 		{"Key-Value store", "Singleton metadata", metadata.sizeString(), metadata.countString()},
 	}
 
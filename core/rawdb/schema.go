@@ -141,6 +141,20 @@ var (
 
 	CliqueSnapshotPrefix = []byte("clique-")
 
+	EquaSlashingPrefix      = []byte("equa-slashing-")   // EquaSlashingPrefix + validator + num (uint64 big endian) + event id -> slashing event
+	EquaSlashingBlockPrefix = []byte("equa-slashblock-") // EquaSlashingBlockPrefix + num (uint64 big endian) + hash -> slashing events detected in the block
+
+	EquaBurnPrefix  = []byte("equa-burn-")   // EquaBurnPrefix + num (uint64 big endian) + hash -> MEV burn ledger entry of the block
+	EquaBurnHeadKey = []byte("EquaBurnHead") // EquaBurnHeadKey tracks the latest block number indexed into the burn ledger
+
+	EquaSignedProposalKey = []byte("EquaSignedProposal") // EquaSignedProposalKey tracks the latest proposal sealed locally, guarding against double proposals
+
+	EquaRewardPrefix       = []byte("equa-reward-")   // EquaRewardPrefix + recipient + num (uint64 big endian) + hash -> rewards credited to the recipient in the block
+	EquaEpochSummaryPrefix = []byte("equa-epochsum-") // EquaEpochSummaryPrefix + epoch (uint64 big endian) + hash of the last block -> summary of the epoch
+
+	EquaValidatorSetPrefix = []byte("equa-valset-")   // EquaValidatorSetPrefix + validator set hash -> validator set committed to in epoch boundary headers
+	EquaArrivalsPrefix     = []byte("equa-arrivals-") // EquaArrivalsPrefix + arrivals commitment -> arrival times claimed by a local proposer
+
 	BestUpdateKey         = []byte("update-")    // bigEndian64(syncPeriod) -> RLP(types.LightClientUpdate)  (nextCommittee only referenced by root hash)
 	FixedCommitteeRootKey = []byte("fixedRoot-") // bigEndian64(syncPeriod) -> committee root hash
 	SyncCommitteeKey      = []byte("committee-") // bigEndian64(syncPeriod) -> serialized committee
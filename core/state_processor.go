@@ -21,6 +21,7 @@ import (
 	"math/big"
 
 	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
 	"github.com/equa/go-equa/consensus/misc"
 	"github.com/equa/go-equa/core/state"
 	"github.com/equa/go-equa/core/tracing"
@@ -123,7 +124,19 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	}
 
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	p.chain.engine.Finalize(p.chain, header, tracingStateDB, block.Body())
+	if engine, ok := p.chain.engine.(consensus.ReceiptsFinalizer); ok {
+		if err := engine.FinalizeWithReceipts(p.chain, header, tracingStateDB, block.Body(), receipts); err != nil {
+			return nil, err
+		}
+
+		// The engine may have added logs to the receipts
+		allLogs = make([]*types.Log, 0, len(allLogs))
+		for _, receipt := range receipts {
+			allLogs = append(allLogs, receipt.Logs...)
+		}
+	} else {
+		p.chain.engine.Finalize(p.chain, header, tracingStateDB, block.Body())
+	}
 
 	return &ProcessResult{
 		Receipts: receipts,
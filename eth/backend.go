@@ -31,6 +31,7 @@ import (
 	"github.com/equa/go-equa/common"
 	"github.com/equa/go-equa/common/hexutil"
 	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/consensus/equa"
 	"github.com/equa/go-equa/core"
 	"github.com/equa/go-equa/core/filtermaps"
 	"github.com/equa/go-equa/core/rawdb"
@@ -44,6 +45,7 @@ import (
 	"github.com/equa/go-equa/eth/downloader"
 	"github.com/equa/go-equa/eth/ethconfig"
 	"github.com/equa/go-equa/eth/gasprice"
+	"github.com/equa/go-equa/eth/protocols/arrival"
 	"github.com/equa/go-equa/eth/protocols/eth"
 	"github.com/equa/go-equa/eth/protocols/snap"
 	"github.com/equa/go-equa/eth/tracers"
@@ -333,6 +335,52 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 
 	eth.dropper = newDropper(eth.p2pServer.MaxDialedConns(), eth.p2pServer.MaxInboundConns())
 
+	// Seal blocks with the configured PoW solver
+	if engine, ok := eth.engine.(*equa.Equa); ok && config.EquaPoWSolver != "" {
+		if err := engine.UsePoWSolver(config.EquaPoWSolver, config.EquaPoWThreads); err != nil {
+			return nil, err
+		}
+	}
+	// Detect MEV with the rules of the operator if configured
+	if engine, ok := eth.engine.(*equa.Equa); ok && config.EquaMEVRules != "" {
+		if err := engine.UseMEVRules(config.EquaMEVRules); err != nil {
+			return nil, err
+		}
+	}
+	// Compare the ordering of new blocks with other nodes if requested
+	if engine, ok := eth.engine.(*equa.Equa); ok && len(config.EquaCrossCheck.Peers) > 0 {
+		engine.StartOrderingCrossCheck(eth.blockchain, config.EquaCrossCheck)
+	}
+	// Apply the canonical blocks to the engine once written, and record the
+	// arrival times of transactions for fair ordering, the slashable offenses in
+	// new blocks, the MEV burned by them and the epoch summaries
+	if engine, ok := eth.engine.(*equa.Equa); ok {
+		engine.StartChainFollower(eth.blockchain)
+		engine.StartArrivalTracking(eth.txPool)
+		engine.StartSlashingMonitor(eth.blockchain)
+		engine.StartBurnLedger(eth.blockchain)
+		engine.StartEventStream(eth.blockchain)
+		engine.StartEpochSummaries(eth.blockchain)
+	}
+	// Sign the compliance statements, timestamp receipts and decryption shares of
+	// the validator with its account, held in the keystore or by an external signer
+	if engine, ok := eth.engine.(*equa.Equa); ok && config.Miner.PendingFeeRecipient != (common.Address{}) {
+		engine.Authorize(config.Miner.PendingFeeRecipient, eth.signEquaData)
+	}
+	// Build the inclusion lists of sealed blocks from the pending transactions
+	if engine, ok := eth.engine.(*equa.Equa); ok {
+		engine.UseInclusionSource(eth.inclusionCandidates)
+	}
+	// Reveal the encrypted transactions committed in new blocks, sharing in their
+	// decryption if the validator holds a threshold key share
+	if engine, ok := eth.engine.(*equa.Equa); ok {
+		if config.EquaKeyShare != "" {
+			if err := engine.UseKeyShare(config.EquaKeyShare); err != nil {
+				return nil, err
+			}
+		}
+		engine.StartEncryptedMempool(eth.blockchain, eth.addEncryptedTx)
+	}
 	eth.miner = miner.New(eth, config.Miner, eth.engine)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
 	eth.miner.SetPrioAddresses(config.TxPool.Locals)
@@ -343,6 +391,23 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}
 	eth.APIBackend.gpo = gasprice.NewOracle(eth.APIBackend, config.GPO, config.Miner.GasPrice)
 
+	// Serve the test network onboarding endpoints if requested
+	if engine, ok := eth.engine.(*equa.Equa); ok && config.EquaFaucet.Enabled() {
+		faucet := config.EquaFaucet
+		if faucet.Account == (common.Address{}) {
+			faucet.Account = config.Miner.PendingFeeRecipient
+		}
+		if err := engine.EnableFaucet(faucet, eth.sendFaucetFunds); err != nil {
+			return nil, err
+		}
+	}
+	// Serve the validator management namespace to the operator if requested
+	if engine, ok := eth.engine.(*equa.Equa); ok && config.EquaAdmin.Enabled {
+		if err := engine.EnableAdminAPI(config.EquaAdmin); err != nil {
+			return nil, err
+		}
+	}
+
 	// Start the RPC service
 	eth.netRPCService = ethapi.NewNetAPI(eth.p2pServer, networkID)
 
@@ -357,6 +422,74 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	return eth, nil
 }
 
+// sendFaucetFunds transfers funds from the faucet account, which must be unlocked
+// in the node's keystore, submitting the transaction to the local pool.
+func (s *Ethereum) sendFaucetFunds(from, to common.Address, amount *big.Int) (common.Hash, error) {
+	account := accounts.Account{Address: from}
+	wallet, err := s.accountManager.Find(account)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("faucet account unavailable: %v", err)
+	}
+	tip, err := s.APIBackend.SuggestGasTipCap(context.Background())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var (
+		config = s.blockchain.Config()
+		feeCap = new(big.Int).Set(tip)
+	)
+	if head := s.blockchain.CurrentBlock(); head.BaseFee != nil {
+		feeCap.Add(feeCap, new(big.Int).Mul(head.BaseFee, common.Big2))
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   config.ChainID,
+		Nonce:     s.txPool.Nonce(from),
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       params.TxGas,
+		To:        &to,
+		Value:     amount,
+	})
+	signed, err := wallet.SignTx(account, tx, config.ChainID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.txPool.Add([]*types.Transaction{signed}, false)[0]; err != nil {
+		return common.Hash{}, err
+	}
+	return signed.Hash(), nil
+}
+
+// addEncryptedTx adds an envelope of the encrypted mempool or the transaction it
+// revealed to the transaction pool.
+func (s *Ethereum) addEncryptedTx(tx *types.Transaction) error {
+	return s.txPool.Add([]*types.Transaction{tx}, false)[0]
+}
+
+// inclusionCandidates returns the executable pending transactions with the
+// lowest nonce of each sender, to build EQUA inclusion lists from.
+func (s *Ethereum) inclusionCandidates() []*types.Transaction {
+	pending := s.txPool.Pending(txpool.PendingFilter{OnlyPlainTxs: true})
+
+	txs := make([]*types.Transaction, 0, len(pending))
+	for _, lazies := range pending {
+		if tx := lazies[0].Resolve(); tx != nil {
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
+
+// signEquaData signs EQUA consensus data with a validator account, looked up
+// in the node's keystore or external signer on every request.
+func (s *Ethereum) signEquaData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	wallet, err := s.accountManager.Find(account)
+	if err != nil {
+		return nil, fmt.Errorf("validator account unavailable: %v", err)
+	}
+	return wallet.SignData(account, mimeType, data)
+}
+
 func makeExtraData(extra []byte) []byte {
 	if len(extra) == 0 {
 		// create default extradata
@@ -379,6 +512,12 @@ func makeExtraData(extra []byte) []byte {
 func (s *Ethereum) APIs() []rpc.API {
 	apis := ethapi.GetAPIs(s.APIBackend)
 
+	// Append any APIs exposed explicitly by the consensus engine
+	if engine, ok := s.engine.(interface {
+		APIs(chain consensus.ChainHeaderReader) []rpc.API
+	}); ok {
+		apis = append(apis, engine.APIs(s.BlockChain())...)
+	}
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -425,6 +564,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 	if s.config.SnapshotCache > 0 {
 		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler))...)
 	}
+	if engine, ok := s.engine.(*equa.Equa); ok {
+		protos = append(protos, arrival.MakeProtocols(engine)...)
+	}
 	return protos
 }
 
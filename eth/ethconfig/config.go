@@ -69,6 +69,10 @@ var Defaults = Config{
 	RPCGasCap:          50000000,
 	RPCEVMTimeout:      5 * time.Second,
 	GPO:                FullNodeGPO,
+	EquaCrossCheck:     equa.DefaultCrossCheckConfig,
+	EquaFaucet:         equa.DefaultFaucetConfig,
+	EquaAdmin:          equa.DefaultAdminConfig,
+	EquaPoWSolver:      equa.PoWSolverBatched,
 	RPCTxFeeCap:        1, // 1 ether
 }
 
@@ -142,6 +146,25 @@ type Config struct {
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
+	// EQUA ordering cross-check options
+	EquaCrossCheck equa.CrossCheckConfig
+
+	// EQUA test network faucet and onboarding options
+	EquaFaucet equa.FaucetConfig
+
+	// EQUA node management namespace options
+	EquaAdmin equa.AdminConfig
+
+	// File of the EQUA MEV detection rules, in JSON or TOML (built-in rules if empty)
+	EquaMEVRules string `toml:",omitempty"`
+
+	// File of the validator's EQUA threshold key share, written by the genesis ceremony
+	EquaKeyShare string `toml:",omitempty"`
+
+	// PoW solver sealing EQUA blocks, see equa.PoWSolvers, and the threads it runs on (0 = one per CPU)
+	EquaPoWSolver  string `toml:",omitempty"`
+	EquaPoWThreads int    `toml:",omitempty"`
+
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
@@ -173,7 +196,7 @@ func CreateConsensusEngine(config *params.ChainConfig, db ethdb.Database) (conse
 	// Check for EQUA consensus engine first
 	if config.Equa != nil {
 		log.Info("Starting EQUA consensus engine", "chainID", config.ChainID)
-		return equa.New(config.Equa, db), nil
+		return equa.New(config, db), nil
 	}
 
 	if config.TerminalTotalDifficulty == nil {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus/equa"
 	"github.com/equa/go-equa/core"
 	"github.com/equa/go-equa/core/history"
 	"github.com/equa/go-equa/core/txpool/blobpool"
@@ -48,6 +49,13 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TxPool                  legacypool.Config
 		BlobPool                blobpool.Config
 		GPO                     gasprice.Config
+		EquaCrossCheck          equa.CrossCheckConfig
+		EquaFaucet              equa.FaucetConfig
+		EquaAdmin               equa.AdminConfig
+		EquaMEVRules            string `toml:",omitempty"`
+		EquaKeyShare            string `toml:",omitempty"`
+		EquaPoWSolver           string `toml:",omitempty"`
+		EquaPoWThreads          int    `toml:",omitempty"`
 		EnablePreimageRecording bool
 		VMTrace                 string
 		VMTraceJsonConfig       string
@@ -89,6 +97,13 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TxPool = c.TxPool
 	enc.BlobPool = c.BlobPool
 	enc.GPO = c.GPO
+	enc.EquaCrossCheck = c.EquaCrossCheck
+	enc.EquaFaucet = c.EquaFaucet
+	enc.EquaAdmin = c.EquaAdmin
+	enc.EquaMEVRules = c.EquaMEVRules
+	enc.EquaKeyShare = c.EquaKeyShare
+	enc.EquaPoWSolver = c.EquaPoWSolver
+	enc.EquaPoWThreads = c.EquaPoWThreads
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
 	enc.VMTrace = c.VMTrace
 	enc.VMTraceJsonConfig = c.VMTraceJsonConfig
@@ -134,6 +149,13 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TxPool                  *legacypool.Config
 		BlobPool                *blobpool.Config
 		GPO                     *gasprice.Config
+		EquaCrossCheck          *equa.CrossCheckConfig
+		EquaFaucet              *equa.FaucetConfig
+		EquaAdmin               *equa.AdminConfig
+		EquaMEVRules            *string `toml:",omitempty"`
+		EquaKeyShare            *string `toml:",omitempty"`
+		EquaPoWSolver           *string `toml:",omitempty"`
+		EquaPoWThreads          *int    `toml:",omitempty"`
 		EnablePreimageRecording *bool
 		VMTrace                 *string
 		VMTraceJsonConfig       *string
@@ -240,6 +262,27 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.GPO != nil {
 		c.GPO = *dec.GPO
 	}
+	if dec.EquaCrossCheck != nil {
+		c.EquaCrossCheck = *dec.EquaCrossCheck
+	}
+	if dec.EquaFaucet != nil {
+		c.EquaFaucet = *dec.EquaFaucet
+	}
+	if dec.EquaAdmin != nil {
+		c.EquaAdmin = *dec.EquaAdmin
+	}
+	if dec.EquaMEVRules != nil {
+		c.EquaMEVRules = *dec.EquaMEVRules
+	}
+	if dec.EquaKeyShare != nil {
+		c.EquaKeyShare = *dec.EquaKeyShare
+	}
+	if dec.EquaPoWSolver != nil {
+		c.EquaPoWSolver = *dec.EquaPoWSolver
+	}
+	if dec.EquaPoWThreads != nil {
+		c.EquaPoWThreads = *dec.EquaPoWThreads
+	}
 	if dec.EnablePreimageRecording != nil {
 		c.EnablePreimageRecording = *dec.EnablePreimageRecording
 	}
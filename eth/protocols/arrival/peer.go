@@ -0,0 +1,230 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package arrival
+
+import (
+	"fmt"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/lru"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/p2p"
+)
+
+const (
+	maxKnownReceipts = 32768 // Receipts remembered per peer to avoid echoing them
+	maxKnownShares   = 32768 // Decryption shares remembered per peer to avoid echoing them
+	maxQueuedBatches = 128   // Receipt or share batches queued per peer before dropping
+)
+
+// receiptKey identifies the receipt of a validator for a transaction.
+type receiptKey struct {
+	validator common.Address
+	hash      common.Hash
+}
+
+// shareKey identifies the decryption share of a validator for an envelope.
+type shareKey struct {
+	validator common.Address
+	envelope  common.Hash
+}
+
+// peer is a remote node speaking the `arrival` protocol.
+type peer struct {
+	*p2p.Peer
+	version     uint // Protocol version negotiated
+	rw          p2p.MsgReadWriter
+	known       *lru.Cache[receiptKey, struct{}] // Receipts the peer is known to have
+	knownShares *lru.Cache[shareKey, struct{}]   // Decryption shares the peer is known to have
+	queue       chan []*equa.TimestampReceipt    // Receipt batches waiting to be sent
+	shareQueue  chan []*equa.DecryptionShare     // Decryption share batches waiting to be sent
+}
+
+func newPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
+	return &peer{
+		Peer:        p,
+		version:     version,
+		rw:          rw,
+		known:       lru.NewCache[receiptKey, struct{}](maxKnownReceipts),
+		knownShares: lru.NewCache[shareKey, struct{}](maxKnownShares),
+		queue:       make(chan []*equa.TimestampReceipt, maxQueuedBatches),
+		shareQueue:  make(chan []*equa.DecryptionShare, maxQueuedBatches),
+	}
+}
+
+// run handles the peer until the connection fails, importing the receipts and
+// decryption shares it sends and forwarding the backend's new ones to it.
+func (p *peer) run(backend Backend) error {
+	announce := make(chan []*equa.TimestampReceipt, maxQueuedBatches)
+	sub := backend.SubscribeTimestampReceipts(announce)
+	defer sub.Unsubscribe()
+
+	// Peers on the first version of the protocol do not take decryption shares
+	var (
+		announceShares = make(chan []*equa.DecryptionShare, maxQueuedBatches)
+		shareSubErr    <-chan error
+	)
+	if p.version >= ARRIVAL2 {
+		shareSub := backend.SubscribeDecryptionShares(announceShares)
+		defer shareSub.Unsubscribe()
+		shareSubErr = shareSub.Err()
+	}
+	quit := make(chan struct{})
+	defer close(quit)
+
+	errc := make(chan error, 2)
+	go func() { errc <- p.readLoop(backend) }()
+	go func() { errc <- p.writeLoop(quit) }()
+
+	for {
+		select {
+		case receipts := <-announce:
+			// Drop the batch rather than stall the announcements of all peers
+			// if this one does not keep up
+			select {
+			case p.queue <- receipts:
+			default:
+				p.Log().Debug("Dropping timestamp receipts", "count", len(receipts))
+			}
+		case shares := <-announceShares:
+			select {
+			case p.shareQueue <- shares:
+			default:
+				p.Log().Debug("Dropping decryption shares", "count", len(shares))
+			}
+		case err := <-errc:
+			return err
+		case <-sub.Err():
+			return nil
+		case <-shareSubErr:
+			return nil
+		}
+	}
+}
+
+// readLoop imports the receipts and decryption shares sent by the peer.
+func (p *peer) readLoop(backend Backend) error {
+	for {
+		msg, err := p.rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > maxMessageSize {
+			return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
+		}
+		switch {
+		case msg.Code == ReceiptsMsg:
+			var receipts ReceiptsPacket
+			err = msg.Decode(&receipts)
+			msg.Discard()
+			if err != nil {
+				return fmt.Errorf("%w: %v", errDecode, err)
+			}
+			if len(receipts) > maxReceipts {
+				return fmt.Errorf("%w: %d receipts", errTooManyItems, len(receipts))
+			}
+			for _, r := range receipts {
+				p.known.Add(receiptKey{r.Validator, r.Hash}, struct{}{})
+			}
+			backend.AddTimestampReceipts(receipts)
+
+		case msg.Code == DecryptionSharesMsg && p.version >= ARRIVAL2:
+			var shares DecryptionSharesPacket
+			err = msg.Decode(&shares)
+			msg.Discard()
+			if err != nil {
+				return fmt.Errorf("%w: %v", errDecode, err)
+			}
+			if len(shares) > maxShares {
+				return fmt.Errorf("%w: %d decryption shares", errTooManyItems, len(shares))
+			}
+			for _, s := range shares {
+				p.knownShares.Add(shareKey{s.Validator, s.Envelope}, struct{}{})
+			}
+			backend.AddDecryptionShares(shares)
+
+		default:
+			msg.Discard()
+			return fmt.Errorf("%w: %v", errInvalidMsgCode, msg.Code)
+		}
+	}
+}
+
+// writeLoop sends queued receipts and decryption shares the peer does not have
+// yet, until quit is closed.
+func (p *peer) writeLoop(quit <-chan struct{}) error {
+	for {
+		select {
+		case receipts := <-p.queue:
+			if err := p.sendReceipts(receipts); err != nil {
+				return err
+			}
+		case shares := <-p.shareQueue:
+			if err := p.sendShares(shares); err != nil {
+				return err
+			}
+		case <-quit:
+			return nil
+		}
+	}
+}
+
+// sendReceipts sends the receipts of a batch the peer does not have yet.
+func (p *peer) sendReceipts(receipts []*equa.TimestampReceipt) error {
+	unknown := make(ReceiptsPacket, 0, len(receipts))
+	for _, r := range receipts {
+		if !p.known.Contains(receiptKey{r.Validator, r.Hash}) {
+			unknown = append(unknown, r)
+		}
+	}
+	for len(unknown) > 0 {
+		batch := unknown[:min(len(unknown), maxReceipts)]
+		unknown = unknown[len(batch):]
+
+		if err := p2p.Send(p.rw, ReceiptsMsg, batch); err != nil {
+			return err
+		}
+		for _, r := range batch {
+			p.known.Add(receiptKey{r.Validator, r.Hash}, struct{}{})
+		}
+		p.Log().Trace("Sent timestamp receipts", "count", len(batch))
+	}
+	return nil
+}
+
+// sendShares sends the decryption shares of a batch the peer does not have yet.
+func (p *peer) sendShares(shares []*equa.DecryptionShare) error {
+	unknown := make(DecryptionSharesPacket, 0, len(shares))
+	for _, s := range shares {
+		if !p.knownShares.Contains(shareKey{s.Validator, s.Envelope}) {
+			unknown = append(unknown, s)
+		}
+	}
+	for len(unknown) > 0 {
+		batch := unknown[:min(len(unknown), maxShares)]
+		unknown = unknown[len(batch):]
+
+		if err := p2p.Send(p.rw, DecryptionSharesMsg, batch); err != nil {
+			return err
+		}
+		for _, s := range batch {
+			p.knownShares.Add(shareKey{s.Validator, s.Envelope}, struct{}{})
+		}
+		p.Log().Trace("Sent decryption shares", "count", len(batch))
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package arrival
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/event"
+	"github.com/equa/go-equa/p2p"
+	"github.com/equa/go-equa/p2p/enode"
+)
+
+// testBackend accepts every receipt and decryption share it has not seen before.
+type testBackend struct {
+	feed        event.Feed
+	known       map[common.Hash]bool
+	added       chan []*equa.TimestampReceipt
+	shareFeed   event.Feed
+	addedShares chan []*equa.DecryptionShare
+}
+
+func newTestBackend() *testBackend {
+	return &testBackend{
+		known:       make(map[common.Hash]bool),
+		added:       make(chan []*equa.TimestampReceipt, 1),
+		addedShares: make(chan []*equa.DecryptionShare, 1),
+	}
+}
+
+func (b *testBackend) AddTimestampReceipts(receipts []*equa.TimestampReceipt) []*equa.TimestampReceipt {
+	var added []*equa.TimestampReceipt
+	for _, r := range receipts {
+		if !b.known[r.Hash] {
+			b.known[r.Hash] = true
+			added = append(added, r)
+		}
+	}
+	b.added <- added
+	return added
+}
+
+func (b *testBackend) SubscribeTimestampReceipts(ch chan<- []*equa.TimestampReceipt) event.Subscription {
+	return b.feed.Subscribe(ch)
+}
+
+func (b *testBackend) AddDecryptionShares(shares []*equa.DecryptionShare) []*equa.DecryptionShare {
+	b.addedShares <- shares
+	return shares
+}
+
+func (b *testBackend) SubscribeDecryptionShares(ch chan<- []*equa.DecryptionShare) event.Subscription {
+	return b.shareFeed.Subscribe(ch)
+}
+
+// Tests that received receipts are imported and that announced receipts are
+// forwarded, except to the peer they came from.
+func TestGossip(t *testing.T) {
+	backend := newTestBackend()
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	defer remote.Close()
+
+	p := newPeer(ARRIVAL2, p2p.NewPeer(enode.ID{0x01}, "test", nil), local)
+	go p.run(backend)
+
+	received := &equa.TimestampReceipt{Hash: common.Hash{0x01}, Seen: 1}
+	if err := p2p.Send(remote, ReceiptsMsg, ReceiptsPacket{received}); err != nil {
+		t.Fatalf("failed to send receipts: %v", err)
+	}
+	select {
+	case added := <-backend.added:
+		if len(added) != 1 || added[0].Hash != received.Hash {
+			t.Fatalf("unexpected imported receipts: %v", added)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("receipts not imported")
+	}
+	// Wait for the peer to subscribe before announcing
+	for backend.feed.Send([]*equa.TimestampReceipt{received}) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	announced := &equa.TimestampReceipt{Hash: common.Hash{0x02}, Seen: 2}
+	backend.feed.Send([]*equa.TimestampReceipt{announced})
+
+	if err := p2p.ExpectMsg(remote, ReceiptsMsg, ReceiptsPacket{announced}); err != nil {
+		t.Fatalf("announced receipts not forwarded: %v", err)
+	}
+}
+
+// Tests that decryption shares are gossiped on the second version of the
+// protocol and refused on the first.
+func TestGossipDecryptionShares(t *testing.T) {
+	backend := newTestBackend()
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	defer remote.Close()
+
+	p := newPeer(ARRIVAL2, p2p.NewPeer(enode.ID{0x01}, "test", nil), local)
+	go p.run(backend)
+
+	received := &equa.DecryptionShare{Validator: common.Address{0x01}, Envelope: common.Hash{0x01}}
+	if err := p2p.Send(remote, DecryptionSharesMsg, DecryptionSharesPacket{received}); err != nil {
+		t.Fatalf("failed to send decryption shares: %v", err)
+	}
+	select {
+	case added := <-backend.addedShares:
+		if len(added) != 1 || added[0].Envelope != received.Envelope {
+			t.Fatalf("unexpected imported decryption shares: %v", added)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("decryption shares not imported")
+	}
+	// Wait for the peer to subscribe before announcing, the share just
+	// received is known to the peer and not echoed
+	for backend.shareFeed.Send([]*equa.DecryptionShare{received}) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	announced := &equa.DecryptionShare{Validator: common.Address{0x02}, Envelope: common.Hash{0x01}}
+	backend.shareFeed.Send([]*equa.DecryptionShare{announced})
+
+	if err := p2p.ExpectMsg(remote, DecryptionSharesMsg, DecryptionSharesPacket{announced}); err != nil {
+		t.Fatalf("announced decryption shares not forwarded: %v", err)
+	}
+
+	// Peers on the first version must not send decryption shares
+	local1, remote1 := p2p.MsgPipe()
+	defer local1.Close()
+	defer remote1.Close()
+
+	errc := make(chan error, 1)
+	go func() { errc <- newPeer(ARRIVAL1, p2p.NewPeer(enode.ID{0x02}, "test", nil), local1).run(backend) }()
+	go p2p.Send(remote1, DecryptionSharesMsg, DecryptionSharesPacket{received})
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, errInvalidMsgCode) {
+			t.Fatalf("unexpected error: %v, want %v", err, errInvalidMsgCode)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("decryption shares accepted on %s/%d", ProtocolName, ARRIVAL1)
+	}
+}
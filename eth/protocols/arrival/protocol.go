@@ -0,0 +1,103 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package arrival implements the gossip of transaction timestamp receipts, the
+// signed first-seen times EQUA validators use for fair ordering, and of the
+// decryption shares revealing encrypted transactions.
+package arrival
+
+import (
+	"errors"
+
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/event"
+	"github.com/equa/go-equa/p2p"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	ARRIVAL1 = 1
+	ARRIVAL2 = 2
+)
+
+// ProtocolName is the official short name of the `arrival` protocol used during
+// devp2p capability negotiation.
+const ProtocolName = "arrival"
+
+// ProtocolVersions are the supported versions of the `arrival` protocol (first
+// is primary).
+var ProtocolVersions = []uint{ARRIVAL2, ARRIVAL1}
+
+// protocolLengths are the number of implemented message corresponding to
+// different protocol versions.
+var protocolLengths = map[uint]uint64{ARRIVAL2: 2, ARRIVAL1: 1}
+
+const (
+	maxMessageSize = 1024 * 1024 // Maximum cap on the size of a protocol message
+	maxReceipts    = 4096        // Maximum number of receipts in a message
+	maxShares      = 4096        // Maximum number of decryption shares in a message
+)
+
+const (
+	ReceiptsMsg         = 0x00
+	DecryptionSharesMsg = 0x01 // Since ARRIVAL2
+)
+
+var (
+	errMsgTooLarge    = errors.New("message too long")
+	errDecode         = errors.New("invalid message")
+	errInvalidMsgCode = errors.New("invalid message code")
+	errTooManyItems   = errors.New("too many items in message")
+)
+
+// ReceiptsPacket is the network packet for gossiping timestamp receipts.
+type ReceiptsPacket []*equa.TimestampReceipt
+
+// DecryptionSharesPacket is the network packet for gossiping decryption shares.
+type DecryptionSharesPacket []*equa.DecryptionShare
+
+// Backend imports and announces timestamp receipts and decryption shares.
+type Backend interface {
+	// AddTimestampReceipts imports receipts received from a peer, returning
+	// the ones not known before.
+	AddTimestampReceipts(receipts []*equa.TimestampReceipt) []*equa.TimestampReceipt
+
+	// SubscribeTimestampReceipts subscribes to receipts to be gossiped.
+	SubscribeTimestampReceipts(ch chan<- []*equa.TimestampReceipt) event.Subscription
+
+	// AddDecryptionShares imports decryption shares received from a peer,
+	// returning the ones not known before.
+	AddDecryptionShares(shares []*equa.DecryptionShare) []*equa.DecryptionShare
+
+	// SubscribeDecryptionShares subscribes to decryption shares to be gossiped.
+	SubscribeDecryptionShares(ch chan<- []*equa.DecryptionShare) event.Subscription
+}
+
+// MakeProtocols constructs the P2P protocol definitions for `arrival`.
+func MakeProtocols(backend Backend) []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		protocols[i] = p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  protocolLengths[version],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return newPeer(version, p, rw).run(backend)
+			},
+		}
+	}
+	return protocols
+}
@@ -31,6 +31,7 @@ const (
 	NetworkingCategory = "NETWORKING"
 	MinerCategory      = "MINER"
 	GasPriceCategory   = "GAS PRICE ORACLE"
+	EquaCategory       = "EQUA CONSENSUS"
 	VMCategory         = "VIRTUAL MACHINE"
 	LoggingCategory    = "LOGGING AND DEBUGGING"
 	MetricsCategory    = "METRICS AND STATS"
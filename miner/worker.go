@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
 	"github.com/equa/go-equa/consensus/misc/eip1559"
 	"github.com/equa/go-equa/consensus/misc/eip4844"
 	"github.com/equa/go-equa/core"
@@ -459,6 +460,161 @@ func (miner *Miner) commitTransactions(env *environment, plainTxs, blobTxs *tran
 	return nil
 }
 
+// inclusionListSource is implemented by consensus engines publishing lists of
+// transactions the next block must include.
+type inclusionListSource interface {
+	InclusionList(parent *types.Header) []*types.Transaction
+}
+
+// commitInclusionList includes the transactions listed for the block by the
+// proposer of its parent. Transactions that fail to apply are left out, the
+// engine only accepts a block skipping them for reasons it can verify.
+func (miner *Miner) commitInclusionList(env *environment, txs []*types.Transaction, interrupt *atomic.Int32) error {
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	for _, tx := range txs {
+		if interrupt != nil {
+			if signal := interrupt.Load(); signal != commitInterruptNone {
+				return signalToErr(signal)
+			}
+		}
+		if !env.txFitsSize(tx) {
+			log.Debug("Listed transaction exceeds block size", "hash", tx.Hash())
+			continue
+		}
+		env.state.SetTxContext(tx.Hash(), env.tcount)
+		if err := miner.commitTransaction(env, tx); err != nil {
+			log.Debug("Listed transaction failed", "hash", tx.Hash(), "err", err)
+		}
+	}
+	return nil
+}
+
+// txOrderer is implemented by consensus engines deciding the order in which the
+// transactions of a block are executed, rather than the fees they pay. Engines
+// may place transactions of their own among the pending ones, in groups to be
+// included contiguously.
+type txOrderer interface {
+	OrderBlock(chain consensus.ChainHeaderReader, header *types.Header, txs []*types.Transaction) ([]consensus.TxGroup, error)
+}
+
+// commitOrderedTransactions includes the pending transactions in the order the
+// consensus engine decides. A transaction failing to apply is left out, along
+// with the later ones of its sender.
+func (miner *Miner) commitOrderedTransactions(env *environment, orderer txOrderer, pending map[common.Address][]*txpool.LazyTransaction, interrupt *atomic.Int32) error {
+	var txs []*types.Transaction
+	for _, ltxs := range pending {
+		for _, ltx := range ltxs {
+			tx := ltx.Resolve()
+			if tx == nil {
+				log.Trace("Ignoring evicted transaction", "hash", ltx.Hash)
+				break
+			}
+			txs = append(txs, tx)
+		}
+	}
+	groups, err := orderer.OrderBlock(miner.chain, env.header, txs)
+	if err != nil {
+		return err
+	}
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	skipped := make(map[common.Address]bool)
+	for _, group := range groups {
+		if interrupt != nil {
+			if signal := interrupt.Load(); signal != commitInterruptNone {
+				return signalToErr(signal)
+			}
+		}
+		if env.gasPool.Gas() < params.TxGas {
+			log.Trace("Not enough gas for further transactions", "have", env.gasPool, "want", params.TxGas)
+			break
+		}
+		if len(group.Txs) > 1 || group.Atomic {
+			miner.commitGroup(env, group)
+			continue
+		}
+		tx := group.Txs[0]
+		from, _ := types.Sender(env.signer, tx)
+		if skipped[from] {
+			continue
+		}
+		// Transactions left out leave the later ones of their sender unexecutable
+		if env.gasPool.Gas() < tx.Gas() || !env.txFitsSize(tx) {
+			log.Trace("Not enough space left for transaction", "hash", tx.Hash(), "gas", env.gasPool.Gas(), "needed", tx.Gas())
+			skipped[from] = true
+			continue
+		}
+		if tx.Protected() && !miner.chainConfig.IsEIP155(env.header.Number) {
+			log.Trace("Ignoring replay protected transaction", "hash", tx.Hash(), "eip155", miner.chainConfig.EIP155Block)
+			skipped[from] = true
+			continue
+		}
+		env.state.SetTxContext(tx.Hash(), env.tcount)
+
+		err := miner.commitTransaction(env, tx)
+		switch {
+		case errors.Is(err, core.ErrNonceTooLow):
+			// Included already, from the inclusion list or a bundle
+			log.Trace("Skipping transaction with low nonce", "hash", tx.Hash(), "sender", from, "nonce", tx.Nonce())
+
+		case err != nil:
+			log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
+			skipped[from] = true
+		}
+	}
+	return nil
+}
+
+// commitGroup includes a group of transactions contiguously and in order. Atomic
+// groups are reverted as a whole if any of their transactions fails to apply or
+// reverts, others keep the transactions that could be applied.
+func (miner *Miner) commitGroup(env *environment, group consensus.TxGroup) {
+	// Snapshots do not outlive a transaction, keep a copy of the state to revert
+	// atomic groups to
+	var (
+		backup   *state.StateDB
+		gas      = env.gasPool.Gas()
+		gasUsed  = env.header.GasUsed
+		txs      = len(env.txs)
+		sidecars = len(env.sidecars)
+		blobs    = env.blobs
+		size     = env.size
+		tcount   = env.tcount
+		failed   error
+	)
+	if group.Atomic {
+		backup = env.state.Copy()
+	}
+	for _, tx := range group.Txs {
+		if !env.txFitsSize(tx) {
+			failed = errors.New("block size exceeded")
+		} else {
+			env.state.SetTxContext(tx.Hash(), env.tcount)
+			if err := miner.commitTransaction(env, tx); err != nil {
+				failed = err
+			} else if env.receipts[len(env.receipts)-1].Status != types.ReceiptStatusSuccessful {
+				failed = errors.New("execution reverted")
+			}
+		}
+		if failed != nil && group.Atomic {
+			break
+		}
+	}
+	if failed != nil {
+		log.Debug("Grouped transaction failed", "first", group.Txs[0].Hash(), "atomic", group.Atomic, "err", failed)
+		if group.Atomic {
+			env.state, env.evm.StateDB, env.witness = backup, backup, backup.Witness()
+			env.gasPool.SetGas(gas)
+			env.header.GasUsed = gasUsed
+			env.txs, env.receipts, env.sidecars = env.txs[:txs], env.receipts[:txs], env.sidecars[:sidecars]
+			env.blobs, env.size, env.tcount = blobs, size, tcount
+		}
+	}
+}
+
 // fillTransactions retrieves the pending transactions from the txpool and fills them
 // into the given sealing block. The transaction selection and ordering strategy can
 // be customized with the plugin in the future.
@@ -481,6 +637,20 @@ func (miner *Miner) fillTransactions(interrupt *atomic.Int32, env *environment)
 	if miner.chainConfig.IsOsaka(env.header.Number, env.header.Time) {
 		filter.GasLimitCap = params.MaxTxGas
 	}
+	// Include the transactions the proposer of the parent block listed for this
+	// one first
+	if source, ok := miner.engine.(inclusionListSource); ok {
+		if parent := miner.chain.GetHeaderByHash(env.header.ParentHash); parent != nil {
+			if err := miner.commitInclusionList(env, source.InclusionList(parent), interrupt); err != nil {
+				return err
+			}
+		}
+	}
+	// Execute the pending transactions in the order of the consensus engine if
+	// it decides one, as the order of a block cannot change once executed
+	if orderer, ok := miner.engine.(txOrderer); ok {
+		return miner.commitOrderedTransactions(env, orderer, miner.txpool.Pending(filter), interrupt)
+	}
 	filter.OnlyPlainTxs, filter.OnlyBlobTxs = true, false
 	pendingPlainTxs := miner.txpool.Pending(filter)
 
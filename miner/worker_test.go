@@ -0,0 +1,226 @@
+// Copyright 2024 The go-equa Authors
+// This file is part of the go-equa library.
+//
+// The go-equa library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-equa library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-equa library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/consensus"
+	"github.com/equa/go-equa/consensus/equa"
+	"github.com/equa/go-equa/core"
+	"github.com/equa/go-equa/core/rawdb"
+	"github.com/equa/go-equa/core/txpool"
+	"github.com/equa/go-equa/core/txpool/legacypool"
+	"github.com/equa/go-equa/core/types"
+	"github.com/equa/go-equa/crypto"
+	"github.com/equa/go-equa/params"
+)
+
+// equaImportEngine is an EQUA engine accepting any header. The PoW challenge of
+// a sealed header commits to the second it was generated in, so verifying it
+// depends on the wall clock.
+type equaImportEngine struct {
+	*equa.Equa
+}
+
+func (e equaImportEngine) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header) error {
+	return nil
+}
+
+func (e equaImportEngine) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header) (chan<- struct{}, <-chan error) {
+	results := make(chan error, len(headers))
+	for range headers {
+		results <- nil
+	}
+	return make(chan struct{}), results
+}
+
+// equaTestWorker is a miner building on a chain sealed by the EQUA engine, with
+// testBankAddress as its only validator.
+type equaTestWorker struct {
+	*Miner
+	engine *equa.Equa
+	chain  *core.BlockChain
+	txpool *txpool.TxPool
+	signer types.Signer
+}
+
+func newEquaTestWorker(t *testing.T, config *params.EquaConfig, alloc types.GenesisAlloc) *equaTestWorker {
+	t.Helper()
+
+	config.PoWDifficulty = 1000
+	config.InitialValidators = []params.EquaInitialValidator{{
+		Address: testBankAddress,
+		Stake:   new(big.Int).Mul(big.NewInt(32), big.NewInt(params.Ether)),
+	}}
+	chainConfig := *params.MergedTestChainConfig
+	chainConfig.Ethash = nil
+	chainConfig.Equa = config
+
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = equa.New(&chainConfig, db)
+		gspec  = &core.Genesis{Config: &chainConfig, Alloc: alloc}
+	)
+	chain, err := core.NewBlockChain(db, gspec, equaImportEngine{engine}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	pool := legacypool.New(testTxPoolConfig, chain)
+	txpool, _ := txpool.New(testTxPoolConfig.PriceLimit, chain, []txpool.SubPool{pool})
+	t.Cleanup(func() { txpool.Close() })
+
+	return &equaTestWorker{
+		Miner:  New(&testWorkerBackend{db: db, chain: chain, txPool: txpool, genesis: gspec}, testConfig, engine),
+		engine: engine,
+		chain:  chain,
+		txpool: txpool,
+		signer: types.LatestSigner(&chainConfig),
+	}
+}
+
+// transfer signs a transfer of the given nonce and gas price in gwei.
+func (w *equaTestWorker) transfer(key *ecdsa.PrivateKey, nonce uint64, gwei int64) *types.Transaction {
+	return types.MustSignNewTx(key, w.signer, &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &testUserAddress,
+		Value:    big.NewInt(1000),
+		Gas:      params.TxGas,
+		GasPrice: big.NewInt(gwei * params.GWei),
+	})
+}
+
+// buildAndImport builds a block on the chain head, seals it and imports it,
+// returning the imported block.
+func (w *equaTestWorker) buildAndImport(t *testing.T) *types.Block {
+	t.Helper()
+
+	result := w.generateWork(&generateParams{
+		parentHash: w.chain.CurrentBlock().Hash(),
+		timestamp:  uint64(time.Now().Unix()),
+		coinbase:   testBankAddress,
+		beaconRoot: new(common.Hash),
+	}, false)
+	if result.err != nil {
+		t.Fatalf("failed to build block: %v", result.err)
+	}
+	results := make(chan *types.Block, 1)
+	if err := w.engine.Seal(w.chain, result.block, results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	block := <-results
+	if _, err := w.chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to import sealed block: %v", err)
+	}
+	return block
+}
+
+// Tests that a block ordered by the EQUA ordering policy executes the
+// transactions of a sender in nonce order, and that the sealed block imports,
+// under every ordering policy.
+func TestOrderedBlockImport(t *testing.T) {
+	for _, policy := range params.EquaOrderingPolicies {
+		t.Run(policy, func(t *testing.T) { testOrderedBlockImport(t, policy) })
+	}
+}
+
+func testOrderedBlockImport(t *testing.T, policy string) {
+	w := newEquaTestWorker(t, &params.EquaConfig{OrderingPolicy: policy}, types.GenesisAlloc{
+		testBankAddress: {Balance: testBankFunds},
+	})
+	// Raise the gas price with the nonce, for ordering by price to reverse them
+	var txs []*types.Transaction
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		txs = append(txs, w.transfer(testBankKey, nonce, int64(nonce+1)))
+	}
+	for i, err := range w.txpool.Add(txs, true) {
+		if err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	included := w.buildAndImport(t).Transactions()
+	if len(included) != len(txs) {
+		t.Fatalf("included transaction count mismatch: have %d, want %d", len(included), len(txs))
+	}
+	for i, tx := range included {
+		if tx.Nonce() != uint64(i) {
+			t.Fatalf("transaction %d nonce mismatch: have %d, want %d", i, tx.Nonce(), i)
+		}
+	}
+	state, err := w.chain.State()
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	if nonce := state.GetNonce(testBankAddress); nonce != uint64(len(txs)) {
+		t.Fatalf("sender nonce mismatch: have %d, want %d", nonce, len(txs))
+	}
+}
+
+// Tests that bundles are executed contiguously among the pool transactions, and
+// that an atomic bundle with a failing transaction is left out as a whole.
+func TestBundleBlockImport(t *testing.T) {
+	failKey, _ := crypto.GenerateKey()
+	w := newEquaTestWorker(t, &params.EquaConfig{Features: map[string]bool{equa.FeatureBundles: true}}, types.GenesisAlloc{
+		testBankAddress: {Balance: testBankFunds},
+		testUserAddress: {Balance: testBankFunds},
+		crypto.PubkeyToAddress(failKey.PublicKey): {Balance: testBankFunds},
+	})
+	var pooled []*types.Transaction
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		pooled = append(pooled, w.transfer(testBankKey, nonce, 1))
+	}
+	for i, err := range w.txpool.Add(pooled, true) {
+		if err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	var (
+		api     = w.engine.APIs(w.chain)[0].Service.(*equa.API)
+		bundled = []*types.Transaction{w.transfer(testUserKey, 0, 1), w.transfer(testUserKey, 1, 1)}
+		failing = []*types.Transaction{w.transfer(failKey, 0, 1), w.transfer(failKey, 2, 1)}
+	)
+	for _, txs := range [][]*types.Transaction{bundled, failing} {
+		args := equa.BundleArgs{Atomic: true}
+		for _, tx := range txs {
+			enc, _ := tx.MarshalBinary()
+			args.Transactions = append(args.Transactions, enc)
+		}
+		if _, err := api.SendBundle(args); err != nil {
+			t.Fatalf("failed to send bundle: %v", err)
+		}
+	}
+	included := w.buildAndImport(t).Transactions()
+	if len(included) != len(pooled)+len(bundled) {
+		t.Fatalf("included transaction count mismatch: have %d, want %d", len(included), len(pooled)+len(bundled))
+	}
+	for i, tx := range included {
+		if tx.Hash() != bundled[0].Hash() {
+			continue
+		}
+		if i+1 == len(included) || included[i+1].Hash() != bundled[1].Hash() {
+			t.Fatalf("bundle not included contiguously: %v", included)
+		}
+		return
+	}
+	t.Fatal("bundle not included")
+}
@@ -430,6 +430,8 @@ func (n *Node) startRPC() error {
 	}
 
 	initAuth := func(port int, secret []byte) error {
+		modules := authModules(allAPIs)
+
 		// Enable auth via HTTP
 		server := n.httpAuth
 		if err := server.setListenAddr(n.config.AuthAddr, port); err != nil {
@@ -444,7 +446,7 @@ func (n *Node) startRPC() error {
 		err := server.enableRPC(allAPIs, httpConfig{
 			CorsAllowedOrigins: DefaultAuthCors,
 			Vhosts:             n.config.AuthVirtualHosts,
-			Modules:            DefaultAuthModules,
+			Modules:            modules,
 			prefix:             DefaultAuthPrefix,
 			rpcEndpointConfig:  sharedConfig,
 		})
@@ -459,7 +461,7 @@ func (n *Node) startRPC() error {
 			return err
 		}
 		if err := server.enableWS(allAPIs, wsConfig{
-			Modules:           DefaultAuthModules,
+			Modules:           modules,
 			Origins:           DefaultAuthOrigins,
 			prefix:            DefaultAuthPrefix,
 			rpcEndpointConfig: sharedConfig,
@@ -590,6 +592,18 @@ func (n *Node) getAPIs() (unauthenticated, all []rpc.API) {
 	return unauthenticated, n.rpcAPIs
 }
 
+// authModules returns the namespaces served on the authenticated endpoint: the
+// default ones and those of all APIs only available behind authentication.
+func authModules(apis []rpc.API) []string {
+	modules := slices.Clone(DefaultAuthModules)
+	for _, api := range apis {
+		if api.Authenticated && !slices.Contains(modules, api.Namespace) {
+			modules = append(modules, api.Namespace)
+		}
+	}
+	return modules
+}
+
 // RegisterHandler mounts a handler on the given path on the canonical HTTP server.
 //
 // The name of the handler is shown in a log message when the HTTP server starts
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
@@ -197,6 +198,19 @@ func TestAuthEndpoints(t *testing.T) {
 	}
 }
 
+// Tests that the namespaces of all authenticated APIs are served on the
+// authenticated endpoint, next to the default ones.
+func TestAuthModules(t *testing.T) {
+	apis := []rpc.API{
+		{Namespace: "engine", Authenticated: true},
+		{Namespace: "web3"},
+		{Namespace: "admin2", Authenticated: true},
+	}
+	if modules := authModules(apis); !slices.Equal(modules, []string{"eth", "engine", "admin2"}) {
+		t.Fatalf("auth modules mismatch: have %v", modules)
+	}
+}
+
 func noneAuth(secret [32]byte) rpc.HTTPAuth {
 	return func(header http.Header) error {
 		token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
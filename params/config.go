@@ -21,8 +21,10 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"slices"
 
 	"github.com/equa/go-equa/common"
+	"github.com/equa/go-equa/common/hexutil"
 	"github.com/equa/go-equa/params/forks"
 )
 
@@ -558,6 +560,212 @@ type EquaConfig struct {
 	PoWDifficulty       uint64 `json:"powDifficulty"`       // Lightweight PoW difficulty for randomness
 	ValidatorReward     uint64 `json:"validatorReward"`     // Block reward for validators in wei
 	SlashingPercentage  uint64 `json:"slashingPercentage"`  // Percentage of stake to slash for MEV extraction
+
+	// EvidenceMaxAge is the number of epochs after an offense during which
+	// slashing evidence for it is still accepted. Zero selects the default.
+	EvidenceMaxAge uint64 `json:"evidenceMaxAge,omitempty"`
+
+	// BuilderMinOrderingScore is the minimum fair ordering score, in percent,
+	// a payload from an external builder needs to be accepted. Zero selects
+	// the default.
+	BuilderMinOrderingScore uint64 `json:"builderMinOrderingScore,omitempty"`
+
+	// Committees is the number of committees the shuffled validator set is
+	// split into every epoch. Zero selects the default.
+	Committees uint64 `json:"committees,omitempty"`
+
+	// UnbondingEpochs is the number of epochs the stake of an exited validator
+	// stays bonded, and slashable, before it can be withdrawn. Zero selects
+	// the default.
+	UnbondingEpochs uint64 `json:"unbondingEpochs,omitempty"`
+
+	// ChurnLimit is the maximum number of queued validators activated at an
+	// epoch boundary. Zero selects the default.
+	ChurnLimit uint64 `json:"churnLimit,omitempty"`
+
+	// RetargetWindow is the number of recent blocks the PoW difficulty is
+	// retargeted over. Zero selects the default.
+	RetargetWindow uint64 `json:"retargetWindow,omitempty"`
+
+	// RetargetMaxChange is the largest change, in percent, of the PoW
+	// difficulty from the average of the retarget window. Zero selects the
+	// default.
+	RetargetMaxChange uint64 `json:"retargetMaxChange,omitempty"`
+
+	// MinPoWDifficulty is the lowest PoW difficulty retargeting can reach.
+	// Zero selects the default.
+	MinPoWDifficulty uint64 `json:"minPoWDifficulty,omitempty"`
+
+	// ArrivalCacheSize is the number of transactions whose arrival times are
+	// remembered for fair ordering. Zero selects the default.
+	ArrivalCacheSize uint64 `json:"arrivalCacheSize,omitempty"`
+
+	// ArrivalCacheTTL is the number of seconds the arrival time of a
+	// transaction is remembered at most. Zero selects the default.
+	ArrivalCacheTTL uint64 `json:"arrivalCacheTTL,omitempty"`
+
+	// OrderingPolicy is the policy the transactions of sealed blocks are
+	// ordered with, see EquaOrderingPolicies. Empty selects strict
+	// first-come-first-served ordering.
+	OrderingPolicy string `json:"orderingPolicy,omitempty"`
+
+	// OrderingWindow is the length, in milliseconds, of the arrival time
+	// windows the batching ordering policies order transactions in. Zero
+	// selects the default.
+	OrderingWindow uint64 `json:"orderingWindow,omitempty"`
+
+	// ValidatorClasses defines the staking requirements of the validators, each
+	// falling in the class with the highest minimum stake it meets. If empty, a
+	// single "standard" class requiring 32 EQUA is used.
+	ValidatorClasses []EquaValidatorClass `json:"validatorClasses,omitempty"`
+
+	// InitialValidators is the validator set committed to at genesis, usually
+	// produced by the genesis ceremony tooling.
+	InitialValidators []EquaInitialValidator `json:"initialValidators,omitempty"`
+
+	// StakingContract is the contract whose registry the validator set is
+	// derived from at every epoch boundary. If unset, the validator set is
+	// maintained from the initial validators and deposit proofs only.
+	StakingContract common.Address `json:"stakingContract,omitempty"`
+
+	// ThresholdPublicKey is the master public key for transaction encryption
+	// produced by the threshold key ceremony of the initial validators.
+	ThresholdPublicKey hexutil.Bytes `json:"thresholdPublicKey,omitempty"`
+
+	// Features switches optional engine subsystems on or off by name. Features
+	// not listed keep their default, see EquaFeatures.
+	Features map[string]bool `json:"features,omitempty"`
+
+	// SlashingPenalties sets the share of stake slashed, in percent, for
+	// violations by name. Violations not listed keep their default, see
+	// EquaPenalties.
+	SlashingPenalties map[string]uint64 `json:"slashingPenalties,omitempty"`
+}
+
+// EquaFeature describes an optional subsystem of the EQUA engine that can be
+// switched on or off through EquaConfig.Features.
+type EquaFeature struct {
+	Name         string // Name used in the configuration
+	Description  string // Short description shown to operators
+	Experimental bool   // Whether the feature is not yet considered safe for production
+	Default      bool   // Whether the feature is enabled if not configured
+}
+
+// EquaFeatures lists the features known to this release. Experimental features
+// must default to disabled. New features must be appended, as the position of a
+// feature is the bit proposers signal readiness for it with.
+var EquaFeatures = []EquaFeature{
+	{Name: "encrypted-mempool", Description: "commit-reveal flow of threshold encrypted transactions", Experimental: true},
+	{Name: "builder-market", Description: "payloads from external builders passing the fairness checks", Default: true},
+	{Name: "bundles", Description: "contiguous, optionally atomic inclusion of transaction bundles", Experimental: true},
+	{Name: "compliance-statements", Description: "signed proposer statements of ordering policy compliance, required in every block", Experimental: true},
+	{Name: "version-signaling", Description: "software version and feature readiness signals in the extra-data of produced blocks", Experimental: true},
+	{Name: "slashing-execution", Description: "on-chain slashing and burning of stake for evidence transactions proving false compliance statements", Experimental: true},
+	{Name: "difficulty-retargeting", Description: "PoW difficulty retargeted every block so block times track the configured period", Experimental: true},
+	{Name: "inclusion-lists", Description: "signed lists of pending transactions the next block must include, carried in compliance statements", Experimental: true},
+	{Name: "validator-set-commitments", Description: "hash of the validator set proposers are drawn from in the extra-data of epoch boundary blocks", Experimental: true},
+	{Name: "ordering-commitments", Description: "signed proposer claims of the arrival times, ordering score and MEV of their block, carried in compliance statements", Experimental: true},
+	{Name: "effective-gas-price", Description: "MEV and slashing heuristics of the state transition price transactions at their effective gas price for the block's base fee", Experimental: true},
+}
+
+// equaFeature returns the registered feature with the given name, or nil.
+func equaFeature(name string) *EquaFeature {
+	for i := range EquaFeatures {
+		if EquaFeatures[i].Name == name {
+			return &EquaFeatures[i]
+		}
+	}
+	return nil
+}
+
+// FeatureEnabled reports whether the named feature is switched on, falling back
+// to its default if it is not configured. Unknown features are disabled.
+func (c *EquaConfig) FeatureEnabled(name string) bool {
+	if enabled, ok := c.Features[name]; ok {
+		return enabled
+	}
+	if feature := equaFeature(name); feature != nil {
+		return feature.Default
+	}
+	return false
+}
+
+// EquaPenalty is the default share of stake slashed for a violation, which can
+// be overridden through EquaConfig.SlashingPenalties.
+type EquaPenalty struct {
+	Name       string // Name used in the configuration
+	Percentage uint64 // Share of the stake slashed, in percent
+}
+
+// Ordering policies the transactions of sealed blocks can be ordered with.
+const (
+	EquaOrderingFCFS            = "fcfs"             // Strictly by arrival time
+	EquaOrderingPriorityAuction = "priority-auction" // By arrival window, by effective gas price within a window
+	EquaOrderingRandomBatch     = "random-batch"     // By arrival window, shuffled within a window
+)
+
+// EquaOrderingPolicies lists the ordering policies known to this release.
+var EquaOrderingPolicies = []string{EquaOrderingFCFS, EquaOrderingPriorityAuction, EquaOrderingRandomBatch}
+
+// EquaPenaltyMEVExtraction is the violation penalized by SlashingPercentage
+// unless configured in SlashingPenalties.
+const EquaPenaltyMEVExtraction = "mev-extraction"
+
+// EquaPenalties lists the violations the engine slashes for, with the penalty
+// applied if not configured. The last one covers violations not listed.
+var EquaPenalties = []EquaPenalty{
+	{Name: EquaPenaltyMEVExtraction},
+	{Name: "transaction-reordering", Percentage: 10},
+	{Name: "transaction-censorship", Percentage: 20},
+	{Name: "validator-collusion", Percentage: 100}, // Total slash for collusion
+	{Name: "false-statement", Percentage: 50},      // Signed lies about ordering are provable, unlike heuristics
+	{Name: "invalid-block", Percentage: 5},         // Repeatedly signing invalid blocks wastes the network's resources
+	{Name: "double-proposal", Percentage: 100},     // Total slash for equivocation, as for double signing
+	{Name: "share-withholding", Percentage: 5},     // Withheld decryption shares stall encrypted transactions
+	{Name: "other", Percentage: 5},                 // Default minor slash
+}
+
+// equaPenalty returns the registered penalty with the given name, or nil.
+func equaPenalty(name string) *EquaPenalty {
+	for i := range EquaPenalties {
+		if EquaPenalties[i].Name == name {
+			return &EquaPenalties[i]
+		}
+	}
+	return nil
+}
+
+// SlashingPenalty returns the share of stake slashed, in percent, for the named
+// violation, falling back to its default if it is not configured. Unknown
+// violations are penalized like "other" ones.
+func (c *EquaConfig) SlashingPenalty(name string) uint64 {
+	if equaPenalty(name) == nil {
+		name = EquaPenalties[len(EquaPenalties)-1].Name
+	}
+	if percentage, ok := c.SlashingPenalties[name]; ok {
+		return percentage
+	}
+	if name == EquaPenaltyMEVExtraction {
+		return c.SlashingPercentage
+	}
+	return equaPenalty(name).Percentage
+}
+
+// EquaInitialValidator is a validator registered in the genesis of an EQUA
+// network.
+type EquaInitialValidator struct {
+	Address   common.Address `json:"address"`   // Account of the validator
+	Stake     *big.Int       `json:"stake"`     // Initial stake in wei
+	PublicKey hexutil.Bytes  `json:"publicKey"` // BLS public key of the validator
+}
+
+// EquaValidatorClass defines the stake requirements, selection weight cap and
+// reward multiplier of a class of EQUA validators.
+type EquaValidatorClass struct {
+	Name             string   `json:"name"`                       // Unique name of the class
+	MinStake         *big.Int `json:"minStake"`                   // Minimum stake in wei to be eligible
+	MaxWeight        uint64   `json:"maxWeight,omitempty"`        // Cap on stake weight in basis points, zero for uncapped
+	RewardMultiplier uint64   `json:"rewardMultiplier,omitempty"` // Block reward multiplier in percent, zero for 100%
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -566,6 +774,75 @@ func (c EquaConfig) String() string {
 		c.Period, c.Epoch, c.ThresholdShares, c.MEVBurnPercentage)
 }
 
+// MaxEvidenceAge is the upper bound on EquaConfig.EvidenceMaxAge, in epochs.
+const MaxEvidenceAge = 64
+
+// validate checks the EQUA configuration for values the engine cannot safely
+// operate with.
+func (c *EquaConfig) validate() error {
+	// The evidence window trades safety against state growth: a short window
+	// lets offenders escape punishment if evidence propagates slowly or nodes
+	// are offline, while a long one forces every node to retain offense history
+	// and the stake it applies to for longer, and lets stale evidence slash
+	// validators whose stake has since changed hands.
+	if c.EvidenceMaxAge > MaxEvidenceAge {
+		return fmt.Errorf("evidenceMaxAge %d exceeds maximum of %d epochs", c.EvidenceMaxAge, MaxEvidenceAge)
+	}
+	if c.MEVBurnPercentage > 100 {
+		return fmt.Errorf("mevBurnPercentage %d exceeds 100", c.MEVBurnPercentage)
+	}
+	if c.SlashingPercentage > 100 {
+		return fmt.Errorf("slashingPercentage %d exceeds 100", c.SlashingPercentage)
+	}
+	if c.RetargetMaxChange >= 100 {
+		return fmt.Errorf("retargetMaxChange %d must be below 100", c.RetargetMaxChange)
+	}
+	names := make(map[string]bool)
+	for i, class := range c.ValidatorClasses {
+		switch {
+		case class.Name == "":
+			return fmt.Errorf("validator class %d has no name", i)
+		case names[class.Name]:
+			return fmt.Errorf("duplicate validator class %q", class.Name)
+		case class.MinStake == nil || class.MinStake.Sign() <= 0:
+			return fmt.Errorf("validator class %q has no minimum stake", class.Name)
+		case class.MaxWeight > 10000:
+			return fmt.Errorf("validator class %q weight cap %d exceeds 10000 basis points", class.Name, class.MaxWeight)
+		}
+		names[class.Name] = true
+	}
+	seen := make(map[common.Address]bool)
+	for i, validator := range c.InitialValidators {
+		switch {
+		case seen[validator.Address]:
+			return fmt.Errorf("duplicate initial validator %s", validator.Address)
+		case validator.Stake == nil || validator.Stake.Sign() <= 0:
+			return fmt.Errorf("initial validator %d (%s) has no stake", i, validator.Address)
+		}
+		seen[validator.Address] = true
+	}
+	for name := range c.Features {
+		if equaFeature(name) == nil {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+	}
+	if c.OrderingPolicy != "" && !slices.Contains(EquaOrderingPolicies, c.OrderingPolicy) {
+		return fmt.Errorf("unknown ordering policy %q", c.OrderingPolicy)
+	}
+	if c.FeatureEnabled("inclusion-lists") && !c.FeatureEnabled("compliance-statements") {
+		return fmt.Errorf("feature %q requires %q", "inclusion-lists", "compliance-statements")
+	}
+	for name, percentage := range c.SlashingPenalties {
+		switch {
+		case equaPenalty(name) == nil:
+			return fmt.Errorf("unknown slashing penalty %q", name)
+		case percentage > 100:
+			return fmt.Errorf("slashing penalty %q of %d%% exceeds 100", name, percentage)
+		}
+	}
+	return nil
+}
+
 // Description returns a human-readable description of ChainConfig.
 func (c *ChainConfig) Description() string {
 	var banner string
@@ -958,6 +1235,11 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			}
 		}
 	}
+	if c.Equa != nil {
+		if err := c.Equa.validate(); err != nil {
+			return fmt.Errorf("invalid equa configuration: %v", err)
+		}
+	}
 	return nil
 }
 
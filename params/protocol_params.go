@@ -219,4 +219,13 @@ var (
 	// EIP-7251 - Increase the MAX_EFFECTIVE_BALANCE
 	ConsolidationQueueAddress = common.HexToAddress("0x0000BBdDc7CE488642fb579F8B00f3a590007251")
 	ConsolidationQueueCode    = common.FromHex("3373fffffffffffffffffffffffffffffffffffffffe1460d35760115f54807fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff1461019a57600182026001905f5b5f82111560685781019083028483029004916001019190604d565b9093900492505050366060146088573661019a573461019a575f5260205ff35b341061019a57600154600101600155600354806004026004013381556001015f358155600101602035815560010160403590553360601b5f5260605f60143760745fa0600101600355005b6003546002548082038060021160e7575060025b5f5b8181146101295782810160040260040181607402815460601b815260140181600101548152602001816002015481526020019060030154905260010160e9565b910180921461013b5790600255610146565b90505f6002555f6003555b5f54807fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff141561017357505f5b6001546001828201116101885750505f61018e565b01600190035b5f555f6001556074025ff35b5f5ffd")
+
+	// EQUA - Slashing evidence, transactions sent here carry proofs of validator offenses
+	EquaSlashingAddress = common.HexToAddress("0x000000000000000000000000000000000000E5A5")
+
+	// EQUA - Voluntary exits, transactions sent here carry exits signed by validators
+	EquaExitAddress = common.HexToAddress("0x000000000000000000000000000000000000E817")
+
+	// EQUA - Validator registry, the stake and status of every validator are kept in its storage
+	EquaValidatorsAddress = common.HexToAddress("0x000000000000000000000000000000000000E5E7")
 )
@@ -303,6 +303,26 @@ var (
 		accounts.MimetypeClique,
 		0x02,
 	}
+	ApplicationEquaStatement = SigFormat{
+		accounts.MimetypeEquaStatement,
+		0x02,
+	}
+	ApplicationEquaTimestamp = SigFormat{
+		accounts.MimetypeEquaTimestamp,
+		0x02,
+	}
+	ApplicationEquaDecryption = SigFormat{
+		accounts.MimetypeEquaDecryption,
+		0x02,
+	}
+	ApplicationEquaInclusionList = SigFormat{
+		accounts.MimetypeEquaInclusionList,
+		0x02,
+	}
+	ApplicationEquaOrderingClaim = SigFormat{
+		accounts.MimetypeEquaOrderingClaim,
+		0x02,
+	}
 	TextPlain = SigFormat{
 		accounts.MimetypeTextPlain,
 		0x45,
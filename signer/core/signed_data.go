@@ -17,6 +17,7 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -33,6 +34,16 @@ import (
 	"github.com/equa/go-equa/signer/core/apitypes"
 )
 
+// equaSigDomains are the prefixes of the EQUA consensus data signed under each
+// content type, as produced by the consensus engine.
+var equaSigDomains = map[string]string{
+	apitypes.ApplicationEquaStatement.Mime:     "equa-compliance-statement",
+	apitypes.ApplicationEquaTimestamp.Mime:     "equa-timestamp-receipt",
+	apitypes.ApplicationEquaDecryption.Mime:    "equa-decryption-share",
+	apitypes.ApplicationEquaInclusionList.Mime: "equa-inclusion-list",
+	apitypes.ApplicationEquaOrderingClaim.Mime: "equa-ordering-claim",
+}
+
 // sign receives a request and produces a signature
 //
 // Note, the produced signature conforms to the secp256k1 curve R, S and V values,
@@ -164,6 +175,28 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		// Clique uses V on the form 0 or 1
 		useEthereumV = false
 		req = &SignDataRequest{ContentType: mediaType, Rawdata: cliqueRlp, Messages: messages, Hash: sighash}
+	case apitypes.ApplicationEquaStatement.Mime, apitypes.ApplicationEquaTimestamp.Mime, apitypes.ApplicationEquaDecryption.Mime, apitypes.ApplicationEquaInclusionList.Mime, apitypes.ApplicationEquaOrderingClaim.Mime:
+		// EQUA consensus data is signed raw, like Clique headers. Only data
+		// carrying the domain prefix of its type is accepted, so that nothing
+		// else, e.g. a transaction, can be signed under these types.
+		equaData, err := fromHex(data)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		domain := equaSigDomains[mediaType]
+		if !bytes.HasPrefix(equaData, []byte(domain)) {
+			return nil, useEthereumV, fmt.Errorf("%s data without %q prefix", mediaType, domain)
+		}
+		messages := []*apitypes.NameValueType{
+			{
+				Name:  "EQUA consensus data",
+				Typ:   "hexdata",
+				Value: fmt.Sprintf("%s %#x", domain, equaData[len(domain):]),
+			},
+		}
+		// EQUA uses V on the form 0 or 1
+		useEthereumV = false
+		req = &SignDataRequest{ContentType: mediaType, Rawdata: equaData, Messages: messages, Hash: crypto.Keccak256(equaData)}
 	case apitypes.DataTyped.Mime:
 		// EIP-712 conformant typed data
 		var err error
@@ -246,6 +246,27 @@ func TestSignData(t *testing.T) {
 	} else if have := signature; !bytes.Equal(have, want) {
 		t.Fatalf("want %x, have %x", want, have)
 	}
+
+	// EQUA consensus data is signed raw, with V on the form 0 or 1
+	statement := append([]byte("equa-compliance-statement"), crypto.Keccak256([]byte("header"))...)
+	control.approveCh <- "Y"
+	control.inputCh <- "a_long_password"
+	signature, err = api.SignData(context.Background(), apitypes.ApplicationEquaStatement.Mime, a, hexutil.Encode(statement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signature) != 65 || signature[64] > 1 {
+		t.Fatalf("Expected 65 byte signature with V 0 or 1, got %x", signature)
+	}
+	if pub, err := crypto.SigToPub(crypto.Keccak256(statement), signature); err != nil {
+		t.Fatal(err)
+	} else if have := crypto.PubkeyToAddress(*pub); have != a.Address() {
+		t.Errorf("Wrong signer: want %x, have %x", a.Address(), have)
+	}
+	// EQUA consensus data of the wrong type is rejected before asking the user
+	if _, err = api.SignData(context.Background(), apitypes.ApplicationEquaTimestamp.Mime, a, hexutil.Encode(statement)); err == nil {
+		t.Error("Expected error signing a statement as a timestamp receipt")
+	}
 }
 
 func TestDomainChainId(t *testing.T) {